@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 
 	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"github.com/teslamotors/vehicle-command/pkg/version"
 )
 
 func usage() {
@@ -32,9 +33,20 @@ func main() {
 		return
 	}
 
+	var printVersion bool
 	flag.StringVar(&config.KeyringTokenName, "token-name", "", "Name to use for keyring entry")
+	flag.BoolVar(&printVersion, "version", false, "Print version information and exit")
 	flag.Usage = usage
 	flag.Parse()
+	if printVersion {
+		version.Print()
+		returnCode = 0
+		return
+	}
+	if err := config.ReadFromProfile(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
 	config.ReadFromEnvironment()
 
 	if config.KeyringTokenName == "" {
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+// placeholderVIN is used when encoding commands without -vin. The VIN isn't part of the encoded
+// payload, but some commands use it to build messages.
+const placeholderVIN = "00000000000000000"
+
+const (
+	formatBase64 = "base64"
+	formatHex    = "hex"
+	formatJSON   = "json"
+)
+
+// offlineCommands are handled without loading credentials or connecting to a vehicle.
+var offlineCommands = map[string]func(vin string, args []string, out io.Writer) error{
+	"encode":        runEncode,
+	"decode":        runDecode,
+	"list-commands": runListCommands,
+}
+
+func encodeBytes(format string, data []byte) (string, error) {
+	switch format {
+	case formatBase64:
+		return base64.StdEncoding.EncodeToString(data), nil
+	case formatHex:
+		return hex.EncodeToString(data), nil
+	}
+	return "", fmt.Errorf("unrecognized format '%s' (expected %s, %s, or %s)", format, formatBase64, formatHex, formatJSON)
+}
+
+// runEncode prints the unsigned payload that a tesla-control command sends to the vehicle. For
+// example, "encode -format json charging-set-limit 80".
+func runEncode(vin string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("encode", flag.ContinueOnError)
+	format := flags.String("format", formatBase64, "Output `format`: base64, hex, or json")
+	envelope := flags.Bool("envelope", false, "Print the RoutableMessage envelope instead of only its payload")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		return errors.New("usage: encode [-format base64|hex|json] [-envelope] COMMAND [ARG...]")
+	}
+
+	info, ok := commands[args[0]]
+	if !ok {
+		return ErrUnknownCommand
+	}
+	if info.requiresFleetAPI {
+		return fmt.Errorf("%s is executed by Tesla's servers and has no vehicle payload", args[0])
+	}
+	keywords, err := info.parseArgs(args)
+	if err != nil {
+		info.Usage(args[0])
+		return err
+	}
+	if vin == "" {
+		vin = placeholderVIN
+	}
+	message, err := vehicle.CaptureMessage(vin, func(car *vehicle.Vehicle) error {
+		return info.handler(context.Background(), nil, car, keywords)
+	})
+	if err != nil {
+		return err
+	}
+
+	var encoded proto.Message = message
+	payload := message.GetProtobufMessageAsBytes()
+	if !*envelope {
+		encoded = protocol.NewPayloadMessage(message.GetToDestination().GetDomain(), false)
+		if encoded == nil {
+			return fmt.Errorf("unrecognized destination domain %s", message.GetToDestination().GetDomain())
+		}
+		if err := proto.Unmarshal(payload, encoded); err != nil {
+			return err
+		}
+	}
+
+	if *format == formatJSON {
+		rendered, err := protocol.MarshalJSON(encoded, "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(rendered))
+		return nil
+	}
+	if *envelope {
+		if payload, err = proto.Marshal(message); err != nil {
+			return err
+		}
+	}
+	rendered, err := encodeBytes(*format, payload)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, rendered)
+	return nil
+}
+
+// runDecode pretty-prints a base64 (or hex) RoutableMessage, including its payload when the payload
+// isn't encrypted.
+func runDecode(_ string, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: decode MESSAGE (base64 or hex encoded RoutableMessage)")
+	}
+	input := strings.TrimSpace(args[0])
+	// Valid hex is usually valid base64 as well, so try hex first.
+	raw, err := hex.DecodeString(input)
+	if err != nil {
+		if raw, err = base64.StdEncoding.DecodeString(input); err != nil {
+			return errors.New("message must be base64 or hex encoded")
+		}
+	}
+
+	var message universal.RoutableMessage
+	if err := proto.Unmarshal(raw, &message); err != nil {
+		return fmt.Errorf("not a RoutableMessage: %w", err)
+	}
+	rendered, err := protocol.MarshalJSON(&message, "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, string(rendered))
+
+	if message.GetSignatureData().GetAES_GCM_PersonalizedData() != nil || message.GetSignatureData().GetAES_GCM_ResponseData() != nil {
+		fmt.Fprintln(out, "Payload is encrypted.")
+		return nil
+	}
+	payload := message.GetProtobufMessageAsBytes()
+	if len(payload) == 0 {
+		return nil
+	}
+	// Messages sent to the vehicle are addressed to a domain; responses come from one.
+	domain, fromVehicle := message.GetToDestination().GetDomain(), false
+	if fromDomain := message.GetFromDestination().GetDomain(); fromDomain != universal.Domain_DOMAIN_BROADCAST {
+		domain, fromVehicle = fromDomain, true
+	}
+	decoded := protocol.NewPayloadMessage(domain, fromVehicle)
+	if decoded == nil {
+		return nil
+	}
+	if err := proto.Unmarshal(payload, decoded); err != nil {
+		return fmt.Errorf("couldn't decode %s payload: %w", domain, err)
+	}
+	if rendered, err = protocol.MarshalJSON(decoded, "  "); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, string(rendered))
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncodePayloadJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := runEncode("", []string{"-format", "json", "charging-set-limit", "80"}, &out); err != nil {
+		t.Fatalf("encode failed: %s", err)
+	}
+	if !strings.Contains(out.String(), `"percent": 80`) {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	for _, format := range []string{formatBase64, formatHex} {
+		var encoded bytes.Buffer
+		if err := runEncode("", []string{"-envelope", "-format", format, "honk"}, &encoded); err != nil {
+			t.Fatalf("encode failed: %s", err)
+		}
+		var decoded bytes.Buffer
+		if err := runDecode("", []string{encoded.String()}, &decoded); err != nil {
+			t.Fatalf("decode of %q failed: %s", encoded.String(), err)
+		}
+		output := decoded.String()
+		if !strings.Contains(output, "DOMAIN_INFOTAINMENT") || !strings.Contains(output, "vehicleControlHonkHornAction") {
+			t.Errorf("Unexpected decode output: %s", output)
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	var out bytes.Buffer
+	for _, args := range [][]string{
+		{},
+		{"not-a-command"},
+		{"-format", "octal", "honk"},
+		{"charging-set-limit"},
+	} {
+		if err := runEncode("", args, &out); err == nil {
+			t.Errorf("Expected error for encode %v", args)
+		}
+	}
+	if err := runDecode("", []string{"!!!"}, &out); err == nil {
+		t.Errorf("Expected error for invalid encoding")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -10,7 +11,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/teslamotors/vehicle-command/internal/log"
+	"github.com/teslamotors/vehicle-command/internal/units"
 	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
 	"github.com/teslamotors/vehicle-command/pkg/cli"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
@@ -21,7 +25,7 @@ import (
 
 var (
 	ErrCommandLineArgs = errors.New("invalid command line arguments")
-	ErrInvalidTime     = errors.New("invalid time")
+	ErrInvalidTime     = units.ErrInvalidTime
 	dayNamesBitMask    = map[string]int32{
 		"SUN":       1,
 		"SUNDAY":    1,
@@ -49,6 +53,8 @@ type Argument struct {
 
 type Handler func(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, args map[string]string) error
 
+// Command describes a tesla-control command. Everything except the handler comes from the
+// command's entry in the catalog package, which the HTTP proxy also uses.
 type Command struct {
 	help             string
 	requiresAuth     bool // True if command requires client-to-vehicle authentication (private key)
@@ -57,6 +63,42 @@ type Command struct {
 	optional         []Argument
 	handler          Handler
 	domain           protocol.Domain
+	capability       vehicle.Capability // Hardware the command requires, if any
+}
+
+// commands combines handlers with their catalog entries.
+var commands = newCommands(handlers)
+
+func newCommands(handlers map[string]Handler) map[string]*Command {
+	commands := make(map[string]*Command, len(handlers))
+	for name, handler := range handlers {
+		spec, ok := catalog.LookupCLI(name)
+		if !ok {
+			panic(fmt.Sprintf("command %s is missing from the catalog", name))
+		}
+		info := &Command{
+			help:             spec.Help,
+			requiresAuth:     spec.RequiresKey,
+			requiresFleetAPI: spec.RequiresFleetAPI,
+			handler:          handler,
+			domain:           cli.DomainsByName[spec.Domain],
+			capability:       vehicle.CommandCapabilities[spec.Name],
+		}
+		for _, arg := range spec.Arguments {
+			if arg.Required {
+				info.args = append(info.args, Argument{name: arg.Name, help: arg.Help})
+			} else {
+				info.optional = append(info.optional, Argument{name: arg.Name, help: arg.Help})
+			}
+		}
+		commands[name] = info
+		for _, alias := range spec.CLIAliases {
+			aliasInfo := *info
+			aliasInfo.help = fmt.Sprintf("Same as %s", name)
+			commands[alias] = &aliasInfo
+		}
+	}
+	return commands
 }
 
 var categoriesByName = map[string]vehicle.StateCategory{
@@ -89,6 +131,16 @@ func GetCategory(nameStr string) (vehicle.StateCategory, error) {
 	return 0, fmt.Errorf("unrecognized state category '%s'", nameStr)
 }
 
+// speedLimitPIN returns the PIN argument of a speed limit command. The error doesn't include the
+// PIN, since tesla-control prints it.
+func speedLimitPIN(args map[string]string) (string, error) {
+	spec, _ := catalog.LookupCLI("speed-limit-activate")
+	if param, ok := spec.Parameter("pin"); ok && !param.Accepts(args["PIN"]) {
+		return "", errors.New("PIN must be four digits")
+	}
+	return args["PIN"], nil
+}
+
 func GetDegree(degStr string) (float32, error) {
 	deg, err := strconv.ParseFloat(degStr, 32)
 	if err != nil {
@@ -112,26 +164,6 @@ func GetDays(days string) (int32, error) {
 	return mask, nil
 }
 
-func MinutesAfterMidnight(hoursAndMinutes string) (int32, error) {
-	components := strings.Split(hoursAndMinutes, ":")
-	if len(components) != 2 {
-		return 0, fmt.Errorf("%w: expected HH:MM", ErrInvalidTime)
-	}
-	hours, err := strconv.Atoi(components[0])
-	if err != nil {
-		return 0, fmt.Errorf("%w: %s", ErrInvalidTime, err)
-	}
-	minutes, err := strconv.Atoi(components[1])
-	if err != nil {
-		return 0, fmt.Errorf("%w: %s", ErrInvalidTime, err)
-	}
-
-	if hours > 23 || hours < 0 || minutes > 59 || minutes < 0 {
-		return 0, fmt.Errorf("%w: hours or minutes outside valid range", ErrInvalidTime)
-	}
-	return int32(60*hours + minutes), nil
-}
-
 // configureAndVerifyFlags verifies that c contains all the information required to execute a command.
 func configureFlags(c *cli.Config, commandName string, forceBLE bool) error {
 	info, ok := commands[commandName]
@@ -142,6 +174,9 @@ func configureFlags(c *cli.Config, commandName string, forceBLE bool) error {
 	if info.domain != protocol.DomainNone {
 		c.Domains = cli.DomainList{info.domain}
 	}
+	// These commands are unauthenticated, and shouldn't wake the vehicle or depend on a working
+	// session.
+	c.SkipHandshake = commandName == "session-info" || commandName == "awake"
 	bleWake := forceBLE && commandName == "wake"
 	if bleWake || info.requiresAuth {
 		// Wake commands are special. When sending a wake command over the Internet, infotainment
@@ -175,6 +210,12 @@ func configureFlags(c *cli.Config, commandName string, forceBLE bool) error {
 	return err
 }
 
+// errVehicleAsleep is returned by the awake command so that its exit status reflects the answer.
+var errVehicleAsleep = errors.New("vehicle is asleep")
+
+// exitAsleep is the exit status of the awake command when the vehicle isn't awake.
+const exitAsleep = 4
+
 var (
 	ErrRequiresOAuth      = errors.New("command requires a FleetAPI OAuth token")
 	ErrRequiresVIN        = errors.New("command requires a VIN")
@@ -215,22 +256,9 @@ func execute(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, a
 		return err
 	}
 
-	if len(args)-1 < len(info.args) || len(args)-1 > len(info.args)+len(info.optional) {
-		writeErr("Invalid number of command line arguments: %d (%d required, %d optional).", len(args), len(info.args), len(info.optional))
-		err = ErrCommandLineArgs
-	} else {
-		keywords := make(map[string]string)
-		for i, argInfo := range info.args {
-			keywords[argInfo.name] = args[i+1]
-		}
-		index := len(info.args) + 1
-		for _, argInfo := range info.optional {
-			if index >= len(args) {
-				break
-			}
-			keywords[argInfo.name] = args[index]
-			index++
-		}
+	keywords, err := info.parseArgs(args)
+	if err == nil {
+		loadCapabilities(ctx, acct, car, info.capability)
 		err = info.handler(ctx, acct, car, keywords)
 	}
 
@@ -241,6 +269,73 @@ func execute(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, a
 	return err
 }
 
+// loadCapabilities reads the vehicle's hardware configuration from Fleet API before the first
+// command that requires capability, so that the command fails immediately if the vehicle lacks it.
+// Over BLE, or if the configuration can't be read, the command is sent without checking.
+func loadCapabilities(ctx context.Context, acct *account.Account, car *vehicle.Vehicle, capability vehicle.Capability) {
+	if capability == "" || acct == nil || car == nil || car.SkipCapabilityCheck || car.Capabilities != nil {
+		return
+	}
+	caps, err := acct.VehicleCapabilities(ctx, car.VIN())
+	if err != nil {
+		log.Debug("Couldn't read vehicle capabilities: %s", err)
+		return
+	}
+	car.Capabilities = caps
+}
+
+// parseArgs maps arguments (args[0] is the command name) to argument names. Arguments are
+// normally positional, but may also be given as "-name VALUE", where name is the argument's name in
+// lower case (e.g., "-passenger 23" for PASSENGER). Positional arguments fill the remaining names
+// in order.
+func (c *Command) parseArgs(args []string) (map[string]string, error) {
+	keywords := make(map[string]string)
+	var positional []string
+	for i := 1; i < len(args); i++ {
+		if name, ok := c.argumentName(args[i]); ok && i+1 < len(args) {
+			keywords[name] = args[i+1]
+			i++
+			continue
+		}
+		positional = append(positional, args[i])
+	}
+	for _, argInfo := range append(append([]Argument(nil), c.args...), c.optional...) {
+		if len(positional) == 0 {
+			break
+		}
+		if _, ok := keywords[argInfo.name]; !ok {
+			keywords[argInfo.name] = positional[0]
+			positional = positional[1:]
+		}
+	}
+	missing := 0
+	for _, argInfo := range c.args {
+		if _, ok := keywords[argInfo.name]; !ok {
+			missing++
+		}
+	}
+	if missing > 0 || len(positional) > 0 {
+		writeErr("Invalid number of command line arguments: %d (%d required, %d optional).", len(args)-1, len(c.args), len(c.optional))
+		return nil, ErrCommandLineArgs
+	}
+	return keywords, nil
+}
+
+// argumentName returns the name of the argument that flag (e.g., "-passenger") refers to.
+func (c *Command) argumentName(flag string) (string, bool) {
+	name, ok := strings.CutPrefix(flag, "-")
+	if !ok {
+		return "", false
+	}
+	name = strings.ToUpper(strings.TrimPrefix(name, "-"))
+	for _, argInfo := range append(append([]Argument(nil), c.args...), c.optional...) {
+		if argInfo.name == name {
+			return name, true
+		}
+	}
+	return "", false
+}
+
 func (c *Command) Usage(name string) {
 	fmt.Printf("Usage: %s", name)
 	maxLength := 0
@@ -272,992 +367,1002 @@ func (c *Command) Usage(name string) {
 	}
 }
 
-var commands = map[string]*Command{
-	"valet-mode-on": {
-		help:             "Enable valet mode",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "PIN", help: "Valet mode PIN"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			return car.EnableValetMode(ctx, args["PIN"])
-		},
-	},
-	"valet-mode-off": {
-		help:             "Disable valet mode",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.DisableValetMode(ctx)
-		},
-	},
-	"unlock": {
-		help:             "Unlock vehicle",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.Unlock(ctx)
-		},
-	},
-	"lock": {
-		help:             "Lock vehicle",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.Lock(ctx)
-		},
-	},
-	"drive": {
-		help:             "Remote start vehicle",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.RemoteDrive(ctx)
-		},
-	},
-	"climate-on": {
-		help:             "Turn on climate control",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.ClimateOn(ctx)
-		},
-	},
-	"climate-off": {
-		help:             "Turn off climate control",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.ClimateOff(ctx)
-		},
-	},
-	"climate-set-temp": {
-		help:             "Set temperature (Celsius)",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "TEMP", help: "Desired temperature (e.g., 70f or 21c; defaults to Celsius)"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			var degrees float32
-			var unit string
-			if _, err := fmt.Sscanf(args["TEMP"], "%f%s", &degrees, &unit); err != nil {
-				return fmt.Errorf("failed to parse temperature: format as 22C or 72F")
-			}
-			if unit == "F" || unit == "f" {
-				degrees = (degrees - 32.0) * 5.0 / 9.0
-			} else if unit != "C" && unit != "c" {
-				return fmt.Errorf("temperature units must be C or F")
-			}
-			return car.ChangeClimateTemp(ctx, degrees, degrees)
-		},
-	},
-	"add-key": {
-		help:             "Add PUBLIC_KEY to vehicle whitelist with ROLE and FORM_FACTOR",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)"},
-			{name: "ROLE", help: "One of: owner, driver, fm (fleet manager), vehicle_monitor, charging_manager"},
-			{name: "FORM_FACTOR", help: "One of: nfc_card, ios_device, android_device, cloud_key"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			role, ok := keys.Role_value["ROLE_"+strings.ToUpper(args["ROLE"])]
-			if !ok {
-				return fmt.Errorf("%w: invalid ROLE", ErrCommandLineArgs)
-			}
-			formFactor, ok := vcsec.KeyFormFactor_value["KEY_FORM_FACTOR_"+strings.ToUpper(args["FORM_FACTOR"])]
-			if !ok {
-				return fmt.Errorf("%w: unrecognized FORM_FACTOR", ErrCommandLineArgs)
-			}
-			publicKey, err := protocol.LoadPublicKey(args["PUBLIC_KEY"])
-			if err != nil {
-				return fmt.Errorf("invalid public key: %s", err)
-			}
-			return car.AddKeyWithRole(ctx, publicKey, keys.Role(role), vcsec.KeyFormFactor(formFactor))
-		},
-	},
-	"add-key-request": {
-		help:             "Request NFC-card approval for a enrolling PUBLIC_KEY with ROLE and FORM_FACTOR",
-		requiresAuth:     false,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)"},
-			{name: "ROLE", help: "One of: owner, driver, fm (fleet manager), vehicle_monitor, charging_manager"},
-			{name: "FORM_FACTOR", help: "One of: nfc_card, ios_device, android_device, cloud_key"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			role, ok := keys.Role_value["ROLE_"+strings.ToUpper(args["ROLE"])]
-			if !ok {
-				return fmt.Errorf("%w: invalid ROLE", ErrCommandLineArgs)
-			}
-			formFactor, ok := vcsec.KeyFormFactor_value["KEY_FORM_FACTOR_"+strings.ToUpper(args["FORM_FACTOR"])]
-			if !ok {
-				return fmt.Errorf("%w: unrecognized FORM_FACTOR", ErrCommandLineArgs)
-			}
-			publicKey, err := protocol.LoadPublicKey(args["PUBLIC_KEY"])
-			if err != nil {
-				return fmt.Errorf("invalid public key: %s", err)
-			}
-			if err := car.SendAddKeyRequestWithRole(ctx, publicKey, keys.Role(role), vcsec.KeyFormFactor(formFactor)); err != nil {
-				return err
-			}
-			fmt.Printf("Sent add-key request to %s. Confirm by tapping NFC card on center console.\n", car.VIN())
-			return nil
-		},
-	},
-	"remove-key": {
-		help:             "Remove PUBLIC_KEY from vehicle whitelist",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			publicKey, err := protocol.LoadPublicKey(args["PUBLIC_KEY"])
-			if err != nil {
-				return fmt.Errorf("invalid public key: %s", err)
-			}
-			return car.RemoveKey(ctx, publicKey)
-		},
-	},
-	"rename-key": {
-		help:             "Change the human-readable metadata of PUBLIC_KEY to NAME, MODEL, KIND",
-		requiresAuth:     false,
-		requiresFleetAPI: true,
-		args: []Argument{
-			{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)"},
-			{name: "NAME", help: "New human-readable name for the public key (e.g., Dave's Phone)"},
-		},
-		handler: func(ctx context.Context, acct *account.Account, _ *vehicle.Vehicle, args map[string]string) error {
-			publicKey, err := protocol.LoadPublicKey(args["PUBLIC_KEY"])
-			if err != nil {
-				return fmt.Errorf("invalid public key: %s", err)
-			}
-			return acct.UpdateKey(ctx, publicKey, args["NAME"])
-		},
-	},
-	"get": {
-		help:             "GET an owner API http ENDPOINT. Hostname will be taken from -config.",
-		requiresAuth:     false,
-		requiresFleetAPI: true,
-		args: []Argument{
-			{name: "ENDPOINT", help: "Fleet API endpoint"},
-		},
-		handler: func(ctx context.Context, acct *account.Account, _ *vehicle.Vehicle, args map[string]string) error {
-			reply, err := acct.Get(ctx, args["ENDPOINT"])
-			if err != nil {
-				return err
-			}
-			fmt.Println(string(reply))
-			return nil
-		},
-	},
-	"post": {
-		help:             "POST to ENDPOINT the contents of FILE. Hostname will be taken from -config.",
-		requiresAuth:     false,
-		requiresFleetAPI: true,
-		args: []Argument{
-			{name: "ENDPOINT", help: "Fleet API endpoint"},
-		},
-		optional: []Argument{
-			{name: "FILE", help: "JSON file to POST"},
-		},
-		handler: func(ctx context.Context, acct *account.Account, _ *vehicle.Vehicle, args map[string]string) error {
-			var jsonBytes []byte
-			var err error
-			if filename, ok := args["FILE"]; ok {
-				jsonBytes, err = os.ReadFile(filename)
+// printChargeLimit reports the charge limit after a command that changes it to a percentage that
+// depends on the vehicle, or returns the command's error, commandErr. If the vehicle refused the
+// command because the limit was already at the requested setting, the limit is reported along with
+// the vehicle's reason. Otherwise the command has succeeded, so failing to read the limit is only
+// a warning.
+func printChargeLimit(ctx context.Context, car *vehicle.Vehicle, commandErr error) error {
+	reason, alreadySet := vehicle.AlreadySet(commandErr)
+	if commandErr != nil && !alreadySet {
+		return commandErr
+	}
+	limit, err := car.ChargeLimit(ctx)
+	if err != nil {
+		writeErr("Charge limit changed, but couldn't read the new limit: %s", err)
+		return nil
+	}
+	switch {
+	case jsonOutput:
+		output, _ := json.Marshal(struct {
+			ChargeLimitSOC int32  `json:"charge_limit_soc"`
+			Reason         string `json:"reason,omitempty"`
+		}{limit, reason})
+		fmt.Println(string(output))
+	case alreadySet:
+		fmt.Printf("Charge limit already set to %d%% (%s)\n", limit, reason)
+	default:
+		fmt.Printf("Charge limit set to %d%%\n", limit)
+	}
+	return nil
+}
+
+// parseTemperature parses a temperature such as 72F or 21.5c, returning degrees Celsius.
+// Temperatures without a suffix are in system's unit.
+func parseTemperature(s string, system units.System) (float32, error) {
+	celsius, err := units.ParseTemperature(s, system)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrCommandLineArgs, err)
+	}
+	return celsius, nil
+}
+
+// printTemperature reports the setpoint the vehicle adopted for a zone, noting when it differs
+// from the requested temperature at the displayed precision.
+func printTemperature(zone string, celsius, requested float32, system units.System) {
+	adopted := units.FormatTemperature(celsius, system)
+	if want := units.FormatTemperature(requested, system); adopted != want {
+		fmt.Printf("%s temperature set to %s (vehicle adjusted requested %s)\n", zone, adopted, want)
+	} else {
+		fmt.Printf("%s temperature set to %s\n", zone, adopted)
+	}
+}
+
+func printSessionDetails(details *vehicle.SessionDetails) error {
+	if jsonOutput {
+		encoded, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(encoded))
+		return nil
+	}
+	fmt.Printf("Domain:       %s\n", details.Domain)
+	fmt.Printf("Status:       %s\n", details.Status)
+	fmt.Printf("Epoch:        %s\n", details.Epoch)
+	if details.SessionCounter != nil {
+		fmt.Printf("Counter:      %d (client session: %d)\n", details.Counter, *details.SessionCounter)
+	} else {
+		fmt.Printf("Counter:      %d\n", details.Counter)
+	}
+	fmt.Printf("Clock time:   %ds since epoch began\n", details.ClockTime)
+	if offset, ok := details.ClockOffsetDuration(); ok {
+		switch {
+		case offset > 0:
+			fmt.Printf("Clock offset: client is %s ahead of vehicle\n", offset)
+		case offset < 0:
+			fmt.Printf("Clock offset: client is %s behind vehicle\n", -offset)
+		default:
+			fmt.Println("Clock offset: none")
+		}
+	} else {
+		fmt.Println("Clock offset: unknown (no cached session in this epoch)")
+	}
+	fmt.Printf("Public key:   %s\n", details.PublicKey)
+	return nil
+}
+
+func printOffPeakCharging(settings *vehicle.OffPeakChargingSettings) error {
+	endTime := fmt.Sprintf("%d:%02d", int(settings.EndTime.Hours()), int(settings.EndTime.Minutes())%60)
+	if jsonOutput {
+		encoded, err := json.Marshal(struct {
+			Enabled      bool   `json:"enabled"`
+			WeekdaysOnly bool   `json:"weekdays_only"`
+			EndTime      string `json:"end_time"`
+		}{settings.Enabled, settings.WeekdaysOnly, endTime})
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(encoded))
+		return nil
+	}
+	if !settings.Enabled {
+		fmt.Println("Off-peak charging is off")
+		return nil
+	}
+	days := "every day"
+	if settings.WeekdaysOnly {
+		days = "on weekdays"
+	}
+	fmt.Printf("Off-peak charging is on %s, ending at %s\n", days, endTime)
+	return nil
+}
+
+var seatsByName = map[string]vehicle.SeatPosition{
+	"front-left":     vehicle.SeatFrontLeft,
+	"front-right":    vehicle.SeatFrontRight,
+	"2nd-row-left":   vehicle.SeatSecondRowLeft,
+	"2nd-row-center": vehicle.SeatSecondRowCenter,
+	"2nd-row-right":  vehicle.SeatSecondRowRight,
+	"3rd-row-left":   vehicle.SeatThirdRowLeft,
+	"3rd-row-right":  vehicle.SeatThirdRowRight,
+}
+
+var copModesByName = map[string]vehicle.CabinOverheatProtectionMode{
+	"off":      vehicle.CabinOverheatProtectionOff,
+	"on":       vehicle.CabinOverheatProtectionOn,
+	"no_ac":    vehicle.CabinOverheatProtectionFanOnly,
+	"fan_only": vehicle.CabinOverheatProtectionFanOnly,
+}
+
+var heaterLevelsByName = map[string]vehicle.Level{
+	"off":    vehicle.LevelOff,
+	"low":    vehicle.LevelLow,
+	"medium": vehicle.LevelMed,
+	"high":   vehicle.LevelHigh,
+}
+
+func parseOnOff(state string) (bool, error) {
+	switch state {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: state must be 'on' or 'off'", ErrCommandLineArgs)
+}
+
+// parseSeatHeaters parses comma-separated SEAT:LEVEL pairs, such as "front-left:high".
+func parseSeatHeaters(spec string) (map[vehicle.SeatPosition]vehicle.Level, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	levels := make(map[vehicle.SeatPosition]vehicle.Level)
+	for _, pair := range strings.Split(spec, ",") {
+		seatName, levelName, _ := strings.Cut(strings.TrimSpace(pair), ":")
+		seat, ok := seatsByName[seatName]
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid seat position '%s'", ErrCommandLineArgs, seatName)
+		}
+		level, ok := heaterLevelsByName[levelName]
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid seat heater level '%s'", ErrCommandLineArgs, levelName)
+		}
+		levels[seat] = level
+	}
+	return levels, nil
+}
+
+// printPreconditionSteps reports the outcome of each step, and returns an error if any failed.
+func printPreconditionSteps(steps []vehicle.PreconditionStep) error {
+	failed := 0
+	type stepJSON struct {
+		Step  string `json:"step"`
+		Error string `json:"error,omitempty"`
+	}
+	var report []stepJSON
+	for _, step := range steps {
+		entry := stepJSON{Step: step.Name}
+		if step.Err != nil {
+			failed++
+			entry.Error = step.Err.Error()
+		}
+		report = append(report, entry)
+		if !jsonOutput {
+			if step.Err != nil {
+				fmt.Printf("%-22s FAILED: %s\n", step.Name, step.Err)
 			} else {
-				jsonBytes, err = io.ReadAll(os.Stdin)
-			}
-			if err != nil {
-				return err
-			}
-			reply, err := acct.Post(ctx, args["ENDPOINT"], jsonBytes)
-			// reply can be set where there's an error; typically a JSON blob providing details
-			if reply != nil {
-				fmt.Println(string(reply))
+				fmt.Printf("%-22s OK\n", step.Name)
 			}
-			if err != nil {
+		}
+	}
+	if jsonOutput {
+		encoded, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(encoded))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d preconditioning steps failed", failed, len(steps))
+	}
+	return nil
+}
+
+var handlers = map[string]Handler{
+	"valet-mode-on": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		return car.EnableValetMode(ctx, args["PIN"])
+	},
+	"valet-mode-off": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.DisableValetMode(ctx)
+	},
+	"unlock": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.Unlock(ctx)
+	},
+	"speed-limit-activate": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		pin, err := speedLimitPIN(args)
+		if err != nil {
+			return err
+		}
+		return car.ActivateSpeedLimit(ctx, pin)
+	},
+	"speed-limit-deactivate": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		pin, err := speedLimitPIN(args)
+		if err != nil {
+			return err
+		}
+		return car.DeactivateSpeedLimit(ctx, pin)
+	},
+	"speed-limit-clear-pin": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		pin, err := speedLimitPIN(args)
+		if err != nil {
+			return err
+		}
+		return car.ClearSpeedLimitPIN(ctx, pin)
+	},
+	"speed-limit-clear-pin-admin": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.ClearSpeedLimitPINAdminAction(ctx)
+	},
+	"speed-limit-set": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		limit, err := units.ParseSpeed(args["MPH"], unitSystem)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrCommandLineArgs, err)
+		}
+		if limit < vehicle.MinSpeedLimitMPH || limit > vehicle.MaxSpeedLimitMPH {
+			return fmt.Errorf("speed limit must be between %d and %d mph", vehicle.MinSpeedLimitMPH, vehicle.MaxSpeedLimitMPH)
+		}
+		return car.SpeedLimitSetLimitMPH(ctx, limit)
+	},
+	"lock": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.Lock(ctx)
+	},
+	"drive": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.RemoteDrive(ctx)
+	},
+	"climate-on": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.ClimateOn(ctx)
+	},
+	"climate-off": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.ClimateOff(ctx)
+	},
+	"climate-set-temp": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		system := unitSystem
+		switch strings.ToUpper(args["UNIT"]) {
+		case "":
+		case "C":
+			system = units.Metric
+		case "F":
+			system = units.Imperial
+		default:
+			return fmt.Errorf("%w: temperature units must be C or F", ErrCommandLineArgs)
+		}
+		driver, err := parseTemperature(args["DRIVER"], system)
+		if err != nil {
+			return err
+		}
+		passenger := driver
+		if args["PASSENGER"] != "" {
+			if passenger, err = parseTemperature(args["PASSENGER"], system); err != nil {
 				return err
 			}
+		}
+		settings, err := car.SetTemperatures(ctx, driver, passenger)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			fmt.Printf("{\"driver_temp\":%g,\"passenger_temp\":%g}\n", settings.DriverCelsius, settings.PassengerCelsius)
 			return nil
-		},
-	},
-	"list-keys": {
-		help:             "List public keys enrolled on vehicle",
-		requiresAuth:     false,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			summary, err := car.KeySummary(ctx)
-			if err != nil {
-				return err
-			}
-			slot := uint32(0)
-			var details *vcsec.WhitelistEntryInfo
-			for mask := summary.GetSlotMask(); mask > 0; mask >>= 1 {
-				if mask&1 == 1 {
-					details, err = car.KeyInfoBySlot(ctx, slot)
-					if err != nil {
-						writeErr("Error fetching slot %d: %s", slot, err)
-						if errors.Is(err, context.DeadlineExceeded) {
-							return err
-						}
-					}
-					if details != nil {
-						fmt.Printf("%02x\t%s\t%s\n", details.GetPublicKey().GetPublicKeyRaw(), details.GetKeyRole(), details.GetMetadataForKey().GetKeyFormFactor())
+		}
+		printTemperature("Driver", settings.DriverCelsius, driver, system)
+		printTemperature("Passenger", settings.PassengerCelsius, passenger, system)
+		return nil
+	},
+	"add-key": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		role, ok := keys.Role_value["ROLE_"+strings.ToUpper(args["ROLE"])]
+		if !ok {
+			return fmt.Errorf("%w: invalid ROLE", ErrCommandLineArgs)
+		}
+		formFactor, ok := vcsec.KeyFormFactor_value["KEY_FORM_FACTOR_"+strings.ToUpper(args["FORM_FACTOR"])]
+		if !ok {
+			return fmt.Errorf("%w: unrecognized FORM_FACTOR", ErrCommandLineArgs)
+		}
+		publicKey, err := protocol.LoadPublicKey(args["PUBLIC_KEY"])
+		if err != nil {
+			return fmt.Errorf("invalid public key: %s", err)
+		}
+		return car.AddKeyWithRole(ctx, publicKey, keys.Role(role), vcsec.KeyFormFactor(formFactor))
+	},
+	"add-key-request": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		role, ok := keys.Role_value["ROLE_"+strings.ToUpper(args["ROLE"])]
+		if !ok {
+			return fmt.Errorf("%w: invalid ROLE", ErrCommandLineArgs)
+		}
+		formFactor, ok := vcsec.KeyFormFactor_value["KEY_FORM_FACTOR_"+strings.ToUpper(args["FORM_FACTOR"])]
+		if !ok {
+			return fmt.Errorf("%w: unrecognized FORM_FACTOR", ErrCommandLineArgs)
+		}
+		publicKey, err := protocol.LoadPublicKey(args["PUBLIC_KEY"])
+		if err != nil {
+			return fmt.Errorf("invalid public key: %s", err)
+		}
+		if err := car.SendAddKeyRequestWithRole(ctx, publicKey, keys.Role(role), vcsec.KeyFormFactor(formFactor)); err != nil {
+			return err
+		}
+		fmt.Printf("Sent add-key request to %s. Confirm by tapping NFC card on center console.\n", car.VIN())
+		return nil
+	},
+	"remove-key": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		publicKey, err := protocol.LoadPublicKey(args["PUBLIC_KEY"])
+		if err != nil {
+			return fmt.Errorf("invalid public key: %s", err)
+		}
+		return car.RemoveKey(ctx, publicKey)
+	},
+	"rename-key": func(ctx context.Context, acct *account.Account, _ *vehicle.Vehicle, args map[string]string) error {
+		publicKey, err := protocol.LoadPublicKey(args["PUBLIC_KEY"])
+		if err != nil {
+			return fmt.Errorf("invalid public key: %s", err)
+		}
+		return acct.UpdateKey(ctx, publicKey, args["NAME"])
+	},
+	"get": func(ctx context.Context, acct *account.Account, _ *vehicle.Vehicle, args map[string]string) error {
+		reply, err := acct.Get(ctx, args["ENDPOINT"])
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(reply))
+		return nil
+	},
+	"post": func(ctx context.Context, acct *account.Account, _ *vehicle.Vehicle, args map[string]string) error {
+		var jsonBytes []byte
+		var err error
+		if filename, ok := args["FILE"]; ok {
+			jsonBytes, err = os.ReadFile(filename)
+		} else {
+			jsonBytes, err = io.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			return err
+		}
+		reply, err := acct.Post(ctx, args["ENDPOINT"], jsonBytes)
+		// reply can be set where there's an error; typically a JSON blob providing details
+		if reply != nil {
+			fmt.Println(string(reply))
+		}
+		if err != nil {
+			return err
+		}
+		return nil
+	},
+	"list-keys": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		summary, err := car.KeySummary(ctx)
+		if err != nil {
+			return err
+		}
+		slot := uint32(0)
+		var details *vcsec.WhitelistEntryInfo
+		for mask := summary.GetSlotMask(); mask > 0; mask >>= 1 {
+			if mask&1 == 1 {
+				details, err = car.KeyInfoBySlot(ctx, slot)
+				if err != nil {
+					writeErr("Error fetching slot %d: %s", slot, err)
+					if errors.Is(err, context.DeadlineExceeded) {
+						return err
 					}
 				}
-				slot++
-			}
-			return nil
-		},
-	},
-	"honk": {
-		help:             "Honk horn",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.HonkHorn(ctx)
-		},
-	},
-	"ping": {
-		help:             "Ping vehicle",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.Ping(ctx)
-		},
-	},
-	"flash-lights": {
-		help:             "Flash lights",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.FlashLights(ctx)
-		},
-	},
-	"low-power-mode": {
-		help:             "Set low power mode to STATE ('on' or 'off')",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "STATE", help: "'on' or 'off'"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			var state bool
-			switch args["STATE"] {
-			case "on":
-				state = true
-			case "off":
-				state = false
-			default:
-				return fmt.Errorf("low power mode state must be 'on' or 'off'")
-			}
-			return car.SetLowPowerMode(ctx, state)
-		},
-	},
-	"charging-set-limit": {
-		help:             "Set charge limit to PERCENT",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "PERCENT", help: "Charging limit"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			limit, err := strconv.Atoi(args["PERCENT"])
-			if err != nil {
-				return fmt.Errorf("error parsing PERCENT")
-			}
-			return car.ChangeChargeLimit(ctx, int32(limit))
-		},
-	},
-	"charging-set-amps": {
-		help:             "Set charge current to AMPS",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "AMPS", help: "Charging current"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			limit, err := strconv.Atoi(args["AMPS"])
-			if err != nil {
-				return fmt.Errorf("error parsing AMPS")
-			}
-			return car.SetChargingAmps(ctx, int32(limit))
-		},
-	},
-	"charging-start": {
-		help:             "Start charging",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.ChargeStart(ctx)
-		},
-	},
-	"charging-stop": {
-		help:             "Stop charging",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.ChargeStop(ctx)
-		},
-	},
-	"charging-schedule": {
-		help:             "Schedule charging to MINS minutes after midnight and enable daily scheduling",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "MINS", help: "Time after midnight in minutes"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			minutesAfterMidnight, err := strconv.Atoi(args["MINS"])
-			if err != nil {
-				return fmt.Errorf("error parsing minutes")
-			}
-			// Convert minutes to a time.Duration
-			chargingTime := time.Duration(minutesAfterMidnight) * time.Minute
-			return car.ScheduleCharging(ctx, true, chargingTime)
-		},
-	},
-	"charging-schedule-cancel": {
-		help:             "Cancel scheduled charge start",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.ScheduleCharging(ctx, false, 0*time.Hour)
-		},
-	},
-	"media-set-volume": {
-		help:             "Set volume",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "VOLUME", help: "Set volume (0.0-10.0"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			volume, err := strconv.ParseFloat(args["VOLUME"], 32)
-			if err != nil {
-				return fmt.Errorf("failed to parse volume")
+				if details != nil {
+					fmt.Printf("%02x\t%s\t%s\n", details.GetPublicKey().GetPublicKeyRaw(), details.GetKeyRole(), details.GetMetadataForKey().GetKeyFormFactor())
+				}
 			}
-			return car.SetVolume(ctx, float32(volume))
-		},
-	},
-	"media-volume-up": {
-		help:             "Increase volume",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.VolumeUp(ctx)
-		},
-	},
-	"media-volume-down": {
-		help:             "Decrease volume",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.VolumeDown(ctx)
-		},
-	},
-	"media-next-favorite": {
-		help:             "Next favorite",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.MediaNextFavorite(ctx)
-		},
-	},
-	"media-next-track": {
-		help:             "Next track",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.MediaNextTrack(ctx)
-		},
-	},
-	"media-previous-track": {
-		help:             "Previous track",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.MediaPreviousTrack(ctx)
-		},
+			slot++
+		}
+		return nil
+	},
+	"honk": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.HonkHorn(ctx)
+	},
+	"ping": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.Ping(ctx)
+	},
+	"awake": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		awake, err := car.IsAwake(ctx)
+		if err != nil {
+			return err
+		}
+		switch {
+		case jsonOutput:
+			output, _ := json.Marshal(struct {
+				Awake bool `json:"awake"`
+			}{awake})
+			fmt.Println(string(output))
+		case awake:
+			fmt.Println("Vehicle is awake")
+		default:
+			fmt.Println("Vehicle is asleep or offline")
+		}
+		if !awake {
+			return errVehicleAsleep
+		}
+		return nil
+	},
+	"command-protocol": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		supported, err := car.SupportsSignedCommands(ctx)
+		if err != nil {
+			return err
+		}
+		switch {
+		case jsonOutput:
+			output, _ := json.Marshal(struct {
+				SignedCommands bool `json:"signed_commands"`
+			}{supported})
+			fmt.Println(string(output))
+		case supported:
+			fmt.Println("Vehicle supports signed commands")
+		default:
+			fmt.Println("Vehicle does not support signed commands; send commands to the Fleet API's REST endpoints instead")
+		}
+		return nil
+	},
+	"flash-lights": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.FlashLights(ctx)
+	},
+	"low-power-mode": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		var state bool
+		switch args["STATE"] {
+		case "on":
+			state = true
+		case "off":
+			state = false
+		default:
+			return fmt.Errorf("low power mode state must be 'on' or 'off'")
+		}
+		return car.SetLowPowerMode(ctx, state)
+	},
+	"charging-set-limit": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		limit, err := strconv.Atoi(args["PERCENT"])
+		if err != nil {
+			return fmt.Errorf("error parsing PERCENT")
+		}
+		return car.ChangeChargeLimit(ctx, int32(limit))
+	},
+	"charging-set-limit-standard": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return printChargeLimit(ctx, car, car.ChargeStandardRange(ctx))
+	},
+	"charging-set-limit-max": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return printChargeLimit(ctx, car, car.ChargeMaxRange(ctx))
+	},
+	"charging-set-amps": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		limit, err := strconv.Atoi(args["AMPS"])
+		if err != nil {
+			return fmt.Errorf("error parsing AMPS")
+		}
+		return car.SetChargingAmps(ctx, int32(limit))
+	},
+	"charging-start": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.ChargeStart(ctx)
+	},
+	"charging-stop": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.ChargeStop(ctx)
+	},
+	"charging-schedule": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		minutesAfterMidnight, err := strconv.Atoi(args["MINS"])
+		if err != nil {
+			return fmt.Errorf("error parsing minutes")
+		}
+		// Convert minutes to a time.Duration
+		chargingTime := time.Duration(minutesAfterMidnight) * time.Minute
+		return car.ScheduleCharging(ctx, true, chargingTime)
+	},
+	"charging-schedule-cancel": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.ScheduleCharging(ctx, false, 0*time.Hour)
+	},
+	"media-set-volume": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		volume, err := strconv.ParseFloat(args["VOLUME"], 32)
+		if err != nil {
+			return fmt.Errorf("failed to parse volume")
+		}
+		return car.SetVolume(ctx, float32(volume))
+	},
+	"media-volume-up": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.VolumeUp(ctx)
+	},
+	"media-volume-down": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.VolumeDown(ctx)
+	},
+	"media-next-favorite": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.MediaNextFavorite(ctx)
+	},
+	"media-next-track": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.MediaNextTrack(ctx)
+	},
+	"media-previous-track": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.MediaPreviousTrack(ctx)
 	},
 
-	"media-previous-favorite": {
-		help:             "Previous favorite",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.MediaPreviousFavorite(ctx)
-		},
-	},
-	"media-toggle-playback": {
-		help:             "Toggle between play/pause",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args:             []Argument{},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.ToggleMediaPlayback(ctx)
-		},
-	},
-	"software-update-start": {
-		help:             "Start software update after DELAY",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{
-				name: "DELAY",
-				help: "Time to wait before starting update. Examples: 2h, 10m.",
-			},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			delay, err := time.ParseDuration(args["DELAY"])
-			if err != nil {
-				return fmt.Errorf("error parsing DELAY. Valid times are <n><unit>, where <n> is a number (decimals are allowed) and <unit> is 's, 'm', or 'h'")
-				// ...or 'ns'/'µs' if that's your cup of tea.
-			}
-			return car.ScheduleSoftwareUpdate(ctx, delay)
-		},
-	},
-	"software-update-cancel": {
-		help:             "Cancel a pending software update",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.CancelSoftwareUpdate(ctx)
-		},
-	},
-	"sentry-mode": {
-		help:             "Set sentry mode to STATE ('on' or 'off')",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "STATE", help: "'on' or 'off'"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			var state bool
-			switch args["STATE"] {
-			case "on":
-				state = true
-			case "off":
-				state = false
-			default:
-				return fmt.Errorf("sentry mode state must be 'on' or 'off'")
-			}
-			return car.SetSentryMode(ctx, state)
-		},
-	},
-	"wake": {
-		help:             "Wake up vehicle",
-		requiresAuth:     false,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.Wakeup(ctx)
-		},
-	},
-	"tonneau-open": {
-		help:             "Open Cybertruck tonneau.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.OpenTonneau(ctx)
-		},
-	},
-	"tonneau-close": {
-		help:             "Close Cybertruck tonneau.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.CloseTonneau(ctx)
-		},
-	},
-	"tonneau-stop": {
-		help:             "Stop moving Cybertruck tonneau.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.StopTonneau(ctx)
-		},
-	},
-	"trunk-open": {
-		help:             "Open vehicle trunk. Note that trunk-close only works on certain vehicle types.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.OpenTrunk(ctx)
-		},
-	},
-	"trunk-move": {
-		help:             "Toggle trunk open/closed. Closing is only available on certain vehicle types.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.ActuateTrunk(ctx)
-		},
-	},
-	"trunk-close": {
-		help:             "Closes vehicle trunk. Only available on certain vehicle types.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.CloseTrunk(ctx)
-		},
-	},
-	"frunk-open": {
-		help:             "Open vehicle frunk. Note that there's no frunk-close command!",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.OpenFrunk(ctx)
-		},
-	},
-	"charge-port-open": {
-		help:             "Open charge port",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.OpenChargePort(ctx)
-		},
-	},
-	"charge-port-close": {
-		help:             "Close charge port",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.CloseChargePort(ctx)
-		},
-	},
-	"autosecure-modelx": {
-		help:             "Close falcon-wing doors and lock vehicle. Model X only.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.AutoSecureVehicle(ctx)
-		},
-	},
-	"session-info": {
-		help:             "Retrieve session info for PUBLIC_KEY from DOMAIN",
-		requiresAuth:     false,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "PUBLIC_KEY", help: "file containing public key (or corresponding private key)"},
-			{name: "DOMAIN", help: "'vcsec' or 'infotainment'"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			// See SeatPosition definition for controlling backrest heaters (limited models).
-			domains := map[string]protocol.Domain{
-				"vcsec":        protocol.DomainVCSEC,
-				"infotainment": protocol.DomainInfotainment,
-			}
-			domain, ok := domains[args["DOMAIN"]]
-			if !ok {
-				return fmt.Errorf("invalid domain %s", args["DOMAIN"])
-			}
-			publicKey, err := protocol.LoadPublicKey(args["PUBLIC_KEY"])
-			if err != nil {
-				return fmt.Errorf("invalid public key: %s", err)
-			}
-			info, err := car.SessionInfo(ctx, publicKey, domain)
+	"media-previous-favorite": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.MediaPreviousFavorite(ctx)
+	},
+	"media-toggle-playback": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.ToggleMediaPlayback(ctx)
+	},
+	"software-update-start": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		delay, err := time.ParseDuration(args["DELAY"])
+		if err != nil {
+			return fmt.Errorf("error parsing DELAY. Valid times are <n><unit>, where <n> is a number (decimals are allowed) and <unit> is 's, 'm', or 'h'")
+			// ...or 'ns'/'µs' if that's your cup of tea.
+		}
+		return car.ScheduleSoftwareUpdate(ctx, delay)
+	},
+	"software-update-cancel": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.CancelSoftwareUpdate(ctx)
+	},
+	"sentry-mode": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		var state bool
+		switch args["STATE"] {
+		case "on":
+			state = true
+		case "off":
+			state = false
+		default:
+			return fmt.Errorf("sentry mode state must be 'on' or 'off'")
+		}
+		return car.SetSentryMode(ctx, state)
+	},
+	"wake": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.Wakeup(ctx)
+	},
+	"tonneau-open": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.OpenTonneau(ctx)
+	},
+	"tonneau-close": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.CloseTonneau(ctx)
+	},
+	"tonneau-stop": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.StopTonneau(ctx)
+	},
+	"trunk-open": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.OpenTrunk(ctx)
+	},
+	"trunk-move": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.ActuateTrunk(ctx)
+	},
+	"trunk-close": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.CloseTrunk(ctx)
+	},
+	"frunk-open": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.OpenFrunk(ctx)
+	},
+	"charge-port-open": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.OpenChargePort(ctx)
+	},
+	"charge-port-close": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.CloseChargePort(ctx)
+	},
+	"autosecure-modelx": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.AutoSecureVehicle(ctx)
+	},
+	"session-info": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		domains := map[string]protocol.Domain{
+			"vcsec":        protocol.DomainVCSEC,
+			"infotainment": protocol.DomainInfotainment,
+		}
+		domainName, keyFile := args["DOMAIN"], args["PUBLIC_KEY"]
+		if _, ok := domains[domainName]; !ok && keyFile != "" {
+			// Earlier versions took PUBLIC_KEY before DOMAIN.
+			domainName, keyFile = keyFile, domainName
+		}
+		domain, ok := domains[domainName]
+		if !ok {
+			return fmt.Errorf("%w: invalid domain %s", ErrCommandLineArgs, domainName)
+		}
+		if keyFile == "" {
+			details, err := car.SessionDetails(ctx, domain)
 			if err != nil {
 				return err
 			}
-			fmt.Printf("%s\n", info)
-			return nil
-		},
-	},
-	"seat-heater": {
-		help:             "Set seat heater at POSITION to LEVEL",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "SEAT", help: "<front|2nd-row|3rd-row>-<left|center|right> (e.g., 2nd-row-left)"},
-			{name: "LEVEL", help: "off, low, medium, or high"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			// See SeatPosition definition for controlling backrest heaters (limited models).
-			seats := map[string]vehicle.SeatPosition{
-				"front-left":     vehicle.SeatFrontLeft,
-				"front-right":    vehicle.SeatFrontRight,
-				"2nd-row-left":   vehicle.SeatSecondRowLeft,
-				"2nd-row-center": vehicle.SeatSecondRowCenter,
-				"2nd-row-right":  vehicle.SeatSecondRowRight,
-				"3rd-row-left":   vehicle.SeatThirdRowLeft,
-				"3rd-row-right":  vehicle.SeatThirdRowRight,
-			}
-			position, ok := seats[args["SEAT"]]
-			if !ok {
-				return fmt.Errorf("invalid seat position")
-			}
-			levels := map[string]vehicle.Level{
-				"off":    vehicle.LevelOff,
-				"low":    vehicle.LevelLow,
-				"medium": vehicle.LevelMed,
-				"high":   vehicle.LevelHigh,
-			}
-			level, ok := levels[args["LEVEL"]]
-			if !ok {
-				return fmt.Errorf("invalid seat heater level")
-			}
-			spec := map[vehicle.SeatPosition]vehicle.Level{
-				position: level,
-			}
-			return car.SetSeatHeater(ctx, spec)
-		},
-	},
-	"steering-wheel-heater": {
-		help:             "Set steering wheel mode to STATE ('on' or 'off')",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "STATE", help: "'on' or 'off'"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			var state bool
-			switch args["STATE"] {
-			case "on":
-				state = true
-			case "off":
-				state = false
-			default:
-				return fmt.Errorf("steering wheel state must be 'on' or 'off'")
-			}
-			return car.SetSteeringWheelHeater(ctx, state)
-		},
-	},
-	"product-info": {
-		help:             "Print JSON product info",
-		requiresAuth:     false,
-		requiresFleetAPI: true,
-		handler: func(ctx context.Context, acct *account.Account, _ *vehicle.Vehicle, _ map[string]string) error {
-			productsJSON, err := acct.Get(ctx, "api/1/products")
-			if err != nil {
+			return printSessionDetails(details)
+		}
+		publicKey, err := protocol.LoadPublicKey(keyFile)
+		if err != nil {
+			return fmt.Errorf("invalid public key: %s", err)
+		}
+		info, err := car.SessionInfo(ctx, publicKey, domain)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			return printJSON(info)
+		}
+		fmt.Printf("%s\n", info)
+		return nil
+	},
+	"seat-heater": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		// See SeatPosition definition for controlling backrest heaters (limited models).
+		position, ok := seatsByName[args["SEAT"]]
+		if !ok {
+			return fmt.Errorf("invalid seat position")
+		}
+		level, ok := heaterLevelsByName[args["LEVEL"]]
+		if !ok {
+			return fmt.Errorf("invalid seat heater level")
+		}
+		spec := map[vehicle.SeatPosition]vehicle.Level{
+			position: level,
+		}
+		return car.SetSeatHeater(ctx, spec)
+	},
+	"defrost": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		on, err := parseOnOff(args["STATE"])
+		if err != nil {
+			return err
+		}
+		return car.SetMaxDefrost(ctx, on)
+	},
+	"precondition": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		opts := &vehicle.PreconditionOptions{}
+		var err error
+		if opts.SeatHeaters, err = parseSeatHeaters(args["SEATS"]); err != nil {
+			return err
+		}
+		if args["DEFROST"] != "" {
+			if opts.MaxDefrost, err = parseOnOff(args["DEFROST"]); err != nil {
 				return err
 			}
-			fmt.Println(string(productsJSON))
-			return nil
-		},
-	},
-	"auto-seat-and-climate": {
-		help:             "Turn on automatic seat heating and HVAC",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "POSITIONS", help: "'L' (left), 'R' (right), or 'LR'"},
-		},
-		optional: []Argument{
-			{name: "STATE", help: "'on' (default) or 'off'"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			var positions []vehicle.SeatPosition
-			if strings.Contains(args["POSITIONS"], "L") {
-				positions = append(positions, vehicle.SeatFrontLeft)
-			}
-			if strings.Contains(args["POSITIONS"], "R") {
-				positions = append(positions, vehicle.SeatFrontRight)
-			}
-			if len(positions) != len(args["POSITIONS"]) {
-				return fmt.Errorf("invalid seat position")
-			}
-			enabled := true
-			if state, ok := args["STATE"]; ok && strings.ToUpper(state) == "OFF" {
-				enabled = false
-			}
-			return car.AutoSeatAndClimate(ctx, positions, enabled)
-		},
-	},
-	"windows-vent": {
-		help:             "Vent all windows",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.VentWindows(ctx)
-		},
-	},
-	"windows-close": {
-		help:             "Close all windows",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.CloseWindows(ctx)
-		},
-	},
-	"body-controller-state": {
-		help:             "Fetch limited vehicle state information. Works over BLE when infotainment is asleep.",
-		domain:           protocol.DomainVCSEC,
-		requiresAuth:     false,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			info, err := car.BodyControllerState(ctx)
-			if err != nil {
+		}
+		if args["WHEEL"] != "" {
+			if opts.SteeringWheelHeater, err = parseOnOff(args["WHEEL"]); err != nil {
 				return err
 			}
-			options := protojson.MarshalOptions{
-				Indent:            "\t",
-				UseEnumNumbers:    false,
-				EmitUnpopulated:   false,
-				EmitDefaultValues: true,
-			}
-			fmt.Println(options.Format(info))
+		}
+		steps, err := car.Precondition(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return printPreconditionSteps(steps)
+	},
+	"cabin-overheat-protection": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		mode, ok := copModesByName[args["MODE"]]
+		if !ok {
+			return fmt.Errorf("mode must be 'off', 'on', 'no_ac', or 'fan_only'")
+		}
+		temp, setTemp := args["TEMP"]
+		level, ok := heaterLevelsByName[temp]
+		if setTemp && (!ok || level == vehicle.LevelOff) {
+			return fmt.Errorf("temperature must be 'low', 'medium', or 'high'")
+		}
+		if err := car.SetCabinOverheatProtectionMode(ctx, mode); err != nil {
+			return err
+		}
+		if !setTemp {
 			return nil
-		},
-	},
-	"guest-mode-on": {
-		help:             "Enable Guest Mode. See https://developer.tesla.com/docs/fleet-api/endpoints/vehicle-commands#guest-mode.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.SetGuestMode(ctx, true)
-		},
-	},
-	"guest-mode-off": {
-		help:             "Disable Guest Mode.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.SetGuestMode(ctx, false)
-		},
-	},
-	"erase-guest-data": {
-		help:             "Erase Guest Mode user data",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
-			return car.EraseGuestData(ctx)
-		},
-	},
-	"charging-schedule-add": {
-		help:             "Schedule charge for DAYS START_TIME-END_TIME at LATITUDE LONGITUDE. The END_TIME may be on the following day.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "DAYS", help: "Comma-separated list of any of Sun, Mon, Tues, Wed, Thurs, Fri, Sat OR all OR weekdays"},
-			{name: "TIME", help: "Time interval to charge (24-hour clock). Examples: '22:00-6:00', '-6:00', '20:32-"},
-			{name: "LATITUDE", help: "Latitude of charging site"},
-			{name: "LONGITUDE", help: "Longitude of charging site"},
-		},
-		optional: []Argument{
-			{name: "REPEAT", help: "Set to 'once' or omit to repeat weekly"},
-			{name: "ID", help: "The ID of the charge schedule to modify. Not required for new schedules."},
-			{name: "ENABLED", help: "Whether the charge schedule is enabled. Expects 'true' or 'false'. Defaults to true."},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			var err error
-			schedule := vehicle.ChargeSchedule{
-				Id:      uint64(time.Now().Unix()),
-				Enabled: true,
-			}
-
-			if enabledStr, ok := args["ENABLED"]; ok {
-				schedule.Enabled = enabledStr == "true"
-			}
-
-			schedule.DaysOfWeek, err = GetDays(args["DAYS"])
+		}
+		return car.SetCabinOverheatProtectionTemperature(ctx, level)
+	},
+	"steering-wheel-heater": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		var state bool
+		switch args["STATE"] {
+		case "on":
+			state = true
+		case "off":
+			state = false
+		default:
+			return fmt.Errorf("steering wheel state must be 'on' or 'off'")
+		}
+		return car.SetSteeringWheelHeater(ctx, state)
+	},
+	"product-info": func(ctx context.Context, acct *account.Account, _ *vehicle.Vehicle, _ map[string]string) error {
+		productsJSON, err := acct.Get(ctx, "api/1/products")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(productsJSON))
+		return nil
+	},
+	"auto-seat-and-climate": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		var positions []vehicle.SeatPosition
+		if strings.Contains(args["POSITIONS"], "L") {
+			positions = append(positions, vehicle.SeatFrontLeft)
+		}
+		if strings.Contains(args["POSITIONS"], "R") {
+			positions = append(positions, vehicle.SeatFrontRight)
+		}
+		if len(positions) != len(args["POSITIONS"]) {
+			return fmt.Errorf("invalid seat position")
+		}
+		enabled := true
+		if state, ok := args["STATE"]; ok && strings.ToUpper(state) == "OFF" {
+			enabled = false
+		}
+		return car.AutoSeatAndClimate(ctx, positions, enabled)
+	},
+	"windows-vent": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.VentWindows(ctx)
+	},
+	"windows-close": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.CloseWindows(ctx)
+	},
+	"body-controller-state": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		info, err := car.BodyControllerState(ctx)
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			return printJSON(info)
+		}
+		options := protojson.MarshalOptions{
+			Indent:            "\t",
+			UseEnumNumbers:    false,
+			EmitUnpopulated:   false,
+			EmitDefaultValues: true,
+		}
+		fmt.Println(options.Format(info))
+		return nil
+	},
+	"homelink-list": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		latitude, err := strconv.ParseFloat(args["LATITUDE"], 32)
+		if err != nil {
+			return fmt.Errorf("%w: invalid latitude", ErrCommandLineArgs)
+		}
+		longitude, err := strconv.ParseFloat(args["LONGITUDE"], 32)
+		if err != nil {
+			return fmt.Errorf("%w: invalid longitude", ErrCommandLineArgs)
+		}
+		devices, err := car.NearbyHomelinkDevices(ctx, float32(latitude), float32(longitude))
+		if err != nil {
+			return err
+		}
+		if jsonOutput {
+			encoded, err := json.Marshal(devices)
 			if err != nil {
 				return err
 			}
+			fmt.Println(string(encoded))
+			return nil
+		}
+		if len(devices) == 0 {
+			fmt.Println("No HomeLink devices in range")
+		}
+		for _, device := range devices {
+			fmt.Printf("HomeLink device at %.6f, %.6f is in range (%.0f m away)\n", device.Latitude, device.Longitude, device.Distance)
+		}
+		return nil
+	},
+	"guest-mode-on": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.SetGuestMode(ctx, true)
+	},
+	"guest-mode-off": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.SetGuestMode(ctx, false)
+	},
+	"erase-guest-data": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		return car.EraseGuestData(ctx)
+	},
+	"charging-schedule-add": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		var err error
+		schedule := vehicle.ChargeSchedule{
+			Id:      uint64(time.Now().Unix()),
+			Enabled: true,
+		}
 
-			r := strings.Split(args["TIME"], "-")
-			if len(r) != 2 {
-				return errors.New("invalid time range")
-			}
+		if enabledStr, ok := args["ENABLED"]; ok {
+			schedule.Enabled = enabledStr == "true"
+		}
 
-			if r[0] != "" {
-				schedule.StartTime, err = MinutesAfterMidnight(r[0])
-				schedule.StartEnabled = true
-				if err != nil {
-					return err
-				}
-			}
+		schedule.DaysOfWeek, err = GetDays(args["DAYS"])
+		if err != nil {
+			return err
+		}
 
-			if r[1] != "" {
-				schedule.EndTime, err = MinutesAfterMidnight(r[1])
-				schedule.EndEnabled = true
-				if err != nil {
-					return err
-				}
-			}
+		r := strings.Split(args["TIME"], "-")
+		if len(r) != 2 {
+			return errors.New("invalid time range")
+		}
 
-			schedule.Latitude, err = GetDegree(args["LATITUDE"])
+		if r[0] != "" {
+			schedule.StartTime, err = units.ParseTimeOfDay(r[0])
+			schedule.StartEnabled = true
 			if err != nil {
 				return err
 			}
+		}
 
-			schedule.Longitude, err = GetDegree(args["LONGITUDE"])
+		if r[1] != "" {
+			schedule.EndTime, err = units.ParseTimeOfDay(r[1])
+			schedule.EndEnabled = true
 			if err != nil {
 				return err
 			}
+		}
 
-			if repeatPolicy, ok := args["REPEAT"]; ok && repeatPolicy == "once" {
-				schedule.OneTime = true
-			}
+		schedule.Latitude, err = GetDegree(args["LATITUDE"])
+		if err != nil {
+			return err
+		}
 
-			if err := car.AddChargeSchedule(ctx, &schedule); err != nil {
-				return err
-			}
-			fmt.Printf("%d\n", schedule.Id)
-			return nil
-		},
-	},
-	"charging-schedule-remove": {
-		help:             "Removes charging schedule of TYPE [ID]",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "TYPE", help: "home|work|other|id"},
-		},
-		optional: []Argument{
-			{name: "ID", help: "numeric ID of schedule to remove when TYPE set to id"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			var home, work, other bool
-			switch strings.ToUpper(args["TYPE"]) {
-			case "ID":
-				if idStr, ok := args["ID"]; ok {
-					id, err := strconv.ParseUint(idStr, 10, 64)
-					if err != nil {
-						return errors.New("expected numeric ID")
-					}
-					return car.RemoveChargeSchedule(ctx, id)
-				} else {
-					return errors.New("missing schedule ID")
-				}
-			case "HOME":
-				home = true
-			case "WORK":
-				work = true
-			case "OTHER":
-				other = true
-			default:
-				return errors.New("TYPE must be home|work|other|id")
-			}
-			return car.BatchRemoveChargeSchedules(ctx, home, work, other)
-		},
-	},
-	"precondition-schedule-add": {
-		help:             "Schedule precondition for DAYS TIME at LATITUDE LONGITUDE.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "DAYS", help: "Comma-separated list of any of Sun, Mon, Tues, Wed, Thurs, Fri, Sat OR all OR weekdays"},
-			{name: "TIME", help: "Time to precondition by. Example: '22:00'"},
-			{name: "LATITUDE", help: "Latitude of location to precondition at."},
-			{name: "LONGITUDE", help: "Longitude of location to precondition at."},
-		},
-		optional: []Argument{
-			{name: "REPEAT", help: "Set to 'once' or omit to repeat weekly"},
-			{name: "ID", help: "The ID of the precondition schedule to modify. Not required for new schedules."},
-			{name: "ENABLED", help: "Whether the precondition schedule is enabled. Expects 'true' or 'false'. Defaults to true."},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			var err error
-			schedule := vehicle.PreconditionSchedule{
-				Id:      uint64(time.Now().Unix()),
-				Enabled: true,
-			}
+		schedule.Longitude, err = GetDegree(args["LONGITUDE"])
+		if err != nil {
+			return err
+		}
 
-			if enabledStr, ok := args["ENABLED"]; ok {
-				schedule.Enabled = enabledStr == "true"
-			}
+		if repeatPolicy, ok := args["REPEAT"]; ok && repeatPolicy == "once" {
+			schedule.OneTime = true
+		}
 
+		if err := car.AddChargeSchedule(ctx, &schedule); err != nil {
+			return err
+		}
+		fmt.Printf("%d\n", schedule.Id)
+		return nil
+	},
+	"charging-schedule-remove": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		var home, work, other bool
+		switch strings.ToUpper(args["TYPE"]) {
+		case "ID":
 			if idStr, ok := args["ID"]; ok {
 				id, err := strconv.ParseUint(idStr, 10, 64)
 				if err != nil {
 					return errors.New("expected numeric ID")
 				}
-				schedule.Id = id
+				return car.RemoveChargeSchedule(ctx, id)
+			} else {
+				return errors.New("missing schedule ID")
+			}
+		case "HOME":
+			home = true
+		case "WORK":
+			work = true
+		case "OTHER":
+			other = true
+		default:
+			return errors.New("TYPE must be home|work|other|id")
+		}
+		return car.BatchRemoveChargeSchedules(ctx, home, work, other)
+	},
+	"charging-schedule-mode": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		mode, err := vehicle.ParseChargingScheduleMode(args["MODE"])
+		if err != nil {
+			return err
+		}
+		var minutes int32
+		if timeStr, ok := args["TIME"]; ok {
+			if minutes, err = units.ParseTimeOfDay(timeStr); err != nil {
+				return err
 			}
-
-			schedule.DaysOfWeek, err = GetDays(args["DAYS"])
+		} else if mode != vehicle.ChargingScheduleOff {
+			return fmt.Errorf("TIME is required for mode %s", mode)
+		}
+		return car.SetChargingScheduleMode(ctx, mode, time.Duration(minutes)*time.Minute)
+	},
+	"charging-off-peak": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, _ map[string]string) error {
+		settings, err := car.OffPeakCharging(ctx)
+		if err != nil {
+			return err
+		}
+		return printOffPeakCharging(settings)
+	},
+	"charging-set-off-peak": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		var settings vehicle.OffPeakChargingSettings
+		var err error
+		if settings.Enabled, err = parseOnOff(args["STATE"]); err != nil {
+			return err
+		}
+		if timeStr, ok := args["END_TIME"]; ok {
+			minutes, err := units.ParseTimeOfDay(timeStr)
 			if err != nil {
 				return err
 			}
+			settings.EndTime = time.Duration(minutes) * time.Minute
+		} else if settings.Enabled {
+			return fmt.Errorf("%w: END_TIME is required when turning off-peak charging on", ErrCommandLineArgs)
+		}
+		switch args["DAYS"] {
+		case "", "all":
+		case "weekdays":
+			settings.WeekdaysOnly = true
+		default:
+			return fmt.Errorf("%w: DAYS must be 'all' or 'weekdays'", ErrCommandLineArgs)
+		}
+		if err := car.SetOffPeakCharging(ctx, settings); err != nil {
+			return err
+		}
+		if updated, err := car.OffPeakCharging(ctx); err == nil {
+			return printOffPeakCharging(updated)
+		}
+		return nil
+	},
+	"precondition-schedule-add": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		var err error
+		schedule := vehicle.PreconditionSchedule{
+			Id:      uint64(time.Now().Unix()),
+			Enabled: true,
+		}
 
-			if timeStr, ok := args["TIME"]; ok {
-				schedule.PreconditionTime, err = MinutesAfterMidnight(timeStr)
-				if err != nil {
-					return err
-				}
-			} else {
-				return errors.New("expected TIME")
-			}
+		if enabledStr, ok := args["ENABLED"]; ok {
+			schedule.Enabled = enabledStr == "true"
+		}
 
-			schedule.Latitude, err = GetDegree(args["LATITUDE"])
+		if idStr, ok := args["ID"]; ok {
+			id, err := strconv.ParseUint(idStr, 10, 64)
 			if err != nil {
-				return err
+				return errors.New("expected numeric ID")
 			}
+			schedule.Id = id
+		}
+
+		schedule.DaysOfWeek, err = GetDays(args["DAYS"])
+		if err != nil {
+			return err
+		}
 
-			schedule.Longitude, err = GetDegree(args["LONGITUDE"])
+		if timeStr, ok := args["TIME"]; ok {
+			schedule.PreconditionTime, err = units.ParseTimeOfDay(timeStr)
 			if err != nil {
 				return err
 			}
+		} else {
+			return errors.New("expected TIME")
+		}
 
-			if repeatPolicy, ok := args["REPEAT"]; ok && repeatPolicy == "once" {
-				schedule.OneTime = true
-			}
+		schedule.Latitude, err = GetDegree(args["LATITUDE"])
+		if err != nil {
+			return err
+		}
 
-			if err := car.AddPreconditionSchedule(ctx, &schedule); err != nil {
-				return err
-			}
-			fmt.Printf("%d\n", schedule.Id)
-			return nil
-		},
-	},
-	"precondition-schedule-remove": {
-		help:             "Removes precondition schedule of TYPE [ID]",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "TYPE", help: "home|work|other|id"},
-		},
-		optional: []Argument{
-			{name: "ID", help: "numeric ID of schedule to remove when TYPE set to id"},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			var home, work, other bool
-			switch strings.ToUpper(args["TYPE"]) {
-			case "ID":
-				if idStr, ok := args["ID"]; ok {
-					id, err := strconv.ParseUint(idStr, 10, 64)
-					if err != nil {
-						return errors.New("expected numeric ID")
-					}
-					return car.RemovePreconditionSchedule(ctx, id)
-				} else {
-					return errors.New("missing schedule ID")
+		schedule.Longitude, err = GetDegree(args["LONGITUDE"])
+		if err != nil {
+			return err
+		}
+
+		if repeatPolicy, ok := args["REPEAT"]; ok && repeatPolicy == "once" {
+			schedule.OneTime = true
+		}
+
+		if err := car.AddPreconditionSchedule(ctx, &schedule); err != nil {
+			return err
+		}
+		fmt.Printf("%d\n", schedule.Id)
+		return nil
+	},
+	"precondition-schedule-remove": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		var home, work, other bool
+		switch strings.ToUpper(args["TYPE"]) {
+		case "ID":
+			if idStr, ok := args["ID"]; ok {
+				id, err := strconv.ParseUint(idStr, 10, 64)
+				if err != nil {
+					return errors.New("expected numeric ID")
 				}
-			case "HOME":
-				home = true
-			case "WORK":
-				work = true
-			case "OTHER":
-				other = true
-			default:
-				return errors.New("TYPE must be home|work|other|id")
-			}
-			return car.BatchRemovePreconditionSchedules(ctx, home, work, other)
-		},
-	},
-	"state": {
-		help:             "Fetch vehicle state over BLE.",
-		requiresAuth:     true,
-		requiresFleetAPI: false,
-		args: []Argument{
-			{name: "CATEGORY", help: "One of " + strings.Join(categoryNames(), ", ")},
-		},
-		handler: func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
-			category, err := GetCategory(args["CATEGORY"])
-			if err != nil {
-				return err
-			}
-			data, err := car.GetState(ctx, category)
-			if err != nil {
-				return err
-			}
-			fmt.Println(protojson.Format(data))
-			return nil
-		},
+				return car.RemovePreconditionSchedule(ctx, id)
+			} else {
+				return errors.New("missing schedule ID")
+			}
+		case "HOME":
+			home = true
+		case "WORK":
+			work = true
+		case "OTHER":
+			other = true
+		default:
+			return errors.New("TYPE must be home|work|other|id")
+		}
+		return car.BatchRemovePreconditionSchedules(ctx, home, work, other)
+	},
+	"state": func(ctx context.Context, _ *account.Account, car *vehicle.Vehicle, args map[string]string) error {
+		category, err := GetCategory(args["CATEGORY"])
+		if err != nil {
+			return err
+		}
+		state, err := car.GetStateWithOptions(ctx, category, vehicle.StateOptions{MaxStaleness: maxStateAge})
+		if err != nil {
+			return err
+		}
+		if !state.Timestamp.IsZero() {
+			writeErr("Data age: %s", state.Age().Round(time.Second))
+		}
+		if jsonOutput {
+			return printJSON(state.Data)
+		}
+		fmt.Println(protojson.Format(state.Data))
+		return nil
 	},
 }
@@ -4,37 +4,11 @@ import (
 	"errors"
 	"strconv"
 	"testing"
-)
 
-func TestMinutesAfterMidnight(t *testing.T) {
-	type params struct {
-		str     string
-		minutes int32
-		err     error
-	}
-	testCases := []params{
-		{str: "3:03", minutes: 183},
-		{str: "0:00", minutes: 0},
-		{str: "", err: ErrInvalidTime},
-		{str: "3:", err: ErrInvalidTime},
-		{str: ":40", err: ErrInvalidTime},
-		{str: "3:40pm", err: ErrInvalidTime},
-		{str: "25:40", err: ErrInvalidTime},
-		{str: "23:40", minutes: 23*60 + 40},
-		{str: "23:60", err: ErrInvalidTime},
-		{str: "23:-01", err: ErrInvalidTime},
-		{str: "24:00", err: ErrInvalidTime},
-		{str: "-2:00", err: ErrInvalidTime},
-	}
-	for _, test := range testCases {
-		minutes, err := MinutesAfterMidnight(test.str)
-		if !errors.Is(err, test.err) {
-			t.Errorf("expected '%s' to result in error %s, but got %s", test.str, test.err, err)
-		} else if test.minutes != minutes {
-			t.Errorf("expected MinutesAfterMidnight('%s') = %d, but got %d", test.str, test.minutes, minutes)
-		}
-	}
-}
+	"github.com/teslamotors/vehicle-command/internal/units"
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
 
 func TestGetDays(t *testing.T) {
 	type params struct {
@@ -62,3 +36,104 @@ func TestGetDays(t *testing.T) {
 		}
 	}
 }
+
+func TestCatalogCommandsHaveHandlers(t *testing.T) {
+	for _, spec := range catalog.Commands() {
+		if spec.CLIName == "" {
+			continue
+		}
+		if _, ok := commands[spec.CLIName]; !ok {
+			t.Errorf("Catalog command %s has no handler", spec.CLIName)
+		}
+	}
+	expected := len(handlers)
+	for _, spec := range catalog.Commands() {
+		expected += len(spec.CLIAliases)
+	}
+	if len(commands) != expected {
+		t.Errorf("Expected %d commands, got %d", expected, len(commands))
+	}
+	if alias := commands["charge-standard"]; alias == nil || alias.domain != commands["charging-set-limit-standard"].domain {
+		t.Errorf("Alias charge-standard wasn't registered")
+	}
+}
+
+func TestParseArgsKeywords(t *testing.T) {
+	cmd := commands["climate-set-temp"]
+	tests := []struct {
+		args []string
+		want map[string]string
+	}{
+		{[]string{"climate-set-temp", "70f"}, map[string]string{"DRIVER": "70f"}},
+		{[]string{"climate-set-temp", "21", "23", "C"}, map[string]string{"DRIVER": "21", "PASSENGER": "23", "UNIT": "C"}},
+		{
+			[]string{"climate-set-temp", "-driver", "21.5", "-passenger", "23", "-unit", "F"},
+			map[string]string{"DRIVER": "21.5", "PASSENGER": "23", "UNIT": "F"},
+		},
+		{[]string{"climate-set-temp", "-unit", "F", "70"}, map[string]string{"DRIVER": "70", "UNIT": "F"}},
+	}
+	for _, test := range tests {
+		got, err := cmd.parseArgs(test.args)
+		if err != nil {
+			t.Errorf("%v: %s", test.args, err)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%v: got %v, want %v", test.args, got, test.want)
+		}
+		for name, value := range test.want {
+			if got[name] != value {
+				t.Errorf("%v: got %s=%q, want %q", test.args, name, got[name], value)
+			}
+		}
+	}
+	for _, args := range [][]string{
+		{"climate-set-temp"},
+		{"climate-set-temp", "-unit", "F"},
+		{"climate-set-temp", "21", "23", "C", "extra"},
+	} {
+		if _, err := cmd.parseArgs(args); err == nil {
+			t.Errorf("Expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestParseTemperature(t *testing.T) {
+	tests := []struct {
+		str     string
+		unit    units.System
+		celsius float32
+	}{
+		{"21.5", units.Metric, 21.5},
+		{"21.5c", units.Imperial, 21.5},
+		{"212F", units.Metric, 100},
+		{"32", units.Imperial, 0},
+	}
+	for _, test := range tests {
+		celsius, err := parseTemperature(test.str, test.unit)
+		if err != nil || celsius != test.celsius {
+			t.Errorf("parseTemperature(%q, %v) = %v, %v; want %v", test.str, test.unit, celsius, err, test.celsius)
+		}
+	}
+	if _, err := parseTemperature("warm", units.Metric); !errors.Is(err, ErrCommandLineArgs) {
+		t.Errorf("Expected ErrCommandLineArgs, got %v", err)
+	}
+}
+
+func TestParseSeatHeaters(t *testing.T) {
+	levels, err := parseSeatHeaters("front-left:high, front-right:low")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(levels) != 2 || levels[vehicle.SeatFrontLeft] != vehicle.LevelHigh || levels[vehicle.SeatFrontRight] != vehicle.LevelLow {
+		t.Errorf("Unexpected seat heater levels %v", levels)
+	}
+	if levels, err := parseSeatHeaters(""); err != nil || levels != nil {
+		t.Errorf("Expected no seat heaters, got %v (%v)", levels, err)
+	}
+	for _, spec := range []string{"front-left", "trunk:high", "front-left:warm"} {
+		if _, err := parseSeatHeaters(spec); !errors.Is(err, ErrCommandLineArgs) {
+			t.Errorf("Expected %q to be rejected, got %v", spec, err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/internal/completion"
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+)
+
+// argHint renders a command's arguments the way Usage does, e.g. "DAYS TIME [ REPEAT ]".
+func (c *Command) argHint() string {
+	var names []string
+	for _, arg := range c.args {
+		names = append(names, arg.name)
+	}
+	if len(c.optional) > 0 {
+		names = append(names, "[")
+		for _, arg := range c.optional {
+			names = append(names, arg.name)
+		}
+		names = append(names, "]")
+	}
+	return strings.Join(names, " ")
+}
+
+// completionCommands lists vehicle commands along with commands handled directly by main.
+func completionCommands() []completion.Command {
+	list := []completion.Command{
+		{Name: "help", Args: "[ COMMAND ]", Help: "Print usage information"},
+		{Name: "encode", Args: "COMMAND [ ARG... ]", Help: "Print the unsigned payload a command sends (offline)"},
+		{Name: "decode", Args: "MESSAGE", Help: "Print a base64 or hex RoutableMessage (offline)"},
+		{Name: "list-commands", Args: "[ -json ]", Help: "List commands, or print the command catalog as JSON"},
+		{Name: "config-dump", Args: "[ -json ]", Help: "Print the effective configuration with secrets masked"},
+		{Name: "completion", Args: "bash|zsh|fish", Help: "Print a shell completion script"},
+	}
+	for name, info := range commands {
+		list = append(list, completion.Command{Name: name, Args: info.argHint(), Help: info.help})
+	}
+	return list
+}
+
+func completionSpec(config *cli.Config) *completion.Spec {
+	return &completion.Spec{
+		Program:    "tesla-control",
+		Flags:      flag.CommandLine,
+		Commands:   completionCommands,
+		FlagValues: config.FlagValues(),
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+)
+
+const configDumpCommand = "config-dump"
+
+// runConfigDump prints the settings that config resolved from flags, the selected profile, and
+// environment variables, followed by tesla-control's own options. It doesn't load credentials, so
+// it never prompts for a keyring password, and secrets are masked as described in cli.Config.Dump.
+func runConfigDump(config *cli.Config, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet(configDumpCommand, flag.ContinueOnError)
+	asJSON := flags.Bool("json", jsonOutput, "Print the configuration as a JSON object")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("usage: %s [-json]", configDumpCommand)
+	}
+	settings := config.Dump()
+	cli.DumpFlags(flag.CommandLine, settings)
+	if *asJSON {
+		encoded, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(encoded))
+		return nil
+	}
+	_, err := io.WriteString(out, cli.FormatSettings(settings))
+	return err
+}
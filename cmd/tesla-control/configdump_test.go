@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"github.com/teslamotors/vehicle-command/pkg/redact"
+)
+
+func TestConfigDump(t *testing.T) {
+	const password = "keyring-hunter2"
+	t.Setenv(cli.EnvTeslaKeyringPass, password)
+	t.Setenv(cli.EnvTeslaKeyFile, "/etc/tesla/private.pem")
+	t.Setenv(cli.EnvTeslaTokenFile, "/etc/tesla/token")
+	config, err := cli.NewConfig(cli.FlagAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ReadFromEnvironment()
+
+	var out bytes.Buffer
+	if err := runConfigDump(config, []string{"-json"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), password) {
+		t.Fatalf("Configuration dump contains the keyring password: %s", out.String())
+	}
+	var settings map[string]string
+	if err := json.Unmarshal(out.Bytes(), &settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings["key-file"] != "/etc/tesla/private.pem" || settings["token-file"] != "/etc/tesla/token" ||
+		settings["keyring-password"] != redact.Secret {
+		t.Errorf("Unexpected settings %v", settings)
+	}
+
+	if err := runConfigDump(config, []string{"extra"}, &out); err == nil {
+		t.Error("Expected error for unexpected argument")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+)
+
+// exitUnconfirmed is the exit status when a command was delivered but the vehicle didn't reach the
+// requested state before the -confirm-timeout expired.
+const exitUnconfirmed = 3
+
+const defaultConfirmTimeout = 10 * time.Second
+
+// confirmPollInterval is the delay between lock state queries. Tests shorten it.
+var confirmPollInterval = time.Second
+
+// confirmedLockStates maps the commands that -confirm can check to the lock state they request.
+var confirmedLockStates = map[string]bool{
+	"lock":   true,
+	"unlock": false,
+}
+
+var errConfirmUnsupported = errors.New("-confirm only applies to lock and unlock")
+
+// confirmation configures -confirm. When enabled, lock and unlock commands succeed only once the
+// vehicle reports the requested lock state.
+type confirmation struct {
+	enabled bool
+	timeout time.Duration
+}
+
+// lockReader returns true if the vehicle is locked.
+type lockReader func(ctx context.Context) (bool, error)
+
+func lockStateName(locked bool) string {
+	if locked {
+		return "locked"
+	}
+	return "unlocked"
+}
+
+// lockedFromStatus interprets the body controller's lock state. Selective unlock (for example,
+// only the driver's door) counts as unlocked.
+func lockedFromStatus(status *vcsec.VehicleStatus) bool {
+	switch status.GetVehicleLockState() {
+	case vcsec.VehicleLockState_E_VEHICLELOCKSTATE_LOCKED, vcsec.VehicleLockState_E_VEHICLELOCKSTATE_INTERNAL_LOCKED:
+		return true
+	}
+	return false
+}
+
+// lockedFromVehicleData reads vehicle_state.locked from a Fleet API vehicle_data response.
+func lockedFromVehicleData(body []byte) (bool, error) {
+	var reply struct {
+		Response struct {
+			VehicleState *struct {
+				Locked bool `json:"locked"`
+			} `json:"vehicle_state"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return false, fmt.Errorf("invalid vehicle data: %w", err)
+	}
+	if reply.Response.VehicleState == nil {
+		return false, errors.New("vehicle data didn't include vehicle_state")
+	}
+	return reply.Response.VehicleState.Locked, nil
+}
+
+// lockReader reads the lock state from vehicle data when connected over the Internet, and from the
+// body controller over BLE, which works even if infotainment is asleep.
+func (c *connection) lockReader() lockReader {
+	if c.acct != nil {
+		endpoint := fmt.Sprintf("api/1/vehicles/%s/vehicle_data?endpoints=vehicle_state", c.car.VIN())
+		return func(ctx context.Context) (bool, error) {
+			body, err := c.acct.Get(ctx, endpoint)
+			if err != nil {
+				return false, err
+			}
+			return lockedFromVehicleData(body)
+		}
+	}
+	return func(ctx context.Context) (bool, error) {
+		status, err := c.car.BodyControllerState(ctx)
+		if err != nil {
+			return false, err
+		}
+		return lockedFromStatus(status), nil
+	}
+}
+
+// confirmLockState polls read until the vehicle's lock state matches want or timeout expires.
+func confirmLockState(read lockReader, want bool, timeout time.Duration, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var last error
+	for {
+		locked, err := read(ctx)
+		if err == nil && locked == want {
+			fmt.Fprintf(out, "Confirmed: vehicle is %s\n", lockStateName(locked))
+			return nil
+		}
+		if err == nil {
+			last = fmt.Errorf("vehicle is still %s", lockStateName(locked))
+		} else {
+			last = err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("vehicle not confirmed %s within %s (see -confirm-timeout): %w", lockStateName(want), timeout, last)
+		case <-time.After(confirmPollInterval):
+		}
+	}
+}
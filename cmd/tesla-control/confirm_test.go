@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+)
+
+func TestLockedFromStatus(t *testing.T) {
+	tests := map[vcsec.VehicleLockState_E]bool{
+		vcsec.VehicleLockState_E_VEHICLELOCKSTATE_LOCKED:             true,
+		vcsec.VehicleLockState_E_VEHICLELOCKSTATE_INTERNAL_LOCKED:    true,
+		vcsec.VehicleLockState_E_VEHICLELOCKSTATE_UNLOCKED:           false,
+		vcsec.VehicleLockState_E_VEHICLELOCKSTATE_SELECTIVE_UNLOCKED: false,
+	}
+	for state, locked := range tests {
+		if got := lockedFromStatus(&vcsec.VehicleStatus{VehicleLockState: state}); got != locked {
+			t.Errorf("%s: expected locked=%v", state, locked)
+		}
+	}
+}
+
+func TestLockedFromVehicleData(t *testing.T) {
+	locked, err := lockedFromVehicleData([]byte(`{"response":{"vehicle_state":{"locked":true}}}`))
+	if err != nil || !locked {
+		t.Errorf("Expected locked, got %v, %v", locked, err)
+	}
+	if _, err := lockedFromVehicleData([]byte(`{"response":{}}`)); err == nil {
+		t.Errorf("Expected error when vehicle_state is missing")
+	}
+	if _, err := lockedFromVehicleData([]byte(`not json`)); err == nil {
+		t.Errorf("Expected error for invalid JSON")
+	}
+}
+
+func TestConfirmLockState(t *testing.T) {
+	defer func(interval time.Duration) { confirmPollInterval = interval }(confirmPollInterval)
+	confirmPollInterval = time.Millisecond
+
+	// The vehicle reports the old state and then an error before reaching the requested state.
+	replies := []struct {
+		locked bool
+		err    error
+	}{{false, nil}, {false, errors.New("vehicle asleep")}, {true, nil}}
+	read := func(context.Context) (bool, error) {
+		reply := replies[0]
+		if len(replies) > 1 {
+			replies = replies[1:]
+		}
+		return reply.locked, reply.err
+	}
+	var out bytes.Buffer
+	if err := confirmLockState(read, true, time.Second, &out); err != nil {
+		t.Fatalf("Expected confirmation, got %s", err)
+	}
+	if out.String() != "Confirmed: vehicle is locked\n" {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+
+	stillLocked := func(context.Context) (bool, error) { return true, nil }
+	err := confirmLockState(stillLocked, false, 20*time.Millisecond, &out)
+	if err == nil || !strings.Contains(err.Error(), "still locked") {
+		t.Errorf("Expected state mismatch, got %v", err)
+	}
+}
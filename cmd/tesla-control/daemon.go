@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// daemonCommand keeps a vehicle connection open and runs a single configured command whenever a
+// local client triggers it, avoiding the connection and handshake latency of running tesla-control
+// once per actuation.
+const daemonCommand = "daemon"
+
+const (
+	// EnvDaemonSecret holds the shared secret that clients present to trigger the daemon's command,
+	// if -secret-file isn't provided.
+	EnvDaemonSecret = "TESLA_DAEMON_SECRET"
+
+	defaultDaemonListen   = "127.0.0.1:8742"
+	defaultDaemonCooldown = 30 * time.Second
+	minDaemonSecretLength = 16
+	daemonTriggerPath     = "/trigger"
+)
+
+const daemonUsage = "usage: daemon [-listen ADDRESS|unix:PATH] [-secret-file FILE] [-cooldown DURATION] [-idle-timeout DURATION] COMMAND [ARG...]"
+
+type daemonOptions struct {
+	listen      string
+	secret      []byte
+	cooldown    time.Duration
+	idleTimeout time.Duration
+	command     []string
+}
+
+// parseDaemonArgs parses the options and command that follow "daemon" on the command line.
+func parseDaemonArgs(args []string) (*daemonOptions, error) {
+	opts := &daemonOptions{}
+	var secretFile string
+	flags := flag.NewFlagSet(daemonCommand, flag.ContinueOnError)
+	flags.StringVar(&opts.listen, "listen", defaultDaemonListen, "Loopback `address` or unix:PATH to accept triggers on")
+	flags.StringVar(&secretFile, "secret-file", "", "Read the trigger secret from `file`. Defaults to $"+EnvDaemonSecret+".")
+	flags.DurationVar(&opts.cooldown, "cooldown", defaultDaemonCooldown, "Minimum time between actuations")
+	flags.DurationVar(&opts.idleTimeout, "idle-timeout", 0, "Disconnect after this long without a trigger. Zero keeps the connection open.")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if secretFile != "" {
+		secret, err := os.ReadFile(secretFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read trigger secret: %w", err)
+		}
+		opts.secret = []byte(strings.TrimSpace(string(secret)))
+	} else {
+		opts.secret = []byte(os.Getenv(EnvDaemonSecret))
+	}
+	if len(opts.secret) < minDaemonSecretLength {
+		return nil, fmt.Errorf("daemon requires a trigger secret of at least %d characters in -secret-file or $%s", minDaemonSecretLength, EnvDaemonSecret)
+	}
+	if opts.cooldown < 0 || opts.idleTimeout < 0 {
+		return nil, errors.New("cooldown and idle timeout can't be negative")
+	}
+
+	opts.command = flags.Args()
+	if len(opts.command) == 0 {
+		return nil, errors.New(daemonUsage)
+	}
+	info, ok := commands[opts.command[0]]
+	if !ok {
+		return nil, ErrUnknownCommand
+	}
+	if info.requiresFleetAPI {
+		return nil, fmt.Errorf("%s doesn't send a command to the vehicle", opts.command[0])
+	}
+	if _, err := info.parseArgs(opts.command); err != nil {
+		info.Usage(opts.command[0])
+		return nil, err
+	}
+	return opts, nil
+}
+
+// daemonListen listens on a Unix socket ("unix:PATH") or a loopback TCP address. Other addresses
+// are refused: the shared secret is sent in the clear.
+func daemonListen(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		// Remove a socket left behind by a previous run, but nothing else.
+		if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			listener.Close()
+			return nil, err
+		}
+		return listener, nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("daemon only listens on loopback addresses or Unix sockets, not %s", address)
+	}
+	return net.Listen("tcp", address)
+}
+
+// daemon serves trigger requests. Only one command runs at a time, and actuations are at least
+// opts.cooldown apart.
+//
+// If opts.idleTimeout is set, the daemon disconnects once that long has passed since the last
+// command, freeing one of the vehicle's BLE connection slots, and reconnects on the next trigger.
+type daemon struct {
+	opts       *daemonOptions
+	send       func() error
+	disconnect func()
+	clock      clock.Clock
+
+	lock     sync.Mutex
+	last     time.Time
+	lastUsed time.Time
+	idle     clock.Timer
+	stopped  chan struct{} // Closed by stop to end watchIdle
+}
+
+func newDaemon(conn *connection, t *timeouts, confirm confirmation, opts *daemonOptions) *daemon {
+	send := func() error {
+		if err := sendDaemonCommand(conn, t, opts.command); err != nil {
+			return err
+		}
+		if want, ok := confirmedLockStates[opts.command[0]]; ok && confirm.enabled {
+			return confirmLockState(conn.lockReader(), want, confirm.timeout, os.Stdout)
+		}
+		return nil
+	}
+	d := &daemon{opts: opts, send: send, disconnect: conn.close, clock: clock.Real}
+	if conn.car != nil {
+		d.lock.Lock()
+		d.resetIdleTimer()
+		d.lock.Unlock()
+	}
+	return d
+}
+
+// resetIdleTimer restarts the idle window. The caller must hold d.lock.
+func (d *daemon) resetIdleTimer() {
+	if d.opts.idleTimeout <= 0 {
+		return
+	}
+	d.lastUsed = d.clock.Now()
+	if d.idle == nil {
+		d.idle = d.clock.NewTimer(d.opts.idleTimeout)
+		d.stopped = make(chan struct{})
+		go d.watchIdle(d.idle, d.stopped)
+	} else {
+		d.idle.Reset(d.opts.idleTimeout)
+	}
+}
+
+// watchIdle disconnects whenever timer fires, until stopped is closed.
+func (d *daemon) watchIdle(timer clock.Timer, stopped <-chan struct{}) {
+	for {
+		select {
+		case <-timer.C():
+			d.disconnectIfIdle()
+		case <-stopped:
+			return
+		}
+	}
+}
+
+func (d *daemon) disconnectIfIdle() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	// A trigger may have arrived after the timer fired but before the lock was acquired. That
+	// trigger restarted the timer, so there's nothing to do until it fires again.
+	if d.idle == nil || clock.Since(d.clock, d.lastUsed) < d.opts.idleTimeout {
+		return
+	}
+	fmt.Printf("Disconnecting after %s without a trigger\n", d.opts.idleTimeout)
+	d.disconnect()
+}
+
+// stop cancels the idle timer. The caller is responsible for closing the connection.
+func (d *daemon) stop() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.idle != nil {
+		d.idle.Stop()
+		close(d.stopped)
+		d.idle = nil
+	}
+}
+
+// sendDaemonCommand sends command, reconnecting first if the connection was lost. A command that
+// couldn't be transmitted is sent once more after reconnecting; the vehicle can't have executed it.
+func sendDaemonCommand(conn *connection, t *timeouts, command []string) error {
+	for attempt := 0; ; attempt++ {
+		if conn.car == nil {
+			if err := conn.open(t.connect); err != nil {
+				return err
+			}
+		}
+		ctx, cancel := withDeadline("command", t.command)
+		err := execute(ctx, conn.acct, conn.car, command)
+		explained := explainDeadline(ctx, err)
+		cancel()
+		if attempt == 0 && errors.Is(err, protocol.ErrNotConnected) {
+			conn.close()
+			continue
+		}
+		return explained
+	}
+}
+
+func writeDaemonResponse(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	response := map[string]interface{}{"result": err == nil}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (d *daemon) authorized(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), d.opts.secret) == 1
+}
+
+func (d *daemon) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != daemonTriggerPath {
+		writeDaemonResponse(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeDaemonResponse(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return
+	}
+	if !d.authorized(req) {
+		writeErr("Rejected unauthenticated trigger")
+		writeDaemonResponse(w, http.StatusUnauthorized, errors.New("invalid secret"))
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if wait := d.opts.cooldown - clock.Since(d.clock, d.last); !d.last.IsZero() && wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeDaemonResponse(w, http.StatusTooManyRequests, fmt.Errorf("cooling down for another %s", wait.Round(time.Second)))
+		return
+	}
+	// The cooldown starts even if the command fails, since the vehicle may have executed it.
+	d.last = d.clock.Now()
+	err := d.send()
+	d.resetIdleTimer()
+	if err != nil {
+		writeErr("Triggered %s failed: %s", d.opts.command[0], err)
+		writeDaemonResponse(w, http.StatusBadGateway, err)
+		return
+	}
+	fmt.Printf("Triggered %s at %s\n", d.opts.command[0], d.last.Format(time.RFC3339))
+	writeDaemonResponse(w, http.StatusOK, nil)
+}
+
+// runDaemon serves triggers until interrupted.
+func runDaemon(conn *connection, t *timeouts, confirm confirmation, opts *daemonOptions) int {
+	listener, err := daemonListen(opts.listen)
+	if err != nil {
+		writeErr("Error: %s", err)
+		return 1
+	}
+	d := newDaemon(conn, t, confirm, opts)
+	defer d.stop()
+	server := &http.Server{Handler: d, ReadHeaderTimeout: 5 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	fmt.Printf("Waiting for POST %s on %s to run %s\n", daemonTriggerPath, opts.listen, strings.Join(opts.command, " "))
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		writeErr("Error: %s", err)
+		return 1
+	}
+	return 0
+}
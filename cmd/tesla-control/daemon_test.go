@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+)
+
+const testDaemonSecret = "0123456789abcdef"
+
+func TestParseDaemonArgs(t *testing.T) {
+	t.Setenv(EnvDaemonSecret, testDaemonSecret)
+	opts, err := parseDaemonArgs([]string{"-cooldown", "5s", "unlock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.cooldown != 5*time.Second || opts.listen != defaultDaemonListen || opts.command[0] != "unlock" {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secretFile, []byte("short\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := [][]string{
+		{},
+		{"not-a-command"},
+		{"list-keys", "extra"},
+		{"get", "api/1/products"},
+		{"-cooldown", "-1s", "unlock"},
+		{"-idle-timeout", "-1s", "unlock"},
+		{"-secret-file", secretFile, "unlock"},
+	}
+	for _, args := range invalid {
+		if _, err := parseDaemonArgs(args); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
+
+func TestDaemonListenRequiresLoopback(t *testing.T) {
+	for _, address := range []string{"0.0.0.0:0", "192.0.2.1:0", "example.com:0"} {
+		if listener, err := daemonListen(address); err == nil {
+			listener.Close()
+			t.Errorf("Expected %s to be refused", address)
+		}
+	}
+	listener, err := daemonListen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.Close()
+}
+
+func TestDaemonTrigger(t *testing.T) {
+	sent := 0
+	var sendErr error
+	d := &daemon{
+		opts: &daemonOptions{secret: []byte(testDaemonSecret), cooldown: time.Hour, command: []string{"unlock"}},
+		send: func() error {
+			sent++
+			return sendErr
+		},
+		clock: clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)),
+	}
+	trigger := func(method, path, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if secret != "" {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := trigger(http.MethodPost, daemonTriggerPath, "wrong secret wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", w.Code)
+	}
+	if w := trigger(http.MethodGet, daemonTriggerPath, testDaemonSecret); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+	if w := trigger(http.MethodPost, "/", testDaemonSecret); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+	if sent != 0 {
+		t.Fatalf("Command sent by rejected trigger")
+	}
+
+	if w := trigger(http.MethodPost, daemonTriggerPath, testDaemonSecret); w.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", w.Code)
+	}
+	w := trigger(http.MethodPost, daemonTriggerPath, testDaemonSecret)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "3600" {
+		t.Errorf("Expected 429 during cooldown, got %d (Retry-After %q)", w.Code, w.Header().Get("Retry-After"))
+	}
+	if sent != 1 {
+		t.Errorf("Expected one command, got %d", sent)
+	}
+
+	d.opts.cooldown = 0
+	sendErr = errors.New("vehicle asleep")
+	if w := trigger(http.MethodPost, daemonTriggerPath, testDaemonSecret); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 for failed command, got %d", w.Code)
+	}
+}
+
+func TestDaemonIdleDisconnect(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	disconnected := make(chan struct{}, 2)
+	d := &daemon{
+		opts:       &daemonOptions{secret: []byte(testDaemonSecret), idleTimeout: time.Minute, command: []string{"unlock"}},
+		send:       func() error { return nil },
+		disconnect: func() { disconnected <- struct{}{} },
+		clock:      fakeClock,
+	}
+	defer d.stop()
+	trigger := func() {
+		req := httptest.NewRequest(http.MethodPost, daemonTriggerPath, nil)
+		req.Header.Set("Authorization", "Bearer "+testDaemonSecret)
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+	}
+
+	// Triggers within the idle window keep the connection open.
+	trigger()
+	for i := 0; i < 3; i++ {
+		fakeClock.Advance(40 * time.Second)
+		trigger()
+	}
+	select {
+	case <-disconnected:
+		t.Fatalf("Disconnected while in use")
+	default:
+	}
+
+	fakeClock.Advance(time.Minute)
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Didn't disconnect after idle timeout")
+	}
+	// The timer isn't rearmed until the next trigger, so the daemon can't disconnect again.
+	if n := fakeClock.Waiters(); n != 0 {
+		t.Errorf("Expected no pending idle timer after disconnecting, got %d", n)
+	}
+	trigger()
+	if n := fakeClock.Waiters(); n != 1 {
+		t.Errorf("Expected the next trigger to restart the idle timer, got %d timers", n)
+	}
+}
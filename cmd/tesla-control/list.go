@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+)
+
+// runListCommands prints tesla-control's commands, or with -json, the full command catalog shared
+// with the HTTP proxy's GET /api/1/commands endpoint.
+func runListCommands(_ string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("list-commands", flag.ContinueOnError)
+	asJSON := flags.Bool("json", jsonOutput, "Print the command catalog as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("usage: list-commands [-json]")
+	}
+	if *asJSON {
+		encoded, err := catalog.MarshalJSON("  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(encoded))
+		return nil
+	}
+
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		info := commands[name]
+		usage := name
+		if hint := info.argHint(); hint != "" {
+			usage += " " + hint
+		}
+		fmt.Fprintf(out, "%s\n    %s\n", usage, info.help)
+	}
+	return nil
+}
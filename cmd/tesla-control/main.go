@@ -12,13 +12,18 @@ import (
 	"time"
 
 	"github.com/google/shlex"
+	"google.golang.org/protobuf/proto"
 
+	"github.com/teslamotors/vehicle-command/internal/completion"
 	"github.com/teslamotors/vehicle-command/internal/log"
+	"github.com/teslamotors/vehicle-command/internal/units"
 	"github.com/teslamotors/vehicle-command/pkg/account"
 	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/connector/ble"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+	"github.com/teslamotors/vehicle-command/pkg/version"
 )
 
 func writeErr(format string, a ...interface{}) {
@@ -26,10 +31,63 @@ func writeErr(format string, a ...interface{}) {
 	fmt.Fprintf(os.Stderr, "\n")
 }
 
+// jsonOutput selects machine-readable output for commands that print protobuf messages.
+var jsonOutput bool
+
+// showTiming prints a breakdown of the time spent connecting and sending each command to stderr.
+var showTiming bool
+
+// withTiming returns ctx and a Timing that records time spent on operations that use ctx, or a nil
+// Timing if -timing isn't set.
+func withTiming(ctx context.Context) (context.Context, *vehicle.Timing) {
+	if !showTiming {
+		return ctx, nil
+	}
+	return vehicle.WithTiming(ctx)
+}
+
+// unitSystem is the unit system of temperature and speed arguments given without a unit.
+var unitSystem = units.DefaultSystem()
+
+// maxStateAge is the oldest vehicle state the state command prints without waking the vehicle to
+// refresh it. Zero accepts state of any age.
+var maxStateAge time.Duration
+
+// printJSON writes m to stdout as a single line of canonical protojson. Fields that aren't
+// recognized by this build are preserved rather than dropped; see protocol.MarshalJSON.
+func printJSON(m proto.Message) error {
+	encoded, err := protocol.MarshalJSON(m, "")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(encoded))
+	return nil
+}
+
 const usage = `
  * Commands sent to a vehicle over the internet require a VIN and a token.
  * Commands sent to a vehicle over BLE require a VIN.
- * Account-management commands require a token.`
+ * Account-management commands require a token.
+ * The encode and decode commands work offline. Run "encode [-format base64|hex|json] COMMAND [ARG...]"
+   to print the unsigned payload a command sends, or "decode MESSAGE" to print a base64 or hex
+   RoutableMessage.
+ * In the interactive shell (run without a COMMAND), "set [connect-timeout|command-timeout DURATION]"
+   shows or changes timeouts, and "reconnect" re-establishes the vehicle connection.
+ * Run "list-commands -json" to print a machine-readable catalog of commands and their parameters.
+ * Run "config-dump [-json]" to print the effective configuration, after applying flags, the
+   profile, and environment variables. Key and token files are shown; secrets are masked.
+ * Run "daemon [-listen ADDRESS|unix:PATH] [-secret-file FILE] [-cooldown DURATION] [-idle-timeout DURATION] COMMAND [ARG...]"
+   to keep the connection open and run COMMAND each time a local client POSTs to /trigger with
+   "Authorization: Bearer SECRET".
+ * Run "watch-charge [-interval DURATION] [-target-soc PERCENT]" to poll the charge state over one
+   connection and print SOC, current, voltage, and power whenever they change. Add -json for JSON
+   lines.
+ * Run "pair [-role ROLE] [-timeout DURATION]" over BLE to enroll your private key, wait for the
+   request to be approved on the touchscreen, and send a signed ping to confirm that pairing worked.
+ * Run "verify-pairing" to check that the vehicle recognizes your private key and accepts commands
+   signed with it. It prints each step it checks and suggests fixes for failures.
+ * Run "completion bash|zsh|fish" to print a shell completion script. For example, add
+   "source <(tesla-control completion bash)" to ~/.bashrc.`
 
 func Usage() {
 	fmt.Printf("Usage: %s [OPTION...] COMMAND [ARG...]\n", os.Args[0])
@@ -57,24 +115,117 @@ func Usage() {
 	}
 }
 
-func runCommand(acct *account.Account, car *vehicle.Vehicle, args []string, timeout time.Duration) int {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// runCommand executes args, sending the command again after failures that policy permits. With
+// -confirm, lock and unlock also wait for the vehicle to report the requested state.
+func runCommand(conn *connection, args []string, t *timeouts, policy retryPolicy, confirm confirmation) int {
+	for attempts := 1; ; attempts++ {
+		ctx, cancel := withDeadline("command", t.command)
+		ctx, timing := withTiming(ctx)
+		err := execute(ctx, conn.acct, conn.car, args)
+		explained := explainDeadline(ctx, err)
+		cancel()
+		if timing != nil {
+			writeErr("Command timing: %s", timing)
+		}
+		if errors.Is(err, errVehicleAsleep) {
+			return exitAsleep
+		}
+		if err == nil {
+			if want, ok := confirmedLockStates[args[0]]; ok && confirm.enabled {
+				if err := confirmLockState(conn.lockReader(), want, confirm.timeout, os.Stdout); err != nil {
+					writeErr("Command delivered, but %s", err)
+					return exitUnconfirmed
+				}
+			}
+			return 0
+		}
 
-	if err := execute(ctx, acct, car, args); err != nil {
+		if policy.shouldRetry(err, attempts) {
+			backoff := retryBackoff(attempts)
+			writeErr("Attempt %d failed: %s (retrying in %s)", attempts, explained, backoff)
+			time.Sleep(backoff)
+			if errors.Is(err, protocol.ErrNotConnected) && conn.car != nil {
+				conn.close()
+				if err := conn.open(t.connect); err != nil {
+					writeErr("Error reconnecting: %s", err)
+					return 1
+				}
+			}
+			continue
+		}
+
+		var sessionErr *vehicle.SessionError
 		if protocol.MayHaveSucceeded(err) {
-			writeErr("Couldn't verify success: %s", err)
-		} else if errors.Is(err, protocol.ErrNoSession) {
+			writeErr("Couldn't verify success: %s", explained)
+		} else if errors.Is(err, vehicle.ErrUnsupportedVehicle) {
+			writeErr("%s. Use -skip-capability-check to send the command anyway.", err)
+		} else if errors.Is(err, protocol.ErrNoSession) && !errors.As(err, &sessionErr) {
 			writeErr("You must provide a private key with -key-name or -key-file to execute this command")
 		} else {
-			writeErr("Failed to execute command: %s", err)
+			writeErr("Failed to execute command: %s", explained)
+		}
+		if policy.retries > 0 && attempts <= policy.retries && classifyFailure(err) == failureAmbiguous {
+			writeErr("Not retrying because the vehicle may have executed the command. Use -force-retry to retry anyway.")
 		}
 		return 1
 	}
-	return 0
 }
 
-func runInteractiveShell(acct *account.Account, car *vehicle.Vehicle, timeout time.Duration) int {
+// connection holds the account and vehicle that commands are sent to.
+type connection struct {
+	config *cli.Config
+	acct   *account.Account
+	car    *vehicle.Vehicle
+
+	skipCapabilityCheck bool // Send commands even if the vehicle lacks the hardware they require
+}
+
+func (c *connection) open(timeout time.Duration) error {
+	ctx, cancel := withDeadline("connect", timeout)
+	defer cancel()
+	ctx, timing := withTiming(ctx)
+
+	acct, car, err := c.config.Connect(ctx)
+	if timing != nil {
+		writeErr("Connection timing: %s", timing)
+	}
+	if err != nil {
+		return explainDeadline(ctx, err)
+	}
+	if car != nil {
+		car.SkipCapabilityCheck = c.skipCapabilityCheck
+	}
+	c.acct, c.car = acct, car
+	return nil
+}
+
+func (c *connection) close() {
+	if c.car != nil {
+		c.config.UpdateCachedSessions(c.car)
+		c.car.Disconnect()
+		c.car = nil
+	}
+}
+
+// openFrameLog returns a FrameTap that appends frames to filename, and a function that flushes
+// queued frames and closes the file.
+func openFrameLog(filename string) (*connector.FrameTap, func(), error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	writeErr("Warning: recording vehicle messages to %s. The file may contain sensitive data.", filename)
+	tap := connector.NewFrameTap(connector.WriteFrames(file))
+	return tap, func() {
+		tap.Close()
+		if dropped := tap.Dropped(); dropped > 0 {
+			writeErr("Frame log is missing %d messages", dropped)
+		}
+		file.Close()
+	}, nil
+}
+
+func runInteractiveShell(conn *connection, t *timeouts, policy retryPolicy, confirm confirmation) int {
 	scanner := bufio.NewScanner(os.Stdin)
 	for fmt.Printf("> "); scanner.Scan(); fmt.Printf("> ") {
 		args, err := shlex.Split(scanner.Text())
@@ -88,7 +239,21 @@ func runInteractiveShell(acct *account.Account, car *vehicle.Vehicle, timeout ti
 			writeErr("Invalid command: %s", err)
 			continue
 		}
-		runCommand(acct, car, args, timeout)
+		switch args[0] {
+		case "set":
+			if err := t.set(args[1:], os.Stdout); err != nil {
+				writeErr("%s", err)
+			}
+		case verifyPairingCommand:
+			verifyPairing(conn, t, conn.acct == nil, os.Stdout)
+		case "reconnect":
+			conn.close()
+			if err := conn.open(t.connect); err != nil {
+				writeErr("Error: %s", err)
+			}
+		default:
+			runCommand(conn, args, t, policy, confirm)
+		}
 	}
 	if err := scanner.Err(); err != nil {
 		writeErr("Error reading command: %s", err)
@@ -104,10 +269,18 @@ func main() {
 	}()
 
 	var (
-		debug          bool
-		forceBLE       bool
-		commandTimeout time.Duration
-		connTimeout    time.Duration
+		debug        bool
+		printVersion bool
+		forceBLE     bool
+		frameLog     string
+		noCaps       bool
+		t            timeouts
+		policy       retryPolicy
+		confirm      confirmation
+
+		daemonOpts *daemonOptions
+		watchOpts  *watchOptions
+		pairOpts   *pairOptions
 	)
 	config, err := cli.NewConfig(cli.FlagAll)
 	if err != nil {
@@ -116,12 +289,28 @@ func main() {
 	}
 	flag.Usage = Usage
 	flag.BoolVar(&debug, "debug", false, "Enable verbose debugging messages")
+	flag.BoolVar(&printVersion, "version", false, "Print version information and exit")
+	flag.BoolVar(&jsonOutput, "json", false, "Print vehicle state and session info as single-line protobuf JSON")
+	flag.BoolVar(&showTiming, "timing", false, "Print a breakdown of the time spent connecting and sending each command to stderr")
 	flag.BoolVar(&forceBLE, "ble", false, "Force BLE connection even if OAuth environment variables are defined")
-	flag.DurationVar(&commandTimeout, "command-timeout", 5*time.Second, "Set timeout for commands sent to the vehicle.")
-	flag.DurationVar(&connTimeout, "connect-timeout", 20*time.Second, "Set timeout for establishing initial connection.")
+	flag.DurationVar(&t.command, "command-timeout", defaultCommandTimeout, "Set timeout for each command sent to the vehicle, including waiting for its response.")
+	flag.IntVar(&policy.retries, "retries", 0, "Send a failed command up to `N` more times, with exponential backoff, if the vehicle can't have executed it")
+	flag.BoolVar(&policy.force, "force-retry", false, "With -retries, also retry failures where the vehicle may have executed the command. Unsafe for commands such as trunk-move.")
+	flag.DurationVar(&t.connect, "connect-timeout", defaultConnectTimeout, "Set timeout for finding the vehicle and establishing a secure connection.")
+	flag.BoolVar(&confirm.enabled, "confirm", false, fmt.Sprintf("After lock or unlock, poll the vehicle until it reports the requested state. Exits with status %d if it doesn't.", exitUnconfirmed))
+	flag.DurationVar(&confirm.timeout, "confirm-timeout", defaultConfirmTimeout, "How long -confirm waits for the vehicle to report the requested state")
+	flag.DurationVar(&maxStateAge, "max-age", 0, "If the state command's data is older than `DURATION`, wake the vehicle and read it again")
+	flag.Var(&unitSystem, "units", fmt.Sprintf("Interpret temperatures and speeds without a unit as `metric` or imperial. Defaults to $%s or the locale.", units.EnvSystem))
+	flag.BoolVar(&noCaps, "skip-capability-check", false, "Send commands such as tonneau-open even if Fleet API reports that the vehicle lacks the hardware they require")
+	flag.StringVar(&frameLog, "frame-log", "", "Append raw messages exchanged with the vehicle to `file`, for debugging protocol implementations. WARNING: the file may contain sensitive data.")
 
 	config.RegisterCommandLineFlags()
 	flag.Parse()
+	if printVersion {
+		version.Print()
+		status = 0
+		return
+	}
 	if !debug {
 		if debugEnv, ok := os.LookupEnv("TESLA_VERBOSE"); ok {
 			debug = debugEnv != "false" && debugEnv != "0"
@@ -130,7 +319,15 @@ func main() {
 	if debug {
 		log.SetLevel(log.LevelDebug)
 	}
+	log.ConfigureFromEnvironment()
+	if err := config.ReadFromProfile(); err != nil {
+		writeErr("%s", err)
+		return
+	}
 	config.ReadFromEnvironment()
+	if config.Transport == cli.TransportBLE {
+		forceBLE = true
+	}
 
 	args := flag.Args()
 	if len(args) > 0 {
@@ -148,7 +345,66 @@ func main() {
 			status = 0
 			return
 		}
-		if err := configureFlags(config, args[0], forceBLE); err != nil {
+		if completion.IsCompletionCommand(args[0]) {
+			if err := completionSpec(config).Run(args, os.Stdout); err != nil {
+				writeErr("%s", err)
+				return
+			}
+			status = 0
+			return
+		}
+		if args[0] == configDumpCommand {
+			if err := runConfigDump(config, args[1:], os.Stdout); err != nil {
+				writeErr("%s", err)
+				return
+			}
+			status = 0
+			return
+		}
+		if handler, ok := offlineCommands[args[0]]; ok {
+			if err := handler(config.VIN, args[1:], os.Stdout); err != nil {
+				writeErr("%s", err)
+				return
+			}
+			status = 0
+			return
+		}
+		commandName := args[0]
+		if commandName == daemonCommand {
+			if daemonOpts, err = parseDaemonArgs(args[1:]); err != nil {
+				writeErr("%s", err)
+				return
+			}
+			commandName = daemonOpts.command[0]
+		} else if commandName == watchChargeCommand {
+			if watchOpts, err = parseWatchArgs(args[1:]); err != nil {
+				writeErr("%s", err)
+				return
+			}
+			// Each poll is a "state charge" query.
+			commandName = "state"
+		} else if commandName == pairCommand {
+			if pairOpts, err = parsePairArgs(args[1:]); err != nil {
+				writeErr("%s", err)
+				return
+			}
+		}
+		if _, ok := confirmedLockStates[commandName]; confirm.enabled && !ok {
+			writeErr("%s", errConfirmUnsupported)
+			return
+		}
+		configure := configureFlags
+		if commandName == verifyPairingCommand {
+			configure = func(c *cli.Config, _ string, forceBLE bool) error {
+				return configurePairingFlags(c, forceBLE)
+			}
+		} else if commandName == pairCommand {
+			// Keys can only be enrolled over BLE.
+			configure = func(c *cli.Config, _ string, _ bool) error {
+				return configurePairingFlags(c, true)
+			}
+		}
+		if err := configure(config, commandName, forceBLE); err != nil {
 			writeErr("Missing required flag: %s", err)
 			return
 		}
@@ -159,27 +415,52 @@ func main() {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), connTimeout)
-	defer cancel()
+	if frameLog != "" {
+		tap, closeLog, err := openFrameLog(frameLog)
+		if err != nil {
+			writeErr("Error opening frame log: %s", err)
+			return
+		}
+		config.FrameTap = tap
+		defer closeLog()
+	}
 
-	acct, car, err := config.Connect(ctx)
-	if err != nil {
+	conn := &connection{config: config, skipCapabilityCheck: noCaps}
+	if flag.Arg(0) == verifyPairingCommand {
+		if verifyPairing(conn, &t, forceBLE, os.Stdout) {
+			status = 0
+		}
+		conn.close()
+		return
+	}
+	if pairOpts != nil {
+		if pairVehicle(conn, &t, pairOpts, os.Stdout) {
+			status = 0
+		}
+		conn.close()
+		return
+	}
+	if err := conn.open(t.connect); err != nil {
 		if ble.IsAdapterError(err) {
 			writeErr("%s", ble.AdapterErrorHelpMessage(err))
-		} else {
+			return
+		}
+		if daemonOpts == nil {
 			writeErr("Error: %s", err)
+			return
 		}
-		return
-	}
-
-	if car != nil {
-		defer car.Disconnect()
-		defer config.UpdateCachedSessions(car)
+		// The vehicle may be out of range when the daemon starts. It connects on the first trigger.
+		writeErr("Vehicle not connected yet: %s", err)
 	}
+	defer conn.close()
 
-	if flag.NArg() > 0 {
-		status = runCommand(acct, car, flag.Args(), commandTimeout)
+	if daemonOpts != nil {
+		status = runDaemon(conn, &t, confirm, daemonOpts)
+	} else if watchOpts != nil {
+		status = runWatchCharge(conn, &t, watchOpts)
+	} else if flag.NArg() > 0 {
+		status = runCommand(conn, flag.Args(), &t, policy, confirm)
 	} else {
-		status = runInteractiveShell(acct, car, commandTimeout)
+		status = runInteractiveShell(conn, &t, policy, confirm)
 	}
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdh"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+)
+
+// pairCommand enrolls the private key over BLE and then checks, step by step, that the vehicle
+// accepts commands signed with it. Running add-key-request alone only sends the request; pair
+// doesn't report success until a signed command has gone through.
+const pairCommand = "pair"
+
+const (
+	defaultPairTimeout = 2 * time.Minute
+	pairPollInterval   = 2 * time.Second
+)
+
+const pairUsage = "usage: pair [-role ROLE] [-timeout DURATION]"
+
+type pairOptions struct {
+	role    keys.Role
+	timeout time.Duration
+}
+
+// parsePairArgs parses the options that follow "pair" on the command line.
+func parsePairArgs(args []string) (*pairOptions, error) {
+	opts := &pairOptions{}
+	var roleName string
+	flags := flag.NewFlagSet(pairCommand, flag.ContinueOnError)
+	flags.StringVar(&roleName, "role", "owner", "Role of the new key: owner, driver, fm, vehicle_monitor, or charging_manager")
+	flags.DurationVar(&opts.timeout, "timeout", defaultPairTimeout, "How long to wait for the request to be approved in the vehicle")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, errors.New(pairUsage)
+	}
+	role, ok := keys.Role_value["ROLE_"+strings.ToUpper(roleName)]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized role %q", roleName)
+	}
+	opts.role = keys.Role(role)
+	if opts.timeout <= 0 {
+		return nil, errors.New("timeout must be positive")
+	}
+	return opts, nil
+}
+
+// keyLookup returns the vehicle's keychain entry for the client's key, or nil if the key isn't
+// enrolled.
+type keyLookup func(ctx context.Context) (*vcsec.WhitelistEntryInfo, error)
+
+// errApprovalTimeout means the add-key request wasn't approved in time.
+var errApprovalTimeout = errors.New("the vehicle didn't enroll the key")
+
+// waitForEnrollment polls lookup until the key appears on the vehicle's keychain or ctx expires.
+// Lookup errors are retried, since the vehicle may be busy while the user approves the request.
+func waitForEnrollment(ctx context.Context, lookup keyLookup, interval time.Duration) (*vcsec.WhitelistEntryInfo, error) {
+	for {
+		info, err := lookup(ctx)
+		if err == nil && info.GetPublicKey() != nil {
+			return info, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errApprovalTimeout
+		case <-time.After(interval):
+		}
+	}
+}
+
+func roleName(role keys.Role) string {
+	return strings.ToLower(strings.TrimPrefix(role.String(), "ROLE_"))
+}
+
+// pairVehicle runs the pairing flow, printing PASS or FAIL for each step. It returns true only if
+// the vehicle executed a command signed with the newly enrolled key.
+func pairVehicle(conn *connection, t *timeouts, opts *pairOptions, out io.Writer) bool {
+	fail := func(step string, err error, hint string) bool {
+		fmt.Fprintf(out, "FAIL  %s: %s\n", step, err)
+		if hint == "" {
+			hint = pairingHint(err, false)
+		}
+		if hint != "" {
+			fmt.Fprintf(out, "      %s\n", hint)
+		}
+		fmt.Fprintln(out, "Pairing did not complete.")
+		return false
+	}
+
+	skey, err := conn.config.PrivateKey()
+	if err == nil && skey == nil {
+		err = cli.ErrNoKeySpecified
+	}
+	if err != nil {
+		return fail("Load private key", err, "")
+	}
+	publicKey, err := ecdh.P256().NewPublicKey(skey.PublicBytes())
+	if err != nil {
+		return fail("Load private key", err, "The private key must be a NIST P-256 key. Use tesla-keygen to create one.")
+	}
+	fmt.Fprintf(out, "PASS  Load private key (public key %02x)\n", skey.PublicBytes())
+
+	// Connect without a handshake, which would fail until the key is enrolled.
+	ctx, cancel := withDeadline("connect", t.connect)
+	car, err := conn.config.ConnectLocal(ctx, skey)
+	if err == nil {
+		if err = car.Connect(ctx); err != nil {
+			car.Disconnect()
+		}
+	}
+	err = explainDeadline(ctx, err)
+	cancel()
+	if err != nil {
+		hint := ""
+		if errors.Is(err, context.DeadlineExceeded) {
+			hint = fmt.Sprintf("The vehicle wasn't found. Check that %s is the VIN of the vehicle next to you, move closer, and try again.", conn.config.VIN)
+		}
+		return fail("Connect over BLE", err, hint)
+	}
+	conn.car = car
+	fmt.Fprintln(out, "PASS  Connect over BLE")
+
+	lookup := func(ctx context.Context) (*vcsec.WhitelistEntryInfo, error) {
+		return car.KeyInfoByPublicKey(ctx, skey.PublicBytes())
+	}
+	ctx, cancel = withDeadline("command", t.command)
+	info, err := lookup(ctx)
+	err = explainDeadline(ctx, err)
+	cancel()
+	if err != nil {
+		return fail("Read vehicle keychain", err, "")
+	}
+
+	if info.GetPublicKey() != nil {
+		fmt.Fprintf(out, "PASS  Key is already enrolled with role %s\n", roleName(info.GetKeyRole()))
+	} else {
+		ctx, cancel = withDeadline("command", t.command)
+		err = car.SendAddKeyRequestWithRole(ctx, publicKey, opts.role, vcsec.KeyFormFactor_KEY_FORM_FACTOR_CLOUD_KEY)
+		err = explainDeadline(ctx, err)
+		cancel()
+		if err != nil {
+			return fail("Send add-key request", err, "")
+		}
+		fmt.Fprintln(out, "PASS  Send add-key request")
+		fmt.Fprintf(out, "      Tap a paired key card on the center console, then approve the request on the touchscreen. Waiting up to %s...\n", opts.timeout)
+
+		ctx, cancel = context.WithTimeout(context.Background(), opts.timeout)
+		info, err = waitForEnrollment(ctx, lookup, pairPollInterval)
+		cancel()
+		if err != nil {
+			return fail("Wait for approval", err, "Make sure you tapped a key card that's already paired with this vehicle and approved the request on the touchscreen before it expired, then run pair again.")
+		}
+		fmt.Fprintln(out, "PASS  Request approved")
+	}
+
+	if got := info.GetKeyRole(); got != opts.role {
+		err := fmt.Errorf("key is enrolled as %s, not %s", roleName(got), roleName(opts.role))
+		return fail("Check key role", err, "Remove the key in the vehicle's Locks screen and run pair again, or pass the enrolled role with -role.")
+	}
+	fmt.Fprintf(out, "PASS  Key role is %s\n", roleName(opts.role))
+
+	// Establish the VCSEC session first so that infotainment can be woken before its handshake.
+	ctx, cancel = withDeadline("connect", t.connect)
+	err = car.StartSession(ctx, []universal.Domain{protocol.DomainVCSEC})
+	err = explainDeadline(ctx, err)
+	cancel()
+	if err != nil {
+		return fail("Establish VCSEC session", err, "")
+	}
+	fmt.Fprintln(out, "PASS  Establish VCSEC session")
+
+	ctx, cancel = withDeadline("connect", t.connect)
+	err = car.Wakeup(ctx)
+	if err == nil {
+		err = car.StartSession(ctx, []universal.Domain{protocol.DomainInfotainment})
+	}
+	err = explainDeadline(ctx, err)
+	cancel()
+	if err != nil {
+		hint := ""
+		if errors.Is(err, context.DeadlineExceeded) {
+			hint = "Infotainment didn't respond after being woken. Vehicles running very old firmware don't support this protocol; check for a software update, then try again."
+		}
+		return fail("Establish infotainment session", err, hint)
+	}
+	fmt.Fprintln(out, "PASS  Establish infotainment session")
+
+	ctx, cancel = withDeadline("command", t.command)
+	err = explainDeadline(ctx, car.Ping(ctx))
+	cancel()
+	if err != nil {
+		return fail("Send signed ping", err, "")
+	}
+	fmt.Fprintln(out, "PASS  Send signed ping")
+	fmt.Fprintf(out, "Pairing complete. tesla-control can now send commands to %s.\n", car.VIN())
+	return true
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+)
+
+func TestParsePairArgs(t *testing.T) {
+	opts, err := parsePairArgs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.role != keys.Role_ROLE_OWNER || opts.timeout != defaultPairTimeout {
+		t.Errorf("Unexpected defaults: %+v", opts)
+	}
+
+	opts, err = parsePairArgs([]string{"-role", "driver", "-timeout", "30s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.role != keys.Role_ROLE_DRIVER || opts.timeout != 30*time.Second {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+
+	for _, args := range [][]string{
+		{"-role", "admin"},
+		{"-timeout", "0s"},
+		{"extra"},
+	} {
+		if _, err := parsePairArgs(args); err == nil {
+			t.Errorf("Expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestWaitForEnrollment(t *testing.T) {
+	calls := 0
+	lookup := func(ctx context.Context) (*vcsec.WhitelistEntryInfo, error) {
+		calls++
+		switch calls {
+		case 1:
+			return &vcsec.WhitelistEntryInfo{}, nil
+		case 2:
+			return nil, protocol.ErrBusy
+		}
+		return &vcsec.WhitelistEntryInfo{
+			PublicKey: &vcsec.PublicKey{PublicKeyRaw: []byte{4}},
+			KeyRole:   keys.Role_ROLE_OWNER,
+		}, nil
+	}
+	info, err := waitForEnrollment(context.Background(), lookup, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || info.GetKeyRole() != keys.Role_ROLE_OWNER {
+		t.Errorf("Unexpected result after %d lookups: %v", calls, info)
+	}
+}
+
+func TestWaitForEnrollmentTimeout(t *testing.T) {
+	lookup := func(ctx context.Context) (*vcsec.WhitelistEntryInfo, error) {
+		return &vcsec.WhitelistEntryInfo{}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := waitForEnrollment(ctx, lookup, time.Millisecond); !errors.Is(err, errApprovalTimeout) {
+		t.Errorf("Expected errApprovalTimeout, got %v", err)
+	}
+}
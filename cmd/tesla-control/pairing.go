@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"github.com/teslamotors/vehicle-command/pkg/connector/ble"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// verifyPairingCommand checks everything needed to send a command to a vehicle and explains the
+// first step that fails. Unlike other commands, it connects to the vehicle itself so that it can
+// report connection failures as one of its steps.
+const verifyPairingCommand = "verify-pairing"
+
+// configurePairingFlags is the verify-pairing counterpart of configureFlags. Checking the key
+// requires both domains: VCSEC reports the key's role and infotainment answers the ping.
+func configurePairingFlags(c *cli.Config, forceBLE bool) error {
+	c.Flags = cli.FlagBLE | cli.FlagVIN | cli.FlagPrivateKey
+	if !forceBLE {
+		c.Flags |= cli.FlagOAuth
+	}
+	c.Domains = nil
+	if c.VIN == "" {
+		return ErrRequiresVIN
+	}
+	if c.KeyringKeyName == "" && c.KeyFilename == "" {
+		return ErrRequiresPrivateKey
+	}
+	return nil
+}
+
+// pairingHint suggests how to fix a failed verify-pairing step.
+func pairingHint(err error, overInternet bool) string {
+	switch {
+	case errors.Is(err, protocol.ErrKeyNotPaired):
+		if overInternet {
+			return "The vehicle doesn't recognize this key. Open https://tesla.com/_ak/<your domain> on a phone with the Tesla app to pair it, then try again."
+		}
+		return "The vehicle doesn't recognize this key. Run add-key-request over BLE, tap a key card on the center console, and approve the request on the touchscreen."
+	case errors.Is(err, cli.ErrNoKeySpecified), errors.Is(err, cli.ErrKeyNotFound):
+		return "Pass the key that was paired with -key-file or -key-name. Use tesla-keygen to create one."
+	case errors.Is(err, protocol.ErrNoSession), errors.Is(err, protocol.ErrRequiresKey):
+		return "The private key couldn't be loaded. Check -key-file or -key-name."
+	case ble.IsAdapterError(err):
+		return ble.AdapterErrorHelpMessage(err)
+	case errors.Is(err, context.DeadlineExceeded):
+		if overInternet {
+			return "The vehicle didn't respond. Make sure it has a cellular or Wi-Fi connection and run \"wake\" before trying again."
+		}
+		return "The vehicle didn't respond. Move closer to it, make sure it isn't connected to too many BLE devices, and try again."
+	case errors.Is(err, protocol.ErrBusy):
+		return "The vehicle is busy or still waking up. Try again in a few seconds."
+	}
+	return ""
+}
+
+// verifyPairing connects to the vehicle (unless conn is already open), confirms that the private
+// key is enrolled, and sends a ping, printing PASS or FAIL for each step. It returns false if any
+// step fails.
+func verifyPairing(conn *connection, t *timeouts, forceBLE bool, out io.Writer) bool {
+	overInternet := !forceBLE && (conn.config.TokenFilename != "" || conn.config.KeyringTokenName != "")
+	fail := func(step string, err error) bool {
+		fmt.Fprintf(out, "FAIL  %s: %s\n", step, err)
+		if hint := pairingHint(err, overInternet); hint != "" {
+			fmt.Fprintf(out, "      %s\n", hint)
+		}
+		fmt.Fprintln(out, "Pairing could not be verified.")
+		return false
+	}
+
+	skey, err := conn.config.PrivateKey()
+	if err == nil && skey == nil {
+		err = cli.ErrNoKeySpecified
+	}
+	if err != nil {
+		return fail("Load private key", err)
+	}
+	fmt.Fprintf(out, "PASS  Load private key (public key %02x)\n", skey.PublicBytes())
+
+	transport := "BLE"
+	if overInternet {
+		transport = "the Internet"
+	}
+	if conn.car == nil {
+		if err := conn.open(t.connect); err != nil {
+			return fail("Connect over "+transport, err)
+		}
+	}
+	fmt.Fprintf(out, "PASS  Connect over %s and establish sessions\n", transport)
+
+	ctx, cancel := withDeadline("command", t.command)
+	info, err := conn.car.KeyInfoByPublicKey(ctx, skey.PublicBytes())
+	err = explainDeadline(ctx, err)
+	cancel()
+	if err != nil {
+		return fail("Look up key on vehicle", err)
+	}
+	if info == nil {
+		return fail("Look up key on vehicle", protocol.ErrKeyNotPaired)
+	}
+	fmt.Fprintf(out, "PASS  Key is enrolled with role %s\n", info.GetKeyRole())
+
+	ctx, cancel = withDeadline("command", t.command)
+	err = explainDeadline(ctx, conn.car.Ping(ctx))
+	cancel()
+	if err != nil {
+		return fail("Send signed ping", err)
+	}
+	fmt.Fprintln(out, "PASS  Send signed ping")
+	fmt.Fprintln(out, "Pairing verified.")
+	return true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+func TestPairingHint(t *testing.T) {
+	tests := []struct {
+		err          error
+		overInternet bool
+		contains     string
+	}{
+		{protocol.ErrKeyNotPaired, true, "tesla.com/_ak"},
+		{protocol.ErrKeyNotPaired, false, "add-key-request"},
+		{fmt.Errorf("connect: %w", context.DeadlineExceeded), true, "wake"},
+		{fmt.Errorf("connect: %w", context.DeadlineExceeded), false, "Move closer"},
+		{cli.ErrNoKeySpecified, false, "tesla-keygen"},
+		{protocol.ErrBusy, false, "busy"},
+	}
+	for _, test := range tests {
+		if hint := pairingHint(test.err, test.overInternet); !strings.Contains(hint, test.contains) {
+			t.Errorf("Expected hint for %v to contain %q, got %q", test.err, test.contains, hint)
+		}
+	}
+	if hint := pairingHint(ErrCommandLineArgs, false); hint != "" {
+		t.Errorf("Expected no hint, got %q", hint)
+	}
+}
+
+func TestConfigurePairingFlags(t *testing.T) {
+	config, err := cli.NewConfig(cli.FlagAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Domains = cli.DomainList{protocol.DomainVCSEC}
+	if err := configurePairingFlags(config, true); err != ErrRequiresVIN {
+		t.Errorf("Expected ErrRequiresVIN, got %v", err)
+	}
+	config.VIN = "5YJ3E1EA7KF000001"
+	if err := configurePairingFlags(config, true); err != ErrRequiresPrivateKey {
+		t.Errorf("Expected ErrRequiresPrivateKey, got %v", err)
+	}
+	config.KeyFilename = "private.pem"
+	if err := configurePairingFlags(config, true); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if config.Domains != nil {
+		t.Errorf("Expected all domains, got %v", config.Domains)
+	}
+}
+
+func TestVerifyPairingReportsMissingKey(t *testing.T) {
+	config, err := cli.NewConfig(cli.FlagBLE | cli.FlagVIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if verifyPairing(&connection{config: config}, &timeouts{}, true, &out) {
+		t.Fatal("Expected verification to fail")
+	}
+	if !strings.HasPrefix(out.String(), "FAIL  Load private key") || !strings.Contains(out.String(), "tesla-keygen") {
+		t.Errorf("Unexpected output: %s", out.String())
+	}
+}
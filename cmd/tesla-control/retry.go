@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+const (
+	initialRetryBackoff = time.Second
+	maxRetryBackoff     = 30 * time.Second
+)
+
+// failureClass describes whether a failed command can be sent again.
+type failureClass int
+
+const (
+	// failurePermanent commands weren't executed, and sending them again won't help. For example,
+	// the vehicle rejected the command or its arguments were invalid.
+	failurePermanent failureClass = iota
+	// failureRetryable commands weren't executed, but might succeed if sent again. For example, the
+	// vehicle was busy or the command couldn't be transmitted.
+	failureRetryable
+	// failureAmbiguous commands may have been executed. Sending them again is only safe if the
+	// command is idempotent: re-sending a trunk command, for example, might close a trunk that the
+	// first attempt opened.
+	failureAmbiguous
+)
+
+// classifyFailure determines whether err, returned by execute, is safe to retry. It relies on the
+// protocol.Error classification attached to errors by the vehicle and connector packages. Errors
+// without that classification are considered ambiguous.
+func classifyFailure(err error) failureClass {
+	var commandErr protocol.Error
+	switch {
+	case errors.Is(err, ErrCommandLineArgs), errors.Is(err, ErrUnknownCommand), protocol.IsNominalError(err):
+		return failurePermanent
+	case !errors.As(err, &commandErr), commandErr.MayHaveSucceeded():
+		return failureAmbiguous
+	case commandErr.Temporary(), errors.Is(err, protocol.ErrNotConnected):
+		return failureRetryable
+	}
+	return failurePermanent
+}
+
+// retryPolicy controls whether runCommand sends a command again after it fails.
+type retryPolicy struct {
+	retries int  // Maximum number of additional attempts
+	force   bool // Retry ambiguous failures
+}
+
+// shouldRetry returns true if a command that has failed attempts times, most recently with err,
+// should be sent again.
+func (r *retryPolicy) shouldRetry(err error, attempts int) bool {
+	if attempts > r.retries {
+		return false
+	}
+	switch classifyFailure(err) {
+	case failureRetryable:
+		return true
+	case failureAmbiguous:
+		return r.force
+	}
+	return false
+}
+
+// retryBackoff returns how long to wait before the attempt following attempts failures.
+func retryBackoff(attempts int) time.Duration {
+	backoff := initialRetryBackoff
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		err   error
+		class failureClass
+	}{
+		{ErrCommandLineArgs, failurePermanent},
+		{&protocol.NominalError{Details: protocol.NewError("car could not execute command: closed", false, false)}, failurePermanent},
+		{protocol.ErrKeyNotPaired, failurePermanent},
+		{protocol.ErrBusy, failureRetryable},
+		{&protocol.RoutableMessageError{Code: universal.MessageFault_E_MESSAGEFAULT_ERROR_BUSY}, failureRetryable},
+		{&protocol.RoutableMessageError{Code: universal.MessageFault_E_MESSAGEFAULT_ERROR_UNKNOWN_KEY_ID}, failurePermanent},
+		{protocol.ErrNotConnected, failureRetryable},
+		{fmt.Errorf("%w: write failed", protocol.ErrNotConnected), failureRetryable},
+		{&protocol.CommandError{Err: context.DeadlineExceeded, PossibleSuccess: false, PossibleTemporary: true}, failureRetryable},
+		{&protocol.CommandError{Err: context.DeadlineExceeded, PossibleSuccess: true, PossibleTemporary: true}, failureAmbiguous},
+		{&deadlineError{phase: "command", timeout: time.Second, err: protocol.ErrBusy}, failureRetryable},
+		{context.DeadlineExceeded, failureAmbiguous},
+		{errors.New("connection reset"), failureAmbiguous},
+	}
+	for _, test := range tests {
+		if class := classifyFailure(test.err); class != test.class {
+			t.Errorf("%s: expected class %d but got %d", test.err, test.class, class)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := retryPolicy{retries: 2}
+	if !policy.shouldRetry(protocol.ErrBusy, 1) || !policy.shouldRetry(protocol.ErrBusy, 2) {
+		t.Errorf("Expected retries for busy vehicle")
+	}
+	if policy.shouldRetry(protocol.ErrBusy, 3) {
+		t.Errorf("Retried too many times")
+	}
+	ambiguous := errors.New("connection reset")
+	if policy.shouldRetry(ambiguous, 1) {
+		t.Errorf("Retried ambiguous failure without -force-retry")
+	}
+	policy.force = true
+	if !policy.shouldRetry(ambiguous, 1) {
+		t.Errorf("Expected -force-retry to retry ambiguous failure")
+	}
+	if policy.shouldRetry(protocol.ErrKeyNotPaired, 1) {
+		t.Errorf("Retried permanent failure")
+	}
+	if (&retryPolicy{}).shouldRetry(protocol.ErrBusy, 1) {
+		t.Errorf("Retried without -retries")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second}
+	for i, backoff := range expected {
+		if actual := retryBackoff(i + 1); actual != backoff {
+			t.Errorf("Attempt %d: expected %s but got %s", i+1, backoff, actual)
+		}
+	}
+}
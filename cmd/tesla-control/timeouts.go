@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	defaultCommandTimeout = 5 * time.Second
+	defaultConnectTimeout = 20 * time.Second
+)
+
+// timeouts bounds the two phases of talking to a vehicle: finding it and establishing sessions,
+// and then sending each command and waiting for its response. Both can be changed from the
+// interactive shell with "set".
+type timeouts struct {
+	connect time.Duration
+	command time.Duration
+}
+
+// deadlineError reports which timeout expired. The phase is "connect" or "command", matching the
+// -connect-timeout and -command-timeout flags.
+type deadlineError struct {
+	phase   string
+	timeout time.Duration
+	err     error
+}
+
+func (e *deadlineError) Error() string {
+	return fmt.Sprintf("%s timeout of %s exceeded (see -%s-timeout): %s", e.phase, e.timeout, e.phase, e.err)
+}
+
+func (e *deadlineError) Unwrap() error {
+	return e.err
+}
+
+// withDeadline returns a context that expires after the phase's timeout.
+func withDeadline(phase string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	cause := &deadlineError{phase: phase, timeout: timeout, err: context.DeadlineExceeded}
+	return context.WithTimeoutCause(context.Background(), timeout, cause)
+}
+
+// explainDeadline converts err into a deadlineError if ctx, which should have been created by
+// withDeadline, expired. Errors caused by the deadline aren't always wrapped versions of
+// context.DeadlineExceeded (for example, some transports return their own timeout errors), so
+// this checks ctx instead of err.
+func explainDeadline(ctx context.Context, err error) error {
+	if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	var cause *deadlineError
+	if !errors.As(context.Cause(ctx), &cause) || errors.As(err, new(*deadlineError)) {
+		return err
+	}
+	return &deadlineError{phase: cause.phase, timeout: cause.timeout, err: err}
+}
+
+// set implements the interactive shell's "set" command. With no arguments, it prints the current
+// values.
+func (t *timeouts) set(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprintf(out, "connect-timeout %s\ncommand-timeout %s\n", t.connect, t.command)
+		return nil
+	}
+	if len(args) != 2 {
+		return errors.New("usage: set [connect-timeout|command-timeout DURATION]")
+	}
+	timeout, err := time.ParseDuration(args[1])
+	if err != nil || timeout <= 0 {
+		return fmt.Errorf("invalid duration '%s' (expected a positive value such as 30s)", args[1])
+	}
+	switch args[0] {
+	case "connect-timeout":
+		t.connect = timeout
+	case "command-timeout":
+		t.command = timeout
+	default:
+		return fmt.Errorf("unrecognized setting '%s' (expected connect-timeout or command-timeout)", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainDeadline(t *testing.T) {
+	ctx, cancel := withDeadline("connect", time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	transportErr := errors.New("i/o timeout")
+	err := explainDeadline(ctx, transportErr)
+	if !errors.Is(err, transportErr) {
+		t.Errorf("Expected explained error to wrap original error")
+	}
+	if !strings.Contains(err.Error(), "connect timeout of 1ns exceeded") {
+		t.Errorf("Error doesn't identify deadline: %s", err)
+	}
+	if twice := explainDeadline(ctx, err); twice.Error() != err.Error() {
+		t.Errorf("Error explained twice: %s", twice)
+	}
+
+	ctx, cancel = withDeadline("command", time.Hour)
+	defer cancel()
+	if err := explainDeadline(ctx, transportErr); err != transportErr {
+		t.Errorf("Error modified before deadline: %s", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := explainDeadline(canceled, transportErr); err != transportErr {
+		t.Errorf("Error modified after cancellation: %s", err)
+	}
+}
+
+func TestSetTimeouts(t *testing.T) {
+	timeouts := timeouts{connect: defaultConnectTimeout, command: defaultCommandTimeout}
+	var out bytes.Buffer
+	if err := timeouts.set(nil, &out); err != nil || out.String() != "connect-timeout 20s\ncommand-timeout 5s\n" {
+		t.Errorf("Unexpected output %q (%v)", out.String(), err)
+	}
+	if err := timeouts.set([]string{"command-timeout", "30s"}, &out); err != nil || timeouts.command != 30*time.Second {
+		t.Errorf("Failed to set command-timeout: %v", err)
+	}
+	if err := timeouts.set([]string{"connect-timeout", "1m"}, &out); err != nil || timeouts.connect != time.Minute {
+		t.Errorf("Failed to set connect-timeout: %v", err)
+	}
+	for _, args := range [][]string{{"command-timeout"}, {"command-timeout", "soon"}, {"command-timeout", "-1s"}, {"timeout", "1s"}} {
+		if err := timeouts.set(args, &out); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
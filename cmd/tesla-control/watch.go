@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// watchChargeCommand polls the vehicle's charge state over the open connection and prints a line
+// each time a reading changes. It reuses the connection and sessions for every poll, so it's much
+// cheaper than running "state charge" in a loop.
+const watchChargeCommand = "watch-charge"
+
+const (
+	defaultWatchInterval = 10 * time.Second
+	minWatchInterval     = time.Second
+)
+
+const watchChargeUsage = "usage: watch-charge [-interval DURATION] [-target-soc PERCENT]"
+
+type watchOptions struct {
+	interval  time.Duration
+	targetSOC int
+}
+
+// parseWatchArgs parses the options that follow "watch-charge" on the command line.
+func parseWatchArgs(args []string) (*watchOptions, error) {
+	opts := &watchOptions{}
+	flags := flag.NewFlagSet(watchChargeCommand, flag.ContinueOnError)
+	flags.DurationVar(&opts.interval, "interval", defaultWatchInterval, "Time between charge state queries")
+	flags.IntVar(&opts.targetSOC, "target-soc", 0, "Exit once the battery reaches `PERCENT`. Zero watches until interrupted.")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, errors.New(watchChargeUsage)
+	}
+	if opts.interval < minWatchInterval {
+		return nil, fmt.Errorf("interval must be at least %s", minWatchInterval)
+	}
+	if opts.targetSOC < 0 || opts.targetSOC > 100 {
+		return nil, errors.New("target SOC must be between 0 and 100")
+	}
+	return opts, nil
+}
+
+// chargeReading holds the fields of a charge state that watch-charge reports.
+type chargeReading struct {
+	Time          time.Time `json:"time"`
+	BatteryLevel  int32     `json:"battery_level"`
+	ChargerAmps   int32     `json:"charger_actual_current"`
+	ChargerVolts  int32     `json:"charger_voltage"`
+	ChargerPower  int32     `json:"charger_power"`
+	ChargingState string    `json:"charging_state"`
+}
+
+func newChargeReading(now time.Time, state *carserver.ChargeState) *chargeReading {
+	reading := &chargeReading{
+		Time:          now,
+		BatteryLevel:  state.GetBatteryLevel(),
+		ChargerAmps:   state.GetChargerActualCurrent(),
+		ChargerVolts:  state.GetChargerVoltage(),
+		ChargerPower:  state.GetChargerPower(),
+		ChargingState: "Unknown",
+	}
+	if cs := state.GetChargingState(); cs != nil {
+		m := cs.ProtoReflect()
+		if field := m.WhichOneof(m.Descriptor().Oneofs().ByName("type")); field != nil {
+			reading.ChargingState = string(field.Name())
+		}
+	}
+	return reading
+}
+
+// sameValues returns true if r and other differ only by time.
+func (r *chargeReading) sameValues(other *chargeReading) bool {
+	if other == nil {
+		return false
+	}
+	a, b := *r, *other
+	a.Time, b.Time = time.Time{}, time.Time{}
+	return a == b
+}
+
+// chargePrinter writes readings that differ from the previous one, either as rows of a table or
+// as JSON lines.
+type chargePrinter struct {
+	out      io.Writer
+	json     bool
+	previous *chargeReading
+}
+
+func signedDelta(now, before int32) string {
+	if before == now {
+		return ""
+	}
+	return fmt.Sprintf(" (%+d)", now-before)
+}
+
+func (p *chargePrinter) print(r *chargeReading) error {
+	if r.sameValues(p.previous) {
+		return nil
+	}
+	defer func() { p.previous = r }()
+	if p.json {
+		encoded, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(p.out, string(encoded))
+		return err
+	}
+	if p.previous == nil {
+		fmt.Fprintf(p.out, "%-8s  %-9s  %-9s  %-9s  %-8s  %s\n", "TIME", "SOC %", "AMPS", "VOLTS", "KW", "STATE")
+	}
+	before := p.previous
+	if before == nil {
+		before = r
+	}
+	_, err := fmt.Fprintf(p.out, "%-8s  %-9s  %-9s  %-9s  %-8s  %s\n",
+		r.Time.Format(time.TimeOnly),
+		fmt.Sprintf("%d%s", r.BatteryLevel, signedDelta(r.BatteryLevel, before.BatteryLevel)),
+		fmt.Sprintf("%d%s", r.ChargerAmps, signedDelta(r.ChargerAmps, before.ChargerAmps)),
+		fmt.Sprintf("%d%s", r.ChargerVolts, signedDelta(r.ChargerVolts, before.ChargerVolts)),
+		fmt.Sprintf("%d%s", r.ChargerPower, signedDelta(r.ChargerPower, before.ChargerPower)),
+		r.ChargingState)
+	return err
+}
+
+// chargeStateReader returns the vehicle's current charge state.
+type chargeStateReader func(ctx context.Context) (*carserver.ChargeState, error)
+
+func (c *connection) chargeStateReader() chargeStateReader {
+	return func(ctx context.Context) (*carserver.ChargeState, error) {
+		data, err := c.car.GetState(ctx, vehicle.StateCategoryCharge)
+		if err != nil {
+			return nil, err
+		}
+		return data.GetChargeState(), nil
+	}
+}
+
+// watchCharge polls read every opts.interval until the battery reaches opts.targetSOC or ctx is
+// canceled. Failed polls are reported and retried on the next interval.
+func watchCharge(ctx context.Context, read chargeStateReader, t *timeouts, opts *watchOptions, p *chargePrinter) error {
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+	for {
+		pollCtx, cancel := context.WithTimeout(ctx, t.command)
+		state, err := read(pollCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			writeErr("Couldn't read charge state: %s", err)
+		} else {
+			reading := newChargeReading(time.Now(), state)
+			if err := p.print(reading); err != nil {
+				return err
+			}
+			if opts.targetSOC > 0 && int(reading.BatteryLevel) >= opts.targetSOC {
+				fmt.Fprintf(os.Stderr, "Reached target SOC of %d%%\n", opts.targetSOC)
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runWatchCharge watches the charge state until the target SOC is reached or the user interrupts.
+func runWatchCharge(conn *connection, t *timeouts, opts *watchOptions) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	p := &chargePrinter{out: os.Stdout, json: jsonOutput}
+	if err := watchCharge(ctx, conn.chargeStateReader(), t, opts, p); err != nil {
+		writeErr("Error: %s", err)
+		return 1
+	}
+	return 0
+}
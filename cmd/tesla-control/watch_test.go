@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+func TestParseWatchArgs(t *testing.T) {
+	opts, err := parseWatchArgs([]string{"-interval", "2s", "-target-soc", "80"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.interval != 2*time.Second || opts.targetSOC != 80 {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+	invalid := [][]string{
+		{"-interval", "10ms"},
+		{"-target-soc", "101"},
+		{"extra"},
+	}
+	for _, args := range invalid {
+		if _, err := parseWatchArgs(args); err == nil {
+			t.Errorf("Expected error for %v", args)
+		}
+	}
+}
+
+func testChargeState(soc, amps int32, charging bool) *carserver.ChargeState {
+	state := &carserver.ChargeState{
+		OptionalBatteryLevel:         &carserver.ChargeState_BatteryLevel{BatteryLevel: soc},
+		OptionalChargerActualCurrent: &carserver.ChargeState_ChargerActualCurrent{ChargerActualCurrent: amps},
+		OptionalChargerVoltage:       &carserver.ChargeState_ChargerVoltage{ChargerVoltage: 240},
+		OptionalChargerPower:         &carserver.ChargeState_ChargerPower{ChargerPower: amps * 240 / 1000},
+	}
+	if charging {
+		state.ChargingState = &carserver.ChargeState_ChargingState{
+			Type: &carserver.ChargeState_ChargingState_Charging{Charging: &carserver.Void{}},
+		}
+	}
+	return state
+}
+
+func TestWatchChargePrintsChanges(t *testing.T) {
+	states := []*carserver.ChargeState{
+		testChargeState(78, 32, true),
+		testChargeState(78, 32, true),
+		nil,
+		testChargeState(79, 24, true),
+		testChargeState(80, 24, true),
+		testChargeState(81, 24, true),
+	}
+	polls := 0
+	read := func(context.Context) (*carserver.ChargeState, error) {
+		state := states[polls]
+		polls++
+		if state == nil {
+			return nil, errors.New("vehicle busy")
+		}
+		return state, nil
+	}
+	var out bytes.Buffer
+	opts := &watchOptions{interval: time.Millisecond, targetSOC: 80}
+	if err := watchCharge(context.Background(), read, &timeouts{command: time.Second}, opts, &chargePrinter{out: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if polls != 5 {
+		t.Errorf("Expected watch to stop at target SOC after 5 polls, got %d", polls)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected a header and three rows, got:\n%s", out.String())
+	}
+	if fields := strings.Fields(lines[2]); fields[1] != "79" || fields[2] != "(+1)" || fields[3] != "24" || fields[4] != "(-8)" || fields[len(fields)-1] != "Charging" {
+		t.Errorf("Unexpected row: %q", lines[2])
+	}
+}
+
+func TestWatchChargeJSON(t *testing.T) {
+	var out bytes.Buffer
+	p := &chargePrinter{out: &out, json: true}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := p.print(newChargeReading(now, testChargeState(50, 0, false))); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"time":"2024-01-01T12:00:00Z","battery_level":50,"charger_actual_current":0,"charger_voltage":240,"charger_power":0,"charging_state":"Unknown"}`
+	if got := strings.TrimSpace(out.String()); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
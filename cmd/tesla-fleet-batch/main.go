@@ -0,0 +1,198 @@
+// Tesla-fleet-batch sends the same command to many vehicles using the fleet package.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/log"
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"github.com/teslamotors/vehicle-command/pkg/fleet"
+	"github.com/teslamotors/vehicle-command/pkg/version"
+)
+
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "usage: %s [OPTION...] -vins VIN[,VIN...] COMMAND ARG\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Sends COMMAND to each vehicle through Fleet API and prints the result for each one.")
+	fmt.Fprintln(w, "Exits with a nonzero status if any vehicle fails.")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Commands:")
+	fmt.Fprintln(w, "  charge-limit PERCENT   Set the charge limit")
+	fmt.Fprintln(w, "  precondition on|off    Turn climate control on or off")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Options:")
+	flag.PrintDefaults()
+}
+
+// readVINs returns the VINs in vinList, a comma-separated list, and in the file named filename,
+// which has one VIN per line. A filename of "-" reads from stdin.
+func readVINs(vinList, filename string) ([]string, error) {
+	var vins []string
+	for _, vin := range strings.Split(vinList, ",") {
+		if vin = strings.TrimSpace(vin); vin != "" {
+			vins = append(vins, vin)
+		}
+	}
+	if filename == "" {
+		return vins, nil
+	}
+	var r io.Reader = os.Stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if vin := strings.TrimSpace(scanner.Text()); vin != "" && !strings.HasPrefix(vin, "#") {
+			vins = append(vins, vin)
+		}
+	}
+	return vins, scanner.Err()
+}
+
+// parseCommand returns the fleet.Func for the command in args.
+func parseCommand(args []string) (fleet.Func, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected a command and one argument")
+	}
+	switch args[0] {
+	case "charge-limit":
+		percent, err := strconv.Atoi(args[1])
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("invalid charge limit %q", args[1])
+		}
+		return fleet.SetChargeLimit(int32(percent)), nil
+	case "precondition":
+		switch args[1] {
+		case "on":
+			return fleet.Precondition(true), nil
+		case "off":
+			return fleet.Precondition(false), nil
+		}
+		return nil, fmt.Errorf("precondition expects on or off, not %q", args[1])
+	}
+	return nil, fmt.Errorf("unrecognized command %q", args[0])
+}
+
+func main() {
+	status := 1
+	defer func() {
+		os.Exit(status)
+	}()
+
+	var (
+		vinList      string
+		vinFile      string
+		debug        bool
+		printVersion bool
+		deadline     time.Duration
+		opts         fleet.Options
+	)
+	config, err := cli.NewConfig(cli.FlagOAuth | cli.FlagPrivateKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load credential configuration: %s\n", err)
+		return
+	}
+	flag.Usage = usage
+	flag.StringVar(&vinList, "vins", "", "Comma-separated `VIN`s or Fleet API vehicle IDs")
+	flag.StringVar(&vinFile, "vin-file", "", "Read VINs from `file`, one per line (- for stdin)")
+	flag.BoolVar(&debug, "debug", false, "Enable verbose debugging messages")
+	flag.BoolVar(&printVersion, "version", false, "Print version information and exit")
+	flag.IntVar(&opts.Concurrency, "concurrency", fleet.DefaultConcurrency, "Maximum number of vehicles to contact at once")
+	flag.IntVar(&opts.MaxAttempts, "attempts", 3, "Maximum attempts per vehicle; commands are only retried if the vehicle can't have executed them")
+	flag.DurationVar(&opts.RetryInterval, "retry-interval", fleet.DefaultRetryInterval, "Delay between attempts")
+	flag.DurationVar(&opts.Timeout, "vehicle-timeout", time.Minute, "Time limit for each vehicle, including retries")
+	flag.DurationVar(&deadline, "timeout", 0, "Time limit for the whole batch (0 disables)")
+	config.RegisterCommandLineFlags()
+	flag.Parse()
+	if printVersion {
+		version.Print()
+		status = 0
+		return
+	}
+	if debug {
+		log.SetLevel(log.LevelDebug)
+	}
+	log.ConfigureFromEnvironment()
+	if err := config.ReadFromProfile(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+	config.ReadFromEnvironment()
+
+	fn, err := parseCommand(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n\n", err)
+		usage()
+		return
+	}
+	vins, err := readVINs(vinList, vinFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading VINs: %s\n", err)
+		return
+	}
+	if len(vins) == 0 {
+		fmt.Fprintln(os.Stderr, "No VINs provided; use -vins or -vin-file")
+		return
+	}
+
+	acct, err := config.Account()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error logging into account: %s\n", err)
+		return
+	}
+	skey, err := config.PrivateKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading private key: %s\n", err)
+		return
+	}
+	sessions := cache.New(0)
+	if config.CacheFilename != "" {
+		if imported, err := cache.ImportFromFile(config.CacheFilename); err == nil {
+			sessions = imported
+		}
+	}
+	opts.Dial = fleet.AccountDialer(acct, skey, sessions)
+	opts.Sessions = sessions
+	opts.Progress = func(done, total int, result fleet.Result) {
+		if result.Err != nil {
+			fmt.Printf("[%d/%d] %s: FAILED after %d attempt(s): %s\n", done, total, result.VIN, result.Attempts, result.Err)
+		} else {
+			fmt.Printf("[%d/%d] %s: OK (%s)\n", done, total, result.VIN, result.Duration.Round(time.Millisecond))
+		}
+	}
+
+	ctx := context.Background()
+	if deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
+	}
+	report := fleet.Run(ctx, vins, fn, &opts)
+
+	if config.CacheFilename != "" {
+		if err := sessions.SyncFile(config.CacheFilename); err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating session cache: %s\n", err)
+		}
+	}
+	failed := len(report.Failed())
+	fmt.Printf("%d succeeded, %d failed\n", len(report.Results)-failed, failed)
+	if failed == 0 {
+		status = 0
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// envRunMain is set when runMain starts the test binary to run main instead of the tests.
+const envRunMain = "TESLA_HTTP_PROXY_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envRunMain) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs main with a new private key and args in a copy of the test binary, and returns its
+// exit code and standard error.
+func runMain(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err := protocol.SavePrivateKey(skey, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], append([]string{"-key-file", keyFile, "-port", "0"}, args...)...)
+	cmd.Env = append(os.Environ(), envRunMain+"=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), stderr.String()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return 0, stderr.String()
+}
+
+func TestSetupErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"-policy-file", missing}, "couldn't load policy file"},
+		{[]string{"-defaults-file", missing}, "couldn't load command defaults file"},
+		{[]string{"-aliases-file", missing}, "couldn't load command aliases file"},
+		{[]string{"-busy-status", "500"}, "invalid -busy-status 500"},
+		{[]string{"-base-path", "tesla"}, "invalid -base-path"},
+	}
+	for _, test := range tests {
+		code, stderr := runMain(t, test.args...)
+		if code != 1 || !strings.Contains(stderr, test.expected) {
+			t.Errorf("%v: expected exit code 1 and %q, got %d: %s", test.args, test.expected, code, stderr)
+		}
+	}
+}
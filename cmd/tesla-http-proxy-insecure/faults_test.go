@@ -0,0 +1,16 @@
+//go:build faultinjection
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFaultInjectionFileError(t *testing.T) {
+	code, stderr := runMain(t, "-fault-injection-file", filepath.Join(t.TempDir(), "missing.json"))
+	if code != 1 || !strings.Contains(stderr, "couldn't load fault injection file") {
+		t.Errorf("Expected exit code 1 for missing fault injection file, got %d: %s", code, stderr)
+	}
+}
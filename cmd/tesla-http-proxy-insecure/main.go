@@ -2,17 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/teslamotors/vehicle-command/internal/log"
+	"github.com/teslamotors/vehicle-command/internal/profiling"
+	"github.com/teslamotors/vehicle-command/internal/proxyflags"
 	"github.com/teslamotors/vehicle-command/pkg/cli"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 	"github.com/teslamotors/vehicle-command/pkg/proxy"
+	"github.com/teslamotors/vehicle-command/pkg/version"
 )
 
 const (
@@ -23,16 +29,73 @@ const (
 const (
 	EnvHost    = "TESLA_HTTP_PROXY_HOST"
 	EnvPort    = "TESLA_HTTP_PROXY_PORT"
+	EnvListen  = "TESLA_HTTP_PROXY_LISTEN"
 	EnvTimeout = "TESLA_HTTP_PROXY_TIMEOUT"
 	EnvVerbose = "TESLA_VERBOSE"
+
+	EnvBasePath = "TESLA_HTTP_PROXY_BASE_PATH"
+
+	EnvAuditLog     = "TESLA_HTTP_PROXY_AUDIT_LOG"
+	EnvAuditWebhook = "TESLA_HTTP_PROXY_AUDIT_WEBHOOK"
+
+	EnvCallbackKeyFile = "TESLA_HTTP_PROXY_CALLBACK_KEY_FILE"
 )
 
 // HTTPProxyConfig holds configuration for the HTTP-only proxy server.
 type HTTPProxyConfig struct {
-	verbose bool
-	host    string
-	port    int
-	timeout time.Duration
+	verbose      bool
+	host         string
+	port         int
+	listen       string
+	basePath     string
+	timeout      time.Duration
+	connectWait  time.Duration
+	commandWait  time.Duration
+	apiCallWait  time.Duration
+	roleRefresh  time.Duration
+	keepAlive    time.Duration
+	vehicleIdle  time.Duration
+	maxURL       int
+	maxHeader    int
+	compressMin  int
+	closeConns   bool
+	startupJSON  bool
+	maxSessions  int
+	busyStatus   int
+	allowLoc     bool
+	allowSpeed   bool
+	strictParams bool
+	enableUI     bool
+	version      bool
+	userAgent    string
+	checkClock   bool
+	requireClock bool
+	maxSkew      time.Duration
+	policyFile   string
+	defaultsFile string
+	aliasesFile  string
+	faultsFile   string
+	vinAllowlist proxy.VINAllowlist
+	audit        proxy.AuditConfig
+	accessLog    proxy.AccessLogConfig
+	telemetry    proxy.TelemetryConfig
+
+	callbackKeyFile   string
+	callbackAttempts  int
+	callbackRetryWait time.Duration
+	callbackHosts     []string
+
+	adminTokenFile   string
+	metricsTokenFile string
+
+	ipFilter proxy.IPFilter
+
+	maxRequests   int
+	maxQueued     int
+	admissionWait time.Duration
+
+	pprofAddr      string
+	pprofTokenFile string
 }
 
 var (
@@ -43,7 +106,86 @@ func init() {
 	flag.BoolVar(&httpConfig.verbose, "verbose", false, "Enable verbose logging")
 	flag.StringVar(&httpConfig.host, "host", "localhost", "Proxy server `hostname`")
 	flag.IntVar(&httpConfig.port, "port", defaultPort, "`Port` to listen on")
+	flag.StringVar(&httpConfig.listen, "listen", "", "Listen on `address` (e.g., [::]:8443 or 0.0.0.0:8443), overriding -host and -port")
+	flag.StringVar(&httpConfig.basePath, "base-path", "", "Serve all endpoints under `prefix` (e.g., /tesla), for ingresses that forward requests without removing it")
 	flag.DurationVar(&httpConfig.timeout, "timeout", proxy.DefaultTimeout, "Timeout interval when sending commands")
+	flag.DurationVar(&httpConfig.connectWait, "connect-timeout", 0, "Fail commands with 504 if connecting to the vehicle and the session handshake take longer (0 to use -timeout)")
+	flag.DurationVar(&httpConfig.commandWait, "command-timeout", 0, "Fail commands with 504 if the vehicle doesn't complete them within this long of connecting (0 to use -timeout)")
+	flag.DurationVar(&httpConfig.apiCallWait, "api-call-timeout", 0, "Limit each request to Fleet API made for a command, retrying requests that time out while -timeout allows (0 to disable)")
+	flag.DurationVar(&httpConfig.keepAlive, "keep-alive", 0, "Refresh vehicle sessions that have been idle this long, while the vehicle is awake (0 to disable)")
+	flag.DurationVar(&httpConfig.vehicleIdle, "vehicle-idle-timeout", proxy.DefaultVehicleIdleTimeout, "Keep each vehicle's connection and session state in memory for this long after a command (0 to disable)")
+	flag.DurationVar(&httpConfig.roleRefresh, "role-refresh", proxy.DefaultRoleRefreshInterval, "How long to trust the role of the command-authentication key on each vehicle before checking it again on the next connection (0 to disable role pre-checks)")
+	flag.IntVar(&httpConfig.maxURL, "max-url-length", proxy.DefaultMaxURLLength, "Reject requests with a longer path and query string, in `bytes` (0 to disable)")
+	flag.IntVar(&httpConfig.maxHeader, "max-header-bytes", proxy.DefaultMaxHeaderBytes, "Reject requests with larger headers, in `bytes` (0 to disable)")
+	flag.IntVar(&httpConfig.maxSessions, "max-sessions", 0, "Reject commands with 503 while this many vehicles have commands in progress (0 for no limit)")
+	flag.IntVar(&httpConfig.maxRequests, "max-concurrent-requests", 0, "Handle at most this many authenticated requests at once, queueing or rejecting the rest with 503 (0 for no limit)")
+	flag.IntVar(&httpConfig.maxQueued, "max-queued-requests", 0, "Number of requests that may wait for admission under -max-concurrent-requests before more are rejected")
+	flag.DurationVar(&httpConfig.admissionWait, "admission-wait", proxy.DefaultAdmissionWait, "Reject requests that have waited this long for admission under -max-concurrent-requests")
+	flag.IntVar(&httpConfig.busyStatus, "busy-status", proxy.DefaultBusyStatus, "HTTP `status` (429 or 503) returned, with Retry-After, when the vehicle stays busy or rate limits commands")
+	flag.BoolVar(&httpConfig.allowLoc, "allow-location", false, "Accept the get_location command, which reveals the vehicle's GPS position")
+	flag.BoolVar(&httpConfig.allowSpeed, "allow-speed-limit", false, "Accept speed_limit_* commands, which restrict how fast the vehicle can be driven")
+	flag.BoolVar(&httpConfig.strictParams, "strict-parameters", false, "Reject command bodies with parameters the command doesn't recognize, instead of ignoring them as Fleet API does")
+	flag.BoolVar(&httpConfig.enableUI, "enable-ui", false, "Serve a page at /ui for trying out commands from a browser (for local development)")
+	flag.BoolVar(&httpConfig.version, "version", false, "Print version information and exit")
+	flag.StringVar(&httpConfig.userAgent, "user-agent", "", "Identify your application to Tesla's servers by prefixing the User-Agent with `product` (e.g., acme-fleet/2.1). Defaults to $TESLA_USER_AGENT.")
+	flag.BoolVar(&httpConfig.checkClock, "check-clock", false, "At startup, warn if the local clock differs from Fleet API's by more than -max-clock-skew")
+	flag.BoolVar(&httpConfig.requireClock, "require-clock-sync", false, "Like -check-clock, but refuse to start if the clock is out of sync or can't be checked")
+	flag.DurationVar(&httpConfig.maxSkew, "max-clock-skew", proxy.DefaultMaxClockSkew, "Largest acceptable difference between the local clock and Fleet API's")
+	flag.StringVar(&httpConfig.policyFile, "policy-file", "", "Only accept commands permitted by the JSON policy in `file`")
+	flag.StringVar(&httpConfig.defaultsFile, "defaults-file", "", "Fill in parameters that commands omit from the per-VIN defaults in JSON `file`")
+	flag.StringVar(&httpConfig.aliasesFile, "aliases-file", "", "Accept other names for commands, as mapped by the JSON aliases in `file`")
+	flag.Func("vin-allowlist", "Only serve vehicles with these comma-separated `VINs`, each of which may end in * to match VINs with that prefix (default: all vehicles)", httpConfig.vinAllowlist.Parse)
+	flag.Func("vin-allowlist-file", "Like -vin-allowlist, but read VINs from `file`, one per line", httpConfig.vinAllowlist.LoadFile)
+	flag.IntVar(&httpConfig.compressMin, "compress-min-bytes", proxy.DefaultCompressionMinBytes, "Compress responses of at least this many `bytes` if the client accepts gzip or deflate (0 to disable)")
+	flag.BoolVar(&httpConfig.closeConns, "close-connections", false, "Close each client connection after one response, for clients that don't reuse connections or send Connection: close")
+	flag.BoolVar(&httpConfig.startupJSON, "startup-json", false, "Once listening, write a JSON line with the listen address, transport, version, and other settings to standard output, for supervisors that check the configuration")
+	flag.StringVar(&httpConfig.accessLog.Filename, "access-log", "", "Append an access log line in Apache Combined Log Format for each request to `file` (\"-\" for standard output)")
+	flag.Int64Var(&httpConfig.accessLog.MaxBytes, "access-log-max-bytes", 100<<20, "Rotate the access log once it exceeds this many `bytes` (0 to disable)")
+	flag.IntVar(&httpConfig.accessLog.MaxBackups, "access-log-backups", 5, "Number of rotated access log files to keep")
+	flag.StringVar(&httpConfig.audit.Filename, "audit-log", "", "Append a JSON-lines audit record of each vehicle command to `file`")
+	flag.Int64Var(&httpConfig.audit.MaxBytes, "audit-log-max-bytes", 100<<20, "Rotate the audit log once it exceeds this many `bytes` (0 to disable)")
+	flag.IntVar(&httpConfig.audit.MaxBackups, "audit-log-backups", 5, "Number of rotated audit log files to keep")
+	flag.StringVar(&httpConfig.audit.WebhookURL, "audit-webhook", "", "POST audit records to `url` instead of writing them to a file")
+	flag.IntVar(&httpConfig.audit.QueueSize, "audit-queue-size", proxy.DefaultAuditQueueSize, "Maximum number of audit records buffered before records are dropped")
+	flag.Func("audit-redact", "Comma-separated response `fields` to redact from audit records, each optionally prefixed with \"command:\" (\"none\" to disable; default redacts vehicle positions)", func(s string) (err error) {
+		httpConfig.audit.Redactions, err = proxy.ParseAuditRedactions(s)
+		return err
+	})
+	flag.StringVar(&httpConfig.callbackKeyFile, "callback-key-file", "", "Sign the results of asynchronous commands with the HMAC key in `file`. Requests with a callback_url are rejected unless this is set.")
+	flag.IntVar(&httpConfig.callbackAttempts, "callback-attempts", proxy.DefaultCallbackAttempts, "Maximum number of attempts to deliver each callback")
+	flag.DurationVar(&httpConfig.callbackRetryWait, "callback-retry-interval", proxy.DefaultCallbackRetryInterval, "Delay before retrying a failed callback, doubling after each attempt")
+	flag.Func("callback-allowed-hosts", "Only send callbacks to these comma-separated `hosts`, which may have private addresses (default: any host with a public address)", func(value string) error {
+		for _, host := range strings.Split(value, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				httpConfig.callbackHosts = append(httpConfig.callbackHosts, host)
+			}
+		}
+		return nil
+	})
+	flag.Func("allow-cidr", "Only accept requests from clients in these comma-separated CIDR `ranges` (default: all clients)", func(s string) (err error) {
+		httpConfig.ipFilter.Allow, err = proxy.ParseCIDRs(s)
+		return err
+	})
+	flag.Func("deny-cidr", "Reject requests from clients in these comma-separated CIDR `ranges` with 403, even if -allow-cidr includes them", func(s string) (err error) {
+		httpConfig.ipFilter.Deny, err = proxy.ParseCIDRs(s)
+		return err
+	})
+	flag.Func("trusted-proxy-cidr", "Use the X-Forwarded-For header to identify clients of reverse proxies in these comma-separated CIDR `ranges`", func(s string) (err error) {
+		httpConfig.ipFilter.TrustedProxies, err = proxy.ParseCIDRs(s)
+		return err
+	})
+	flag.StringVar(&httpConfig.adminTokenFile, "admin-token-file", "", "Enable the /admin/ endpoints for clients that present the bearer token in `file`")
+	flag.StringVar(&httpConfig.metricsTokenFile, "metrics-token-file", "", "Enable the /metrics endpoint for clients that present the bearer token in `file`")
+	flag.StringVar(&httpConfig.pprofAddr, "pprof-addr", "", "Serve Go profiling data on a separate `address` (e.g., localhost:6060). Requires -pprof-token-file.")
+	flag.StringVar(&httpConfig.pprofTokenFile, "pprof-token-file", "", "Require clients of -pprof-addr to present the bearer token in `file`")
+	flag.StringVar(&httpConfig.telemetry.Addr, "telemetry-listen", "", "Accept Fleet Telemetry connections from vehicles on `address` (e.g., :4443)")
+	flag.StringVar(&httpConfig.telemetry.CertFile, "telemetry-cert", "", "TLS certificate chain `file` presented to vehicles by the telemetry listener")
+	flag.StringVar(&httpConfig.telemetry.KeyFile, "telemetry-key", "", "TLS private key `file` for the telemetry listener")
+	flag.StringVar(&httpConfig.telemetry.ClientCAFile, "telemetry-ca", "", "CA certificate `file` used to verify vehicle client certificates")
+	flag.StringVar(&httpConfig.telemetry.Filename, "telemetry-output", "", "Append decoded telemetry records as JSON lines to `file`")
+	flag.Int64Var(&httpConfig.telemetry.MaxBytes, "telemetry-output-max-bytes", 100<<20, "Rotate the telemetry output once it exceeds this many `bytes` (0 to disable)")
+	flag.IntVar(&httpConfig.telemetry.MaxBackups, "telemetry-output-backups", 5, "Number of rotated telemetry output files to keep")
+	flag.StringVar(&httpConfig.telemetry.WebhookURL, "telemetry-webhook", "", "POST decoded telemetry records to `url` instead of writing them to a file")
 }
 
 // Usage prints help text for the command.
@@ -77,17 +219,32 @@ func main() {
 	flag.Usage = Usage
 	config.RegisterCommandLineFlags()
 	flag.Parse()
+	if httpConfig.version {
+		version.Print()
+		return
+	}
 
 	err = readFromEnvironment()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading environment: %s\n", err)
 		os.Exit(1)
 	}
+	if err := config.ReadFromProfile(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading profile: %s\n", err)
+		os.Exit(1)
+	}
 	config.ReadFromEnvironment()
 
 	if httpConfig.verbose {
 		log.SetLevel(log.LevelDebug)
 	}
+	log.ConfigureFromEnvironment()
+	log.Info("Starting %s %s", version.Program(), version.Get())
+
+	addr, err := listenAddress()
+	if err != nil {
+		return
+	}
 
 	var skey protocol.ECDHPrivateKey
 	skey, err = config.PrivateKey()
@@ -95,22 +252,177 @@ func main() {
 		return
 	}
 
+	var options []proxy.Option
+	if httpConfig.policyFile != "" {
+		policy, loadErr := proxy.LoadPolicyFile(httpConfig.policyFile)
+		if loadErr != nil {
+			err = fmt.Errorf("couldn't load policy file: %w", loadErr)
+			return
+		}
+		options = append(options, proxy.WithAuthorizer(policy))
+	}
+	if httpConfig.defaultsFile != "" {
+		defaults, loadErr := proxy.LoadCommandDefaultsFile(httpConfig.defaultsFile)
+		if loadErr != nil {
+			err = fmt.Errorf("couldn't load command defaults file: %w", loadErr)
+			return
+		}
+		options = append(options, proxy.WithCommandDefaults(defaults))
+	}
+	if httpConfig.aliasesFile != "" {
+		aliases, loadErr := proxy.LoadCommandAliasesFile(httpConfig.aliasesFile)
+		if loadErr != nil {
+			err = fmt.Errorf("couldn't load command aliases file: %w", loadErr)
+			return
+		}
+		options = append(options, proxy.WithCommandAliases(aliases))
+	}
+	if httpConfig.faultsFile != "" {
+		faults, loadErr := proxy.LoadFaultInjectionFile(httpConfig.faultsFile)
+		if loadErr != nil {
+			err = fmt.Errorf("couldn't load fault injection file: %w", loadErr)
+			return
+		}
+		log.Warning("Fault injection is enabled. Commands matching the rules in %s will be delayed or fail on purpose. Never enable this in production.", httpConfig.faultsFile)
+		options = append(options, proxy.WithFaultInjection(faults))
+	}
+	if f := &httpConfig.ipFilter; len(f.Allow) > 0 || len(f.Deny) > 0 || len(f.TrustedProxies) > 0 {
+		options = append(options, proxy.WithIPFilter(f))
+	}
+	if httpConfig.vinAllowlist.Len() > 0 {
+		options = append(options, proxy.WithVINAllowlist(&httpConfig.vinAllowlist))
+	}
+
 	log.Debug("Creating proxy")
-	p, err := proxy.New(context.Background(), skey, cacheSize)
+	p, err := proxy.New(context.Background(), skey, cacheSize, options...)
 	if err != nil {
 		log.Error("Error initializing proxy service: %v", err)
 		return
 	}
 	p.Timeout = httpConfig.timeout
-	addr := fmt.Sprintf("%s:%d", httpConfig.host, httpConfig.port)
+	p.ConnectTimeout = httpConfig.connectWait
+	p.CommandTimeout = httpConfig.commandWait
+	p.APICallTimeout = httpConfig.apiCallWait
+	p.Environment = config.Environment
+	p.FleetAPIHost = config.FleetAPIHost
+	if p.Environment != "" {
+		log.Info("Using environment %s (Fleet API server %s)", p.Environment, p.FleetAPIHost)
+	}
+	p.RoleRefreshInterval = httpConfig.roleRefresh
+	p.KeepAliveInterval = httpConfig.keepAlive
+	p.VehicleIdleTimeout = httpConfig.vehicleIdle
+	p.MaxURLLength = httpConfig.maxURL
+	p.MaxHeaderBytes = httpConfig.maxHeader
+	p.CompressionMinBytes = httpConfig.compressMin
+	p.CloseConnections = httpConfig.closeConns
+	p.MaxActiveSessions = httpConfig.maxSessions
+	p.MaxConcurrentRequests = httpConfig.maxRequests
+	p.MaxQueuedRequests = httpConfig.maxQueued
+	p.AdmissionWait = httpConfig.admissionWait
+	if httpConfig.busyStatus != http.StatusTooManyRequests && httpConfig.busyStatus != http.StatusServiceUnavailable {
+		err = fmt.Errorf("invalid -busy-status %d: expected %d or %d", httpConfig.busyStatus, http.StatusTooManyRequests, http.StatusServiceUnavailable)
+		return
+	}
+	p.BusyStatus = httpConfig.busyStatus
+	if httpConfig.basePath != "" && !strings.HasPrefix(httpConfig.basePath, "/") {
+		err = fmt.Errorf("invalid -base-path %q: expected a path starting with /", httpConfig.basePath)
+		return
+	}
+	p.BasePath = httpConfig.basePath
+	p.AllowLocation = httpConfig.allowLoc
+	p.AllowSpeedLimit = httpConfig.allowSpeed
+	p.StrictParameters = httpConfig.strictParams
+	p.EnableUI = httpConfig.enableUI
+	p.UserAgent = httpConfig.userAgent
+	p.MaxClockSkew = httpConfig.maxSkew
+	p.IncludeTiming = httpConfig.verbose
+	p.IncludeMessages = httpConfig.verbose
+	p.Callbacks.Attempts = httpConfig.callbackAttempts
+	p.Callbacks.RetryInterval = httpConfig.callbackRetryWait
+	p.Callbacks.AllowedHosts = httpConfig.callbackHosts
+	if httpConfig.callbackKeyFile != "" {
+		if p.Callbacks.SigningKey, err = proxyflags.ReadSecret(httpConfig.callbackKeyFile, "callback key"); err != nil {
+			return
+		}
+	}
+	if httpConfig.adminTokenFile != "" {
+		if p.AdminToken, err = proxyflags.ReadSecret(httpConfig.adminTokenFile, "admin token"); err != nil {
+			return
+		}
+	}
+	if httpConfig.metricsTokenFile != "" {
+		if p.MetricsToken, err = proxyflags.ReadSecret(httpConfig.metricsTokenFile, "metrics token"); err != nil {
+			return
+		}
+	}
+	if httpConfig.checkClock || httpConfig.requireClock {
+		ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+		_, err = p.CheckClock(ctx)
+		cancel()
+		if err != nil {
+			if httpConfig.requireClock {
+				return
+			}
+			if !errors.Is(err, proxy.ErrClockUnsynchronized) {
+				log.Warning("%s", err)
+			}
+			err = nil
+		}
+	}
+	p.Settings = config.Dump()
+	cli.DumpFlags(flag.CommandLine, p.Settings)
+	if p.Audit, err = httpConfig.audit.Open(); err != nil {
+		return
+	}
+	if p.AccessLog, err = httpConfig.accessLog.Open(); err != nil {
+		return
+	}
+	telemetryServer, err := httpConfig.telemetry.Open()
+	if err != nil {
+		return
+	}
+	go p.RunKeepAlive(context.Background())
+	if telemetryServer != nil {
+		log.Info("Accepting Fleet Telemetry connections on %s", telemetryServer.Addr)
+		go func() {
+			log.Error("Telemetry listener stopped: %s", telemetryServer.ListenAndServeTLS("", ""))
+		}()
+	}
+	if httpConfig.pprofAddr != "" {
+		var pprofServer *http.Server
+		if pprofServer, err = profiling.NewServer(httpConfig.pprofAddr, httpConfig.pprofTokenFile, proxyflags.Port(addr)); err != nil {
+			return
+		}
+		log.Info("Serving profiling data on %s", pprofServer.Addr)
+		go func() {
+			log.Error("Profiling listener stopped: %s", pprofServer.ListenAndServe())
+		}()
+	}
 	log.Info("Listening on %s (HTTP, no TLS)", addr)
 
-	log.Error("Server stopped: %s", http.ListenAndServe(addr, p))
+	var ln net.Listener
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		return
+	}
+	if httpConfig.startupJSON {
+		if err = p.StartupInfo(ln.Addr(), false).Write(os.Stdout); err != nil {
+			return
+		}
+	}
+	// The server rejects requests with oversized headers before reading them in full; the proxy's
+	// own check then applies the exact limit. Zero leaves the net/http default.
+	server := &http.Server{Handler: p, MaxHeaderBytes: httpConfig.maxHeader}
+	log.Error("Server stopped: %s", server.Serve(ln))
 }
 
 // readFromEnvironment applies configuration from environment variables.
 // Values set by command-line flags are not overwritten.
 func readFromEnvironment() error {
+	// A listen address from the environment doesn't override -host or -port flags.
+	if httpConfig.listen == "" && httpConfig.host == "localhost" && httpConfig.port == defaultPort {
+		httpConfig.listen = os.Getenv(EnvListen)
+	}
+
 	if httpConfig.host == "localhost" {
 		if host, ok := os.LookupEnv(EnvHost); ok {
 			httpConfig.host = host
@@ -123,6 +435,26 @@ func readFromEnvironment() error {
 		}
 	}
 
+	if httpConfig.audit.Filename == "" {
+		httpConfig.audit.Filename = os.Getenv(EnvAuditLog)
+	}
+
+	if httpConfig.basePath == "" {
+		httpConfig.basePath = os.Getenv(EnvBasePath)
+	}
+
+	if httpConfig.userAgent == "" {
+		httpConfig.userAgent = os.Getenv(cli.EnvTeslaUserAgent)
+	}
+
+	if httpConfig.audit.WebhookURL == "" {
+		httpConfig.audit.WebhookURL = os.Getenv(EnvAuditWebhook)
+	}
+
+	if httpConfig.callbackKeyFile == "" {
+		httpConfig.callbackKeyFile = os.Getenv(EnvCallbackKeyFile)
+	}
+
 	var err error
 	if httpConfig.port == defaultPort {
 		if port, ok := os.LookupEnv(EnvPort); ok {
@@ -144,3 +476,8 @@ func readFromEnvironment() error {
 
 	return nil
 }
+
+// listenAddress returns the address the proxy listens on; see [proxyflags.ListenAddress].
+func listenAddress() (string, error) {
+	return proxyflags.ListenAddress(httpConfig.listen, httpConfig.host, httpConfig.port)
+}
@@ -21,6 +21,7 @@ func assertEquals(t *testing.T, expected, actual interface{}, message string) {
 func resetConfig() {
 	httpConfig.host = "localhost"
 	httpConfig.port = defaultPort
+	httpConfig.listen = ""
 	httpConfig.timeout = proxy.DefaultTimeout
 	httpConfig.verbose = false
 }
@@ -95,6 +96,7 @@ func TestFlagsPrecedenceOverEnvironment(t *testing.T) {
 	origPort := os.Getenv(EnvPort)
 	origVerbose := os.Getenv(EnvVerbose)
 	origTimeout := os.Getenv(EnvTimeout)
+	origListen := os.Getenv(EnvListen)
 	origArgs := os.Args
 
 	defer func() {
@@ -102,6 +104,7 @@ func TestFlagsPrecedenceOverEnvironment(t *testing.T) {
 		os.Setenv(EnvPort, origPort)
 		os.Setenv(EnvVerbose, origVerbose)
 		os.Setenv(EnvTimeout, origTimeout)
+		os.Setenv(EnvListen, origListen)
 		os.Args = origArgs
 	}()
 
@@ -110,6 +113,7 @@ func TestFlagsPrecedenceOverEnvironment(t *testing.T) {
 	os.Setenv(EnvPort, "9090")
 	os.Setenv(EnvVerbose, "true")
 	os.Setenv(EnvTimeout, "30s")
+	os.Setenv(EnvListen, "[::]:7070")
 
 	// Set command-line args that should take precedence
 	os.Args = []string{"cmd", "-host", "flaghost", "-port", "8888", "-timeout", "60s"}
@@ -121,6 +125,7 @@ func TestFlagsPrecedenceOverEnvironment(t *testing.T) {
 	flag.StringVar(&httpConfig.host, "host", "localhost", "Proxy server `hostname`")
 	flag.IntVar(&httpConfig.port, "port", defaultPort, "`Port` to listen on")
 	flag.DurationVar(&httpConfig.timeout, "timeout", proxy.DefaultTimeout, "Timeout interval when sending commands")
+	flag.StringVar(&httpConfig.listen, "listen", "", "Listen on `address`")
 
 	flag.Parse()
 	err := readFromEnvironment()
@@ -132,6 +137,78 @@ func TestFlagsPrecedenceOverEnvironment(t *testing.T) {
 	assertEquals(t, "flaghost", httpConfig.host, "host")
 	assertEquals(t, 8888, httpConfig.port, "port")
 	assertEquals(t, 60*time.Second, httpConfig.timeout, "timeout")
+	assertEquals(t, "", httpConfig.listen, "listen")
+
+	// -listen overrides both the environment and -host and -port
+	os.Args = []string{"cmd", "-host", "flaghost", "-port", "8888", "-listen", "[::1]:9999"}
+	flag.Parse()
+	if err := readFromEnvironment(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	addr, err := listenAddress()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assertEquals(t, "[::1]:9999", addr, "address")
+}
+
+func TestListenEnvironmentVariable(t *testing.T) {
+	origHost := os.Getenv(EnvHost)
+	origPort := os.Getenv(EnvPort)
+	origListen := os.Getenv(EnvListen)
+	origTimeout := os.Getenv(EnvTimeout)
+	defer func() {
+		os.Setenv(EnvHost, origHost)
+		os.Setenv(EnvPort, origPort)
+		os.Setenv(EnvListen, origListen)
+		os.Setenv(EnvTimeout, origTimeout)
+	}()
+
+	os.Unsetenv(EnvTimeout)
+	os.Setenv(EnvHost, "0.0.0.0")
+	os.Setenv(EnvPort, "9090")
+	os.Setenv(EnvListen, "[::]:7070")
+
+	resetConfig()
+	if err := readFromEnvironment(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	addr, err := listenAddress()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assertEquals(t, "[::]:7070", addr, "address")
+}
+
+func TestListenAddress(t *testing.T) {
+	defer resetConfig()
+
+	tests := []struct {
+		host string
+		port int
+		addr string
+	}{
+		{"localhost", 8080, "localhost:8080"},
+		{"::1", 8080, "[::1]:8080"},
+		{"[::1]", 8080, "[::1]:8080"},
+		{"::", 8080, "[::]:8080"},
+		{"", 8080, ":8080"},
+		{"0.0.0.0", 8080, "0.0.0.0:8080"},
+	}
+	for _, test := range tests {
+		resetConfig()
+		httpConfig.host, httpConfig.port = test.host, test.port
+		addr, err := listenAddress()
+		if err != nil {
+			t.Fatalf("Unexpected error for host %q: %v", test.host, err)
+		}
+		assertEquals(t, test.addr, addr, "address for host "+test.host)
+	}
+
+	httpConfig.listen = "::1:8080"
+	if _, err := listenAddress(); err == nil {
+		t.Error("Expected error for unbracketed IPv6 listen address, got nil")
+	}
 }
 
 func TestInvalidPortEnvironmentVariable(t *testing.T) {
@@ -0,0 +1,11 @@
+//go:build faultinjection
+
+package main
+
+import "flag"
+
+// Injected faults look exactly like real failures, so the flag that enables them only exists in
+// binaries built for testing with -tags faultinjection.
+func init() {
+	flag.StringVar(&httpConfig.faultsFile, "fault-injection-file", "", "FOR TESTING ONLY: delay and fail commands as described by the JSON rules in `file`")
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/teslamotors/vehicle-command/internal/proxyflags"
 	"github.com/teslamotors/vehicle-command/pkg/proxy"
 )
 
@@ -22,6 +23,7 @@ func TestParseConfig(t *testing.T) {
 	origKey := os.Getenv(EnvTLSKey)
 	origHost := os.Getenv(EnvHost)
 	origPort := os.Getenv(EnvPort)
+	origListen := os.Getenv(EnvListen)
 	origVerbose := os.Getenv(EnvVerbose)
 	origTimeout := os.Getenv(EnvTimeout)
 	origArgs := os.Args
@@ -32,6 +34,7 @@ func TestParseConfig(t *testing.T) {
 		os.Setenv(EnvTLSKey, origKey)
 		os.Setenv(EnvHost, origHost)
 		os.Setenv(EnvPort, origPort)
+		os.Setenv(EnvListen, origListen)
 		os.Setenv(EnvVerbose, origVerbose)
 		os.Setenv(EnvTimeout, origTimeout)
 		os.Args = origArgs
@@ -44,6 +47,7 @@ func TestParseConfig(t *testing.T) {
 		}
 		assertEquals(t, "localhost", httpConfig.host, "host")
 		assertEquals(t, defaultPort, httpConfig.port, "port")
+		assertEquals(t, "", httpConfig.listen, "listen")
 		assertEquals(t, proxy.DefaultTimeout, httpConfig.timeout, "timeout")
 		assertEquals(t, "", httpConfig.certFilename, "certFilename")
 		assertEquals(t, "", httpConfig.keyFilename, "keyFilename")
@@ -57,6 +61,7 @@ func TestParseConfig(t *testing.T) {
 		os.Setenv(EnvPort, "8443")
 		os.Setenv(EnvVerbose, "true")
 		os.Setenv(EnvTimeout, "30s")
+		os.Setenv(EnvListen, "[::]:8443")
 
 		err := readFromEnvironment()
 		if err != nil {
@@ -66,12 +71,13 @@ func TestParseConfig(t *testing.T) {
 		assertEquals(t, "/env/key.pem", httpConfig.keyFilename, "keyFilename")
 		assertEquals(t, "envhost", httpConfig.host, "host")
 		assertEquals(t, 8443, httpConfig.port, "port")
+		assertEquals(t, "[::]:8443", httpConfig.listen, "listen")
 		assertEquals(t, 30*time.Second, httpConfig.timeout, "timeout")
 		assertEquals(t, true, httpConfig.verbose, "verbose")
 	})
 
 	t.Run("flags override environment variables", func(t *testing.T) {
-		os.Args = []string{"cmd", "-cert", "/flag/cert.pem", "-tls-key", "/flag/key.pem", "-host", "flaghost", "-port", "9090", "-timeout", "60s"}
+		os.Args = []string{"cmd", "-cert", "/flag/cert.pem", "-tls-key", "/flag/key.pem", "-host", "flaghost", "-port", "9090", "-timeout", "60s", "-listen", "[::1]:9443"}
 
 		flag.Parse()
 		err := readFromEnvironment()
@@ -83,6 +89,64 @@ func TestParseConfig(t *testing.T) {
 		assertEquals(t, "/flag/key.pem", httpConfig.keyFilename, "keyFilename")
 		assertEquals(t, "flaghost", httpConfig.host, "host")
 		assertEquals(t, 9090, httpConfig.port, "port")
+		assertEquals(t, "[::1]:9443", httpConfig.listen, "listen")
 		assertEquals(t, 60*time.Second, httpConfig.timeout, "timeout")
 	})
+
+	t.Run("listen environment variable doesn't override host flag", func(t *testing.T) {
+		httpConfig.listen = ""
+		os.Args = []string{"cmd", "-host", "flaghost", "-port", "9090"}
+
+		flag.Parse()
+		if err := readFromEnvironment(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		assertEquals(t, "", httpConfig.listen, "listen")
+		addr, err := listenAddress()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		assertEquals(t, "flaghost:9090", addr, "address")
+	})
+}
+
+func TestListenAddress(t *testing.T) {
+	origConfig := *httpConfig
+	defer func() { *httpConfig = origConfig }()
+
+	tests := []struct {
+		host, listen string
+		port         int
+		addr         string
+		loopback     bool
+	}{
+		{host: "localhost", port: 443, addr: "localhost:443", loopback: true},
+		{host: "::1", port: 443, addr: "[::1]:443", loopback: true},
+		{host: "[::1]", port: 443, addr: "[::1]:443", loopback: true},
+		{host: "::", port: 4443, addr: "[::]:4443"},
+		{host: "[::]", port: 4443, addr: "[::]:4443"},
+		{host: "", port: 4443, addr: ":4443"},
+		{host: "0.0.0.0", port: 4443, addr: "0.0.0.0:4443"},
+		{host: "127.0.0.1", port: 4443, addr: "127.0.0.1:4443", loopback: true},
+		{host: "localhost", port: 443, listen: "[::]:8443", addr: "[::]:8443"},
+		{host: "localhost", port: 443, listen: ":8443", addr: ":8443"},
+		{host: "0.0.0.0", port: 443, listen: "[::1]:8443", addr: "[::1]:8443", loopback: true},
+	}
+	for _, test := range tests {
+		httpConfig.host, httpConfig.port, httpConfig.listen = test.host, test.port, test.listen
+		addr, err := listenAddress()
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", test, err)
+			continue
+		}
+		assertEquals(t, test.addr, addr, "address")
+		assertEquals(t, test.loopback, proxyflags.IsLoopback(addr), "loopback "+addr)
+	}
+
+	for _, listen := range []string{"::1:8443", "localhost", "localhost:http", "[::]:70000"} {
+		httpConfig.listen = listen
+		if _, err := listenAddress(); err == nil {
+			t.Errorf("Expected error for listen address %s", listen)
+		}
+	}
 }
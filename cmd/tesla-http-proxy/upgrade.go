@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/log"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+// envUpgrade is set in the environment of a process started by an upgrade. It lists the addresses
+// of the listeners that the previous process passed to the new one, separated by commas, in the
+// order of their file descriptors, starting at 3. They're followed by a pipe that carries the
+// previous process's session cache, and a pipe on which the new process reports that it's ready.
+const envUpgrade = "TESLA_HTTP_PROXY_UPGRADE"
+
+const (
+	// upgradeReadyTimeout limits the time the previous process waits for the new one to start
+	// serving. If it expires, the previous process kills the new one and keeps serving.
+	upgradeReadyTimeout = 30 * time.Second
+	// drainPollInterval is how often a process that has been upgraded checks whether its
+	// connections and asynchronous commands have finished.
+	drainPollInterval = 100 * time.Millisecond
+	// firstRequestTimeout limits the time a process that has been upgraded waits for connections
+	// it accepted to send their first request. The http package closes such connections without
+	// a response once shutdown starts, and treats them as idle after 5 seconds.
+	firstRequestTimeout = 5 * time.Second
+)
+
+// errUpgradeNotReady indicates the new process exited before it started serving.
+var errUpgradeNotReady = errors.New("new process exited before it was ready")
+
+// upgrader serves the proxy's listeners and, on upgradeSignals, hands them over to a new copy of
+// the binary without closing them. The previous process then finishes the requests it has
+// already accepted and exits, while the new one accepts new connections.
+type upgrader struct {
+	p         *proxy.Proxy
+	upgrades  chan os.Signal          // Receives upgradeSignals, if upgrades are enabled
+	inherited map[string]net.Listener // Listeners passed by the previous process, by address
+	ready     *os.File                // Reports readiness to the previous process, if any
+
+	lock      sync.Mutex
+	servers   []*http.Server
+	listeners []*onceCloseListener // listeners[i] is served by servers[i]
+	fresh     map[net.Conn]bool    // Connections that haven't sent a request yet
+}
+
+// onceCloseListener lets drain stop accepting connections before the servers shut down, which
+// close their listeners again.
+type onceCloseListener struct {
+	net.Listener
+	once sync.Once
+	err  error
+}
+
+func (l *onceCloseListener) Close() error {
+	l.once.Do(func() {
+		l.err = l.Listener.Close()
+	})
+	return l.err
+}
+
+// newUpgrader returns an upgrader for p. If this process was started by an upgrade, it takes over
+// the previous process's listeners and imports its sessions into p. If enabled is true, the
+// upgrade signals are caught from now on, so that one that arrives before the proxy is serving
+// doesn't terminate it.
+func newUpgrader(p *proxy.Proxy, enabled bool) (*upgrader, error) {
+	u := &upgrader{
+		p:         p,
+		inherited: make(map[string]net.Listener),
+		fresh:     make(map[net.Conn]bool),
+	}
+	if enabled {
+		u.upgrades = make(chan os.Signal, 1)
+		signal.Notify(u.upgrades, upgradeSignals...)
+	}
+	addrs, ok := os.LookupEnv(envUpgrade)
+	if !ok {
+		return u, nil
+	}
+	// A later upgrade sets the variable again for its own listeners.
+	os.Unsetenv(envUpgrade)
+	fd := uintptr(3)
+	for _, addr := range strings.Split(addrs, ",") {
+		f := os.NewFile(fd, "listener "+addr)
+		fd++
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't take over listener on %s: %w", addr, err)
+		}
+		u.inherited[addr] = ln
+	}
+	snapshot := os.NewFile(fd, "session snapshot")
+	u.ready = os.NewFile(fd+1, "upgrade ready")
+	// Sessions only save handshakes, so the new process can do without them.
+	if n, err := p.ImportSessions(snapshot); err != nil {
+		log.Warning("Couldn't import sessions from previous process: %s", err)
+	} else {
+		log.Info("Took over %d listeners and sessions for %d vehicles from previous process", len(u.inherited), n)
+	}
+	snapshot.Close()
+	return u, nil
+}
+
+// serve starts serving server in the background, on the listener inherited for server.Addr if
+// there is one. The returned channel receives the error that ends serving, which is
+// http.ErrServerClosed after an upgrade. If certFile is empty, server.TLSConfig must include a
+// certificate.
+func (u *upgrader) serve(server *http.Server, certFile, keyFile string) (<-chan error, error) {
+	// Loading the certificate up front means a new process with an unusable certificate fails
+	// before it reports that it's ready, rather than after the previous process has stopped.
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if server.TLSConfig == nil {
+			server.TLSConfig = &tls.Config{}
+		}
+		server.TLSConfig.Certificates = []tls.Certificate{cert}
+	}
+	ln, ok := u.inherited[server.Addr]
+	if ok {
+		delete(u.inherited, server.Addr)
+	} else {
+		var err error
+		if ln, err = net.Listen("tcp", server.Addr); err != nil {
+			return nil, err
+		}
+	}
+	connState := server.ConnState
+	server.ConnState = func(c net.Conn, state http.ConnState) {
+		u.lock.Lock()
+		if state == http.StateNew {
+			u.fresh[c] = true
+		} else {
+			delete(u.fresh, c)
+		}
+		u.lock.Unlock()
+		if connState != nil {
+			connState(c, state)
+		}
+	}
+	listener := &onceCloseListener{Listener: ln}
+	u.lock.Lock()
+	u.servers = append(u.servers, server)
+	u.listeners = append(u.listeners, listener)
+	u.lock.Unlock()
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- server.ServeTLS(listener, "", "")
+	}()
+	return stopped, nil
+}
+
+// listenerAddr returns the address of the listener on which server is served.
+func (u *upgrader) listenerAddr(server *http.Server) net.Addr {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	for i, s := range u.servers {
+		if s == server {
+			return u.listeners[i].Addr()
+		}
+	}
+	return nil
+}
+
+// wait reports readiness to the previous process, if there is one, and returns when stopped
+// receives an error, or after handing the listeners over to a new process. In the latter case,
+// it returns nil once the requests this process accepted have finished.
+func (u *upgrader) wait(stopped <-chan error) error {
+	// Listeners that no server claimed, for example because a flag changed, are closed so that
+	// their addresses can be reused.
+	for addr, ln := range u.inherited {
+		log.Warning("Closing listener on %s inherited from previous process", addr)
+		ln.Close()
+	}
+	u.inherited = nil
+	if u.ready != nil {
+		u.ready.Write([]byte{1})
+		u.ready.Close()
+		u.ready = nil
+	}
+
+	if u.upgrades != nil {
+		defer signal.Stop(u.upgrades)
+	}
+	for {
+		select {
+		case err := <-stopped:
+			return err
+		case sig := <-u.upgrades:
+			log.Info("Received %s; starting new process", sig)
+			pid, err := u.upgrade()
+			if err != nil {
+				log.Error("Upgrade failed, continuing to serve: %s", err)
+				continue
+			}
+			log.Info("New process %d is serving; draining", pid)
+			u.drain()
+			return nil
+		}
+	}
+}
+
+// upgrade starts a new copy of the binary with the same arguments, passing it the listeners and a
+// snapshot of the session cache, and returns its process ID once it's ready to serve.
+func (u *upgrader) upgrade() (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	u.lock.Lock()
+	servers, listeners := u.servers, u.listeners
+	u.lock.Unlock()
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	addrs := make([]string, len(listeners))
+	for i, ln := range listeners {
+		tcp, ok := ln.Listener.(*net.TCPListener)
+		if !ok {
+			return 0, fmt.Errorf("can't pass listener on %s to new process", servers[i].Addr)
+		}
+		f, err := listenerFile(tcp)
+		if err != nil {
+			return 0, err
+		}
+		files = append(files, f)
+		addrs[i] = servers[i].Addr
+	}
+	// The snapshot is taken before the new process starts so that it doesn't hold up commands if
+	// the new process reads it slowly.
+	var snapshot bytes.Buffer
+	if err := u.p.ExportSessions(&snapshot); err != nil {
+		return 0, fmt.Errorf("couldn't export sessions: %w", err)
+	}
+	snapshotReader, snapshotWriter, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	files = append(files, snapshotReader)
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		snapshotWriter.Close()
+		return 0, err
+	}
+	defer readyReader.Close()
+	files = append(files, readyWriter)
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), envUpgrade+"="+strings.Join(addrs, ","))
+	cmd.ExtraFiles = files
+	if err := cmd.Start(); err != nil {
+		snapshotWriter.Close()
+		return 0, err
+	}
+	// Close this process's copies of the files, so that reading from readyReader fails if the new
+	// process exits.
+	for _, f := range files {
+		f.Close()
+	}
+	files = nil
+	go func() {
+		snapshotWriter.Write(snapshot.Bytes())
+		snapshotWriter.Close()
+	}()
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	ready := make(chan error, 1)
+	go func() {
+		var b [1]byte
+		_, err := readyReader.Read(b[:])
+		ready <- err
+	}()
+
+	timer := time.NewTimer(upgradeReadyTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-ready:
+		if err != nil {
+			err = errUpgradeNotReady
+		}
+	case <-timer.C:
+		err = fmt.Errorf("new process wasn't ready within %s", upgradeReadyTimeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		if exitErr := <-exited; exitErr != nil {
+			err = fmt.Errorf("%w (%s)", err, exitErr)
+		}
+		return 0, err
+	}
+	return cmd.Process.Pid, nil
+}
+
+// drain stops accepting connections and returns once the requests this process accepted,
+// including asynchronous commands that haven't delivered their callbacks, have finished.
+func (u *upgrader) drain() {
+	u.p.Drain()
+	u.lock.Lock()
+	servers, listeners := u.servers, u.listeners
+	u.lock.Unlock()
+	// Connections that are still queued on the listeners are accepted by the new process.
+	for _, ln := range listeners {
+		ln.Close()
+	}
+	for deadline := time.Now().Add(firstRequestTimeout); time.Now().Before(deadline); {
+		u.lock.Lock()
+		fresh := len(u.fresh)
+		u.lock.Unlock()
+		if fresh == 0 {
+			break
+		}
+		time.Sleep(drainPollInterval)
+	}
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := server.Shutdown(context.Background()); err != nil {
+				log.Warning("Couldn't shut down listener on %s: %s", server.Addr, err)
+			}
+		}()
+	}
+	wg.Wait()
+	for u.p.RequestsInFlight() > 0 {
+		time.Sleep(drainPollInterval)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// Passing listeners to a new process relies on Unix file descriptor inheritance, so -enable-upgrade
+// is rejected on this platform.
+var upgradeSignals []os.Signal
+
+func listenerFile(*net.TCPListener) (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,193 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+// envUpgradeTest is set to the directory holding the TLS certificate and key when the test binary
+// is started as the new process by TestUpgrade.
+const envUpgradeTest = "TESLA_HTTP_PROXY_UPGRADE_TEST"
+
+const upgradeTestVIN = "5YJ3E1EA7KF000001"
+
+// upgradeTestHandler serves the process ID at /pid, the exported sessions at /sessions, and the
+// process ID at /slow after release is closed.
+func upgradeTestHandler(p *proxy.Proxy, entered chan<- struct{}, release <-chan struct{}) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pid", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, os.Getpid())
+	})
+	mux.HandleFunc("/sessions", func(w http.ResponseWriter, _ *http.Request) {
+		p.ExportSessions(w)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		entered <- struct{}{}
+		<-release
+		fmt.Fprint(w, os.Getpid())
+	})
+	mux.HandleFunc("/exit", func(http.ResponseWriter, *http.Request) {
+		os.Exit(0)
+	})
+	return mux
+}
+
+// runUpgradedProcess is the new process in TestUpgrade. It serves until the test asks it to exit.
+func runUpgradedProcess(t *testing.T, dir string) {
+	// Don't outlive a test that fails to clean up.
+	time.AfterFunc(time.Minute, func() { os.Exit(1) })
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, err := newUpgrader(p, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Addr: "127.0.0.1:0", Handler: upgradeTestHandler(p, nil, nil)}
+	stopped, err := up.serve(server, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Fatal(up.wait(stopped))
+}
+
+func TestUpgrade(t *testing.T) {
+	if dir := os.Getenv(envUpgradeTest); dir != "" {
+		runUpgradedProcess(t, dir)
+		return
+	}
+
+	dir := t.TempDir()
+	certPEM, keyPEM, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// The new process is a copy of the test binary that only runs this test.
+	t.Setenv(envUpgradeTest, dir)
+	origArgs := os.Args
+	os.Args = []string{os.Args[0], "-test.run=^TestUpgrade$"}
+	defer func() { os.Args = origArgs }()
+
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := `{"vehicles":{"` + upgradeTestVIN + `":[{"created_at":"2024-01-01T00:00:00Z","domain":2,"data":"AQI="}]}}`
+	if _, err := p.ImportSessions(strings.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	up, err := newUpgrader(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entered, release := make(chan struct{}, 1), make(chan struct{})
+	server := &http.Server{Addr: "127.0.0.1:0", Handler: upgradeTestHandler(p, entered, release)}
+	stopped, err := up.serve(server, certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- up.wait(stopped)
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		// Each request opens a connection, so that it's accepted by whichever process is serving.
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}, DisableKeepAlives: true},
+	}
+	baseURL := "https://" + up.listeners[0].Addr().String()
+	get := func(path string) (string, error) {
+		resp, err := client.Get(baseURL + path)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("%s: status %d", path, resp.StatusCode)
+		}
+		return string(body), err
+	}
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		body, err := get("/slow")
+		slow <- result{body, err}
+	}()
+	<-entered
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	self := strconv.Itoa(os.Getpid())
+	var child string
+	deadline := time.Now().Add(10 * time.Second)
+	for child == "" || child == self {
+		if time.Now().After(deadline) {
+			close(release)
+			t.Fatalf("New process didn't take over the listener")
+		}
+		if child, err = get("/pid"); err != nil {
+			t.Errorf("Request failed during handover: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer get("/exit")
+
+	if sessions, err := get("/sessions"); err != nil || !strings.Contains(sessions, upgradeTestVIN) {
+		t.Errorf("New process didn't import sessions: %q, %v", sessions, err)
+	}
+
+	// The request that was in flight during the handover completes in the previous process, which
+	// then exits.
+	select {
+	case err := <-done:
+		t.Fatalf("Previous process stopped before its request finished: %v", err)
+	default:
+	}
+	close(release)
+	if r := <-slow; r.err != nil || r.body != self {
+		t.Errorf("In-flight request didn't survive the handover: %q, %v", r.body, r.err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Previous process didn't drain cleanly: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Errorf("Previous process didn't finish draining")
+	}
+	if pid, err := get("/pid"); err != nil || pid != child {
+		t.Errorf("Expected new process %s to keep serving, got %q, %v", child, pid, err)
+	}
+}
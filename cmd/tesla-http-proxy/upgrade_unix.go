@@ -0,0 +1,42 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// upgradeSignals make the proxy hand its listeners over to a new process, if -enable-upgrade is
+// set.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
+
+// listenerFile returns a duplicate of ln's file descriptor for a new process.
+//
+// TCPListener.File isn't suitable, because exec.Cmd puts the files it returns in blocking mode,
+// which also applies to ln. Accept would then block in a system call that Close can't interrupt.
+func listenerFile(ln *net.TCPListener) (*os.File, error) {
+	raw, err := ln.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var fd int
+	var dupErr error
+	// Holding ForkLock keeps the descriptor from leaking into processes started before it's
+	// marked close-on-exec.
+	syscall.ForkLock.RLock()
+	err = raw.Control(func(s uintptr) {
+		if fd, dupErr = syscall.Dup(int(s)); dupErr == nil {
+			syscall.CloseOnExec(fd)
+		}
+	})
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if dupErr != nil {
+		return nil, os.NewSyscallError("dup", dupErr)
+	}
+	return os.NewFile(uintptr(fd), "listener "+ln.Addr().String()), nil
+}
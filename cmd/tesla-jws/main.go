@@ -13,6 +13,7 @@ import (
 	"github.com/teslamotors/vehicle-command/internal/authentication"
 	"github.com/teslamotors/vehicle-command/pkg/cli"
 	"github.com/teslamotors/vehicle-command/pkg/sign"
+	"github.com/teslamotors/vehicle-command/pkg/version"
 )
 
 const helpStr = `
@@ -144,9 +145,10 @@ func verify() {
 }
 
 func main() {
-	var fleet bool
+	var fleet, printVersion bool
 	flag.Usage = usage
 	flag.BoolVar(&fleet, "fleet", false, "Sign fleet-wide message")
+	flag.BoolVar(&printVersion, "version", false, "Print version information and exit")
 
 	config, err := cli.NewConfig(cli.FlagPrivateKey | cli.FlagVIN)
 	if err != nil {
@@ -156,6 +158,14 @@ func main() {
 
 	config.RegisterCommandLineFlags()
 	flag.Parse()
+	if printVersion {
+		version.Print()
+		return
+	}
+	if err := config.ReadFromProfile(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
 	config.ReadFromEnvironment()
 
 	if flag.NArg() == 0 {
@@ -15,9 +15,11 @@ import (
 	"path/filepath"
 
 	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/completion"
 	"github.com/teslamotors/vehicle-command/internal/log"
 	"github.com/teslamotors/vehicle-command/pkg/cli"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/version"
 )
 
 func writeErr(format string, a ...interface{}) {
@@ -42,12 +44,30 @@ func cliUsage() {
 
 func usage(w io.Writer) {
 	fmt.Fprintf(w, "usage: %s [OPTION...] create|delete|export|migrate\n", filepath.Base(os.Args[0]))
+	fmt.Fprintf(w, "       %s completion bash|zsh|fish\n", filepath.Base(os.Args[0]))
 	fmt.Fprintln(w, usageText)
 	fmt.Fprintln(w, "")
 	fmt.Fprintln(w, "OPTIONS:")
 	flag.PrintDefaults()
 }
 
+var keygenCommands = []completion.Command{
+	{Name: "create", Help: "Create a private key and print its public key"},
+	{Name: "delete", Help: "Delete the private key"},
+	{Name: "export", Help: "Print the private key in PEM format"},
+	{Name: "migrate", Help: "Move the private key in -key-file to the keyring as -key-name"},
+	{Name: "completion", Args: "bash|zsh|fish", Help: "Print a shell completion script"},
+}
+
+func completionSpec(config *cli.Config) *completion.Spec {
+	return &completion.Spec{
+		Program:    "tesla-keygen",
+		Flags:      flag.CommandLine,
+		Commands:   func() []completion.Command { return append([]completion.Command(nil), keygenCommands...) },
+		FlagValues: config.FlagValues(),
+	}
+}
+
 func printPublicKey(skey protocol.ECDHPrivateKey, outputFile string) bool {
 	pkey := ecdsa.PublicKey{Curve: elliptic.P256()}
 	pkey.X, pkey.Y = elliptic.Unmarshal(elliptic.P256(), skey.PublicBytes())
@@ -76,7 +96,7 @@ func printPublicKey(skey protocol.ECDHPrivateKey, outputFile string) bool {
 }
 
 func printPrivateKey(skey protocol.ECDHPrivateKey) error {
-	native, ok := skey.(*authentication.NativeECDHKey)
+	native, ok := authentication.UnwrapKey(skey).(*authentication.NativeECDHKey)
 	if !ok {
 		return fmt.Errorf("private key is not exportable")
 	}
@@ -91,10 +111,11 @@ func printPrivateKey(skey protocol.ECDHPrivateKey) error {
 func main() {
 	// Command-line variables
 	var (
-		overwrite  bool
-		outputFile string
-		skey       protocol.ECDHPrivateKey
-		err        error
+		overwrite    bool
+		printVersion bool
+		outputFile   string
+		skey         protocol.ECDHPrivateKey
+		err          error
 	)
 	status := 1
 	defer func() {
@@ -106,7 +127,13 @@ func main() {
 	flag.Usage = cliUsage
 	flag.BoolVar(&overwrite, "f", false, "Overwrite existing key if it exists")
 	flag.StringVar(&outputFile, "output", "", "Save public key to `file`. Defaults to stdout.")
+	flag.BoolVar(&printVersion, "version", false, "Print version information and exit")
 	flag.Parse()
+	if printVersion {
+		version.Print()
+		status = 0
+		return
+	}
 
 	if config.Debug {
 		log.SetLevel(log.LevelDebug)
@@ -115,8 +142,21 @@ func main() {
 		writeErr("Failed to load credential configuration: %s", err)
 		return
 	}
+	if err := config.ReadFromProfile(); err != nil {
+		writeErr("%s", err)
+		return
+	}
 	config.ReadFromEnvironment()
 
+	if flag.NArg() > 0 && completion.IsCompletionCommand(flag.Arg(0)) {
+		if err := completionSpec(config).Run(flag.Args(), os.Stdout); err != nil {
+			writeErr("%s", err)
+			return
+		}
+		status = 0
+		return
+	}
+
 	if flag.NArg() != 1 {
 		usage(os.Stderr)
 		return
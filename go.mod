@@ -4,10 +4,13 @@ go 1.23
 
 require (
 	github.com/99designs/keyring v1.2.2
+	github.com/BurntSushi/toml v1.6.0
 	github.com/cronokirby/saferith v0.33.0
 	github.com/go-ble/ble v0.0.0-20240122180141-8c5522f54333
 	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/google/flatbuffers v25.2.10+incompatible
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
+	github.com/gorilla/websocket v1.5.3
 	golang.org/x/term v0.5.0
 	google.golang.org/protobuf v1.34.2
 )
@@ -0,0 +1,146 @@
+package authentication
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/redact"
+)
+
+// KeyOperation identifies the private-key operation reported to a KeyUsageObserver.
+type KeyOperation string
+
+const (
+	KeyOperationECDH KeyOperation = "ecdh" // ECDH key agreement with a vehicle's public key
+	KeyOperationSign KeyOperation = "sign" // Schnorr signature
+)
+
+// KeyPurpose explains why the private key was used.
+type KeyPurpose string
+
+const (
+	// KeyPurposeUnspecified is reported for operations that callers didn't label.
+	KeyPurposeUnspecified KeyPurpose = "unspecified"
+	// KeyPurposeSessionHandshake derives a session key to authenticate session info sent by a
+	// vehicle during a handshake.
+	KeyPurposeSessionHandshake KeyPurpose = "session_handshake"
+	// KeyPurposeSessionResume re-derives the session key of a cached session, from which the
+	// HMAC keys that authenticate commands are personalized.
+	KeyPurposeSessionResume KeyPurpose = "session_resume"
+	// KeyPurposeMessageSignature signs a JWT, such as a Fleet Telemetry configuration.
+	KeyPurposeMessageSignature KeyPurpose = "message_signature"
+)
+
+// KeyUsage describes one use of a private key.
+type KeyUsage struct {
+	Time      time.Time    `json:"time"`
+	Operation KeyOperation `json:"operation"`
+	Purpose   KeyPurpose   `json:"purpose"`
+	// VINHash identifies the vehicle without revealing its VIN (see redact.HashVIN). It's empty
+	// if the operation isn't tied to one vehicle.
+	VINHash string `json:"vin_hash,omitempty"`
+}
+
+// KeyUsageObserver receives a KeyUsage for each private key operation. ObserveKeyUsage is called
+// synchronously before the operation, so it must be safe for concurrent use and should return
+// quickly.
+type KeyUsageObserver interface {
+	ObserveKeyUsage(usage KeyUsage)
+}
+
+// KeyUsageFunc adapts a function to the KeyUsageObserver interface.
+type KeyUsageFunc func(usage KeyUsage)
+
+// ObserveKeyUsage calls f(usage).
+func (f KeyUsageFunc) ObserveKeyUsage(usage KeyUsage) {
+	f(usage)
+}
+
+// observedKey reports the operations of an ECDHPrivateKey to an observer.
+type observedKey struct {
+	ECDHPrivateKey
+	observer KeyUsageObserver
+	vin      string
+	purpose  KeyPurpose
+}
+
+// ObserveKeyUsage returns a key that reports each use of key to observer. Keys that aren't
+// wrapped by ObserveKeyUsage aren't observed and incur no overhead.
+func ObserveKeyUsage(key ECDHPrivateKey, observer KeyUsageObserver) ECDHPrivateKey {
+	return &observedKey{ECDHPrivateKey: UnwrapKey(key), observer: observer, purpose: KeyPurposeUnspecified}
+}
+
+// WithKeyUsage labels the operations of key, if it's observed, with the vehicle and purpose that
+// they serve. Other keys are returned unchanged.
+func WithKeyUsage(key ECDHPrivateKey, vin string, purpose KeyPurpose) ECDHPrivateKey {
+	observed, ok := key.(*observedKey)
+	if !ok {
+		return key
+	}
+	labeled := *observed
+	labeled.vin = vin
+	labeled.purpose = purpose
+	return &labeled
+}
+
+// UnwrapKey returns the key underlying a key returned by ObserveKeyUsage, or key itself if it
+// isn't observed.
+func UnwrapKey(key ECDHPrivateKey) ECDHPrivateKey {
+	if observed, ok := key.(*observedKey); ok {
+		return observed.ECDHPrivateKey
+	}
+	return key
+}
+
+func (k *observedKey) observe(operation KeyOperation) {
+	usage := KeyUsage{Time: time.Now(), Operation: operation, Purpose: k.purpose}
+	if k.vin != "" {
+		usage.VINHash = redact.HashVIN(k.vin)
+	}
+	k.observer.ObserveKeyUsage(usage)
+}
+
+func (k *observedKey) Exchange(remotePublicBytes []byte) (Session, error) {
+	k.observe(KeyOperationECDH)
+	return k.ECDHPrivateKey.Exchange(remotePublicBytes)
+}
+
+func (k *observedKey) SchnorrSignature(message []byte) ([]byte, error) {
+	k.observe(KeyOperationSign)
+	return k.ECDHPrivateKey.SchnorrSignature(message)
+}
+
+// KeyUsageLog is a KeyUsageObserver that writes each KeyUsage to a writer as a line of JSON.
+type KeyUsageLog struct {
+	lock sync.Mutex
+	out  io.Writer
+	err  error
+}
+
+// NewKeyUsageLog returns a KeyUsageLog that writes to out.
+func NewKeyUsageLog(out io.Writer) *KeyUsageLog {
+	return &KeyUsageLog{out: out}
+}
+
+// ObserveKeyUsage appends usage to the log. Write errors don't interrupt key operations; the first
+// one is returned by Err.
+func (l *KeyUsageLog) ObserveKeyUsage(usage KeyUsage) {
+	line, err := json.Marshal(usage)
+	if err != nil {
+		return
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err := l.out.Write(append(line, '\n')); err != nil && l.err == nil {
+		l.err = err
+	}
+}
+
+// Err returns the first error encountered while writing the log.
+func (l *KeyUsageLog) Err() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.err
+}
@@ -0,0 +1,72 @@
+package authentication
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/redact"
+)
+
+func TestKeyUsageLog(t *testing.T) {
+	key, err := NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	observed := ObserveKeyUsage(key, NewKeyUsageLog(&out))
+
+	if _, err := observed.Exchange(peer.PublicBytes()); err != nil {
+		t.Fatal(err)
+	}
+	labeled := WithKeyUsage(observed, "5YJ3E1EA7KF000001", KeyPurposeMessageSignature)
+	if _, err := labeled.SchnorrSignature([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(observed.PublicBytes(), key.PublicBytes()) {
+		t.Error("Observed key has a different public key")
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %q", out.String())
+	}
+	var usages [2]KeyUsage
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &usages[i]); err != nil {
+			t.Fatalf("Invalid log line %q: %s", line, err)
+		}
+	}
+	if usages[0].Operation != KeyOperationECDH || usages[0].Purpose != KeyPurposeUnspecified || usages[0].VINHash != "" {
+		t.Errorf("Unexpected usage %+v", usages[0])
+	}
+	if usages[1].Operation != KeyOperationSign || usages[1].Purpose != KeyPurposeMessageSignature || usages[1].VINHash != redact.HashVIN("5YJ3E1EA7KF000001") {
+		t.Errorf("Unexpected usage %+v", usages[1])
+	}
+	if strings.Contains(out.String(), "5YJ3E1EA7KF000001") {
+		t.Error("Log contains VIN")
+	}
+}
+
+func TestUnobservedKeyUsage(t *testing.T) {
+	key, err := NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if WithKeyUsage(key, "VIN", KeyPurposeSessionHandshake) != key {
+		t.Error("WithKeyUsage wrapped a key that isn't observed")
+	}
+	observed := ObserveKeyUsage(key, KeyUsageFunc(func(KeyUsage) {}))
+	if UnwrapKey(observed) != key || UnwrapKey(WithKeyUsage(observed, "VIN", KeyPurposeSessionHandshake)) != key {
+		t.Error("UnwrapKey didn't return the original key")
+	}
+	if UnwrapKey(ObserveKeyUsage(observed, KeyUsageFunc(func(KeyUsage) {}))) != key {
+		t.Error("Observing an observed key should replace its observer")
+	}
+}
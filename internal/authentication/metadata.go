@@ -26,8 +26,12 @@ var (
 
 type metadata struct {
 	Context hash.Hash
-	fields  map[signatures.Tag]bool
+	fields  [4]uint64 // Bitset of the tags that have been added.
 	last    signatures.Tag
+
+	// Scratch space, so that adding a field doesn't allocate.
+	header [2]byte
+	word   [4]byte
 }
 
 // Add a (tag, value) pair to the list of metadata values.
@@ -42,17 +46,16 @@ func (m *metadata) Add(tag signatures.Tag, value []byte) error {
 		return ErrMetadataFieldTooLong
 	}
 	m.last = tag
-	m.Context.Write([]byte{byte(tag)})
-	m.Context.Write([]byte{byte(len(value))})
+	m.header = [2]byte{byte(tag), byte(len(value))}
+	m.Context.Write(m.header[:])
 	m.Context.Write(value)
-	m.fields[tag] = true
+	m.fields[byte(tag)/64] |= 1 << (byte(tag) % 64)
 	return nil
 }
 
 func (m *metadata) AddUint32(tag signatures.Tag, value uint32) error {
-	var buffer [4]byte
-	binary.BigEndian.PutUint32(buffer[:], value)
-	return m.Add(tag, buffer[:])
+	binary.BigEndian.PutUint32(m.word[:], value)
+	return m.Add(tag, m.word[:])
 }
 
 func newMetadata() *metadata {
@@ -60,17 +63,13 @@ func newMetadata() *metadata {
 }
 
 func newMetadataHash(context hash.Hash) *metadata {
-	meta := metadata{
-		Context: context,
-		fields:  make(map[signatures.Tag]bool),
-	}
-	return &meta
+	return &metadata{Context: context}
 }
 
 // Contains returns true if every tag on the provided list has been added.
 func (m *metadata) Contains(tags []signatures.Tag) bool {
 	for _, tag := range tags {
-		if _, ok := m.fields[tag]; !ok {
+		if m.fields[byte(tag)/64]&(1<<(byte(tag)%64)) == 0 {
 			return false
 		}
 	}
@@ -78,7 +77,8 @@ func (m *metadata) Contains(tags []signatures.Tag) bool {
 }
 
 func (m *metadata) Checksum(message []byte) []byte {
-	m.Context.Write([]byte{byte(signatures.Tag_TAG_END)})
+	m.header[0] = byte(signatures.Tag_TAG_END)
+	m.Context.Write(m.header[:1])
 	m.Context.Write(message)
 	return m.Context.Sum(nil)
 }
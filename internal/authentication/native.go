@@ -27,6 +27,10 @@ type NativeSession struct {
 	gcm         cipher.AEAD
 	key         []byte
 	localPublic []byte
+	// subkeys holds the HMAC keys derived from key for the labels used to authenticate messages,
+	// so that they aren't derived again for every message. It's read-only once the session is
+	// created.
+	subkeys map[string][]byte
 }
 
 func (n *NativeSession) LocalPublicBytes() []byte {
@@ -70,7 +74,11 @@ func (n *NativeSession) subkey(label []byte) []byte {
 }
 
 func (n *NativeSession) NewHMAC(label string) hash.Hash {
-	return hmac.New(sha256.New, n.subkey([]byte(label)))
+	key, ok := n.subkeys[label]
+	if !ok {
+		key = n.subkey([]byte(label))
+	}
+	return hmac.New(sha256.New, key)
 }
 
 func (n *NativeSession) SessionInfoHMAC(id, challenge, encodedInfo []byte) ([]byte, error) {
@@ -132,6 +140,10 @@ func (n *NativeECDHKey) Exchange(publicBytes []byte) (Session, error) {
 		return nil, err
 	}
 	session.localPublic = n.PublicBytes()
+	session.subkeys = map[string][]byte{
+		labelMessageAuth: session.subkey([]byte(labelMessageAuth)),
+		labelSessionInfo: session.subkey([]byte(labelSessionInfo)),
+	}
 	return &session, nil
 }
 
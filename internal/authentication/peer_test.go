@@ -16,7 +16,7 @@ var (
 	testMessagePlaintext = []byte("hello world")
 )
 
-func getVerifierAndSignerKeys(t *testing.T) (ECDHPrivateKey, ECDHPrivateKey) {
+func getVerifierAndSignerKeys(t testing.TB) (ECDHPrivateKey, ECDHPrivateKey) {
 	t.Helper()
 	// Generate a private key, extract the private scalar, convert to comma-separated hex:
 	// openssl ecparam -genkey -noout -name prime256v1 | openssl asn1parse | grep "OCTET STRING" | cut -f4 -d: | xxd -r -p | xxd -i
@@ -35,7 +35,7 @@ func getVerifierAndSignerKeys(t *testing.T) (ECDHPrivateKey, ECDHPrivateKey) {
 	return verifierPrivateKey, signerPrivateKey
 }
 
-func getGCMVerifierAndSigner(t *testing.T) (*Verifier, *Signer) {
+func getGCMVerifierAndSigner(t testing.TB) (*Verifier, *Signer) {
 	t.Helper()
 	verifierPrivateKey, signerPrivateKey := getVerifierAndSignerKeys(t)
 	challenge := []byte{0, 1, 2, 3, 4, 5, 6, 7}
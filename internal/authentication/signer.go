@@ -93,6 +93,17 @@ func (s *Signer) ExportSessionInfo() ([]byte, error) {
 	return proto.Marshal(&info)
 }
 
+// SkipCounter advances s's counter by n without transmitting any messages. Clients that restore
+// a Signer from persisted session info use this to avoid reusing counter values that were
+// consumed after the session info was saved. The counter stops at its maximum value.
+func (s *Signer) SkipCounter(n uint32) {
+	if s.counter > 0xFFFFFFFF-n {
+		s.counter = 0xFFFFFFFF
+	} else {
+		s.counter += n
+	}
+}
+
 // UpdateSessionInfo allows s to resync session state with a Verifier.
 // A Verifier may include info in an authentication error message when the error may have resulted
 // from a desync. The Signer can update its session info and then reattempt transmission.
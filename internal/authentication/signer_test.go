@@ -208,6 +208,19 @@ func TestSignerCounterRollover(t *testing.T) {
 	checkError(t, err, errCodeInvalidToken)
 }
 
+func TestSkipCounter(t *testing.T) {
+	_, signer := getGCMVerifierAndSigner(t)
+	start := signer.counter
+	signer.SkipCounter(10)
+	if signer.counter != start+10 {
+		t.Errorf("Expected counter %d, got %d", start+10, signer.counter)
+	}
+	signer.SkipCounter(0xFFFFFFFF)
+	if signer.counter != 0xFFFFFFFF {
+		t.Errorf("Counter wrapped around to %d", signer.counter)
+	}
+}
+
 func TestNewAuthenticatedSigner(t *testing.T) {
 	id := []byte("mycar")
 	challenge := []byte("challenge")
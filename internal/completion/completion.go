@@ -0,0 +1,306 @@
+// Package completion generates bash, zsh, and fish completion scripts for command-line tools built
+// on the standard flag package.
+//
+// Scripts embed the program's flags, but list commands and dynamic flag values (such as key names
+// in the system keyring) by invoking the program with [ListArg] at completion time. That keeps
+// completions in sync with the installed binary.
+package completion
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ListArg is the hidden command that completion scripts use to query the program. Programs should
+// pass command lines that begin with ListArg or "completion" to [Spec.Run].
+const ListArg = "__complete"
+
+// Shells supported by [Spec.WriteScript].
+const (
+	ShellBash = "bash"
+	ShellZsh  = "zsh"
+	ShellFish = "fish"
+)
+
+var ErrUnknownShell = errors.New("unknown shell (expected bash, zsh, or fish)")
+
+// Command describes a positional command, such as "charging-set-limit".
+type Command struct {
+	Name string
+	Args string // Argument hint, such as "PERCENT [AMPS]"
+	Help string
+}
+
+// description is shown next to the command by shells that support it.
+func (c Command) description() string {
+	help := firstLine(c.Help)
+	if c.Args == "" {
+		return help
+	}
+	return c.Args + " - " + help
+}
+
+// Spec describes a program's command-line interface.
+type Spec struct {
+	Program string
+	Flags   *flag.FlagSet
+	// Commands returns the program's commands.
+	Commands func() []Command
+	// FlagValues maps flag names to functions that list suggested values. Values are computed when
+	// the user presses TAB, so they may depend on the environment.
+	FlagValues map[string]func() []string
+}
+
+// IsCompletionCommand returns true if Run should handle a command line that starts with name.
+func IsCompletionCommand(name string) bool {
+	return name == "completion" || name == ListArg
+}
+
+// Run handles "completion SHELL", which writes a completion script, and the hidden ListArg
+// queries made by those scripts.
+func (s *Spec) Run(args []string, out io.Writer) error {
+	if len(args) == 0 || !IsCompletionCommand(args[0]) {
+		return errors.New("not a completion command")
+	}
+	if args[0] == "completion" {
+		if len(args) != 2 {
+			return errors.New("usage: completion bash|zsh|fish")
+		}
+		return s.WriteScript(out, args[1])
+	}
+	return s.list(out, args[1:])
+}
+
+// list writes completion candidates, one per line. Commands are followed by a tab and their
+// description.
+func (s *Spec) list(out io.Writer, args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "commands":
+		for _, command := range s.sortedCommands() {
+			fmt.Fprintf(out, "%s\t%s\n", command.Name, command.description())
+		}
+		return nil
+	case len(args) == 2 && args[0] == "flag":
+		if values, ok := s.FlagValues[args[1]]; ok {
+			for _, value := range values() {
+				fmt.Fprintln(out, value)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("usage: %s commands|flag NAME", ListArg)
+}
+
+func (s *Spec) sortedCommands() []Command {
+	if s.Commands == nil {
+		return nil
+	}
+	commands := s.Commands()
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// flagInfo summarizes a flag for script generation.
+type flagInfo struct {
+	name    string
+	help    string
+	isBool  bool
+	isFile  bool
+	dynamic bool
+}
+
+func (s *Spec) flags() []flagInfo {
+	var flags []flagInfo
+	s.Flags.VisitAll(func(f *flag.Flag) {
+		argName, usage := flag.UnquoteUsage(f)
+		info := flagInfo{name: f.Name, help: firstLine(usage)}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			info.isBool = true
+		}
+		info.isFile = strings.EqualFold(argName, "file")
+		_, info.dynamic = s.FlagValues[f.Name]
+		flags = append(flags, info)
+	})
+	return flags
+}
+
+// WriteScript writes a completion script for shell to w.
+func (s *Spec) WriteScript(w io.Writer, shell string) error {
+	switch shell {
+	case ShellBash:
+		s.writeBash(w)
+	case ShellZsh:
+		s.writeZsh(w)
+	case ShellFish:
+		s.writeFish(w)
+	default:
+		return ErrUnknownShell
+	}
+	return nil
+}
+
+// functionName converts the program name into a shell identifier.
+func (s *Spec) functionName() string {
+	return "_" + strings.NewReplacer("-", "_", ".", "_").Replace(s.Program)
+}
+
+// valueFlagPattern returns a shell case pattern matching flags that consume the next word, in both
+// the -flag and --flag forms accepted by the flag package.
+func valueFlagPattern(flags []flagInfo, include func(flagInfo) bool) string {
+	var patterns []string
+	for _, f := range flags {
+		if !f.isBool && include(f) {
+			patterns = append(patterns, "-"+f.name, "--"+f.name)
+		}
+	}
+	return strings.Join(patterns, "|")
+}
+
+func (s *Spec) writeBash(w io.Writer) {
+	flags := s.flags()
+	fn := s.functionName()
+	var names []string
+	for _, f := range flags {
+		names = append(names, "-"+f.name)
+	}
+
+	fmt.Fprintf(w, "# bash completion for %s. Load with: source <(%s completion bash)\n", s.Program, s.Program)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintln(w, `    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"`)
+	fmt.Fprintln(w, `    COMPREPLY=()`)
+	fmt.Fprintln(w, `    case "$prev" in`)
+	for _, f := range flags {
+		if f.dynamic {
+			fmt.Fprintf(w, "        -%s|--%s)\n", f.name, f.name)
+			fmt.Fprintf(w, "            COMPREPLY=($(compgen -W \"$(%s %s flag %s 2>/dev/null)\" -- \"$cur\"))\n", s.Program, ListArg, f.name)
+			fmt.Fprintln(w, "            return ;;")
+		}
+	}
+	if pattern := valueFlagPattern(flags, func(f flagInfo) bool { return f.isFile && !f.dynamic }); pattern != "" {
+		fmt.Fprintf(w, "        %s)\n", pattern)
+		fmt.Fprintln(w, `            COMPREPLY=($(compgen -f -- "$cur"))`)
+		fmt.Fprintln(w, "            return ;;")
+	}
+	if pattern := valueFlagPattern(flags, func(f flagInfo) bool { return !f.isFile && !f.dynamic }); pattern != "" {
+		fmt.Fprintf(w, "        %s)\n", pattern)
+		fmt.Fprintln(w, "            return ;;")
+	}
+	fmt.Fprintln(w, `    esac`)
+	fmt.Fprintln(w, `    if [[ "$cur" == -* ]]; then`)
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shellQuote(strings.Join(names, " ")))
+	fmt.Fprintln(w, `        return`)
+	fmt.Fprintln(w, `    fi`)
+	fmt.Fprintln(w, `    local i skip=0`)
+	fmt.Fprintln(w, `    for ((i = 1; i < COMP_CWORD; i++)); do`)
+	fmt.Fprintln(w, `        if ((skip)); then skip=0; continue; fi`)
+	fmt.Fprintln(w, `        case "${COMP_WORDS[i]}" in`)
+	if pattern := valueFlagPattern(flags, func(flagInfo) bool { return true }); pattern != "" {
+		fmt.Fprintf(w, "            %s) skip=1 ;;\n", pattern)
+	}
+	fmt.Fprintln(w, `            -*) ;;`)
+	fmt.Fprintln(w, `            *) return ;; # Command already given; arguments are free-form.`)
+	fmt.Fprintln(w, `        esac`)
+	fmt.Fprintln(w, `    done`)
+	fmt.Fprintf(w, "    COMPREPLY=($(compgen -W \"$(%s %s commands 2>/dev/null | cut -f1)\" -- \"$cur\"))\n", s.Program, ListArg)
+	fmt.Fprintln(w, "}")
+	fmt.Fprintf(w, "complete -F %s %s\n", fn, s.Program)
+}
+
+func (s *Spec) writeZsh(w io.Writer) {
+	fn := s.functionName()
+	fmt.Fprintf(w, "#compdef %s\n", s.Program)
+	fmt.Fprintf(w, "# zsh completion for %s. Load with: source <(%s completion zsh)\n", s.Program, s.Program)
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintln(w, `    local state line`)
+	fmt.Fprintln(w, `    local -a commands values`)
+	fmt.Fprintln(w, `    _arguments -S \`)
+	for _, f := range s.flags() {
+		spec := fmt.Sprintf("-%s[%s]", f.name, zshEscape(f.help))
+		switch {
+		case f.isBool:
+		case f.dynamic:
+			spec += ":value:->flag-" + f.name
+		case f.isFile:
+			spec += ":file:_files"
+		default:
+			spec += ":value: "
+		}
+		fmt.Fprintf(w, "        %s \\\n", shellQuote(spec))
+	}
+	fmt.Fprintln(w, `        '1:command:->command' \`)
+	fmt.Fprintln(w, `        '*::argument:->argument'`)
+	fmt.Fprintln(w, `    case "$state" in`)
+	fmt.Fprintln(w, `        command)`)
+	fmt.Fprintf(w, "            commands=(${(f)\"$(%s %s commands 2>/dev/null)\"})\n", s.Program, ListArg)
+	fmt.Fprintln(w, `            commands=(${commands/$'\t'/:})`)
+	fmt.Fprintln(w, `            _describe -t commands command commands ;;`)
+	fmt.Fprintln(w, `        flag-*)`)
+	fmt.Fprintf(w, "            values=(${(f)\"$(%s %s flag ${state#flag-} 2>/dev/null)\"})\n", s.Program, ListArg)
+	fmt.Fprintln(w, `            compadd -a values ;;`)
+	fmt.Fprintln(w, `    esac`)
+	fmt.Fprintln(w, "}")
+	fmt.Fprintf(w, "compdef %s %s\n", fn, s.Program)
+}
+
+func (s *Spec) writeFish(w io.Writer) {
+	flags := s.flags()
+	fn := "_" + s.functionName() + "_needs_command"
+	fmt.Fprintf(w, "# fish completion for %s. Load with: %s completion fish | source\n", s.Program, s.Program)
+	fmt.Fprintf(w, "function %s\n", fn)
+	fmt.Fprintln(w, `    set -l tokens (commandline -opc)`)
+	fmt.Fprintln(w, `    set -e tokens[1]`)
+	fmt.Fprintln(w, `    set -l skip 0`)
+	fmt.Fprintln(w, `    for token in $tokens`)
+	fmt.Fprintln(w, `        if test $skip -eq 1`)
+	fmt.Fprintln(w, `            set skip 0`)
+	fmt.Fprintln(w, `            continue`)
+	fmt.Fprintln(w, `        end`)
+	fmt.Fprintln(w, `        switch $token`)
+	if pattern := valueFlagPattern(flags, func(flagInfo) bool { return true }); pattern != "" {
+		fmt.Fprintf(w, "            case %s\n", strings.ReplaceAll(pattern, "|", " "))
+		fmt.Fprintln(w, `                set skip 1`)
+	}
+	fmt.Fprintln(w, `            case '-*'`)
+	fmt.Fprintln(w, `            case '*'`)
+	fmt.Fprintln(w, `                return 1`)
+	fmt.Fprintln(w, `        end`)
+	fmt.Fprintln(w, `    end`)
+	fmt.Fprintln(w, `    return 0`)
+	fmt.Fprintln(w, "end")
+	fmt.Fprintf(w, "complete -c %s -f\n", s.Program)
+	for _, f := range flags {
+		line := fmt.Sprintf("complete -c %s -o %s -d %s", s.Program, f.name, shellQuote(f.help))
+		switch {
+		case f.isBool:
+		case f.dynamic:
+			line += fmt.Sprintf(" -x -a '(%s %s flag %s 2>/dev/null)'", s.Program, ListArg, f.name)
+		case f.isFile:
+			line += " -r -F"
+		default:
+			line += " -x"
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "complete -c %s -n %s -a '(%s %s commands 2>/dev/null)'\n", s.Program, fn, s.Program, ListArg)
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// shellQuote single-quotes s for bash, zsh, and fish.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// zshEscape escapes characters that are special inside an _arguments description.
+func zshEscape(s string) string {
+	return strings.NewReplacer("[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
@@ -0,0 +1,76 @@
+package completion
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func testSpec() *Spec {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Bool("debug", false, "Enable debugging")
+	flags.String("key-file", "", "A `file` containing private key")
+	flags.String("key-name", "", "Keyring `name` for private key")
+	flags.String("vin", "", "Vehicle Identification Number")
+	return &Spec{
+		Program: "test-tool",
+		Flags:   flags,
+		Commands: func() []Command {
+			return []Command{
+				{Name: "charging-stop", Help: "Stop charging"},
+				{Name: "charging-set-limit", Args: "PERCENT", Help: "Set charge limit to PERCENT\nMore details"},
+			}
+		},
+		FlagValues: map[string]func() []string{
+			"key-name": func() []string { return []string{"fleet", "personal"} },
+		},
+	}
+}
+
+func TestListCommands(t *testing.T) {
+	var out bytes.Buffer
+	if err := testSpec().Run([]string{ListArg, "commands"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "charging-set-limit\tPERCENT - Set charge limit to PERCENT\ncharging-stop\tStop charging\n"
+	if out.String() != expected {
+		t.Errorf("Unexpected command list:\n%s", out.String())
+	}
+}
+
+func TestListFlagValues(t *testing.T) {
+	var out bytes.Buffer
+	if err := testSpec().Run([]string{ListArg, "flag", "key-name"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "fleet\npersonal\n" {
+		t.Errorf("Unexpected key names: %q", out.String())
+	}
+	out.Reset()
+	if err := testSpec().Run([]string{ListArg, "flag", "vin"}, &out); err != nil || out.Len() != 0 {
+		t.Errorf("Expected no values for vin, got %q (%v)", out.String(), err)
+	}
+}
+
+func TestScripts(t *testing.T) {
+	for _, shell := range []string{ShellBash, ShellZsh, ShellFish} {
+		var out bytes.Buffer
+		if err := testSpec().Run([]string{"completion", shell}, &out); err != nil {
+			t.Fatalf("Error generating %s script: %s", shell, err)
+		}
+		script := out.String()
+		for _, expected := range []string{"debug", "key-file", "test-tool __complete commands", "test-tool __complete flag "} {
+			if !strings.Contains(script, expected) {
+				t.Errorf("%s script doesn't contain %q", shell, expected)
+			}
+		}
+		if strings.Contains(script, "More details") {
+			t.Errorf("%s script contains more than the first line of help text", shell)
+		}
+	}
+	if err := testSpec().Run([]string{"completion", "powershell"}, &bytes.Buffer{}); !errors.Is(err, ErrUnknownShell) {
+		t.Errorf("Expected ErrUnknownShell, got %v", err)
+	}
+}
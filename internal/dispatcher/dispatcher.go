@@ -9,7 +9,8 @@ import (
 	"time"
 
 	"github.com/teslamotors/vehicle-command/internal/authentication"
-	"github.com/teslamotors/vehicle-command/internal/log"
+	logger "github.com/teslamotors/vehicle-command/internal/log"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
 	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 
@@ -18,12 +19,15 @@ import (
 	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
 )
 
+var log = logger.Module(logger.ModuleDispatcher)
+
 // Dispatcher objects send (encrypted) messages to a vehicle and route incoming messages to the
 // appropriate receiver object.
 type Dispatcher struct {
 	conn       connector.Connector
 	privateKey authentication.ECDHPrivateKey
 	address    []byte
+	clock      clock.Clock
 
 	latencyLock sync.Mutex
 	maxLatency  time.Duration
@@ -39,10 +43,22 @@ type Dispatcher struct {
 	handlers    map[receiverKey]*receiver
 }
 
+// Option configures a Dispatcher created by New.
+type Option func(*Dispatcher)
+
+// WithClock makes the dispatcher use c instead of the system clock to time retries and to expire
+// stale session info.
+func WithClock(c clock.Clock) Option {
+	return func(d *Dispatcher) {
+		d.clock = c
+	}
+}
+
 // New creates a Dispatcher from a Connector.
-func New(conn connector.Connector, privateKey authentication.ECDHPrivateKey) (*Dispatcher, error) {
+func New(conn connector.Connector, privateKey authentication.ECDHPrivateKey, options ...Option) (*Dispatcher, error) {
 	dispatcher := Dispatcher{
 		conn:       conn,
+		clock:      clock.Real,
 		maxLatency: conn.AllowedLatency(),
 		address:    make([]byte, addressLength),
 		sessions:   make(map[universal.Domain]*session),
@@ -50,6 +66,9 @@ func New(conn connector.Connector, privateKey authentication.ECDHPrivateKey) (*D
 		privateKey: privateKey,
 		done:       make(chan bool),
 	}
+	for _, option := range options {
+		option(&dispatcher)
+	}
 	if _, err := rand.Read(dispatcher.address); err != nil {
 		return nil, err
 	}
@@ -99,13 +118,15 @@ func (d *Dispatcher) tryStartSession(ctx context.Context, s *session, domain uni
 		return false, err
 	}
 	defer recv.Close()
+	retryTimer := d.clock.NewTimer(d.RetryInterval())
+	defer retryTimer.Stop()
 	// Request sent
 	select {
 	case <-ctx.Done():
 		return false, ctx.Err()
 	case <-s.readySignal:
 		return false, nil
-	case <-time.After(d.RetryInterval()):
+	case <-retryTimer.C():
 		return true, nil
 	case reply := <-recv.Recv():
 		if err = protocol.GetError(reply); err != nil {
@@ -114,52 +135,129 @@ func (d *Dispatcher) tryStartSession(ctx context.Context, s *session, domain uni
 	}
 	// Reply received. Normally, the dispatcher will clear readySignal after processing the reply;
 	// the other branches handle malformed vehicle responses.
+	retryTimer.Reset(d.RetryInterval())
 	select {
 	case <-s.readySignal:
 		return false, nil
 	case <-ctx.Done():
 		return false, ctx.Err()
-	case <-time.After(d.RetryInterval()):
+	case <-retryTimer.C():
 		return true, nil
 	}
 }
 
+// HasSession returns true if d has completed a handshake with domain (or loaded one from a cache),
+// so that authenticated messages can be sent to it.
+func (d *Dispatcher) HasSession(domain universal.Domain) bool {
+	d.sessionLock.Lock()
+	defer d.sessionLock.Unlock()
+	session, ok := d.sessions[domain]
+	if !ok {
+		return false
+	}
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	return session.ready
+}
+
+// ResyncSession performs a new handshake with domain, replacing the session's clock and anti-replay
+// counter with the vehicle's. Unlike StartSession, it contacts the vehicle even if the session is
+// already established (for example, from a cache).
+func (d *Dispatcher) ResyncSession(ctx context.Context, domain universal.Domain) error {
+	d.sessionLock.Lock()
+	s, ok := d.sessions[domain]
+	d.sessionLock.Unlock()
+	if !ok || s == nil || s.ctx == nil {
+		return d.StartSession(ctx, domain)
+	}
+	for {
+		recv, err := d.RequestSessionInfo(ctx, domain)
+		if err != nil {
+			return err
+		}
+		// The reply's session info is applied in process() before the reply is delivered here.
+		retryTimer := d.clock.NewTimer(d.RetryInterval())
+		select {
+		case reply := <-recv.Recv():
+			retryTimer.Stop()
+			recv.Close()
+			return protocol.GetError(reply)
+		case <-retryTimer.C():
+			recv.Close()
+		case <-ctx.Done():
+			retryTimer.Stop()
+			recv.Close()
+			return ctx.Err()
+		}
+	}
+}
+
+// ResyncSessions calls ResyncSession for each of domains concurrently. Errors are reported as by
+// StartSessions.
+func (d *Dispatcher) ResyncSessions(ctx context.Context, domains []universal.Domain) error {
+	return forEachDomain(ctx, domains, d.ResyncSession)
+}
+
 // StartSessions starts sessions with the provided vehicle domains (or all supported domains, if
-// domains is nil).
+// domains is nil). The handshakes run concurrently.
 //
-// If multiple connections fail, only returns the first error.
+// If a handshake fails, the others are canceled, and the error is returned once they've stopped.
+// If more than one handshake fails on its own, the error is a [protocol.HandshakeError] that lists
+// each domain's error.
 func (d *Dispatcher) StartSessions(ctx context.Context, domains []universal.Domain) error {
-	aggregateContext, cancel := context.WithCancel(ctx)
-	defer cancel()
-	results := make(chan error)
 	if domains == nil {
 		domains = []universal.Domain{
 			universal.Domain_DOMAIN_VEHICLE_SECURITY,
 			universal.Domain_DOMAIN_INFOTAINMENT,
 		}
 	}
+	return forEachDomain(ctx, domains, d.StartSession)
+}
+
+// forEachDomain calls handshake for each of domains concurrently, canceling the remaining calls
+// if one fails.
+func forEachDomain(ctx context.Context, domains []universal.Domain, handshake func(context.Context, universal.Domain) error) error {
+	aggregateContext, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan protocol.DomainError, len(domains))
 	for _, domain := range domains {
 		go func(dom universal.Domain) {
-			results <- d.StartSession(aggregateContext, dom)
+			results <- protocol.DomainError{Domain: dom, Err: handshake(aggregateContext, dom)}
 		}(domain)
 	}
+	var failures []protocol.DomainError
 	var err error
 	for i := 0; i < len(domains); i++ {
-		err = <-results
-		// The aggregateContext is canceled if one of the handshakes fails. We don't want to return
-		// the Canceled error if ErrProtocolNotSupported is present.
-		if err != nil && !errors.Is(err, context.Canceled) {
-			return err
+		result := <-results
+		if result.Err == nil {
+			continue
+		}
+		// The aggregateContext is canceled if one of the handshakes fails, and handshakes fail
+		// together when ctx expires. Neither is a failure of the domain; we don't want to return
+		// Canceled if ErrProtocolNotSupported is present.
+		if errors.Is(result.Err, context.Canceled) || (ctx.Err() != nil && errors.Is(result.Err, ctx.Err())) {
+			if err == nil {
+				err = result.Err
+			}
+			continue
 		}
+		failures = append(failures, result)
+		cancel()
 	}
-	return err
+	switch len(failures) {
+	case 0:
+		return err
+	case 1:
+		return failures[0].Err
+	}
+	return &protocol.HandshakeError{Failures: failures}
 }
 
 func (d *Dispatcher) createHandler(key *receiverKey, id []byte) *receiver {
 	d.handlerLock.Lock()
 	defer d.handlerLock.Unlock()
 
-	now := time.Now()
+	now := d.clock.Now()
 	recv := &receiver{
 		key:           key,
 		ch:            make(chan *universal.RoutableMessage, receiverBufferSize),
@@ -425,9 +523,11 @@ func (d *Dispatcher) Send(ctx context.Context, message *universal.RoutableMessag
 			log.Warning("No session available for %s", message.GetToDestination().GetDomain())
 			return nil, protocol.ErrNoSession
 		}
+		signingStart := time.Now()
 		if err := session.authorize(ctx, message, auth); err != nil {
 			return nil, err
 		}
+		connector.RecordTiming(ctx, func(t *connector.Timing) { t.Signing += time.Since(signingStart) })
 	}
 
 	resp := d.createHandler(&key, authentication.RequestID(message))
@@ -441,8 +541,14 @@ func (d *Dispatcher) Send(ctx context.Context, message *universal.RoutableMessag
 		}
 	}()
 
+	// Handshake messages are accounted for by the caller as part of the handshake.
+	handshake := message.GetSessionInfoRequest() != nil
 	for {
+		sendStart := time.Now()
 		err = d.conn.Send(ctx, encodedMessage)
+		if !handshake {
+			connector.RecordTiming(ctx, func(t *connector.Timing) { t.RoundTrip += time.Since(sendStart) })
+		}
 		if err == nil {
 			return resp, nil
 		}
@@ -451,10 +557,19 @@ func (d *Dispatcher) Send(ctx context.Context, message *universal.RoutableMessag
 			return nil, err
 		}
 		log.Debug("[%02x] Retrying transmission after error: %s", message.GetUuid(), err)
+		waitStart := time.Now()
+		retryTimer := d.clock.NewTimer(d.conn.RetryInterval())
 		select {
 		case <-ctx.Done():
+			retryTimer.Stop()
 			return nil, &protocol.CommandError{Err: ctx.Err(), PossibleSuccess: false, PossibleTemporary: true}
-		case <-time.After(d.conn.RetryInterval()):
+		case <-retryTimer.C():
+			if !handshake {
+				connector.RecordTiming(ctx, func(t *connector.Timing) {
+					t.Retries++
+					t.RetryWait += time.Since(waitStart)
+				})
+			}
 			continue
 		}
 	}
@@ -502,6 +617,8 @@ func (d *Dispatcher) Cache() []CacheEntry {
 			continue
 		}
 		entry := CacheEntry{
+			// Not d.clock: LoadCache derives the vehicle's clock from CreatedAt, and the session
+			// signs commands with timestamps from the system clock.
 			CreatedAt:   time.Now(),
 			Domain:      int(domain),
 			SessionInfo: encodedInfo,
@@ -513,7 +630,11 @@ func (d *Dispatcher) Cache() []CacheEntry {
 
 // LoadCache initializes or overwrites d's sessions. This allows resuming a session with a vehicle
 // without requiring a round trip.
-func (d *Dispatcher) LoadCache(entries []CacheEntry) error {
+//
+// Each session's counter is advanced by counterMargin. If the entries were saved before the last
+// few commands were sent (for example, because the process exited before it could persist its
+// sessions), restoring them as-is would reuse counter values the vehicle has already seen.
+func (d *Dispatcher) LoadCache(entries []CacheEntry, counterMargin uint32) error {
 	sessions := make(map[universal.Domain]*session)
 	for _, entry := range entries {
 		s, err := newSession(d.privateKey, d.conn.VIN())
@@ -522,10 +643,12 @@ func (d *Dispatcher) LoadCache(entries []CacheEntry) error {
 		if err != nil {
 			return fmt.Errorf("invalid cache: %s", err)
 		}
-		s.ctx, err = authentication.ImportSessionInfo(d.privateKey, []byte(d.conn.VIN()), entry.SessionInfo, entry.CreatedAt)
+		key := authentication.WithKeyUsage(d.privateKey, d.conn.VIN(), authentication.KeyPurposeSessionResume)
+		s.ctx, err = authentication.ImportSessionInfo(key, []byte(d.conn.VIN()), entry.SessionInfo, entry.CreatedAt)
 		if err != nil {
 			return fmt.Errorf("invalid cache: %s", err)
 		}
+		s.ctx.SkipCounter(counterMargin)
 		sessions[universal.Domain(entry.Domain)] = s
 	}
 
@@ -9,8 +9,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/teslamotors/vehicle-command/pkg/clock"
 	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/redact"
 
 	"google.golang.org/protobuf/proto"
 
@@ -92,9 +94,14 @@ type dummyConnector struct {
 	keys        map[universal.Domain]authentication.ECDHPrivateKey
 	dropReplies bool
 	AckRequests bool
+
+	// domainErrors holds errors that Send returns for messages to each domain.
+	domainErrors map[universal.Domain]error
+
+	retryInterval time.Duration
 }
 
-func newDummyConnector(t *testing.T) *dummyConnector {
+func newDummyConnector(t testing.TB) *dummyConnector {
 	t.Helper()
 	conn := dummyConnector{
 		callback:    handleSessionInfoRequests,
@@ -103,6 +110,8 @@ func newDummyConnector(t *testing.T) *dummyConnector {
 		keys:        make(map[universal.Domain]authentication.ECDHPrivateKey),
 		dropReplies: false,
 		AckRequests: true,
+
+		retryInterval: time.Millisecond,
 	}
 	return &conn
 }
@@ -142,7 +151,7 @@ func (d *dummyConnector) AllowedLatency() time.Duration {
 }
 
 func (d *dummyConnector) RetryInterval() time.Duration {
-	return time.Millisecond
+	return d.retryInterval
 }
 
 func (d *dummyConnector) EnqueueReply(t *testing.T, response []byte) {
@@ -226,6 +235,24 @@ func handleSessionInfoRequests(d *dummyConnector, message *universal.RoutableMes
 	return encoded, true
 }
 
+// withLatency returns a callback that replies to each message as callback does, but only after
+// latency has elapsed. Messages are answered concurrently, like a vehicle's domains answer them.
+func withLatency(latency time.Duration, callback func(*dummyConnector, *universal.RoutableMessage) ([]byte, bool)) func(*dummyConnector, *universal.RoutableMessage) ([]byte, bool) {
+	return func(d *dummyConnector, message *universal.RoutableMessage) ([]byte, bool) {
+		time.AfterFunc(latency, func() {
+			d.lock.Lock()
+			defer d.lock.Unlock()
+			if d.dropReplies {
+				return
+			}
+			if responseBytes, shouldSend := callback(d, message); shouldSend {
+				d.outbox <- responseBytes
+			}
+		})
+		return nil, false
+	}
+}
+
 func (d *dummyConnector) handleAsync(message *universal.RoutableMessage) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
@@ -254,11 +281,15 @@ func (d *dummyConnector) Send(_ context.Context, buffer []byte) error {
 	if !d.AckRequests {
 		return errTimeout
 	}
-	if len(d.errorQueue) > 0 {
-		d.lock.Lock()
-		err := d.errorQueue[0]
+	d.lock.Lock()
+	var err error
+	queued := len(d.errorQueue) > 0
+	if queued {
+		err = d.errorQueue[0]
 		d.errorQueue = d.errorQueue[1:]
-		d.lock.Unlock()
+	}
+	d.lock.Unlock()
+	if queued {
 		if err == errDropMessage {
 			return nil
 		} else if err != nil {
@@ -268,6 +299,9 @@ func (d *dummyConnector) Send(_ context.Context, buffer []byte) error {
 	if err := proto.Unmarshal(buffer, &message); err != nil {
 		return err
 	}
+	if err := d.domainErrors[message.GetToDestination().GetDomain()]; err != nil {
+		return err
+	}
 	go d.handleAsync(&message)
 	return nil
 }
@@ -300,7 +334,7 @@ func TestSendWithoutSession(t *testing.T) {
 }
 
 // getTestSetup creates and returns a Dispatcher and associated dummyConnector. This function launches the dispatcher's Listen goroutine, and the caller must Close() the returned dummyConnector.
-func getTestSetup(t *testing.T) (*Dispatcher, *dummyConnector) {
+func getTestSetup(t *testing.T, options ...Option) (*Dispatcher, *dummyConnector) {
 	t.Helper()
 	conn := newDummyConnector(t)
 
@@ -308,7 +342,7 @@ func getTestSetup(t *testing.T) (*Dispatcher, *dummyConnector) {
 	if err != nil {
 		t.Fatalf("Couldn't create private key: %s", err)
 	}
-	dispatcher, err := New(conn, key)
+	dispatcher, err := New(conn, key, options...)
 	if err != nil {
 		t.Fatalf("Couldn't initialize dispatcher: %s", err)
 	}
@@ -694,9 +728,166 @@ func TestWaitForAllSessions(t *testing.T) {
 	}
 }
 
+// startDispatcher returns a Dispatcher that's listening to conn, without any sessions.
+func startDispatcher(t testing.TB, conn *dummyConnector) *Dispatcher {
+	t.Helper()
+	key, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Couldn't create private key: %s", err)
+	}
+	dispatcher, err := New(conn, key)
+	if err != nil {
+		t.Fatalf("Couldn't initialize dispatcher: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), quiescentDelay)
+	defer cancel()
+	if err := dispatcher.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return dispatcher
+}
+
+func TestConcurrentHandshakes(t *testing.T) {
+	const latency = 150 * time.Millisecond
+	conn := newDummyConnector(t)
+	defer conn.Close()
+	conn.retryInterval = time.Second
+	conn.callback = withLatency(latency, handleSessionInfoRequests)
+	dispatcher := startDispatcher(t, conn)
+	defer dispatcher.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*latency)
+	defer cancel()
+
+	start := time.Now()
+	if err := dispatcher.StartSessions(ctx, nil); err != nil {
+		t.Fatalf("Couldn't start sessions: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 2*latency {
+		t.Errorf("Handshakes took %s, expected them to overlap", elapsed)
+	}
+
+	domains := []universal.Domain{universal.Domain_DOMAIN_VEHICLE_SECURITY, universal.Domain_DOMAIN_INFOTAINMENT}
+	start = time.Now()
+	if err := dispatcher.ResyncSessions(ctx, domains); err != nil {
+		t.Fatalf("Couldn't resync sessions: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 2*latency {
+		t.Errorf("Resyncs took %s, expected them to overlap", elapsed)
+	}
+	for _, domain := range domains {
+		if !dispatcher.HasSession(domain) {
+			t.Errorf("No session with %s", domain)
+		}
+	}
+}
+
+func TestHandshakeErrors(t *testing.T) {
+	const latency = time.Second
+	errInfotainment := errors.New("infotainment unreachable")
+	conn := newDummyConnector(t)
+	defer conn.Close()
+	conn.retryInterval = time.Second
+	conn.callback = withLatency(latency, handleSessionInfoRequests)
+	conn.domainErrors = map[universal.Domain]error{
+		universal.Domain_DOMAIN_VEHICLE_SECURITY: protocol.ErrKeyNotPaired,
+	}
+	dispatcher := startDispatcher(t, conn)
+	defer dispatcher.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*latency)
+	defer cancel()
+
+	// A single failure is returned as is, and the other handshake is abandoned.
+	start := time.Now()
+	if err := dispatcher.StartSessions(ctx, nil); err != protocol.ErrKeyNotPaired {
+		t.Errorf("Expected key not paired but got %s", err)
+	}
+	if elapsed := time.Since(start); elapsed >= latency {
+		t.Errorf("Failure took %s to report, expected it before the other handshake finished", elapsed)
+	}
+
+	// If both domains fail, each of their errors is reported.
+	conn.domainErrors[universal.Domain_DOMAIN_INFOTAINMENT] = errInfotainment
+	err := dispatcher.StartSessions(ctx, nil)
+	var handshakeErr *protocol.HandshakeError
+	if !errors.As(err, &handshakeErr) || len(handshakeErr.Failures) != 2 {
+		t.Fatalf("Expected a HandshakeError with two failures but got %v", err)
+	}
+	for _, failure := range handshakeErr.Failures {
+		if failure.Err != conn.domainErrors[failure.Domain] {
+			t.Errorf("Unexpected error for %s: %s", failure.Domain, failure.Err)
+		}
+	}
+	if failures := handshakeErr.Failures; failures[0].Domain == failures[1].Domain {
+		t.Errorf("Expected an error for each domain but got %s", err)
+	}
+	if !errors.Is(err, protocol.ErrKeyNotPaired) || !errors.Is(err, errInfotainment) {
+		t.Errorf("Unexpected error chain: %s", err)
+	}
+	if protocol.ShouldRetry(err) {
+		t.Errorf("Expected %s to be permanent", err)
+	}
+}
+
+// benchmarkHandshakes measures how long handshake takes to establish sessions with a vehicle that
+// takes latency to answer each handshake.
+func benchmarkHandshakes(b *testing.B, latency time.Duration, handshake func(context.Context, *Dispatcher) error) {
+	ctx := context.Background()
+	b.StopTimer()
+	for i := 0; i < b.N; i++ {
+		conn := newDummyConnector(b)
+		conn.retryInterval = time.Second
+		conn.callback = withLatency(latency, handleSessionInfoRequests)
+		dispatcher := startDispatcher(b, conn)
+		b.StartTimer()
+		if err := handshake(ctx, dispatcher); err != nil {
+			b.Fatalf("Couldn't start sessions: %s", err)
+		}
+		b.StopTimer()
+		dispatcher.Stop()
+		conn.Close()
+	}
+}
+
+func BenchmarkStartSessions(b *testing.B) {
+	const latency = 10 * time.Millisecond
+	domains := []universal.Domain{universal.Domain_DOMAIN_VEHICLE_SECURITY, universal.Domain_DOMAIN_INFOTAINMENT}
+	b.Run("Sequential", func(b *testing.B) {
+		benchmarkHandshakes(b, latency, func(ctx context.Context, dispatcher *Dispatcher) error {
+			for _, domain := range domains {
+				if err := dispatcher.StartSession(ctx, domain); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	b.Run("Concurrent", func(b *testing.B) {
+		benchmarkHandshakes(b, latency, func(ctx context.Context, dispatcher *Dispatcher) error {
+			return dispatcher.StartSessions(ctx, domains)
+		})
+	})
+}
+
+// sendAsync calls dispatcher.Send in a new goroutine and returns a channel that receives its error.
+func sendAsync(ctx context.Context, dispatcher *Dispatcher, message *universal.RoutableMessage) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		rsp, err := dispatcher.Send(ctx, message, connector.AuthMethodNone)
+		if err == nil {
+			rsp.Close()
+		}
+		result <- err
+	}()
+	return result
+}
+
 func TestRetrySend(t *testing.T) {
-	dispatcher, conn := getTestSetup(t)
+	fakeClock := clock.NewFake(time.Unix(1700000000, 0))
+	dispatcher, conn := getTestSetup(t, WithClock(fakeClock))
 	defer conn.Close()
+	conn.retryInterval = time.Second
 
 	const errCount = 3
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
@@ -708,33 +899,31 @@ func TestRetrySend(t *testing.T) {
 	errFoo := errors.New("not enough pylons")
 	conn.EnqueueSendError(&protocol.CommandError{Err: errFoo, PossibleSuccess: true, PossibleTemporary: true})
 
-	req := testCommand()
-	rsp, err := dispatcher.Send(ctx, req, connector.AuthMethodNone)
-	if err == nil {
-		rsp.Close()
+	result := sendAsync(ctx, dispatcher, testCommand())
+	for i := 0; i < errCount; i++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(conn.retryInterval)
 	}
-	if !errors.Is(err, errFoo) {
+	if err := <-result; !errors.Is(err, errFoo) {
 		t.Errorf("Unexpected error: %s", err)
 	}
 }
 
 func TestSendTimeout(t *testing.T) {
-	dispatcher, conn := getTestSetup(t)
+	// The fake clock never advances, so the context expires while Send waits to retry.
+	dispatcher, conn := getTestSetup(t, WithClock(clock.NewFake(time.Unix(1700000000, 0))))
 	defer conn.Close()
+	conn.retryInterval = time.Second
 
 	const errCount = 50
-	ctx, cancel := context.WithTimeout(context.Background(), dispatcher.RetryInterval()/2)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
 	defer cancel()
 
 	for i := 0; i < errCount; i++ {
 		conn.EnqueueSendError(&protocol.CommandError{Err: errTimeout, PossibleSuccess: false, PossibleTemporary: true})
 	}
 
-	req := testCommand()
-	rsp, err := dispatcher.Send(ctx, req, connector.AuthMethodNone)
-	if err == nil {
-		rsp.Close()
-	}
+	err := <-sendAsync(ctx, dispatcher, testCommand())
 	if !errors.Is(err, context.DeadlineExceeded) {
 		t.Errorf("Unexpected error: %s", err)
 	}
@@ -941,7 +1130,9 @@ func TestRetryNonresponsive(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	dispatcher, err := New(conn, key)
+	fakeClock := clock.NewFake(time.Unix(1700000000, 0))
+	conn.retryInterval = time.Second
+	dispatcher, err := New(conn, key, WithClock(fakeClock))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -962,7 +1153,16 @@ func TestRetryNonresponsive(t *testing.T) {
 		return nil, false
 	}
 
-	if err := dispatcher.StartSession(ctx, testDomain); !errors.Is(err, context.Canceled) {
+	result := make(chan error, 1)
+	go func() {
+		result <- dispatcher.StartSession(ctx, testDomain)
+	}()
+	// Each retry interval that elapses without a reply triggers another request.
+	for i := 1; i < maxCallbacks; i++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(conn.retryInterval)
+	}
+	if err := <-result; !errors.Is(err, context.Canceled) {
 		t.Errorf("Expected key not paired but got %s", err)
 	}
 
@@ -1007,7 +1207,7 @@ func TestCache(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := dispatcher.LoadCache(cache); err != nil {
+	if err := dispatcher.LoadCache(cache, 0); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1029,3 +1229,97 @@ func TestCache(t *testing.T) {
 		t.Errorf("Timed out waiting for response")
 	}
 }
+
+func TestResyncSession(t *testing.T) {
+	dispatcher, conn := getTestSetup(t)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), quiescentDelay)
+	defer cancel()
+
+	if err := dispatcher.ResyncSession(ctx, testDomain); err != nil {
+		t.Fatalf("Couldn't resync session: %s", err)
+	}
+
+	conn.lock.Lock()
+	handshakes := 0
+	for _, message := range conn.inbox {
+		if message.GetSessionInfoRequest() != nil {
+			handshakes++
+		}
+	}
+	conn.lock.Unlock()
+	if handshakes != 2 {
+		t.Errorf("Expected a second handshake, but vehicle received %d", handshakes)
+	}
+
+	rsp, err := dispatcher.Send(ctx, testCommand(), connector.AuthMethodHMAC)
+	if err != nil {
+		t.Fatalf("Error sending command after resync: %s", err)
+	}
+	defer rsp.Close()
+	conn.EnqueueReply(t, encodeRoutableMessage(t, replyWithPayload(rsp, []byte("hello world"))))
+	select {
+	case message := <-rsp.Recv():
+		checkFault(t, message, universal.MessageFault_E_MESSAGEFAULT_ERROR_NONE)
+	case <-ctx.Done():
+		t.Errorf("Timed out waiting for response")
+	}
+}
+
+func TestKeyUsagePurposes(t *testing.T) {
+	key, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Couldn't create private key: %s", err)
+	}
+	var lock sync.Mutex
+	var usages []authentication.KeyUsage
+	observed := authentication.ObserveKeyUsage(key, authentication.KeyUsageFunc(func(usage authentication.KeyUsage) {
+		lock.Lock()
+		defer lock.Unlock()
+		usages = append(usages, usage)
+	}))
+	checkUsage := func(purpose authentication.KeyPurpose, vin string) {
+		t.Helper()
+		lock.Lock()
+		defer lock.Unlock()
+		if len(usages) != 1 {
+			t.Fatalf("Expected one key operation, got %+v", usages)
+		}
+		usage := usages[0]
+		if usage.Operation != authentication.KeyOperationECDH || usage.Purpose != purpose || usage.VINHash != redact.HashVIN(vin) || usage.Time.IsZero() {
+			t.Errorf("Unexpected key usage %+v", usage)
+		}
+		usages = nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), quiescentDelay)
+	defer cancel()
+
+	conn := newDummyConnector(t)
+	dispatcher, err := New(conn, observed)
+	if err != nil {
+		t.Fatalf("Couldn't initialize dispatcher: %s", err)
+	}
+	if err := dispatcher.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.StartSession(ctx, testDomain); err != nil {
+		t.Fatalf("Couldn't start session: %s", err)
+	}
+	checkUsage(authentication.KeyPurposeSessionHandshake, conn.VIN())
+	cache := dispatcher.Cache()
+	dispatcher.Stop()
+	conn.Close()
+
+	conn = newDummyConnector(t)
+	defer conn.Close()
+	dispatcher, err = New(conn, observed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dispatcher.LoadCache(cache, 0); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(authentication.KeyPurposeSessionResume, conn.VIN())
+}
@@ -120,7 +120,7 @@ func (s *session) processHello(challenge, info, tag []byte) error {
 
 	var err error
 	if s.ctx == nil {
-		s.ctx, err = authentication.NewAuthenticatedSigner(s.private, s.vin, challenge, info, tag)
+		s.ctx, err = authentication.NewAuthenticatedSigner(authentication.WithKeyUsage(s.private, string(s.vin), authentication.KeyPurposeSessionHandshake), s.vin, challenge, info, tag)
 		if err != nil {
 			return err
 		}
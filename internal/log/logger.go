@@ -1,5 +1,7 @@
 // Package log provides a global logger with configurable logging level. The intended use is for
 // development builds.
+//
+// VINs in log messages are replaced using the process-wide function installed in package redact.
 
 package log
 
@@ -8,6 +10,8 @@ import (
 	"os"
 	"sync"
 	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/redact"
 )
 
 type Level int
@@ -42,11 +46,20 @@ func logLevel() Level {
 	return globalLogLevel
 }
 
+func write(level Level, format string, a ...interface{}) {
+	msg := fmt.Sprintf("%s %s ", time.Now().Format(time.RFC3339), labels[level])
+	msg += redact.Text(fmt.Sprintf(format, a...))
+	fmt.Fprintln(os.Stderr, msg)
+}
+
+// forceLog writes a message regardless of the configured log level.
+func forceLog(level Level, format string, a ...interface{}) {
+	write(level, format, a...)
+}
+
 func log(level Level, format string, a ...interface{}) {
 	if level <= logLevel() {
-		msg := fmt.Sprintf("%s %s ", time.Now().Format(time.RFC3339), labels[level])
-		msg += fmt.Sprintf(format, a...)
-		fmt.Fprintln(os.Stderr, msg)
+		write(level, format, a...)
 	}
 }
 
@@ -0,0 +1,173 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// EnvModuleLevels is the environment variable used to override log levels for individual modules,
+// e.g. TESLA_LOG=proxy=debug,ble=warn,dispatcher=info.
+const EnvModuleLevels = "TESLA_LOG"
+
+// Names of the subsystems that accept per-module log levels.
+const (
+	ModuleBLE        = "ble"
+	ModuleCache      = "cache"
+	ModuleDispatcher = "dispatcher"
+	ModuleInet       = "inet"
+	ModuleProxy      = "proxy"
+	ModuleTelemetry  = "telemetry"
+	ModuleVehicle    = "vehicle"
+)
+
+var validModules = map[string]bool{
+	ModuleBLE:        true,
+	ModuleCache:      true,
+	ModuleDispatcher: true,
+	ModuleInet:       true,
+	ModuleProxy:      true,
+	ModuleTelemetry:  true,
+	ModuleVehicle:    true,
+}
+
+var moduleLevels = make(map[string]Level)
+
+var levelNames = map[string]Level{
+	"none":    LevelNone,
+	"off":     LevelNone,
+	"error":   LevelError,
+	"warn":    LevelWarning,
+	"warning": LevelWarning,
+	"info":    LevelInfo,
+	"debug":   LevelDebug,
+}
+
+// Modules returns the sorted list of module names accepted by SetModuleLevels.
+func Modules() []string {
+	names := make([]string, 0, len(validModules))
+	for name := range validModules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseLevel converts a level name (none, error, warn, info, or debug) into a Level.
+func ParseLevel(name string) (Level, error) {
+	level, ok := levelNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return LevelNone, fmt.Errorf("unrecognized log level '%s'", name)
+	}
+	return level, nil
+}
+
+// SetModuleLevel overrides the global log level for a single module.
+func SetModuleLevel(module string, level Level) {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+	moduleLevels[module] = level
+}
+
+// ClearModuleLevels removes all per-module overrides.
+func ClearModuleLevels() {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+	moduleLevels = make(map[string]Level)
+}
+
+// SetModuleLevels applies a comma-separated list of module=level pairs. Entries for known modules
+// are applied even if other entries are invalid. The names of unrecognized modules are returned
+// so that the caller can warn about them; malformed entries result in an error.
+func SetModuleLevels(spec string) (unknown []string, err error) {
+	var errs []string
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		module, levelName, ok := strings.Cut(entry, "=")
+		if !ok {
+			errs = append(errs, fmt.Sprintf("expected module=level but got '%s'", entry))
+			continue
+		}
+		module = strings.ToLower(strings.TrimSpace(module))
+		level, parseErr := ParseLevel(levelName)
+		if parseErr != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", module, parseErr))
+			continue
+		}
+		if !validModules[module] {
+			unknown = append(unknown, module)
+			continue
+		}
+		SetModuleLevel(module, level)
+	}
+	if len(errs) > 0 {
+		err = fmt.Errorf("invalid %s value: %s", EnvModuleLevels, strings.Join(errs, "; "))
+	}
+	return unknown, err
+}
+
+// ConfigureFromEnvironment applies per-module levels from the TESLA_LOG environment variable. Problems
+// with the variable are reported on stderr regardless of the configured log level, since they are
+// otherwise easy to miss.
+func ConfigureFromEnvironment() {
+	spec, ok := os.LookupEnv(EnvModuleLevels)
+	if !ok {
+		return
+	}
+	unknown, err := SetModuleLevels(spec)
+	for _, module := range unknown {
+		forceLog(LevelWarning, "Ignoring unknown log module '%s' in %s; valid modules are: %s",
+			module, EnvModuleLevels, strings.Join(Modules(), ", "))
+	}
+	if err != nil {
+		forceLog(LevelWarning, "%s", err)
+	}
+}
+
+// Logger writes messages on behalf of a single module. Its level can be set independently of the
+// global level using SetModuleLevel; otherwise it inherits the global level.
+type Logger struct {
+	module string
+}
+
+// Module returns a Logger for the named module.
+func Module(name string) *Logger {
+	return &Logger{module: name}
+}
+
+func (l *Logger) level() Level {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+	if level, ok := moduleLevels[l.module]; ok {
+		return level
+	}
+	return globalLogLevel
+}
+
+// Enabled returns true if messages at level would be written. Use it to skip expensive formatting.
+func (l *Logger) Enabled(level Level) bool {
+	return level <= l.level()
+}
+
+func (l *Logger) log(level Level, format string, a ...interface{}) {
+	if level <= l.level() {
+		write(level, format, a...)
+	}
+}
+
+func (l *Logger) Debug(format string, a ...interface{}) {
+	l.log(LevelDebug, format, a...)
+}
+func (l *Logger) Info(format string, a ...interface{}) {
+	l.log(LevelInfo, format, a...)
+}
+func (l *Logger) Warning(format string, a ...interface{}) {
+	l.log(LevelWarning, format, a...)
+}
+func (l *Logger) Error(format string, a ...interface{}) {
+	l.log(LevelError, format, a...)
+}
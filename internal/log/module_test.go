@@ -0,0 +1,52 @@
+package log
+
+import (
+	"testing"
+)
+
+func TestSetModuleLevels(t *testing.T) {
+	defer ClearModuleLevels()
+
+	unknown, err := SetModuleLevels("proxy=debug, ble=warn,dispatcher=INFO,bogus=debug")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(unknown) != 1 || unknown[0] != "bogus" {
+		t.Errorf("Expected bogus to be reported as unknown, got %v", unknown)
+	}
+
+	expected := map[string]Level{
+		ModuleProxy:      LevelDebug,
+		ModuleBLE:        LevelWarning,
+		ModuleDispatcher: LevelInfo,
+	}
+	for module, level := range expected {
+		if got := Module(module).level(); got != level {
+			t.Errorf("Module %s has level %d, expected %d", module, got, level)
+		}
+	}
+}
+
+func TestModuleInheritsGlobalLevel(t *testing.T) {
+	defer ClearModuleLevels()
+	defer SetLevel(logLevel())
+
+	SetLevel(LevelInfo)
+	if got := Module(ModuleVehicle).level(); got != LevelInfo {
+		t.Errorf("Expected module to inherit global level, got %d", got)
+	}
+	SetModuleLevel(ModuleVehicle, LevelNone)
+	if got := Module(ModuleVehicle).level(); got != LevelNone {
+		t.Errorf("Expected module override to take effect, got %d", got)
+	}
+}
+
+func TestSetModuleLevelsMalformed(t *testing.T) {
+	defer ClearModuleLevels()
+
+	for _, spec := range []string{"proxy", "proxy=loud"} {
+		if _, err := SetModuleLevels(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Package profiling serves Go runtime profiles (see net/http/pprof) for the HTTP proxy binaries.
+//
+// Profiles expose memory contents and the command line, and some of them consume CPU on demand, so
+// they're served on a dedicated listener, never on a proxy's command port, and only to clients
+// that present a bearer token.
+package profiling
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strconv"
+)
+
+// NewServer returns a server for the profiling endpoints under /debug/pprof/ on addr. Clients must
+// send an "Authorization: Bearer" header with the token in tokenFile. The server may not share
+// proxyPort, the port that accepts vehicle commands.
+func NewServer(addr, tokenFile string, proxyPort int) (*http.Server, error) {
+	if tokenFile == "" {
+		return nil, errors.New("-pprof-addr requires -pprof-token-file")
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -pprof-addr: %w", err)
+	}
+	if port == strconv.Itoa(proxyPort) {
+		return nil, errors.New("-pprof-addr must not use the proxy's port")
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read pprof token: %w", err)
+	}
+	// Surrounding whitespace, such as a trailing newline, isn't part of the token.
+	token = bytes.TrimSpace(token)
+	if len(token) == 0 {
+		return nil, fmt.Errorf("pprof token file %s is empty", tokenFile)
+	}
+	return &http.Server{Addr: addr, Handler: Handler(token)}, nil
+}
+
+// Handler serves the profiling endpoints to requests with an "Authorization: Bearer" header that
+// contains token. Importing net/http/pprof also registers the endpoints on http.DefaultServeMux,
+// so servers that use this package must never serve the default mux.
+func Handler(token []byte) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	expected := append([]byte("Bearer "), token...)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pprof"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, req)
+	})
+}
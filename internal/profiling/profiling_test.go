@@ -0,0 +1,52 @@
+package profiling
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandlerRequiresToken(t *testing.T) {
+	handler := Handler([]byte("secret"))
+	for header, want := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("Authorization %q: expected %d, got %d", header, want, w.Code)
+		}
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewServer("localhost:6060", "", 443); err == nil {
+		t.Errorf("Expected error without token file")
+	}
+	if _, err := NewServer("localhost:443", tokenFile, 443); err == nil {
+		t.Errorf("Expected error when sharing the proxy's port")
+	}
+	if _, err := NewServer("localhost", tokenFile, 443); err == nil {
+		t.Errorf("Expected error for address without port")
+	}
+	server, err := NewServer("localhost:6060", tokenFile, 443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.Addr != "localhost:6060" {
+		t.Errorf("Unexpected address %s", server.Addr)
+	}
+}
@@ -0,0 +1,65 @@
+// Package proxyflags interprets the command-line settings shared by the HTTP proxy binaries, so
+// that tesla-http-proxy and tesla-http-proxy-insecure accept them in exactly the same way.
+package proxyflags
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ListenAddress returns the address a proxy listens on: listen if set, and otherwise host and
+// port. An empty host, or "::", listens on all IPv4 and IPv6 interfaces; 0.0.0.0 listens on IPv4
+// interfaces only.
+func ListenAddress(listen, host string, port int) (string, error) {
+	if listen == "" {
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		return net.JoinHostPort(host, strconv.Itoa(port)), nil
+	}
+	_, listenPort, err := net.SplitHostPort(listen)
+	if err != nil {
+		return "", fmt.Errorf("invalid listen address %s: %w", listen, err)
+	}
+	if _, err := strconv.ParseUint(listenPort, 10, 16); err != nil {
+		return "", fmt.Errorf("invalid port in listen address %s", listen)
+	}
+	return listen, nil
+}
+
+// Port returns the port number of addr, which has been validated by ListenAddress.
+func Port(addr string) int {
+	_, port, _ := net.SplitHostPort(addr)
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// IsLoopback returns true if addr only accepts connections from the local machine.
+func IsLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ReadSecret loads a key or token, such as the HMAC key used to sign callbacks, from filename.
+// Surrounding whitespace, such as a trailing newline, isn't part of the secret. The error messages
+// identify the secret by name.
+func ReadSecret(filename, name string) ([]byte, error) {
+	secret, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %s: %w", name, err)
+	}
+	secret = bytes.TrimSpace(secret)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%s file %s is empty", name, filename)
+	}
+	return secret, nil
+}
@@ -0,0 +1,63 @@
+package proxyflags
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		listen   string
+		host     string
+		port     int
+		addr     string
+		loopback bool
+	}{
+		{host: "localhost", port: 443, addr: "localhost:443", loopback: true},
+		{host: "::", port: 4443, addr: "[::]:4443"},
+		{host: "[::]", port: 4443, addr: "[::]:4443"},
+		{host: "0.0.0.0", port: 4443, addr: "0.0.0.0:4443"},
+		{host: "0.0.0.0", port: 443, listen: "[::1]:8443", addr: "[::1]:8443", loopback: true},
+	}
+	for _, test := range tests {
+		addr, err := ListenAddress(test.listen, test.host, test.port)
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %s", test, err)
+			continue
+		}
+		if addr != test.addr || IsLoopback(addr) != test.loopback {
+			t.Errorf("%+v: got %s (loopback %v)", test, addr, IsLoopback(addr))
+		}
+	}
+	if port := Port("[::1]:8443"); port != 8443 {
+		t.Errorf("Expected port 8443, got %d", port)
+	}
+	for _, listen := range []string{"::1:8443", "localhost", "localhost:http", "[::]:70000"} {
+		if _, err := ListenAddress(listen, "localhost", 443); err == nil {
+			t.Errorf("Expected error for listen address %s", listen)
+		}
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "token")
+	if err := os.WriteFile(filename, []byte("  secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := ReadSecret(filename, "admin token"); err != nil || string(secret) != "secret" {
+		t.Errorf("Expected secret without whitespace, got %q (%v)", secret, err)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{empty, filepath.Join(dir, "missing")} {
+		if _, err := ReadSecret(name, "admin token"); err == nil || !strings.Contains(err.Error(), "admin token") {
+			t.Errorf("%s: expected error naming the secret, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package units parses the temperatures, speeds, and times of day that tesla-control accepts on
+// its command line. Every command that takes one of these arguments uses this package, so they all
+// accept the same formats.
+//
+// Temperatures and speeds may carry an explicit unit ("21.5C", "70F", "65mph", "105kph"). Values
+// without one are interpreted in a [System], which defaults to the one customary in the user's
+// locale. Times of day may use a 24-hour ("18:30") or 12-hour ("6:30pm") clock.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+var (
+	ErrInvalidSystem      = errors.New("unrecognized unit system")
+	ErrInvalidTemperature = errors.New("invalid temperature")
+	ErrInvalidSpeed       = errors.New("invalid speed")
+	ErrInvalidTime        = errors.New("invalid time")
+)
+
+// EnvSystem is the environment variable that selects the default System, overriding the locale.
+const EnvSystem = "TESLA_UNITS"
+
+// kphPerMPH converts miles per hour to kilometers per hour.
+const kphPerMPH = 1.609344
+
+// System is the unit system used for values that don't specify a unit. It implements flag.Value.
+type System int
+
+const (
+	// Metric uses degrees Celsius and kilometers per hour.
+	Metric System = iota
+	// Imperial uses degrees Fahrenheit and miles per hour.
+	Imperial
+)
+
+func (s System) String() string {
+	if s == Imperial {
+		return "imperial"
+	}
+	return "metric"
+}
+
+// Set parses value, which must be "metric" or "imperial", into s.
+func (s *System) Set(value string) error {
+	system, err := ParseSystem(value)
+	if err != nil {
+		return err
+	}
+	*s = system
+	return nil
+}
+
+// ParseSystem converts "metric" or "imperial" (in any case) to a System.
+func ParseSystem(value string) (System, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "metric":
+		return Metric, nil
+	case "imperial":
+		return Imperial, nil
+	}
+	return Metric, fmt.Errorf("%w %q: expected metric or imperial", ErrInvalidSystem, value)
+}
+
+// TemperatureUnit returns "C" or "F".
+func (s System) TemperatureUnit() string {
+	if s == Imperial {
+		return "F"
+	}
+	return "C"
+}
+
+// DefaultSystem returns the System named by the TESLA_UNITS environment variable if it's valid.
+// Otherwise it returns the system customary in the locale given by LC_ALL, LC_MEASUREMENT, or
+// LANG: Imperial for the United States, Liberia, and Myanmar, and Metric elsewhere or if the
+// locale isn't set.
+func DefaultSystem() System {
+	return defaultSystem(os.Getenv)
+}
+
+func defaultSystem(getenv func(string) string) System {
+	if system, err := ParseSystem(getenv(EnvSystem)); err == nil {
+		return system
+	}
+	for _, name := range []string{"LC_ALL", "LC_MEASUREMENT", "LANG"} {
+		if locale := getenv(name); locale != "" {
+			return localeSystem(locale)
+		}
+	}
+	return Metric
+}
+
+// localeSystem returns the System customary in a POSIX locale such as "en_US.UTF-8".
+func localeSystem(locale string) System {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	_, territory, _ := strings.Cut(locale, "_")
+	switch strings.ToUpper(territory) {
+	case "US", "LR", "MM":
+		return Imperial
+	}
+	return Metric
+}
+
+// cutSuffix removes the first of suffixes that s ends with, ignoring case, and returns it in
+// lower case.
+func cutSuffix(s string, suffixes ...string) (string, string) {
+	for _, suffix := range suffixes {
+		if n := len(s) - len(suffix); n >= 0 && strings.EqualFold(s[n:], suffix) {
+			return strings.TrimSpace(s[:n]), suffix
+		}
+	}
+	return s, ""
+}
+
+// ParseTemperature parses a temperature such as "21.5C", "70F", or "21.5 °C" and returns it in
+// degrees Celsius. Temperatures without a unit are in system's unit.
+func ParseTemperature(s string, system System) (float32, error) {
+	value, suffix := cutSuffix(strings.TrimSpace(s), "°c", "°f", "c", "f")
+	unit := system.TemperatureUnit()
+	if suffix != "" {
+		unit = strings.ToUpper(strings.TrimPrefix(suffix, "°"))
+	}
+	degrees, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w %q: format as 21.5C or 70F", ErrInvalidTemperature, s)
+	}
+	if unit == "F" {
+		return vehicle.FahrenheitToCelsius(float32(degrees)), nil
+	}
+	return float32(degrees), nil
+}
+
+// FormatTemperature formats celsius in system's unit, to the precision the vehicle displays.
+func FormatTemperature(celsius float32, system System) string {
+	if system == Imperial {
+		return fmt.Sprintf("%.0f°F", vehicle.CelsiusToFahrenheit(celsius))
+	}
+	return fmt.Sprintf("%.1f°C", celsius)
+}
+
+// ParseSpeed parses a speed such as "65mph", "105kph", or "105 km/h" and returns it in miles per
+// hour. Speeds without a unit are in miles per hour if system is Imperial and kilometers per hour
+// otherwise.
+func ParseSpeed(s string, system System) (float64, error) {
+	value, suffix := cutSuffix(strings.TrimSpace(s), "mph", "kph", "km/h", "kmh")
+	speed, err := strconv.ParseFloat(value, 64)
+	if err != nil || speed < 0 {
+		return 0, fmt.Errorf("%w %q: format as 65mph or 105kph", ErrInvalidSpeed, s)
+	}
+	if suffix == "mph" || (suffix == "" && system == Imperial) {
+		return speed, nil
+	}
+	return speed / kphPerMPH, nil
+}
+
+// ParseTimeOfDay parses a time such as "18:30", "6:30pm", "6pm", or "12:15 AM" and returns the
+// number of minutes after midnight. 24-hour times must include minutes; 12-hour times may omit
+// them.
+func ParseTimeOfDay(s string) (int32, error) {
+	value, suffix := cutSuffix(strings.TrimSpace(s), "am", "pm")
+	hoursStr, minutesStr, hasMinutes := strings.Cut(value, ":")
+	if !hasMinutes && suffix == "" {
+		return 0, fmt.Errorf("%w %q: expected HH:MM or a 12-hour time such as 6:30pm", ErrInvalidTime, s)
+	}
+	hours, err := parseClockField(hoursStr)
+	if err != nil {
+		return 0, fmt.Errorf("%w %q: %s", ErrInvalidTime, s, err)
+	}
+	minutes := 0
+	if hasMinutes {
+		if minutes, err = parseClockField(minutesStr); err != nil {
+			return 0, fmt.Errorf("%w %q: %s", ErrInvalidTime, s, err)
+		}
+	}
+	if minutes > 59 {
+		return 0, fmt.Errorf("%w %q: minutes outside valid range", ErrInvalidTime, s)
+	}
+	switch suffix {
+	case "":
+		if hours > 23 {
+			return 0, fmt.Errorf("%w %q: hours outside valid range", ErrInvalidTime, s)
+		}
+	default:
+		if hours < 1 || hours > 12 {
+			return 0, fmt.Errorf("%w %q: 12-hour times must be between 1 and 12", ErrInvalidTime, s)
+		}
+		hours %= 12
+		if suffix == "pm" {
+			hours += 12
+		}
+	}
+	return int32(60*hours + minutes), nil
+}
+
+// parseClockField parses the hours or minutes of a time, which must be one or two digits.
+func parseClockField(field string) (int, error) {
+	if len(field) == 0 || len(field) > 2 {
+		return 0, errors.New("expected one or two digits")
+	}
+	for _, c := range field {
+		if c < '0' || c > '9' {
+			return 0, errors.New("expected one or two digits")
+		}
+	}
+	return strconv.Atoi(field)
+}
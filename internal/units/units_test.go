@@ -0,0 +1,175 @@
+package units
+
+import (
+	"errors"
+	"flag"
+	"math"
+	"testing"
+)
+
+func TestParseSystem(t *testing.T) {
+	tests := map[string]System{
+		"metric":    Metric,
+		"Metric":    Metric,
+		"IMPERIAL":  Imperial,
+		" imperial": Imperial,
+	}
+	for value, want := range tests {
+		if got, err := ParseSystem(value); err != nil || got != want {
+			t.Errorf("ParseSystem(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "si", "us", "celsius"} {
+		if _, err := ParseSystem(value); !errors.Is(err, ErrInvalidSystem) {
+			t.Errorf("ParseSystem(%q): expected ErrInvalidSystem, got %v", value, err)
+		}
+	}
+}
+
+func TestSystemFlag(t *testing.T) {
+	system := Metric
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Var(&system, "units", "")
+	if err := flags.Parse([]string{"-units", "imperial"}); err != nil || system != Imperial {
+		t.Errorf("Expected -units imperial to select Imperial, got %v (%v)", system, err)
+	}
+	if system.String() != "imperial" || Metric.String() != "metric" {
+		t.Errorf("Unexpected names %q and %q", system, Metric)
+	}
+	if err := system.Set("furlongs"); err == nil || system != Imperial {
+		t.Errorf("Expected invalid value to be rejected without changing the flag")
+	}
+}
+
+func TestDefaultSystem(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want System
+	}{
+		{map[string]string{}, Metric},
+		{map[string]string{"LANG": "en_US.UTF-8"}, Imperial},
+		{map[string]string{"LANG": "en_GB.UTF-8"}, Metric},
+		{map[string]string{"LANG": "C"}, Metric},
+		{map[string]string{"LANG": "POSIX"}, Metric},
+		{map[string]string{"LANG": "en_LR"}, Imperial},
+		{map[string]string{"LANG": "my_MM.UTF-8"}, Imperial},
+		{map[string]string{"LANG": "es_US@euro"}, Imperial},
+		{map[string]string{"LANG": "de_DE@euro"}, Metric},
+		// LC_MEASUREMENT takes precedence over LANG, and LC_ALL over both.
+		{map[string]string{"LANG": "en_US.UTF-8", "LC_MEASUREMENT": "en_CA.UTF-8"}, Metric},
+		{map[string]string{"LANG": "fr_FR", "LC_MEASUREMENT": "fr_FR", "LC_ALL": "en_US"}, Imperial},
+		// TESLA_UNITS overrides the locale, unless it's invalid.
+		{map[string]string{"LANG": "en_US.UTF-8", EnvSystem: "metric"}, Metric},
+		{map[string]string{"LANG": "de_DE", EnvSystem: "Imperial"}, Imperial},
+		{map[string]string{"LANG": "en_US", EnvSystem: "kelvin"}, Imperial},
+	}
+	for _, test := range tests {
+		getenv := func(name string) string { return test.env[name] }
+		if got := defaultSystem(getenv); got != test.want {
+			t.Errorf("defaultSystem(%v) = %v; want %v", test.env, got, test.want)
+		}
+	}
+}
+
+func TestParseTemperature(t *testing.T) {
+	tests := []struct {
+		value   string
+		system  System
+		celsius float32
+	}{
+		{"21.5", Metric, 21.5},
+		{"21.5C", Metric, 21.5},
+		{"21.5c", Imperial, 21.5},
+		{"21.5 °C", Imperial, 21.5},
+		{"21.5°c", Imperial, 21.5},
+		{"212F", Metric, 100},
+		{"212f", Metric, 100},
+		{"212 °F", Metric, 100},
+		{"32", Imperial, 0},
+		{"-40", Imperial, -40},
+		{"-40C", Imperial, -40},
+		{" 20 ", Metric, 20},
+	}
+	for _, test := range tests {
+		celsius, err := ParseTemperature(test.value, test.system)
+		if err != nil || celsius != test.celsius {
+			t.Errorf("ParseTemperature(%q, %v) = %v, %v; want %v", test.value, test.system, celsius, err, test.celsius)
+		}
+	}
+	for _, value := range []string{"", "C", "warm", "21.5K", "21.5CC", "F21", "21,5C"} {
+		if _, err := ParseTemperature(value, Metric); !errors.Is(err, ErrInvalidTemperature) {
+			t.Errorf("ParseTemperature(%q): expected ErrInvalidTemperature, got %v", value, err)
+		}
+	}
+}
+
+func TestFormatTemperature(t *testing.T) {
+	if got := FormatTemperature(21.5, Metric); got != "21.5°C" {
+		t.Errorf("Unexpected metric temperature %q", got)
+	}
+	if got := FormatTemperature(21.5, Imperial); got != "71°F" {
+		t.Errorf("Unexpected imperial temperature %q", got)
+	}
+}
+
+func TestParseSpeed(t *testing.T) {
+	tests := []struct {
+		value  string
+		system System
+		mph    float64
+	}{
+		{"65", Imperial, 65},
+		{"65mph", Metric, 65},
+		{"65 MPH", Metric, 65},
+		{"160.9344", Metric, 100},
+		{"160.9344kph", Imperial, 100},
+		{"160.9344 km/h", Imperial, 100},
+		{"160.9344KMH", Imperial, 100},
+		{"0", Metric, 0},
+	}
+	for _, test := range tests {
+		mph, err := ParseSpeed(test.value, test.system)
+		if err != nil || math.Abs(mph-test.mph) > 1e-9 {
+			t.Errorf("ParseSpeed(%q, %v) = %v, %v; want %v", test.value, test.system, mph, err, test.mph)
+		}
+	}
+	for _, value := range []string{"", "mph", "fast", "-10", "65 m/s", "65mphh"} {
+		if _, err := ParseSpeed(value, Imperial); !errors.Is(err, ErrInvalidSpeed) {
+			t.Errorf("ParseSpeed(%q): expected ErrInvalidSpeed, got %v", value, err)
+		}
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	tests := map[string]int32{
+		"0:00":     0,
+		"00:00":    0,
+		"3:03":     183,
+		"03:03":    183,
+		"23:40":    23*60 + 40,
+		"23:59":    23*60 + 59,
+		"12:00am":  0,
+		"12am":     0,
+		"12:30 AM": 30,
+		"1am":      60,
+		"3:40pm":   15*60 + 40,
+		"3:40 PM":  15*60 + 40,
+		"12pm":     12 * 60,
+		"12:59pm":  12*60 + 59,
+		"11:59pm":  23*60 + 59,
+		" 7:30 ":   7*60 + 30,
+	}
+	for value, want := range tests {
+		if got, err := ParseTimeOfDay(value); err != nil || got != want {
+			t.Errorf("ParseTimeOfDay(%q) = %d, %v; want %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{
+		"", "3", "3:", ":40", "25:40", "24:00", "23:60", "23:-01", "-2:00", "3:4:5", "003:00", "3:400",
+		"0am", "13pm", "0:30am", "12:60pm", "pm", "3:40xm", "3.40", "noon",
+	} {
+		if _, err := ParseTimeOfDay(value); !errors.Is(err, ErrInvalidTime) {
+			t.Errorf("ParseTimeOfDay(%q): expected ErrInvalidTime, got %v", value, err)
+		}
+	}
+}
@@ -0,0 +1,805 @@
+// Package vehicletest implements an in-memory vehicle for hermetic tests of code that sends
+// commands, such as the HTTP proxy.
+//
+// A Vehicle performs session handshakes, authenticates commands with the same code that verifies
+// them in tests of the signing library, and replies the way a vehicle would: acknowledgements
+// for commands it executes, and protocol faults or application-layer errors for commands it
+// rejects. Clients talk to it through the [connector.Connector] returned by [Vehicle.Connect].
+package vehicletest
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	verror "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/errors"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/signatures"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+)
+
+// ErrClosed is returned when sending on a closed connection.
+var ErrClosed = errors.New("vehicletest: connection closed")
+
+// Command records a message that the vehicle authenticated and executed.
+type Command struct {
+	Domain  universal.Domain
+	Payload []byte // Decrypted protobuf payload
+}
+
+type verifierKey struct {
+	domain    universal.Domain
+	publicKey string
+}
+
+// Vehicle simulates the VCSEC and infotainment domains of a vehicle.
+type Vehicle struct {
+	vin string
+
+	lock          sync.Mutex
+	domainKeys    map[universal.Domain]authentication.ECDHPrivateKey
+	roles         map[string]keys.Role
+	verifiers     map[verifierKey]*authentication.Verifier
+	counters      map[verifierKey]uint32
+	locked        bool
+	chargeLimit   int32
+	driverTemp    float32
+	passengerTemp float32
+	climateOn     bool
+	maxDefrost    bool
+	copMode       carserver.ClimateState_CabinOverheatProtection_E
+	copFanOnly    bool
+	departure     *carserver.ScheduledDepartureAction
+	speedLimit    SpeedLimit
+	stateAge      time.Duration
+	location      *carserver.LocationState
+	speed         float32
+	battery       *carserver.ChargeState
+	commands      []Command
+	commandError  string
+	actionError   string
+	rejectAction  func(*carserver.VehicleAction) bool
+	fault         universal.MessageFault_E
+	desyncs       int
+	handshakes    int
+	keyInfos      int
+	asleep        bool
+	wakes         int
+}
+
+// Charge limits reported by the simulated vehicle.
+const (
+	defaultChargeLimit  = 80
+	StandardChargeLimit = 90
+	MaxChargeLimit      = 100
+)
+
+// defaultSpeedLimitMPH is the Speed Limit Mode maximum speed until a client sets one.
+const defaultSpeedLimitMPH = 65
+
+// SpeedLimit is the state of the simulated vehicle's Speed Limit Mode.
+type SpeedLimit struct {
+	Active   bool
+	PIN      string // Empty if no PIN is set
+	LimitMPH float64
+}
+
+// Cabin temperature range, in degrees Celsius, reported by the simulated vehicle. Setpoints outside
+// of the range are clamped, and all setpoints are rounded to the nearest half degree.
+const (
+	defaultTemperature = 21
+	MinTemperature     = 15
+	MaxTemperature     = 28
+)
+
+// New returns a vehicle with an empty keychain. Use [Vehicle.Pair] to enroll client keys.
+func New(vin string) *Vehicle {
+	v := &Vehicle{
+		vin:           vin,
+		domainKeys:    make(map[universal.Domain]authentication.ECDHPrivateKey),
+		roles:         make(map[string]keys.Role),
+		verifiers:     make(map[verifierKey]*authentication.Verifier),
+		counters:      make(map[verifierKey]uint32),
+		locked:        true,
+		chargeLimit:   defaultChargeLimit,
+		driverTemp:    defaultTemperature,
+		passengerTemp: defaultTemperature,
+		speedLimit:    SpeedLimit{LimitMPH: defaultSpeedLimitMPH},
+	}
+	for _, domain := range []universal.Domain{universal.Domain_DOMAIN_VEHICLE_SECURITY, universal.Domain_DOMAIN_INFOTAINMENT} {
+		key, err := authentication.NewECDHPrivateKey(rand.Reader)
+		if err != nil {
+			panic(err)
+		}
+		v.domainKeys[domain] = key
+	}
+	return v
+}
+
+// VIN returns the vehicle's VIN.
+func (v *Vehicle) VIN() string {
+	return v.vin
+}
+
+// Pair adds publicKey to the vehicle's keychain with the given role.
+func (v *Vehicle) Pair(publicKey []byte, role keys.Role) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.roles[string(publicKey)] = role
+}
+
+// RejectCommands makes the vehicle refuse authenticated commands with an application-layer error
+// that includes reason, as it does when, for example, a command isn't valid in the vehicle's
+// current state. An empty reason restores normal behavior.
+func (v *Vehicle) RejectCommands(reason string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.commandError = reason
+}
+
+// RejectActions makes the vehicle refuse infotainment actions for which reject returns true, with
+// an application-layer error that includes reason. Other commands succeed. A nil reject restores
+// normal behavior.
+func (v *Vehicle) RejectActions(reason string, reject func(*carserver.VehicleAction) bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.actionError, v.rejectAction = reason, reject
+}
+
+// InjectFault makes the vehicle reply to authenticated commands with a protocol-layer fault, such
+// as MESSAGEFAULT_ERROR_BUSY. MESSAGEFAULT_ERROR_NONE restores normal behavior.
+func (v *Vehicle) InjectFault(fault universal.MessageFault_E) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.fault = fault
+}
+
+// Commands returns the commands the vehicle has executed, in order.
+func (v *Vehicle) Commands() []Command {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return append([]Command(nil), v.commands...)
+}
+
+// Locked returns true if the vehicle is locked.
+func (v *Vehicle) Locked() bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.locked
+}
+
+// ChargeLimit returns the vehicle's charge limit, in percent.
+func (v *Vehicle) ChargeLimit() int32 {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.chargeLimit
+}
+
+// Temperatures returns the vehicle's driver and passenger temperature setpoints, in degrees
+// Celsius.
+func (v *Vehicle) Temperatures() (driver, passenger float32) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.driverTemp, v.passengerTemp
+}
+
+// ClimateOn returns true if the vehicle's climate control is on.
+func (v *Vehicle) ClimateOn() bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.climateOn
+}
+
+// MaxDefrost returns true if Max Defrost is on.
+func (v *Vehicle) MaxDefrost() bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.maxDefrost
+}
+
+// CabinOverheatProtection returns the vehicle's Cabin Overheat Protection mode.
+func (v *Vehicle) CabinOverheatProtection() carserver.ClimateState_CabinOverheatProtection_E {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.copMode
+}
+
+// SpeedLimit returns the state of the vehicle's Speed Limit Mode.
+func (v *Vehicle) SpeedLimit() SpeedLimit {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.speedLimit
+}
+
+// SupportFanOnlyCabinOverheatProtection controls whether the vehicle accepts the fan-only Cabin
+// Overheat Protection mode. By default, it rejects that mode.
+func (v *Vehicle) SupportFanOnlyCabinOverheatProtection(supported bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.copFanOnly = supported
+}
+
+// ScheduledDeparture returns the vehicle's scheduled departure settings, or nil if they've never
+// been set.
+func (v *Vehicle) ScheduledDeparture() *carserver.ScheduledDepartureAction {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.departure == nil {
+		return nil
+	}
+	return proto.Clone(v.departure).(*carserver.ScheduledDepartureAction)
+}
+
+// Desyncs returns the number of authenticated requests the vehicle rejected with session info
+// attached, which the client uses to resynchronize its counter or clock before retrying.
+func (v *Vehicle) Desyncs() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.desyncs
+}
+
+// Handshakes returns the number of session info requests the vehicle has answered.
+func (v *Vehicle) Handshakes() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.handshakes
+}
+
+// KeyInfoRequests returns the number of times the vehicle has been asked for information about an
+// enrolled key, such as its role.
+func (v *Vehicle) KeyInfoRequests() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.keyInfos
+}
+
+// SetStateAge makes the vehicle report state that it last updated age ago, as a vehicle that has
+// been asleep does. A positive age also puts the vehicle to sleep (see [Vehicle.SetAsleep]).
+// Waking the vehicle makes its state current again.
+func (v *Vehicle) SetStateAge(age time.Duration) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.stateAge = age
+	v.asleep = age > 0
+}
+
+// SetAsleep changes the sleep status the vehicle reports. A wake command wakes it up.
+func (v *Vehicle) SetAsleep(asleep bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.asleep = asleep
+}
+
+// Wakes returns the number of wake commands the vehicle has received.
+func (v *Vehicle) Wakes() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.wakes
+}
+
+// SetLocation sets the GPS position, heading (in degrees), and speed (in miles per hour) the
+// vehicle reports. Until it's called, the vehicle doesn't report a position. While the speed is
+// non-zero, the vehicle refuses to unlock.
+func (v *Vehicle) SetLocation(latitude, longitude float32, heading uint32, speed float32) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.location = &carserver.LocationState{
+		OptionalLatitude:  &carserver.LocationState_Latitude{Latitude: latitude},
+		OptionalLongitude: &carserver.LocationState_Longitude{Longitude: longitude},
+		OptionalHeading:   &carserver.LocationState_Heading{Heading: heading},
+	}
+	v.speed = speed
+}
+
+// SetChargeState sets the battery and charging fields the vehicle reports, such as its battery
+// level and charging power. The charge limit in state is ignored, since it reflects the commands
+// the vehicle receives. Until SetChargeState is called, the vehicle doesn't report a battery level.
+func (v *Vehicle) SetChargeState(state *carserver.ChargeState) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.battery = proto.Clone(state).(*carserver.ChargeState)
+}
+
+// Connect returns a new connection to the vehicle.
+func (v *Vehicle) Connect() *Connection {
+	return &Connection{vehicle: v, inbox: make(chan []byte, connector.BufferSize)}
+}
+
+// newReply addresses a reply to request.
+func newReply(request *universal.RoutableMessage) *universal.RoutableMessage {
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		panic(err)
+	}
+	return &universal.RoutableMessage{
+		ToDestination: request.GetFromDestination(),
+		FromDestination: &universal.Destination{
+			SubDestination: &universal.Destination_Domain{Domain: request.GetToDestination().GetDomain()},
+		},
+		RequestUuid: request.GetUuid(),
+		Uuid:        uuid,
+	}
+}
+
+func setFault(reply *universal.RoutableMessage, fault universal.MessageFault_E) {
+	reply.SignedMessageStatus = &universal.MessageStatus{
+		OperationStatus:    universal.OperationStatus_E_OPERATIONSTATUS_ERROR,
+		SignedMessageFault: fault,
+	}
+}
+
+// handle returns the vehicle's reply to request, or nil if the vehicle doesn't reply.
+func (v *Vehicle) handle(request *universal.RoutableMessage) *universal.RoutableMessage {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	domain := request.GetToDestination().GetDomain()
+	if _, ok := v.domainKeys[domain]; !ok {
+		return nil
+	}
+	reply := newReply(request)
+
+	if sessionRequest := request.GetSessionInfoRequest(); sessionRequest != nil {
+		v.handshakes++
+		verifier, err := v.verifier(domain, sessionRequest.GetPublicKey())
+		if err != nil {
+			info, _ := proto.Marshal(&signatures.SessionInfo{Status: signatures.Session_Info_Status_SESSION_INFO_STATUS_KEY_NOT_ON_WHITELIST})
+			reply.Payload = &universal.RoutableMessage_SessionInfo{SessionInfo: info}
+			return reply
+		}
+		if err := verifier.SetSessionInfo(request.GetUuid(), reply); err != nil {
+			setFault(reply, universal.MessageFault_E_MESSAGEFAULT_ERROR_INTERNAL)
+		}
+		return reply
+	}
+
+	if request.GetSignatureData() == nil {
+		// Only VCSEC information requests may be sent without authentication.
+		payload, ok := v.handleUnsigned(domain, request.GetProtobufMessageAsBytes())
+		if !ok {
+			setFault(reply, universal.MessageFault_E_MESSAGEFAULT_ERROR_INVALID_SIGNATURE)
+			return reply
+		}
+		reply.Payload = &universal.RoutableMessage_ProtobufMessageAsBytes{ProtobufMessageAsBytes: payload}
+		return reply
+	}
+
+	publicKey := request.GetSignatureData().GetSignerIdentity().GetPublicKey()
+	verifier, err := v.verifier(domain, publicKey)
+	if err != nil {
+		setFault(reply, universal.MessageFault_E_MESSAGEFAULT_ERROR_UNKNOWN_KEY_ID)
+		return reply
+	}
+	plaintext, err := verifier.Verify(request)
+	if err != nil {
+		var sigErr *authentication.InvalidSignatureError
+		var authErr *authentication.Error
+		switch {
+		case errors.As(err, &sigErr):
+			// Include session info so the client can resynchronize.
+			v.desyncs++
+			setFault(reply, sigErr.Code)
+			reply.Payload = &universal.RoutableMessage_SessionInfo{SessionInfo: sigErr.EncodedInfo}
+			reply.SubSigData = &universal.RoutableMessage_SignatureData{
+				SignatureData: &signatures.SignatureData{
+					SigType: &signatures.SignatureData_SessionInfoTag{
+						SessionInfoTag: &signatures.HMAC_Signature_Data{Tag: sigErr.Tag},
+					},
+				},
+			}
+		case errors.As(err, &authErr):
+			setFault(reply, authErr.Code)
+		default:
+			setFault(reply, universal.MessageFault_E_MESSAGEFAULT_ERROR_INTERNAL)
+		}
+		return reply
+	}
+	if v.fault != universal.MessageFault_E_MESSAGEFAULT_ERROR_NONE {
+		setFault(reply, v.fault)
+		return reply
+	}
+
+	var payload []byte
+	switch domain {
+	case universal.Domain_DOMAIN_VEHICLE_SECURITY:
+		payload, err = v.executeVCSEC(plaintext)
+	case universal.Domain_DOMAIN_INFOTAINMENT:
+		payload, err = v.executeInfotainment(plaintext)
+	}
+	if err != nil {
+		setFault(reply, universal.MessageFault_E_MESSAGEFAULT_ERROR_DECODING)
+		return reply
+	}
+	v.commands = append(v.commands, Command{Domain: domain, Payload: plaintext})
+
+	reply.Payload = &universal.RoutableMessage_ProtobufMessageAsBytes{ProtobufMessageAsBytes: payload}
+	if request.GetFlags()&(1<<universal.Flags_FLAG_ENCRYPT_RESPONSE) != 0 {
+		key := verifierKey{domain, string(publicKey)}
+		v.counters[key]++
+		if err := verifier.Encrypt(reply, authentication.RequestID(request), v.counters[key]); err != nil {
+			reply.Payload = nil
+			setFault(reply, universal.MessageFault_E_MESSAGEFAULT_ERROR_INTERNAL)
+		}
+	}
+	return reply
+}
+
+// verifier returns the session for publicKey on domain, creating it if necessary. It returns an
+// error if publicKey isn't paired. The caller must hold v.lock.
+func (v *Vehicle) verifier(domain universal.Domain, publicKey []byte) (*authentication.Verifier, error) {
+	if _, ok := v.roles[string(publicKey)]; !ok {
+		return nil, errors.New("key not paired")
+	}
+	key := verifierKey{domain, string(publicKey)}
+	if verifier, ok := v.verifiers[key]; ok {
+		return verifier, nil
+	}
+	verifier, err := authentication.NewVerifier(v.domainKeys[domain], []byte(v.vin), domain, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	v.verifiers[key] = verifier
+	return verifier, nil
+}
+
+func (v *Vehicle) vehicleStatus() *vcsec.VehicleStatus {
+	status := &vcsec.VehicleStatus{
+		VehicleLockState:   vcsec.VehicleLockState_E_VEHICLELOCKSTATE_UNLOCKED,
+		VehicleSleepStatus: vcsec.VehicleSleepStatus_E_VEHICLE_SLEEP_STATUS_AWAKE,
+	}
+	if v.asleep {
+		status.VehicleSleepStatus = vcsec.VehicleSleepStatus_E_VEHICLE_SLEEP_STATUS_ASLEEP
+	}
+	if v.locked {
+		status.VehicleLockState = vcsec.VehicleLockState_E_VEHICLELOCKSTATE_LOCKED
+	}
+	return status
+}
+
+// handleUnsigned answers a VCSEC information request. The caller must hold v.lock.
+func (v *Vehicle) handleUnsigned(domain universal.Domain, payload []byte) ([]byte, bool) {
+	if domain != universal.Domain_DOMAIN_VEHICLE_SECURITY {
+		return nil, false
+	}
+	var message vcsec.UnsignedMessage
+	if err := proto.Unmarshal(payload, &message); err != nil {
+		return nil, false
+	}
+	request := message.GetInformationRequest()
+	if request == nil {
+		return nil, false
+	}
+	var reply vcsec.FromVCSECMessage
+	switch request.GetInformationRequestType() {
+	case vcsec.InformationRequestType_INFORMATION_REQUEST_TYPE_GET_STATUS:
+		reply.SubMessage = &vcsec.FromVCSECMessage_VehicleStatus{VehicleStatus: v.vehicleStatus()}
+	case vcsec.InformationRequestType_INFORMATION_REQUEST_TYPE_GET_WHITELIST_ENTRY_INFO:
+		v.keyInfos++
+		info := &vcsec.WhitelistEntryInfo{}
+		if role, ok := v.roles[string(request.GetPublicKey())]; ok {
+			info.PublicKey = &vcsec.PublicKey{PublicKeyRaw: request.GetPublicKey()}
+			info.KeyRole = role
+		}
+		reply.SubMessage = &vcsec.FromVCSECMessage_WhitelistEntryInfo{WhitelistEntryInfo: info}
+	default:
+		return nil, false
+	}
+	encoded, err := proto.Marshal(&reply)
+	return encoded, err == nil
+}
+
+// executeVCSEC executes an authenticated VCSEC command. The caller must hold v.lock.
+func (v *Vehicle) executeVCSEC(plaintext []byte) ([]byte, error) {
+	var message vcsec.UnsignedMessage
+	if err := proto.Unmarshal(plaintext, &message); err != nil {
+		return nil, err
+	}
+	var reply vcsec.FromVCSECMessage
+	if v.commandError != "" {
+		reply.SubMessage = &vcsec.FromVCSECMessage_CommandStatus{
+			CommandStatus: &vcsec.CommandStatus{OperationStatus: vcsec.OperationStatus_E_OPERATIONSTATUS_ERROR},
+		}
+		return proto.Marshal(&reply)
+	}
+	switch message.GetSubMessage().(type) {
+	case *vcsec.UnsignedMessage_RKEAction:
+		switch message.GetRKEAction() {
+		case vcsec.RKEAction_E_RKE_ACTION_LOCK:
+			v.locked = true
+		case vcsec.RKEAction_E_RKE_ACTION_UNLOCK:
+			if v.speed > 0 {
+				reply.SubMessage = &vcsec.FromVCSECMessage_NominalError{
+					NominalError: &verror.NominalError{GenericError: verror.GenericError_E_GENERICERROR_VEHICLE_NOT_IN_PARK},
+				}
+				return proto.Marshal(&reply)
+			}
+			v.locked = false
+		case vcsec.RKEAction_E_RKE_ACTION_WAKE_VEHICLE:
+			v.stateAge = 0
+			v.asleep = false
+			v.wakes++
+		}
+	case *vcsec.UnsignedMessage_WhitelistOperation:
+		reply.SubMessage = &vcsec.FromVCSECMessage_CommandStatus{
+			CommandStatus: &vcsec.CommandStatus{
+				OperationStatus: vcsec.OperationStatus_E_OPERATIONSTATUS_OK,
+				SubMessage: &vcsec.CommandStatus_WhitelistOperationStatus{
+					WhitelistOperationStatus: &vcsec.WhitelistOperationStatus{},
+				},
+			},
+		}
+	case *vcsec.UnsignedMessage_InformationRequest:
+		if message.GetInformationRequest().GetInformationRequestType() == vcsec.InformationRequestType_INFORMATION_REQUEST_TYPE_GET_STATUS {
+			reply.SubMessage = &vcsec.FromVCSECMessage_VehicleStatus{VehicleStatus: v.vehicleStatus()}
+		}
+	}
+	return proto.Marshal(&reply)
+}
+
+// executeInfotainment executes an authenticated infotainment action. The caller must hold v.lock.
+func (v *Vehicle) executeInfotainment(plaintext []byte) ([]byte, error) {
+	var action carserver.Action
+	if err := proto.Unmarshal(plaintext, &action); err != nil {
+		return nil, err
+	}
+	response := &carserver.Response{
+		ActionStatus: &carserver.ActionStatus{Result: carserver.OperationStatus_E_OPERATIONSTATUS_OK},
+	}
+	if v.commandError != "" {
+		response.ActionStatus = &carserver.ActionStatus{
+			Result:       carserver.OperationStatus_E_OPERATIONSTATUS_ERROR,
+			ResultReason: &carserver.ResultReason{Reason: &carserver.ResultReason_PlainText{PlainText: v.commandError}},
+		}
+		return proto.Marshal(response)
+	}
+	vehicleAction := action.GetVehicleAction()
+	if reason := v.rejectionReason(vehicleAction); reason != "" {
+		response.ActionStatus = &carserver.ActionStatus{
+			Result:       carserver.OperationStatus_E_OPERATIONSTATUS_ERROR,
+			ResultReason: &carserver.ResultReason{Reason: &carserver.ResultReason_PlainText{PlainText: reason}},
+		}
+		return proto.Marshal(response)
+	}
+	switch {
+	case vehicleAction.GetGetVehicleData() != nil:
+		response.ResponseMsg = &carserver.Response_VehicleData{VehicleData: &carserver.VehicleData{
+			ChargeState: v.chargeState(),
+			ClimateState: &carserver.ClimateState{
+				Timestamp:                    v.stateTimestamp(),
+				OptionalDriverTempSetting:    &carserver.ClimateState_DriverTempSetting{DriverTempSetting: v.driverTemp},
+				OptionalPassengerTempSetting: &carserver.ClimateState_PassengerTempSetting{PassengerTempSetting: v.passengerTemp},
+				OptionalMinAvailTempCelsius:  &carserver.ClimateState_MinAvailTempCelsius{MinAvailTempCelsius: MinTemperature},
+				OptionalMaxAvailTempCelsius:  &carserver.ClimateState_MaxAvailTempCelsius{MaxAvailTempCelsius: MaxTemperature},
+				OptionalCabinOverheatProtection: &carserver.ClimateState_CabinOverheatProtection{
+					CabinOverheatProtection: v.copMode,
+				},
+				OptionalSupportsFanOnlyCabinOverheatProtection: &carserver.ClimateState_SupportsFanOnlyCabinOverheatProtection{
+					SupportsFanOnlyCabinOverheatProtection: v.copFanOnly,
+				},
+			},
+			LocationState: v.locationState(),
+			DriveState: &carserver.DriveState{
+				Timestamp:          v.stateTimestamp(),
+				OptionalSpeedFloat: &carserver.DriveState_SpeedFloat{SpeedFloat: v.speed},
+			},
+		}}
+	case vehicleAction.GetHvacAutoAction() != nil:
+		v.climateOn = vehicleAction.GetHvacAutoAction().GetPowerOn()
+		if !v.climateOn {
+			v.maxDefrost = false
+		}
+	case vehicleAction.GetHvacSetPreconditioningMaxAction() != nil:
+		v.maxDefrost = vehicleAction.GetHvacSetPreconditioningMaxAction().GetOn()
+		v.climateOn = v.climateOn || v.maxDefrost
+	case vehicleAction.GetSetCabinOverheatProtectionAction() != nil:
+		action := vehicleAction.GetSetCabinOverheatProtectionAction()
+		switch {
+		case !action.GetOn():
+			v.copMode = carserver.ClimateState_CabinOverheatProtectionOff
+		case action.GetFanOnly():
+			v.copMode = carserver.ClimateState_CabinOverheatProtectionFanOnly
+		default:
+			v.copMode = carserver.ClimateState_CabinOverheatProtectionOn
+		}
+	case vehicleAction.GetHvacTemperatureAdjustmentAction() != nil:
+		action := vehicleAction.GetHvacTemperatureAdjustmentAction()
+		v.driverTemp = adjustTemperature(action.GetDriverTempCelsius())
+		v.passengerTemp = adjustTemperature(action.GetPassengerTempCelsius())
+	case vehicleAction.GetScheduledDepartureAction() != nil:
+		action := vehicleAction.GetScheduledDepartureAction()
+		if !action.GetEnabled() && v.departure != nil {
+			// Disabling scheduled departure preserves the other settings.
+			v.departure.Enabled = false
+		} else {
+			v.departure = proto.Clone(action).(*carserver.ScheduledDepartureAction)
+		}
+	case vehicleAction.GetDrivingSpeedLimitAction() != nil:
+		action := vehicleAction.GetDrivingSpeedLimitAction()
+		v.speedLimit.Active = action.GetActivate()
+		if action.GetActivate() {
+			v.speedLimit.PIN = action.GetPin()
+		}
+	case vehicleAction.GetDrivingSetSpeedLimitAction() != nil:
+		v.speedLimit.LimitMPH = vehicleAction.GetDrivingSetSpeedLimitAction().GetLimitMph()
+	case vehicleAction.GetDrivingClearSpeedLimitPinAction() != nil,
+		vehicleAction.GetDrivingClearSpeedLimitPinAdminAction() != nil:
+		v.speedLimit.Active = false
+		v.speedLimit.PIN = ""
+	case vehicleAction.GetChargingSetLimitAction() != nil:
+		v.chargeLimit = vehicleAction.GetChargingSetLimitAction().GetPercent()
+	case vehicleAction.GetChargingStartStopAction().GetStartStandard() != nil:
+		v.chargeLimit = StandardChargeLimit
+	case vehicleAction.GetChargingStartStopAction().GetStartMaxRange() != nil:
+		v.chargeLimit = MaxChargeLimit
+	}
+	return proto.Marshal(response)
+}
+
+func (v *Vehicle) stateTimestamp() *timestamppb.Timestamp {
+	return timestamppb.New(time.Now().Add(-v.stateAge))
+}
+
+func (v *Vehicle) locationState() *carserver.LocationState {
+	state := &carserver.LocationState{Timestamp: v.stateTimestamp()}
+	if v.location != nil {
+		proto.Merge(state, v.location)
+	}
+	return state
+}
+
+func (v *Vehicle) chargeState() *carserver.ChargeState {
+	state := &carserver.ChargeState{}
+	if v.battery != nil {
+		proto.Merge(state, v.battery)
+	}
+	state.Timestamp = v.stateTimestamp()
+	state.OptionalChargeLimitSoc = &carserver.ChargeState_ChargeLimitSoc{ChargeLimitSoc: v.chargeLimit}
+	if v.departure == nil {
+		return state
+	}
+	mode := carserver.ChargeState_ScheduledChargingModeOff
+	if v.departure.GetEnabled() {
+		mode = carserver.ChargeState_ScheduledChargingModeDepartBy
+	}
+	state.OptionalScheduledChargingMode = &carserver.ChargeState_ScheduledChargingMode_{ScheduledChargingMode: mode}
+	state.OptionalScheduledDepartureTimeMinutes = &carserver.ChargeState_ScheduledDepartureTimeMinutes{
+		ScheduledDepartureTimeMinutes: uint32(v.departure.GetDepartureTime()),
+	}
+	state.PreconditioningTimes = v.departure.GetPreconditioningTimes()
+	state.OffPeakChargingTimes = v.departure.GetOffPeakChargingTimes()
+	state.OptionalOffPeakHoursEndTime = &carserver.ChargeState_OffPeakHoursEndTime{
+		OffPeakHoursEndTime: uint32(v.departure.GetOffPeakHoursEndTime()),
+	}
+	return state
+}
+
+// rejectionReason returns the reason the vehicle refuses action, or an empty string. Actions
+// configured with RejectActions are refused first. The simulated vehicle has two rows of seats,
+// so it rejects third-row seat heater settings. It also rejects fan-only Cabin Overheat
+// Protection unless configured to support it, and Speed Limit Mode commands with the wrong PIN.
+func (v *Vehicle) rejectionReason(action *carserver.VehicleAction) string {
+	if v.rejectAction != nil && v.rejectAction(action) {
+		return v.actionError
+	}
+	pin, checkPIN := "", false
+	switch {
+	case action.GetDrivingSpeedLimitAction() != nil:
+		// Activating Speed Limit Mode sets the PIN if there isn't one.
+		pin, checkPIN = action.GetDrivingSpeedLimitAction().GetPin(), v.speedLimit.PIN != ""
+	case action.GetDrivingClearSpeedLimitPinAction() != nil:
+		pin, checkPIN = action.GetDrivingClearSpeedLimitPinAction().GetPin(), true
+	}
+	if checkPIN && pin != v.speedLimit.PIN {
+		return "invalid_pin"
+	}
+	if limit := action.GetDrivingSetSpeedLimitAction(); limit != nil && v.speedLimit.Active {
+		return "speed_limit_mode_active"
+	}
+	if cop := action.GetSetCabinOverheatProtectionAction(); cop.GetOn() && cop.GetFanOnly() && !v.copFanOnly {
+		return "fan_only_not_supported"
+	}
+	for _, heater := range action.GetHvacSeatHeaterActions().GetHvacSeatHeaterAction() {
+		if heater.GetCAR_SEAT_THIRD_ROW_LEFT() != nil || heater.GetCAR_SEAT_THIRD_ROW_RIGHT() != nil {
+			return "seat_not_present"
+		}
+	}
+	return ""
+}
+
+// adjustTemperature clamps and rounds a requested setpoint the way the simulated vehicle does.
+func adjustTemperature(celsius float32) float32 {
+	celsius = min(max(celsius, MinTemperature), MaxTemperature)
+	return float32(math.Round(float64(celsius)*2) / 2)
+}
+
+// Connection is an in-memory [connector.Connector] to a Vehicle.
+type Connection struct {
+	vehicle *Vehicle
+
+	lock   sync.Mutex
+	inbox  chan []byte
+	closed bool
+}
+
+// Receive returns messages sent by the vehicle.
+func (c *Connection) Receive() <-chan []byte {
+	return c.inbox
+}
+
+// Send delivers buffer to the vehicle, which replies asynchronously.
+func (c *Connection) Send(_ context.Context, buffer []byte) error {
+	c.lock.Lock()
+	closed := c.closed
+	c.lock.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	var request universal.RoutableMessage
+	if err := proto.Unmarshal(buffer, &request); err != nil {
+		return err
+	}
+	go c.deliver(c.vehicle.handle(&request))
+	return nil
+}
+
+func (c *Connection) deliver(reply *universal.RoutableMessage) {
+	if reply == nil {
+		return
+	}
+	encoded, err := proto.Marshal(reply)
+	if err != nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.inbox <- encoded:
+	default:
+		// Vehicles drop replies if the client isn't keeping up.
+	}
+}
+
+// VIN returns the vehicle's VIN.
+func (c *Connection) VIN() string {
+	return c.vehicle.vin
+}
+
+// Close disconnects from the vehicle. It's safe to call more than once.
+func (c *Connection) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.inbox)
+	}
+}
+
+// PreferredAuthMethod returns HMAC, which Fleet API connections use.
+func (c *Connection) PreferredAuthMethod() connector.AuthMethod {
+	return connector.AuthMethodHMAC
+}
+
+// RetryInterval is short to keep tests fast.
+func (c *Connection) RetryInterval() time.Duration {
+	return 10 * time.Millisecond
+}
+
+// AllowedLatency returns a generous limit, since replies are never delayed.
+func (c *Connection) AllowedLatency() time.Duration {
+	return time.Second
+}
+
+var _ connector.Connector = (*Connection)(nil)
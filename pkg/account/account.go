@@ -3,72 +3,43 @@ package account
 import (
 	"context"
 	"crypto/ecdh"
-	_ "embed" // Used to embed version for use with user agent
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"regexp"
-	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/teslamotors/vehicle-command/internal/authentication"
 	"github.com/teslamotors/vehicle-command/internal/log"
 	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
 	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
 	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+	"github.com/teslamotors/vehicle-command/pkg/version"
 )
 
-var (
-	//go:embed version.txt
-	libraryVersion string
-)
-
-func buildUserAgent(app string) string {
-	library := strings.TrimSpace("tesla-sdk/" + libraryVersion)
-	build, ok := debug.ReadBuildInfo()
-	if !ok {
-		return library
-	}
-	path := strings.Split(build.Path, "/")
-	if len(path) == 0 {
-		return library
-	}
-
-	if app == "" {
-		app = path[len(path)-1]
-		var version string
-		if build.Main.Version != "(devel)" && build.Main.Version != "" {
-			version = build.Main.Version
-		} else {
-			for _, info := range build.Settings {
-				if info.Key == "vcs.revision" {
-					if len(info.Value) > 8 {
-						version = info.Value[0:8]
-					}
-					break
-				}
-			}
-		}
-
-		if version != "" {
-			app = fmt.Sprintf("%s/%s", app, version)
-		}
-	}
-
-	return fmt.Sprintf("%s %s", app, library)
-}
-
 // Account allows interaction with a Tesla account.
 type Account struct {
-	// The default UserAgent is constructed from the global UserAgent, but can be overridden.
-	UserAgent  string
-	authHeader string
-	Host       string
-	Subject    string
-	client     http.Client
+	// The default UserAgent is constructed by [version.UserAgent], but can be overridden.
+	UserAgent   string
+	credentials inet.Credentials
+	Host        string
+	Subject     string
+	client      http.Client
+
+	// FrameTap, if set, receives the raw messages exchanged with vehicles returned by GetVehicle.
+	FrameTap *connector.FrameTap
+
+	// Clock, if set, replaces the system clock when vehicles returned by GetVehicle wait to retry.
+	Clock clock.Clock
+
+	// CallTimeout, if non-zero, limits each request that vehicles returned by GetVehicle send to
+	// Tesla's servers; see [inet.Connection.SetCallTimeout].
+	CallTimeout time.Duration
 }
 
 // We don't parse JWTs beyond what's required to extract the API server domain name
@@ -114,9 +85,9 @@ func (p *oauthPayload) domain() string {
 	return domain
 }
 
-// New returns an [Account] that can be used to fetch a [vehicle.Vehicle].
-// Optional userAgent can be passed in - otherwise it will be generated from code
-func New(oauthToken, userAgent string) (*Account, error) {
+// parseOAuthToken extracts the claims of oauthToken without verifying its signature, which is
+// left to Tesla's servers.
+func parseOAuthToken(oauthToken string) (*oauthPayload, error) {
 	parts := strings.Split(oauthToken, ".")
 	if len(parts) != 3 {
 		return nil, fmt.Errorf("client provided malformed OAuth token")
@@ -129,35 +100,87 @@ func New(oauthToken, userAgent string) (*Account, error) {
 	if err := json.Unmarshal(payloadJSON, &payload); err != nil {
 		return nil, fmt.Errorf("client provided malformed OAuth token: %s", err)
 	}
+	return &payload, nil
+}
 
+// New returns an [Account] that can be used to fetch a [vehicle.Vehicle].
+// Optional userAgent names the application, such as "acme-fleet/2.1"; it's prepended to a
+// User-Agent generated from the build. See [version.UserAgent].
+func New(oauthToken, userAgent string) (*Account, error) {
+	payload, err := parseOAuthToken(oauthToken)
+	if err != nil {
+		return nil, err
+	}
 	domain := payload.domain()
 	if domain == "" {
 		return nil, fmt.Errorf("client provided OAuth token with invalid audiences")
 	}
-	return &Account{
-		UserAgent:  buildUserAgent(userAgent),
-		authHeader: "Bearer " + strings.TrimSpace(oauthToken),
-		Host:       domain,
-		Subject:    payload.Subject,
-	}, nil
+	acct := &Account{
+		UserAgent: version.UserAgent(userAgent),
+		Host:      domain,
+		Subject:   payload.Subject,
+	}
+	acct.credentials.SetAuthHeader("Bearer " + strings.TrimSpace(oauthToken))
+	return acct, nil
 }
 
-// GetVehicle returns the Vehicle belonging to the account with the provided vin.
+// UpdateToken replaces the account's OAuth token, for example after the client refreshes it.
+// Vehicles previously returned by [Account.GetVehicle] use the new token for subsequent requests
+// and keep their sessions: sessions are authenticated by the command key, not the token, so no
+// new handshake is needed and anti-replay counters carry on where they left off.
+//
+// The new token must belong to the same user as the old one. The account's Host is unchanged.
+func (a *Account) UpdateToken(oauthToken string) error {
+	payload, err := parseOAuthToken(oauthToken)
+	if err != nil {
+		return err
+	}
+	if payload.Subject != a.Subject {
+		return fmt.Errorf("refreshed OAuth token belongs to a different user")
+	}
+	a.credentials.SetAuthHeader("Bearer " + strings.TrimSpace(oauthToken))
+	return nil
+}
+
+// GetVehicle returns the Vehicle belonging to the account with the provided vin. The vin may also
+// be a numeric Fleet API vehicle ID; see [Account.ResolveVIN].
 //
 // Providing a nil privateKey is allowed, but a privateKey is required for most Vehicle
 // interactions. Typically, the privateKey will only be nil when connecting to the Vehicle to send
 // an AddKeyRequest; see documentation in [pkg/github.com/teslamotors/vehicle-command/pkg/vehicle]. The
 // sessions parameter may also be nil, but providing a cache.SessionCache avoids a round-trip
 // handshake with the Vehicle in subsequent connections.
-func (a *Account) GetVehicle(_ context.Context, vin string, privateKey authentication.ECDHPrivateKey, sessions *cache.SessionCache) (*vehicle.Vehicle, error) {
-	conn := inet.NewConnection(vin, a.authHeader, a.Host, a.UserAgent)
-	car, err := vehicle.NewVehicle(conn, privateKey, sessions)
+func (a *Account) GetVehicle(ctx context.Context, vin string, privateKey authentication.ECDHPrivateKey, sessions *cache.SessionCache) (*vehicle.Vehicle, error) {
+	vin, err := a.ResolveVIN(ctx, vin)
+	if err != nil {
+		return nil, err
+	}
+	conn := inet.NewConnectionWithCredentials(vin, &a.credentials, a.Host, a.UserAgent)
+	conn.ObserveFrames(a.FrameTap)
+	conn.SetCallTimeout(a.CallTimeout)
+	var options []vehicle.Option
+	if a.Clock != nil {
+		conn.SetClock(a.Clock)
+		options = append(options, vehicle.WithClock(a.Clock))
+	}
+	car, err := vehicle.NewVehicle(conn, privateKey, sessions, options...)
 	if err != nil {
 		conn.Close()
 	}
 	return car, err
 }
 
+// httpStatusError is returned by Get when Tesla's servers don't reply with 200 OK.
+type httpStatusError struct {
+	url    string
+	code   int
+	status string
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("http error when sending command to %s: %s", e.url, e.status)
+}
+
 // Get sends an HTTP GET request to endpoint.
 //
 // The endpoint should contain only the path (e.g., "api/1/vehicles/foo"); the domain is determined
@@ -171,7 +194,7 @@ func (a *Account) Get(ctx context.Context, endpoint string) ([]byte, error) {
 	log.Debug("Requesting %s...", url)
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("User-Agent", a.UserAgent)
-	request.Header.Set("Authorization", a.authHeader)
+	request.Header.Set("Authorization", a.credentials.AuthHeader())
 	response, err := a.client.Do(request)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching %s: %w", endpoint, err)
@@ -180,8 +203,7 @@ func (a *Account) Get(ctx context.Context, endpoint string) ([]byte, error) {
 		_ = response.Body.Close()
 	}()
 	if response.StatusCode != http.StatusOK {
-		err := fmt.Errorf("http error when sending command to %s: %s", url, response.Status)
-		return nil, err
+		return nil, &httpStatusError{url: url, code: response.StatusCode, status: response.Status}
 	}
 	reader := io.LimitedReader{R: response.Body, N: connector.MaxResponseLength}
 	body, err := io.ReadAll(&reader)
@@ -193,7 +215,7 @@ func (a *Account) Get(ctx context.Context, endpoint string) ([]byte, error) {
 }
 
 func (a *Account) sendFleetAPICommand(ctx context.Context, endpoint string, command interface{}) ([]byte, error) {
-	return inet.SendFleetAPICommand(ctx, &a.client, a.UserAgent, a.authHeader, fmt.Sprintf("https://%s/%s", a.Host, endpoint), command)
+	return inet.SendFleetAPICommand(ctx, &a.client, a.UserAgent, a.credentials.AuthHeader(), fmt.Sprintf("https://%s/%s", a.Host, endpoint), command)
 }
 
 // Post sends an HTTP POST request to endpoint.
@@ -86,3 +86,29 @@ func makeTestJWT(payload *oauthPayload) string {
 	jwtBody, _ := json.Marshal(payload)
 	return fmt.Sprintf("x.%s.y", b64Encode(string(jwtBody)))
 }
+
+func TestUpdateToken(t *testing.T) {
+	acct, err := New(makeTestJWT(&oauthPayload{Subject: "alice"}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed := makeTestJWT(&oauthPayload{Subject: "alice", OUCode: "eu"})
+	if err := acct.UpdateToken(refreshed); err != nil {
+		t.Fatalf("Couldn't update token: %s", err)
+	}
+	if got := acct.credentials.AuthHeader(); got != "Bearer "+refreshed {
+		t.Errorf("Unexpected Authorization header %q", got)
+	}
+	if acct.Host != defaultDomain {
+		t.Errorf("Token refresh changed Host to %s", acct.Host)
+	}
+	if err := acct.UpdateToken(makeTestJWT(&oauthPayload{Subject: "bob"})); err == nil {
+		t.Error("Expected error when updating to another user's token")
+	}
+	if err := acct.UpdateToken("malformed"); err == nil {
+		t.Error("Expected error for malformed token")
+	}
+	if got := acct.credentials.AuthHeader(); got != "Bearer "+refreshed {
+		t.Errorf("Rejected tokens replaced the Authorization header with %q", got)
+	}
+}
@@ -0,0 +1,56 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrAlertsNotSupported indicates that Fleet API can't report the alerts of a vehicle, for example
+// because its firmware doesn't upload them.
+var ErrAlertsNotSupported = errors.New("vehicle doesn't report alerts")
+
+// Alert is a notification that a vehicle raised, such as a door left open or low tire pressure.
+type Alert struct {
+	// Name identifies the kind of alert, e.g. "Name_Of_The_Alert".
+	Name string `json:"name"`
+	// Time is when the vehicle raised the alert.
+	Time time.Time `json:"time"`
+	// Audience lists who the alert is meant for, such as "customer" or "service".
+	Audience []string `json:"audience"`
+	// UserText is the description shown to the driver, if any.
+	UserText string `json:"user_text,omitempty"`
+}
+
+// RecentAlerts fetches the alerts that the vehicle with the given VIN or vehicle ID recently raised
+// from the Fleet API, most recent first. Reading them doesn't wake the vehicle. Returns
+// ErrAlertsNotSupported if Fleet API doesn't have alerts for the vehicle.
+func (a *Account) RecentAlerts(ctx context.Context, vin string) ([]Alert, error) {
+	vin, err := a.ResolveVIN(ctx, vin)
+	if err != nil {
+		return nil, err
+	}
+	body, err := a.Get(ctx, fmt.Sprintf("api/1/vehicles/%s/recent_alerts", vin))
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound {
+		return nil, ErrAlertsNotSupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	var reply struct {
+		Response *struct {
+			Alerts *[]Alert `json:"recent_alerts"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, fmt.Errorf("invalid vehicle alerts: %w", err)
+	}
+	if reply.Response == nil || reply.Response.Alerts == nil {
+		return nil, ErrAlertsNotSupported
+	}
+	return *reply.Response.Alerts, nil
+}
@@ -0,0 +1,53 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecentAlerts(t *testing.T) {
+	replies := map[string]string{
+		"/api/1/vehicles/5YJ3E1EA7KF000001/recent_alerts": `{"response":{"recent_alerts":[` +
+			`{"name":"VCFRONT_a192_doorOpen","time":"2024-03-19T22:01:15.101+00:00","audience":["customer"],"user_text":"Door open"},` +
+			`{"name":"TPMS_a019_lowPressure","time":"2024-03-19T21:00:00Z","audience":["service","customer"]}]}}`,
+		"/api/1/vehicles/5YJ3E1EA7KF000002/recent_alerts": `{"response":{"recent_alerts":[]}}`,
+		"/api/1/vehicles/5YJ3E1EA7KF000003/recent_alerts": `{"response":null}`,
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reply, ok := replies[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write([]byte(reply))
+	}))
+	defer server.Close()
+	acct := &Account{Host: strings.TrimPrefix(server.URL, "https://"), client: *server.Client()}
+	ctx := context.Background()
+
+	alerts, err := acct.RecentAlerts(ctx, "5YJ3E1EA7KF000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 2 || alerts[0].Name != "VCFRONT_a192_doorOpen" || alerts[0].UserText != "Door open" ||
+		len(alerts[1].Audience) != 2 || alerts[1].UserText != "" {
+		t.Errorf("Unexpected alerts %+v", alerts)
+	}
+	if want := time.Date(2024, 3, 19, 22, 1, 15, 101e6, time.UTC); !alerts[0].Time.Equal(want) {
+		t.Errorf("Expected time %s, got %s", want, alerts[0].Time)
+	}
+
+	if alerts, err := acct.RecentAlerts(ctx, "5YJ3E1EA7KF000002"); err != nil || alerts == nil || len(alerts) != 0 {
+		t.Errorf("Expected empty list of alerts, got %v, %v", alerts, err)
+	}
+	for _, vin := range []string{"5YJ3E1EA7KF000003", "5YJ3E1EA7KF000009"} {
+		if _, err := acct.RecentAlerts(ctx, vin); !errors.Is(err, ErrAlertsNotSupported) {
+			t.Errorf("%s: expected ErrAlertsNotSupported, got %v", vin, err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// capabilities caches the results of VehicleCapabilities, keyed by host and VIN. A vehicle's
+// hardware doesn't change, so entries never expire.
+var capabilities sync.Map
+
+// carTypesWithHEPAFilter lists the vehicle_config car_type values of models that have a HEPA
+// filter and therefore support Bioweapon Defense Mode.
+var carTypesWithHEPAFilter = map[string]bool{
+	"models":     true,
+	"modelx":     true,
+	"modely":     true,
+	"cybertruck": true,
+}
+
+// vehicleConfig holds the vehicle_config fields that capabilities are derived from. Pointers are
+// nil if the field is absent, which leaves the corresponding capability unknown.
+type vehicleConfig struct {
+	CarType        string `json:"car_type"`
+	HasSeatCooling *bool  `json:"has_seat_cooling"`
+}
+
+func (c *vehicleConfig) capabilities() vehicle.Capabilities {
+	caps := make(vehicle.Capabilities)
+	if c.CarType != "" {
+		caps[vehicle.CapabilityTonneau] = c.CarType == "cybertruck"
+		caps[vehicle.CapabilityHEPAFilter] = carTypesWithHEPAFilter[c.CarType]
+	}
+	if c.HasSeatCooling != nil {
+		caps[vehicle.CapabilitySeatCooling] = *c.HasSeatCooling
+	}
+	return caps
+}
+
+// VehicleCapabilities returns the optional hardware of the vehicle with the given VIN, derived
+// from its configuration in Fleet API. The result is cached, so only the first call for each
+// vehicle contacts Tesla's servers. Reading the configuration doesn't wake the vehicle, but fails
+// if the vehicle is asleep and Tesla's servers haven't seen it recently.
+func (a *Account) VehicleCapabilities(ctx context.Context, vin string) (vehicle.Capabilities, error) {
+	key := a.Host + "/" + vin
+	if cached, ok := capabilities.Load(key); ok {
+		return cached.(vehicle.Capabilities), nil
+	}
+	data, err := a.VehicleData(ctx, vin, VehicleDataOptions{Endpoints: []string{"vehicle_config"}})
+	if err != nil {
+		return nil, err
+	}
+	var reply struct {
+		Config *vehicleConfig `json:"vehicle_config"`
+	}
+	if err := json.Unmarshal(data.Response, &reply); err != nil {
+		return nil, fmt.Errorf("invalid vehicle configuration: %w", err)
+	}
+	if reply.Config == nil {
+		return nil, errors.New("vehicle configuration missing from response")
+	}
+	caps := reply.Config.capabilities()
+	capabilities.Store(key, caps)
+	return caps, nil
+}
@@ -0,0 +1,61 @@
+package account
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+func TestVehicleCapabilities(t *testing.T) {
+	replies := map[string]string{
+		"/api/1/vehicles/7G2CEHED0RA000001/vehicle_data": `{"response":{"vehicle_config":{"car_type":"cybertruck","has_seat_cooling":true}}}`,
+		"/api/1/vehicles/5YJ3E1EA7KF000001/vehicle_data": `{"response":{"vehicle_config":{"car_type":"model3"}}}`,
+	}
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		reply, ok := replies[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write([]byte(reply))
+	}))
+	defer server.Close()
+	acct := &Account{Host: strings.TrimPrefix(server.URL, "https://"), client: *server.Client()}
+	ctx := context.Background()
+
+	caps, err := acct.VehicleCapabilities(ctx, "7G2CEHED0RA000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caps[vehicle.CapabilityTonneau] || !caps[vehicle.CapabilityHEPAFilter] || !caps[vehicle.CapabilitySeatCooling] {
+		t.Errorf("Unexpected Cybertruck capabilities %v", caps)
+	}
+
+	caps, err = acct.VehicleCapabilities(ctx, "5YJ3E1EA7KF000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if supported, known := caps[vehicle.CapabilityTonneau]; !known || supported {
+		t.Errorf("Expected Model 3 not to have a tonneau, got %v", caps)
+	}
+	if _, known := caps[vehicle.CapabilitySeatCooling]; known {
+		t.Errorf("Expected seat cooling to be unknown, got %v", caps)
+	}
+
+	before := requests
+	if _, err := acct.VehicleCapabilities(ctx, "5YJ3E1EA7KF000001"); err != nil {
+		t.Fatal(err)
+	}
+	if requests != before {
+		t.Error("Expected capabilities to be cached")
+	}
+	if _, err := acct.VehicleCapabilities(ctx, "5YJ3E1EA7KF000009"); err == nil {
+		t.Error("Expected error for unknown vehicle")
+	}
+}
@@ -0,0 +1,63 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrVehicleInService indicates that the vehicle is in service mode, in which it doesn't
+	// accept commands from third-party applications.
+	ErrVehicleInService = errors.New("vehicle is in service mode")
+	// ErrVehicleOffline indicates that Tesla's servers can't reach the vehicle, for example
+	// because it has no cellular or Wi-Fi connection. Unlike a vehicle that's asleep, it can't be
+	// woken up until it reconnects.
+	ErrVehicleOffline = errors.New("vehicle is offline")
+)
+
+// Vehicle states reported by Fleet API.
+const (
+	VehicleStateOnline  = "online"
+	VehicleStateAsleep  = "asleep"
+	VehicleStateOffline = "offline"
+)
+
+// VehicleStatus is a vehicle's connectivity as reported by Fleet API's vehicle list. Reading it
+// doesn't wake the vehicle.
+type VehicleStatus struct {
+	State     string `json:"state"` // VehicleStateOnline, VehicleStateAsleep, or VehicleStateOffline
+	InService bool   `json:"in_service"`
+}
+
+// Err returns ErrVehicleInService or ErrVehicleOffline if the vehicle can't currently receive
+// commands, or nil otherwise. Vehicles that are asleep can be woken up, so they aren't considered
+// unavailable.
+func (s *VehicleStatus) Err() error {
+	switch {
+	case s.InService:
+		return ErrVehicleInService
+	case s.State == VehicleStateOffline:
+		return ErrVehicleOffline
+	}
+	return nil
+}
+
+// VehicleStatus fetches the state of the vehicle with the given VIN from Tesla's servers.
+func (a *Account) VehicleStatus(ctx context.Context, vin string) (*VehicleStatus, error) {
+	body, err := a.Get(ctx, "api/1/vehicles/"+vin)
+	if err != nil {
+		return nil, err
+	}
+	var reply struct {
+		Response *VehicleStatus `json:"response"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, fmt.Errorf("invalid vehicle status: %w", err)
+	}
+	if reply.Response == nil {
+		return nil, errors.New("vehicle status missing from response")
+	}
+	return reply.Response, nil
+}
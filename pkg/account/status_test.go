@@ -0,0 +1,49 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVehicleStatus(t *testing.T) {
+	replies := map[string]string{
+		"/api/1/vehicles/5YJ3E1EA7KF000001": `{"response":{"vin":"5YJ3E1EA7KF000001","state":"online","in_service":false}}`,
+		"/api/1/vehicles/5YJ3E1EA7KF000002": `{"response":{"vin":"5YJ3E1EA7KF000002","state":"asleep","in_service":false}}`,
+		"/api/1/vehicles/5YJ3E1EA7KF000003": `{"response":{"vin":"5YJ3E1EA7KF000003","state":"offline","in_service":false}}`,
+		"/api/1/vehicles/5YJ3E1EA7KF000004": `{"response":{"vin":"5YJ3E1EA7KF000004","state":"online","in_service":true}}`,
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reply, ok := replies[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		w.Write([]byte(reply))
+	}))
+	defer server.Close()
+	acct := &Account{Host: strings.TrimPrefix(server.URL, "https://"), client: *server.Client()}
+	ctx := context.Background()
+
+	for vin, want := range map[string]error{
+		"5YJ3E1EA7KF000001": nil,
+		"5YJ3E1EA7KF000002": nil,
+		"5YJ3E1EA7KF000003": ErrVehicleOffline,
+		"5YJ3E1EA7KF000004": ErrVehicleInService,
+	} {
+		status, err := acct.VehicleStatus(ctx, vin)
+		if err != nil {
+			t.Errorf("%s: %s", vin, err)
+			continue
+		}
+		if !errors.Is(status.Err(), want) {
+			t.Errorf("%s: expected %v, got %v", vin, want, status.Err())
+		}
+	}
+	if _, err := acct.VehicleStatus(ctx, "5YJ3E1EA7KF000009"); err == nil {
+		t.Error("Expected error for unknown vehicle")
+	}
+}
@@ -0,0 +1,112 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/log"
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+)
+
+// VehicleDataOptions control how [Account.VehicleData] reads vehicle data from the Fleet API.
+type VehicleDataOptions struct {
+	// Endpoints limits the response to the named categories, such as "charge_state" or
+	// "location_data". All categories are returned if it's empty.
+	Endpoints []string
+	// Live wakes the vehicle before reading its data. Otherwise Tesla's servers may answer with
+	// the data the vehicle last uploaded, which can be hours old if the vehicle is asleep.
+	Live bool
+	// MaxStaleness is the age of the oldest data the caller accepts. If the data is older, the
+	// vehicle is woken up and the data is read again. Zero accepts data of any age.
+	MaxStaleness time.Duration
+}
+
+// VehicleData is a Fleet API vehicle_data response.
+type VehicleData struct {
+	// Response is the "response" object of the reply.
+	Response json.RawMessage
+	// Timestamp is the oldest timestamp of the categories in Response. It's zero if none of them
+	// has one.
+	Timestamp time.Time
+}
+
+// Age returns how long ago the vehicle uploaded the data, or zero if the timestamp is unknown.
+func (d *VehicleData) Age() time.Duration {
+	if d.Timestamp.IsZero() {
+		return 0
+	}
+	return time.Since(d.Timestamp)
+}
+
+// VehicleData fetches data about the vehicle with the given VIN or vehicle ID from the Fleet API.
+func (a *Account) VehicleData(ctx context.Context, vin string, options VehicleDataOptions) (*VehicleData, error) {
+	vin, err := a.ResolveVIN(ctx, vin)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("api/1/vehicles/%s/vehicle_data", vin)
+	if len(options.Endpoints) > 0 {
+		endpoint += "?endpoints=" + url.QueryEscape(strings.Join(options.Endpoints, ";"))
+	}
+	if options.Live {
+		if err := a.wakeUp(ctx, vin); err != nil {
+			return nil, err
+		}
+	}
+	data, err := a.getVehicleData(ctx, endpoint)
+	if err != nil || options.Live || options.MaxStaleness <= 0 || data.Age() <= options.MaxStaleness {
+		return data, err
+	}
+	log.Debug("Vehicle data is %s old; waking vehicle to refresh it", data.Age().Round(time.Second))
+	if err := a.wakeUp(ctx, vin); err != nil {
+		return nil, err
+	}
+	return a.getVehicleData(ctx, endpoint)
+}
+
+func (a *Account) wakeUp(ctx context.Context, vin string) error {
+	conn := inet.NewConnectionWithCredentials(vin, &a.credentials, a.Host, a.UserAgent)
+	conn.SetCallTimeout(a.CallTimeout)
+	defer conn.Close()
+	return conn.Wakeup(ctx)
+}
+
+func (a *Account) getVehicleData(ctx context.Context, endpoint string) (*VehicleData, error) {
+	body, err := a.Get(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	var reply struct {
+		Response json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, fmt.Errorf("invalid vehicle data: %w", err)
+	}
+	return &VehicleData{Response: reply.Response, Timestamp: vehicleDataTimestamp(reply.Response)}, nil
+}
+
+// vehicleDataTimestamp returns the oldest "timestamp" field, in milliseconds since the Unix epoch,
+// of the categories in a vehicle_data response.
+func vehicleDataTimestamp(response json.RawMessage) time.Time {
+	var categories map[string]json.RawMessage
+	if err := json.Unmarshal(response, &categories); err != nil {
+		return time.Time{}
+	}
+	var oldest time.Time
+	for _, raw := range categories {
+		var category struct {
+			Timestamp int64 `json:"timestamp"`
+		}
+		if err := json.Unmarshal(raw, &category); err != nil || category.Timestamp <= 0 {
+			continue
+		}
+		if t := time.UnixMilli(category.Timestamp); oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	return oldest
+}
@@ -0,0 +1,52 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVehicleDataTimestamp(t *testing.T) {
+	older := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	newer := time.Now().Truncate(time.Millisecond)
+	response := fmt.Sprintf(`{"id":1,"state":"online","charge_state":{"timestamp":%d},"climate_state":{"timestamp":%d}}`,
+		newer.UnixMilli(), older.UnixMilli())
+	if got := vehicleDataTimestamp([]byte(response)); !got.Equal(older) {
+		t.Errorf("Expected %s, got %s", older, got)
+	}
+	if got := vehicleDataTimestamp([]byte(`{"id":1}`)); !got.IsZero() {
+		t.Errorf("Expected zero timestamp, got %s", got)
+	}
+}
+
+func TestVehicleData(t *testing.T) {
+	timestamp := time.Now().Add(-time.Minute).UnixMilli()
+	var query string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query = req.URL.RawQuery
+		fmt.Fprintf(w, `{"response":{"charge_state":{"battery_level":80,"timestamp":%d}}}`, timestamp)
+	}))
+	defer server.Close()
+	acct := &Account{Host: strings.TrimPrefix(server.URL, "https://"), client: *server.Client()}
+
+	data, err := acct.VehicleData(context.Background(), "5YJ3E1EA7KF000001", VehicleDataOptions{
+		Endpoints:    []string{"charge_state", "climate_state"},
+		MaxStaleness: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "endpoints=charge_state%3Bclimate_state" {
+		t.Errorf("Unexpected query %q", query)
+	}
+	if data.Timestamp.UnixMilli() != timestamp || data.Age() < time.Minute {
+		t.Errorf("Unexpected timestamp %s", data.Timestamp)
+	}
+	if !strings.Contains(string(data.Response), `"battery_level":80`) {
+		t.Errorf("Unexpected response %s", data.Response)
+	}
+}
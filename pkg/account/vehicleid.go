@@ -0,0 +1,166 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+)
+
+var (
+	// ErrUnknownVehicleID indicates that none of the account's vehicles has the requested ID.
+	ErrUnknownVehicleID = errors.New("no vehicle with that ID in account")
+	// ErrAmbiguousVehicleID indicates that the requested ID matches more than one of the
+	// account's vehicles.
+	ErrAmbiguousVehicleID = errors.New("vehicle ID matches more than one vehicle in account")
+)
+
+const (
+	vinCacheSize = 4096
+	vinCacheTTL  = time.Hour
+	// maxVehiclePages bounds the number of vehicle list pages fetched while resolving an ID.
+	maxVehiclePages = 50
+)
+
+// vins caches the results of ResolveVIN. It's shared by all accounts, but keyed by account.
+var vins = newVINCache(vinCacheSize, vinCacheTTL)
+
+// IsVehicleID returns true if id is a numeric Fleet API vehicle ID rather than a VIN.
+func IsVehicleID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, c := range id {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveVIN returns the VIN of the vehicle identified by id, which may be a VIN or a numeric Fleet
+// API vehicle ID. VINs are returned unchanged. IDs are looked up in the account's vehicle list;
+// the result is cached, so later calls with the same ID don't contact Tesla's servers.
+//
+// ResolveVIN returns ErrUnknownVehicleID or ErrAmbiguousVehicleID if id doesn't identify exactly
+// one of the account's vehicles.
+func (a *Account) ResolveVIN(ctx context.Context, id string) (string, error) {
+	if !IsVehicleID(id) {
+		return id, nil
+	}
+	key := a.Subject + "@" + a.Host + "/" + id
+	if vin, ok := vins.get(key); ok {
+		return vin, nil
+	}
+	vin, err := a.lookupVIN(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	vins.put(key, vin)
+	return vin, nil
+}
+
+// lookupVIN searches the account's vehicle list for vehicles whose id or vehicle_id field matches
+// id.
+func (a *Account) lookupVIN(ctx context.Context, id string) (string, error) {
+	var match string
+	for page := 1; page <= maxVehiclePages; page++ {
+		body, err := a.Get(ctx, fmt.Sprintf("api/1/vehicles?page=%d", page))
+		if err != nil {
+			return "", err
+		}
+		var reply struct {
+			Response []struct {
+				ID        json.Number `json:"id"`
+				VehicleID json.Number `json:"vehicle_id"`
+				VIN       string      `json:"vin"`
+			} `json:"response"`
+			Pagination struct {
+				Next *int `json:"next"`
+			} `json:"pagination"`
+		}
+		if err := json.Unmarshal(body, &reply); err != nil {
+			return "", fmt.Errorf("invalid vehicle list: %w", err)
+		}
+		for _, v := range reply.Response {
+			if v.ID.String() != id && v.VehicleID.String() != id {
+				continue
+			}
+			if match != "" && match != v.VIN {
+				return "", fmt.Errorf("%w: %s", ErrAmbiguousVehicleID, id)
+			}
+			match = v.VIN
+		}
+		if reply.Pagination.Next == nil {
+			break
+		}
+	}
+	if match == "" {
+		return "", fmt.Errorf("%w: %s", ErrUnknownVehicleID, id)
+	}
+	return match, nil
+}
+
+type vinCacheEntry struct {
+	vin     string
+	expires time.Time
+}
+
+// vinCache maps vehicle IDs to VINs. Entries expire after ttl, and the cache holds at most size
+// entries; when it's full, the entry closest to expiring is evicted.
+type vinCache struct {
+	lock    sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]vinCacheEntry
+	clock   clock.Clock
+}
+
+func newVINCache(size int, ttl time.Duration) *vinCache {
+	return &vinCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]vinCacheEntry),
+		clock:   clock.Real,
+	}
+}
+
+func (c *vinCache) get(key string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !c.clock.Now().Before(entry.expires) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.vin, true
+}
+
+func (c *vinCache) put(key, vin string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := c.clock.Now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.size {
+		var oldest string
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+				continue
+			}
+			if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+				oldest = k
+			}
+		}
+		if len(c.entries) >= c.size {
+			delete(c.entries, oldest)
+		}
+	}
+	c.entries[key] = vinCacheEntry{vin: vin, expires: now.Add(c.ttl)}
+}
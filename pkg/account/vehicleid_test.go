@@ -0,0 +1,100 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+)
+
+func TestIsVehicleID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"1492931337154643":  true,
+		"5YJ3E1EA7KF000001": false,
+		"":                  false,
+		"12a":               false,
+	} {
+		if got := IsVehicleID(id); got != want {
+			t.Errorf("IsVehicleID(%q) = %v, expected %v", id, got, want)
+		}
+	}
+}
+
+func TestResolveVIN(t *testing.T) {
+	pages := []string{
+		`{"response":[{"id":100,"vehicle_id":200,"vin":"5YJ3E1EA7KF000001"}],"pagination":{"next":2}}`,
+		`{"response":[{"id":101,"vehicle_id":100,"vin":"5YJ3E1EA7KF000002"},{"id":102,"vehicle_id":300,"vin":"5YJ3E1EA7KF000003"}],"pagination":{"next":null}}`,
+	}
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		var page int
+		fmt.Sscan(req.URL.Query().Get("page"), &page)
+		if req.URL.Path != "/api/1/vehicles" || page < 1 || page > len(pages) {
+			http.NotFound(w, req)
+			return
+		}
+		fmt.Fprint(w, pages[page-1])
+	}))
+	defer server.Close()
+	vins = newVINCache(vinCacheSize, vinCacheTTL)
+	acct := &Account{Subject: "test", Host: strings.TrimPrefix(server.URL, "https://"), client: *server.Client()}
+	ctx := context.Background()
+
+	if vin, err := acct.ResolveVIN(ctx, "5YJ3E1EA7KF000009"); err != nil || vin != "5YJ3E1EA7KF000009" {
+		t.Errorf("VIN wasn't returned unchanged: %s %s", vin, err)
+	}
+	if requests != 0 {
+		t.Errorf("Resolving a VIN made %d requests", requests)
+	}
+	for id, want := range map[string]string{"102": "5YJ3E1EA7KF000003", "200": "5YJ3E1EA7KF000001"} {
+		if vin, err := acct.ResolveVIN(ctx, id); err != nil || vin != want {
+			t.Errorf("ResolveVIN(%s) = %s %v, expected %s", id, vin, err, want)
+		}
+	}
+
+	requests = 0
+	if vin, err := acct.ResolveVIN(ctx, "102"); err != nil || vin != "5YJ3E1EA7KF000003" || requests != 0 {
+		t.Errorf("Resolved ID wasn't cached: %s %v (%d requests)", vin, err, requests)
+	}
+	if _, err := acct.ResolveVIN(ctx, "100"); !errors.Is(err, ErrAmbiguousVehicleID) {
+		t.Errorf("Expected ambiguous ID error, got %v", err)
+	}
+	if _, err := acct.ResolveVIN(ctx, "999"); !errors.Is(err, ErrUnknownVehicleID) {
+		t.Errorf("Expected unknown ID error, got %v", err)
+	}
+
+	// Mappings aren't shared between accounts.
+	other := &Account{Subject: "other", Host: acct.Host, client: *server.Client()}
+	requests = 0
+	if _, err := other.ResolveVIN(ctx, "102"); err != nil || requests == 0 {
+		t.Errorf("Expected lookup for a different account: %v (%d requests)", err, requests)
+	}
+}
+
+func TestVINCache(t *testing.T) {
+	fakeClock := clock.NewFake(time.Unix(1700000000, 0))
+	c := newVINCache(2, time.Minute)
+	c.clock = fakeClock
+
+	c.put("a", "VIN-A")
+	fakeClock.Advance(time.Second)
+	c.put("b", "VIN-B")
+	c.put("c", "VIN-C")
+	if _, ok := c.get("a"); ok {
+		t.Errorf("Oldest entry wasn't evicted from full cache")
+	}
+	if vin, ok := c.get("b"); !ok || vin != "VIN-B" {
+		t.Errorf("Unexpected entry for b: %s %v", vin, ok)
+	}
+	fakeClock.Advance(time.Minute)
+	if _, ok := c.get("c"); ok {
+		t.Errorf("Entry didn't expire")
+	}
+}
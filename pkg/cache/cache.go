@@ -2,18 +2,33 @@ package cache
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/teslamotors/vehicle-command/internal/dispatcher"
+	logger "github.com/teslamotors/vehicle-command/internal/log"
 )
 
+var log = logger.Module(logger.ModuleCache)
+
+// DefaultCounterMargin is the number of counter values skipped when a session is restored from a
+// SessionCache returned by New or Import. It should exceed the number of commands a client might
+// send between saving the cache and crashing.
+const DefaultCounterMargin = 32
+
 type SessionCache struct {
 	MaxEntries int
 	Vehicles   map[string][]dispatcher.CacheEntry `json:"vehicles"`
-	lock       sync.Mutex
+	// CounterMargin is added to each session's counter when the session is loaded into a vehicle.
+	// Restored sessions therefore never reuse a counter that was consumed after the cache was
+	// saved, at the cost of skipping unused ones. Set it to zero to restore counters exactly.
+	CounterMargin uint32 `json:"-"`
+	lock          sync.Mutex
 }
 
 // New returns a SessionCache with that holds session state for up to maxEntries vehicles.
@@ -24,15 +39,16 @@ type SessionCache struct {
 // Set maxEntries to zero for an unbounded cache.
 func New(maxEntries int) *SessionCache {
 	return &SessionCache{
-		MaxEntries: maxEntries,
-		Vehicles:   make(map[string][]dispatcher.CacheEntry),
+		MaxEntries:    maxEntries,
+		Vehicles:      make(map[string][]dispatcher.CacheEntry),
+		CounterMargin: DefaultCounterMargin,
 	}
 }
 
 // Import a SessionCache using data in r.
 // The data should previously have been generated using [SessionCache.Export].
 func Import(r io.Reader) (*SessionCache, error) {
-	var cache SessionCache
+	cache := SessionCache{CounterMargin: DefaultCounterMargin}
 	decoder := json.NewDecoder(r)
 	if err := decoder.Decode(&cache); err != nil {
 		return nil, err
@@ -59,15 +75,52 @@ func (c *SessionCache) Export(w io.Writer) error {
 	return json.NewEncoder(w).Encode(c)
 }
 
-// ExportToFile writes a SessionCache to disk.
+// ExportToFile writes a SessionCache to disk. The file is replaced atomically, so readers never
+// observe a partially written cache.
 func (c *SessionCache) ExportToFile(filename string) error {
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	file, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer os.Remove(file.Name())
+	if err := c.Export(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
+}
 
-	return c.Export(file)
+// SyncFile merges c with the sessions stored in filename and writes the result back to filename.
+// Sessions in c take precedence; sessions for other VINs are copied from the file into c.
+//
+// SyncFile holds an exclusive lock on filename + ".lock" while it runs, so multiple processes can
+// share a cache file without discarding each other's sessions.
+func (c *SessionCache) SyncFile(filename string) error {
+	lock, err := os.OpenFile(filename+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	if stored, err := ImportFromFile(filename); err == nil {
+		c.lock.Lock()
+		for vin, sessions := range stored.Vehicles {
+			if _, ok := c.Vehicles[vin]; !ok {
+				c.Vehicles[vin] = sessions
+			}
+		}
+		c.lock.Unlock()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		log.Warning("Discarding unreadable session cache %s: %s", filename, err)
+	}
+	return c.ExportToFile(filename)
 }
 
 // Update the SessionCache's entry for a vin with current state.
@@ -96,11 +149,21 @@ func (c *SessionCache) Update(vin string, sessions []dispatcher.CacheEntry) erro
 				oldestCreationTime = mostRecent
 			}
 		}
+		log.Debug("Evicting cached sessions for %s", oldestVIN)
 		delete(c.Vehicles, oldestVIN)
 	}
 	return nil
 }
 
+// Delete removes the sessions associated with vin, so that the next client to load sessions from
+// the SessionCache performs a new handshake with the vehicle.
+func (c *SessionCache) Delete(vin string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.Vehicles, vin)
+}
+
 // GetEntry returns the sessions associated with vin.
 // This method intended for use by the internal dispatcher package; other clients should have no
 // use for it.
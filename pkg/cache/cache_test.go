@@ -2,7 +2,9 @@ package cache
 
 import (
 	"bytes"
+	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -97,3 +99,46 @@ func TestEviction(t *testing.T) {
 	_ = c.Update("1", generateTestSessions(1))
 	verifyCache(t, c, []int{4, 5, 6, 7, 8})
 }
+
+func TestDelete(t *testing.T) {
+	c := generateTestCache(t, 3)
+	c.Delete("1")
+	c.Delete("not-cached")
+	verifyCache(t, c, []int{0, 2})
+}
+
+func TestSyncFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cache.json")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := New(0)
+			_ = c.Update(strconv.Itoa(i), generateTestSessions(i))
+			if err := c.SyncFile(filename); err != nil {
+				t.Errorf("SyncFile failed: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	c, err := ImportFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyCache(t, c, []int{0, 1, 2, 3, 4, 5, 6, 7})
+
+	// Sessions in memory replace sessions on disk.
+	c = New(0)
+	_ = c.Update("0", generateTestSessions(0)[:1])
+	if err := c.SyncFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = ImportFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Vehicles) != 8 || len(c.Vehicles["0"]) != 1 {
+		t.Errorf("Expected updated entry to replace stored entry")
+	}
+}
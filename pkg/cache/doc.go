@@ -14,6 +14,14 @@
 //
 // The same SessionCache may safely be used with different VINs.
 //
+// Saving a SessionCache and sending a command are not atomic: a client that exits abnormally after
+// sending a command, but before saving the cache, leaves a counter in the file that the vehicle has
+// already seen. To keep the next command from being rejected, sessions skip ahead by
+// [SessionCache.CounterMargin] counter values when they're restored.
+//
+// Processes that share a cache file should save it using [SessionCache.SyncFile], which merges
+// sessions written by other processes instead of overwriting them.
+//
 // If a SessionCache is exported using its [SessionCache.Export] or [SessionCache.ExportToFile]
 // methods, access controls should be used to prevent third parties from reading or tampering with
 // the data.
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package cache
+
+import "os"
+
+// Advisory locks aren't available through the standard library on this platform. SyncFile still
+// replaces the file atomically, so concurrent writers may lose each other's sessions but can't
+// corrupt the file.
+
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,445 @@
+/*
+Package catalog describes the vehicle commands supported by this SDK's tools: their names in the
+HTTP proxy's REST API and in tesla-control, parameters, help text, and the vehicle domain that
+executes them.
+
+The HTTP proxy and tesla-control both build their dispatch tables from this package, so it's also
+the authoritative list for clients, such as web interfaces, that want to render available commands
+without maintaining their own copy.
+*/
+package catalog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// Type is the JSON type of a parameter.
+type Type string
+
+const (
+	TypeString Type = "string"
+	TypeNumber Type = "number"
+	TypeBool   Type = "boolean"
+)
+
+// Domains that execute commands. These match the names accepted by tesla-control's -domain flag.
+const (
+	DomainVCSEC        = "VCSEC"
+	DomainInfotainment = "INFOTAINMENT"
+)
+
+var domainNames = map[universal.Domain]string{
+	universal.Domain_DOMAIN_VEHICLE_SECURITY: DomainVCSEC,
+	universal.Domain_DOMAIN_INFOTAINMENT:     DomainInfotainment,
+}
+
+// Handling describes how the HTTP proxy processes a command.
+type Handling string
+
+const (
+	// HandlingSigned commands are signed by the proxy and sent to the vehicle. This is the default.
+	HandlingSigned Handling = ""
+	// HandlingForwarded commands are forwarded to Tesla's servers without modification.
+	HandlingForwarded Handling = "forwarded"
+	// HandlingNotImplemented commands are rejected by the proxy.
+	HandlingNotImplemented Handling = "not_implemented"
+)
+
+// Role is the least-privileged key role that can authorize a command. See the "Roles" section of
+// pkg/protocol/protocol.md.
+type Role string
+
+const (
+	// RoleDriver commands can be authorized by Driver keys and above. This is the default.
+	RoleDriver Role = ""
+	// RoleOwner commands configure access controls, such as PINs, and require an Owner or Fleet
+	// Manager key.
+	RoleOwner Role = "owner"
+)
+
+// Parameter describes a REST API JSON body field or a tesla-control positional argument.
+type Parameter struct {
+	Name     string   `json:"name"`
+	Type     Type     `json:"type"`
+	Required bool     `json:"required"`
+	Values   []string `json:"values,omitempty"` // Permitted values, if restricted
+	// Integer is true if numbers must be whole.
+	Integer bool `json:"integer,omitempty"`
+	// Minimum and Maximum bound numbers, if set.
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+	// Pattern is a regular expression that strings must match, if set. Patterns are anchored
+	// explicitly, since JSON Schema patterns aren't.
+	Pattern string `json:"pattern,omitempty"`
+	Help    string `json:"help,omitempty"`
+}
+
+// Command describes a command available through the REST API, tesla-control, or both.
+type Command struct {
+	// Name is the command's REST API name, as in /api/1/vehicles/{VIN}/command/{Name}. It's empty
+	// for commands that only tesla-control supports.
+	Name string `json:"name,omitempty"`
+	// CLIName is the tesla-control command name. It's empty for commands that tesla-control
+	// doesn't support.
+	CLIName string `json:"cli_name,omitempty"`
+	// CLIAliases are alternative tesla-control names for the command.
+	CLIAliases []string `json:"cli_aliases,omitempty"`
+	Help       string   `json:"help"`
+	// Domain is the vehicle subsystem that executes the command, if there's exactly one. For REST
+	// API commands, it's taken from [vehicle.CommandDomains].
+	Domain string `json:"domain,omitempty"`
+	// RequiresKey is true if the command must be authorized by a key enrolled on the vehicle.
+	RequiresKey bool `json:"requires_key"`
+	// Role is the minimum role of the key that authorizes the command, if RequiresKey is true.
+	Role Role `json:"role,omitempty"`
+	// RequiresFleetAPI is true if the command is executed by Tesla's servers and therefore
+	// requires an OAuth token.
+	RequiresFleetAPI bool     `json:"requires_fleet_api"`
+	Handling         Handling `json:"handling,omitempty"`
+	// QueryString is true if the proxy accepts the command as a GET request with parameters in
+	// the query string.
+	QueryString bool `json:"query_string,omitempty"`
+	// Request is the zero value of the struct that holds the command's JSON body, such as
+	// ChargeLimitRequest{}. It's nil for commands without parameters.
+	Request interface{} `json:"-"`
+	// Parameters are the REST API's JSON body fields. They're derived from Request.
+	Parameters []Parameter `json:"parameters,omitempty"`
+	// Arguments are tesla-control's positional arguments, in order. Required arguments precede
+	// optional ones.
+	Arguments []Parameter `json:"arguments,omitempty"`
+}
+
+var (
+	byName    = make(map[string]*Command)
+	byCLIName = make(map[string]*Command)
+)
+
+func init() {
+	for i := range commands {
+		c := &commands[i]
+		if domain, ok := vehicle.CommandDomains[c.Name]; ok {
+			c.Domain = domainNames[domain]
+		}
+		if c.Request != nil {
+			c.Parameters = parametersOf(reflect.TypeOf(c.Request))
+		}
+		for _, param := range append(c.Parameters, c.Arguments...) {
+			if param.Pattern != "" {
+				patterns[param.Pattern] = regexp.MustCompile(param.Pattern)
+			}
+		}
+		if c.Name != "" {
+			if _, ok := byName[c.Name]; ok {
+				panic("duplicate command " + c.Name)
+			}
+			byName[c.Name] = c
+		}
+		if c.CLIName != "" {
+			if _, ok := byCLIName[c.CLIName]; ok {
+				panic("duplicate command " + c.CLIName)
+			}
+			byCLIName[c.CLIName] = c
+		}
+		for _, alias := range c.CLIAliases {
+			if _, ok := byCLIName[alias]; ok || c.CLIName == "" {
+				panic("duplicate or unexpected alias " + alias)
+			}
+			byCLIName[alias] = c
+		}
+	}
+}
+
+// Commands returns every command in the catalog.
+func Commands() []Command {
+	return append([]Command(nil), commands...)
+}
+
+// Lookup returns the command with the REST API name name.
+func Lookup(name string) (*Command, bool) {
+	c, ok := byName[name]
+	return c, ok
+}
+
+// LookupCLI returns the tesla-control command name. The name may be one of the command's
+// CLIAliases.
+func LookupCLI(name string) (*Command, bool) {
+	c, ok := byCLIName[name]
+	return c, ok
+}
+
+// MarshalJSON renders the catalog as a JSON object with a "commands" array. If indent is
+// non-empty, the output is pretty-printed.
+func MarshalJSON(indent string) ([]byte, error) {
+	listing := struct {
+		Commands []Command `json:"commands"`
+	}{commands}
+	if indent == "" {
+		return json.Marshal(listing)
+	}
+	return json.MarshalIndent(listing, "", indent)
+}
+
+// PermittedFor returns false if a key with the given role cannot authorize c. Roles whose
+// capabilities aren't described by the catalog, such as ROLE_NONE, are permitted; the vehicle
+// makes the final decision.
+func (c *Command) PermittedFor(role keys.Role) bool {
+	if !c.RequiresKey || c.Role != RoleOwner {
+		return true
+	}
+	switch role {
+	case keys.Role_ROLE_DRIVER, keys.Role_ROLE_GUEST, keys.Role_ROLE_CHARGING_MANAGER, keys.Role_ROLE_VEHICLE_MONITOR:
+		return false
+	}
+	return true
+}
+
+// Parameter returns the REST API parameter name.
+func (c *Command) Parameter(name string) (*Parameter, bool) {
+	for i := range c.Parameters {
+		if c.Parameters[i].Name == name {
+			return &c.Parameters[i], true
+		}
+	}
+	return nil, false
+}
+
+// ParameterError indicates that a REST API request is missing a required parameter, has a
+// parameter with the wrong type or value, or has a parameter that the command doesn't accept.
+type ParameterError struct {
+	Name       string
+	Missing    bool
+	Unexpected bool
+	// Constraint describes the values that an invalid parameter accepts, such as "must be an
+	// integer between 50 and 100". It never includes the rejected value, which may be a PIN.
+	Constraint string
+}
+
+func (e *ParameterError) Error() string {
+	switch {
+	case e.Missing:
+		return fmt.Sprintf("missing %s param", e.Name)
+	case e.Unexpected:
+		return fmt.Sprintf("unexpected %s param", e.Name)
+	case e.Constraint != "":
+		return fmt.Sprintf("invalid %s param: %s", e.Name, e.Constraint)
+	}
+	return fmt.Sprintf("invalid %s param", e.Name)
+}
+
+// Validate checks that params, decoded from a JSON body, contains the command's required
+// parameters and that known parameters have the expected types and values. Unrecognized parameters
+// are permitted for compatibility with clients written for the Fleet API.
+func (c *Command) Validate(params map[string]interface{}) error {
+	return c.validate(params, false)
+}
+
+// ValidateStrict is like Validate, but also rejects unrecognized parameters.
+func (c *Command) ValidateStrict(params map[string]interface{}) error {
+	return c.validate(params, true)
+}
+
+func (c *Command) validate(params map[string]interface{}, strict bool) error {
+	for _, param := range c.Parameters {
+		value, ok := params[param.Name]
+		if !ok {
+			if param.Required {
+				return &ParameterError{Name: param.Name, Missing: true}
+			}
+			continue
+		}
+		if !param.Accepts(value) {
+			return &ParameterError{Name: param.Name, Constraint: param.Constraint()}
+		}
+	}
+	if !strict {
+		return nil
+	}
+	var unexpected []string
+	for name := range params {
+		if _, ok := c.Parameter(name); !ok {
+			unexpected = append(unexpected, name)
+		}
+	}
+	if len(unexpected) > 0 {
+		sort.Strings(unexpected)
+		return &ParameterError{Name: unexpected[0], Unexpected: true}
+	}
+	return nil
+}
+
+// DecodeRequest validates the JSON body data and decodes it into a pointer to a new value of the
+// command's Request type, such as *ChargeLimitRequest. Commands without a Request type return nil.
+// Like Validate, it ignores unrecognized parameters.
+func (c *Command) DecodeRequest(data []byte) (interface{}, error) {
+	return c.decodeRequest(data, false)
+}
+
+// DecodeRequestStrict is like DecodeRequest, but also rejects unrecognized parameters.
+func (c *Command) DecodeRequestStrict(data []byte) (interface{}, error) {
+	return c.decodeRequest(data, true)
+}
+
+func (c *Command) decodeRequest(data []byte, strict bool) (interface{}, error) {
+	var params map[string]interface{}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &params); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.validate(params, strict); err != nil {
+		return nil, err
+	}
+	if c.Request == nil {
+		return nil, nil
+	}
+	request := reflect.New(reflect.TypeOf(c.Request))
+	if len(params) > 0 {
+		if err := json.Unmarshal(data, request.Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return request.Interface(), nil
+}
+
+// Accepts returns true if value, decoded from JSON, has the parameter's type and is one of its
+// permitted values.
+func (p *Parameter) Accepts(value interface{}) bool {
+	switch p.Type {
+	case TypeNumber:
+		n, ok := value.(float64)
+		return ok && (!p.Integer || n == math.Trunc(n)) &&
+			(p.Minimum == nil || n >= *p.Minimum) && (p.Maximum == nil || n <= *p.Maximum)
+	case TypeBool:
+		_, ok := value.(bool)
+		return ok
+	case TypeString:
+		s, ok := value.(string)
+		if !ok || !p.matchesPattern(s) {
+			return false
+		}
+		if len(p.Values) == 0 {
+			return true
+		}
+		for _, v := range p.Values {
+			if s == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Constraint describes the values that Accepts returns true for.
+func (p *Parameter) Constraint() string {
+	switch p.Type {
+	case TypeBool:
+		return "must be a boolean"
+	case TypeString:
+		switch {
+		case len(p.Values) > 0:
+			return "must be one of " + strings.Join(p.Values, ", ")
+		case p.Pattern != "":
+			return "must match " + p.Pattern
+		}
+		return "must be a string"
+	}
+	kind := "a number"
+	if p.Integer {
+		kind = "an integer"
+	}
+	switch {
+	case p.Minimum != nil && p.Maximum != nil:
+		return fmt.Sprintf("must be %s between %g and %g", kind, *p.Minimum, *p.Maximum)
+	case p.Minimum != nil:
+		return fmt.Sprintf("must be %s no less than %g", kind, *p.Minimum)
+	case p.Maximum != nil:
+		return fmt.Sprintf("must be %s no greater than %g", kind, *p.Maximum)
+	}
+	return "must be " + kind
+}
+
+// parametersOf returns the parameters described by the fields of t, a Request struct type. See
+// requests.go for the struct tags it understands. It panics if a field can't be described, so
+// mistakes are caught when the package is initialized.
+func parametersOf(t reflect.Type) []Parameter {
+	var params []Parameter
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			panic(fmt.Sprintf("%s.%s has no JSON name", t.Name(), field.Name))
+		}
+		param := Parameter{
+			Name:     name,
+			Required: field.Type.Kind() != reflect.Pointer,
+			Pattern:  field.Tag.Get("pattern"),
+			Help:     field.Tag.Get("help"),
+		}
+		if values := field.Tag.Get("enum"); values != "" {
+			param.Values = strings.Split(values, ",")
+		}
+		kind := field.Type.Kind()
+		if kind == reflect.Pointer {
+			kind = field.Type.Elem().Kind()
+		}
+		switch kind {
+		case reflect.Bool:
+			param.Type = TypeBool
+		case reflect.String:
+			param.Type = TypeString
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			param.Type, param.Integer = TypeNumber, true
+		case reflect.Float32, reflect.Float64:
+			param.Type = TypeNumber
+		default:
+			panic(fmt.Sprintf("%s.%s has unsupported type %s", t.Name(), field.Name, field.Type))
+		}
+		param.Minimum = tagBound(t, field, "min")
+		param.Maximum = tagBound(t, field, "max")
+		if (param.Type != TypeNumber && (param.Minimum != nil || param.Maximum != nil)) ||
+			(param.Type != TypeString && (param.Values != nil || param.Pattern != "")) {
+			panic(fmt.Sprintf("%s.%s has constraints that don't apply to its type", t.Name(), field.Name))
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// tagBound returns the number in field's key tag, or nil if it doesn't have one.
+func tagBound(t reflect.Type, field reflect.StructField, key string) *float64 {
+	tag, ok := field.Tag.Lookup(key)
+	if !ok {
+		return nil
+	}
+	x, err := strconv.ParseFloat(tag, 64)
+	if err != nil {
+		panic(fmt.Sprintf("%s.%s has invalid %s tag: %s", t.Name(), field.Name, key, err))
+	}
+	return &x
+}
+
+// patterns holds the compiled Pattern of each catalog parameter.
+var patterns = make(map[string]*regexp.Regexp)
+
+func (p *Parameter) matchesPattern(s string) bool {
+	if p.Pattern == "" {
+		return true
+	}
+	if re, ok := patterns[p.Pattern]; ok {
+		return re.MatchString(s)
+	}
+	matched, err := regexp.MatchString(p.Pattern, s)
+	return err == nil && matched
+}
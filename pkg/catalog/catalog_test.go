@@ -0,0 +1,289 @@
+package catalog
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+func TestCommandsAreWellFormed(t *testing.T) {
+	for _, c := range Commands() {
+		label := c.Name + c.CLIName
+		if c.Name == "" && c.CLIName == "" {
+			t.Errorf("Command with help %q has no name", c.Help)
+		}
+		if c.Help == "" {
+			t.Errorf("%s has no help text", label)
+		}
+		if c.Domain != "" && c.Domain != DomainVCSEC && c.Domain != DomainInfotainment {
+			t.Errorf("%s has unknown domain %s", label, c.Domain)
+		}
+		optional := false
+		for _, arg := range c.Arguments {
+			if !arg.Required {
+				optional = true
+			} else if optional {
+				t.Errorf("%s has required argument %s after an optional argument", label, arg.Name)
+			}
+		}
+		if c.QueryString && c.Name == "" {
+			t.Errorf("%s accepts query strings but isn't a REST API command", label)
+		}
+		for _, param := range c.Parameters {
+			if param.Type != TypeString && param.Type != TypeNumber && param.Type != TypeBool {
+				t.Errorf("%s parameter %s has unknown type %s", label, param.Name, param.Type)
+			}
+		}
+	}
+}
+
+func TestCommandDomains(t *testing.T) {
+	for name := range vehicle.CommandDomains {
+		if _, ok := Lookup(name); !ok {
+			t.Errorf("vehicle.CommandDomains lists %s, which isn't in the catalog", name)
+		}
+	}
+	for _, c := range Commands() {
+		if c.Name != "" && c.RequiresKey && c.Domain == "" {
+			t.Errorf("%s requires a key but has no domain; add it to vehicle.CommandDomains", c.Name)
+		}
+	}
+	if c, _ := Lookup("door_lock"); c.Domain != DomainVCSEC {
+		t.Errorf("Expected door_lock to be sent to VCSEC, got %q", c.Domain)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	c, _ := Lookup("window_control")
+	schema := c.Schema()
+	if schema.Type != "object" || !schema.AdditionalProperties {
+		t.Errorf("Unexpected schema %+v", schema)
+	}
+	command, ok := schema.Properties["command"]
+	if !ok || command.Type != TypeString || len(command.Enum) != 2 {
+		t.Errorf("Unexpected command property %+v", command)
+	}
+	found := false
+	for _, name := range schema.Required {
+		found = found || name == "command"
+	}
+	if !found {
+		t.Errorf("command isn't required: %v", schema.Required)
+	}
+	if len(schema.Properties) != len(c.Parameters) {
+		t.Errorf("Expected %d properties, got %d", len(c.Parameters), len(schema.Properties))
+	}
+}
+
+func TestParameterConstraints(t *testing.T) {
+	c, _ := Lookup("speed_limit_set_limit")
+	limit, _ := c.Parameter("limit_mph")
+	for value, want := range map[float64]bool{49.9: false, 50: true, 120: true, 120.5: false} {
+		if got := limit.Accepts(value); got != want {
+			t.Errorf("limit_mph accepts %v = %v, expected %v", value, got, want)
+		}
+	}
+	c, _ = Lookup("speed_limit_activate")
+	pin, _ := c.Parameter("pin")
+	for value, want := range map[string]bool{"1234": true, "0000": true, "123": false, "12345": false, "12a4": false, "": false} {
+		if got := pin.Accepts(value); got != want {
+			t.Errorf("pin accepts %q = %v, expected %v", value, got, want)
+		}
+	}
+
+	schema := c.Schema()
+	if schema.Properties["pin"].Pattern != pinPattern {
+		t.Errorf("Schema is missing pin pattern: %+v", schema.Properties["pin"])
+	}
+	c, _ = Lookup("speed_limit_set_limit")
+	property := c.Schema().Properties["limit_mph"]
+	if property.Minimum == nil || *property.Minimum != 50 || property.Maximum == nil || *property.Maximum != 120 {
+		t.Errorf("Schema is missing limit_mph bounds: %+v", property)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	c, ok := Lookup("set_charge_limit")
+	if !ok || c.CLIName != "charging-set-limit" {
+		t.Fatalf("Unexpected result for set_charge_limit: %+v", c)
+	}
+	if c, ok = LookupCLI("charging-set-limit"); !ok || c.Name != "set_charge_limit" {
+		t.Errorf("Unexpected result for charging-set-limit: %+v", c)
+	}
+	if _, ok = Lookup("charging-set-limit"); ok {
+		t.Errorf("Lookup should not match tesla-control names")
+	}
+	if c, ok = LookupCLI("charge-max"); !ok || c.Name != "charge_max_range" {
+		t.Errorf("Unexpected result for alias charge-max: %+v", c)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c, _ := Lookup("set_charging_schedule_mode")
+	tests := []struct {
+		params     map[string]interface{}
+		invalid    string
+		missing    bool
+		unexpected bool
+	}{
+		{map[string]interface{}{"mode": "departure", "time": 450.0}, "", false, false},
+		{map[string]interface{}{"mode": "off", "extra": "ignored"}, "", false, false},
+		{map[string]interface{}{"time": 450.0}, "mode", true, false},
+		{map[string]interface{}{"mode": "weekly"}, "mode", false, false},
+		{map[string]interface{}{"mode": "off", "time": "7:30"}, "time", false, false},
+		{map[string]interface{}{"mode": "off", "time": 1440.0}, "time", false, false},
+		{map[string]interface{}{"mode": "off", "time": 450.5}, "time", false, false},
+		{nil, "mode", true, false},
+	}
+	for _, test := range tests {
+		err := c.Validate(test.params)
+		if test.invalid == "" {
+			if err != nil {
+				t.Errorf("Unexpected error for %v: %s", test.params, err)
+			}
+			continue
+		}
+		paramErr, ok := err.(*ParameterError)
+		if !ok || paramErr.Name != test.invalid || paramErr.Missing != test.missing || paramErr.Unexpected != test.unexpected {
+			t.Errorf("Expected error for %s (missing=%v) with %v, got %v", test.invalid, test.missing, test.params, err)
+		}
+	}
+}
+
+func TestValidateStrict(t *testing.T) {
+	c, _ := Lookup("set_charging_schedule_mode")
+	err := c.ValidateStrict(map[string]interface{}{"mode": "off", "extra": "rejected", "another": 1.0})
+	if paramErr, ok := err.(*ParameterError); !ok || paramErr.Name != "another" || !paramErr.Unexpected {
+		t.Errorf("Expected unexpected parameter error, got %v", err)
+	}
+	if err := c.ValidateStrict(map[string]interface{}{"mode": "weekly"}); err == nil || err.Error() != "invalid mode param: must be one of off, start_time, departure" {
+		t.Errorf("Expected invalid mode error, got %v", err)
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	c, _ := Lookup("set_charge_limit")
+	request, err := c.DecodeRequest([]byte(`{"percent": 80}`))
+	if limit, ok := request.(*ChargeLimitRequest); err != nil || !ok || limit.Percent != 80 {
+		t.Errorf("Unexpected result %#v, %v", request, err)
+	}
+	rejected := map[string]string{
+		`{"percent": 49}`:               "invalid percent param: must be an integer between 50 and 100",
+		`{"percent": 80.5}`:             "invalid percent param: must be an integer between 50 and 100",
+		`{"percent": "80"}`:             "invalid percent param: must be an integer between 50 and 100",
+		`{}`:                            "missing percent param",
+		`{"percent": 80, "percent": 1}`: "invalid percent param: must be an integer between 50 and 100",
+	}
+	for body, want := range rejected {
+		if _, err := c.DecodeRequest([]byte(body)); err == nil || err.Error() != want {
+			t.Errorf("Expected %q for %s, got %v", want, body, err)
+		}
+	}
+
+	request, err = c.DecodeRequest([]byte(`{"percent": 80, "limit": 70}`))
+	if limit, ok := request.(*ChargeLimitRequest); err != nil || !ok || limit.Percent != 80 {
+		t.Errorf("Unexpected result with unrecognized parameter %#v, %v", request, err)
+	}
+	if _, err = c.DecodeRequestStrict([]byte(`{"percent": 80, "limit": 70}`)); err == nil || err.Error() != "unexpected limit param" {
+		t.Errorf("Expected strict decoding to reject unrecognized parameter, got %v", err)
+	}
+
+	c, _ = Lookup("window_control")
+	request, err = c.DecodeRequest([]byte(`{"command": "close", "lat": 37.4, "lon": -122.1}`))
+	if window, ok := request.(*WindowControlRequest); err != nil || !ok || window.Command != "close" || window.Lat == nil || *window.Lat != 37.4 {
+		t.Errorf("Unexpected result %#v, %v", request, err)
+	}
+	if _, err = c.DecodeRequest([]byte(`{"command": "close", "lat": 91}`)); err == nil || err.Error() != "invalid lat param: must be a number between -90 and 90" {
+		t.Errorf("Unexpected error for out-of-range latitude: %v", err)
+	}
+
+	c, _ = Lookup("speed_limit_activate")
+	if _, err = c.DecodeRequest([]byte(`{"pin": "12345"}`)); err == nil || err.Error() != "invalid pin param: must match "+pinPattern {
+		t.Errorf("Unexpected error for invalid PIN: %v", err)
+	}
+
+	c, _ = Lookup("honk_horn")
+	if request, err = c.DecodeRequest(nil); request != nil || err != nil {
+		t.Errorf("Unexpected result for command without parameters: %#v, %v", request, err)
+	}
+	if _, err = c.DecodeRequestStrict([]byte(`{"loud": true}`)); err == nil {
+		t.Errorf("Expected error for parameter of command without parameters")
+	}
+}
+
+func TestRequestTypes(t *testing.T) {
+	for _, c := range commands {
+		if c.Request == nil {
+			continue
+		}
+		// A body with each parameter at its zero value or bound should decode into Request.
+		body := make(map[string]interface{})
+		for _, param := range c.Parameters {
+			switch {
+			case len(param.Values) > 0:
+				body[param.Name] = param.Values[0]
+			case param.Pattern != "":
+				body[param.Name] = "1234"
+			case param.Type == TypeBool:
+				body[param.Name] = true
+			case param.Type == TypeString:
+				body[param.Name] = "x"
+			case param.Minimum != nil:
+				body[param.Name] = *param.Minimum
+			default:
+				body[param.Name] = 0.0
+			}
+		}
+		data, _ := json.Marshal(body)
+		if _, err := c.DecodeRequest(data); err != nil {
+			t.Errorf("%s: %s", c.Name, err)
+		}
+	}
+	c, _ := Lookup("speed_limit_set_limit")
+	limit, _ := c.Parameter("limit_mph")
+	if *limit.Minimum != vehicle.MinSpeedLimitMPH || *limit.Maximum != vehicle.MaxSpeedLimitMPH {
+		t.Errorf("limit_mph bounds don't match the vehicle package")
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	encoded, err := MarshalJSON("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listing struct {
+		Commands []Command `json:"commands"`
+	}
+	if err := json.Unmarshal(encoded, &listing); err != nil {
+		t.Fatal(err)
+	}
+	if len(listing.Commands) != len(commands) {
+		t.Errorf("Expected %d commands, got %d", len(commands), len(listing.Commands))
+	}
+}
+
+func TestPermittedFor(t *testing.T) {
+	pin, _ := Lookup("set_pin_to_drive")
+	honk, _ := Lookup("honk_horn")
+	wake, _ := Lookup("wake_up")
+	tests := []struct {
+		command *Command
+		role    keys.Role
+		ok      bool
+	}{
+		{pin, keys.Role_ROLE_OWNER, true},
+		{pin, keys.Role_ROLE_FM, true},
+		{pin, keys.Role_ROLE_DRIVER, false},
+		{pin, keys.Role_ROLE_GUEST, false},
+		{pin, keys.Role_ROLE_NONE, true},
+		{honk, keys.Role_ROLE_DRIVER, true},
+		{wake, keys.Role_ROLE_VEHICLE_MONITOR, true},
+	}
+	for _, test := range tests {
+		if ok := test.command.PermittedFor(test.role); ok != test.ok {
+			t.Errorf("%s with %s: expected %v but got %v", test.command.Name, test.role, test.ok, ok)
+		}
+	}
+}
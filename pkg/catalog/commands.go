@@ -0,0 +1,795 @@
+package catalog
+
+// copModes are the Cabin Overheat Protection modes accepted by set_cabin_overheat_protection.
+var copModes = []string{"off", "on", "no_ac", "fan_only"}
+
+// pinPattern matches four-digit PINs.
+const pinPattern = `^[0-9]{4}$`
+
+var speedLimitPINArgument = Parameter{Name: "PIN", Type: TypeString, Required: true, Pattern: pinPattern, Help: "Four-digit Speed Limit Mode PIN"}
+
+// commands lists REST API commands, grouped by category as in the Fleet API documentation,
+// followed by commands that only tesla-control supports. The domains of REST API commands are
+// filled in from vehicle.CommandDomains.
+var commands = []Command{
+	{
+		Name:        "adjust_volume",
+		CLIName:     "media-set-volume",
+		Help:        "Set media volume",
+		RequiresKey: true,
+		QueryString: true,
+		Request:     AdjustVolumeRequest{},
+		Arguments: []Parameter{
+			{Name: "VOLUME", Type: TypeString, Required: true, Help: "Set volume (0.0-10.0)"},
+		},
+	},
+	{
+		Name:     "remote_boombox",
+		Help:     "Play a sound through the external speaker",
+		Handling: HandlingNotImplemented,
+	},
+	{
+		Name:        "media_next_fav",
+		CLIName:     "media-next-favorite",
+		Help:        "Next favorite",
+		RequiresKey: true,
+	},
+	{
+		Name:        "media_prev_fav",
+		CLIName:     "media-previous-favorite",
+		Help:        "Previous favorite",
+		RequiresKey: true,
+	},
+	{
+		Name:        "media_next_track",
+		CLIName:     "media-next-track",
+		Help:        "Next track",
+		RequiresKey: true,
+	},
+	{
+		Name:        "media_prev_track",
+		CLIName:     "media-previous-track",
+		Help:        "Previous track",
+		RequiresKey: true,
+	},
+	{
+		Name:        "media_volume_down",
+		CLIName:     "media-volume-down",
+		Help:        "Decrease volume",
+		RequiresKey: true,
+	},
+	{
+		Name:        "media_volume_up",
+		CLIName:     "media-volume-up",
+		Help:        "Increase volume",
+		RequiresKey: true,
+	},
+	{
+		Name:        "media_toggle_playback",
+		CLIName:     "media-toggle-playback",
+		Help:        "Toggle between play/pause",
+		RequiresKey: true,
+	},
+	{
+		Name:        "auto_conditioning_start",
+		CLIName:     "climate-on",
+		Help:        "Turn on climate control",
+		RequiresKey: true,
+		QueryString: true,
+	},
+	{
+		Name:        "auto_conditioning_stop",
+		CLIName:     "climate-off",
+		Help:        "Turn off climate control",
+		RequiresKey: true,
+		QueryString: true,
+	},
+	{
+		Name:        "charge_max_range",
+		CLIName:     "charging-set-limit-max",
+		CLIAliases:  []string{"charge-max"},
+		Help:        "Set charge limit to the maximum range setting and report the resulting limit",
+		RequiresKey: true,
+		QueryString: true,
+	},
+	{
+		Name:        "remote_seat_cooler_request",
+		Help:        "Set seat cooler level",
+		RequiresKey: true,
+		Request:     RemoteSeatCoolerRequest{},
+	},
+	{
+		Name:        "remote_seat_heater_request",
+		CLIName:     "seat-heater",
+		Help:        "Set seat heater at POSITION to LEVEL",
+		RequiresKey: true,
+		Request:     RemoteSeatHeaterRequest{},
+		Arguments: []Parameter{
+			{Name: "SEAT", Type: TypeString, Required: true, Help: "<front|2nd-row|3rd-row>-<left|center|right> (e.g., 2nd-row-left)"},
+			{Name: "LEVEL", Type: TypeString, Required: true, Help: "off, low, medium, or high"},
+		},
+	},
+	{
+		Name:        "remote_auto_seat_climate_request",
+		CLIName:     "auto-seat-and-climate",
+		Help:        "Turn on automatic seat heating and HVAC",
+		RequiresKey: true,
+		Request:     RemoteAutoSeatClimateRequest{},
+		Arguments: []Parameter{
+			{Name: "POSITIONS", Type: TypeString, Required: true, Help: "'L' (left), 'R' (right), or 'LR'"},
+			{Name: "STATE", Type: TypeString, Help: "'on' (default) or 'off'"},
+		},
+	},
+	{
+		Name:        "remote_steering_wheel_heater_request",
+		CLIName:     "steering-wheel-heater",
+		Help:        "Set steering wheel mode to STATE ('on' or 'off')",
+		RequiresKey: true,
+		QueryString: true,
+		Request:     SteeringWheelHeaterRequest{},
+		Arguments: []Parameter{
+			{Name: "STATE", Type: TypeString, Required: true, Help: "'on' or 'off'"},
+		},
+	},
+	{
+		Name:        "set_bioweapon_mode",
+		Help:        "Set Bioweapon Defense Mode",
+		RequiresKey: true,
+		Request:     BioweaponModeRequest{},
+	},
+	{
+		Name:        "set_cabin_overheat_protection",
+		CLIName:     "cabin-overheat-protection",
+		Help:        "Set Cabin Overheat Protection mode and, optionally, the temperature at which it activates",
+		RequiresKey: true,
+		QueryString: true,
+		Request:     CabinOverheatProtectionRequest{},
+		Arguments: []Parameter{
+			{Name: "MODE", Type: TypeString, Required: true, Values: copModes, Help: "no_ac is the same as fan_only"},
+			{Name: "TEMP", Type: TypeString, Values: []string{"low", "medium", "high"}, Help: "Activation temperature"},
+		},
+	},
+	{
+		Name:        "set_climate_keeper_mode",
+		Help:        "Set Climate Keeper mode",
+		RequiresKey: true,
+		QueryString: true,
+		Request:     ClimateKeeperModeRequest{},
+	},
+	{
+		Name:        "set_cop_temp",
+		Help:        "Set Cabin Overheat Protection temperature",
+		RequiresKey: true,
+		Request:     CabinOverheatProtectionTempRequest{},
+	},
+	{
+		Name:        "set_preconditioning_max",
+		CLIName:     "defrost",
+		Help:        "Turn Max Defrost on or off",
+		RequiresKey: true,
+		QueryString: true,
+		Request:     PreconditioningMaxRequest{},
+		Arguments: []Parameter{
+			{Name: "STATE", Type: TypeString, Required: true, Help: "'on' or 'off'"},
+		},
+	},
+	{
+		Name:        "set_temps",
+		CLIName:     "climate-set-temp",
+		Help:        "Set driver and passenger temperatures and report the resulting setpoints",
+		RequiresKey: true,
+		QueryString: true,
+		Request:     TemperaturesRequest{},
+		Arguments: []Parameter{
+			{Name: "DRIVER", Type: TypeString, Required: true, Help: "Driver temperature (e.g., 70f or 21c; defaults to UNIT)"},
+			{Name: "PASSENGER", Type: TypeString, Help: "Passenger temperature (defaults to DRIVER)"},
+			{Name: "UNIT", Type: TypeString, Values: []string{"C", "F"}, Help: "Unit of temperatures without a suffix (default from -units)"},
+		},
+	},
+	{
+		Name:        "actuate_trunk",
+		Help:        "Open the front or rear trunk",
+		RequiresKey: true,
+		Request:     ActuateTrunkRequest{},
+	},
+	{
+		Name:        "charge_port_door_open",
+		CLIName:     "charge-port-open",
+		Help:        "Open charge port",
+		RequiresKey: true,
+		QueryString: true,
+	},
+	{
+		Name:        "charge_port_door_close",
+		CLIName:     "charge-port-close",
+		Help:        "Close charge port",
+		RequiresKey: true,
+		QueryString: true,
+	},
+	{
+		Name:        "flash_lights",
+		CLIName:     "flash-lights",
+		Help:        "Flash lights",
+		RequiresKey: true,
+	},
+	{
+		Name:        "honk_horn",
+		CLIName:     "honk",
+		Help:        "Honk horn",
+		RequiresKey: true,
+	},
+	{
+		Name:        "remote_start_drive",
+		CLIName:     "drive",
+		Help:        "Remote start vehicle",
+		RequiresKey: true,
+	},
+	{
+		Name:        "open_tonneau",
+		CLIName:     "tonneau-open",
+		Help:        "Open Cybertruck tonneau.",
+		RequiresKey: true,
+	},
+	{
+		Name:        "close_tonneau",
+		CLIName:     "tonneau-close",
+		Help:        "Close Cybertruck tonneau.",
+		RequiresKey: true,
+	},
+	{
+		Name:        "stop_tonneau",
+		CLIName:     "tonneau-stop",
+		Help:        "Stop moving Cybertruck tonneau.",
+		RequiresKey: true,
+	},
+	{
+		Name:        "set_low_power_mode",
+		CLIName:     "low-power-mode",
+		Help:        "Set low power mode to STATE ('on' or 'off')",
+		RequiresKey: true,
+		Request:     LowPowerModeRequest{},
+		Arguments: []Parameter{
+			{Name: "STATE", Type: TypeString, Required: true, Help: "'on' or 'off'"},
+		},
+	},
+	{
+		Name:        "charge_standard",
+		CLIName:     "charging-set-limit-standard",
+		CLIAliases:  []string{"charge-standard"},
+		Help:        "Set charge limit to the standard range setting and report the resulting limit",
+		RequiresKey: true,
+		QueryString: true,
+	},
+	{
+		Name:        "charge_start",
+		CLIName:     "charging-start",
+		Help:        "Start charging",
+		RequiresKey: true,
+		QueryString: true,
+	},
+	{
+		Name:        "charge_stop",
+		CLIName:     "charging-stop",
+		Help:        "Stop charging",
+		RequiresKey: true,
+		QueryString: true,
+	},
+	{
+		Name:        "set_charging_amps",
+		CLIName:     "charging-set-amps",
+		Help:        "Set charge current to AMPS",
+		RequiresKey: true,
+		QueryString: true,
+		Request:     ChargingAmpsRequest{},
+		Arguments: []Parameter{
+			{Name: "AMPS", Type: TypeString, Required: true, Help: "Charging current"},
+		},
+	},
+	{
+		Name:        "set_scheduled_charging",
+		CLIName:     "charging-schedule",
+		Help:        "Schedule charging to MINS minutes after midnight and enable daily scheduling",
+		RequiresKey: true,
+		Request:     ScheduledChargingRequest{},
+		Arguments: []Parameter{
+			{Name: "MINS", Type: TypeString, Required: true, Help: "Time after midnight in minutes"},
+		},
+	},
+	{
+		Name:        "set_charge_limit",
+		CLIName:     "charging-set-limit",
+		Help:        "Set charge limit to PERCENT",
+		RequiresKey: true,
+		QueryString: true,
+		Request:     ChargeLimitRequest{},
+		Arguments: []Parameter{
+			{Name: "PERCENT", Type: TypeString, Required: true, Help: "Charging limit"},
+		},
+	},
+	{
+		Name:        "set_scheduled_departure",
+		Help:        "Schedule charging and preconditioning for a departure time",
+		RequiresKey: true,
+		Request:     ScheduledDepartureRequest{},
+	},
+	{
+		Name:        "add_charge_schedule",
+		CLIName:     "charging-schedule-add",
+		Help:        "Schedule charge for DAYS START_TIME-END_TIME at LATITUDE LONGITUDE. The END_TIME may be on the following day.",
+		RequiresKey: true,
+		Request:     AddChargeScheduleRequest{},
+		Arguments: []Parameter{
+			{Name: "DAYS", Type: TypeString, Required: true, Help: "Comma-separated list of any of Sun, Mon, Tues, Wed, Thurs, Fri, Sat OR all OR weekdays"},
+			{Name: "TIME", Type: TypeString, Required: true, Help: "Time interval to charge (24- or 12-hour clock). Examples: '22:00-6:00', '10pm-6am', '-6:00', '20:32-"},
+			{Name: "LATITUDE", Type: TypeString, Required: true, Help: "Latitude of charging site"},
+			{Name: "LONGITUDE", Type: TypeString, Required: true, Help: "Longitude of charging site"},
+			{Name: "REPEAT", Type: TypeString, Help: "Set to 'once' or omit to repeat weekly"},
+			{Name: "ID", Type: TypeString, Help: "The ID of the charge schedule to modify. Not required for new schedules."},
+			{Name: "ENABLED", Type: TypeString, Help: "Whether the charge schedule is enabled. Expects 'true' or 'false'. Defaults to true."},
+		},
+	},
+	{
+		Name:        "add_precondition_schedule",
+		CLIName:     "precondition-schedule-add",
+		Help:        "Schedule precondition for DAYS TIME at LATITUDE LONGITUDE.",
+		RequiresKey: true,
+		Request:     AddPreconditionScheduleRequest{},
+		Arguments: []Parameter{
+			{Name: "DAYS", Type: TypeString, Required: true, Help: "Comma-separated list of any of Sun, Mon, Tues, Wed, Thurs, Fri, Sat OR all OR weekdays"},
+			{Name: "TIME", Type: TypeString, Required: true, Help: "Time to precondition by. Examples: '22:00', '10pm'"},
+			{Name: "LATITUDE", Type: TypeString, Required: true, Help: "Latitude of location to precondition at."},
+			{Name: "LONGITUDE", Type: TypeString, Required: true, Help: "Longitude of location to precondition at."},
+			{Name: "REPEAT", Type: TypeString, Help: "Set to 'once' or omit to repeat weekly"},
+			{Name: "ID", Type: TypeString, Help: "The ID of the precondition schedule to modify. Not required for new schedules."},
+			{Name: "ENABLED", Type: TypeString, Help: "Whether the precondition schedule is enabled. Expects 'true' or 'false'. Defaults to true."},
+		},
+	},
+	{
+		Name:        "remove_charge_schedule",
+		CLIName:     "charging-schedule-remove",
+		Help:        "Removes charging schedule of TYPE [ID]",
+		RequiresKey: true,
+		Request:     RemoveScheduleRequest{},
+		Arguments: []Parameter{
+			{Name: "TYPE", Type: TypeString, Required: true, Help: "home|work|other|id"},
+			{Name: "ID", Type: TypeString, Help: "numeric ID of schedule to remove when TYPE set to id"},
+		},
+	},
+	{
+		Name:        "set_charging_schedule_mode",
+		CLIName:     "charging-schedule-mode",
+		Help:        "Set charging schedule MODE to off, start_time, or departure, starting or departing at TIME",
+		RequiresKey: true,
+		Request:     ChargingScheduleModeRequest{},
+		Arguments: []Parameter{
+			{Name: "MODE", Type: TypeString, Required: true, Help: "off|start_time|departure"},
+			{Name: "TIME", Type: TypeString, Help: "Charging start time or departure time (24- or 12-hour clock). Required unless MODE is off. Examples: '7:30', '7:30am'"},
+		},
+	},
+	{
+		Name:        "get_off_peak_charging",
+		CLIName:     "charging-off-peak",
+		Help:        "Show off-peak charging settings",
+		RequiresKey: true,
+		QueryString: true,
+	},
+	{
+		Name:        "get_charge_state",
+		Help:        "Show the vehicle's battery level, range in kilometers and miles, charging power, and time to full charge",
+		RequiresKey: true,
+		QueryString: true,
+	},
+	{
+		Name:        "get_location",
+		Help:        "Show the vehicle's GPS position, heading, and speed. The proxy only accepts this command if started with -allow-location.",
+		RequiresKey: true,
+		QueryString: true,
+	},
+	{
+		Name:        "set_off_peak_charging",
+		CLIName:     "charging-set-off-peak",
+		Help:        "Turn off-peak charging on or off. Off-peak charging ends at END_TIME, on all DAYS or weekdays only. Turning it on also enables scheduled departure.",
+		RequiresKey: true,
+		Request:     OffPeakChargingRequest{},
+		Arguments: []Parameter{
+			{Name: "STATE", Type: TypeString, Required: true, Help: "on|off"},
+			{Name: "END_TIME", Type: TypeString, Help: "End of off-peak hours (24- or 12-hour clock). Required if STATE is on. Examples: '6:00', '6am'"},
+			{Name: "DAYS", Type: TypeString, Help: "all|weekdays (default: all)"},
+		},
+	},
+	{
+		Name:        "remove_precondition_schedule",
+		CLIName:     "precondition-schedule-remove",
+		Help:        "Removes precondition schedule of TYPE [ID]",
+		RequiresKey: true,
+		Request:     RemoveScheduleRequest{},
+		Arguments: []Parameter{
+			{Name: "TYPE", Type: TypeString, Required: true, Help: "home|work|other|id"},
+			{Name: "ID", Type: TypeString, Help: "numeric ID of schedule to remove when TYPE set to id"},
+		},
+	},
+	{
+		Name:             "set_managed_charge_current_request",
+		Help:             "Set managed charging current",
+		RequiresFleetAPI: true,
+		Handling:         HandlingForwarded,
+	},
+	{
+		Name:             "set_managed_charger_location",
+		Help:             "Set managed charger location",
+		RequiresFleetAPI: true,
+		Handling:         HandlingForwarded,
+	},
+	{
+		Name:             "set_managed_scheduled_charging_time",
+		Help:             "Set managed scheduled charging time",
+		RequiresFleetAPI: true,
+		Handling:         HandlingForwarded,
+	},
+	{
+		Name:        "wake_up",
+		CLIName:     "wake",
+		Help:        "Wake up vehicle",
+		QueryString: true,
+	},
+	{
+		Name:        "set_pin_to_drive",
+		Help:        "Enable or disable PIN to Drive",
+		RequiresKey: true,
+		Role:        RoleOwner,
+		Request:     PINToDriveRequest{},
+	},
+	{
+		Name:        "clear_pin_to_drive_admin",
+		Help:        "Clear the PIN to Drive PIN (fleet manager only)",
+		RequiresKey: true,
+		Role:        RoleOwner,
+	},
+	{
+		Name:        "door_lock",
+		CLIName:     "lock",
+		Help:        "Lock vehicle",
+		RequiresKey: true,
+		QueryString: true,
+		Request:     DoorLockRequest{},
+	},
+	{
+		Name:        "door_unlock",
+		CLIName:     "unlock",
+		Help:        "Unlock vehicle",
+		RequiresKey: true,
+		Request:     DoorLockRequest{},
+	},
+	{
+		Name:        "erase_user_data",
+		CLIName:     "erase-guest-data",
+		Help:        "Erase Guest Mode user data",
+		RequiresKey: true,
+	},
+	{
+		Name:        "reset_pin_to_drive_pin",
+		Help:        "Reset the PIN to Drive PIN",
+		RequiresKey: true,
+		Role:        RoleOwner,
+	},
+	{
+		Name:        "reset_valet_pin",
+		Help:        "Reset the valet mode PIN",
+		RequiresKey: true,
+		Role:        RoleOwner,
+	},
+	{
+		Name:        "guest_mode",
+		Help:        "Enable or disable Guest Mode",
+		RequiresKey: true,
+		Role:        RoleOwner,
+		Request:     GuestModeRequest{},
+	},
+	{
+		Name:        "set_sentry_mode",
+		CLIName:     "sentry-mode",
+		Help:        "Set sentry mode to STATE ('on' or 'off')",
+		RequiresKey: true,
+		QueryString: true,
+		Request:     SentryModeRequest{},
+		Arguments: []Parameter{
+			{Name: "STATE", Type: TypeString, Required: true, Help: "'on' or 'off'"},
+		},
+	},
+	{
+		Name:        "set_valet_mode",
+		Help:        "Enable or disable valet mode",
+		RequiresKey: true,
+		Role:        RoleOwner,
+		Request:     ValetModeRequest{},
+	},
+	{
+		Name:        "set_vehicle_name",
+		Help:        "Rename the vehicle",
+		RequiresKey: true,
+		Request:     VehicleNameRequest{},
+	},
+	{
+		Name:        "speed_limit_activate",
+		CLIName:     "speed-limit-activate",
+		Help:        "Activate Speed Limit Mode. If no PIN is set, PIN becomes the Speed Limit Mode PIN.",
+		RequiresKey: true,
+		Request:     SpeedLimitPINRequest{},
+		Arguments: []Parameter{
+			speedLimitPINArgument,
+		},
+	},
+	{
+		Name:        "speed_limit_deactivate",
+		CLIName:     "speed-limit-deactivate",
+		Help:        "Deactivate Speed Limit Mode",
+		RequiresKey: true,
+		Request:     SpeedLimitPINRequest{},
+		Arguments: []Parameter{
+			speedLimitPINArgument,
+		},
+	},
+	{
+		Name:        "speed_limit_clear_pin",
+		CLIName:     "speed-limit-clear-pin",
+		Help:        "Clear the Speed Limit Mode PIN, which also deactivates Speed Limit Mode",
+		RequiresKey: true,
+		Role:        RoleOwner,
+		Request:     SpeedLimitPINRequest{},
+		Arguments: []Parameter{
+			speedLimitPINArgument,
+		},
+	},
+	{
+		Name:        "speed_limit_clear_pin_admin",
+		CLIName:     "speed-limit-clear-pin-admin",
+		Help:        "Clear the Speed Limit Mode PIN without knowing it (fleet manager only)",
+		RequiresKey: true,
+		Role:        RoleOwner,
+	},
+	{
+		Name:        "speed_limit_set_limit",
+		CLIName:     "speed-limit-set",
+		Help:        "Set the Speed Limit Mode maximum speed to MPH",
+		RequiresKey: true,
+		Request:     SpeedLimitRequest{},
+		Arguments: []Parameter{
+			{Name: "MPH", Type: TypeString, Required: true, Help: "Maximum speed, such as 65mph or 105kph (default unit from -units)"},
+		},
+	},
+	{
+		Name:        "trigger_homelink",
+		Help:        "Trigger HomeLink at a location",
+		RequiresKey: true,
+		Request:     HomelinkRequest{},
+	},
+	{
+		Name:        "schedule_software_update",
+		CLIName:     "software-update-start",
+		Help:        "Start software update after DELAY",
+		RequiresKey: true,
+		Request:     SoftwareUpdateRequest{},
+		Arguments: []Parameter{
+			{Name: "DELAY", Type: TypeString, Required: true, Help: "Time to wait before starting update. Examples: 2h, 10m."},
+		},
+	},
+	{
+		Name:        "cancel_software_update",
+		CLIName:     "software-update-cancel",
+		Help:        "Cancel a pending software update",
+		RequiresKey: true,
+	},
+	{
+		Name:             "navigation_request",
+		Help:             "Send a destination to the vehicle",
+		RequiresFleetAPI: true,
+		Handling:         HandlingForwarded,
+	},
+	{
+		Name:        "window_control",
+		Help:        "Vent or close all windows",
+		RequiresKey: true,
+		Request:     WindowControlRequest{},
+	},
+	// Commands supported only by tesla-control.
+	{
+		CLIName:     "add-key",
+		Help:        "Add PUBLIC_KEY to vehicle whitelist with ROLE and FORM_FACTOR",
+		Domain:      DomainVCSEC,
+		RequiresKey: true,
+		Role:        RoleOwner,
+		Arguments: []Parameter{
+			{Name: "PUBLIC_KEY", Type: TypeString, Required: true, Help: "file containing public key (or corresponding private key)"},
+			{Name: "ROLE", Type: TypeString, Required: true, Help: "One of: owner, driver, fm (fleet manager), vehicle_monitor, charging_manager"},
+			{Name: "FORM_FACTOR", Type: TypeString, Required: true, Help: "One of: nfc_card, ios_device, android_device, cloud_key"},
+		},
+	},
+	{
+		CLIName: "add-key-request",
+		Help:    "Request NFC-card approval for a enrolling PUBLIC_KEY with ROLE and FORM_FACTOR",
+		Domain:  DomainVCSEC,
+		Arguments: []Parameter{
+			{Name: "PUBLIC_KEY", Type: TypeString, Required: true, Help: "file containing public key (or corresponding private key)"},
+			{Name: "ROLE", Type: TypeString, Required: true, Help: "One of: owner, driver, fm (fleet manager), vehicle_monitor, charging_manager"},
+			{Name: "FORM_FACTOR", Type: TypeString, Required: true, Help: "One of: nfc_card, ios_device, android_device, cloud_key"},
+		},
+	},
+	{
+		CLIName:     "autosecure-modelx",
+		Help:        "Close falcon-wing doors and lock vehicle. Model X only.",
+		Domain:      DomainVCSEC,
+		RequiresKey: true,
+	},
+	{
+		CLIName: "body-controller-state",
+		Help:    "Fetch limited vehicle state information. Works over BLE when infotainment is asleep.",
+		Domain:  DomainVCSEC,
+	},
+	{
+		CLIName:     "precondition",
+		Help:        "Turn on climate control, then optionally Max Defrost, seat heaters, and the steering wheel heater",
+		Domain:      DomainInfotainment,
+		RequiresKey: true,
+		Arguments: []Parameter{
+			{Name: "SEATS", Type: TypeString, Help: "Comma-separated SEAT:LEVEL pairs (e.g., front-left:high,front-right:low)"},
+			{Name: "DEFROST", Type: TypeString, Help: "'on' to turn on Max Defrost (default 'off')"},
+			{Name: "WHEEL", Type: TypeString, Help: "'on' to turn on the steering wheel heater (default 'off')"},
+		},
+	},
+	{
+		CLIName:     "homelink-list",
+		Help:        "Check whether a HomeLink device at LATITUDE, LONGITUDE is in range of the vehicle",
+		Domain:      DomainInfotainment,
+		RequiresKey: true,
+		Arguments: []Parameter{
+			{Name: "LATITUDE", Type: TypeString, Required: true, Help: "Latitude of the HomeLink device"},
+			{Name: "LONGITUDE", Type: TypeString, Required: true, Help: "Longitude of the HomeLink device"},
+		},
+	},
+	{
+		CLIName:     "charging-schedule-cancel",
+		Help:        "Cancel scheduled charge start",
+		Domain:      DomainInfotainment,
+		RequiresKey: true,
+	},
+	{
+		CLIName:     "frunk-open",
+		Help:        "Open vehicle frunk. Note that there's no frunk-close command!",
+		Domain:      DomainVCSEC,
+		RequiresKey: true,
+	},
+	{
+		CLIName:          "get",
+		Help:             "GET an owner API http ENDPOINT. Hostname will be taken from -config.",
+		RequiresFleetAPI: true,
+		Arguments: []Parameter{
+			{Name: "ENDPOINT", Type: TypeString, Required: true, Help: "Fleet API endpoint"},
+		},
+	},
+	{
+		CLIName:     "guest-mode-off",
+		Help:        "Disable Guest Mode.",
+		Domain:      DomainInfotainment,
+		RequiresKey: true,
+	},
+	{
+		CLIName:     "guest-mode-on",
+		Help:        "Enable Guest Mode. See https://developer.tesla.com/docs/fleet-api/endpoints/vehicle-commands#guest-mode.",
+		Domain:      DomainInfotainment,
+		RequiresKey: true,
+	},
+	{
+		CLIName: "list-keys",
+		Help:    "List public keys enrolled on vehicle",
+		Domain:  DomainVCSEC,
+	},
+	{
+		CLIName: "awake",
+		Help:    "Check whether the vehicle is awake without waking it. Exits with status 0 if it's awake and 4 if it isn't. Doesn't require a paired key.",
+	},
+	{
+		CLIName: "command-protocol",
+		Help:    "Check whether the vehicle supports signed commands. Vehicles that don't must be sent commands through the Fleet API's REST endpoints. Doesn't require a paired key.",
+	},
+	{
+		CLIName:     "ping",
+		Help:        "Ping vehicle",
+		Domain:      DomainInfotainment,
+		RequiresKey: true,
+	},
+	{
+		CLIName:          "post",
+		Help:             "POST to ENDPOINT the contents of FILE. Hostname will be taken from -config.",
+		RequiresFleetAPI: true,
+		Arguments: []Parameter{
+			{Name: "ENDPOINT", Type: TypeString, Required: true, Help: "Fleet API endpoint"},
+			{Name: "FILE", Type: TypeString, Help: "JSON file to POST"},
+		},
+	},
+	{
+		CLIName:          "product-info",
+		Help:             "Print JSON product info",
+		RequiresFleetAPI: true,
+	},
+	{
+		CLIName:     "remove-key",
+		Help:        "Remove PUBLIC_KEY from vehicle whitelist",
+		Domain:      DomainVCSEC,
+		RequiresKey: true,
+		Role:        RoleOwner,
+		Arguments: []Parameter{
+			{Name: "PUBLIC_KEY", Type: TypeString, Required: true, Help: "file containing public key (or corresponding private key)"},
+		},
+	},
+	{
+		CLIName:          "rename-key",
+		Help:             "Change the human-readable metadata of PUBLIC_KEY to NAME, MODEL, KIND",
+		RequiresFleetAPI: true,
+		Arguments: []Parameter{
+			{Name: "PUBLIC_KEY", Type: TypeString, Required: true, Help: "file containing public key (or corresponding private key)"},
+			{Name: "NAME", Type: TypeString, Required: true, Help: "New human-readable name for the public key (e.g., Dave's Phone)"},
+		},
+	},
+	{
+		CLIName: "session-info",
+		Help:    "Retrieve session info from DOMAIN, including the clock offset between this client and the vehicle. Unsigned, so it works when commands are failing.",
+		Arguments: []Parameter{
+			{Name: "DOMAIN", Type: TypeString, Required: true, Help: "'vcsec' or 'infotainment'"},
+			{Name: "PUBLIC_KEY", Type: TypeString, Help: "file containing public key (or corresponding private key) to query instead of the client's key"},
+		},
+	},
+	{
+		CLIName:     "state",
+		Help:        "Fetch vehicle state over BLE.",
+		Domain:      DomainInfotainment,
+		RequiresKey: true,
+		Arguments: []Parameter{
+			{Name: "CATEGORY", Type: TypeString, Required: true, Help: "One of charge, drive, location, charge-schedule, tire-pressure, media-detail, software-update, parental-controls, climate, closures, precondition-schedule, media"},
+		},
+	},
+	{
+		CLIName:     "trunk-close",
+		Help:        "Closes vehicle trunk. Only available on certain vehicle types.",
+		Domain:      DomainVCSEC,
+		RequiresKey: true,
+	},
+	{
+		CLIName:     "trunk-move",
+		Help:        "Toggle trunk open/closed. Closing is only available on certain vehicle types.",
+		Domain:      DomainVCSEC,
+		RequiresKey: true,
+	},
+	{
+		CLIName:     "trunk-open",
+		Help:        "Open vehicle trunk. Note that trunk-close only works on certain vehicle types.",
+		Domain:      DomainVCSEC,
+		RequiresKey: true,
+	},
+	{
+		CLIName:     "valet-mode-off",
+		Help:        "Disable valet mode",
+		Domain:      DomainInfotainment,
+		RequiresKey: true,
+	},
+	{
+		CLIName:     "valet-mode-on",
+		Help:        "Enable valet mode",
+		Domain:      DomainInfotainment,
+		RequiresKey: true,
+		Arguments: []Parameter{
+			{Name: "PIN", Type: TypeString, Required: true, Help: "Valet mode PIN"},
+		},
+	},
+	{
+		CLIName:     "windows-close",
+		Help:        "Close all windows",
+		Domain:      DomainInfotainment,
+		RequiresKey: true,
+	},
+	{
+		CLIName:     "windows-vent",
+		Help:        "Vent all windows",
+		Domain:      DomainInfotainment,
+		RequiresKey: true,
+	},
+}
@@ -0,0 +1,221 @@
+package catalog
+
+// Request bodies of REST API commands. A command's Parameters, and therefore its JSON Schema, are
+// derived from these types using the following struct tags:
+//
+//   - json: the parameter name. Pointer fields are optional; other fields are required.
+//   - help: the parameter's description.
+//   - enum: comma-separated permitted values of a string.
+//   - min, max: bounds of a number. Integer fields only accept whole numbers.
+//   - pattern: an anchored regular expression that a string must match.
+//
+// Clients can marshal these types to build request bodies, and [Command.DecodeRequest] returns
+// them.
+
+// AdjustVolumeRequest is the body of adjust_volume.
+type AdjustVolumeRequest struct {
+	Volume float64 `json:"volume" min:"0" max:"10" help:"Volume level, 0.0 to 10.0"`
+}
+
+// RemoteSeatCoolerRequest is the body of remote_seat_cooler_request.
+type RemoteSeatCoolerRequest struct {
+	SeatPosition    int `json:"seat_position" min:"1" max:"2" help:"1 for front left, 2 for front right"`
+	SeatCoolerLevel int `json:"seat_cooler_level" min:"0" max:"3" help:"0 (off) to 3 (high)"`
+}
+
+// RemoteSeatHeaterRequest is the body of remote_seat_heater_request.
+type RemoteSeatHeaterRequest struct {
+	SeatPosition int `json:"seat_position" min:"0" max:"8" help:"Seat index, 0 (front left) to 8 (third row right)"`
+	Level        int `json:"level" min:"0" max:"3" help:"0 (off) to 3 (high)"`
+}
+
+// RemoteAutoSeatClimateRequest is the body of remote_auto_seat_climate_request.
+type RemoteAutoSeatClimateRequest struct {
+	AutoSeatPosition int  `json:"auto_seat_position" min:"1" max:"2" help:"1 for front left, 2 for front right"`
+	AutoClimateOn    bool `json:"auto_climate_on" help:"Enable automatic seat climate"`
+}
+
+// SteeringWheelHeaterRequest is the body of remote_steering_wheel_heater_request.
+type SteeringWheelHeaterRequest struct {
+	On bool `json:"on" help:"Enable the steering wheel heater"`
+}
+
+// BioweaponModeRequest is the body of set_bioweapon_mode.
+type BioweaponModeRequest struct {
+	On             bool `json:"on" help:"Enable Bioweapon Defense Mode"`
+	ManualOverride bool `json:"manual_override" help:"Override automatic climate settings"`
+}
+
+// CabinOverheatProtectionRequest is the body of set_cabin_overheat_protection.
+type CabinOverheatProtectionRequest struct {
+	On      *bool   `json:"on,omitempty" help:"Enable Cabin Overheat Protection; required unless mode is set"`
+	FanOnly *bool   `json:"fan_only,omitempty" help:"Run the fan without air conditioning"`
+	Mode    *string `json:"mode,omitempty" enum:"off,on,no_ac,fan_only" help:"Alternative to on and fan_only; no_ac is the same as fan_only"`
+}
+
+// ClimateKeeperModeRequest is the body of set_climate_keeper_mode.
+type ClimateKeeperModeRequest struct {
+	ClimateKeeperMode int   `json:"climate_keeper_mode" min:"0" max:"3" help:"0 (off), 1 (on), 2 (dog), or 3 (camp)"`
+	ManualOverride    *bool `json:"manual_override,omitempty" help:"Override automatic climate settings"`
+}
+
+// CabinOverheatProtectionTempRequest is the body of set_cop_temp.
+type CabinOverheatProtectionTempRequest struct {
+	CopTemp int `json:"cop_temp" min:"0" max:"2" help:"Temperature level: 0 (low), 1 (medium), or 2 (high)"`
+}
+
+// PreconditioningMaxRequest is the body of set_preconditioning_max.
+type PreconditioningMaxRequest struct {
+	On             bool  `json:"on" help:"Enable Max Defrost"`
+	ManualOverride *bool `json:"manual_override,omitempty" help:"Override automatic climate settings"`
+}
+
+// TemperaturesRequest is the body of set_temps.
+type TemperaturesRequest struct {
+	DriverTemp    *float64 `json:"driver_temp,omitempty" help:"Driver temperature in Celsius"`
+	PassengerTemp *float64 `json:"passenger_temp,omitempty" help:"Passenger temperature in Celsius"`
+}
+
+// ActuateTrunkRequest is the body of actuate_trunk.
+type ActuateTrunkRequest struct {
+	WhichTrunk *string `json:"which_trunk,omitempty" enum:"front,rear" help:"Trunk to open; defaults to rear"`
+}
+
+// LowPowerModeRequest is the body of set_low_power_mode.
+type LowPowerModeRequest struct {
+	Enable bool `json:"enable" help:"Enable low power mode"`
+}
+
+// ChargingAmpsRequest is the body of set_charging_amps.
+type ChargingAmpsRequest struct {
+	ChargingAmps int `json:"charging_amps" min:"0" help:"Charge current in amps"`
+}
+
+// ScheduledChargingRequest is the body of set_scheduled_charging.
+type ScheduledChargingRequest struct {
+	Enable bool `json:"enable" help:"Enable scheduled charging"`
+	Time   *int `json:"time,omitempty" min:"0" max:"1439" help:"Start time in minutes after midnight"`
+}
+
+// ChargeLimitRequest is the body of set_charge_limit.
+type ChargeLimitRequest struct {
+	Percent int `json:"percent" min:"50" max:"100" help:"Charge limit percentage"`
+}
+
+// ScheduledDepartureRequest is the body of set_scheduled_departure.
+type ScheduledDepartureRequest struct {
+	Enable                      bool  `json:"enable" help:"Enable scheduled departure"`
+	DepartureTime               *int  `json:"departure_time,omitempty" min:"0" max:"1439" help:"Departure time in minutes after midnight"`
+	PreconditioningEnabled      *bool `json:"preconditioning_enabled,omitempty" help:"Precondition before departure"`
+	PreconditioningWeekdaysOnly *bool `json:"preconditioning_weekdays_only,omitempty" help:"Only precondition on weekdays"`
+	OffPeakChargingEnabled      *bool `json:"off_peak_charging_enabled,omitempty" help:"Charge during off-peak hours"`
+	OffPeakChargingWeekdaysOnly *bool `json:"off_peak_charging_weekdays_only,omitempty" help:"Only charge off-peak on weekdays"`
+	EndOffPeakTime              *int  `json:"end_off_peak_time,omitempty" min:"0" max:"1439" help:"End of off-peak hours in minutes after midnight"`
+}
+
+// AddChargeScheduleRequest is the body of add_charge_schedule.
+type AddChargeScheduleRequest struct {
+	DaysOfWeek   string  `json:"days_of_week" help:"Comma-separated day names, \"all\", or \"weekdays\""`
+	Enabled      bool    `json:"enabled" help:"Enable the schedule"`
+	StartEnabled bool    `json:"start_enabled" help:"Start charging at start_time"`
+	StartTime    *int    `json:"start_time,omitempty" min:"0" max:"1439" help:"Start time in minutes after midnight"`
+	EndEnabled   bool    `json:"end_enabled" help:"Stop charging at end_time"`
+	EndTime      *int    `json:"end_time,omitempty" min:"0" max:"1439" help:"End time in minutes after midnight"`
+	Lat          float64 `json:"lat" min:"-90" max:"90" help:"Latitude of the charging location"`
+	Lon          float64 `json:"lon" min:"-180" max:"180" help:"Longitude of the charging location"`
+	OneTime      *bool   `json:"one_time,omitempty" help:"Run the schedule once instead of weekly"`
+	ID           *int64  `json:"id,omitempty" min:"0" help:"ID of an existing schedule to modify"`
+}
+
+// AddPreconditionScheduleRequest is the body of add_precondition_schedule.
+type AddPreconditionScheduleRequest struct {
+	DaysOfWeek       string  `json:"days_of_week" help:"Comma-separated day names, \"all\", or \"weekdays\""`
+	Enabled          bool    `json:"enabled" help:"Enable the schedule"`
+	PreconditionTime int     `json:"precondition_time" min:"0" max:"1439" help:"Time to be ready by, in minutes after midnight"`
+	Lat              float64 `json:"lat" min:"-90" max:"90" help:"Latitude of the preconditioning location"`
+	Lon              float64 `json:"lon" min:"-180" max:"180" help:"Longitude of the preconditioning location"`
+	OneTime          *bool   `json:"one_time,omitempty" help:"Run the schedule once instead of weekly"`
+	ID               *int64  `json:"id,omitempty" min:"0" help:"ID of an existing schedule to modify"`
+}
+
+// RemoveScheduleRequest is the body of remove_charge_schedule and remove_precondition_schedule.
+type RemoveScheduleRequest struct {
+	ID int64 `json:"id" min:"0" help:"ID of the schedule to remove"`
+}
+
+// ChargingScheduleModeRequest is the body of set_charging_schedule_mode.
+type ChargingScheduleModeRequest struct {
+	Mode string `json:"mode" enum:"off,start_time,departure" help:"Scheduling mode"`
+	Time *int   `json:"time,omitempty" min:"0" max:"1439" help:"Start or departure time in minutes after midnight; required unless mode is off"`
+}
+
+// OffPeakChargingRequest is the body of set_off_peak_charging.
+type OffPeakChargingRequest struct {
+	Enabled        bool  `json:"enabled" help:"Charge during off-peak hours"`
+	EndOffPeakTime *int  `json:"end_off_peak_time,omitempty" min:"0" max:"1439" help:"End of off-peak hours in minutes after midnight; required if enabled is true"`
+	WeekdaysOnly   *bool `json:"weekdays_only,omitempty" help:"Only charge off-peak on weekdays"`
+}
+
+// PINToDriveRequest is the body of set_pin_to_drive.
+type PINToDriveRequest struct {
+	On       bool    `json:"on" help:"Enable PIN to Drive"`
+	Password *string `json:"password,omitempty" pattern:"^[0-9]{4}$" help:"Four-digit PIN"`
+}
+
+// DoorLockRequest is the body of door_lock and door_unlock. Confirm may also be given in the query
+// string of either command.
+type DoorLockRequest struct {
+	Confirm *bool `json:"confirm,omitempty" help:"Read back the lock state after the vehicle acknowledges the command"`
+}
+
+// GuestModeRequest is the body of guest_mode.
+type GuestModeRequest struct {
+	Enable bool `json:"enable" help:"Enable Guest Mode"`
+}
+
+// SentryModeRequest is the body of set_sentry_mode.
+type SentryModeRequest struct {
+	On bool `json:"on" help:"Enable Sentry Mode"`
+}
+
+// ValetModeRequest is the body of set_valet_mode.
+type ValetModeRequest struct {
+	On       bool    `json:"on" help:"Enable valet mode"`
+	Password *string `json:"password,omitempty" pattern:"^[0-9]{4}$" help:"Four-digit valet PIN"`
+}
+
+// VehicleNameRequest is the body of set_vehicle_name.
+type VehicleNameRequest struct {
+	VehicleName string `json:"vehicle_name" help:"New vehicle name"`
+}
+
+// SpeedLimitPINRequest is the body of speed_limit_activate, speed_limit_deactivate, and
+// speed_limit_clear_pin.
+type SpeedLimitPINRequest struct {
+	PIN string `json:"pin" pattern:"^[0-9]{4}$" help:"Four-digit Speed Limit Mode PIN"`
+}
+
+// SpeedLimitRequest is the body of speed_limit_set_limit. The bounds match
+// vehicle.MinSpeedLimitMPH and vehicle.MaxSpeedLimitMPH.
+type SpeedLimitRequest struct {
+	LimitMPH float64 `json:"limit_mph" min:"50" max:"120" help:"Maximum speed in miles per hour"`
+}
+
+// HomelinkRequest is the body of trigger_homelink.
+type HomelinkRequest struct {
+	Lat float64 `json:"lat" min:"-90" max:"90" help:"Latitude of the HomeLink device"`
+	Lon float64 `json:"lon" min:"-180" max:"180" help:"Longitude of the HomeLink device"`
+}
+
+// SoftwareUpdateRequest is the body of schedule_software_update.
+type SoftwareUpdateRequest struct {
+	OffsetSec int `json:"offset_sec" min:"0" help:"Delay before starting the update, in seconds"`
+}
+
+// WindowControlRequest is the body of window_control. The Fleet API requires the vehicle's
+// location to close windows, but the proxy doesn't, so it accepts and ignores lat and lon.
+type WindowControlRequest struct {
+	Command string   `json:"command" enum:"vent,close" help:"Window operation"`
+	Lat     *float64 `json:"lat,omitempty" min:"-90" max:"90" help:"Latitude of the vehicle; ignored"`
+	Lon     *float64 `json:"lon,omitempty" min:"-180" max:"180" help:"Longitude of the vehicle; ignored"`
+}
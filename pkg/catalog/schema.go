@@ -0,0 +1,61 @@
+package catalog
+
+// jsonSchemaDialect identifies the JSON Schema version that Schema documents conform to.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// schemaTypeInteger is the JSON Schema type of parameters with Integer set. JSON has no integer
+// type, so it isn't one of the Type constants.
+const schemaTypeInteger Type = "integer"
+
+// Schema is a JSON Schema describing the JSON body of a REST API command.
+type Schema struct {
+	Dialect     string                     `json:"$schema"`
+	Title       string                     `json:"title"`
+	Description string                     `json:"description,omitempty"`
+	Type        string                     `json:"type"`
+	Properties  map[string]*PropertySchema `json:"properties"`
+	Required    []string                   `json:"required,omitempty"`
+	// AdditionalProperties is always true, since Validate ignores unrecognized parameters.
+	AdditionalProperties bool `json:"additionalProperties"`
+}
+
+// PropertySchema is the JSON Schema of a single parameter.
+type PropertySchema struct {
+	Type        Type     `json:"type"`
+	Enum        []string `json:"enum,omitempty"`
+	Minimum     *float64 `json:"minimum,omitempty"`
+	Maximum     *float64 `json:"maximum,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+// Schema returns a JSON Schema that accepts exactly the request bodies that Validate accepts.
+func (c *Command) Schema() *Schema {
+	schema := &Schema{
+		Dialect:              jsonSchemaDialect,
+		Title:                c.Name,
+		Description:          c.Help,
+		Type:                 "object",
+		Properties:           make(map[string]*PropertySchema, len(c.Parameters)),
+		AdditionalProperties: true,
+	}
+	for _, param := range c.Parameters {
+		property := &PropertySchema{Type: param.Type, Description: param.Help}
+		switch param.Type {
+		case TypeString:
+			property.Enum = param.Values
+			property.Pattern = param.Pattern
+		case TypeNumber:
+			property.Minimum = param.Minimum
+			property.Maximum = param.Maximum
+			if param.Integer {
+				property.Type = schemaTypeInteger
+			}
+		}
+		schema.Properties[param.Name] = property
+		if param.Required {
+			schema.Required = append(schema.Required, param.Name)
+		}
+	}
+	return schema
+}
@@ -48,21 +48,27 @@ However, most [vehicle.Vehicle] commands do not work over unauthenticated connec
 package cli
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/teslamotors/vehicle-command/internal/log"
 	"github.com/teslamotors/vehicle-command/pkg/account"
 	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/connector/ble"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/redact"
 	"github.com/teslamotors/vehicle-command/pkg/vehicle"
 
 	"github.com/99designs/keyring"
@@ -115,6 +121,13 @@ const (
 	EnvTeslaKeyringPass  = "TESLA_KEYRING_PASSWORD"
 	EnvTeslaKeyringPath  = "TESLA_KEYRING_PATH"
 	EnvTeslaKeyringDebug = "TESLA_KEYRING_DEBUG"
+	EnvTeslaVINRedaction = "TESLA_VIN_REDACTION"
+	EnvTeslaVINHashKey   = "TESLA_VIN_HASH_KEY_FILE"
+	EnvTeslaProfile      = "TESLA_PROFILE"
+	EnvTeslaConfigFile   = "TESLA_CONFIG_FILE"
+	EnvTeslaEnvironment  = "TESLA_ENVIRONMENT"
+	EnvTeslaKeyAuditLog  = "TESLA_KEY_AUDIT_LOG"
+	EnvTeslaUserAgent    = "TESLA_USER_AGENT"
 )
 
 // Flag controls what options should be scanned from the command line and/or environment variables.
@@ -124,6 +137,17 @@ func (f Flag) isSet(other Flag) bool {
 	return (f & other) == other
 }
 
+// usesProfiles returns true if f includes a flag whose settings a [Profile] can provide.
+func (f Flag) usesProfiles() bool {
+	return f.isSet(FlagVIN) || f.isSet(FlagOAuth) || f.isSet(FlagPrivateKey)
+}
+
+// usesEnvironments returns true if f includes a flag whose credentials an [Environment] can
+// provide.
+func (f Flag) usesEnvironments() bool {
+	return f.isSet(FlagOAuth) || f.isSet(FlagPrivateKey)
+}
+
 const (
 	FlagVIN        Flag = 1 // Enable VIN option.
 	FlagOAuth      Flag = 2 // Enable OAuth options.
@@ -151,17 +175,48 @@ type Config struct {
 	DisableCache     bool
 	Backend          keyring.Config
 	BackendType      backendType
-	Debug            bool // Enable keyring debug messages
+	Debug            bool   // Enable keyring debug messages
+	VINRedaction     string // How VINs are redacted in logs (mask, hash, or none). See package redact.
+	VINHashKeyFile   string // File containing the secret key of VIN hashes. See [redact.SetHashKey].
+	Profile          string // Name of the profile applied by [Config.ReadFromProfile]
+	ConfigFilename   string // File containing profiles. Defaults to $TESLA_CONFIG_FILE, then DefaultConfigFilename().
+	Transport        string // TransportBLE, TransportInternet, or empty to choose based on whether an OAuth token is configured
+	Region           string // Fleet API region (na, eu, or cn). Defaults to the region in the OAuth token.
+	Environment      string // Name of the environment applied by [Config.ReadFromProfile]
+
+	// FleetAPIHost overrides the Fleet API server in the OAuth token. It's set from the selected
+	// environment.
+	FleetAPIHost string
 
 	// Domains can limit a vehicle connection to relevant subsystems, which can reduce
 	// connection latency and avoid waking up the infotainment system unnecessarily.
 	Domains DomainList
 
+	// SkipHandshake makes Connect return without starting vehicle sessions, for commands that
+	// don't need them. Sessions loaded from the cache are still available.
+	SkipHandshake bool
+
+	// FrameTap, if set, receives the raw messages exchanged with the vehicle. See
+	// [connector.FrameTap].
+	FrameTap *connector.FrameTap
+
+	// KeyAuditLog, if set, is a file to which [Config.PrivateKey] appends a JSON line for each use
+	// of the private key. See [protocol.KeyUsage].
+	KeyAuditLog string
+
+	// UserAgent names the application in the User-Agent header of requests to Tesla's servers,
+	// such as "acme-fleet/2.1". See [account.New].
+	UserAgent string
+
 	password   *string
 	sessions   *cache.SessionCache
 	acct       *account.Account
 	skey       protocol.ECDHPrivateKey
 	oauthToken string
+
+	// environments holds every environment defined in the configuration file, so that credentials
+	// belonging to an environment other than c.Environment can be rejected.
+	environments map[string]*Environment
 }
 
 func NewConfig(flags Flag) (*Config, error) {
@@ -181,6 +236,12 @@ func NewConfig(flags Flag) (*Config, error) {
 }
 
 func (c *Config) RegisterCommandLineFlags() {
+	if c.Flags.usesProfiles() {
+		flag.StringVar(&c.Profile, "profile", "", "Apply settings from profile `name` in the configuration file. Defaults to $TESLA_PROFILE. Other flags override the profile.")
+	}
+	if c.Flags.usesEnvironments() {
+		flag.StringVar(&c.Environment, "environment", "", "Use the Fleet API server and credentials of environment `name` in the configuration file. Defaults to $TESLA_ENVIRONMENT.")
+	}
 	if c.Flags.isSet(FlagVIN) {
 		flag.StringVar(&c.VIN, "vin", "", "Vehicle Identification Number. Defaults to $TESLA_VIN.")
 	}
@@ -188,15 +249,22 @@ func (c *Config) RegisterCommandLineFlags() {
 		if !c.Flags.isSet(FlagVIN) {
 			log.Debug("FlagPrivateKey is set but FlagVIN is not. A VIN is required to send vehicle commands.")
 		}
-		flag.StringVar(&c.CacheFilename, "session-cache", "", "Load session info cache from `file`. Defaults to $TESLA_CACHE_FILE then ~/.tesla-cache.json.")
-		flag.BoolVar(&c.DisableCache, "disable-session-cache", false, "Disable the session info cache.")
+		flag.StringVar(&c.CacheFilename, "session-cache", "", "Load session info cache from `file`. Defaults to $TESLA_CACHE_FILE, then ~/.tesla-cache.json if it exists, then a file in the user cache directory.")
+		flag.BoolVar(&c.DisableCache, "no-session-cache", false, "Disable the session info cache.")
+		flag.BoolVar(&c.DisableCache, "disable-session-cache", false, "Same as -no-session-cache.")
 		flag.StringVar(&c.KeyringKeyName, "key-name", "", "System keyring `name` for private key. Defaults to $TESLA_KEY_NAME.")
 		flag.StringVar(&c.KeyFilename, "key-file", "", "A `file` containing private key. Defaults to $TESLA_KEY_FILE.")
 		flag.Var(&c.Domains, "domain", "Domains to connect to (can be repeated; omit for all)")
+		flag.StringVar(&c.KeyAuditLog, "key-audit-log", "", "Append a JSON line to `file` each time the private key is used. Defaults to $TESLA_KEY_AUDIT_LOG.")
+	}
+	if c.Flags.isSet(FlagVIN) || c.Flags.isSet(FlagPrivateKey) {
+		flag.StringVar(&c.VINRedaction, "vin-redaction", "", "How VINs appear in logs: mask, hash, or none. Defaults to $TESLA_VIN_REDACTION then mask.")
+		flag.StringVar(&c.VINHashKeyFile, "vin-hash-key-file", "", "Key VIN hashes with the secret in `file`, so that they match across processes. Defaults to $TESLA_VIN_HASH_KEY_FILE, then a random key per process.")
 	}
 	if c.Flags.isSet(FlagOAuth) {
 		flag.StringVar(&c.KeyringTokenName, "token-name", "", "System keyring `name` for OAuth token. Defaults to $TESLA_TOKEN_NAME.")
 		flag.StringVar(&c.TokenFilename, "token-file", "", "`File` containing OAuth token. Defaults to $TESLA_TOKEN_FILE.")
+		flag.StringVar(&c.UserAgent, "user-agent", "", "Identify your application to Tesla's servers by prefixing the User-Agent with `product` (e.g., acme-fleet/2.1). Defaults to $TESLA_USER_AGENT.")
 	}
 	if c.Flags.isSet(FlagOAuth) || c.Flags.isSet(FlagPrivateKey) {
 		var names []string
@@ -234,6 +302,18 @@ func (c *Config) LoadCredentials() error {
 // environment from overriding explicit command-line parameters and avoid potentially misleading
 // debug log messages.
 func (c *Config) ReadFromEnvironment() {
+	if c.VINRedaction == "" {
+		c.VINRedaction = os.Getenv(EnvTeslaVINRedaction)
+	}
+	if err := c.applyVINRedaction(); err != nil {
+		log.Warning("%s; falling back to %s", err, redact.ModeMask)
+	}
+	if c.VINHashKeyFile == "" {
+		c.VINHashKeyFile = os.Getenv(EnvTeslaVINHashKey)
+	}
+	if err := c.applyVINHashKey(); err != nil {
+		log.Warning("%s; VIN hashes won't match those of other processes", err)
+	}
 	if c.Flags.isSet(FlagVIN) {
 		if c.VIN == "" {
 			c.VIN = os.Getenv(EnvTeslaVIN)
@@ -241,12 +321,12 @@ func (c *Config) ReadFromEnvironment() {
 		}
 	}
 	if c.Flags.isSet(FlagPrivateKey) {
-		if !c.DisableCache && c.CacheFilename == "" {
+		if c.DisableCache {
+			c.CacheFilename = ""
+		} else if c.CacheFilename == "" {
 			c.CacheFilename = os.Getenv(EnvTeslaCacheFile)
 			if c.CacheFilename == "" {
-				if homeDir := os.Getenv("HOME"); homeDir != "" {
-					c.CacheFilename = filepath.Join(homeDir, ".tesla-cache.json")
-				}
+				c.CacheFilename = defaultCacheFilename()
 			}
 			log.Debug("Set session cache file to '%s'", c.CacheFilename)
 		}
@@ -257,6 +337,9 @@ func (c *Config) ReadFromEnvironment() {
 			c.KeyFilename = os.Getenv(EnvTeslaKeyFile)
 			log.Debug("Set key file to '%s'", c.KeyFilename)
 		}
+		if c.KeyAuditLog == "" {
+			c.KeyAuditLog = os.Getenv(EnvTeslaKeyAuditLog)
+		}
 	}
 	if c.Flags.isSet(FlagOAuth) {
 		if c.KeyringTokenName == "" && c.TokenFilename == "" {
@@ -266,6 +349,9 @@ func (c *Config) ReadFromEnvironment() {
 			c.TokenFilename = os.Getenv(EnvTeslaTokenFile)
 			log.Debug("Set OAuth token file to '%s'", c.TokenFilename)
 		}
+		if c.UserAgent == "" {
+			c.UserAgent = os.Getenv(EnvTeslaUserAgent)
+		}
 	}
 	if c.Flags.isSet(FlagOAuth) || c.Flags.isSet(FlagPrivateKey) {
 		if c.BackendType.String() == string(keyring.InvalidBackend) {
@@ -291,7 +377,48 @@ func (c *Config) ReadFromEnvironment() {
 	}
 }
 
-// UpdateCachedSessions updates c.CacheFilename with updated session state.
+// applyVINRedaction installs the redaction function selected by c.VINRedaction.
+func (c *Config) applyVINRedaction() error {
+	f, err := redact.ParseMode(c.VINRedaction)
+	redact.SetVINRedactor(f)
+	return err
+}
+
+// applyVINHashKey installs the key in c.VINHashKeyFile, if set, as the key of VIN hashes.
+// Surrounding whitespace, such as a trailing newline, isn't part of the key.
+func (c *Config) applyVINHashKey() error {
+	if c.VINHashKeyFile == "" {
+		return nil
+	}
+	key, err := os.ReadFile(c.VINHashKeyFile)
+	if err != nil {
+		return fmt.Errorf("couldn't read VIN hash key: %w", err)
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		return fmt.Errorf("VIN hash key file %s is empty", c.VINHashKeyFile)
+	}
+	redact.SetHashKey(key)
+	return nil
+}
+
+// defaultCacheFilename returns ~/.tesla-cache.json if it exists, for compatibility with earlier
+// releases, and otherwise a file in the user cache directory ($XDG_CACHE_HOME on Linux).
+func defaultCacheFilename() string {
+	if homeDir := os.Getenv("HOME"); homeDir != "" {
+		legacy := filepath.Join(homeDir, ".tesla-cache.json")
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy
+		}
+	}
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(cacheDir, "vehicle-command", "sessions.json")
+	}
+	return ""
+}
+
+// UpdateCachedSessions updates c.CacheFilename with updated session state. Sessions that other
+// processes have saved to the same file since it was loaded are preserved.
 //
 // If c.CacheFilename is not set or no vehicle handshake has occurred, then this method does
 // nothing.
@@ -300,7 +427,11 @@ func (c *Config) UpdateCachedSessions(v *vehicle.Vehicle) {
 		return
 	}
 	_ = v.UpdateCachedSessions(c.sessions)
-	if err := c.sessions.ExportToFile(c.CacheFilename); err != nil {
+	if err := os.MkdirAll(filepath.Dir(c.CacheFilename), 0700); err != nil {
+		log.Error("Error creating cache directory: %s", err)
+		return
+	}
+	if err := c.sessions.SyncFile(c.CacheFilename); err != nil {
 		log.Error("Error updating cache: %s", err)
 	}
 }
@@ -320,6 +451,9 @@ func (c *Config) PrivateKey() (skey protocol.ECDHPrivateKey, err error) {
 	if c.KeyFilename == "" && c.KeyringKeyName == "" {
 		return nil, ErrNoKeySpecified
 	}
+	if err := c.checkEnvironment(); err != nil {
+		return nil, err
+	}
 	if c.KeyFilename != "" {
 		skey, err = protocol.LoadPrivateKey(c.KeyFilename)
 	}
@@ -329,10 +463,33 @@ func (c *Config) PrivateKey() (skey protocol.ECDHPrivateKey, err error) {
 	if err := c.loadCache(); err != nil {
 		return nil, err
 	}
+	if skey != nil && c.KeyAuditLog != "" {
+		if skey, err = c.observeKeyUsage(skey); err != nil {
+			return nil, err
+		}
+	}
 	c.skey = skey
 	return skey, err
 }
 
+// observeKeyUsage returns skey wrapped so that each use is recorded in c.KeyAuditLog. The file
+// stays open for the life of the process.
+func (c *Config) observeKeyUsage(skey protocol.ECDHPrivateKey) (protocol.ECDHPrivateKey, error) {
+	file, err := os.OpenFile(c.KeyAuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open key audit log: %w", err)
+	}
+	usageLog := protocol.NewKeyUsageLog(file)
+	var reportError sync.Once
+	observer := protocol.KeyUsageFunc(func(usage protocol.KeyUsage) {
+		usageLog.ObserveKeyUsage(usage)
+		if err := usageLog.Err(); err != nil {
+			reportError.Do(func() { log.Error("Couldn't write key audit log: %s", err) })
+		}
+	})
+	return protocol.ObserveKeyUsage(skey, observer), nil
+}
+
 // Connect to vehicle and/or account.
 //
 // If c.TokenFilename is set, the returned account will not be nil and the vehicle will use a
@@ -357,10 +514,12 @@ func (c *Config) Connect(ctx context.Context) (acct *account.Account, car *vehic
 		log.Debug("Client public key: %02x", skey.PublicBytes())
 	}
 
-	if c.Flags.isSet(FlagOAuth) && (c.KeyringTokenName != "" || c.TokenFilename != "") {
+	if c.Transport == TransportInternet && !c.Flags.isSet(FlagOAuth) || c.Transport == TransportBLE && !c.Flags.isSet(FlagBLE) {
+		err = ErrNoAvailableTransports
+	} else if c.Flags.isSet(FlagOAuth) && (c.KeyringTokenName != "" || c.TokenFilename != "") && c.Transport != TransportBLE {
 		log.Debug("Required OAuth parameters supplied by CLI and/or environment. Connecting over the Internet...")
 		acct, car, err = c.ConnectRemote(ctx, skey)
-	} else if c.Flags.isSet(FlagBLE) && c.Flags.isSet(FlagVIN) {
+	} else if c.Flags.isSet(FlagBLE) && c.Flags.isSet(FlagVIN) && c.Transport != TransportInternet {
 		log.Debug("Connecting over BLE...")
 		car, err = c.ConnectLocal(ctx, skey)
 	} else {
@@ -380,7 +539,7 @@ func (c *Config) Connect(ctx context.Context) (acct *account.Account, car *vehic
 	if err := car.Connect(ctx); err != nil {
 		return nil, nil, err
 	}
-	if skey != nil {
+	if skey != nil && !c.SkipHandshake {
 		log.Info("Securing connection...")
 		if err := car.StartSession(ctx, c.Domains); err != nil {
 			return nil, nil, err
@@ -397,7 +556,13 @@ func (c *Config) loadCache() error {
 	var err error
 	c.sessions, err = cache.ImportFromFile(c.CacheFilename)
 	if err != nil {
-		if !errors.Is(err, fs.ErrNotExist) {
+		var syntaxErr *json.SyntaxError
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF):
+			// Cached sessions are only an optimization, so a damaged cache shouldn't block commands.
+			log.Warning("Ignoring unreadable session cache %s: %s", c.CacheFilename, err)
+		default:
 			return fmt.Errorf("failed to load session cache: %s", err)
 		}
 		// Create a new cache if one couldn't be loaded from the file
@@ -410,6 +575,9 @@ func (c *Config) token() (string, error) {
 	if c.oauthToken != "" {
 		return c.oauthToken, nil
 	}
+	if err := c.checkEnvironment(); err != nil {
+		return "", err
+	}
 	var err error
 	if c.TokenFilename != "" {
 		token, err := os.ReadFile(c.TokenFilename)
@@ -432,7 +600,14 @@ func (c *Config) Account() (*account.Account, error) {
 	if err != nil {
 		return nil, err
 	}
-	return account.New(token, "")
+	acct, err := account.New(token, c.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	if c.FleetAPIHost != "" {
+		acct.Host = c.FleetAPIHost
+	}
+	return acct, nil
 }
 
 // SavePrivateKey writes skey to the system keyring or file, depending on what options are
@@ -458,6 +633,10 @@ func (c *Config) ConnectRemote(ctx context.Context, skey protocol.ECDHPrivateKey
 	}
 
 	acct = c.acct
+	acct.FrameTap = c.FrameTap
+	if host, ok := regionHosts[c.Region]; ok {
+		acct.Host = host
+	}
 
 	if c.Flags.isSet(FlagVIN) && c.VIN != "" {
 		car, err = acct.GetVehicle(ctx, c.VIN, skey, c.sessions)
@@ -480,6 +659,7 @@ func (c *Config) ConnectLocal(ctx context.Context, skey protocol.ECDHPrivateKey)
 	if err != nil {
 		return nil, err
 	}
+	conn.ObserveFrames(c.FrameTap)
 
 	car, err = vehicle.NewVehicle(conn, skey, c.sessions)
 	if err != nil {
@@ -487,3 +667,49 @@ func (c *Config) ConnectLocal(ctx context.Context, skey protocol.ECDHPrivateKey)
 	}
 	return
 }
+
+// FlagValues returns functions that list suggested values for flags registered by
+// [Config.RegisterCommandLineFlags], keyed by flag name. It's intended for shell completion, so
+// listing keyring contents never prompts for a password.
+func (c *Config) FlagValues() map[string]func() []string {
+	values := make(map[string]func() []string)
+	if c.Flags.usesProfiles() {
+		values["profile"] = c.profileNames
+	}
+	if c.Flags.isSet(FlagPrivateKey) {
+		values["key-name"] = func() []string {
+			names, _ := c.KeyringKeyNames()
+			return names
+		}
+		values["domain"] = func() []string {
+			var names []string
+			for name := range DomainsByName {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return names
+		}
+	}
+	if c.Flags.isSet(FlagVIN) || c.Flags.isSet(FlagPrivateKey) {
+		values["vin-redaction"] = func() []string {
+			return []string{redact.ModeMask, redact.ModeHash, redact.ModeNone}
+		}
+	}
+	if c.Flags.isSet(FlagOAuth) {
+		values["token-name"] = func() []string {
+			names, _ := c.KeyringTokenNames()
+			return names
+		}
+	}
+	if c.Flags.isSet(FlagOAuth) || c.Flags.isSet(FlagPrivateKey) {
+		values["keyring-type"] = func() []string {
+			var names []string
+			for _, name := range keyring.AvailableBackends() {
+				names = append(names, string(name))
+			}
+			sort.Strings(names)
+			return names
+		}
+	}
+	return values
+}
@@ -1,8 +1,20 @@
 package cli_test
 
 import (
-	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/redact"
+	"github.com/teslamotors/vehicle-command/pkg/sign"
 )
 
 func TestDomainCLI(t *testing.T) {
@@ -22,3 +34,148 @@ func TestDomainCLI(t *testing.T) {
 		t.Errorf("Unexpected string conversion result: %s", s)
 	}
 }
+
+func TestKeyringKeyNames(t *testing.T) {
+	t.Setenv(cli.EnvTeslaKeyringType, "file")
+	t.Setenv(cli.EnvTeslaKeyringPass, "hunter2")
+	t.Setenv(cli.EnvTeslaKeyringPath, t.TempDir())
+
+	config, err := cli.NewConfig(cli.FlagPrivateKey | cli.FlagOAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ReadFromEnvironment()
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"work", "home"} {
+		config.KeyringKeyName = name
+		if err := config.SavePrivateKey(skey); err != nil {
+			t.Fatalf("Failed to save key: %s", err)
+		}
+	}
+	config.KeyringTokenName = "fleet"
+	if err := config.SaveTokenToKeyring("token"); err != nil {
+		t.Fatalf("Failed to save token: %s", err)
+	}
+
+	names, err := config.KeyringKeyNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "home,work" {
+		t.Errorf("Unexpected key names: %v", names)
+	}
+	names, err = config.KeyringTokenNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "fleet" {
+		t.Errorf("Unexpected token names: %v", names)
+	}
+}
+
+func TestDefaultCacheFilename(t *testing.T) {
+	home := t.TempDir()
+	cacheHome := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", cacheHome)
+	t.Setenv(cli.EnvTeslaCacheFile, "")
+
+	newConfig := func(disable bool) *cli.Config {
+		config, err := cli.NewConfig(cli.FlagPrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.DisableCache = disable
+		config.ReadFromEnvironment()
+		return config
+	}
+
+	if runtime.GOOS == "linux" {
+		expected := filepath.Join(cacheHome, "vehicle-command", "sessions.json")
+		if got := newConfig(false).CacheFilename; got != expected {
+			t.Errorf("Expected cache file %s, got %s", expected, got)
+		}
+	}
+
+	legacy := filepath.Join(home, ".tesla-cache.json")
+	if err := os.WriteFile(legacy, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := newConfig(false).CacheFilename; got != legacy {
+		t.Errorf("Expected existing cache file %s, got %s", legacy, got)
+	}
+	if got := newConfig(true).CacheFilename; got != "" {
+		t.Errorf("Expected cache to be disabled, got %s", got)
+	}
+}
+
+func TestKeyAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := protocol.SavePrivateKey(skey, keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := cli.NewConfig(cli.FlagPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.KeyFilename = keyFile
+	config.KeyAuditLog = filepath.Join(dir, "key-audit.jsonl")
+	observed, err := config.PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sign.SignMessageForFleet(observed, "TelemetryClient", jwt.MapClaims{}); err != nil {
+		t.Fatal(err)
+	}
+	// Observed keys can still be exported.
+	if err := protocol.SavePrivateKey(observed, filepath.Join(dir, "copy.pem")); err != nil {
+		t.Errorf("Couldn't save observed key: %s", err)
+	}
+
+	contents, err := os.ReadFile(config.KeyAuditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var usage protocol.KeyUsage
+	if err := json.Unmarshal(contents, &usage); err != nil {
+		t.Fatalf("Invalid key audit log %q: %s", contents, err)
+	}
+	if usage.Operation != protocol.KeyOperationSign || usage.Purpose != protocol.KeyPurposeMessageSignature {
+		t.Errorf("Unexpected key usage %+v", usage)
+	}
+}
+
+func TestVINHashKeyFile(t *testing.T) {
+	defer redact.SetHashKey(nil)
+	keyFile := filepath.Join(t.TempDir(), "vin-hash-key")
+	if err := os.WriteFile(keyFile, []byte("deployment-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hash := func() string {
+		config, err := cli.NewConfig(cli.FlagVIN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.VINHashKeyFile = keyFile
+		config.ReadFromEnvironment()
+		return redact.HashVIN("5YJ3E1EA7KF000001")
+	}
+	first := hash()
+	redact.SetHashKey(nil)
+	if second := hash(); second != first {
+		t.Errorf("VIN hashes with the same key file differ: %s and %s", first, second)
+	}
+	redact.SetHashKey([]byte("deployment-secret"))
+	if got := redact.HashVIN("5YJ3E1EA7KF000001"); got != first {
+		t.Errorf("Key file whitespace is part of the key: %s and %s", got, first)
+	}
+}
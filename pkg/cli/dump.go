@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"flag"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/pkg/redact"
+
+	"github.com/99designs/keyring"
+)
+
+// Dump returns the effective configuration, keyed by command-line flag name, so that users can
+// check which settings a combination of flags, profile, and environment variables produced.
+// Empty settings are omitted.
+//
+// File paths and keyring entry names are reported, but secrets never are: the keyring password,
+// OAuth token, and private key appear as [redact.Secret] if they're set or loaded. The VIN is
+// redacted as it would be in logs.
+func (c *Config) Dump() map[string]string {
+	settings := make(map[string]string)
+	set := func(name, value string) {
+		if value != "" {
+			settings[name] = value
+		}
+	}
+	set("profile", c.Profile)
+	set("environment", c.Environment)
+	set("config", c.ConfigFilename)
+	set("fleet-api-host", c.FleetAPIHost)
+	set("region", c.Region)
+	set("transport", c.Transport)
+	if c.VIN != "" {
+		set("vin", redact.VIN(c.VIN))
+	}
+	set("vin-redaction", c.VINRedaction)
+	set("vin-hash-key-file", c.VINHashKeyFile)
+	set("bt-adapter", c.BtAdapterID)
+	set("domain", c.Domains.String())
+	set("key-name", c.KeyringKeyName)
+	set("key-file", c.KeyFilename)
+	set("token-name", c.KeyringTokenName)
+	set("token-file", c.TokenFilename)
+	set("session-cache", c.CacheFilename)
+	set("key-audit-log", c.KeyAuditLog)
+	set("user-agent", c.UserAgent)
+	if c.DisableCache {
+		set("no-session-cache", "true")
+	}
+	if backend := c.BackendType.String(); backend != string(keyring.InvalidBackend) {
+		set("keyring-type", backend)
+	}
+	set("keyring-file-dir", c.Backend.FileDir)
+	if c.Debug {
+		set("keyring-debug", "true")
+	}
+	if c.password != nil && *c.password != "" {
+		set("keyring-password", redact.Secret)
+	}
+	if c.oauthToken != "" {
+		set("oauth-token", redact.Secret)
+	}
+	if c.skey != nil {
+		set("private-key", redact.Secret)
+	}
+	return settings
+}
+
+// DumpFlags adds the values of the flags in fs to settings, as returned by [Config.Dump]. Flags
+// that settings already contains are skipped, so the effective values reported by Dump take
+// precedence over raw flag values. Flags whose names suggest that they hold a secret, rather than
+// the name of a file containing one, are reported as [redact.Secret], and URLs are reported
+// without their credentials (see [redact.URL]).
+func DumpFlags(fs *flag.FlagSet, settings map[string]string) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := settings[f.Name]; ok {
+			return
+		}
+		value := f.Value.String()
+		if value == "" {
+			return
+		}
+		if redact.IsSecretSetting(f.Name) {
+			value = redact.Secret
+		}
+		settings[f.Name] = redact.URL(value)
+	})
+}
+
+// FormatSettings renders settings as sorted "name = value" lines.
+func FormatSettings(settings map[string]string) string {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteString(" = ")
+		b.WriteString(strconv.Quote(settings[name]))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
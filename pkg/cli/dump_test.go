@@ -0,0 +1,85 @@
+package cli_test
+
+import (
+	"crypto/rand"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/redact"
+)
+
+func TestDumpRedactsSecrets(t *testing.T) {
+	const password = "correct-horse-battery-staple"
+	const token = "header.eyJzdWIiOiJzZWNyZXQtdG9rZW4ifQ.signature"
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "private.pem")
+	tokenFile := filepath.Join(dir, "token")
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protocol.SavePrivateKey(skey, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(tokenFile, []byte(token), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(cli.EnvTeslaKeyringPass, password)
+	t.Setenv(cli.EnvTeslaKeyFile, keyFile)
+	t.Setenv(cli.EnvTeslaTokenFile, tokenFile)
+	t.Setenv(cli.EnvTeslaVIN, "5YJ3E1EA7KF000001")
+
+	config, err := cli.NewConfig(cli.FlagAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ReadFromEnvironment()
+	if err := config.LoadCredentials(); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("key-file", "overridden", "")
+	fs.String("secret", password, "")
+	fs.String("secret-file", "/etc/secret", "")
+	fs.Duration("timeout", 0, "")
+	fs.String("audit-webhook", "https://hooks.example.com/audit?key="+password, "")
+	settings := config.Dump()
+	cli.DumpFlags(fs, settings)
+
+	for name, want := range map[string]string{
+		"key-file":         keyFile,
+		"token-file":       tokenFile,
+		"keyring-password": redact.Secret,
+		"oauth-token":      redact.Secret,
+		"private-key":      redact.Secret,
+		"secret":           redact.Secret,
+		"secret-file":      "/etc/secret",
+		"timeout":          "0s",
+		"audit-webhook":    "https://hooks.example.com/audit?key=" + redact.Secret,
+	} {
+		if got := settings[name]; got != want {
+			t.Errorf("Expected %s = %q, got %q", name, want, got)
+		}
+	}
+	if settings["vin"] == "5YJ3E1EA7KF000001" {
+		t.Error("VIN wasn't redacted")
+	}
+
+	output := cli.FormatSettings(settings)
+	pem, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{password, token, string(pem)} {
+		if strings.Contains(output, secret) {
+			t.Errorf("Configuration dump contains a secret:\n%s", output)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// ErrEnvironmentMismatch indicates that a private key or OAuth token configured by a flag,
+// environment variable, or profile belongs to a different environment than the one selected.
+var ErrEnvironmentMismatch = errors.New("credentials don't match environment")
+
+// An Environment bundles a Fleet API server with the credentials used with it, such as a staging
+// server and the key and token registered there. Selecting an environment with -environment sets
+// all of them together. Environments are stored in the configuration file alongside profiles:
+//
+//	[environments.production]
+//	fleet_api_url = "https://fleet-api.prd.na.vn.cloud.tesla.com"
+//	key_file = "/etc/tesla/production.pem"
+//	token_file = "/etc/tesla/production-token"
+//
+//	[environments.staging]
+//	fleet_api_url = "https://fleet-api.staging.example.com"
+//	key_file = "/etc/tesla/staging.pem"
+//	token_file = "/etc/tesla/staging-token"
+//
+// Each environment must set fleet_api_url and a private key, and environments may not share a key
+// or token. Credentials that belong to another environment are rejected when they're loaded, so a
+// production key can't be used with a staging server by mistake.
+type Environment struct {
+	FleetAPIHost string // Host (and optional port) from fleet_api_url
+	KeyFile      string
+	KeyName      string // Name of the private key in the system keyring
+	TokenFile    string
+	TokenName    string // Name of the OAuth token in the system keyring
+}
+
+func (e *Environment) set(key, value string) error {
+	switch key {
+	case "fleet_api_url":
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme != "https" || u.Host == "" || (u.Path != "" && u.Path != "/") ||
+			u.RawQuery != "" || u.User != nil {
+			return fmt.Errorf("fleet_api_url must be an https:// URL without a path, not %q", value)
+		}
+		e.FleetAPIHost = u.Host
+	case "key_file":
+		e.KeyFile = expandHome(value)
+	case "key_name":
+		e.KeyName = value
+	case "token_file":
+		e.TokenFile = expandHome(value)
+	case "token_name":
+		e.TokenName = value
+	default:
+		return fmt.Errorf("unrecognized key %s", key)
+	}
+	return nil
+}
+
+// credential identifies a private key or OAuth token by the key that configures it and its value.
+type credential struct {
+	kind, value string
+}
+
+// credentials lists the credentials configured in e.
+func (e *Environment) credentials() []credential {
+	var creds []credential
+	for _, cred := range []credential{
+		{"key_file", absPath(e.KeyFile)},
+		{"key_name", e.KeyName},
+		{"token_file", absPath(e.TokenFile)},
+		{"token_name", e.TokenName},
+	} {
+		if cred.value != "" {
+			creds = append(creds, cred)
+		}
+	}
+	return creds
+}
+
+// absPath makes filename absolute, so that different spellings of a path compare equal.
+func absPath(filename string) string {
+	if filename == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filename
+}
+
+// validateEnvironments checks that each environment is complete and that no two environments
+// share credentials.
+func validateEnvironments(environments map[string]*Environment) error {
+	names := make([]string, 0, len(environments))
+	for name := range environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	owners := make(map[credential]string)
+	for _, name := range names {
+		env := environments[name]
+		if env.FleetAPIHost == "" {
+			return fmt.Errorf("environment %s doesn't set fleet_api_url", name)
+		}
+		if env.KeyFile == "" && env.KeyName == "" {
+			return fmt.Errorf("environment %s doesn't set key_file or key_name", name)
+		}
+		for _, cred := range env.credentials() {
+			if owner, ok := owners[cred]; ok {
+				return fmt.Errorf("environments %s and %s share a %s", owner, name, cred.kind)
+			}
+			owners[cred] = name
+		}
+	}
+	return nil
+}
+
+// applyEnvironment fills in c's credentials from env and directs Fleet API requests to env's
+// server. Credentials that are already set must be env's own.
+func (c *Config) applyEnvironment(env *Environment, environments map[string]*Environment) error {
+	if c.Region != "" {
+		return fmt.Errorf("region %s can't be combined with environment %s, which sets the Fleet API server", c.Region, c.Environment)
+	}
+	if c.Flags.isSet(FlagPrivateKey) && c.KeyringKeyName == "" && c.KeyFilename == "" {
+		c.KeyringKeyName = env.KeyName
+		c.KeyFilename = env.KeyFile
+	}
+	if c.Flags.isSet(FlagOAuth) && c.KeyringTokenName == "" && c.TokenFilename == "" {
+		c.KeyringTokenName = env.TokenName
+		c.TokenFilename = env.TokenFile
+	}
+	c.FleetAPIHost = env.FleetAPIHost
+	c.environments = environments
+	return c.checkEnvironment()
+}
+
+// checkEnvironment returns ErrEnvironmentMismatch if c's private key or OAuth token isn't the one
+// configured for c.Environment. Credentials can be set by environment variables after
+// ReadFromProfile applies the environment, so they're checked again before they're loaded.
+func (c *Config) checkEnvironment() error {
+	env, ok := c.environments[c.Environment]
+	if !ok {
+		return nil
+	}
+	if c.Flags.isSet(FlagPrivateKey) && (absPath(c.KeyFilename) != absPath(env.KeyFile) || c.KeyringKeyName != env.KeyName) {
+		return fmt.Errorf("%w: private key isn't the one configured for environment %s", ErrEnvironmentMismatch, c.Environment)
+	}
+	if !c.Flags.isSet(FlagOAuth) {
+		return nil
+	}
+	if env.TokenFile != "" || env.TokenName != "" {
+		if absPath(c.TokenFilename) != absPath(env.TokenFile) || c.KeyringTokenName != env.TokenName {
+			return fmt.Errorf("%w: OAuth token isn't the one configured for environment %s", ErrEnvironmentMismatch, c.Environment)
+		}
+		return nil
+	}
+	// The environment doesn't configure a token, but the token mustn't belong to another one.
+	token := (&Environment{TokenFile: c.TokenFilename, TokenName: c.KeyringTokenName}).credentials()
+	for name, other := range c.environments {
+		for _, cred := range other.credentials() {
+			if slices.Contains(token, cred) {
+				return fmt.Errorf("%w: OAuth token belongs to environment %s, not %s", ErrEnvironmentMismatch, name, c.Environment)
+			}
+		}
+	}
+	return nil
+}
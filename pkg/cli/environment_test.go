@@ -0,0 +1,167 @@
+package cli_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+)
+
+const testEnvironments = `
+[environments.production]
+fleet_api_url = "https://fleet-api.prd.na.vn.cloud.tesla.com"
+key_file = "/etc/tesla/production.pem"
+token_file = "/etc/tesla/production-token"
+
+[environments.staging]
+fleet_api_url = "https://fleet-api.staging.example.com:8443/"
+key_name = "staging"
+
+[profiles.test-car]
+vin = "5YJ3E1EA7KF000003"
+environment = "staging"
+`
+
+func TestLoadEnvironments(t *testing.T) {
+	environments, err := cli.LoadEnvironments(writeProfiles(t, testEnvironments))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(environments) != 2 {
+		t.Fatalf("Expected two environments, got %d", len(environments))
+	}
+	if prod := environments["production"]; prod.FleetAPIHost != "fleet-api.prd.na.vn.cloud.tesla.com" ||
+		prod.KeyFile != "/etc/tesla/production.pem" || prod.TokenFile != "/etc/tesla/production-token" {
+		t.Errorf("Unexpected production environment: %+v", prod)
+	}
+	if staging := environments["staging"]; staging.FleetAPIHost != "fleet-api.staging.example.com:8443" || staging.KeyName != "staging" {
+		t.Errorf("Unexpected staging environment: %+v", staging)
+	}
+	profiles, err := cli.LoadProfiles(writeProfiles(t, testEnvironments))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profiles["test-car"].Environment != "staging" {
+		t.Errorf("Unexpected profile: %+v", profiles["test-car"])
+	}
+}
+
+func TestLoadEnvironmentsErrors(t *testing.T) {
+	const url = "fleet_api_url = \"https://fleet-api.example.com\"\n"
+	tests := map[string]string{
+		"missing URL":     "[environments.a]\nkey_name = \"a\"\n",
+		"missing key":     "[environments.a]\n" + url,
+		"http URL":        "[environments.a]\nfleet_api_url = \"http://fleet-api.example.com\"\nkey_name = \"a\"\n",
+		"URL with path":   "[environments.a]\nfleet_api_url = \"https://fleet-api.example.com/api\"\nkey_name = \"a\"\n",
+		"unknown key":     "[environments.a]\nregion = \"na\"\n",
+		"shared key":      "[environments.a]\n" + url + "key_file = \"k.pem\"\n[environments.b]\n" + url + "key_file = \"./k.pem\"\n",
+		"shared token":    "[environments.a]\n" + url + "key_name = \"a\"\ntoken_name = \"t\"\n[environments.b]\n" + url + "key_name = \"b\"\ntoken_name = \"t\"\n",
+		"duplicate table": "[environments.a]\n" + url + "key_name = \"a\"\n[environments.a]\n",
+	}
+	for name, contents := range tests {
+		_, err := cli.LoadEnvironments(writeProfiles(t, contents))
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+		} else if !strings.Contains(err.Error(), "config.toml:") {
+			t.Errorf("%s: expected error to include filename, got %s", name, err)
+		}
+	}
+}
+
+func newEnvironmentConfig(t *testing.T, flags cli.Flag) *cli.Config {
+	t.Helper()
+	clearProfileEnvironment(t)
+	t.Setenv(cli.EnvTeslaConfigFile, writeProfiles(t, testEnvironments))
+	config, err := cli.NewConfig(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestReadEnvironment(t *testing.T) {
+	config := newEnvironmentConfig(t, cli.FlagAll)
+	t.Setenv(cli.EnvTeslaEnvironment, "production")
+	t.Setenv(cli.EnvTeslaKeyFile, "/etc/tesla/staging.pem")
+	if err := config.ReadFromProfile(); err != nil {
+		t.Fatal(err)
+	}
+	config.ReadFromEnvironment()
+	if config.Environment != "production" || config.FleetAPIHost != "fleet-api.prd.na.vn.cloud.tesla.com" {
+		t.Errorf("Unexpected environment %q or host %q", config.Environment, config.FleetAPIHost)
+	}
+	// The environment takes precedence over environment variables, as profiles do.
+	if config.KeyFilename != "/etc/tesla/production.pem" || config.TokenFilename != "/etc/tesla/production-token" {
+		t.Errorf("Expected credentials from environment, got key %q and token %q", config.KeyFilename, config.TokenFilename)
+	}
+
+	// A profile can select an environment.
+	config = newEnvironmentConfig(t, cli.FlagAll)
+	config.Profile = "test-car"
+	if err := config.ReadFromProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if config.Environment != "staging" || config.KeyringKeyName != "staging" || config.VIN != "5YJ3E1EA7KF000003" {
+		t.Errorf("Profile didn't apply environment: %+v", config)
+	}
+
+	config = newEnvironmentConfig(t, cli.FlagAll)
+	config.Environment = "qa"
+	if err := config.ReadFromProfile(); !errors.Is(err, cli.ErrEnvironmentNotFound) {
+		t.Errorf("Expected ErrEnvironmentNotFound, got %v", err)
+	}
+}
+
+func TestEnvironmentMismatch(t *testing.T) {
+	// Simulate a -key-file flag naming the production key.
+	config := newEnvironmentConfig(t, cli.FlagPrivateKey)
+	config.Environment = "staging"
+	config.KeyFilename = "/etc/tesla/production.pem"
+	if err := config.ReadFromProfile(); !errors.Is(err, cli.ErrEnvironmentMismatch) {
+		t.Errorf("Expected ErrEnvironmentMismatch for production key, got %v", err)
+	}
+
+	// Staging doesn't configure a token, so a token from the environment could be production's.
+	config = newEnvironmentConfig(t, cli.FlagAll)
+	config.Environment = "staging"
+	t.Setenv(cli.EnvTeslaTokenFile, "/etc/tesla/production-token")
+	if err := config.ReadFromProfile(); err != nil {
+		t.Fatal(err)
+	}
+	config.ReadFromEnvironment()
+	if _, err := config.Account(); !errors.Is(err, cli.ErrEnvironmentMismatch) {
+		t.Errorf("Expected ErrEnvironmentMismatch for production token, got %v", err)
+	}
+
+	config = newEnvironmentConfig(t, cli.FlagAll)
+	config.Environment = "staging"
+	config.Region = "eu"
+	if err := config.ReadFromProfile(); err == nil {
+		t.Errorf("Expected error combining a region with an environment")
+	}
+}
+
+func TestEnvironmentFleetAPIHost(t *testing.T) {
+	config := newEnvironmentConfig(t, cli.FlagOAuth)
+	config.Environment = "staging"
+	token := "header." + base64.RawStdEncoding.EncodeToString(
+		[]byte(`{"aud":["https://fleet-api.prd.na.vn.cloud.tesla.com"],"sub":"test"}`)) + ".signature"
+	config.TokenFilename = filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(config.TokenFilename, []byte(token), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ReadFromProfile(); err != nil {
+		t.Fatal(err)
+	}
+	acct, err := config.Account()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acct.Host != "fleet-api.staging.example.com:8443" {
+		t.Errorf("Expected staging host, got %s", acct.Host)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/teslamotors/vehicle-command/internal/authentication"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
@@ -140,7 +142,7 @@ func (c *Config) fullKeyName() string {
 
 // SaveKeyToKeyring writes a private key to the system keyring.
 func (c *Config) saveKeyToKeyring(key protocol.ECDHPrivateKey) error {
-	nativeKey, ok := key.(*authentication.NativeECDHKey)
+	nativeKey, ok := authentication.UnwrapKey(key).(*authentication.NativeECDHKey)
 	if !ok {
 		return fmt.Errorf("key is not exportable")
 	}
@@ -172,3 +174,47 @@ func (c *Config) DeletePrivateKey() error {
 	}
 	return kr.Remove(c.fullKeyName())
 }
+
+// storedPassword returns the keyring password provided through the environment without prompting.
+func (c *Config) storedPassword(string) (string, error) {
+	if c.password != nil && *c.password != "" {
+		return *c.password, nil
+	}
+	return "", fmt.Errorf("keyring password not available without prompting")
+}
+
+// listKeyringNames returns the names of keyring items belonging to service. It never prompts for a
+// password; file-backed keyrings can only be listed if the password is set in the environment.
+func (c *Config) listKeyringNames(service string) ([]string, error) {
+	backend := c.Backend
+	backend.FilePasswordFunc = c.storedPassword
+	backend.KeychainPasswordFunc = c.storedPassword
+	kr, err := keyring.Open(backend)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := kr.Keys()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, key := range keys {
+		if name, ok := strings.CutPrefix(key, service+"."); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// KeyringKeyNames returns the names of private keys stored in the system keyring, for use with
+// -key-name. Unlike methods that load credentials, it never prompts for a keyring password, which
+// makes it suitable for non-interactive uses such as shell completion.
+func (c *Config) KeyringKeyNames() ([]string, error) {
+	return c.listKeyringNames(keyringKeyService)
+}
+
+// KeyringTokenNames is like [Config.KeyringKeyNames], but returns the names of OAuth tokens.
+func (c *Config) KeyringTokenNames() ([]string, error) {
+	return c.listKeyringNames(keyringTokenService)
+}
@@ -0,0 +1,327 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/teslamotors/vehicle-command/internal/log"
+)
+
+// Values of [Profile.Transport]. An empty transport connects over the Internet if an OAuth token is
+// configured, and otherwise over BLE.
+const (
+	TransportBLE      = "ble"
+	TransportInternet = "internet"
+)
+
+// regionHosts maps [Profile.Region] values to Fleet API servers.
+var regionHosts = map[string]string{
+	"na": "fleet-api.prd.na.vn.cloud.tesla.com",
+	"eu": "fleet-api.prd.eu.vn.cloud.tesla.com",
+	"cn": "fleet-api.prd.cn.vn.cloud.tesla.cn",
+}
+
+// ErrProfileNotFound indicates the selected profile isn't defined in the configuration file.
+var ErrProfileNotFound = errors.New("profile not found")
+
+// ErrEnvironmentNotFound indicates the selected environment isn't defined in the configuration
+// file.
+var ErrEnvironmentNotFound = errors.New("environment not found")
+
+// A Profile bundles the settings for one vehicle or fleet, so that switching between them only
+// requires selecting a different profile. Profiles are stored in a configuration file as TOML
+// tables:
+//
+//	[profiles.personal]
+//	vin = "5YJ3E1EA7KF000001"
+//	key_file = "~/.tesla/personal.pem"
+//	transport = "ble"
+//
+//	[profiles.work]
+//	vin = "5YJ3E1EA7KF000002"
+//	key_name = "work"
+//	token_file = "~/.tesla/fleet-token"
+//	region = "eu"
+//
+// A profile may also select an [Environment] defined in the same file.
+type Profile struct {
+	VIN       string
+	KeyFile   string
+	KeyName   string // Name of the private key in the system keyring
+	TokenFile string
+	TokenName string // Name of the OAuth token in the system keyring
+	Transport string // TransportBLE, TransportInternet, or empty
+	Region    string // Fleet API region: na, eu, or cn. Overrides the region in the OAuth token.
+	// Environment names the environment applied along with the profile, unless one is selected
+	// explicitly.
+	Environment string
+}
+
+// DefaultConfigFilename returns the configuration file used when $TESLA_CONFIG_FILE isn't set:
+// tesla-control/config.toml in the user configuration directory (~/.config on Linux).
+func DefaultConfigFilename() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tesla-control", "config.toml")
+}
+
+// configFile holds the tables defined in a configuration file.
+type configFile struct {
+	profiles     map[string]*Profile
+	environments map[string]*Environment
+}
+
+// LoadProfiles reads the profiles defined in filename.
+func LoadProfiles(filename string) (map[string]*Profile, error) {
+	config, err := loadConfigFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return config.profiles, nil
+}
+
+// LoadEnvironments reads the environments defined in filename.
+func LoadEnvironments(filename string) (map[string]*Environment, error) {
+	config, err := loadConfigFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return config.environments, nil
+}
+
+func loadConfigFile(filename string) (*configFile, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseConfigFile(filename, file)
+}
+
+// tableSetter is implemented by the types of configuration file tables.
+type tableSetter interface {
+	set(key, value string) error
+}
+
+// tableDecoder decodes a configuration file table with the set method of its type, which
+// validates each value.
+type tableDecoder struct {
+	table tableSetter
+}
+
+// UnmarshalTOML implements toml.Unmarshaler.
+func (d tableDecoder) UnmarshalTOML(data any) error {
+	values, ok := data.(map[string]any)
+	if !ok {
+		return errors.New("expected a table")
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, ok := values[key].(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", key)
+		}
+		if err := d.table.set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseConfigFile parses a configuration file, which contains [profiles.NAME] and
+// [environments.NAME] tables of string values.
+func parseConfigFile(filename string, r io.Reader) (*configFile, error) {
+	var tables struct {
+		Profiles     map[string]toml.Primitive `toml:"profiles"`
+		Environments map[string]toml.Primitive `toml:"environments"`
+	}
+	meta, err := toml.NewDecoder(r).Decode(&tables)
+	if err != nil {
+		return nil, configFileError(filename, err)
+	}
+	config := &configFile{
+		profiles:     make(map[string]*Profile),
+		environments: make(map[string]*Environment),
+	}
+	for name, primitive := range tables.Profiles {
+		profile := &Profile{}
+		if err := meta.PrimitiveDecode(primitive, tableDecoder{profile}); err != nil {
+			return nil, configFileError(filename, err)
+		}
+		config.profiles[name] = profile
+	}
+	for name, primitive := range tables.Environments {
+		env := &Environment{}
+		if err := meta.PrimitiveDecode(primitive, tableDecoder{env}); err != nil {
+			return nil, configFileError(filename, err)
+		}
+		config.environments[name] = env
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: expected [profiles.NAME] or [environments.NAME] tables, got %s", filename, undecoded[0])
+	}
+	if err := validateEnvironments(config.environments); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return config, nil
+}
+
+// configFileError adds filename and, if err has one, the line number to an error from the TOML
+// decoder.
+func configFileError(filename string, err error) error {
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("%s:%d: %s", filename, parseErr.Position.Line, parseErr.Message)
+	}
+	return fmt.Errorf("%s: %w", filename, err)
+}
+
+func (p *Profile) set(key, value string) error {
+	switch key {
+	case "vin":
+		p.VIN = value
+	case "key_file":
+		p.KeyFile = expandHome(value)
+	case "key_name":
+		p.KeyName = value
+	case "token_file":
+		p.TokenFile = expandHome(value)
+	case "token_name":
+		p.TokenName = value
+	case "transport":
+		if value != TransportBLE && value != TransportInternet {
+			return fmt.Errorf("transport must be %s or %s, not %q", TransportBLE, TransportInternet, value)
+		}
+		p.Transport = value
+	case "region":
+		if _, ok := regionHosts[value]; !ok {
+			return fmt.Errorf("unrecognized region %q", value)
+		}
+		p.Region = value
+	case "environment":
+		p.Environment = value
+	default:
+		return fmt.Errorf("unrecognized key %s", key)
+	}
+	return nil
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+func (c *Config) configFilename() string {
+	if c.ConfigFilename != "" {
+		return c.ConfigFilename
+	}
+	if filename := os.Getenv(EnvTeslaConfigFile); filename != "" {
+		return filename
+	}
+	return DefaultConfigFilename()
+}
+
+// ReadFromProfile populates c using the profile named by c.Profile, or $TESLA_PROFILE if c.Profile
+// isn't set. Values that are already populated are not overwritten, so command-line flags take
+// precedence over the profile.
+//
+// It then applies the environment named by c.Environment, $TESLA_ENVIRONMENT, or the profile, in
+// that order of precedence; see [Environment].
+//
+// Call ReadFromProfile after flag.Parse() and before [Config.ReadFromEnvironment], so that the
+// profile takes precedence over environment variables. It does nothing if neither a profile nor an
+// environment is selected.
+func (c *Config) ReadFromProfile() error {
+	if c.Profile == "" && c.Flags.usesProfiles() {
+		c.Profile = os.Getenv(EnvTeslaProfile)
+	}
+	if c.Environment == "" && c.Flags.usesEnvironments() {
+		c.Environment = os.Getenv(EnvTeslaEnvironment)
+	}
+	if c.Profile == "" && c.Environment == "" {
+		return nil
+	}
+	filename := c.configFilename()
+	config, err := loadConfigFile(filename)
+	if err != nil {
+		if c.Profile == "" {
+			return fmt.Errorf("couldn't load environment %s: %w", c.Environment, err)
+		}
+		return fmt.Errorf("couldn't load profile %s: %w", c.Profile, err)
+	}
+	if c.Profile != "" {
+		if err := c.applyProfile(filename, config.profiles); err != nil {
+			return err
+		}
+	}
+	if c.Environment == "" {
+		return nil
+	}
+	env, ok := config.environments[c.Environment]
+	if !ok {
+		return fmt.Errorf("%w: %s isn't defined in %s", ErrEnvironmentNotFound, c.Environment, filename)
+	}
+	log.Debug("Using environment '%s' from %s", c.Environment, filename)
+	return c.applyEnvironment(env, config.environments)
+}
+
+func (c *Config) applyProfile(filename string, profiles map[string]*Profile) error {
+	p, ok := profiles[c.Profile]
+	if !ok {
+		return fmt.Errorf("%w: %s isn't defined in %s", ErrProfileNotFound, c.Profile, filename)
+	}
+	log.Debug("Using profile '%s' from %s", c.Profile, filename)
+
+	if c.Flags.isSet(FlagVIN) && c.VIN == "" {
+		c.VIN = p.VIN
+	}
+	if c.Flags.isSet(FlagPrivateKey) && c.KeyringKeyName == "" && c.KeyFilename == "" {
+		c.KeyringKeyName = p.KeyName
+		c.KeyFilename = p.KeyFile
+	}
+	if c.Flags.isSet(FlagOAuth) && c.KeyringTokenName == "" && c.TokenFilename == "" {
+		c.KeyringTokenName = p.TokenName
+		c.TokenFilename = p.TokenFile
+	}
+	if c.Transport == "" {
+		c.Transport = p.Transport
+	}
+	if c.Region == "" {
+		c.Region = p.Region
+	}
+	if c.Environment == "" && c.Flags.usesEnvironments() {
+		c.Environment = p.Environment
+	}
+	return nil
+}
+
+// profileNames lists the profiles in c's configuration file, for shell completion.
+func (c *Config) profileNames() []string {
+	profiles, err := LoadProfiles(c.configFilename())
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,203 @@
+package cli_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/cli"
+)
+
+const testProfiles = `# Vehicles
+[profiles.personal]
+vin = "5YJ3E1EA7KF000001"
+key_file = "~/personal.pem" # expanded
+transport = "ble"
+
+[profiles.work]
+vin = '5YJ3E1EA7KF000002'
+key_name = "work"
+token_file = "/etc/tesla/token"
+transport = "internet"
+region = "eu"
+`
+
+func writeProfiles(t *testing.T, contents string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(filename, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func clearProfileEnvironment(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{
+		cli.EnvTeslaProfile, cli.EnvTeslaConfigFile, cli.EnvTeslaVIN, cli.EnvTeslaKeyName,
+		cli.EnvTeslaKeyFile, cli.EnvTeslaTokenName, cli.EnvTeslaTokenFile, cli.EnvTeslaEnvironment,
+	} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	profiles, err := cli.LoadProfiles(writeProfiles(t, testProfiles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 {
+		t.Fatalf("Expected two profiles, got %d", len(profiles))
+	}
+	personal := profiles["personal"]
+	if personal.VIN != "5YJ3E1EA7KF000001" || personal.KeyFile != filepath.Join(home, "personal.pem") || personal.Transport != cli.TransportBLE {
+		t.Errorf("Unexpected personal profile: %+v", personal)
+	}
+	work := profiles["work"]
+	if work.VIN != "5YJ3E1EA7KF000002" || work.KeyName != "work" || work.TokenFile != "/etc/tesla/token" || work.Region != "eu" {
+		t.Errorf("Unexpected work profile: %+v", work)
+	}
+}
+
+func TestLoadProfilesErrors(t *testing.T) {
+	tests := map[string]string{
+		"outside table":   "vin = \"5YJ3E1EA7KF000001\"\n",
+		"unknown key":     "[profiles.a]\nvim = \"5YJ3E1EA7KF000001\"\n",
+		"unquoted":        "[profiles.a]\nvin = 5YJ3E1EA7KF000001\n",
+		"unterminated":    "[profiles.a]\nvin = \"5YJ3E1EA7KF000001\n",
+		"bad transport":   "[profiles.a]\ntransport = \"wifi\"\n",
+		"bad region":      "[profiles.a]\nregion = \"mars\"\n",
+		"bad table":       "[vehicles.a]\n",
+		"duplicate table": "[profiles.a]\n[profiles.a]\n",
+	}
+	for name, contents := range tests {
+		_, err := cli.LoadProfiles(writeProfiles(t, contents))
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+		} else if !strings.Contains(err.Error(), "config.toml:") {
+			t.Errorf("%s: expected error to include line number, got %s", name, err)
+		}
+	}
+}
+
+func TestProfilePrecedence(t *testing.T) {
+	clearProfileEnvironment(t)
+	t.Setenv(cli.EnvTeslaConfigFile, writeProfiles(t, testProfiles))
+	t.Setenv(cli.EnvTeslaProfile, "work")
+	t.Setenv(cli.EnvTeslaVIN, "environment VIN")
+	t.Setenv(cli.EnvTeslaKeyFile, "environment.pem")
+	t.Setenv(cli.EnvTeslaTokenName, "environment token")
+
+	config, err := cli.NewConfig(cli.FlagAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a command-line flag
+	config.VIN = "flag VIN"
+	if err := config.ReadFromProfile(); err != nil {
+		t.Fatal(err)
+	}
+	config.ReadFromEnvironment()
+
+	// Flags override the profile
+	if config.VIN != "flag VIN" {
+		t.Errorf("Expected VIN from flag, got %s", config.VIN)
+	}
+	// The profile overrides the environment
+	if config.KeyringKeyName != "work" || config.KeyFilename != "" {
+		t.Errorf("Expected key from profile, got name %q and file %q", config.KeyringKeyName, config.KeyFilename)
+	}
+	if config.TokenFilename != "/etc/tesla/token" || config.KeyringTokenName != "" {
+		t.Errorf("Expected token from profile, got name %q and file %q", config.KeyringTokenName, config.TokenFilename)
+	}
+	if config.Transport != cli.TransportInternet || config.Region != "eu" {
+		t.Errorf("Unexpected transport %q or region %q", config.Transport, config.Region)
+	}
+}
+
+func TestProfileFlagOverridesEnvironment(t *testing.T) {
+	clearProfileEnvironment(t)
+	t.Setenv(cli.EnvTeslaConfigFile, writeProfiles(t, testProfiles))
+	t.Setenv(cli.EnvTeslaProfile, "work")
+
+	config, err := cli.NewConfig(cli.FlagAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Profile = "personal"
+	if err := config.ReadFromProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if config.VIN != "5YJ3E1EA7KF000001" {
+		t.Errorf("Expected VIN from personal profile, got %s", config.VIN)
+	}
+}
+
+func TestProfileRespectsFlags(t *testing.T) {
+	clearProfileEnvironment(t)
+	t.Setenv(cli.EnvTeslaConfigFile, writeProfiles(t, testProfiles))
+
+	config, err := cli.NewConfig(cli.FlagOAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Profile = "work"
+	if err := config.ReadFromProfile(); err != nil {
+		t.Fatal(err)
+	}
+	if config.VIN != "" || config.KeyringKeyName != "" {
+		t.Errorf("Profile set fields disabled by Flags: VIN %q, key name %q", config.VIN, config.KeyringKeyName)
+	}
+	if config.TokenFilename != "/etc/tesla/token" {
+		t.Errorf("Expected token file from profile, got %q", config.TokenFilename)
+	}
+}
+
+func TestMissingProfile(t *testing.T) {
+	clearProfileEnvironment(t)
+	filename := writeProfiles(t, testProfiles)
+
+	config, err := cli.NewConfig(cli.FlagAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ReadFromProfile(); err != nil {
+		t.Errorf("Expected no error without a profile, got %s", err)
+	}
+
+	config.ConfigFilename = filename
+	config.Profile = "garage"
+	if err := config.ReadFromProfile(); !errors.Is(err, cli.ErrProfileNotFound) {
+		t.Errorf("Expected ErrProfileNotFound, got %v", err)
+	}
+
+	config.ConfigFilename = filepath.Join(t.TempDir(), "missing.toml")
+	if err := config.ReadFromProfile(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected missing file error, got %v", err)
+	}
+}
+
+func TestProfilesIgnoredWithoutProfileFlags(t *testing.T) {
+	clearProfileEnvironment(t)
+	t.Setenv(cli.EnvTeslaConfigFile, writeProfiles(t, testProfiles))
+	t.Setenv(cli.EnvTeslaProfile, "work")
+	t.Setenv(cli.EnvTeslaEnvironment, "staging")
+
+	config, err := cli.NewConfig(cli.FlagBLE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ReadFromProfile(); err != nil {
+		t.Fatalf("Expected profile and environment to be ignored, got %s", err)
+	}
+	if config.Profile != "" || config.Environment != "" || config.Transport != "" {
+		t.Errorf("Applied profile %q and environment %q without profile flags", config.Profile, config.Environment)
+	}
+	if _, ok := config.FlagValues()["profile"]; ok {
+		t.Errorf("Offered profile completion without profile flags")
+	}
+}
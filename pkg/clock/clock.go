@@ -0,0 +1,187 @@
+// Package clock abstracts the passage of time so that timeouts, retries, and cache expiration can
+// be tested deterministically.
+//
+// Production code uses Real, which defers to the time package. Tests substitute a Fake and advance
+// it explicitly instead of sleeping.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates timers.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel that receives the current time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+	// NewTimer returns a Timer that fires once d has elapsed.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the Clock equivalent of a *time.Timer.
+type Timer interface {
+	// C returns the channel on which the timer delivers the time when it fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. It returns false if the timer had already fired or been
+	// stopped.
+	Stop() bool
+	// Reset changes the timer to fire once d has elapsed. It returns true if the timer was active.
+	Reset(d time.Duration) bool
+}
+
+// Real is the system clock.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// Since returns the time elapsed on c since t.
+func Since(c Clock, t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Fake is a Clock that only moves forward when Advance is called. It's safe for concurrent use.
+type Fake struct {
+	lock    sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+// NewFake returns a Fake that reads start until it's advanced.
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.changed = sync.NewCond(&f.lock)
+	return f
+}
+
+// Now returns the fake time.
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// After returns a channel that receives the fake time once f has advanced by d.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer returns a Timer that fires once f has advanced by d. A timer with a non-positive
+// duration fires immediately.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: f, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves f forward by d, firing timers that expire along the way in order.
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	end := f.now.Add(d)
+	sort.SliceStable(f.timers, func(i, j int) bool {
+		return f.timers[i].deadline.Before(f.timers[j].deadline)
+	})
+	fired := 0
+	for _, t := range f.timers {
+		if t.deadline.After(end) {
+			break
+		}
+		f.now = t.deadline
+		t.fire(f.now)
+		fired++
+	}
+	f.timers = f.timers[fired:]
+	f.now = end
+	f.changed.Broadcast()
+}
+
+// Waiters returns the number of timers that haven't yet fired or been stopped.
+func (f *Fake) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.timers)
+}
+
+// BlockUntil waits until at least n timers are pending. Tests use it to make sure that the code
+// under test is waiting on f before advancing it.
+func (f *Fake) BlockUntil(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for len(f.timers) < n {
+		f.changed.Wait()
+	}
+}
+
+// remove deletes t from the pending timers. The caller must hold f.lock.
+func (f *Fake) remove(t *fakeTimer) bool {
+	for i, pending := range f.timers {
+		if pending == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	ch       chan time.Time
+	deadline time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+// fire delivers now without blocking, as a *time.Timer does if nobody reads its channel.
+func (t *fakeTimer) fire(now time.Time) {
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	f := t.clock
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	active := f.remove(t)
+	t.deadline = f.now.Add(d)
+	if d <= 0 {
+		t.fire(f.now)
+	} else {
+		f.timers = append(f.timers, t)
+	}
+	f.changed.Broadcast()
+	return active
+}
@@ -0,0 +1,68 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func fired(t Timer) bool {
+	select {
+	case <-t.C():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFake(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	f := NewFake(start)
+	short := f.NewTimer(time.Second)
+	long := f.NewTimer(time.Minute)
+	stopped := f.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Errorf("Stop() returned false for an active timer")
+	}
+	if got := f.Waiters(); got != 2 {
+		t.Errorf("Expected 2 waiters, got %d", got)
+	}
+
+	f.Advance(999 * time.Millisecond)
+	if fired(short) {
+		t.Errorf("Timer fired early")
+	}
+	f.Advance(time.Millisecond)
+	if !fired(short) || fired(long) || fired(stopped) {
+		t.Errorf("Wrong timers fired after one second")
+	}
+	if got := Since(f, start); got != time.Second {
+		t.Errorf("Expected one second to elapse, got %s", got)
+	}
+	if short.Stop() {
+		t.Errorf("Stop() returned true for an expired timer")
+	}
+
+	if !long.Reset(time.Second) {
+		t.Errorf("Reset() returned false for an active timer")
+	}
+	f.Advance(time.Hour)
+	if !fired(long) {
+		t.Errorf("Reset timer didn't fire")
+	}
+	if !fired(f.NewTimer(0)) {
+		t.Errorf("Timer with zero duration didn't fire immediately")
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(time.Unix(0, 0))
+	done := make(chan time.Time)
+	go func() {
+		done <- <-f.After(time.Second)
+	}()
+	f.BlockUntil(1)
+	f.Advance(time.Second)
+	if got := <-done; !got.Equal(time.Unix(1, 0)) {
+		t.Errorf("After delivered %s", got)
+	}
+}
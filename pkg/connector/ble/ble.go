@@ -8,14 +8,17 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-ble/ble"
-	"github.com/teslamotors/vehicle-command/internal/log"
+	logger "github.com/teslamotors/vehicle-command/internal/log"
 	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 )
 
+var log = logger.Module(logger.ModuleBLE)
+
 const (
 	maxBLEMTUSize     = ble.MaxMTU // Max MTU size accepted by the client (this library)
 	maxBLEMessageSize = 1024
@@ -50,6 +53,7 @@ type Connection struct {
 	client      ble.Client
 	lastRx      time.Time
 	lock        sync.Mutex
+	tap         atomic.Pointer[connector.FrameTap]
 }
 
 func (c *Connection) PreferredAuthMethod() connector.AuthMethod {
@@ -74,6 +78,7 @@ func (c *Connection) flush() bool {
 		if len(c.inputBuffer) >= 2+msgLength {
 			buffer := c.inputBuffer[2 : 2+msgLength]
 			log.Debug("RX: %02x", buffer)
+			c.tap.Load().Observe(c.vin, connector.FrameIncoming, buffer)
 			c.inputBuffer = c.inputBuffer[2+msgLength:]
 			select {
 			case c.inbox <- buffer:
@@ -111,6 +116,7 @@ func (c *Connection) Send(_ context.Context, buffer []byte) error {
 
 	var out []byte
 	log.Debug("TX: %02x", buffer)
+	c.tap.Load().Observe(c.vin, connector.FrameOutgoing, buffer)
 	out = append(out, uint8(len(buffer)>>8), uint8(len(buffer)))
 	out = append(out, buffer...)
 	blockLength := c.blockLength
@@ -119,7 +125,8 @@ func (c *Connection) Send(_ context.Context, buffer []byte) error {
 			blockLength = len(out)
 		}
 		if err := c.client.WriteCharacteristic(c.txChar, out[:blockLength], false); err != nil {
-			return err
+			// The vehicle discards incomplete messages, so it can't have acted on this one.
+			return fmt.Errorf("%w: %w", protocol.ErrNotConnected, err)
 		}
 		out = out[blockLength:]
 	}
@@ -130,6 +137,11 @@ func (c *Connection) VIN() string {
 	return c.vin
 }
 
+// ObserveFrames copies messages sent and received by c, without BLE length prefixes, to tap.
+func (c *Connection) ObserveFrames(tap *connector.FrameTap) {
+	c.tap.Store(tap)
+}
+
 func VehicleLocalName(vin string) string {
 	vinBytes := []byte(vin)
 	digest := sha1.Sum(vinBytes)
@@ -257,6 +269,8 @@ func NewConnection(ctx context.Context, vin string) (*Connection, error) {
 // NewConnectionFromScanResult creates a new BLE connection to the given target.
 // If target is nil, the vehicle will be scanned for.
 func NewConnectionFromScanResult(ctx context.Context, vin string, target *ScanResult) (*Connection, error) {
+	start := time.Now()
+	defer connector.RecordTiming(ctx, func(t *connector.Timing) { t.Connect += time.Since(start) })
 	var lastError error
 	for {
 		conn, retry, err := tryToConnect(ctx, vin, target)
@@ -3,7 +3,6 @@ package ble
 import (
 	"github.com/go-ble/ble"
 	"github.com/go-ble/ble/darwin"
-	"github.com/teslamotors/vehicle-command/internal/log"
 )
 
 func IsAdapterError(_ error) bool {
@@ -70,3 +70,9 @@ type FleetAPIConnector interface {
 	SendFleetAPICommand(ctx context.Context, endpoint string, command interface{}) ([]byte, error)
 	Wakeup(ctx context.Context) error
 }
+
+// SleepStateReporter is implemented by Connectors that can determine whether the vehicle is awake
+// without contacting it, and therefore without waking it.
+type SleepStateReporter interface {
+	IsAwake(ctx context.Context) (bool, error)
+}
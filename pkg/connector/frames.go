@@ -0,0 +1,133 @@
+package connector
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FrameDirection indicates whether a Frame was sent to or received from a vehicle.
+type FrameDirection int
+
+const (
+	// FrameOutgoing frames were sent to the vehicle.
+	FrameOutgoing FrameDirection = iota
+	// FrameIncoming frames were received from the vehicle.
+	FrameIncoming
+)
+
+func (d FrameDirection) String() string {
+	if d == FrameIncoming {
+		return "rx"
+	}
+	return "tx"
+}
+
+// Frame is a raw datagram exchanged with a vehicle: an encoded RoutableMessage, without any
+// transport-specific framing.
+//
+// Frames are sensitive. Although commands are authenticated, and encrypted over BLE, frames
+// include session state, key identifiers, and over the Internet, unencrypted command payloads and
+// vehicle responses. Don't record them in production or share them without reviewing their
+// contents.
+type Frame struct {
+	VIN       string
+	Direction FrameDirection
+	Time      time.Time
+	Data      []byte
+}
+
+// FrameObserver receives frames from a FrameTap. Frames are delivered in order from a single
+// goroutine, and the observer may retain Frame.Data.
+type FrameObserver func(frame Frame)
+
+// FrameTapBufferSize is the number of frames a FrameTap queues for a slow observer before it
+// starts dropping them.
+const FrameTapBufferSize = 256
+
+// FrameTap copies frames from connectors to a FrameObserver, which is intended for debugging
+// protocol implementations. Connectors that implement FrameObservable accept a FrameTap, and one
+// FrameTap may be shared by any number of connections.
+//
+// Observing frames never blocks the connector: if the observer falls FrameTapBufferSize frames
+// behind, further frames are dropped and counted until it catches up.
+type FrameTap struct {
+	frames  chan Frame
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	lock   sync.RWMutex
+	closed bool
+}
+
+// NewFrameTap starts delivering frames to observer. Call [FrameTap.Close] to stop.
+func NewFrameTap(observer FrameObserver) *FrameTap {
+	t := &FrameTap{
+		frames: make(chan Frame, FrameTapBufferSize),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(t.done)
+		for frame := range t.frames {
+			observer(frame)
+		}
+	}()
+	return t
+}
+
+// Observe queues a copy of data for the observer. It's safe to call on a nil FrameTap, which
+// discards data, and after Close.
+func (t *FrameTap) Observe(vin string, direction FrameDirection, data []byte) {
+	if t == nil {
+		return
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	if t.closed {
+		return
+	}
+	frame := Frame{
+		VIN:       vin,
+		Direction: direction,
+		Time:      time.Now(),
+		Data:      append([]byte(nil), data...),
+	}
+	select {
+	case t.frames <- frame:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of frames discarded because the observer fell behind.
+func (t *FrameTap) Dropped() uint64 {
+	return t.dropped.Load()
+}
+
+// Close stops accepting frames and waits for the observer to receive those already queued.
+// Repeated calls are allowed.
+func (t *FrameTap) Close() {
+	t.lock.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.frames)
+	}
+	t.lock.Unlock()
+	<-t.done
+}
+
+// FrameObservable is implemented by Connectors that can report the frames they exchange with the
+// vehicle to a FrameTap. Passing a nil FrameTap stops reporting.
+type FrameObservable interface {
+	ObserveFrames(tap *FrameTap)
+}
+
+// WriteFrames returns a FrameObserver that writes each frame to w as a line containing its time,
+// direction, VIN, and hex-encoded contents. Write errors are ignored.
+func WriteFrames(w io.Writer) FrameObserver {
+	return func(frame Frame) {
+		fmt.Fprintf(w, "%s %s %s %x\n", frame.Time.UTC().Format(time.RFC3339Nano), frame.Direction, frame.VIN, frame.Data)
+	}
+}
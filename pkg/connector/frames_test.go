@@ -0,0 +1,68 @@
+package connector
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameTapDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	var received int
+	tap := NewFrameTap(func(Frame) {
+		<-release
+		received++
+	})
+
+	data := []byte{1, 2, 3}
+	done := make(chan struct{})
+	go func() {
+		// The observer holds one frame, and the rest fill the queue or are dropped.
+		for i := 0; i < FrameTapBufferSize+10; i++ {
+			tap.Observe("VIN123", FrameOutgoing, data)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Observe blocked on a slow observer")
+	}
+	data[0] = 9
+
+	close(release)
+	tap.Close()
+	if uint64(received)+tap.Dropped() != FrameTapBufferSize+10 {
+		t.Errorf("Received %d frames and dropped %d", received, tap.Dropped())
+	}
+	if tap.Dropped() == 0 {
+		t.Error("Expected frames to be dropped")
+	}
+	tap.Observe("VIN123", FrameOutgoing, data) // Ignored after Close
+	tap.Close()
+
+	var nilTap *FrameTap
+	nilTap.Observe("VIN123", FrameIncoming, data)
+}
+
+func TestWriteFrames(t *testing.T) {
+	var out bytes.Buffer
+	tap := NewFrameTap(WriteFrames(&out))
+	data := []byte{0xca, 0xfe}
+	tap.Observe("VIN123", FrameOutgoing, data)
+	data[0] = 0 // The tap keeps its own copy
+	tap.Observe("VIN123", FrameIncoming, []byte{0x01})
+	tap.Close()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", out.String())
+	}
+	if fields := strings.Fields(lines[0]); len(fields) != 4 || fields[1] != "tx" || fields[2] != "VIN123" || fields[3] != "cafe" {
+		t.Errorf("Unexpected line %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], " rx VIN123 01") {
+		t.Errorf("Unexpected line %q", lines[1])
+	}
+}
@@ -3,24 +3,42 @@ package inet
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/teslamotors/vehicle-command/internal/log"
+	logger "github.com/teslamotors/vehicle-command/internal/log"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
 	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 )
 
+var log = logger.Module(logger.ModuleInet)
+
 // MaxLatency is the default maximum latency permitted when updating the vehicle clock estimate.
 var MaxLatency = 10 * time.Second
 
+// wakeRetryInterval is the delay between wake_up requests while waiting for a vehicle to come online.
+const wakeRetryInterval = 10 * time.Second
+
+// responseBuffers holds buffers for reading Fleet API responses. Responses are usually short, but
+// may be up to connector.MaxResponseLength bytes long, so reading each one into a buffer from the
+// pool and copying it out is much cheaper than allocating a buffer of that size per request.
+var responseBuffers = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, connector.MaxResponseLength+1)
+		return &buffer
+	},
+}
+
 func ReadWithContext(ctx context.Context, r io.Reader, p []byte) ([]byte, error) {
 	bytesRead := 0
 	for {
@@ -43,6 +61,11 @@ func ReadWithContext(ctx context.Context, r io.Reader, p []byte) ([]byte, error)
 
 var ErrVehicleNotAwake = protocol.NewError("vehicle unavailable: vehicle is offline or asleep", false, false)
 
+// ErrAPICallTimeout indicates that a single request to Tesla's servers took longer than the
+// connection's call timeout; see [Connection.SetCallTimeout]. Errors that wrap it are Temporary,
+// so the request is retried if the caller's deadline allows.
+var ErrAPICallTimeout = errors.New("request to Fleet API timed out")
+
 /*
 The regular expression below extracts domains from HTTP bodies:
 
@@ -57,6 +80,9 @@ var baseDomainRE = regexp.MustCompile(`use base URL: https://([-a-z0-9.]*)`)
 type HTTPError struct {
 	Code    int
 	Message string
+	// RetryAfter is how long the server asked the client to wait before trying again, or zero if
+	// the response didn't include a Retry-After header.
+	RetryAfter time.Duration
 }
 
 func (e *HTTPError) Error() string {
@@ -109,8 +135,9 @@ func SendFleetAPICommand(ctx context.Context, client *http.Client, userAgent, au
 		_ = result.Body.Close()
 	}()
 
-	body = make([]byte, connector.MaxResponseLength+1)
-	body, err = ReadWithContext(ctx, result.Body, body)
+	buffer := responseBuffers.Get().(*[]byte)
+	defer responseBuffers.Put(buffer)
+	body, err = ReadWithContext(ctx, result.Body, *buffer)
 	if err != nil {
 		return nil, &protocol.CommandError{Err: err, PossibleSuccess: true, PossibleTemporary: false}
 	}
@@ -118,6 +145,8 @@ func SendFleetAPICommand(ctx context.Context, client *http.Client, userAgent, au
 	if len(body) == connector.MaxResponseLength+1 {
 		return nil, protocol.NewError("response exceeds maximum length", true, true)
 	}
+	// The buffer goes back to the pool when this function returns.
+	body = bytes.Clone(body)
 
 	log.Debug("Server returned %d: %s: %s", result.StatusCode, http.StatusText(result.StatusCode), body)
 	switch result.StatusCode {
@@ -132,7 +161,25 @@ func SendFleetAPICommand(ctx context.Context, client *http.Client, userAgent, au
 			return nil, ErrVehicleNotAwake
 		}
 	}
-	return nil, &HTTPError{Code: result.StatusCode, Message: string(body)}
+	return nil, &HTTPError{Code: result.StatusCode, Message: string(body), RetryAfter: ParseRetryAfter(result.Header.Get("Retry-After"))}
+}
+
+// ParseRetryAfter returns the delay specified by a Retry-After header, which may be a number of
+// seconds or an HTTP date, or zero if the header is missing or invalid.
+func ParseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date).Round(time.Second), 0)
+	}
+	return 0
 }
 
 func ValidTeslaDomainSuffix(domain string) bool {
@@ -143,7 +190,10 @@ func ValidTeslaDomainSuffix(domain string) bool {
 // response body is not necessarily nil if the error is set.
 func (c *Connection) SendFleetAPICommand(ctx context.Context, endpoint string, command interface{}) ([]byte, error) {
 	url := fmt.Sprintf("https://%s/%s", c.serverURL, endpoint)
-	rsp, err := SendFleetAPICommand(ctx, c.client, c.UserAgent, c.authHeader, url, command)
+	callCtx, cancel := c.withCallTimeout(ctx)
+	defer cancel()
+	rsp, err := SendFleetAPICommand(callCtx, c.client, c.UserAgent, c.credentials.AuthHeader(), url, command)
+	err = c.callError(callCtx, err)
 	if err != nil {
 		var httpErr *HTTPError
 		if errors.As(err, &httpErr) && httpErr.Code == http.StatusMisdirectedRequest {
@@ -157,14 +207,46 @@ func (c *Connection) SendFleetAPICommand(ctx context.Context, endpoint string, c
 	return rsp, err
 }
 
+// Credentials hold the Authorization header that connections present to Tesla's servers.
+// Connections that share Credentials use a refreshed OAuth token as soon as it's set. Vehicle
+// sessions are authenticated by the command key rather than the token, so refreshing the token
+// doesn't require a new handshake or reset the session's anti-replay counter.
+type Credentials struct {
+	lock       sync.RWMutex
+	authHeader string
+}
+
+// NewCredentials returns Credentials that present authHeader, such as "Bearer <token>".
+func NewCredentials(authHeader string) *Credentials {
+	return &Credentials{authHeader: authHeader}
+}
+
+// AuthHeader returns the current Authorization header.
+func (c *Credentials) AuthHeader() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.authHeader
+}
+
+// SetAuthHeader replaces the Authorization header used by subsequent requests. Requests already in
+// progress keep the old header.
+func (c *Credentials) SetAuthHeader(authHeader string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.authHeader = authHeader
+}
+
 // Connection implements the connector.Connector interface by POSTing commands to a server.
 type Connection struct {
-	UserAgent  string
-	vin        string
-	client     *http.Client
-	serverURL  string
-	inbox      chan []byte
-	authHeader string
+	UserAgent   string
+	vin         string
+	client      *http.Client
+	serverURL   string
+	inbox       chan []byte
+	credentials *Credentials
+	tap         *connector.FrameTap
+	clock       clock.Clock
+	callTimeout time.Duration
 
 	lock     sync.Mutex
 	lastPoke time.Time
@@ -172,17 +254,29 @@ type Connection struct {
 
 // NewConnection creates a Connection.
 func NewConnection(vin string, authHeader, serverURL, userAgent string) *Connection {
+	return NewConnectionWithCredentials(vin, NewCredentials(authHeader), serverURL, userAgent)
+}
+
+// NewConnectionWithCredentials creates a Connection that presents credentials, which the caller
+// may update when it refreshes its OAuth token.
+func NewConnectionWithCredentials(vin string, credentials *Credentials, serverURL, userAgent string) *Connection {
 	conn := Connection{
-		UserAgent:  userAgent,
-		vin:        vin,
-		client:     &http.Client{},
-		serverURL:  serverURL,
-		authHeader: authHeader,
-		inbox:      make(chan []byte, connector.BufferSize),
+		UserAgent:   userAgent,
+		vin:         vin,
+		client:      &http.Client{},
+		serverURL:   serverURL,
+		credentials: credentials,
+		clock:       clock.Real,
+		inbox:       make(chan []byte, connector.BufferSize),
 	}
 	return &conn
 }
 
+// Credentials returns the credentials that c presents to Tesla's servers.
+func (c *Connection) Credentials() *Credentials {
+	return c.credentials
+}
+
 func (c *Connection) PreferredAuthMethod() connector.AuthMethod {
 	return connector.AuthMethodHMAC
 }
@@ -212,7 +306,100 @@ func (c *Connection) VIN() string {
 	return c.vin
 }
 
+// ObserveFrames copies RoutableMessages sent and received by c to tap. Set it before using c.
+func (c *Connection) ObserveFrames(tap *connector.FrameTap) {
+	c.tap = tap
+}
+
+// SetClock makes c wait between wake_up requests using clk instead of the system clock. Set it
+// before using c.
+func (c *Connection) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// SetCallTimeout limits each request that c sends to Tesla's servers to timeout, so that one
+// request that hangs doesn't use up the deadline of the context it's sent with. Requests that run
+// out of time fail with an error that wraps ErrAPICallTimeout. Zero, the default, limits requests
+// only by their context. Set it before using c.
+func (c *Connection) SetCallTimeout(timeout time.Duration) {
+	c.callTimeout = timeout
+}
+
+// withCallTimeout returns a context for one request to Tesla's servers, which ends after c's call
+// timeout or when ctx does, whichever comes first.
+func (c *Connection) withCallTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.callTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, c.callTimeout, ErrAPICallTimeout)
+}
+
+// callError replaces err, returned by a request sent with callCtx, with an error that wraps
+// ErrAPICallTimeout if the request failed because it ran out of its own time rather than the
+// caller's.
+func (c *Connection) callError(callCtx context.Context, err error) error {
+	if err == nil || !errors.Is(context.Cause(callCtx), ErrAPICallTimeout) {
+		return err
+	}
+	log.Warning("Request to Fleet API for %s took longer than %s", c.vin, c.callTimeout)
+	return &protocol.CommandError{
+		Err:               fmt.Errorf("%w after %s", ErrAPICallTimeout, c.callTimeout),
+		PossibleSuccess:   protocol.MayHaveSucceeded(err),
+		PossibleTemporary: true,
+	}
+}
+
+// IsAwake returns true if Tesla's servers report that the vehicle is online. It reads the
+// vehicle's state from the vehicle list endpoint, which doesn't wake the vehicle or count against
+// the wake_up rate limit.
+func (c *Connection) IsAwake(ctx context.Context) (bool, error) {
+	callCtx, cancel := c.withCallTimeout(ctx)
+	defer cancel()
+	awake, err := c.isAwake(callCtx)
+	return awake, c.callError(callCtx, err)
+}
+
+func (c *Connection) isAwake(ctx context.Context) (bool, error) {
+	url := fmt.Sprintf("https://%s/api/1/vehicles/%s", c.serverURL, c.vin)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("User-Agent", c.UserAgent)
+	request.Header.Set("Authorization", c.credentials.AuthHeader())
+	request.Header.Set("Accept", "*/*")
+
+	result, err := c.client.Do(request)
+	if err != nil {
+		return false, &protocol.CommandError{Err: err, PossibleSuccess: false, PossibleTemporary: true}
+	}
+	defer result.Body.Close()
+	body, err := ReadWithContext(ctx, result.Body, make([]byte, connector.MaxResponseLength))
+	if err != nil {
+		return false, err
+	}
+	if result.StatusCode != http.StatusOK {
+		return false, &HTTPError{Code: result.StatusCode, Message: string(body)}
+	}
+	var reply struct {
+		Response struct {
+			State string `json:"state"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return false, fmt.Errorf("invalid vehicle response: %w", err)
+	}
+	log.Debug("Vehicle %s is %s", c.vin, reply.Response.State)
+	return reply.Response.State == "online", nil
+}
+
+// Wakeup wakes the vehicle and waits until Tesla's servers report it's online. If the vehicle is
+// already online, no wake_up request is sent.
 func (c *Connection) Wakeup(ctx context.Context) error {
+	if awake, err := c.IsAwake(ctx); err == nil && awake {
+		return nil
+	}
+
 	type wakeResponse struct {
 		State string `json:"state"`
 	}
@@ -222,7 +409,7 @@ func (c *Connection) Wakeup(ctx context.Context) error {
 
 	for {
 		c.lock.Lock()
-		c.lastPoke = time.Now()
+		c.lastPoke = c.clock.Now()
 		c.lock.Unlock()
 		endpoint := fmt.Sprintf("api/1/vehicles/%s/wake_up", c.vin)
 		respJSON, err := c.SendFleetAPICommand(ctx, endpoint, nil)
@@ -240,19 +427,30 @@ func (c *Connection) Wakeup(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(10 * time.Second):
+		case <-c.clock.After(wakeRetryInterval):
 			continue
 		}
 	}
 }
 
+// encodeSignedCommand returns the body of a signed_command request that carries message. It's
+// what json.Marshal produces for the request, without the reflection. The body isn't taken from a
+// pool, since the HTTP client may still be reading it after the response arrives.
+func encodeSignedCommand(message []byte) []byte {
+	const prefix, suffix = `{"routable_message":"`, `"}`
+	body := make([]byte, 0, len(prefix)+base64.StdEncoding.EncodedLen(len(message))+len(suffix))
+	body = append(body, prefix...)
+	body = base64.StdEncoding.AppendEncode(body, message)
+	return append(body, suffix...)
+}
+
 func (c *Connection) Send(ctx context.Context, buffer []byte) error {
-	type cmd struct {
-		Payload []byte `json:"routable_message"`
+	if log.Enabled(logger.LevelDebug) {
+		log.Debug("Sending RoutableMessage: %s", protocol.RoutableMessageJSON(buffer))
 	}
-
+	c.tap.Observe(c.vin, connector.FrameOutgoing, buffer)
 	endpoint := fmt.Sprintf("api/1/vehicles/%s/signed_command", c.vin)
-	body, err := c.SendFleetAPICommand(ctx, endpoint, cmd{Payload: buffer})
+	body, err := c.SendFleetAPICommand(ctx, endpoint, encodeSignedCommand(buffer))
 	if err != nil {
 		return err
 	}
@@ -266,6 +464,10 @@ func (c *Connection) Send(ctx context.Context, buffer []byte) error {
 		log.Debug("Invalid server response (%d bytes): %s", len(body), body)
 		return &protocol.CommandError{Err: fmt.Errorf("unable to parse server response: %w", err), PossibleSuccess: true, PossibleTemporary: false}
 	}
+	if log.Enabled(logger.LevelDebug) {
+		log.Debug("Received RoutableMessage: %s", protocol.RoutableMessageJSON(rsp.Payload))
+	}
+	c.tap.Observe(c.vin, connector.FrameIncoming, rsp.Payload)
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	if c.inbox == nil {
@@ -1,13 +1,25 @@
 package inet
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
 )
 
 func TestSendAfterClose(t *testing.T) {
@@ -26,3 +38,378 @@ func TestSendAfterClose(t *testing.T) {
 		t.Errorf("Expected ErrNotConnected but got %s", err)
 	}
 }
+
+func TestIsAwake(t *testing.T) {
+	state := "asleep"
+	wakes := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/1/vehicles/VIN123":
+			if req.Method != http.MethodGet {
+				t.Errorf("Unexpected %s request for vehicle state", req.Method)
+			}
+			w.Write([]byte(`{"response": {"state": "` + state + `"}}`))
+		case "/api/1/vehicles/VIN123/wake_up":
+			wakes++
+			state = "online"
+			w.Write([]byte(`{"response": {"state": "online"}}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+	domain, _ := strings.CutPrefix(server.URL, "https://")
+	conn := NewConnection("VIN123", "", domain, "")
+	conn.client = server.Client()
+	ctx := context.Background()
+
+	if awake, err := conn.IsAwake(ctx); err != nil || awake {
+		t.Fatalf("Expected vehicle to be asleep (err = %v)", err)
+	}
+	if err := conn.Wakeup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if awake, err := conn.IsAwake(ctx); err != nil || !awake {
+		t.Fatalf("Expected vehicle to be awake (err = %v)", err)
+	}
+	if err := conn.Wakeup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if wakes != 1 {
+		t.Errorf("Expected 1 wake_up request, got %d", wakes)
+	}
+}
+
+func TestWakeupRetry(t *testing.T) {
+	const failures = 3
+	var lock sync.Mutex
+	wakes := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/1/vehicles/VIN123":
+			w.Write([]byte(`{"response": {"state": "asleep"}}`))
+		case "/api/1/vehicles/VIN123/wake_up":
+			lock.Lock()
+			wakes++
+			ready := wakes > failures
+			lock.Unlock()
+			if !ready {
+				http.Error(w, `{"error": "timeout"}`, http.StatusGatewayTimeout)
+				return
+			}
+			w.Write([]byte(`{"response": {"state": "online"}}`))
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer server.Close()
+	domain, _ := strings.CutPrefix(server.URL, "https://")
+	conn := NewConnection("VIN123", "", domain, "")
+	conn.client = server.Client()
+	fakeClock := clock.NewFake(time.Unix(1700000000, 0))
+	conn.SetClock(fakeClock)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.Wakeup(context.Background())
+	}()
+	for i := 0; i < failures; i++ {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(wakeRetryInterval)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if wakes != failures+1 {
+		t.Errorf("Expected %d wake_up requests, got %d", failures+1, wakes)
+	}
+}
+
+func TestObserveFrames(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(`{"response": "AQI="}`)) // 0x01 0x02
+	}))
+	defer server.Close()
+	domain, _ := strings.CutPrefix(server.URL, "https://")
+	conn := NewConnection("VIN123", "", domain, "")
+	conn.client = server.Client()
+
+	var frames []connector.Frame
+	tap := connector.NewFrameTap(func(frame connector.Frame) {
+		frames = append(frames, frame)
+	})
+	conn.ObserveFrames(tap)
+	if err := conn.Send(context.Background(), []byte{0x0a}); err != nil {
+		t.Fatalf("Send failed: %s", err)
+	}
+	tap.Close()
+
+	if len(frames) != 2 {
+		t.Fatalf("Expected 2 frames, got %d", len(frames))
+	}
+	if frames[0].Direction != connector.FrameOutgoing || !bytes.Equal(frames[0].Data, []byte{0x0a}) {
+		t.Errorf("Unexpected outgoing frame %+v", frames[0])
+	}
+	if frames[1].Direction != connector.FrameIncoming || !bytes.Equal(frames[1].Data, []byte{0x01, 0x02}) || frames[1].VIN != "VIN123" {
+		t.Errorf("Unexpected incoming frame %+v", frames[1])
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"response":null,"error":"rate limited","error_description":""}`))
+	}))
+	defer server.Close()
+	domain, _ := strings.CutPrefix(server.URL, "https://")
+	conn := NewConnection("VIN123", "", domain, "")
+	conn.client = server.Client()
+
+	err := conn.Send(context.Background(), []byte{})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusTooManyRequests || httpErr.RetryAfter != 7*time.Second {
+		t.Errorf("Expected 429 with a 7s delay, got %#v", err)
+	}
+
+	for value, want := range map[string]time.Duration{
+		"":                              0,
+		"0":                             0,
+		"-5":                            0,
+		"120":                           2 * time.Minute,
+		"soon":                          0,
+		"Wed, 21 Oct 2015 07:28:00 GMT": 0, // In the past
+	} {
+		if got := ParseRetryAfter(value); got != want {
+			t.Errorf("ParseRetryAfter(%q) = %s, expected %s", value, got, want)
+		}
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	const callTimeout = 50 * time.Millisecond
+	var lock sync.Mutex
+	hang := true
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		slow := hang
+		lock.Unlock()
+		if slow {
+			<-release
+			return
+		}
+		if req.URL.Path == "/api/1/vehicles/VIN123" {
+			w.Write([]byte(`{"response": {"state": "online"}}`))
+			return
+		}
+		w.Write([]byte(`{"response": "AQI="}`))
+	}))
+	defer server.Close()
+	// The server can't tell that the client gave up on requests that hung.
+	defer close(release)
+	domain, _ := strings.CutPrefix(server.URL, "https://")
+	conn := NewConnection("VIN123", "", domain, "")
+	conn.client = server.Client()
+	conn.SetCallTimeout(callTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	err := conn.Send(ctx, []byte{0x0a})
+	if !errors.Is(err, ErrAPICallTimeout) {
+		t.Fatalf("Expected ErrAPICallTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Request that hung took %s to fail", elapsed)
+	}
+	if !protocol.ShouldRetry(err) {
+		t.Errorf("Expected request that timed out to be retried")
+	}
+	if _, err := conn.IsAwake(ctx); !errors.Is(err, ErrAPICallTimeout) {
+		t.Errorf("Expected IsAwake to fail with ErrAPICallTimeout, got %v", err)
+	}
+
+	// Running out of the caller's time isn't reported as a call timeout.
+	shortCtx, cancelShort := context.WithTimeout(ctx, callTimeout/5)
+	defer cancelShort()
+	if err := conn.Send(shortCtx, []byte{0x0a}); err == nil || errors.Is(err, ErrAPICallTimeout) {
+		t.Errorf("Expected caller's deadline to end request, got %v", err)
+	}
+
+	lock.Lock()
+	hang = false
+	lock.Unlock()
+	if err := conn.Send(ctx, []byte{0x0a}); err != nil {
+		t.Errorf("Send failed: %s", err)
+	}
+	if awake, err := conn.IsAwake(ctx); err != nil || !awake {
+		t.Errorf("Expected vehicle to be awake (err = %v)", err)
+	}
+}
+
+// newRelayedVehicle returns a Vehicle, with a session already started, that sends commands through
+// a Fleet API server that relays them to the returned vehicletest.Vehicle. If observe isn't nil,
+// the server calls it with each request.
+func newRelayedVehicle(tb testing.TB, observe func(*http.Request)) (*vehicle.Vehicle, *vehicletest.Vehicle, *Credentials) {
+	tb.Helper()
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	car := vehicletest.New("VIN123")
+	car.Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+	link := car.Connect()
+	tb.Cleanup(link.Close)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if observe != nil {
+			observe(req)
+		}
+		var request struct {
+			Payload []byte `json:"routable_message"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := link.Send(req.Context(), request.Payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		// Replies aren't necessarily relayed in response to the request that triggered them, but
+		// the dispatcher matches them to requests regardless.
+		select {
+		case reply := <-link.Receive():
+			json.NewEncoder(w).Encode(struct {
+				Payload []byte `json:"response"`
+			}{reply})
+		case <-time.After(time.Second):
+			http.Error(w, "vehicle didn't reply", http.StatusGatewayTimeout)
+		}
+	}))
+	tb.Cleanup(server.Close)
+	domain, _ := strings.CutPrefix(server.URL, "https://")
+	credentials := NewCredentials("Bearer old-token")
+	conn := NewConnectionWithCredentials("VIN123", credentials, domain, "")
+	conn.client = server.Client()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	v, err := vehicle.NewVehicle(conn, skey, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := v.Connect(ctx); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(v.Disconnect)
+	if err := v.StartSession(ctx, nil); err != nil {
+		tb.Fatal(err)
+	}
+	return v, car, credentials
+}
+
+func TestTokenRefreshKeepsSession(t *testing.T) {
+	// The server records the Authorization header of each request.
+	var lock sync.Mutex
+	var authHeaders []string
+	v, car, credentials := newRelayedVehicle(t, func(req *http.Request) {
+		lock.Lock()
+		authHeaders = append(authHeaders, req.Header.Get("Authorization"))
+		lock.Unlock()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := v.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	handshakes := car.Handshakes()
+
+	credentials.SetAuthHeader("Bearer new-token")
+	if err := v.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if car.Handshakes() != handshakes {
+		t.Errorf("Token refresh caused %d new handshakes", car.Handshakes()-handshakes)
+	}
+	// The vehicle rejects commands with a stale counter, so this would fail if the refresh had
+	// reset the session's anti-replay counter.
+	if car.Desyncs() != 0 {
+		t.Errorf("Vehicle rejected %d commands after the token refresh", car.Desyncs())
+	}
+	if !car.Locked() {
+		t.Error("Vehicle didn't execute commands sent after the token refresh")
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if last := authHeaders[len(authHeaders)-1]; last != "Bearer new-token" {
+		t.Errorf("Expected requests to use the refreshed token, got %q", last)
+	}
+	if authHeaders[0] != "Bearer old-token" {
+		t.Errorf("Expected requests before the refresh to use the old token, got %q", authHeaders[0])
+	}
+}
+
+func TestEncodeSignedCommand(t *testing.T) {
+	for _, message := range [][]byte{{}, {0}, []byte("routable message"), bytes.Repeat([]byte{0xff}, 1000)} {
+		expected, err := json.Marshal(struct {
+			Payload []byte `json:"routable_message"`
+		}{message})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body := encodeSignedCommand(message); !bytes.Equal(body, expected) {
+			t.Errorf("Expected %s, got %s", expected, body)
+		}
+	}
+}
+
+// TestConcurrentSignedCommands checks that commands sent concurrently over one connection don't
+// share encoding or response buffers. Run with -race.
+func TestConcurrentSignedCommands(t *testing.T) {
+	v, car, _ := newRelayedVehicle(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const senders, commands = 8, 10
+	errs := make(chan error, senders)
+	for i := 0; i < senders; i++ {
+		go func() {
+			var err error
+			for j := 0; j < commands && err == nil; j++ {
+				if j%2 == 0 {
+					err = v.Lock(ctx)
+				} else {
+					err = v.Unlock(ctx)
+				}
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < senders; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if car.Desyncs() != 0 {
+		t.Errorf("Vehicle rejected %d commands", car.Desyncs())
+	}
+}
+
+func BenchmarkSignAndSend(b *testing.B) {
+	v, _, _ := newRelayedVehicle(b, nil)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := v.Lock(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
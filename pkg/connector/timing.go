@@ -0,0 +1,69 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Timing breaks down the time spent sending commands to a vehicle. It's populated by connectors,
+// the session layer, and vehicle.Vehicle for operations that use a context returned by
+// WithTiming. Phases that run concurrently, such as handshakes with different domains, are
+// counted once.
+//
+// Fields must not be read until the operations that use the context have returned.
+type Timing struct {
+	// Connect is time spent opening the connection, including scanning for the vehicle over BLE.
+	Connect time.Duration
+	// Handshake is time spent exchanging session info with the vehicle.
+	Handshake time.Duration
+	// Signing is time spent authorizing commands.
+	Signing time.Duration
+	// RoundTrip is time spent transmitting commands and waiting for the vehicle's responses.
+	RoundTrip time.Duration
+	// RetryWait is time spent waiting before retransmitting a command.
+	RetryWait time.Duration
+	// Retries is the number of times a command was retransmitted.
+	Retries int
+}
+
+func (t *Timing) String() string {
+	return fmt.Sprintf("connect %s, handshake %s, signing %s, round trip %s, retry wait %s (%d retries)",
+		t.Connect, t.Handshake, t.Signing, t.RoundTrip, t.RetryWait, t.Retries)
+}
+
+type timingKey struct{}
+
+type timingRecorder struct {
+	lock   sync.Mutex
+	timing *Timing
+}
+
+// WithTiming returns a copy of ctx that accumulates a breakdown of time spent on the operations
+// that use it into the returned Timing.
+func WithTiming(ctx context.Context) (context.Context, *Timing) {
+	recorder := &timingRecorder{timing: &Timing{}}
+	return context.WithValue(ctx, timingKey{}, recorder), recorder.timing
+}
+
+// TimingFromContext returns the Timing associated with ctx by WithTiming, or nil if there isn't
+// one.
+func TimingFromContext(ctx context.Context) *Timing {
+	if recorder, ok := ctx.Value(timingKey{}).(*timingRecorder); ok {
+		return recorder.timing
+	}
+	return nil
+}
+
+// RecordTiming calls update with the Timing associated with ctx, if any. Connector implementations
+// use it to report time spent connecting. It's safe to call from multiple goroutines.
+func RecordTiming(ctx context.Context, update func(t *Timing)) {
+	recorder, ok := ctx.Value(timingKey{}).(*timingRecorder)
+	if !ok {
+		return
+	}
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	update(recorder.timing)
+}
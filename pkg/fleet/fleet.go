@@ -0,0 +1,258 @@
+// Package fleet sends commands to many vehicles at once.
+//
+// [Run] connects to each vehicle in a list, starts an authenticated session, and calls a function
+// that sends the vehicle commands. Vehicles are handled concurrently, up to a limit, and failed
+// attempts are retried when that's safe. The result for each vehicle is collected in a [Report].
+//
+//	acct, _ := account.New(token, "")
+//	report := fleet.Run(ctx, vins, fleet.SetChargeLimit(80), &fleet.Options{
+//		Dial:        fleet.AccountDialer(acct, privateKey, sessions),
+//		Sessions:    sessions,
+//		Concurrency: 8,
+//		MaxAttempts: 3,
+//	})
+//	if err := report.Err(); err != nil {
+//		// Some vehicles failed; see report.Failed().
+//	}
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// Defaults used for zero-valued Options fields.
+const (
+	DefaultConcurrency   = 4
+	DefaultMaxAttempts   = 1
+	DefaultRetryInterval = 5 * time.Second
+)
+
+// ErrNoDialer indicates that Run was called without Options.Dial.
+var ErrNoDialer = errors.New("fleet: no dialer configured")
+
+// Func sends commands to car, which is connected and has an authenticated session. It may be
+// called again for the same vehicle if an attempt fails with an error that's safe to retry.
+type Func func(ctx context.Context, car *vehicle.Vehicle) error
+
+// Dialer returns a vehicle that hasn't been connected yet.
+type Dialer func(ctx context.Context, vin string) (*vehicle.Vehicle, error)
+
+// AccountDialer returns a Dialer that reaches vehicles through acct's Fleet API server. The vehicles
+// authorize commands with privateKey and load sessions from sessions, which may be nil.
+func AccountDialer(acct *account.Account, privateKey authentication.ECDHPrivateKey, sessions *cache.SessionCache) Dialer {
+	return func(ctx context.Context, vin string) (*vehicle.Vehicle, error) {
+		return acct.GetVehicle(ctx, vin, privateKey, sessions)
+	}
+}
+
+// Options configures Run.
+type Options struct {
+	// Dial creates vehicles. It's required.
+	Dial Dialer
+
+	// Sessions, if non-nil, is updated with each vehicle's sessions after its last attempt. It
+	// should be the cache that Dial loads sessions from.
+	Sessions *cache.SessionCache
+
+	// Domains lists the domains to start sessions with. Nil starts sessions with all domains.
+	Domains []universal.Domain
+
+	// Concurrency limits the number of vehicles handled at once. Defaults to DefaultConcurrency.
+	Concurrency int
+
+	// MaxAttempts limits the attempts per vehicle. Defaults to DefaultMaxAttempts, which disables
+	// retries. Failures to connect or start a session are always retried; failures of Func are
+	// retried only if protocol.ShouldRetry reports that the command didn't reach the vehicle.
+	MaxAttempts int
+
+	// RetryInterval is the delay between attempts. Defaults to DefaultRetryInterval.
+	RetryInterval time.Duration
+
+	// Timeout limits the time spent on each vehicle, including retries. Zero means no limit other
+	// than the deadline of the context passed to Run.
+	Timeout time.Duration
+
+	// Progress, if non-nil, is called as each vehicle finishes. done counts the vehicles that
+	// have finished so far, out of total. Calls are never concurrent.
+	Progress func(done, total int, result Result)
+}
+
+// Result is the outcome for one vehicle.
+type Result struct {
+	VIN      string
+	Err      error // Nil if the vehicle succeeded
+	Attempts int
+	Duration time.Duration
+}
+
+// Report collects the results of Run.
+type Report struct {
+	// Results holds one entry per VIN, in the order the VINs were passed to Run.
+	Results []Result
+}
+
+// Succeeded returns the VINs of vehicles that succeeded.
+func (r *Report) Succeeded() []string {
+	var vins []string
+	for _, result := range r.Results {
+		if result.Err == nil {
+			vins = append(vins, result.VIN)
+		}
+	}
+	return vins
+}
+
+// Failed returns the results of vehicles that failed.
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err returns nil if every vehicle succeeded, or else an error that wraps each vehicle's error.
+func (r *Report) Err() error {
+	var errs []error
+	for _, result := range r.Failed() {
+		errs = append(errs, fmt.Errorf("%s: %w", result.VIN, result.Err))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d vehicles failed: %w", len(errs), len(r.Results), errors.Join(errs...))
+}
+
+// Run calls fn with each vehicle in vins and returns the results. Duplicate VINs are handled once
+// and reported once. Vehicles that haven't started when ctx is canceled fail with ctx's error.
+func Run(ctx context.Context, vins []string, fn Func, opts *Options) *Report {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultMaxAttempts
+	}
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = DefaultRetryInterval
+	}
+
+	report := &Report{}
+	seen := make(map[string]bool)
+	for _, vin := range vins {
+		if !seen[vin] {
+			seen[vin] = true
+			report.Results = append(report.Results, Result{VIN: vin})
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		progress sync.Mutex
+		done     int
+	)
+	slots := make(chan struct{}, o.Concurrency)
+	for i := range report.Results {
+		result := &report.Results[i]
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			result.Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			o.runVehicle(ctx, fn, result)
+			if o.Progress != nil {
+				progress.Lock()
+				defer progress.Unlock()
+				done++
+				o.Progress(done, len(report.Results), *result)
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+// runVehicle makes up to o.MaxAttempts attempts to run fn on result.VIN.
+func (o *Options) runVehicle(ctx context.Context, fn Func, result *Result) {
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+	for {
+		result.Attempts++
+		var retry bool
+		retry, result.Err = o.attempt(ctx, fn, result.VIN)
+		if result.Err == nil || !retry || result.Attempts >= o.MaxAttempts {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(o.RetryInterval):
+		}
+	}
+}
+
+// attempt connects to vin and calls fn. If it fails, retry indicates whether trying again is safe.
+func (o *Options) attempt(ctx context.Context, fn Func, vin string) (retry bool, err error) {
+	if o.Dial == nil {
+		return false, ErrNoDialer
+	}
+	car, err := o.Dial(ctx, vin)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	if err := car.Connect(ctx); err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer car.Disconnect()
+	if o.Sessions != nil {
+		defer car.UpdateCachedSessions(o.Sessions)
+	}
+	if err := car.StartSession(ctx, o.Domains); err != nil {
+		return ctx.Err() == nil, err
+	}
+	err = fn(ctx, car)
+	return protocol.ShouldRetry(err), err
+}
+
+// SetChargeLimit returns a Func that sets each vehicle's charge limit to percent.
+func SetChargeLimit(percent int32) Func {
+	return func(ctx context.Context, car *vehicle.Vehicle) error {
+		return car.ChangeChargeLimit(ctx, percent)
+	}
+}
+
+// Precondition returns a Func that turns each vehicle's climate control on or off.
+func Precondition(on bool) Func {
+	return func(ctx context.Context, car *vehicle.Vehicle) error {
+		if on {
+			return car.ClimateOn(ctx)
+		}
+		return car.ClimateOff(ctx)
+	}
+}
@@ -0,0 +1,160 @@
+package fleet
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+var testVINs = []string{"5YJ3E1EA7KF000001", "5YJ3E1EA7KF000002", "5YJ3E1EA7KF000003", "5YJ3E1EA7KF000004"}
+
+// testFleet returns simulated vehicles for testVINs, all paired with skey except for the last one,
+// and a Dialer that reaches them.
+func testFleet(t *testing.T, sessions *cache.SessionCache) (map[string]*vehicletest.Vehicle, Dialer) {
+	t.Helper()
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cars := make(map[string]*vehicletest.Vehicle)
+	for i, vin := range testVINs {
+		cars[vin] = vehicletest.New(vin)
+		if i < len(testVINs)-1 {
+			cars[vin].Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+		}
+	}
+	dial := func(_ context.Context, vin string) (*vehicle.Vehicle, error) {
+		car, ok := cars[vin]
+		if !ok {
+			return nil, errors.New("unknown vehicle")
+		}
+		return vehicle.NewVehicle(car.Connect(), skey, sessions)
+	}
+	return cars, dial
+}
+
+func TestRun(t *testing.T) {
+	sessions := cache.New(0)
+	cars, dial := testFleet(t, sessions)
+
+	var (
+		lock       sync.Mutex
+		progress   []int
+		active     atomic.Int32
+		maxActive  atomic.Int32
+		setLimitTo = SetChargeLimit(65)
+	)
+	fn := func(ctx context.Context, car *vehicle.Vehicle) error {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			m := maxActive.Load()
+			if n <= m || maxActive.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return setLimitTo(ctx, car)
+	}
+	vins := append(append([]string(nil), testVINs...), testVINs[0])
+	report := Run(context.Background(), vins, fn, &Options{
+		Dial:        dial,
+		Sessions:    sessions,
+		Concurrency: 2,
+		Progress: func(done, total int, result Result) {
+			lock.Lock()
+			defer lock.Unlock()
+			progress = append(progress, done)
+			if total != len(testVINs) {
+				t.Errorf("Expected total of %d, got %d", len(testVINs), total)
+			}
+		},
+	})
+
+	if len(report.Results) != len(testVINs) {
+		t.Fatalf("Expected %d results, got %d", len(testVINs), len(report.Results))
+	}
+	for i, result := range report.Results {
+		if result.VIN != testVINs[i] {
+			t.Errorf("Result %d is for %s, expected %s", i, result.VIN, testVINs[i])
+		}
+	}
+	if succeeded := report.Succeeded(); len(succeeded) != 3 {
+		t.Errorf("Unexpected successes %v", succeeded)
+	}
+	failed := report.Failed()
+	if len(failed) != 1 || failed[0].VIN != testVINs[3] || report.Err() == nil {
+		t.Errorf("Expected unpaired vehicle to fail: %+v", failed)
+	}
+	for _, vin := range testVINs[:3] {
+		if cars[vin].ChargeLimit() != 65 {
+			t.Errorf("%s: charge limit wasn't set", vin)
+		}
+		if _, ok := sessions.GetEntry(vin); !ok {
+			t.Errorf("%s: sessions weren't cached", vin)
+		}
+	}
+	if maxActive.Load() > 2 {
+		t.Errorf("Concurrency limit exceeded: %d vehicles at once", maxActive.Load())
+	}
+	if len(progress) != len(testVINs) || progress[len(progress)-1] != len(testVINs) {
+		t.Errorf("Unexpected progress callbacks %v", progress)
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	_, dial := testFleet(t, nil)
+	var dials atomic.Int32
+	flakyDial := func(ctx context.Context, vin string) (*vehicle.Vehicle, error) {
+		if dials.Add(1) == 1 {
+			return nil, errors.New("connection refused")
+		}
+		return dial(ctx, vin)
+	}
+	opts := &Options{Dial: flakyDial, MaxAttempts: 3, RetryInterval: time.Millisecond}
+	report := Run(context.Background(), testVINs[:1], Precondition(true), opts)
+	if result := report.Results[0]; result.Err != nil || result.Attempts != 2 {
+		t.Errorf("Expected success on second attempt: %+v", result)
+	}
+
+	// Vehicles that reject a command aren't retried.
+	rejected := errors.New("rejected")
+	calls := 0
+	report = Run(context.Background(), testVINs[:1], func(context.Context, *vehicle.Vehicle) error {
+		calls++
+		return rejected
+	}, opts)
+	if result := report.Results[0]; !errors.Is(result.Err, rejected) || result.Attempts != 1 || calls != 1 {
+		t.Errorf("Unexpected retry of rejected command: %+v", result)
+	}
+	if !errors.Is(report.Err(), rejected) {
+		t.Errorf("Report error doesn't wrap vehicle error: %s", report.Err())
+	}
+
+	report = Run(context.Background(), testVINs[:1], Precondition(true), nil)
+	if !errors.Is(report.Err(), ErrNoDialer) {
+		t.Errorf("Expected ErrNoDialer, got %v", report.Err())
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	_, dial := testFleet(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report := Run(ctx, testVINs, Precondition(true), &Options{Dial: dial, Concurrency: 1})
+	for _, result := range report.Results {
+		if result.Err == nil {
+			t.Errorf("%s: expected failure after cancellation", result.VIN)
+		}
+	}
+}
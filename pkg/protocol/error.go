@@ -101,6 +101,69 @@ func (e *KeychainError) Error() string {
 	return fmt.Sprintf("keychain operation failed: %s", e.Code)
 }
 
+// DomainError is the error a session handshake with Domain failed with.
+type DomainError struct {
+	Domain universal.Domain
+	Err    error
+}
+
+func (e *DomainError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Domain, e.Err)
+}
+
+func (e *DomainError) Unwrap() error {
+	return e.Err
+}
+
+// HandshakeError indicates that session handshakes with more than one domain failed. Use
+// errors.Is to check for an error in any of the domains, or errors.As to find out which domains
+// failed.
+type HandshakeError struct {
+	// Failures lists the error of each domain that failed, starting with the first.
+	Failures []DomainError
+}
+
+func (e *HandshakeError) Error() string {
+	msg := "session handshakes failed"
+	for i, failure := range e.Failures {
+		if i == 0 {
+			msg += ": "
+		} else {
+			msg += "; "
+		}
+		msg += failure.Error()
+	}
+	return msg
+}
+
+func (e *HandshakeError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i := range e.Failures {
+		errs[i] = &e.Failures[i]
+	}
+	return errs
+}
+
+func (e *HandshakeError) MayHaveSucceeded() bool {
+	for _, failure := range e.Failures {
+		if MayHaveSucceeded(failure.Err) {
+			return true
+		}
+	}
+	return false
+}
+
+// Temporary returns true if every domain failed with a Temporary error, in which case repeating
+// the handshakes might succeed.
+func (e *HandshakeError) Temporary() bool {
+	for _, failure := range e.Failures {
+		if !Temporary(failure.Err) {
+			return false
+		}
+	}
+	return len(e.Failures) > 0
+}
+
 // MayHaveSucceeded returns true if err is a CommandError that indicates the command may have been
 // executed but the client did not receive a confirmation from the vehicle.
 func MayHaveSucceeded(err error) bool {
@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"errors"
 	"testing"
 
 	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
@@ -78,3 +79,25 @@ func TestRetriableError(t *testing.T) {
 		}
 	}
 }
+
+func TestHandshakeError(t *testing.T) {
+	err := &HandshakeError{Failures: []DomainError{
+		{Domain: universal.Domain_DOMAIN_VEHICLE_SECURITY, Err: ErrBusy},
+		{Domain: universal.Domain_DOMAIN_INFOTAINMENT, Err: &RoutableMessageError{Code: universal.MessageFault_E_MESSAGEFAULT_ERROR_TIMEOUT}},
+	}}
+	if !ShouldRetry(err) {
+		t.Errorf("Expected handshakes to be retried if every domain failed temporarily")
+	}
+	if !errors.Is(err, ErrBusy) {
+		t.Errorf("Domain errors aren't unwrapped")
+	}
+	var domainErr *DomainError
+	if !errors.As(err, &domainErr) || domainErr.Domain != universal.Domain_DOMAIN_VEHICLE_SECURITY {
+		t.Errorf("Expected the first failure to be VCSEC's, got %v", domainErr)
+	}
+
+	err.Failures[1].Err = ErrKeyNotPaired
+	if ShouldRetry(err) {
+		t.Errorf("Expected handshakes not to be retried if a domain failed permanently")
+	}
+}
@@ -0,0 +1,213 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	carserver "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+)
+
+// UnknownFieldsKey is the JSON object key used by MarshalJSON to carry protobuf fields that aren't
+// present in this package's message definitions, such as fields added by newer vehicle firmware.
+// The value is the base64-encoded wire format of those fields.
+const UnknownFieldsKey = "@unknown"
+
+// MarshalJSON converts m to canonical protojson, using proto field names and emitting enum names.
+// Unlike protojson, unknown fields are not dropped: they are preserved under UnknownFieldsKey in
+// the object for the message that contained them, so that UnmarshalJSON can restore them.
+//
+// If indent is non-empty, the output is pretty-printed with one level of indent per nesting depth.
+func MarshalJSON(m proto.Message, indent string) ([]byte, error) {
+	options := protojson.MarshalOptions{UseProtoNames: true}
+	encoded, err := options.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		obj = make(map[string]interface{})
+	}
+	attachUnknownFields(m.ProtoReflect(), obj)
+	if indent == "" {
+		return json.Marshal(obj)
+	}
+	return json.MarshalIndent(obj, "", indent)
+}
+
+// UnmarshalJSON parses data, which should have been produced by MarshalJSON or protojson, into m.
+// Unknown fields recorded under UnknownFieldsKey are restored to the message wire format.
+func UnmarshalJSON(data []byte, m proto.Message) error {
+	var obj map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return err
+	}
+	stripped, err := stripUnknownFields(obj)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(stripped)
+	if err != nil {
+		return err
+	}
+	if err := protojson.Unmarshal(encoded, m); err != nil {
+		return err
+	}
+	restoreUnknownFields(m.ProtoReflect(), obj)
+	return nil
+}
+
+// RoutableMessageJSON decodes a serialized RoutableMessage and renders it with MarshalJSON. It's
+// intended for debug output, so decoding errors are rendered in place of the message.
+func RoutableMessageJSON(encoded []byte) string {
+	var message universal.RoutableMessage
+	if err := proto.Unmarshal(encoded, &message); err != nil {
+		return fmt.Sprintf("<invalid RoutableMessage: %s>", err)
+	}
+	rendered, err := MarshalJSON(&message, "")
+	if err != nil {
+		return fmt.Sprintf("<unprintable RoutableMessage: %s>", err)
+	}
+	return string(rendered)
+}
+
+// NewPayloadMessage returns an empty message of the type carried in the plaintext payload of a
+// RoutableMessage exchanged with domain. Set fromVehicle for responses. It returns nil for domains
+// that don't have a known payload type.
+func NewPayloadMessage(domain universal.Domain, fromVehicle bool) proto.Message {
+	switch domain {
+	case universal.Domain_DOMAIN_VEHICLE_SECURITY:
+		if fromVehicle {
+			return &vcsec.FromVCSECMessage{}
+		}
+		return &vcsec.UnsignedMessage{}
+	case universal.Domain_DOMAIN_INFOTAINMENT:
+		if fromVehicle {
+			return &carserver.Response{}
+		}
+		return &carserver.Action{}
+	}
+	return nil
+}
+
+// isWellKnownType returns true for messages that protojson renders as something other than an
+// object with one key per field (e.g., google.protobuf.Timestamp becomes a string).
+func isWellKnownType(md protoreflect.MessageDescriptor) bool {
+	return md.ParentFile().Package() == "google.protobuf"
+}
+
+// forEachNestedMessage invokes fn on each populated message-valued field of m along with the JSON
+// value that protojson produced for it.
+func forEachNestedMessage(m protoreflect.Message, obj map[string]interface{}, fn func(protoreflect.Message, map[string]interface{})) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Message() == nil || isWellKnownType(fd.Message()) {
+			return true
+		}
+		jsonValue, ok := obj[string(fd.Name())]
+		if !ok {
+			if jsonValue, ok = obj[fd.JSONName()]; !ok {
+				return true
+			}
+		}
+		switch {
+		case fd.IsList():
+			items, _ := jsonValue.([]interface{})
+			list := v.List()
+			for i := 0; i < list.Len() && i < len(items); i++ {
+				if child, ok := items[i].(map[string]interface{}); ok {
+					fn(list.Get(i).Message(), child)
+				}
+			}
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil || isWellKnownType(fd.MapValue().Message()) {
+				return true
+			}
+			entries, _ := jsonValue.(map[string]interface{})
+			v.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+				if child, ok := entries[key.String()].(map[string]interface{}); ok {
+					fn(value.Message(), child)
+				}
+				return true
+			})
+		default:
+			if child, ok := jsonValue.(map[string]interface{}); ok {
+				fn(v.Message(), child)
+			}
+		}
+		return true
+	})
+}
+
+func attachUnknownFields(m protoreflect.Message, obj map[string]interface{}) {
+	if raw := m.GetUnknown(); len(raw) > 0 {
+		obj[UnknownFieldsKey] = base64.StdEncoding.EncodeToString(raw)
+	}
+	forEachNestedMessage(m, obj, attachUnknownFields)
+}
+
+// stripUnknownFields returns a copy of value with UnknownFieldsKey entries removed, after checking
+// that they are valid base64.
+func stripUnknownFields(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if key == UnknownFieldsKey {
+				if _, err := decodeUnknownFields(item); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			stripped, err := stripUnknownFields(item)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = stripped
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			stripped, err := stripUnknownFields(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = stripped
+		}
+		return out, nil
+	}
+	return value, nil
+}
+
+func decodeUnknownFields(value interface{}) ([]byte, error) {
+	encoded, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a base64 string", UnknownFieldsKey)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value: %w", UnknownFieldsKey, err)
+	}
+	return raw, nil
+}
+
+func restoreUnknownFields(m protoreflect.Message, obj map[string]interface{}) {
+	if raw, err := decodeUnknownFields(obj[UnknownFieldsKey]); err == nil {
+		m.SetUnknown(append(m.GetUnknown(), raw...))
+	}
+	forEachNestedMessage(m, obj, restoreUnknownFields)
+}
@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	carserver "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+func unknownField(number protowire.Number, value uint64) []byte {
+	raw := protowire.AppendTag(nil, number, protowire.VarintType)
+	return protowire.AppendVarint(raw, value)
+}
+
+func TestJSONRoundTripPreservesUnknownFields(t *testing.T) {
+	message := &universal.RoutableMessage{
+		ToDestination: &universal.Destination{
+			SubDestination: &universal.Destination_Domain{Domain: universal.Domain_DOMAIN_INFOTAINMENT},
+		},
+		Payload: &universal.RoutableMessage_ProtobufMessageAsBytes{ProtobufMessageAsBytes: []byte{1, 2, 3}},
+		Uuid:    []byte("0123456789abcdef"),
+	}
+	message.ProtoReflect().SetUnknown(unknownField(999, 42))
+	message.ToDestination.ProtoReflect().SetUnknown(unknownField(500, 7))
+
+	encoded, err := MarshalJSON(message, "  ")
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %s", err)
+	}
+	if strings.Count(string(encoded), UnknownFieldsKey) != 2 {
+		t.Errorf("Expected two unknown field entries in %s", encoded)
+	}
+	if !strings.Contains(string(encoded), "DOMAIN_INFOTAINMENT") {
+		t.Errorf("Expected enum names in output: %s", encoded)
+	}
+
+	var decoded universal.RoutableMessage
+	if err := UnmarshalJSON(encoded, &decoded); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %s", err)
+	}
+	if !proto.Equal(message, &decoded) {
+		t.Errorf("Round trip mismatch:\n%v\n%v", message, &decoded)
+	}
+}
+
+func TestJSONRepeatedMessages(t *testing.T) {
+	action := &carserver.Action{
+		ActionMsg: &carserver.Action_VehicleAction{
+			VehicleAction: &carserver.VehicleAction{
+				VehicleActionMsg: &carserver.VehicleAction_ChargingSetLimitAction{
+					ChargingSetLimitAction: &carserver.ChargingSetLimitAction{Percent: 80},
+				},
+			},
+		},
+	}
+	action.GetVehicleAction().GetChargingSetLimitAction().ProtoReflect().SetUnknown(unknownField(100, 1))
+
+	encoded, err := MarshalJSON(action, "")
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: %s", err)
+	}
+	var decoded carserver.Action
+	if err := UnmarshalJSON(encoded, &decoded); err != nil {
+		t.Fatalf("UnmarshalJSON failed: %s", err)
+	}
+	if !proto.Equal(action, &decoded) {
+		t.Errorf("Round trip mismatch:\n%v\n%v", action, &decoded)
+	}
+}
+
+func TestUnmarshalJSONRejectsInvalidUnknownFields(t *testing.T) {
+	var message universal.RoutableMessage
+	if err := UnmarshalJSON([]byte(`{"@unknown": "not base64!"}`), &message); err == nil {
+		t.Errorf("Expected error for invalid base64")
+	}
+	if err := UnmarshalJSON([]byte(`{"@unknown": 5}`), &message); err == nil {
+		t.Errorf("Expected error for non-string value")
+	}
+}
+
+func TestRoutableMessageJSON(t *testing.T) {
+	if out := RoutableMessageJSON([]byte{0xff}); !strings.HasPrefix(out, "<invalid") {
+		t.Errorf("Expected invalid message marker, got %s", out)
+	}
+}
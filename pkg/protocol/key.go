@@ -17,13 +17,48 @@ import (
 
 type ECDHPrivateKey authentication.ECDHPrivateKey
 
+// KeyUsage describes one use of a private key, as reported to a KeyUsageObserver.
+type KeyUsage = authentication.KeyUsage
+
+// KeyUsageObserver receives a KeyUsage for each operation of a key returned by ObserveKeyUsage.
+type KeyUsageObserver = authentication.KeyUsageObserver
+
+// KeyUsageFunc adapts a function to the KeyUsageObserver interface.
+type KeyUsageFunc = authentication.KeyUsageFunc
+
+// KeyUsageLog is a KeyUsageObserver that writes JSON lines.
+type KeyUsageLog = authentication.KeyUsageLog
+
+// Key operations and purposes reported in KeyUsage.
+const (
+	KeyOperationECDH = authentication.KeyOperationECDH
+	KeyOperationSign = authentication.KeyOperationSign
+
+	KeyPurposeUnspecified      = authentication.KeyPurposeUnspecified
+	KeyPurposeSessionHandshake = authentication.KeyPurposeSessionHandshake
+	KeyPurposeSessionResume    = authentication.KeyPurposeSessionResume
+	KeyPurposeMessageSignature = authentication.KeyPurposeMessageSignature
+)
+
+// ObserveKeyUsage returns a key that reports each ECDH exchange and signature made with skey to
+// observer, labeled with the vehicle and purpose where known. Keys that aren't observed incur no
+// overhead.
+func ObserveKeyUsage(skey ECDHPrivateKey, observer KeyUsageObserver) ECDHPrivateKey {
+	return authentication.ObserveKeyUsage(skey, observer)
+}
+
+// NewKeyUsageLog returns a KeyUsageObserver that writes each KeyUsage to out as a line of JSON.
+func NewKeyUsageLog(out io.Writer) *KeyUsageLog {
+	return authentication.NewKeyUsageLog(out)
+}
+
 // LoadPrivateKey loads a P256 EC private key from a file.
 func LoadPrivateKey(filename string) (ECDHPrivateKey, error) {
 	return authentication.LoadExternalECDHKey(filename)
 }
 
 func SavePrivateKey(skey ECDHPrivateKey, filename string) error {
-	nativeKey, ok := skey.(*authentication.NativeECDHKey)
+	nativeKey, ok := authentication.UnwrapKey(skey).(*authentication.NativeECDHKey)
 	if !ok {
 		return fmt.Errorf("key is not exportable")
 	}
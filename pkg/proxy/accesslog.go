@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/redact"
+)
+
+// accessLogTimeFormat is the timestamp layout used by Common Log Format.
+const accessLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLogConfig configures the access log written by the proxy binaries.
+type AccessLogConfig struct {
+	Filename   string // Append access log lines to this file, or to standard output if "-".
+	MaxBytes   int64  // Rotate Filename once it exceeds this size. Zero disables rotation.
+	MaxBackups int    // Number of rotated files to keep.
+}
+
+// Open returns a writer for Proxy.AccessLog. It returns nil (and no error) if the access log is
+// not configured.
+func (c *AccessLogConfig) Open() (io.Writer, error) {
+	switch c.Filename {
+	case "":
+		return nil, nil
+	case "-":
+		return os.Stdout, nil
+	}
+	f, err := OpenRotatingFile(c.Filename, c.MaxBytes, c.MaxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open access log: %w", err)
+	}
+	return f, nil
+}
+
+// accessLogWriter records the status and size of a response for the access log. It wraps the
+// connection's ResponseWriter, beneath compression, so that it counts the bytes actually sent.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (a *accessLogWriter) WriteHeader(code int) {
+	if a.status == 0 {
+		a.status = code
+	}
+	a.ResponseWriter.WriteHeader(code)
+}
+
+func (a *accessLogWriter) Write(p []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	n, err := a.ResponseWriter.Write(p)
+	a.bytes += int64(n)
+	return n, err
+}
+
+// logAccess writes an access log entry for req, which started at start. It must be deferred.
+func (p *Proxy) logAccess(w *accessLogWriter, req *http.Request, start time.Time) {
+	line := formatAccessLogEntry(p.clientHost(req), req, w.status, w.bytes, start, time.Since(start))
+	p.accessLogLock.Lock()
+	defer p.accessLogLock.Unlock()
+	if _, err := io.WriteString(p.AccessLog, line); err != nil {
+		log.Warning("Couldn't write access log: %s", err)
+	}
+}
+
+// clientHost returns the address of the client that sent req, as identified by the proxy's
+// IPFilter if it has one.
+func (p *Proxy) clientHost(req *http.Request) string {
+	if p.ipFilter != nil {
+		if addr, err := p.ipFilter.ClientAddr(req); err == nil {
+			return addr.String()
+		}
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// formatAccessLogEntry returns a line in Apache Combined Log Format, followed by the time taken to
+// serve the request in microseconds (as Apache's %D). VINs in the request line are redacted, and
+// the remote user is always "-" so that OAuth tokens never reach the log.
+func formatAccessLogEntry(host string, req *http.Request, status int, bytes int64, start time.Time, latency time.Duration) string {
+	if status == 0 {
+		// The handler didn't write anything, so net/http sends an empty 200.
+		status = http.StatusOK
+	}
+	size := "-"
+	if bytes > 0 {
+		size = strconv.FormatInt(bytes, 10)
+	}
+	requestLine := fmt.Sprintf("%s %s %s", req.Method, req.URL.RequestURI(), req.Proto)
+	return fmt.Sprintf("%s - - [%s] \"%s\" %d %s \"%s\" \"%s\" %d\n",
+		host,
+		start.Format(accessLogTimeFormat),
+		escapeAccessLogField(redact.Text(requestLine)),
+		status,
+		size,
+		escapeAccessLogField(orDash(req.Referer())),
+		escapeAccessLogField(orDash(req.UserAgent())),
+		latency.Microseconds())
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escapeAccessLogField escapes quotes, backslashes, and non-printable characters as Apache does,
+// so that clients can't forge log entries.
+func escapeAccessLogField(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package proxy_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	p, _ := newTestProxy(t, true)
+	var out bytes.Buffer
+	p.AccessLog = &out
+
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/door_lock", strings.NewReader("{}"))
+	req.RemoteAddr = "192.0.2.10:51234"
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("User-Agent", `fleet-client/1.0 "beta"`)
+	req.Header.Set("Referer", "https://example.com/dashboard")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.RemoteAddr = "192.0.2.11:51235"
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 access log lines, got %q", out.String())
+	}
+	pattern := regexp.MustCompile(`^192\.0\.2\.10 - - \[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] ` +
+		`"POST /api/1/vehicles/\*{13}0001/command/door_lock HTTP/1\.1" 200 (\d+) ` +
+		`"https://example\.com/dashboard" "fleet-client/1\.0 \\"beta\\"" \d+$`)
+	match := pattern.FindStringSubmatch(lines[0])
+	if match == nil {
+		t.Fatalf("Unexpected access log line %q", lines[0])
+	}
+	if size := strconv.Itoa(w.Body.Len()); match[1] != size {
+		t.Errorf("Logged %s bytes, but the response was %s bytes", match[1], size)
+	}
+	if !regexp.MustCompile(`^192\.0\.2\.11 - - \[[^]]+\] "GET /health HTTP/1\.1" 200 \d+ "-" "-" \d+$`).MatchString(lines[1]) {
+		t.Errorf("Unexpected access log line %q", lines[1])
+	}
+	if strings.Contains(out.String(), testVIN) || strings.Contains(out.String(), testToken) {
+		t.Error("Access log contains a VIN or OAuth token")
+	}
+}
@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/redact"
+	"github.com/teslamotors/vehicle-command/pkg/version"
+)
+
+const (
+	adminVehiclesPath   = "/admin/vehicles/"
+	adminStatsPath      = "/admin/stats"
+	adminDrainPath      = "/admin/drain"
+	adminConfigPath     = "/admin/config"
+	adminClockCheckPath = "/admin/clock-check"
+
+	// lastCommandPath and lastCommandSuffix surround the VIN in the path of the last command
+	// endpoint, which requires the admin token although it isn't under /admin/.
+	lastCommandPath   = "/vehicles/"
+	lastCommandSuffix = "last-command"
+)
+
+var errAdminUnauthorized = errors.New("missing or invalid admin token")
+
+// sessionReset is the response to POST /admin/vehicles/{VIN}/reset_session.
+type sessionReset struct {
+	VIN   string `json:"vin"`
+	Reset bool   `json:"reset"`
+}
+
+// adminStats is the response to GET /admin/stats.
+type adminStats struct {
+	Version          string    `json:"version"`
+	Environment      string    `json:"environment,omitempty"`
+	FleetAPIHost     string    `json:"fleet_api_host,omitempty"`
+	StartTime        time.Time `json:"start_time"`
+	UptimeSeconds    int64     `json:"uptime_seconds"`
+	CommandsInFlight int64     `json:"commands_in_flight"`
+	VehiclesActive   int       `json:"vehicles_active"`
+	SessionsRejected uint64    `json:"sessions_rejected"`
+	Panics           uint64    `json:"panics"`
+	Draining         bool      `json:"draining"`
+	RequestsInFlight int64     `json:"requests_in_flight"`
+	RequestsQueued   int       `json:"requests_queued"`
+	RequestsShed     uint64    `json:"requests_shed"`
+}
+
+// authorizeAdmin checks that req carries p.AdminToken. Otherwise, it writes an error response and
+// returns false. Admin endpoints don't exist unless p.AdminToken is set.
+func (p *Proxy) authorizeAdmin(w http.ResponseWriter, req *http.Request) bool {
+	if len(p.AdminToken) == 0 {
+		writeJSONError(w, http.StatusNotFound, nil)
+		return false
+	}
+	expected := append([]byte("Bearer "), p.AdminToken...)
+	if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), expected) != 1 {
+		log.Warning("Rejected admin request from %s for %s", req.RemoteAddr, req.URL.Path)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeJSONError(w, http.StatusUnauthorized, errAdminUnauthorized)
+		return false
+	}
+	return true
+}
+
+// handleResetSession discards the proxy's sessions with vin, including the anti-replay counters
+// and epochs, so that the next command performs a new handshake. This recovers from a vehicle that
+// was reset, or whose keys were re-enrolled, without the proxy noticing.
+func (p *Proxy) handleResetSession(w http.ResponseWriter, req *http.Request, vin string) {
+	if len(vin) != vinLength {
+		writeJSONError(w, http.StatusNotFound, errors.New("expected 17-character VIN in path"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	// Wait for any command in progress, which would otherwise save its session afterwards.
+	if err := p.lockVIN(ctx, vin); err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer p.unlockVIN(vin)
+
+	p.sessions.Delete(vin)
+	p.keyRoles.Delete(vin)
+	p.signedCommands.Delete(vin)
+	p.idleSessions.Delete(vin)
+	p.lastCommands.delete(vin)
+	p.discardVehicle(vin)
+	if p.SessionStore != nil {
+		// Replace the stored sessions with an empty cache, which loadStoredSessions ignores.
+		var buffer bytes.Buffer
+		err := cache.New(0).Export(&buffer)
+		if err == nil {
+			err = p.SessionStore.Save(ctx, vin, buffer.Bytes())
+		}
+		if err != nil {
+			p.metrics.sessionStoreErrors.Add(1)
+			log.Error("Couldn't reset stored sessions for %s: %s", vin, err)
+			writeJSONError(w, http.StatusServiceUnavailable, errSessionStoreUnavailable)
+			return
+		}
+	}
+	log.Warning("Admin request from %s reset sessions for %s", req.RemoteAddr, vin)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: &sessionReset{VIN: vin, Reset: true}})
+}
+
+// handleAdminStats reports which environment the proxy is using, along with a summary of its
+// load.
+func (p *Proxy) handleAdminStats(w http.ResponseWriter) {
+	m := p.metrics
+	m.queueLock.Lock()
+	active := len(m.queueDepth)
+	m.queueLock.Unlock()
+	stats := &adminStats{
+		Version:          version.Get().Version,
+		Environment:      p.Environment,
+		FleetAPIHost:     p.FleetAPIHost,
+		StartTime:        p.started.UTC(),
+		UptimeSeconds:    int64(time.Since(p.started) / time.Second),
+		CommandsInFlight: m.inFlight.Load(),
+		VehiclesActive:   active,
+		SessionsRejected: m.sessionsRejected.Load(),
+		Panics:           m.panics.Load(),
+		Draining:         p.Draining(),
+		RequestsInFlight: m.requestsInFlight.Load(),
+		RequestsQueued:   p.admission.depth(),
+		RequestsShed:     p.admission.shedCount(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: stats})
+}
+
+// adminConfig is the response to GET /admin/config.
+type adminConfig struct {
+	// Proxy holds the configuration of p, keyed by field name in snake case.
+	Proxy map[string]string `json:"proxy"`
+	// Settings holds Proxy.Settings, usually the command-line configuration of the proxy binary.
+	Settings map[string]string `json:"settings,omitempty"`
+}
+
+// proxySettings returns p's configuration for GET /admin/config. Secrets held by p are reported as
+// redact.Secret if they're set.
+func (p *Proxy) proxySettings() map[string]string {
+	settings := map[string]string{
+		"timeout":                   p.Timeout.String(),
+		"connect_timeout":           p.ConnectTimeout.String(),
+		"command_timeout":           p.CommandTimeout.String(),
+		"api_call_timeout":          p.APICallTimeout.String(),
+		"base_path":                 p.basePath(),
+		"audit":                     strconv.FormatBool(p.Audit != nil),
+		"access_log":                strconv.FormatBool(p.AccessLog != nil),
+		"max_url_length":            strconv.Itoa(p.MaxURLLength),
+		"max_header_bytes":          strconv.Itoa(p.MaxHeaderBytes),
+		"role_refresh_interval":     p.RoleRefreshInterval.String(),
+		"max_active_sessions":       strconv.Itoa(p.MaxActiveSessions),
+		"max_concurrent_requests":   strconv.Itoa(p.MaxConcurrentRequests),
+		"max_queued_requests":       strconv.Itoa(p.MaxQueuedRequests),
+		"admission_wait":            p.admissionWait().String(),
+		"compression_min_bytes":     strconv.Itoa(p.CompressionMinBytes),
+		"close_connections":         strconv.FormatBool(p.CloseConnections),
+		"allow_location":            strconv.FormatBool(p.AllowLocation),
+		"allow_speed_limit":         strconv.FormatBool(p.AllowSpeedLimit),
+		"enable_ui":                 strconv.FormatBool(p.EnableUI),
+		"user_agent":                version.UserAgent(p.UserAgent),
+		"busy_status":               strconv.Itoa(p.busyStatus()),
+		"strict_parameters":         strconv.FormatBool(p.StrictParameters),
+		"include_timing":            strconv.FormatBool(p.IncludeTiming),
+		"include_messages":          strconv.FormatBool(p.IncludeMessages),
+		"session_store":             strconv.FormatBool(p.SessionStore != nil),
+		"session_store_fail_closed": strconv.FormatBool(p.SessionStoreFailClosed),
+		"keep_alive_interval":       p.KeepAliveInterval.String(),
+		"max_keep_alive_idle":       p.MaxKeepAliveIdle.String(),
+		"vehicle_idle_timeout":      p.VehicleIdleTimeout.String(),
+		"vin_allowlist_entries":     strconv.Itoa(p.vinAllowlist.Len()),
+		"environment":               p.Environment,
+		"fleet_api_host":            p.FleetAPIHost,
+		"max_clock_skew":            p.MaxClockSkew.String(),
+		"clock_check_url":           redact.URL(p.clockCheckURL()),
+		"callback_attempts":         strconv.Itoa(p.Callbacks.Attempts),
+		"callback_retry_interval":   p.Callbacks.RetryInterval.String(),
+		"callback_allowed_hosts":    strings.Join(p.Callbacks.AllowedHosts, ","),
+		"command_key":               redact.Secret,
+		"admin_token":               redact.Secret,
+	}
+	if len(p.Callbacks.SigningKey) > 0 {
+		settings["callback_signing_key"] = redact.Secret
+	}
+	if len(p.MetricsToken) > 0 {
+		settings["metrics_token"] = redact.Secret
+	}
+	return settings
+}
+
+// handleAdminConfig reports the proxy's effective configuration, so that operators can check what
+// a deployment is running with. Secrets are never included. Besides the secrets that
+// proxySettings masks, any value in p.Settings that names a secret, or that contains one of the
+// proxy's own secrets, is replaced with redact.Secret, and URLs such as webhooks are reported
+// without their credentials (see redact.URL).
+func (p *Proxy) handleAdminConfig(w http.ResponseWriter) {
+	reply := &adminConfig{Proxy: p.proxySettings()}
+	if len(p.Settings) > 0 {
+		reply.Settings = make(map[string]string, len(p.Settings))
+		for name, value := range p.Settings {
+			if redact.IsSecretSetting(name) || p.containsSecret(value) {
+				value = redact.Secret
+			}
+			value = redact.URL(value)
+			reply.Settings[name] = value
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: reply})
+}
+
+// containsSecret returns true if value includes the admin token, metrics token, or callback signing
+// key.
+func (p *Proxy) containsSecret(value string) bool {
+	for _, secret := range [][]byte{p.AdminToken, p.MetricsToken, p.Callbacks.SigningKey} {
+		if len(secret) > 0 && strings.Contains(value, string(secret)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+)
+
+// DefaultAdmissionWait is the default value of Proxy.AdmissionWait.
+const DefaultAdmissionWait = 2 * time.Second
+
+// admissionRetryAfterSeconds is the Retry-After value sent with requests shed by the admission
+// controller.
+const admissionRetryAfterSeconds = 1
+
+var errOverloaded = errors.New("proxy is overloaded; try again later")
+
+// admissionQueue limits the number of requests handled at once. Requests beyond the limit wait in
+// FIFO order, and each request that finishes hands its slot directly to the oldest waiter, so that
+// new arrivals can't overtake requests that are already queued.
+type admissionQueue struct {
+	lock    sync.Mutex
+	active  int
+	waiters []chan struct{}
+	shed    uint64
+	clock   clock.Clock
+}
+
+// acquire returns true once the caller may proceed, in which case it must call release when it's
+// done. It returns false without waiting if maxQueued requests are already waiting, and returns
+// false if the caller doesn't reach the front of the queue within wait or before ctx is done.
+func (a *admissionQueue) acquire(ctx context.Context, limit, maxQueued int, wait time.Duration) bool {
+	a.lock.Lock()
+	if a.active < limit && len(a.waiters) == 0 {
+		a.active++
+		a.lock.Unlock()
+		return true
+	}
+	if len(a.waiters) >= maxQueued {
+		a.shed++
+		a.lock.Unlock()
+		return false
+	}
+	admitted := make(chan struct{}, 1)
+	a.waiters = append(a.waiters, admitted)
+	a.lock.Unlock()
+
+	timer := a.clock.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-admitted:
+		return true
+	case <-timer.C():
+	case <-ctx.Done():
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	select {
+	case <-admitted:
+		// release handed over a slot after the wait expired.
+		return true
+	default:
+	}
+	for i, waiter := range a.waiters {
+		if waiter == admitted {
+			a.waiters = append(a.waiters[:i], a.waiters[i+1:]...)
+			break
+		}
+	}
+	a.shed++
+	return false
+}
+
+// release ends a request admitted by acquire, passing its slot to the oldest waiting request.
+func (a *admissionQueue) release() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.waiters) > 0 {
+		a.waiters[0] <- struct{}{}
+		a.waiters = a.waiters[1:]
+		return
+	}
+	a.active--
+}
+
+// depth returns the number of requests waiting to be admitted.
+func (a *admissionQueue) depth() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return len(a.waiters)
+}
+
+// shedCount returns the number of requests turned away since the proxy started.
+func (a *admissionQueue) shedCount() uint64 {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.shed
+}
+
+func (p *Proxy) admissionWait() time.Duration {
+	if p.AdmissionWait <= 0 {
+		return DefaultAdmissionWait
+	}
+	return p.AdmissionWait
+}
+
+// admissionSlot is a request's slot under MaxConcurrentRequests. The handler that was admitted
+// releases it when it returns, unless it hands the slot off to work that continues in the
+// background, such as an asynchronous command.
+type admissionSlot struct {
+	queue     *admissionQueue
+	handedOff bool
+}
+
+type admissionSlotKey struct{}
+
+func (s *admissionSlot) release() {
+	if !s.handedOff {
+		s.queue.release()
+	}
+}
+
+// handOffAdmission transfers the slot of the request with context ctx, if it has one, from its
+// handler to the caller. The caller must call the returned function once the request's work is
+// done.
+func handOffAdmission(ctx context.Context) func() {
+	slot, ok := ctx.Value(admissionSlotKey{}).(*admissionSlot)
+	if !ok || slot.handedOff {
+		return func() {}
+	}
+	slot.handedOff = true
+	return slot.queue.release
+}
+
+// admit waits for req to be admitted under p.MaxConcurrentRequests. If the proxy is overloaded, it
+// writes a 503 with a Retry-After header and returns false. Otherwise, the caller must call
+// p.admission.release once it has handled req.
+func (p *Proxy) admit(w http.ResponseWriter, req *http.Request) bool {
+	if p.admission.acquire(req.Context(), p.MaxConcurrentRequests, p.MaxQueuedRequests, p.admissionWait()) {
+		return true
+	}
+	log.Warning("Shed %s request for %s: proxy is overloaded", req.Method, req.URL.Path)
+	w.Header().Set("Retry-After", strconv.Itoa(admissionRetryAfterSeconds))
+	writeJSONError(w, http.StatusServiceUnavailable, errOverloaded)
+	return false
+}
@@ -0,0 +1,115 @@
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+// sendLock sends door_lock to p. Unlike postCommand, it's safe to call from other goroutines.
+func sendLock(p *proxy.Proxy) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/door_lock", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	return w
+}
+
+// waitFor polls condition until it's true or the test times out.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAdmissionControl(t *testing.T) {
+	// Commands block in the authorizer until release is closed.
+	release := make(chan struct{})
+	var releaseLock sync.Mutex
+	authorize := func(ctx context.Context, _ proxy.CommandRequest) error {
+		releaseLock.Lock()
+		ch := release
+		releaseLock.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+		}
+		return nil
+	}
+	p, _ := newTestProxy(t, true, proxy.WithAuthorizer(authorizerFunc(authorize)))
+	p.MaxConcurrentRequests = 1
+	p.MaxQueuedRequests = 1
+	p.AdmissionWait = 5 * time.Second
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		codes[0] = sendLock(p).Code
+	}()
+	waitFor(t, func() bool { return p.RequestsInFlight() == 1 })
+	go func() {
+		defer wg.Done()
+		codes[1] = sendLock(p).Code
+	}()
+	waitFor(t, func() bool {
+		return strings.Contains(scrapeMetrics(t, p), "tesla_proxy_admission_queue_depth 1\n")
+	})
+
+	// The queue is full, so the next request is shed without waiting.
+	w := sendLock(p)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 503 with Retry-After, got %d: %s", w.Code, w.Body.String())
+	}
+	health := httptest.NewRecorder()
+	p.ServeHTTP(health, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if health.Code != http.StatusOK {
+		t.Errorf("Health check wasn't exempt from admission control: %d", health.Code)
+	}
+
+	close(release)
+	wg.Wait()
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK {
+		t.Errorf("Admitted requests failed: %v", codes)
+	}
+
+	// A queued request that isn't admitted within AdmissionWait is shed.
+	releaseLock.Lock()
+	release = make(chan struct{})
+	releaseLock.Unlock()
+	p.AdmissionWait = 20 * time.Millisecond
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		codes[0] = sendLock(p).Code
+	}()
+	waitFor(t, func() bool { return p.RequestsInFlight() == 1 })
+	if w := sendLock(p); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after waiting, got %d", w.Code)
+	}
+	close(release)
+	wg.Wait()
+
+	metrics := scrapeMetrics(t, p)
+	for _, line := range []string{
+		"tesla_proxy_requests_max 1\n",
+		"tesla_proxy_admission_queue_depth 0\n",
+		"tesla_proxy_requests_shed_total 2\n",
+	} {
+		if !strings.Contains(metrics, line) {
+			t.Errorf("Metrics don't include %q:\n%s", line, metrics)
+		}
+	}
+}
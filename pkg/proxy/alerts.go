@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+)
+
+// AlertsResolver returns the alerts a vehicle recently raised.
+type AlertsResolver func(ctx context.Context, acct *account.Account, vin string) ([]account.Alert, error)
+
+// WithAlertsResolver replaces the lookup used by GET /api/1/vehicles/{VIN}/alerts. By default,
+// alerts are read from Fleet API with [account.Account.RecentAlerts].
+func WithAlertsResolver(resolve AlertsResolver) Option {
+	return func(p *Proxy) {
+		p.resolveAlerts = resolve
+	}
+}
+
+// vehicleAlerts is the response to GET /api/1/vehicles/{VIN}/alerts.
+type vehicleAlerts struct {
+	// Supported is false if the vehicle doesn't report alerts, in which case Alerts is empty.
+	Supported bool            `json:"supported"`
+	Alerts    []account.Alert `json:"alerts"`
+}
+
+// handleVehicleAlerts reports the alerts vin recently raised. Vehicles that don't report alerts
+// get an empty list rather than an error, so that clients polling a mixed fleet don't need to
+// special-case them.
+func (p *Proxy) handleVehicleAlerts(acct *account.Account, w http.ResponseWriter, vin string) {
+	if len(vin) != vinLength {
+		writeJSONError(w, http.StatusNotFound, errors.New("expected 17-character VIN or numeric vehicle ID in path"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	resolve := p.resolveAlerts
+	if resolve == nil {
+		resolve = func(ctx context.Context, acct *account.Account, vin string) ([]account.Alert, error) {
+			return acct.RecentAlerts(ctx, vin)
+		}
+	}
+	reply := vehicleAlerts{Supported: true}
+	alerts, err := resolve(ctx, acct, vin)
+	switch {
+	case errors.Is(err, account.ErrAlertsNotSupported):
+		log.Debug("[%s] Vehicle doesn't report alerts", vin)
+		reply.Supported = false
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	default:
+		reply.Alerts = alerts
+	}
+	if reply.Alerts == nil {
+		reply.Alerts = []account.Alert{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: &reply})
+}
@@ -0,0 +1,48 @@
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func TestVehicleAlerts(t *testing.T) {
+	const unsupportedVIN, failingVIN = "5YJ3E1EA7KF000002", "5YJ3E1EA7KF000003"
+	raised := time.Date(2024, 3, 19, 22, 1, 15, 0, time.UTC)
+	resolve := func(_ context.Context, _ *account.Account, vin string) ([]account.Alert, error) {
+		switch vin {
+		case testVIN:
+			return []account.Alert{{Name: "VCFRONT_a192_doorOpen", Time: raised, Audience: []string{"customer"}, UserText: "Door open"}}, nil
+		case unsupportedVIN:
+			return nil, account.ErrAlertsNotSupported
+		}
+		return nil, errors.New("fleet api unavailable")
+	}
+	p, _ := newTestProxy(t, true, proxy.WithAlertsResolver(resolve))
+	get := func(vin string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/api/1/vehicles/"+vin+"/alerts", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+
+	expected := `"response":{"supported":true,"alerts":[{"name":"VCFRONT_a192_doorOpen","time":"2024-03-19T22:01:15Z","audience":["customer"],"user_text":"Door open"}]}`
+	if code, body := get(testVIN); code != http.StatusOK || !strings.Contains(body, expected) {
+		t.Errorf("Unexpected response %d %s", code, body)
+	}
+	// Vehicles that don't report alerts aren't an error.
+	if code, body := get(unsupportedVIN); code != http.StatusOK || !strings.Contains(body, `"response":{"supported":false,"alerts":[]}`) {
+		t.Errorf("Unexpected response %d %s", code, body)
+	}
+	if code, body := get(failingVIN); code != http.StatusInternalServerError || !strings.Contains(body, "fleet api unavailable") {
+		t.Errorf("Unexpected response %d %s", code, body)
+	}
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// CommandAliases lets clients call commands by other names, such as the names used by other Tesla
+// API wrappers. The proxy replaces an alias with the command it stands for as soon as it matches
+// the request's route, so policies, defaults, audit records, and metrics all use the command's
+// name in the catalog. CommandAliases must be created with ParseCommandAliases or
+// LoadCommandAliasesFile.
+type CommandAliases struct {
+	// Aliases maps each alias to the name of a command in the catalog.
+	Aliases map[string]string `json:"aliases"`
+}
+
+// ParseCommandAliases decodes JSON-encoded CommandAliases, such as
+//
+//	{"aliases": {"climate_on": "auto_conditioning_start", "climate_off": "auto_conditioning_stop"}}
+//
+// Each alias must map to a command in the catalog. An alias can't be the name of a command itself,
+// since that would make the command unreachable.
+func ParseCommandAliases(data []byte) (*CommandAliases, error) {
+	var aliases CommandAliases
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, err
+	}
+	for alias, command := range aliases.Aliases {
+		if err := validateAlias(alias, command); err != nil {
+			return nil, fmt.Errorf("alias %q: %w", alias, err)
+		}
+	}
+	return &aliases, nil
+}
+
+// LoadCommandAliasesFile reads JSON-encoded CommandAliases from filename.
+func LoadCommandAliasesFile(filename string) (*CommandAliases, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := ParseCommandAliases(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid aliases file %s: %w", filename, err)
+	}
+	return aliases, nil
+}
+
+func validateAlias(alias, command string) error {
+	if !aliasPattern.MatchString(alias) {
+		return errors.New("aliases may only contain letters, digits, underscores, and hyphens")
+	}
+	if _, ok := catalog.Lookup(alias); ok {
+		return errors.New("collides with the command of the same name")
+	}
+	if _, ok := catalog.Lookup(command); !ok {
+		return fmt.Errorf("unknown command %q", command)
+	}
+	return nil
+}
+
+// WithCommandAliases makes the proxy accept the aliases as command names.
+func WithCommandAliases(aliases *CommandAliases) Option {
+	return func(p *Proxy) {
+		p.aliases = aliases
+	}
+}
+
+// resolveCommandAlias replaces an alias in a vehicle command or command schema route with the
+// command it stands for. The request's path is rewritten too, so that commands forwarded to Fleet
+// API use the command's name.
+func (p *Proxy) resolveCommandAlias(req *http.Request, rt *route) {
+	if p.aliases == nil || (rt.kind != routeVehicleCommand && rt.kind != routeCommandSchema) {
+		return
+	}
+	command, ok := p.aliases.Aliases[rt.command]
+	if !ok {
+		return
+	}
+	if rt.kind == routeVehicleCommand {
+		req.URL.Path = strings.TrimSuffix(req.URL.Path, rt.command) + command
+		req.URL.RawPath = ""
+		rt.methods = commandMethods(command)
+	}
+	log.Debug("Resolved command alias %s to %s", rt.command, command)
+	rt.command = command
+}
@@ -0,0 +1,78 @@
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func TestCommandAliases(t *testing.T) {
+	aliases, err := proxy.ParseCommandAliases([]byte(`{"aliases": {
+		"unlock": "door_unlock",
+		"chargeLimit": "set_charge_limit"
+	}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var commands []string
+	authorize := func(_ context.Context, req proxy.CommandRequest) error {
+		commands = append(commands, req.Command)
+		return nil
+	}
+	p, car := newTestProxy(t, true, proxy.WithCommandAliases(aliases), proxy.WithAuthorizer(authorizerFunc(authorize)))
+
+	if code, reply := postCommand(t, p, "unlock", nil); code != http.StatusOK || car.Locked() {
+		t.Fatalf("Alias didn't unlock the vehicle: %d %+v", code, reply)
+	}
+	if len(commands) != 1 || commands[0] != "door_unlock" {
+		t.Errorf("Expected the authorizer to see door_unlock, got %v", commands)
+	}
+
+	// Aliases accept the same methods as their commands.
+	req := httptest.NewRequest(http.MethodGet, "/api/1/vehicles/"+testVIN+"/command/chargeLimit?percent=65", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || car.ChargeLimit() != 65 {
+		t.Errorf("Unexpected response to GET of alias: %d %s", w.Code, w.Body.String())
+	}
+	req = httptest.NewRequest(http.MethodGet, "/api/1/vehicles/"+testVIN+"/command/unlock", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST" {
+		t.Errorf("Expected 405 for GET of POST-only alias, got %d %v", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/1/commands/chargeLimit/schema", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"percent"`) {
+		t.Errorf("Unexpected schema for alias: %d %s", w.Code, w.Body.String())
+	}
+
+	// Without aliases, the names are unknown commands.
+	p, _ = newTestProxy(t, true)
+	if code, _ := postCommand(t, p, "unlock", nil); code == http.StatusOK {
+		t.Errorf("Alias was accepted without being configured")
+	}
+}
+
+func TestParseCommandAliases(t *testing.T) {
+	invalid := map[string]string{
+		"collision":      `{"aliases": {"door_lock": "door_unlock"}}`,
+		"unknown target": `{"aliases": {"lock": "door_lokc"}}`,
+		"chained alias":  `{"aliases": {"lock": "close", "close": "door_lock"}}`,
+		"path separator": `{"aliases": {"doors/lock": "door_lock"}}`,
+		"empty name":     `{"aliases": {"": "door_lock"}}`,
+		"JSON":           `{"aliases": ["door_lock"]}`,
+	}
+	for label, config := range invalid {
+		if _, err := proxy.ParseCommandAliases([]byte(config)); err == nil {
+			t.Errorf("Expected error for invalid %s", label)
+		}
+	}
+}
@@ -0,0 +1,579 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/redact"
+)
+
+const (
+	// DefaultAuditQueueSize is the number of audit records that may be buffered before new records
+	// are dropped.
+	DefaultAuditQueueSize = 1024
+
+	// Audit outcomes.
+	AuditOutcomeSuccess   = "success"
+	AuditOutcomeFailure   = "failure"
+	AuditOutcomeForwarded = "forwarded"
+
+	requestIDHeader = "X-Request-ID"
+)
+
+// AuditRecord describes a single command sent through the proxy. Records are written as JSON lines.
+//
+// Each record includes the hash of the previous record, and its own hash is computed over its
+// contents (excluding the Hash field) together with PrevHash. Removing or modifying records breaks
+// the chain, which can be detected by VerifyAuditChain.
+type AuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id"`
+	VIN       string    `json:"vin"`
+	Command   string    `json:"command"`
+	Requester string    `json:"requester"`
+	Outcome   string    `json:"outcome"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	// Response is the "response" object of the reply sent to the client, after the AuditLogger's
+	// redactions have been applied.
+	Response json.RawMessage `json:"response,omitempty"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+}
+
+func (r *AuditRecord) computeHash() (string, error) {
+	unsigned := *r
+	unsigned.Hash = ""
+	encoded, err := json.Marshal(&unsigned)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(encoded)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// AuditLogger asynchronously writes AuditRecords to an io.Writer. Each record is passed to the
+// writer in a single Write call, so writers that frame output per call (such as WebhookWriter)
+// receive exactly one record at a time.
+//
+// Recording an event never blocks command processing: if the queue is full, the record is dropped
+// and counted.
+type AuditLogger struct {
+	// Redactions are applied to each record's Response before it's queued. NewAuditLogger
+	// initializes it to DefaultAuditRedactions.
+	Redactions AuditRedactions
+
+	out      io.Writer
+	queue    chan AuditRecord
+	done     chan struct{}
+	dropped  atomic.Uint64
+	failed   atomic.Uint64
+	prevHash string
+	closeMu  sync.Mutex
+	closed   bool
+}
+
+// NewAuditLogger starts an AuditLogger that writes to out. The queueSize bounds the number of
+// records waiting to be written; use DefaultAuditQueueSize if unsure.
+func NewAuditLogger(out io.Writer, queueSize int) *AuditLogger {
+	return newAuditLogger(out, queueSize, "")
+}
+
+// newAuditLogger starts an AuditLogger whose first record follows the record with hash prevHash,
+// so that the chain continues the records that out already holds.
+func newAuditLogger(out io.Writer, queueSize int, prevHash string) *AuditLogger {
+	if queueSize <= 0 {
+		queueSize = DefaultAuditQueueSize
+	}
+	a := &AuditLogger{
+		Redactions: DefaultAuditRedactions(),
+		out:        out,
+		queue:      make(chan AuditRecord, queueSize),
+		done:       make(chan struct{}),
+		prevHash:   prevHash,
+	}
+	go a.run()
+	return a
+}
+
+// Record enqueues r. The Timestamp is set if empty, the VIN and Response are redacted, and the hash
+// chain fields are populated when the record is written.
+func (a *AuditLogger) Record(r AuditRecord) {
+	if r.Timestamp.IsZero() {
+		r.Timestamp = time.Now()
+	}
+	r.VIN = redact.VIN(r.VIN)
+	r.Response = a.Redactions.apply(r.Command, r.Response)
+
+	a.closeMu.Lock()
+	defer a.closeMu.Unlock()
+	if a.closed {
+		a.dropped.Add(1)
+		return
+	}
+	select {
+	case a.queue <- r:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of records discarded because the queue was full.
+func (a *AuditLogger) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// WriteErrors returns the number of records that could not be written to the underlying writer.
+func (a *AuditLogger) WriteErrors() uint64 {
+	return a.failed.Load()
+}
+
+// Close flushes queued records and stops the background writer. If the underlying writer is an
+// io.Closer, it is closed as well.
+func (a *AuditLogger) Close() error {
+	a.closeMu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.closeMu.Unlock()
+	<-a.done
+	if closer, ok := a.out.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (a *AuditLogger) run() {
+	defer close(a.done)
+	for r := range a.queue {
+		r.PrevHash = a.prevHash
+		hash, err := r.computeHash()
+		if err != nil {
+			a.failed.Add(1)
+			log.Error("Failed to encode audit record: %s", err)
+			continue
+		}
+		r.Hash = hash
+		line, err := json.Marshal(&r)
+		if err != nil {
+			a.failed.Add(1)
+			log.Error("Failed to encode audit record: %s", err)
+			continue
+		}
+		if _, err := a.out.Write(append(line, '\n')); err != nil {
+			a.failed.Add(1)
+			log.Error("Failed to write audit record: %s", err)
+			continue
+		}
+		a.prevHash = hash
+	}
+}
+
+// VerifyAuditChain reads JSON-line audit records from r and checks that each record's hash is
+// valid and matches the PrevHash of the record that follows it. It returns the number of records
+// that were verified.
+func VerifyAuditChain(r io.Reader) (int, error) {
+	decoder := json.NewDecoder(r)
+	prev := ""
+	count := 0
+	for decoder.More() {
+		var record AuditRecord
+		if err := decoder.Decode(&record); err != nil {
+			return count, fmt.Errorf("record %d: %w", count, err)
+		}
+		if count > 0 && record.PrevHash != prev {
+			return count, fmt.Errorf("record %d: hash chain broken", count)
+		}
+		hash, err := record.computeHash()
+		if err != nil {
+			return count, fmt.Errorf("record %d: %w", count, err)
+		}
+		if hash != record.Hash {
+			return count, fmt.Errorf("record %d: hash mismatch", count)
+		}
+		prev = record.Hash
+		count++
+	}
+	return count, nil
+}
+
+// maxAuditRecordBytes bounds the size of an encoded audit record, which is dominated by its
+// response (see maxAuditedResponse). JSON escaping can grow a response up to sixfold.
+const maxAuditRecordBytes = 6*maxAuditedResponse + 4<<10
+
+// lastAuditHash returns the hash of the last record in the audit log name, or "" if the file
+// doesn't exist or is empty. A logger that appends to the file continues the chain from there, so
+// that a restart doesn't look like tampering to VerifyAuditChain.
+func lastAuditHash(name string) (string, error) {
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() == 0 {
+		return "", nil
+	}
+	offset := max(0, info.Size()-maxAuditRecordBytes)
+	tail := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(tail, offset); err != nil {
+		return "", err
+	}
+	if tail[len(tail)-1] != '\n' {
+		return "", errors.New("last record is incomplete")
+	}
+	tail = tail[:len(tail)-1]
+	line := tail[bytes.LastIndexByte(tail, '\n')+1:]
+	if offset > 0 && len(line) == len(tail) {
+		return "", errors.New("last record is too long")
+	}
+	var record AuditRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return "", fmt.Errorf("last record is invalid: %w", err)
+	}
+	if hash, err := record.computeHash(); err != nil || hash != record.Hash {
+		return "", errors.New("last record's hash doesn't match its contents")
+	}
+	return record.Hash, nil
+}
+
+// RotatingFile is an append-only io.WriteCloser that renames the file to name.1 (shifting older
+// backups up to name.N) once it grows past MaxBytes.
+type RotatingFile struct {
+	name       string
+	maxBytes   int64
+	maxBackups int
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenRotatingFile opens (or creates) name for appending. A maxBytes of zero disables rotation.
+func OpenRotatingFile(name string, maxBytes int64, maxBackups int) (*RotatingFile, error) {
+	f := &RotatingFile{name: name, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", f.name, i), fmt.Sprintf("%s.%d", f.name, i+1))
+	}
+	if f.maxBackups > 0 {
+		if err := os.Rename(f.name, f.name+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.name); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the underlying file.
+func (f *RotatingFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.file.Close()
+}
+
+// WebhookWriter POSTs each Write call to a URL as an application/json request body.
+type WebhookWriter struct {
+	URL     string
+	Client  *http.Client
+	Timeout time.Duration
+}
+
+func (w *WebhookWriter) Write(p []byte) (int, error) {
+	timeout := w.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(p))
+	if err != nil {
+		return 0, redactURLError(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return 0, redactURLError(err)
+	}
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return 0, fmt.Errorf("audit webhook returned %s", rsp.Status)
+	}
+	return len(p), nil
+}
+
+// redactURLError removes credentials from the URL that err reports, since errors are logged.
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redact.URL(urlErr.URL)
+	}
+	return err
+}
+
+// redactedValue replaces the values of redacted response fields.
+const redactedValue = "[REDACTED]"
+
+// AuditRedactions lists the response fields that are redacted from audit records. Keys are command
+// names, or "*" for fields redacted from every command. Fields are JSON object keys, and are
+// redacted wherever they appear in the response, including nested objects and arrays.
+type AuditRedactions map[string][]string
+
+// DefaultAuditRedactions returns the redactions applied unless configured otherwise: vehicle
+// positions, wherever they appear, and the whole location reported by get_location.
+func DefaultAuditRedactions() AuditRedactions {
+	return AuditRedactions{
+		"*":            {"latitude", "longitude", "native_latitude", "native_longitude"},
+		"get_location": {"location"},
+	}
+}
+
+// ParseAuditRedactions parses a comma-separated list of fields to redact. A field may be prefixed
+// with a command name and a colon (e.g., "get_location:location") to redact it only from that
+// command's responses. The string "none" disables redaction.
+func ParseAuditRedactions(s string) (AuditRedactions, error) {
+	redactions := make(AuditRedactions)
+	if s == "none" {
+		return redactions, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		command, field, ok := strings.Cut(entry, ":")
+		if !ok {
+			command, field = "*", entry
+		}
+		if command == "" || field == "" {
+			return nil, fmt.Errorf("invalid audit redaction %q", entry)
+		}
+		redactions[command] = append(redactions[command], field)
+	}
+	return redactions, nil
+}
+
+// apply returns response with the fields configured for command redacted. Responses that aren't
+// valid JSON are dropped, since they can't be inspected.
+func (r AuditRedactions) apply(command string, response json.RawMessage) json.RawMessage {
+	if len(response) == 0 {
+		return nil
+	}
+	fields := make(map[string]bool)
+	for _, key := range []string{"*", command} {
+		for _, field := range r[key] {
+			fields[field] = true
+		}
+	}
+	var value interface{}
+	if err := json.Unmarshal(response, &value); err != nil {
+		return nil
+	}
+	if len(fields) == 0 {
+		return response
+	}
+	redacted, err := json.Marshal(redactFields(value, fields))
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+func redactFields(value interface{}, fields map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, member := range v {
+			if fields[key] {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactFields(member, fields)
+			}
+		}
+	case []interface{}:
+		for i, element := range v {
+			v[i] = redactFields(element, fields)
+		}
+	}
+	return value
+}
+
+// AuditConfig selects where audit records are written. At most one of Filename and WebhookURL may
+// be set.
+type AuditConfig struct {
+	Filename   string // Append JSON lines to this file.
+	MaxBytes   int64  // Rotate Filename once it exceeds this size. Zero disables rotation.
+	MaxBackups int    // Number of rotated files to keep.
+	WebhookURL string // POST each record to this URL.
+	QueueSize  int    // Maximum number of buffered records. Defaults to DefaultAuditQueueSize.
+	// Redactions replaces DefaultAuditRedactions if non-nil. Use an empty map to disable redaction.
+	Redactions AuditRedactions
+}
+
+// Open starts an AuditLogger using c. It returns nil (and no error) if auditing is not configured.
+// Records appended to an existing file continue its hash chain; Open fails if the file's last
+// record can't be verified, rather than starting a new chain that would hide tampering.
+func (c *AuditConfig) Open() (*AuditLogger, error) {
+	var out io.Writer
+	var prevHash string
+	switch {
+	case c.Filename != "" && c.WebhookURL != "":
+		return nil, fmt.Errorf("audit log file and webhook are mutually exclusive")
+	case c.Filename != "":
+		var err error
+		if prevHash, err = lastAuditHash(c.Filename); err != nil {
+			return nil, fmt.Errorf("couldn't continue hash chain of audit log %s: %w", c.Filename, err)
+		}
+		f, err := OpenRotatingFile(c.Filename, c.MaxBytes, c.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't open audit log: %w", err)
+		}
+		out = f
+	case c.WebhookURL != "":
+		out = &WebhookWriter{URL: c.WebhookURL}
+	default:
+		return nil, nil
+	}
+	logger := newAuditLogger(out, c.QueueSize, prevHash)
+	if c.Redactions != nil {
+		logger.Redactions = c.Redactions
+	}
+	return logger, nil
+}
+
+// requestID returns the client-supplied request ID, or generates a new one.
+func requestID(req *http.Request) string {
+	if id := req.Header.Get(requestIDHeader); id != "" {
+		return id
+	}
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf[:])
+}
+
+// requesterIdentity identifies the client for audit purposes: the CN of a verified client
+// certificate if present, and otherwise the subject of the OAuth token.
+func requesterIdentity(req *http.Request, subject string) string {
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		if cn := req.TLS.PeerCertificates[0].Subject.CommonName; cn != "" {
+			return "cn:" + cn
+		}
+	}
+	if subject != "" {
+		return "sub:" + subject
+	}
+	return ""
+}
+
+// maxAuditedResponse is the size of the largest response body included in an audit record.
+const maxAuditedResponse = 64 << 10
+
+// statusRecorder captures the status code written to an http.ResponseWriter, and the body if body
+// is non-nil.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	body   *bytes.Buffer
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	if s.body != nil {
+		if s.body.Len()+len(p) > maxAuditedResponse {
+			s.body = nil
+		} else {
+			s.body.Write(p)
+		}
+	}
+	return s.ResponseWriter.Write(p)
+}
+
+// response returns the "response" object of the recorded body, or nil if the body wasn't recorded
+// or isn't a JSON object with a response.
+func (s *statusRecorder) response() json.RawMessage {
+	if s.body == nil {
+		return nil
+	}
+	var reply struct {
+		Response json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(s.body.Bytes(), &reply); err != nil || string(reply.Response) == "null" {
+		return nil
+	}
+	return reply.Response
+}
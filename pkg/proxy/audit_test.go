@@ -0,0 +1,266 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+const testVIN = "5YJ3E1EA7KF000001"
+
+// testToken is an unsigned OAuth token that the proxy accepts as client credentials.
+var testToken = "header." + base64.RawStdEncoding.EncodeToString(
+	[]byte(`{"aud":["https://fleet-api.prd.na.vn.cloud.tesla.com"],"sub":"test-subject"}`)) + ".signature"
+
+func TestAuditHashChain(t *testing.T) {
+	var buf bytes.Buffer
+	audit := proxy.NewAuditLogger(&buf, 10)
+	for _, command := range []string{"door_lock", "door_unlock", "honk_horn"} {
+		audit.Record(proxy.AuditRecord{VIN: testVIN, Command: command, Outcome: proxy.AuditOutcomeSuccess})
+	}
+	if err := audit.Close(); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+
+	if strings.Contains(buf.String(), testVIN) {
+		t.Errorf("Audit log contains unredacted VIN")
+	}
+	count, err := proxy.VerifyAuditChain(bytes.NewReader(buf.Bytes()))
+	if err != nil || count != 3 {
+		t.Fatalf("Expected three valid records, got %d: %v", count, err)
+	}
+
+	// Dropping the second record should break the chain.
+	lines := strings.SplitAfter(buf.String(), "\n")
+	truncated := lines[0] + lines[2]
+	if _, err := proxy.VerifyAuditChain(strings.NewReader(truncated)); err == nil {
+		t.Errorf("Expected truncated log to fail verification")
+	}
+}
+
+func TestAuditHashChainAcrossRestarts(t *testing.T) {
+	config := &proxy.AuditConfig{Filename: filepath.Join(t.TempDir(), "audit.log")}
+	for _, command := range []string{"door_lock", "door_unlock"} {
+		audit, err := config.Open()
+		if err != nil {
+			t.Fatalf("Couldn't open audit log: %s", err)
+		}
+		audit.Record(proxy.AuditRecord{VIN: testVIN, Command: command, Outcome: proxy.AuditOutcomeSuccess})
+		audit.Record(proxy.AuditRecord{VIN: testVIN, Command: "honk_horn", Outcome: proxy.AuditOutcomeSuccess})
+		if err := audit.Close(); err != nil {
+			t.Fatalf("Close failed: %s", err)
+		}
+	}
+	contents, err := os.ReadFile(config.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := proxy.VerifyAuditChain(bytes.NewReader(contents)); err != nil || count != 4 {
+		t.Fatalf("Expected four valid records across restarts, got %d: %v", count, err)
+	}
+
+	// A process can't append to a log whose last record was altered.
+	tampered := bytes.Replace(contents, []byte(`"honk_horn"`), []byte(`"flash_lights"`), -1)
+	if err := os.WriteFile(config.Filename, tampered, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.Open(); err == nil {
+		t.Errorf("Opened audit log with a tampered last record")
+	}
+}
+
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (b *blockingWriter) Write(p []byte) (int, error) {
+	<-b.release
+	return len(p), nil
+}
+
+func TestAuditDropsWhenQueueFull(t *testing.T) {
+	writer := &blockingWriter{release: make(chan struct{})}
+	audit := proxy.NewAuditLogger(writer, 1)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		audit.Record(proxy.AuditRecord{Command: "honk_horn"})
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Record blocked on a slow writer")
+	}
+	close(writer.release)
+	audit.Close()
+
+	// One record may be held by the writer and one by the queue.
+	if dropped := audit.Dropped(); dropped < 8 {
+		t.Errorf("Expected at least 8 dropped records, got %d", dropped)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.log")
+	f, err := proxy.OpenRotatingFile(name, 10, 2)
+	if err != nil {
+		t.Fatalf("Couldn't open file: %s", err)
+	}
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+	}
+	f.Close()
+
+	expected := map[string]string{
+		name:        "dddddddd\n",
+		name + ".1": "cccccccc\n",
+		name + ".2": "bbbbbbbb\n",
+	}
+	for filename, contents := range expected {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Errorf("Couldn't read %s: %s", filename, err)
+		} else if string(data) != contents {
+			t.Errorf("Expected %s to contain %q, got %q", filename, contents, data)
+		}
+	}
+	if _, err := os.Stat(name + ".3"); err == nil {
+		t.Errorf("Expected oldest backup to be discarded")
+	}
+}
+
+func TestWebhookWriter(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		buf.ReadFrom(r.Body)
+		received <- buf.String()
+	}))
+	defer server.Close()
+
+	audit := proxy.NewAuditLogger(&proxy.WebhookWriter{URL: server.URL}, 1)
+	audit.Record(proxy.AuditRecord{Command: "door_lock"})
+	audit.Close()
+
+	select {
+	case body := <-received:
+		if !strings.Contains(body, `"command":"door_lock"`) {
+			t.Errorf("Unexpected webhook body: %s", body)
+		}
+	default:
+		t.Errorf("Webhook not called")
+	}
+	if audit.WriteErrors() != 0 {
+		t.Errorf("Unexpected write errors")
+	}
+}
+
+func TestProxyRecordsAuditEvents(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	p.Audit = proxy.NewAuditLogger(&buf, 10)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/1/vehicles/"+testVIN+"/command/door_unlock", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("X-Request-ID", "abc123")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	p.Audit.Close()
+
+	if w.Header().Get("X-Request-ID") != "abc123" {
+		t.Errorf("Request ID not echoed")
+	}
+	var record proxy.AuditRecord
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Couldn't parse audit record %q: %s", buf.String(), err)
+	}
+	if record.RequestID != "abc123" || record.Command != "door_unlock" || record.Status != http.StatusMethodNotAllowed ||
+		record.Outcome != proxy.AuditOutcomeFailure || record.Requester != "sub:test-subject" {
+		t.Errorf("Unexpected audit record: %+v", record)
+	}
+}
+
+func TestAuditRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	audit := proxy.NewAuditLogger(&buf, 10)
+	audit.Record(proxy.AuditRecord{
+		Command:  "get_location",
+		Response: json.RawMessage(`{"result":true,"location":{"latitude":37.4925,"longitude":-121.9447}}`),
+	})
+	audit.Record(proxy.AuditRecord{
+		Command:  "forwarded_command",
+		Response: json.RawMessage(`{"result":true,"drive_state":[{"latitude":37.4925,"native_longitude":-121.9447}]}`),
+	})
+	audit.Record(proxy.AuditRecord{Command: "honk_horn", Response: json.RawMessage(`not json`)})
+	audit.Close()
+
+	if strings.Contains(buf.String(), "37.49") || strings.Contains(buf.String(), "121.94") || strings.Contains(buf.String(), "not json") {
+		t.Errorf("Audit log contains redacted data: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"location":"[REDACTED]"`) || !strings.Contains(buf.String(), `"result":true`) {
+		t.Errorf("Unexpected audit log: %s", buf.String())
+	}
+	if count, err := proxy.VerifyAuditChain(bytes.NewReader(buf.Bytes())); err != nil || count != 3 {
+		t.Errorf("Expected three valid records, got %d: %v", count, err)
+	}
+}
+
+func TestParseAuditRedactions(t *testing.T) {
+	redactions, err := proxy.ParseAuditRedactions("reason, honk_horn:result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	audit := proxy.NewAuditLogger(&buf, 10)
+	audit.Redactions = redactions
+	audit.Record(proxy.AuditRecord{Command: "honk_horn", Response: json.RawMessage(`{"result":false,"reason":"busy"}`)})
+	audit.Record(proxy.AuditRecord{Command: "flash_lights", Response: json.RawMessage(`{"result":false,"latitude":1}`)})
+	audit.Close()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	// Custom redactions replace the defaults, so latitude is no longer redacted.
+	if len(lines) != 2 || !strings.Contains(lines[0], `"response":{"reason":"[REDACTED]","result":"[REDACTED]"}`) ||
+		!strings.Contains(lines[1], `"response":{"latitude":1,"result":false}`) {
+		t.Errorf("Unexpected audit log: %s", buf.String())
+	}
+
+	if none, err := proxy.ParseAuditRedactions("none"); err != nil || len(none) != 0 {
+		t.Errorf("Unexpected result for none: %v %v", none, err)
+	}
+	if _, err := proxy.ParseAuditRedactions("honk_horn:"); err == nil {
+		t.Errorf("Expected error for empty field")
+	}
+}
+
+func TestProxyRedactsAuditedResponses(t *testing.T) {
+	var buf bytes.Buffer
+	p, car := newTestProxy(t, true)
+	p.AllowLocation = true
+	p.Audit = proxy.NewAuditLogger(&buf, 10)
+	car.SetLocation(37.5, -122.25, 270, 25)
+
+	if code, reply := postCommand(t, p, "get_location", nil); code != http.StatusOK || reply.Response.Location == nil {
+		t.Fatalf("Unexpected response %d %+v", code, reply)
+	}
+	p.Audit.Close()
+
+	var record proxy.AuditRecord
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Couldn't parse audit record %q: %s", buf.String(), err)
+	}
+	if string(record.Response) != `{"location":"[REDACTED]","reason":"","result":true}` {
+		t.Errorf("Unexpected audited response %s", record.Response)
+	}
+}
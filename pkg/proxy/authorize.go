@@ -0,0 +1,202 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+)
+
+// CommandRequest describes a command that an Authorizer may permit or deny.
+type CommandRequest struct {
+	VIN     string
+	Command string
+	// Parameters holds the command's JSON body merged with its query parameters, if the command
+	// accepts them.
+	Parameters RequestParameters
+	// Identity identifies the client: "cn:" followed by the Common Name of a verified client
+	// certificate, or else "sub:" followed by the OAuth token's subject.
+	Identity string
+	// Subject is the OAuth token's subject, which may be empty.
+	Subject string
+	Header  http.Header
+	// Time is when the proxy received the request.
+	Time time.Time
+}
+
+// Authorizer enforces an application-specific policy on commands. The proxy calls Authorize before
+// sending a command to a vehicle or forwarding it to Fleet API, and rejects the command if it
+// returns an error. A *PolicyError results in 403 Forbidden with the error's message; other errors
+// result in 500 Internal Server Error.
+type Authorizer interface {
+	Authorize(ctx context.Context, req CommandRequest) error
+}
+
+// PolicyError indicates that an Authorizer denied a command.
+type PolicyError struct {
+	Message string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+var errAuthorizerFailed = errors.New("couldn't authorize command")
+
+// WithAuthorizer makes the proxy check each command with authorizer before dispatching it.
+func WithAuthorizer(authorizer Authorizer) Option {
+	return func(p *Proxy) {
+		p.authorizer = authorizer
+	}
+}
+
+// authorize checks a command against p.authorizer, if one is set. If the command is denied, it
+// writes an error response and returns the reason.
+func (p *Proxy) authorize(acct *account.Account, w http.ResponseWriter, req *http.Request, command, vin string) error {
+	if p.authorizer == nil {
+		return nil
+	}
+	params, err := commandParameters(req, command)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	err = p.authorizer.Authorize(ctx, CommandRequest{
+		VIN:        vin,
+		Command:    command,
+		Parameters: params,
+		Identity:   requesterIdentity(req, acct.Subject),
+		Subject:    acct.Subject,
+		Header:     req.Header.Clone(),
+		Time:       time.Now(),
+	})
+	var policyErr *PolicyError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &policyErr):
+		writeJSONError(w, http.StatusForbidden, policyErr)
+	default:
+		log.Error("Authorizer failed: %s", err)
+		writeJSONError(w, http.StatusInternalServerError, errAuthorizerFailed)
+	}
+	return err
+}
+
+// Policy is an Authorizer that permits a command if any of its rules match it. Commands that don't
+// match a rule are denied. Policies must be created with ParsePolicy or LoadPolicyFile.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyRule matches commands. Empty lists match any value.
+type PolicyRule struct {
+	// Identities lists client identities, in the format of CommandRequest.Identity.
+	Identities []string `json:"identities,omitempty"`
+	VINs       []string `json:"vins,omitempty"`
+	Commands   []string `json:"commands,omitempty"`
+	// Hours restricts the rule to a time of day. It matches at all times if nil.
+	Hours *PolicyHours `json:"hours,omitempty"`
+}
+
+// PolicyHours is a daily time window. If From is later than To, the window spans midnight.
+type PolicyHours struct {
+	From     string `json:"from"`                // Start time, as HH:MM
+	To       string `json:"to"`                  // End time (exclusive), as HH:MM
+	TimeZone string `json:"time_zone,omitempty"` // IANA time zone name; defaults to UTC
+
+	from, to time.Duration
+	location *time.Location
+}
+
+// ParsePolicy decodes a JSON-encoded Policy.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, err
+	}
+	for i, rule := range policy.Rules {
+		if rule.Hours == nil {
+			continue
+		}
+		if err := rule.Hours.parse(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return &policy, nil
+}
+
+// LoadPolicyFile reads a JSON-encoded Policy from filename.
+func LoadPolicyFile(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", filename, err)
+	}
+	return policy, nil
+}
+
+// Authorize returns a *PolicyError unless one of p's rules matches req.
+func (p *Policy) Authorize(_ context.Context, req CommandRequest) error {
+	for _, rule := range p.Rules {
+		if rule.matches(&req) {
+			return nil
+		}
+	}
+	return &PolicyError{Message: fmt.Sprintf("policy doesn't permit %s on this vehicle", req.Command)}
+}
+
+func (r *PolicyRule) matches(req *CommandRequest) bool {
+	matchesAny := func(values []string, value string) bool {
+		return len(values) == 0 || slices.Contains(values, value)
+	}
+	return matchesAny(r.Identities, req.Identity) &&
+		matchesAny(r.VINs, req.VIN) &&
+		matchesAny(r.Commands, req.Command) &&
+		(r.Hours == nil || r.Hours.contains(req.Time))
+}
+
+func (h *PolicyHours) parse() error {
+	var err error
+	if h.location, err = time.LoadLocation(h.TimeZone); err != nil {
+		return err
+	}
+	if h.from, err = parseTimeOfDay(h.From); err != nil {
+		return fmt.Errorf("invalid from time: %w", err)
+	}
+	if h.to, err = parseTimeOfDay(h.To); err != nil {
+		return fmt.Errorf("invalid to time: %w", err)
+	}
+	return nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (h *PolicyHours) contains(t time.Time) bool {
+	if h.location == nil {
+		return false
+	}
+	t = t.In(h.location)
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if h.from <= h.to {
+		return h.from <= offset && offset < h.to
+	}
+	return offset >= h.from || offset < h.to
+}
@@ -0,0 +1,105 @@
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+type authorizerFunc func(ctx context.Context, req proxy.CommandRequest) error
+
+func (f authorizerFunc) Authorize(ctx context.Context, req proxy.CommandRequest) error {
+	return f(ctx, req)
+}
+
+func TestAuthorizer(t *testing.T) {
+	var requests []proxy.CommandRequest
+	authorize := func(_ context.Context, req proxy.CommandRequest) error {
+		requests = append(requests, req)
+		switch req.Command {
+		case "door_unlock":
+			return &proxy.PolicyError{Message: "unlocking is not allowed"}
+		case "honk_horn":
+			return errors.New("policy service unavailable")
+		}
+		return nil
+	}
+	p, car := newTestProxy(t, true, proxy.WithAuthorizer(authorizerFunc(authorize)))
+
+	code, reply := postCommand(t, p, "set_charge_limit", map[string]interface{}{"percent": 70.0})
+	if code != http.StatusOK || !reply.Response.Result || car.ChargeLimit() != 70 {
+		t.Fatalf("Permitted command failed: %d %+v", code, reply)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("Expected one authorization request, got %d", len(requests))
+	}
+	req := requests[0]
+	if req.VIN != testVIN || req.Command != "set_charge_limit" || req.Parameters["percent"] != 70.0 ||
+		req.Identity != "sub:test-subject" || req.Header.Get("Authorization") == "" || req.Time.IsZero() {
+		t.Errorf("Unexpected authorization request %+v", req)
+	}
+
+	before := len(car.Commands())
+	code, reply = postCommand(t, p, "door_unlock", nil)
+	if code != http.StatusForbidden || !strings.Contains(reply.Error, "unlocking is not allowed") {
+		t.Errorf("Unexpected response to denied command: %d %+v", code, reply)
+	}
+	if code, _ = postCommand(t, p, "honk_horn", nil); code != http.StatusInternalServerError {
+		t.Errorf("Expected authorizer failure to return 500, got %d", code)
+	}
+	if len(car.Commands()) != before || !car.Locked() {
+		t.Errorf("Denied commands reached the vehicle")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy, err := proxy.ParsePolicy([]byte(`{"rules": [
+		{"identities": ["sub:driver"], "vins": ["` + testVIN + `"], "commands": ["door_lock", "door_unlock"],
+		 "hours": {"from": "08:00", "to": "18:00", "time_zone": "America/Los_Angeles"}},
+		{"identities": ["cn:night-shift"], "hours": {"from": "22:00", "to": "06:00"}},
+		{"identities": ["sub:admin"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 17:00 UTC is 09:00 or 10:00 in Los Angeles.
+	day := time.Date(2025, time.March, 3, 17, 0, 0, 0, time.UTC)
+	night := time.Date(2025, time.March, 3, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		identity, vin, command string
+		at                     time.Time
+		permitted              bool
+	}{
+		{"sub:driver", testVIN, "door_lock", day, true},
+		{"sub:driver", testVIN, "door_lock", night.Add(4 * time.Hour), false},
+		{"sub:driver", testVIN, "honk_horn", day, false},
+		{"sub:driver", "5YJ3E1EA7KF000002", "door_lock", day, false},
+		{"cn:night-shift", testVIN, "honk_horn", night, true},
+		{"cn:night-shift", testVIN, "honk_horn", day, false},
+		{"sub:admin", testVIN, "door_unlock", night, true},
+		{"sub:stranger", testVIN, "door_lock", day, false},
+	}
+	for _, test := range tests {
+		err := policy.Authorize(context.Background(), proxy.CommandRequest{
+			Identity: test.identity,
+			VIN:      test.vin,
+			Command:  test.command,
+			Time:     test.at,
+		})
+		var policyErr *proxy.PolicyError
+		if test.permitted && err != nil {
+			t.Errorf("%+v: unexpected error %s", test, err)
+		} else if !test.permitted && !errors.As(err, &policyErr) {
+			t.Errorf("%+v: expected PolicyError, got %v", test, err)
+		}
+	}
+
+	if _, err := proxy.ParsePolicy([]byte(`{"rules": [{"hours": {"from": "8am", "to": "18:00"}}]}`)); err == nil {
+		t.Errorf("Expected error for invalid hours")
+	}
+}
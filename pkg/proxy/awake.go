@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+)
+
+// vehicleAwake is the response to GET /api/1/vehicles/{VIN}/awake.
+type vehicleAwake struct {
+	Awake bool `json:"awake"`
+}
+
+// handleVehicleAwake reports whether vin is awake. Unlike wake_up, checking doesn't wake the vehicle
+// or count against the account's wake quota.
+func (p *Proxy) handleVehicleAwake(acct *account.Account, w http.ResponseWriter, vin string) {
+	if len(vin) != vinLength {
+		writeJSONError(w, http.StatusNotFound, errors.New("expected 17-character VIN or numeric vehicle ID in path"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	awake, err := p.probeAwake(ctx, acct, vin)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: &vehicleAwake{Awake: awake}})
+}
+
+func (p *Proxy) probeAwake(ctx context.Context, acct *account.Account, vin string) (bool, error) {
+	car, err := p.getVehicle(ctx, acct, vin)
+	if err != nil {
+		return false, err
+	}
+	if err := car.Connect(ctx); err != nil {
+		return false, err
+	}
+	defer car.Disconnect()
+	return car.IsAwake(ctx)
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// basePath returns p.BasePath without a trailing slash, or "" if the proxy serves its routes at
+// the root.
+func (p *Proxy) basePath() string {
+	return strings.TrimSuffix(p.BasePath, "/")
+}
+
+// stripBasePath returns a shallow copy of req with p.BasePath removed from its path, as
+// http.StripPrefix does, so that the access log still records the path the client requested. If
+// the path is outside the base path, it writes a 404 response and returns nil.
+func (p *Proxy) stripBasePath(w http.ResponseWriter, req *http.Request) *http.Request {
+	base := p.basePath()
+	if base == "" {
+		return req
+	}
+	path, ok := cutBasePath(req.URL.Path, base)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("%s is outside the proxy's base path %s", req.URL.Path, base))
+		return nil
+	}
+	stripped := new(http.Request)
+	*stripped = *req
+	stripped.URL = new(url.URL)
+	*stripped.URL = *req.URL
+	stripped.URL.Path = path
+	// RawPath is only set when the path contains escaped characters. If they're in the base path,
+	// the path is re-escaped from Path when it's needed.
+	stripped.URL.RawPath, ok = cutBasePath(req.URL.RawPath, base)
+	if !ok {
+		stripped.URL.RawPath = ""
+	}
+	return stripped
+}
+
+// cutBasePath returns path without base, which must be followed by a slash or end the path. The
+// base path itself maps to "/".
+func cutBasePath(path, base string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, base)
+	if !ok || (rest != "" && rest[0] != '/') {
+		return "", false
+	}
+	if rest == "" {
+		return "/", true
+	}
+	return rest, true
+}
@@ -0,0 +1,64 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBasePath(t *testing.T) {
+	p, dialed := newDialRecordingProxy(t)
+	p.BasePath = "/tesla/"
+	p.AdminToken = []byte("admin-token")
+	p.MetricsToken = []byte(testMetricsToken)
+	p.EnableUI = true
+	send := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		if strings.Contains(path, "/admin/") {
+			req.Header.Set("Authorization", "Bearer admin-token")
+		} else if strings.HasSuffix(path, "/metrics") {
+			req.Header.Set("Authorization", "Bearer "+testMetricsToken)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{"/tesla/health", "/tesla/metrics", "/tesla/admin/config", "/tesla/api/1/commands"} {
+		if w := send(http.MethodGet, path); w.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+	if w := send(http.MethodGet, "/tesla/admin/config"); !strings.Contains(w.Body.String(), `"base_path":"/tesla"`) {
+		t.Errorf("Admin config doesn't include base path: %s", w.Body.String())
+	}
+	if w := send(http.MethodPost, "/tesla/api/1/vehicles/"+testVIN+"/command/door_lock"); w.Code != http.StatusOK {
+		t.Errorf("Command under base path failed with status %d: %s", w.Code, w.Body.String())
+	}
+	dials := len(*dialed)
+
+	for _, path := range []string{
+		"/health",
+		"/api/1/vehicles/" + testVIN + "/command/door_lock",
+		"/teslafoo/health",
+		"/other/tesla/health",
+	} {
+		w := send(http.MethodPost, path)
+		if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "outside the proxy's base path /tesla") {
+			t.Errorf("%s: expected 404 outside base path, got %d: %s", path, w.Code, w.Body.String())
+		}
+	}
+	if len(*dialed) != dials {
+		t.Errorf("Proxy connected to a vehicle for a request outside the base path")
+	}
+
+	// The UI redirects to a URL that the ingress forwards back to the proxy.
+	if w := send(http.MethodGet, "/tesla/ui"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/tesla/ui/" {
+		t.Errorf("Expected redirect to /tesla/ui/, got %d %v", w.Code, w.Header())
+	}
+	if w := send(http.MethodGet, "/tesla/ui/app.js"); w.Code != http.StatusOK {
+		t.Errorf("Expected UI asset under base path, got %d", w.Code)
+	}
+}
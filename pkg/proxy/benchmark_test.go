@@ -0,0 +1,44 @@
+package proxy_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Benchmarks for commands sent through the proxy to an in-memory vehicle. Run with:
+//
+//	go test -run '^$' -bench . -benchmem ./pkg/proxy
+
+// BenchmarkCommandWarmVIN measures commands to a vehicle the proxy already has a session with.
+func BenchmarkCommandWarmVIN(b *testing.B) {
+	p, _ := newTestProxy(b, true)
+	if code, _ := postCommand(b, p, "flash_lights", nil); code != http.StatusOK {
+		b.Fatalf("Command failed with status %d", code)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if code, _ := postCommand(b, p, "flash_lights", nil); code != http.StatusOK {
+			b.Fatalf("Command failed with status %d", code)
+		}
+	}
+}
+
+// BenchmarkCommandColdVIN measures commands that start with a handshake, because the proxy's
+// sessions with the vehicle were reset.
+func BenchmarkCommandColdVIN(b *testing.B) {
+	p, _ := newTestProxy(b, true)
+	p.AdminToken = []byte("admin-token")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		if code := resetSession(p, "admin-token", testVIN); code != http.StatusOK && code != http.StatusNotFound {
+			b.Fatalf("Reset failed with status %d", code)
+		}
+		b.StartTimer()
+		if code, _ := postCommand(b, p, "flash_lights", nil); code != http.StatusOK {
+			b.Fatalf("Command failed with status %d", code)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+)
+
+const (
+	bulkChargeLimitPath = "/api/1/bulk/set_charge_limit"
+	// maxBulkVehicles limits the number of vehicles in one bulk request.
+	maxBulkVehicles = 500
+	// maxBulkBodyBytes limits the size of a bulk request's body. It comfortably fits
+	// maxBulkVehicles VINs with overrides.
+	maxBulkBodyBytes = 64 << 10
+	// bulkConcurrency is the number of vehicles a bulk request sends commands to at once.
+	bulkConcurrency = 16
+
+	// Charge limits that vehicles accept, in percent.
+	minChargeLimit = 50
+	maxChargeLimit = 100
+)
+
+// BulkChargeLimitRequest is the body of POST /api/1/bulk/set_charge_limit. Each vehicle in VINs
+// is set to Percent, and each vehicle in Overrides is set to its own limit.
+type BulkChargeLimitRequest struct {
+	Percent   *int           `json:"percent,omitempty"`
+	VINs      []string       `json:"vins,omitempty"`
+	Overrides map[string]int `json:"overrides,omitempty"`
+}
+
+// BulkChargeLimitResult is the outcome of setting one vehicle's charge limit in a bulk request.
+// Status and Body are the status code and body that the equivalent set_charge_limit request
+// would have received.
+type BulkChargeLimitResult struct {
+	Percent int             `json:"percent"`
+	Status  int             `json:"status"`
+	Body    json.RawMessage `json:"body"`
+}
+
+// BulkChargeLimitResponse is the "response" object of a bulk charge limit request.
+type BulkChargeLimitResponse struct {
+	Succeeded int                               `json:"succeeded"`
+	Failed    int                               `json:"failed"`
+	Results   map[string]*BulkChargeLimitResult `json:"results"`
+}
+
+// limits returns the charge limit requested for each vehicle.
+func (r *BulkChargeLimitRequest) limits() (map[string]int, error) {
+	limits := make(map[string]int, len(r.VINs)+len(r.Overrides))
+	if len(r.VINs) > 0 && r.Percent == nil {
+		return nil, errors.New("percent is required when vins is set")
+	}
+	for _, vin := range r.VINs {
+		if _, ok := limits[vin]; ok {
+			return nil, fmt.Errorf("vehicle %s is listed more than once", vin)
+		}
+		limits[vin] = *r.Percent
+	}
+	for vin, percent := range r.Overrides {
+		if _, ok := limits[vin]; ok {
+			return nil, fmt.Errorf("vehicle %s is listed in both vins and overrides", vin)
+		}
+		limits[vin] = percent
+	}
+	if len(limits) == 0 {
+		return nil, errors.New("no vehicles in request")
+	}
+	if len(limits) > maxBulkVehicles {
+		return nil, fmt.Errorf("request includes %d vehicles; the limit is %d", len(limits), maxBulkVehicles)
+	}
+	return limits, nil
+}
+
+// validateChargeLimit returns an error if a vehicle can't be sent a charge limit of percent.
+func validateChargeLimit(vin string, percent int) error {
+	if len(vin) != vinLength {
+		return errors.New("expected 17-character VIN")
+	}
+	if percent < minChargeLimit || percent > maxChargeLimit {
+		return fmt.Errorf("percent must be between %d and %d", minChargeLimit, maxChargeLimit)
+	}
+	return nil
+}
+
+// handleBulkChargeLimit sets the charge limit of several vehicles concurrently. Each vehicle's
+// command goes through the same checks, auditing, and error handling as an individual
+// set_charge_limit request, and its result is reported separately. The response is 200 OK unless
+// the request itself is malformed, even if some or all vehicles fail.
+func (p *Proxy) handleBulkChargeLimit(acct *account.Account, w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBulkBodyBytes+1))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, errors.New("could not read request body"))
+		return
+	}
+	if len(body) > maxBulkBodyBytes {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", maxBulkBodyBytes))
+		return
+	}
+	var bulk BulkChargeLimitRequest
+	if err := json.Unmarshal(body, &bulk); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	limits, err := bulk.limits()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	vins := make([]string, 0, len(limits))
+	for vin := range limits {
+		vins = append(vins, vin)
+	}
+	sort.Strings(vins)
+	id := requestID(req)
+	w.Header().Set(requestIDHeader, id)
+	log.Info("Setting charge limit of %d vehicles", len(vins))
+
+	results := make([]*BulkChargeLimitResult, len(vins))
+	group := p.newRequestGroup(req.Context(), bulkConcurrency)
+	for i, vin := range vins {
+		err := group.Go(func() {
+			results[i] = p.setChargeLimit(acct, req, vin, limits[vin], id+"-"+strconv.Itoa(i))
+		})
+		if err != nil {
+			// The client is gone, so the remaining vehicles aren't sent commands.
+			results[i] = &BulkChargeLimitResult{Percent: limits[vin]}
+			results[i].Status, results[i].Body = subRequestError(statusClientClosedRequest, errClientClosedRequest)
+		}
+	}
+	group.Wait()
+
+	reply := BulkChargeLimitResponse{Results: make(map[string]*BulkChargeLimitResult, len(vins))}
+	for i, vin := range vins {
+		reply.Results[vin] = results[i]
+		if subCommandSucceeded(results[i].Status, results[i].Body) {
+			reply.Succeeded++
+		} else {
+			reply.Failed++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: &reply})
+}
+
+// setChargeLimit executes one vehicle's part of a bulk request as if it had been sent to
+// /api/1/vehicles/{vin}/command/set_charge_limit.
+func (p *Proxy) setChargeLimit(acct *account.Account, req *http.Request, vin string, percent int, id string) *BulkChargeLimitResult {
+	result := &BulkChargeLimitResult{Percent: percent}
+	if err := validateChargeLimit(vin, percent); err != nil {
+		result.Status, result.Body = subRequestError(http.StatusBadRequest, err)
+	} else {
+		params, _ := json.Marshal(map[string]int{"percent": percent})
+		result.Status, result.Body = p.executeSubCommand(acct, req, vin, "set_charge_limit", params, id)
+	}
+	return result
+}
+
+// executeSubCommand executes command as if params had been sent to
+// /api/1/vehicles/{vin}/command/{command} with req's method and headers, and returns the status
+// code and body of the response. It's used by requests that combine several commands.
+func (p *Proxy) executeSubCommand(acct *account.Account, req *http.Request, vin, command string, params []byte, id string) (int, json.RawMessage) {
+	// Commands are executed to completion once they've started, but no more are started for a
+	// client that has gone away.
+	if req.Context().Err() != nil {
+		return subRequestError(statusClientClosedRequest, errClientClosedRequest)
+	}
+	result := &bufferedResponse{header: make(http.Header)}
+	rec := &statusRecorder{ResponseWriter: result}
+	sub := req.Clone(req.Context())
+	sub.URL.Path = "/api/1/vehicles/" + vin + "/command/" + command
+	sub.URL.RawPath = ""
+	sub.URL.RawQuery = ""
+	sub.RequestURI = sub.URL.RequestURI()
+	sub.Body = io.NopCloser(bytes.NewReader(params))
+	sub.ContentLength = int64(len(params))
+	func() {
+		defer p.recoverPanic(rec, sub)
+		p.executeCommand(acct, rec, sub, command, vin, id)
+	}()
+	return subResponse(rec, result)
+}
+
+// subCommandSucceeded returns true if status and body, as returned by executeSubCommand, report
+// success. A vehicle that refuses a command yields 200 OK with a "result" of false, which is a
+// failure.
+func subCommandSucceeded(status int, body json.RawMessage) bool {
+	if status != http.StatusOK {
+		return false
+	}
+	var reply struct {
+		Response struct {
+			Result *bool `json:"result"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		// Responses forwarded from Fleet API needn't have a result.
+		return true
+	}
+	return reply.Response.Result == nil || *reply.Response.Result
+}
+
+// subRequestError returns the status code and body of an error response to a command that
+// executeSubCommand would otherwise have executed.
+func subRequestError(code int, err error) (int, json.RawMessage) {
+	result := &bufferedResponse{header: make(http.Header)}
+	rec := &statusRecorder{ResponseWriter: result}
+	writeJSONError(rec, code, err)
+	return subResponse(rec, result)
+}
+
+// subResponse returns the status code and body written to rec, which wraps result. A body that
+// isn't JSON is returned as a JSON string.
+func subResponse(rec *statusRecorder, result *bufferedResponse) (int, json.RawMessage) {
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	body := bytes.TrimSpace(result.body.Bytes())
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+	return status, body
+}
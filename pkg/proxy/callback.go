@@ -0,0 +1,306 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+)
+
+const (
+	// DefaultCallbackAttempts is the number of times the proxy tries to deliver a callback.
+	DefaultCallbackAttempts = 5
+	// DefaultCallbackRetryInterval is the delay before the first callback retry. The delay doubles
+	// after each failed attempt.
+	DefaultCallbackRetryInterval = 2 * time.Second
+
+	// CallbackSignatureHeader contains "sha256=" followed by the hex-encoded HMAC-SHA256 of the
+	// callback request body, keyed with [CallbackConfig.SigningKey].
+	CallbackSignatureHeader = "X-Callback-Signature"
+
+	callbackURLParameter = "callback_url"
+)
+
+var (
+	errCallbacksDisabled = errors.New("callback_url is not supported because the proxy has no callback signing key")
+	errCallbackHost      = errors.New("callback_url host is not allowed")
+	errCallbackNotPublic = errors.New("callback_url must not resolve to a loopback, private, or link-local address")
+)
+
+// CallbackConfig controls how the proxy delivers the results of asynchronous commands.
+type CallbackConfig struct {
+	// SigningKey authenticates callback requests. Requests that include a callback_url are
+	// rejected if it's empty.
+	SigningKey []byte
+	// Attempts is the maximum number of delivery attempts.
+	Attempts int
+	// RetryInterval is the delay before the first retry.
+	RetryInterval time.Duration
+	// AllowedHosts, if non-empty, are the only hosts that callback_url may name. Callbacks are
+	// otherwise sent only to public addresses, so that clients can't use the proxy to reach
+	// services on its network; listing a host here also allows it to resolve to a loopback,
+	// private, or link-local address.
+	AllowedHosts []string
+
+	clientOnce sync.Once
+	client     *http.Client
+}
+
+// allowsHost returns true if host is one of c.AllowedHosts.
+func (c *CallbackConfig) allowsHost(host string) bool {
+	return slices.ContainsFunc(c.AllowedHosts, func(allowed string) bool {
+		return strings.EqualFold(allowed, host)
+	})
+}
+
+// isPublicAddr returns false for addresses that callbacks shouldn't reach unless their host is in
+// CallbackConfig.AllowedHosts, including the link-local addresses of cloud metadata services.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// checkURL returns an error if the proxy shouldn't send callbacks to u. Hostnames are checked
+// again when they're resolved, since their addresses can change.
+func (c *CallbackConfig) checkURL(u *url.URL) error {
+	host := u.Hostname()
+	if c.allowsHost(host) {
+		return nil
+	}
+	if len(c.AllowedHosts) > 0 {
+		return errCallbackHost
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !isPublicAddr(addr) {
+		return errCallbackNotPublic
+	}
+	return nil
+}
+
+// httpClient returns the client that sends callbacks. It doesn't follow redirects, which could
+// lead to hosts that checkURL would reject, and it refuses to connect to non-public addresses
+// unless the callback's host is in c.AllowedHosts.
+func (c *CallbackConfig) httpClient() *http.Client {
+	c.clientOnce.Do(func() {
+		dialer := &net.Dialer{Timeout: DefaultTimeout}
+		publicDialer := &net.Dialer{
+			Timeout: DefaultTimeout,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				addrPort, err := netip.ParseAddrPort(address)
+				if err != nil || !isPublicAddr(addrPort.Addr()) {
+					return errCallbackNotPublic
+				}
+				return nil
+			},
+		}
+		c.client = &http.Client{
+			Timeout: DefaultTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Transport: &http.Transport{
+				// An environment proxy would make the connection, so its address couldn't be checked.
+				Proxy: nil,
+				DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+					host, _, err := net.SplitHostPort(address)
+					if err == nil && c.allowsHost(host) {
+						return dialer.DialContext(ctx, network, address)
+					}
+					return publicDialer.DialContext(ctx, network, address)
+				},
+				TLSHandshakeTimeout: DefaultTimeout,
+				// Callbacks are infrequent and go to many hosts, so connections aren't kept.
+				DisableKeepAlives: true,
+			},
+		}
+	})
+	return c.client
+}
+
+// CallbackPayload is the JSON body the proxy POSTs to a command's callback_url once the command
+// finishes.
+type CallbackPayload struct {
+	RequestID string    `json:"request_id"`
+	VIN       string    `json:"vin"`
+	Command   string    `json:"command"`
+	Timestamp time.Time `json:"timestamp"`
+	// Status and Body are the HTTP status code and JSON body that the proxy would have returned if
+	// the request had not included a callback_url.
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// SignCallback returns the value of the CallbackSignatureHeader for body.
+func SignCallback(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCallback checks that signature, the value of a callback's CallbackSignatureHeader, matches
+// body.
+func VerifyCallback(key, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignCallback(key, body)), []byte(signature))
+}
+
+// extractCallbackURL removes the callback_url parameter from the JSON body of req, if present, and
+// returns its value if callbacks allows it. The body is left unchanged if it isn't a JSON object so that the usual
+// parameter parsing can report the error.
+func extractCallbackURL(req *http.Request, callbacks *CallbackConfig) (string, error) {
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", errors.New("could not read request body")
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(body, &params); err != nil {
+		return "", nil
+	}
+	raw, ok := params[callbackURLParameter]
+	if !ok {
+		return "", nil
+	}
+	var callbackURL string
+	if err := json.Unmarshal(raw, &callbackURL); err != nil {
+		return "", errors.New("callback_url must be a string")
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("callback_url must be an absolute http or https URL")
+	}
+	if err := callbacks.checkURL(u); err != nil {
+		return "", err
+	}
+
+	delete(params, callbackURLParameter)
+	if body, err = json.Marshal(params); err != nil {
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return callbackURL, nil
+}
+
+// handleAsyncCommand accepts a command with a callback_url. It replies with 202 Accepted, executes
+// the command in the background, and then POSTs the result to callbackURL.
+func (p *Proxy) handleAsyncCommand(acct *account.Account, w http.ResponseWriter, req *http.Request, command, vin, id, callbackURL string) {
+	// The background work keeps the request's admission slot, but the request's context and body
+	// don't outlive this handler.
+	releaseAdmission := handOffAdmission(req.Context())
+	req = req.Clone(context.Background())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(&Response{Response: map[string]string{"request_id": id}})
+
+	p.metrics.requestsInFlight.Add(1)
+	p.goRequest(func() {
+		defer p.metrics.requestsInFlight.Add(-1)
+		defer releaseAdmission()
+		result := &bufferedResponse{header: make(http.Header)}
+		rec := &statusRecorder{ResponseWriter: result}
+		func() {
+			defer p.recoverPanic(rec, req)
+			p.executeCommand(acct, rec, req, command, vin, id)
+		}()
+
+		payload := &CallbackPayload{
+			RequestID: id,
+			VIN:       vin,
+			Command:   command,
+			Timestamp: time.Now(),
+			Status:    rec.status,
+			Body:      bytes.TrimSpace(result.body.Bytes()),
+		}
+		if payload.Status == 0 {
+			payload.Status = http.StatusOK
+		}
+		if !json.Valid(payload.Body) {
+			payload.Body, _ = json.Marshal(string(payload.Body))
+		}
+		if err := p.Callbacks.deliver(p.clock, callbackURL, payload); err != nil {
+			log.Error("Couldn't deliver result of request %s to callback: %s", id, err)
+		}
+	})
+}
+
+func (c *CallbackConfig) deliver(clk clock.Clock, callbackURL string, payload *CallbackPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	attempts := max(c.Attempts, 1)
+	delay := c.RetryInterval
+	for attempt := 1; ; attempt++ {
+		retry, err := c.post(callbackURL, payload.RequestID, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == attempts {
+			return err
+		}
+		log.Warning("Callback for request %s failed (attempt %d of %d): %s", payload.RequestID, attempt, attempts, err)
+		<-clk.After(delay)
+		delay *= 2
+	}
+}
+
+// post sends one callback request. It returns true if a failed request should be retried.
+func (c *CallbackConfig) post(callbackURL, id string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestIDHeader, id)
+	req.Header.Set(CallbackSignatureHeader, SignCallback(c.SigningKey, body))
+	rsp, err := c.httpClient().Do(req)
+	if err != nil {
+		return !errors.Is(err, errCallbackNotPublic), err
+	}
+	_, _ = io.Copy(io.Discard, rsp.Body)
+	rsp.Body.Close()
+	if rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("callback returned %s", rsp.Status)
+	// Other client errors won't go away by trying again.
+	retry := rsp.StatusCode >= 500 || rsp.StatusCode == http.StatusRequestTimeout || rsp.StatusCode == http.StatusTooManyRequests
+	return retry, err
+}
+
+// bufferedResponse is an http.ResponseWriter that stores the response body in memory.
+type bufferedResponse struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(int) {}
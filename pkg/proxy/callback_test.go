@@ -0,0 +1,226 @@
+package proxy_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+var testCallbackKey = []byte("callback secret")
+
+// callbackReceiver returns a server that fails the first failures requests with 503 and sends the
+// payloads of later requests to the returned channel.
+func callbackReceiver(t *testing.T, failures int32) (*httptest.Server, <-chan *proxy.CallbackPayload) {
+	t.Helper()
+	payloads := make(chan *proxy.CallbackPayload, 1)
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !proxy.VerifyCallback(testCallbackKey, body, req.Header.Get(proxy.CallbackSignatureHeader)) {
+			t.Errorf("Invalid callback signature")
+		}
+		var payload proxy.CallbackPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Invalid callback payload %q: %s", body, err)
+		}
+		payloads <- &payload
+	}))
+	t.Cleanup(server.Close)
+	return server, payloads
+}
+
+func postAsyncCommand(t *testing.T, p *proxy.Proxy, command string, params map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/"+command, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	return w
+}
+
+func waitForCallback(t *testing.T, payloads <-chan *proxy.CallbackPayload) *proxy.CallbackPayload {
+	t.Helper()
+	select {
+	case payload := <-payloads:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for callback")
+	}
+	return nil
+}
+
+func TestAsyncCommand(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	p.Callbacks.SigningKey = testCallbackKey
+	p.Callbacks.RetryInterval = time.Millisecond
+	p.Callbacks.AllowedHosts = []string{"127.0.0.1"}
+	server, payloads := callbackReceiver(t, 2)
+
+	w := postAsyncCommand(t, p, "set_charge_limit", map[string]interface{}{
+		"percent":      70,
+		"callback_url": server.URL,
+	})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body)
+	}
+	var accepted struct {
+		Response struct {
+			RequestID string `json:"request_id"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &accepted); err != nil || accepted.Response.RequestID == "" {
+		t.Fatalf("Unexpected response %s (%v)", w.Body, err)
+	}
+
+	payload := waitForCallback(t, payloads)
+	if payload.RequestID != accepted.Response.RequestID || payload.VIN != testVIN || payload.Command != "set_charge_limit" {
+		t.Errorf("Unexpected callback payload: %+v", payload)
+	}
+	var reply commandResponse
+	if err := json.Unmarshal(payload.Body, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Status != http.StatusOK || reply.Response == nil || !reply.Response.Result {
+		t.Errorf("Unexpected command result %d %s", payload.Status, payload.Body)
+	}
+	if car.ChargeLimit() != 70 {
+		t.Errorf("Expected charge limit 70, got %d", car.ChargeLimit())
+	}
+}
+
+func TestAsyncCommandFailure(t *testing.T) {
+	p, _ := newTestProxy(t, false)
+	p.Callbacks.SigningKey = testCallbackKey
+	p.Callbacks.AllowedHosts = []string{"127.0.0.1"}
+	server, payloads := callbackReceiver(t, 0)
+
+	if w := postAsyncCommand(t, p, "flash_lights", map[string]interface{}{"callback_url": server.URL}); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", w.Code)
+	}
+	if payload := waitForCallback(t, payloads); payload.Status != http.StatusInternalServerError {
+		t.Errorf("Expected failure to be reported, got %d %s", payload.Status, payload.Body)
+	}
+}
+
+func TestAsyncCommandRejected(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	tests := []struct {
+		key         []byte
+		callbackURL interface{}
+	}{
+		{nil, "https://example.com/done"},
+		{testCallbackKey, "/done"},
+		{testCallbackKey, "ftp://example.com/done"},
+		{testCallbackKey, 42},
+		{testCallbackKey, "http://127.0.0.1:8080/done"},
+		{testCallbackKey, "http://[::1]/done"},
+		{testCallbackKey, "http://10.1.2.3/done"},
+		{testCallbackKey, "http://169.254.169.254/latest/meta-data/"},
+		{testCallbackKey, "http://[::ffff:192.168.0.1]/done"},
+	}
+	for _, test := range tests {
+		p.Callbacks.SigningKey = test.key
+		w := postAsyncCommand(t, p, "flash_lights", map[string]interface{}{"callback_url": test.callbackURL})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected callback_url %v to be rejected, got %d", test.callbackURL, w.Code)
+		}
+	}
+	p.Callbacks.AllowedHosts = []string{"callbacks.example.com"}
+	if w := postAsyncCommand(t, p, "flash_lights", map[string]interface{}{"callback_url": "https://example.com/done"}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected host outside AllowedHosts to be rejected, got %d", w.Code)
+	}
+	if len(car.Commands()) != 0 {
+		t.Errorf("Vehicle received a rejected command")
+	}
+}
+
+func TestAsyncCommandCallbackTargets(t *testing.T) {
+	p, _ := newTestProxy(t, true)
+	p.Callbacks.SigningKey = testCallbackKey
+	var internalCalls atomic.Int32
+	internal := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		internalCalls.Add(1)
+	}))
+	defer internal.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, internal.URL, http.StatusTemporaryRedirect)
+	}))
+	defer redirect.Close()
+
+	// A hostname that resolves to a loopback address is refused when the callback is sent.
+	_, port, _ := net.SplitHostPort(internal.Listener.Addr().String())
+	if w := postAsyncCommand(t, p, "flash_lights", map[string]interface{}{"callback_url": "http://localhost:" + port}); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", w.Code)
+	}
+	waitFor(t, func() bool { return p.RequestsInFlight() == 0 })
+
+	// Redirects aren't followed, even from an allowed host.
+	p.Callbacks.AllowedHosts = []string{"127.0.0.1"}
+	if w := postAsyncCommand(t, p, "flash_lights", map[string]interface{}{"callback_url": redirect.URL}); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", w.Code)
+	}
+	waitFor(t, func() bool { return p.RequestsInFlight() == 0 })
+
+	if n := internalCalls.Load(); n != 0 {
+		t.Errorf("Callback reached an internal server %d times", n)
+	}
+}
+
+func TestAsyncCommandAdmission(t *testing.T) {
+	p, _ := newTestProxy(t, true)
+	p.Callbacks.SigningKey = testCallbackKey
+	p.Callbacks.AllowedHosts = []string{"127.0.0.1"}
+	p.MaxConcurrentRequests = 1
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	if w := postAsyncCommand(t, p, "flash_lights", map[string]interface{}{"callback_url": server.URL}); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", w.Code)
+	}
+	// The command keeps its slot until the callback is delivered.
+	if w := sendLock(p); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 while an asynchronous command is in progress, got %d", w.Code)
+	}
+	close(release)
+	waitFor(t, func() bool { return p.RequestsInFlight() == 0 })
+	if w := sendLock(p); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 after the callback was delivered, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestVerifyCallback(t *testing.T) {
+	body := []byte(`{"request_id":"1"}`)
+	signature := proxy.SignCallback(testCallbackKey, body)
+	if !proxy.VerifyCallback(testCallbackKey, body, signature) {
+		t.Errorf("Signature didn't verify")
+	}
+	if proxy.VerifyCallback([]byte("other key"), body, signature) {
+		t.Errorf("Signature verified with the wrong key")
+	}
+	if proxy.VerifyCallback(testCallbackKey, []byte(`{"request_id":"2"}`), signature) {
+		t.Errorf("Signature verified with the wrong body")
+	}
+}
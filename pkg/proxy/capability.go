@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+)
+
+// commandProtocol is the response to GET /api/1/vehicles/{VIN}/command_protocol.
+type commandProtocol struct {
+	// SignedCommands is true if the vehicle accepts commands signed by the proxy. Otherwise, the
+	// proxy forwards commands for the vehicle to the Fleet API's REST endpoints.
+	SignedCommands bool `json:"signed_commands"`
+	// Cached is true if the answer came from an earlier probe or command rather than the vehicle.
+	Cached bool `json:"cached"`
+}
+
+// handleCommandProtocol reports whether vin supports the signed command protocol. The answer is
+// cached per VIN for the lifetime of the proxy, since it only changes with a firmware update.
+func (p *Proxy) handleCommandProtocol(acct *account.Account, w http.ResponseWriter, vin string) {
+	if len(vin) != vinLength {
+		writeJSONError(w, http.StatusNotFound, errors.New("expected 17-character VIN or numeric vehicle ID in path"))
+		return
+	}
+	reply := commandProtocol{Cached: true}
+	if supported, ok := p.signedCommands.Load(vin); ok {
+		reply.SignedCommands = supported.(bool)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+		defer cancel()
+		supported, err := p.probeCommandProtocol(ctx, acct, vin)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if supported {
+			p.markSupportedVIN(vin)
+		} else {
+			p.markUnsupportedVIN(vin)
+		}
+		reply = commandProtocol{SignedCommands: supported}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: &reply})
+}
+
+func (p *Proxy) probeCommandProtocol(ctx context.Context, acct *account.Account, vin string) (bool, error) {
+	car, err := p.getVehicle(ctx, acct, vin)
+	if err != nil {
+		return false, err
+	}
+	if err := car.Connect(ctx); err != nil {
+		return false, err
+	}
+	defer car.Disconnect()
+	return car.SupportsSignedCommands(ctx)
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+const (
+	// displayUnitsTTL is how long the proxy remembers a vehicle's display units. Owners rarely
+	// change them, and looking them up costs a Fleet API request.
+	displayUnitsTTL = time.Hour
+	// displayUnitsTimeout limits the time get_charge_state waits for display units, which are
+	// omitted if they can't be read in time.
+	displayUnitsTimeout = 5 * time.Second
+)
+
+// Display units reported by get_charge_state.
+const (
+	unitsKilometers = "km"
+	unitsMiles      = "mi"
+)
+
+// DisplayUnitsResolver returns the distance units, "km" or "mi", that the vehicle with the given
+// VIN displays to its driver.
+type DisplayUnitsResolver func(ctx context.Context, acct *account.Account, vin string) (string, error)
+
+// WithDisplayUnitsResolver replaces the lookup get_charge_state uses to report a vehicle's display
+// units. The vehicle doesn't include them in the state it sends the proxy, so by default they're
+// read from the gui_settings that the vehicle last uploaded to Fleet API.
+func WithDisplayUnitsResolver(resolve DisplayUnitsResolver) Option {
+	return func(p *Proxy) {
+		p.resolveDisplayUnits = resolve
+	}
+}
+
+// fleetAPIDisplayUnits is the default DisplayUnitsResolver. It doesn't wake the vehicle.
+func fleetAPIDisplayUnits(ctx context.Context, acct *account.Account, vin string) (string, error) {
+	data, err := acct.VehicleData(ctx, vin, account.VehicleDataOptions{Endpoints: []string{"gui_settings"}})
+	if err != nil {
+		return "", err
+	}
+	var reply struct {
+		GUISettings struct {
+			DistanceUnits string `json:"gui_distance_units"` // "km/hr" or "mi/hr"
+		} `json:"gui_settings"`
+	}
+	if err := json.Unmarshal(data.Response, &reply); err != nil {
+		return "", err
+	}
+	switch {
+	case strings.HasPrefix(reply.GUISettings.DistanceUnits, unitsKilometers):
+		return unitsKilometers, nil
+	case strings.HasPrefix(reply.GUISettings.DistanceUnits, unitsMiles):
+		return unitsMiles, nil
+	}
+	return "", errors.New("vehicle data doesn't include distance units")
+}
+
+// cachedDisplayUnits is an entry in Proxy.displayUnits.
+type cachedDisplayUnits struct {
+	units   string
+	fetched time.Time
+}
+
+// displayUnits returns vin's display units, or an empty string if they can't be determined.
+func (p *Proxy) displayUnits(ctx context.Context, acct *account.Account, vin string) string {
+	if cached, ok := p.displayUnitsCache.Load(vin); ok {
+		if entry := cached.(cachedDisplayUnits); clock.Since(p.clock, entry.fetched) < displayUnitsTTL {
+			return entry.units
+		}
+	}
+	resolve := p.resolveDisplayUnits
+	if resolve == nil {
+		resolve = fleetAPIDisplayUnits
+	}
+	ctx, cancel := context.WithTimeout(ctx, displayUnitsTimeout)
+	defer cancel()
+	units, err := resolve(ctx, acct, vin)
+	if err != nil {
+		log.Warning("[%s] Couldn't read display units: %s", vin, err)
+		return ""
+	}
+	p.displayUnitsCache.Store(vin, cachedDisplayUnits{units: units, fetched: p.clock.Now()})
+	return units
+}
+
+// chargeState is the battery and charging state reported by get_charge_state. Units are part of
+// each field's name. Distances are given in both units so that clients don't need to convert them.
+type chargeState struct {
+	ChargingState            string  `json:"charging_state"`
+	BatteryLevel             int32   `json:"battery_level_percent"`
+	UsableBatteryLevel       int32   `json:"usable_battery_level_percent"`
+	ChargeLimit              int32   `json:"charge_limit_percent"`
+	RangeMiles               float64 `json:"range_mi"`
+	RangeKilometers          float64 `json:"range_km"`
+	EstimatedRangeMiles      float64 `json:"estimated_range_mi"`
+	EstimatedRangeKilometers float64 `json:"estimated_range_km"`
+	ChargerPowerKW           float64 `json:"charger_power_kw"`
+	// MinutesToFull is null unless the vehicle is charging.
+	MinutesToFull  *int    `json:"minutes_to_full"`
+	EnergyAddedKWh float64 `json:"energy_added_kwh"`
+	// DisplayUnits is "km" or "mi", or null if unknown.
+	DisplayUnits *string `json:"display_units"`
+}
+
+// roundTenth rounds x to one decimal place.
+func roundTenth(x float64) float64 {
+	return math.Round(x*10) / 10
+}
+
+func newChargeState(status *vehicle.ChargeStatus, units string) *chargeState {
+	state := &chargeState{
+		ChargingState:            status.ChargingState,
+		BatteryLevel:             status.BatteryLevel,
+		UsableBatteryLevel:       status.UsableBatteryLevel,
+		ChargeLimit:              status.ChargeLimit,
+		RangeMiles:               roundTenth(status.RangeMiles),
+		RangeKilometers:          roundTenth(status.RangeMiles * vehicle.KilometersPerMile),
+		EstimatedRangeMiles:      roundTenth(status.EstimatedRangeMiles),
+		EstimatedRangeKilometers: roundTenth(status.EstimatedRangeMiles * vehicle.KilometersPerMile),
+		ChargerPowerKW:           roundTenth(status.ChargerPowerKW),
+		EnergyAddedKWh:           roundTenth(status.EnergyAddedKWh),
+	}
+	if status.ChargingState == "charging" {
+		minutes := int(status.TimeToFull / time.Minute)
+		state.MinutesToFull = &minutes
+	}
+	if units != "" {
+		state.DisplayUnits = &units
+	}
+	return state
+}
+
+// writeChargeStateResponse reports the vehicle's battery and charging state. As with
+// writeLocationResponse, a vehicle that doesn't report its battery level yields an unsuccessful
+// result rather than an error.
+func (p *Proxy) writeChargeStateResponse(ctx context.Context, w http.ResponseWriter, acct *account.Account, car *vehicle.Vehicle) error {
+	status, err := car.ChargeStatus(ctx)
+	var busyErr *vehicle.BusyError
+	switch {
+	case errors.Is(err, vehicle.ErrVehicleStateUnknown):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(&Response{Response: &carResponse{Reason: err.Error()}})
+		return err
+	case errors.As(err, &busyErr):
+		p.writeBusyError(w, busyErr)
+		return err
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return err
+	}
+	reply := successResponse(ctx, car)
+	reply.ChargeState = newChargeState(status, p.displayUnits(ctx, acct, car.VIN()))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: reply})
+	return nil
+}
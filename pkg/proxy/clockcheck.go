@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultMaxClockSkew is the default for Proxy.MaxClockSkew.
+	DefaultMaxClockSkew = 30 * time.Second
+
+	defaultClockCheckHost = "fleet-api.prd.na.vn.cloud.tesla.com"
+)
+
+// ErrClockUnsynchronized indicates that the local clock differs from Fleet API's by more than
+// Proxy.MaxClockSkew. Vehicles reject signed commands that appear to have expired, and Tesla's
+// servers reject OAuth tokens that appear to be from the future, so hosts with inaccurate clocks
+// see errors that are hard to diagnose.
+var ErrClockUnsynchronized = errors.New("local clock is not synchronized")
+
+// ClockCheck is the result of comparing the local clock with a server's.
+type ClockCheck struct {
+	URL        string    `json:"url"`
+	LocalTime  time.Time `json:"local_time"`
+	ServerTime time.Time `json:"server_time"`
+	// SkewSeconds is positive if the local clock is ahead of the server's.
+	SkewSeconds    float64 `json:"skew_seconds"`
+	MaxSkewSeconds float64 `json:"max_skew_seconds"`
+	Synchronized   bool    `json:"synchronized"`
+}
+
+// clockCheckURL returns the URL that CheckClock sends a HEAD request to.
+func (p *Proxy) clockCheckURL() string {
+	if p.ClockCheckURL != "" {
+		return p.ClockCheckURL
+	}
+	host := p.FleetAPIHost
+	if host == "" {
+		host = defaultClockCheckHost
+	}
+	return "https://" + host + "/"
+}
+
+// CheckClock compares the local clock with the Date header of the response to a HEAD request for
+// p.ClockCheckURL. Any response will do, so the request isn't authenticated.
+//
+// The Date header has a resolution of one second, so the comparison is only accurate to about
+// half a second plus half the round-trip time. If the clocks differ by more than p.MaxClockSkew,
+// CheckClock logs a warning and returns the result along with an error that wraps
+// ErrClockUnsynchronized. The measured skew is exported as the tesla_proxy_clock_skew_seconds
+// metric.
+func (p *Proxy) CheckClock(ctx context.Context) (*ClockCheck, error) {
+	url := p.clockCheckURL()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	sent := p.clock.Now()
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't check clock: %w", err)
+	}
+	rsp.Body.Close()
+	received := p.clock.Now()
+	date, err := http.ParseTime(rsp.Header.Get("Date"))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't check clock: %s sent no valid Date header", url)
+	}
+
+	// The server truncates the time to whole seconds, and sets it at some point between sending
+	// the request and receiving the response.
+	server := date.Add(500 * time.Millisecond)
+	local := sent.Add(received.Sub(sent) / 2)
+	skew := local.Sub(server)
+	p.metrics.clockSkew.Store(int64(skew))
+	p.metrics.clockChecked.Store(true)
+
+	check := &ClockCheck{
+		URL:            url,
+		LocalTime:      local.UTC(),
+		ServerTime:     date.UTC(),
+		SkewSeconds:    skew.Seconds(),
+		MaxSkewSeconds: p.MaxClockSkew.Seconds(),
+		Synchronized:   skew.Abs() <= p.MaxClockSkew,
+	}
+	if !check.Synchronized {
+		direction := "ahead of"
+		if skew < 0 {
+			direction = "behind"
+		}
+		log.Warning("*** The local clock is %s %s %s. Vehicles and Tesla's servers will reject "+
+			"commands and tokens that appear to have expired. Synchronize the clock with NTP. ***",
+			skew.Abs().Round(time.Second), direction, url)
+		return check, fmt.Errorf("%w: off by %s (maximum %s)", ErrClockUnsynchronized, skew.Round(time.Second), p.MaxClockSkew)
+	}
+	log.Debug("Local clock is within %s of %s", skew.Abs().Round(time.Millisecond), url)
+	return check, nil
+}
+
+// handleAdminClockCheck runs CheckClock and reports the result. A clock that's out of sync is
+// reported with 200 OK; only failure to reach the server is an error.
+func (p *Proxy) handleAdminClockCheck(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), p.Timeout)
+	defer cancel()
+	check, err := p.CheckClock(ctx)
+	if check == nil {
+		writeJSONError(w, http.StatusBadGateway, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: check})
+}
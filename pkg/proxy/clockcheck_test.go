@@ -0,0 +1,78 @@
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func TestCheckClock(t *testing.T) {
+	serverTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sendDate := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodHead {
+			t.Errorf("Unexpected method %s", req.Method)
+		}
+		if sendDate {
+			w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+		} else {
+			w.Header()["Date"] = nil
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	// The server's time is truncated to the second, so the proxy assumes it's half a second later.
+	fakeClock := clock.NewFake(serverTime.Add(90*time.Second + 500*time.Millisecond))
+	p, _ := newTestProxy(t, true, proxy.WithClock(fakeClock))
+	p.ClockCheckURL = server.URL
+	p.AdminToken = []byte("admin-token")
+
+	if strings.Contains(scrapeMetrics(t, p), "tesla_proxy_clock_skew_seconds") {
+		t.Errorf("Clock skew exported before it was measured")
+	}
+	check, err := p.CheckClock(context.Background())
+	if !errors.Is(err, proxy.ErrClockUnsynchronized) {
+		t.Fatalf("Expected ErrClockUnsynchronized, got %v", err)
+	}
+	if check.SkewSeconds != 90 || check.Synchronized || !check.ServerTime.Equal(serverTime) || !check.LocalTime.Equal(fakeClock.Now()) {
+		t.Errorf("Unexpected result %+v", check)
+	}
+	if metrics := scrapeMetrics(t, p); !strings.Contains(metrics, "tesla_proxy_clock_skew_seconds 90\n") {
+		t.Errorf("Clock skew not exported:\n%s", metrics)
+	}
+
+	serverTime = serverTime.Add(88 * time.Second)
+	var reply struct {
+		Response proxy.ClockCheck `json:"response"`
+	}
+	adminRequest(t, p, http.MethodGet, "/admin/clock-check", &reply)
+	if check := reply.Response; check.SkewSeconds != 2 || !check.Synchronized || check.URL != server.URL {
+		t.Errorf("Unexpected result %+v", check)
+	}
+
+	serverTime = serverTime.Add(4 * time.Second)
+	p.MaxClockSkew = time.Second
+	if check, err := p.CheckClock(context.Background()); !errors.Is(err, proxy.ErrClockUnsynchronized) || check.SkewSeconds != -2 {
+		t.Errorf("Expected clock to be 2s behind, got %+v, %v", check, err)
+	}
+
+	sendDate = false
+	if _, err := p.CheckClock(context.Background()); err == nil || errors.Is(err, proxy.ErrClockUnsynchronized) {
+		t.Errorf("Expected error for missing Date header, got %v", err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/admin/clock-check", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 when the clock can't be checked, got %d", w.Code)
+	}
+}
@@ -2,12 +2,14 @@ package proxy
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
 	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 	"github.com/teslamotors/vehicle-command/pkg/vehicle"
@@ -22,6 +24,8 @@ var (
 	// ErrCommandUseRESTAPI indicates vehicle/command is not supported by the protocol
 	ErrCommandUseRESTAPI = errors.New("command requires using the REST API")
 
+	errInvalidCommand = &inet.HTTPError{Code: http.StatusBadRequest, Message: "{\"response\":null,\"error\":\"invalid_command\",\"error_description\":\"\"}"}
+
 	seatPositions = []vehicle.SeatPosition{
 		vehicle.SeatFrontLeft,
 		vehicle.SeatFrontRight,
@@ -34,6 +38,13 @@ var (
 		vehicle.SeatThirdRowRight,
 	}
 
+	copModes = map[string]vehicle.CabinOverheatProtectionMode{
+		"off":      vehicle.CabinOverheatProtectionOff,
+		"on":       vehicle.CabinOverheatProtectionOn,
+		"no_ac":    vehicle.CabinOverheatProtectionFanOnly,
+		"fan_only": vehicle.CabinOverheatProtectionFanOnly,
+	}
+
 	dayNamesBitMask = map[string]int32{
 		"SUN":       1,
 		"SUNDAY":    1,
@@ -57,16 +68,44 @@ var (
 // RequestParameters allows simple type check
 type RequestParameters map[string]interface{}
 
-// ExtractCommandAction use command to define which action should be executed.
+// ExtractCommandAction use command to define which action should be executed. Parameters that
+// the command doesn't recognize are ignored for compatibility with Fleet API clients.
 func ExtractCommandAction(ctx context.Context, command string, params RequestParameters) (func(*vehicle.Vehicle) error, error) {
+	return decodeCommandAction(ctx, command, params, false)
+}
+
+// decodeCommandAction is ExtractCommandAction, rejecting unrecognized parameters if strict is set.
+func decodeCommandAction(ctx context.Context, command string, params RequestParameters, strict bool) (func(*vehicle.Vehicle) error, error) {
+	spec, ok := catalog.Lookup(command)
+	if !ok {
+		return nil, errInvalidCommand
+	}
+	var body []byte
+	if len(params) > 0 {
+		var err error
+		if body, err = json.Marshal(params); err != nil {
+			return nil, err
+		}
+	}
+	decode := spec.DecodeRequest
+	if strict {
+		decode = spec.DecodeRequestStrict
+	}
+	request, err := decode(body)
+	if err != nil {
+		return nil, &protocol.NominalError{Details: err}
+	}
+	return commandAction(ctx, command, request)
+}
+
+// commandAction returns the action for command, given its request as returned by
+// catalog.Command.DecodeRequest.
+func commandAction(ctx context.Context, command string, request interface{}) (func(*vehicle.Vehicle) error, error) {
 	switch command {
 	// Media controls
 	case "adjust_volume":
-		volume, err := params.getNumber("volume", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.SetVolume(ctx, float32(volume)) }, nil
+		r := request.(*catalog.AdjustVolumeRequest)
+		return func(v *vehicle.Vehicle) error { return v.SetVolume(ctx, float32(r.Volume)) }, nil
 	case "remote_boombox":
 		return nil, ErrCommandNotImplemented
 	case "media_next_fav":
@@ -91,109 +130,74 @@ func ExtractCommandAction(ctx context.Context, command string, params RequestPar
 	case "charge_max_range":
 		return func(v *vehicle.Vehicle) error { return v.ChargeMaxRange(ctx) }, nil
 	case "remote_seat_cooler_request":
-		level, seat, err := params.settingForCoolerSeatPosition()
-		if err != nil {
-			return nil, err
-		}
+		r := request.(*catalog.RemoteSeatCoolerRequest)
+		// The API uses levels 0-3, which are one more than vehicle.Level.
+		level, seat := vehicle.Level(r.SeatCoolerLevel-1), coolerSeatPosition(r.SeatPosition)
 		return func(v *vehicle.Vehicle) error { return v.SetSeatCooler(ctx, level, seat) }, nil
 	case "remote_seat_heater_request":
-		setting, err := params.settingForHeatSeatPosition()
-		if err != nil {
-			return nil, err
-		}
-
+		r := request.(*catalog.RemoteSeatHeaterRequest)
+		// The catalog restricts seat_position to indices of seatPositions.
+		setting := map[vehicle.SeatPosition]vehicle.Level{seatPositions[r.SeatPosition]: vehicle.Level(r.Level)}
 		return func(v *vehicle.Vehicle) error { return v.SetSeatHeater(ctx, setting) }, nil
 	case "remote_auto_seat_climate_request":
-		seat, enabled, err := params.settingForAutoSeatPosition()
-		if err != nil {
-			return nil, err
-		}
+		r := request.(*catalog.RemoteAutoSeatClimateRequest)
+		seat := autoSeatPosition(r.AutoSeatPosition)
 		return func(v *vehicle.Vehicle) error {
-			return v.AutoSeatAndClimate(ctx, []vehicle.SeatPosition{seat}, enabled)
+			return v.AutoSeatAndClimate(ctx, []vehicle.SeatPosition{seat}, r.AutoClimateOn)
 		}, nil
 	case "remote_steering_wheel_heater_request":
-		on, err := params.getBool("on", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.SetSteeringWheelHeater(ctx, on) }, nil
+		r := request.(*catalog.SteeringWheelHeaterRequest)
+		return func(v *vehicle.Vehicle) error { return v.SetSteeringWheelHeater(ctx, r.On) }, nil
 	case "set_bioweapon_mode":
-		on, err := params.getBool("on", true)
-		if err != nil {
-			return nil, err
-		}
-		override, err := params.getBool("manual_override", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.SetBioweaponDefenseMode(ctx, on, override) }, nil
+		r := request.(*catalog.BioweaponModeRequest)
+		return func(v *vehicle.Vehicle) error { return v.SetBioweaponDefenseMode(ctx, r.On, r.ManualOverride) }, nil
 	case "set_cabin_overheat_protection":
-		on, err := params.getBool("on", true)
-		if err != nil {
-			return nil, err
+		r := request.(*catalog.CabinOverheatProtectionRequest)
+		// The catalog restricts mode to the keys of copModes.
+		if r.Mode != nil {
+			mode := copModes[*r.Mode]
+			return func(v *vehicle.Vehicle) error { return v.SetCabinOverheatProtectionMode(ctx, mode) }, nil
 		}
-		fanOnly, err := params.getBool("fan_only", false)
-		if err != nil {
-			return nil, err
+		if r.On == nil {
+			return nil, missingParamError("on")
 		}
+		on, fanOnly := *r.On, r.FanOnly != nil && *r.FanOnly
 		return func(v *vehicle.Vehicle) error { return v.SetCabinOverheatProtection(ctx, on, fanOnly) }, nil
 	case "set_climate_keeper_mode":
+		r := request.(*catalog.ClimateKeeperModeRequest)
 		// 0 : off
 		// 1 : On
 		// 2 : Dog
 		// 3 : Camp
-		mode, err := params.getNumber("climate_keeper_mode", true)
-		if err != nil {
-			return nil, err
-		}
-		override, err := params.getBool("manual_override", false)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error {
-			return v.SetClimateKeeperMode(ctx, vehicle.ClimateKeeperMode(mode), override)
-		}, nil
+		mode, override := vehicle.ClimateKeeperMode(r.ClimateKeeperMode), r.ManualOverride != nil && *r.ManualOverride
+		return func(v *vehicle.Vehicle) error { return v.SetClimateKeeperMode(ctx, mode, override) }, nil
 	case "set_cop_temp":
-		level, err := params.getNumber("cop_temp", true)
-		if err != nil {
-			return nil, err
-		}
+		r := request.(*catalog.CabinOverheatProtectionTempRequest)
 		return func(v *vehicle.Vehicle) error {
-			return v.SetCabinOverheatProtectionTemperature(ctx, vehicle.Level(level))
+			return v.SetCabinOverheatProtectionTemperature(ctx, vehicle.Level(r.CopTemp))
 		}, nil
 	case "set_preconditioning_max":
-		on, err := params.getBool("on", true)
-		if err != nil {
-			return nil, err
-		}
-		override, err := params.getBool("manual_override", false)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.SetPreconditioningMax(ctx, on, override) }, nil
+		r := request.(*catalog.PreconditioningMaxRequest)
+		override := r.ManualOverride != nil && *r.ManualOverride
+		return func(v *vehicle.Vehicle) error { return v.SetPreconditioningMax(ctx, r.On, override) }, nil
 	case "set_temps":
-		driverTemp, err := params.getNumber("driver_temp", false)
-		if err != nil {
-			return nil, err
+		r := request.(*catalog.TemperaturesRequest)
+		var driverTemp, passengerTemp float32
+		if r.DriverTemp != nil {
+			driverTemp = float32(*r.DriverTemp)
 		}
-		passengerTemp, err := params.getNumber("passenger_temp", false)
-		if err != nil {
-			return nil, err
+		if r.PassengerTemp != nil {
+			passengerTemp = float32(*r.PassengerTemp)
 		}
 		return func(v *vehicle.Vehicle) error {
-			return v.ChangeClimateTemp(ctx, float32(driverTemp), float32(passengerTemp))
+			_, err := v.SetTemperatures(ctx, driverTemp, passengerTemp)
+			return err
 		}, nil
 	// vehicle.Vehicle actuation commands
 	case "actuate_trunk":
-		if which, err := params.getString("which_trunk", false); err == nil {
-			switch which {
-			case "front":
-				return func(v *vehicle.Vehicle) error { return v.OpenFrunk(ctx) }, nil
-			case "rear":
-				return func(v *vehicle.Vehicle) error { return v.OpenTrunk(ctx) }, nil
-			default:
-				return nil, &protocol.NominalError{Details: protocol.NewError("invalid_value", false, false)}
-			}
+		r := request.(*catalog.ActuateTrunkRequest)
+		if r.WhichTrunk != nil && *r.WhichTrunk == "front" {
+			return func(v *vehicle.Vehicle) error { return v.OpenFrunk(ctx) }, nil
 		}
 		return func(v *vehicle.Vehicle) error { return v.OpenTrunk(ctx) }, nil
 	case "charge_port_door_open":
@@ -214,11 +218,8 @@ func ExtractCommandAction(ctx context.Context, command string, params RequestPar
 		return func(v *vehicle.Vehicle) error { return v.StopTonneau(ctx) }, nil
 	// Power-management controls
 	case "set_low_power_mode":
-		on, err := params.getBool("enable", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.SetLowPowerMode(ctx, on) }, nil
+		r := request.(*catalog.LowPowerModeRequest)
+		return func(v *vehicle.Vehicle) error { return v.SetLowPowerMode(ctx, r.Enable) }, nil
 	case "charge_standard":
 		return func(v *vehicle.Vehicle) error { return v.ChargeStandardRange(ctx) }, nil
 	case "charge_start":
@@ -226,169 +227,99 @@ func ExtractCommandAction(ctx context.Context, command string, params RequestPar
 	case "charge_stop":
 		return func(v *vehicle.Vehicle) error { return v.ChargeStop(ctx) }, nil
 	case "set_charging_amps":
-		amps, err := params.getNumber("charging_amps", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.SetChargingAmps(ctx, int32(amps)) }, nil
+		r := request.(*catalog.ChargingAmpsRequest)
+		return func(v *vehicle.Vehicle) error { return v.SetChargingAmps(ctx, int32(r.ChargingAmps)) }, nil
 	case "set_scheduled_charging":
-		on, err := params.getBool("enable", true)
-		if err != nil {
-			return nil, err
-		}
-		scheduledTime, err := params.getTimeAfterMidnight("time")
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.ScheduleCharging(ctx, on, scheduledTime) }, nil
+		r := request.(*catalog.ScheduledChargingRequest)
+		scheduledTime := minutesAfterMidnight(r.Time)
+		return func(v *vehicle.Vehicle) error { return v.ScheduleCharging(ctx, r.Enable, scheduledTime) }, nil
 	case "set_charge_limit":
-		limit, err := params.getNumber("percent", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.ChangeChargeLimit(ctx, int32(limit)) }, nil
+		r := request.(*catalog.ChargeLimitRequest)
+		return func(v *vehicle.Vehicle) error { return v.ChangeChargeLimit(ctx, int32(r.Percent)) }, nil
 	case "set_scheduled_departure":
-		enable, err := params.getBool("enable", true)
-		if err != nil {
-			return nil, err
-		}
-		if !enable {
+		r := request.(*catalog.ScheduledDepartureRequest)
+		if !r.Enable {
 			return func(v *vehicle.Vehicle) error { return v.ClearScheduledDeparture(ctx) }, nil
 		}
-
-		offPeakPolicy, err := params.getPolicy("off_peak_charging_enabled", "off_peak_charging_weekdays_only")
-		if err != nil {
-			return nil, err
-		}
-		preconditionPolicy, err := params.getPolicy("preconditioning_enabled", "preconditioning_weekdays_only")
-		if err != nil {
-			return nil, err
-		}
-
-		departureTime, err := params.getTimeAfterMidnight("departure_time")
-		if err != nil {
-			return nil, err
-		}
-		endOffPeakTime, err := params.getTimeAfterMidnight("end_off_peak_time")
-		if err != nil {
-			return nil, err
-		}
+		offPeakPolicy := chargingPolicy(r.OffPeakChargingEnabled, r.OffPeakChargingWeekdaysOnly)
+		preconditionPolicy := chargingPolicy(r.PreconditioningEnabled, r.PreconditioningWeekdaysOnly)
+		departureTime := minutesAfterMidnight(r.DepartureTime)
+		endOffPeakTime := minutesAfterMidnight(r.EndOffPeakTime)
 		return func(v *vehicle.Vehicle) error {
 			return v.ScheduleDeparture(ctx, departureTime, endOffPeakTime, preconditionPolicy, offPeakPolicy)
 		}, nil
 	case "add_charge_schedule":
-		lat, err := params.getNumber("lat", true)
-		if err != nil {
-			return nil, err
-		}
-		lon, err := params.getNumber("lon", true)
-		if err != nil {
-			return nil, err
-		}
-		startTime, err := params.getNumber("start_time", false)
-		if err != nil {
-			return nil, err
-		}
-		startEnabled, err := params.getBool("start_enabled", true)
-		if err != nil {
-			return nil, err
-		}
-		endTime, err := params.getNumber("end_time", false)
-		if err != nil {
-			return nil, err
-		}
-		endEnabled, err := params.getBool("end_enabled", true)
-		if err != nil {
-			return nil, err
-		}
-		daysOfWeek, err := params.getDays("days_of_week", true)
-		if err != nil {
-			return nil, err
-		}
-		id, err := params.getNumber("id", false)
-		if err != nil {
-			return nil, err
-		}
-		idUint64 := uint64(id)
-		if id == 0 {
-			idUint64 = uint64(time.Now().Unix())
-		}
-		enabled, err := params.getBool("enabled", true)
-		if err != nil {
-			return nil, err
-		}
-		oneTime, err := params.getBool("one_time", false)
+		r := request.(*catalog.AddChargeScheduleRequest)
+		daysOfWeek, err := parseDays(r.DaysOfWeek)
 		if err != nil {
 			return nil, err
 		}
 		schedule := vehicle.ChargeSchedule{
 			DaysOfWeek:   daysOfWeek,
-			Latitude:     float32(lat),
-			Longitude:    float32(lon),
-			Id:           idUint64,
-			StartTime:    int32(startTime),
-			EndTime:      int32(endTime),
-			StartEnabled: startEnabled,
-			EndEnabled:   endEnabled,
-			Enabled:      enabled,
-			OneTime:      oneTime,
+			Latitude:     float32(r.Lat),
+			Longitude:    float32(r.Lon),
+			Id:           scheduleID(r.ID),
+			StartTime:    int32(valueOrZero(r.StartTime)),
+			EndTime:      int32(valueOrZero(r.EndTime)),
+			StartEnabled: r.StartEnabled,
+			EndEnabled:   r.EndEnabled,
+			Enabled:      r.Enabled,
+			OneTime:      valueOrZero(r.OneTime),
 		}
 		return func(v *vehicle.Vehicle) error { return v.AddChargeSchedule(ctx, &schedule) }, nil
 	case "add_precondition_schedule":
-		lat, err := params.getNumber("lat", true)
-		if err != nil {
-			return nil, err
-		}
-		lon, err := params.getNumber("lon", true)
-		if err != nil {
-			return nil, err
-		}
-		preconditionTime, err := params.getNumber("precondition_time", true)
-		if err != nil {
-			return nil, err
-		}
-		oneTime, err := params.getBool("one_time", false)
-		if err != nil {
-			return nil, err
-		}
-		daysOfWeek, err := params.getDays("days_of_week", true)
-		if err != nil {
-			return nil, err
-		}
-		id, err := params.getNumber("id", false)
-		if err != nil {
-			return nil, err
-		}
-		idUint64 := uint64(id)
-		if id == 0 {
-			idUint64 = uint64(time.Now().Unix())
-		}
-		enabled, err := params.getBool("enabled", true)
+		r := request.(*catalog.AddPreconditionScheduleRequest)
+		daysOfWeek, err := parseDays(r.DaysOfWeek)
 		if err != nil {
 			return nil, err
 		}
 		schedule := vehicle.PreconditionSchedule{
 			DaysOfWeek:       daysOfWeek,
-			Latitude:         float32(lat),
-			Longitude:        float32(lon),
-			Id:               idUint64,
-			PreconditionTime: int32(preconditionTime),
-			OneTime:          oneTime,
-			Enabled:          enabled,
+			Latitude:         float32(r.Lat),
+			Longitude:        float32(r.Lon),
+			Id:               scheduleID(r.ID),
+			PreconditionTime: int32(r.PreconditionTime),
+			OneTime:          valueOrZero(r.OneTime),
+			Enabled:          r.Enabled,
 		}
 		return func(v *vehicle.Vehicle) error { return v.AddPreconditionSchedule(ctx, &schedule) }, nil
 	case "remove_charge_schedule":
-		id, err := params.getNumber("id", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.RemoveChargeSchedule(ctx, uint64(id)) }, nil
+		r := request.(*catalog.RemoveScheduleRequest)
+		return func(v *vehicle.Vehicle) error { return v.RemoveChargeSchedule(ctx, uint64(r.ID)) }, nil
+	case "set_charging_schedule_mode":
+		r := request.(*catalog.ChargingScheduleModeRequest)
+		mode, err := vehicle.ParseChargingScheduleMode(r.Mode)
+		if err != nil {
+			return nil, invalidParamError("mode")
+		}
+		if r.Time == nil && mode != vehicle.ChargingScheduleOff {
+			return nil, missingParamError("time")
+		}
+		scheduledTime := minutesAfterMidnight(r.Time)
+		return func(v *vehicle.Vehicle) error { return v.SetChargingScheduleMode(ctx, mode, scheduledTime) }, nil
+	case "get_off_peak_charging":
+		// The settings are read when writing the response.
+		return func(*vehicle.Vehicle) error { return nil }, nil
+	case "get_location":
+		// The location is read when writing the response.
+		return func(*vehicle.Vehicle) error { return nil }, nil
+	case "get_charge_state":
+		// The charge state is read when writing the response.
+		return func(*vehicle.Vehicle) error { return nil }, nil
+	case "set_off_peak_charging":
+		r := request.(*catalog.OffPeakChargingRequest)
+		if r.Enabled && r.EndOffPeakTime == nil {
+			return nil, missingParamError("end_off_peak_time")
+		}
+		settings := vehicle.OffPeakChargingSettings{
+			Enabled:      r.Enabled,
+			WeekdaysOnly: valueOrZero(r.WeekdaysOnly),
+			EndTime:      minutesAfterMidnight(r.EndOffPeakTime),
+		}
+		return func(v *vehicle.Vehicle) error { return v.SetOffPeakCharging(ctx, settings) }, nil
 	case "remove_precondition_schedule":
-		id, err := params.getNumber("id", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.RemovePreconditionSchedule(ctx, uint64(id)) }, nil
+		r := request.(*catalog.RemoveScheduleRequest)
+		return func(v *vehicle.Vehicle) error { return v.RemovePreconditionSchedule(ctx, uint64(r.ID)) }, nil
 	case "set_managed_charge_current_request":
 		return nil, ErrCommandUseRESTAPI
 	case "set_managed_charger_location":
@@ -399,15 +330,9 @@ func ExtractCommandAction(ctx context.Context, command string, params RequestPar
 		return func(v *vehicle.Vehicle) error { return v.Wakeup(ctx) }, nil
 	// Security
 	case "set_pin_to_drive":
-		on, err := params.getBool("on", true)
-		if err != nil {
-			return nil, err
-		}
-		password, err := params.getString("password", false)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.SetPINToDrive(ctx, on, password) }, nil
+		r := request.(*catalog.PINToDriveRequest)
+		password := valueOrZero(r.Password)
+		return func(v *vehicle.Vehicle) error { return v.SetPINToDrive(ctx, r.On, password) }, nil
 	case "clear_pin_to_drive_admin":
 		return func(v *vehicle.Vehicle) error { return v.ClearPINToDrive(ctx) }, nil
 	case "door_lock":
@@ -421,80 +346,43 @@ func ExtractCommandAction(ctx context.Context, command string, params RequestPar
 	case "reset_valet_pin":
 		return func(v *vehicle.Vehicle) error { return v.ResetValetPin(ctx) }, nil
 	case "guest_mode":
-		on, err := params.getBool("enable", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.SetGuestMode(ctx, on) }, nil
+		r := request.(*catalog.GuestModeRequest)
+		return func(v *vehicle.Vehicle) error { return v.SetGuestMode(ctx, r.Enable) }, nil
 	case "set_sentry_mode":
-		on, err := params.getBool("on", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.SetSentryMode(ctx, on) }, nil
+		r := request.(*catalog.SentryModeRequest)
+		return func(v *vehicle.Vehicle) error { return v.SetSentryMode(ctx, r.On) }, nil
 	case "set_valet_mode":
-		on, err := params.getBool("on", true)
-		if err != nil {
-			return nil, err
-		}
-		password, err := params.getString("password", false)
-		if err != nil {
-			return nil, err
-		}
-		if on {
+		r := request.(*catalog.ValetModeRequest)
+		if r.On {
+			password := valueOrZero(r.Password)
 			return func(v *vehicle.Vehicle) error { return v.EnableValetMode(ctx, password) }, nil
 		}
 		return func(v *vehicle.Vehicle) error { return v.DisableValetMode(ctx) }, nil
 	case "set_vehicle_name":
-		name, err := params.getString("vehicle_name", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.SetVehicleName(ctx, name) }, nil
+		r := request.(*catalog.VehicleNameRequest)
+		return func(v *vehicle.Vehicle) error { return v.SetVehicleName(ctx, r.VehicleName) }, nil
 	case "speed_limit_activate":
-		pin, err := params.getString("pin", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.ActivateSpeedLimit(ctx, pin) }, nil
+		r := request.(*catalog.SpeedLimitPINRequest)
+		return func(v *vehicle.Vehicle) error { return v.ActivateSpeedLimit(ctx, r.PIN) }, nil
 	case "speed_limit_deactivate":
-		pin, err := params.getString("pin", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.DeactivateSpeedLimit(ctx, pin) }, nil
+		r := request.(*catalog.SpeedLimitPINRequest)
+		return func(v *vehicle.Vehicle) error { return v.DeactivateSpeedLimit(ctx, r.PIN) }, nil
 	case "speed_limit_clear_pin":
-		pin, err := params.getString("pin", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.ClearSpeedLimitPIN(ctx, pin) }, nil
+		r := request.(*catalog.SpeedLimitPINRequest)
+		return func(v *vehicle.Vehicle) error { return v.ClearSpeedLimitPIN(ctx, r.PIN) }, nil
 	case "speed_limit_clear_pin_admin":
 		return func(v *vehicle.Vehicle) error { return v.ClearSpeedLimitPINAdminAction(ctx) }, nil
 	case "speed_limit_set_limit":
-		speedMPH, err := params.getNumber("limit_mph", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.SpeedLimitSetLimitMPH(ctx, speedMPH) }, nil
+		r := request.(*catalog.SpeedLimitRequest)
+		return func(v *vehicle.Vehicle) error { return v.SpeedLimitSetLimitMPH(ctx, r.LimitMPH) }, nil
 	case "trigger_homelink":
-		lat, err := params.getNumber("lat", true)
-		if err != nil {
-			return nil, err
-		}
-		lon, err := params.getNumber("lon", true)
-		if err != nil {
-			return nil, err
-		}
-		return func(v *vehicle.Vehicle) error { return v.TriggerHomelink(ctx, float32(lat), float32(lon)) }, nil
+		r := request.(*catalog.HomelinkRequest)
+		return func(v *vehicle.Vehicle) error { return v.TriggerHomelink(ctx, float32(r.Lat), float32(r.Lon)) }, nil
 	// Updates
 	case "schedule_software_update":
-		offsetSeconds, err := params.getNumber("offset_sec", true)
-		if err != nil {
-			return nil, err
-		}
+		r := request.(*catalog.SoftwareUpdateRequest)
 		return func(v *vehicle.Vehicle) error {
-			return v.ScheduleSoftwareUpdate(ctx, time.Duration(offsetSeconds)*time.Second)
+			return v.ScheduleSoftwareUpdate(ctx, time.Duration(r.OffsetSec)*time.Second)
 		}, nil
 	case "cancel_software_update":
 		return func(v *vehicle.Vehicle) error { return v.CancelSoftwareUpdate(ctx) }, nil
@@ -503,79 +391,41 @@ func ExtractCommandAction(ctx context.Context, command string, params RequestPar
 	case "navigation_request":
 		return nil, ErrCommandUseRESTAPI
 	case "window_control":
-		// Latitude and longitude are not required for vehicles that support this protocol.
-		cmd, err := params.getString("command", true)
-		if err != nil {
-			return nil, err
-		}
-		switch cmd {
-		case "vent":
+		// Latitude and longitude are not required for vehicles that support this protocol. The
+		// catalog restricts command to vent and close.
+		if request.(*catalog.WindowControlRequest).Command == "vent" {
 			return func(v *vehicle.Vehicle) error { return v.VentWindows(ctx) }, nil
-		case "close":
-			return func(v *vehicle.Vehicle) error { return v.CloseWindows(ctx) }, nil
-		default:
-			return nil, errors.New("command must be 'vent' or 'close'")
 		}
+		return func(v *vehicle.Vehicle) error { return v.CloseWindows(ctx) }, nil
 	default:
-		return nil, &inet.HTTPError{Code: http.StatusBadRequest, Message: "{\"response\":null,\"error\":\"invalid_command\",\"error_description\":\"\"}"}
+		return nil, errInvalidCommand
 	}
 }
 
-func (p RequestParameters) getString(key string, required bool) (string, error) {
-	value, exists := p[key]
-
-	if exists {
-		if strValue, isString := value.(string); isString {
-			return strValue, nil
-		}
-		return "", invalidParamError(key)
+// valueOrZero returns *p, or the zero value if p is nil.
+func valueOrZero[T any](p *T) T {
+	var value T
+	if p != nil {
+		value = *p
 	}
-
-	if !required {
-		return "", nil
-	}
-
-	return "", missingParamError(key)
+	return value
 }
 
-func (p RequestParameters) getBool(key string, required bool) (bool, error) {
-	value, exists := p[key]
-	if exists {
-		if val, isBool := value.(bool); isBool {
-			return val, nil
-		}
-		return false, invalidParamError(key)
-	}
-
-	if !required {
-		return false, nil
-	}
-
-	return false, missingParamError(key)
+// minutesAfterMidnight converts an optional time of day in minutes to a duration. The catalog
+// restricts the time to 0-1439.
+func minutesAfterMidnight(minutes *int) time.Duration {
+	return time.Duration(valueOrZero(minutes)) * time.Minute
 }
 
-func (p RequestParameters) getNumber(key string, required bool) (float64, error) {
-	value, exists := p[key]
-	if exists {
-		if num, isFloat64 := value.(float64); isFloat64 {
-			return num, nil
-		}
-		return 0, invalidParamError(key)
-	}
-
-	if !required {
-		return 0, nil
+// scheduleID returns id, or an ID based on the current time for a new schedule.
+func scheduleID(id *int64) uint64 {
+	if id == nil || *id == 0 {
+		return uint64(time.Now().Unix())
 	}
-
-	return 0, missingParamError(key)
+	return uint64(*id)
 }
 
-func (p RequestParameters) getDays(key string, required bool) (int32, error) {
-	daysStr, err := p.getString(key, required)
-	if err != nil {
-		return 0, err
-	}
-
+func parseDays(daysStr string) (int32, error) {
 	var mask int32
 	for _, d := range strings.Split(daysStr, ",") {
 		if v, ok := dayNamesBitMask[strings.TrimSpace(strings.ToUpper(d))]; ok {
@@ -587,97 +437,35 @@ func (p RequestParameters) getDays(key string, required bool) (int32, error) {
 	return mask, nil
 }
 
-func (p RequestParameters) getPolicy(enabledKey string, weekdaysOnlyKey string) (vehicle.ChargingPolicy, error) {
-	enabled, err := p.getBool(enabledKey, false)
-	if err != nil {
-		return 0, err
-	}
-	weekdaysOnly, err := p.getBool(weekdaysOnlyKey, false)
-	if err != nil {
-		return 0, err
-	}
-	if weekdaysOnly {
-		return vehicle.ChargingPolicyWeekdays, nil
-	}
-	if enabled {
-		return vehicle.ChargingPolicyAllDays, nil
-	}
-	return vehicle.ChargingPolicyOff, nil
-}
-
-func (p RequestParameters) getTimeAfterMidnight(key string) (time.Duration, error) {
-	minutes, err := p.getNumber(key, false)
-	if err != nil {
-		return 0, err
+func chargingPolicy(enabled, weekdaysOnly *bool) vehicle.ChargingPolicy {
+	if valueOrZero(weekdaysOnly) {
+		return vehicle.ChargingPolicyWeekdays
 	}
-	// Leave further validation to the car for consistency with previous API.
-	return time.Duration(minutes) * time.Minute, nil
-}
-
-func (p RequestParameters) settingForHeatSeatPosition() (map[vehicle.SeatPosition]vehicle.Level, error) {
-	index, err := p.getNumber("seat_position", true)
-	if err != nil {
-		return nil, err
-	}
-	if int(index) < 0 || int(index) >= len(seatPositions) {
-		return nil, errors.New("invalid seat position")
+	if valueOrZero(enabled) {
+		return vehicle.ChargingPolicyAllDays
 	}
-
-	level, err := p.getNumber("level", true)
-	if err != nil {
-		return nil, err
-	}
-
-	return map[vehicle.SeatPosition]vehicle.Level{seatPositions[int(index)]: vehicle.Level(level)}, nil
+	return vehicle.ChargingPolicyOff
 }
 
 // Note: The API uses 0-3
-func (p RequestParameters) settingForCoolerSeatPosition() (vehicle.Level, vehicle.SeatPosition, error) {
-	position, err := p.getNumber("seat_position", true)
-	if err != nil {
-		return 0, 0, err
-	}
-
-	var seat vehicle.SeatPosition
+func coolerSeatPosition(position int) vehicle.SeatPosition {
 	switch carserver.HvacSeatCoolerActions_HvacSeatCoolerPosition_E(position) {
 	case carserver.HvacSeatCoolerActions_HvacSeatCoolerPosition_FrontLeft:
-		seat = vehicle.SeatFrontLeft
+		return vehicle.SeatFrontLeft
 	case carserver.HvacSeatCoolerActions_HvacSeatCoolerPosition_FrontRight:
-		seat = vehicle.SeatFrontRight
-	default:
-		seat = vehicle.SeatUnknown
-	}
-
-	level, err := p.getNumber("seat_cooler_level", true)
-	if err != nil {
-		return 0, 0, err
+		return vehicle.SeatFrontRight
 	}
-
-	return vehicle.Level(level - 1), seat, nil
+	return vehicle.SeatUnknown
 }
 
-func (p RequestParameters) settingForAutoSeatPosition() (vehicle.SeatPosition, bool, error) {
-	position, err := p.getNumber("auto_seat_position", true)
-	if err != nil {
-		return 0, false, err
-	}
-
-	enabled, err := p.getBool("auto_climate_on", true)
-	if err != nil {
-		return 0, false, err
-	}
-
-	var seat vehicle.SeatPosition
+func autoSeatPosition(position int) vehicle.SeatPosition {
 	switch carserver.AutoSeatClimateAction_AutoSeatPosition_E(position) {
 	case carserver.AutoSeatClimateAction_AutoSeatPosition_FrontLeft:
-		seat = vehicle.SeatFrontLeft
+		return vehicle.SeatFrontLeft
 	case carserver.AutoSeatClimateAction_AutoSeatPosition_FrontRight:
-		seat = vehicle.SeatFrontRight
-	default:
-		seat = vehicle.SeatUnknown
+		return vehicle.SeatFrontRight
 	}
-
-	return seat, enabled, nil
+	return vehicle.SeatUnknown
 }
 
 func missingParamError(key string) error {
@@ -2,11 +2,15 @@ package proxy_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
 	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 	"github.com/teslamotors/vehicle-command/pkg/proxy"
@@ -48,3 +52,254 @@ func TestExtractCommandAction(t *testing.T) {
 		}
 	}
 }
+
+func TestSetChargingScheduleModeParams(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		params proxy.RequestParameters
+		valid  bool
+	}{
+		{proxy.RequestParameters{"mode": "off"}, true},
+		{proxy.RequestParameters{"mode": "departure", "time": 450.0}, true},
+		{proxy.RequestParameters{"mode": "start_time", "time": 0.0}, true},
+		{proxy.RequestParameters{"mode": "departure"}, false},
+		{proxy.RequestParameters{"mode": "departure", "time": 1440.0}, false},
+		{proxy.RequestParameters{"mode": "departure", "time": -1.0}, false},
+		{proxy.RequestParameters{"mode": "departure", "time": 30.5}, false},
+		{proxy.RequestParameters{"mode": "departure", "time": "7:30"}, false},
+		{proxy.RequestParameters{"mode": "sometimes", "time": 450.0}, false},
+		{proxy.RequestParameters{"time": 450.0}, false},
+	}
+	for _, test := range tests {
+		action, err := proxy.ExtractCommandAction(ctx, "set_charging_schedule_mode", test.params)
+		if test.valid && (err != nil || action == nil) {
+			t.Errorf("Expected %v to be accepted, got %v", test.params, err)
+		} else if !test.valid {
+			var nominal *protocol.NominalError
+			if !errors.As(err, &nominal) {
+				t.Errorf("Expected %v to be rejected with a NominalError, got %v", test.params, err)
+			}
+		}
+	}
+}
+
+func TestCatalogCommandsAreImplemented(t *testing.T) {
+	for _, spec := range catalog.Commands() {
+		if spec.Name == "" {
+			continue
+		}
+		_, err := proxy.ExtractCommandAction(context.Background(), spec.Name, proxy.RequestParameters{})
+		var httpErr *inet.HTTPError
+		if errors.As(err, &httpErr) {
+			t.Errorf("Catalog command %s is not handled by the proxy", spec.Name)
+		}
+	}
+	_, err := proxy.ExtractCommandAction(context.Background(), "teleport", proxy.RequestParameters{})
+	var httpErr *inet.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid_command for unknown command, got %v", err)
+	}
+}
+
+func TestCommandCatalogEndpoint(t *testing.T) {
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/1/commands", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d", w.Code)
+	}
+	var listing struct {
+		Commands []catalog.Command `json:"commands"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listing); err != nil {
+		t.Fatalf("Invalid catalog JSON: %s", err)
+	}
+	if len(listing.Commands) != len(catalog.Commands()) {
+		t.Errorf("Expected %d commands, got %d", len(catalog.Commands()), len(listing.Commands))
+	}
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/1/commands", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", w.Code)
+	}
+}
+
+func TestCommandSchemaEndpoint(t *testing.T) {
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	for _, spec := range catalog.Commands() {
+		if spec.Name == "" {
+			continue
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/1/commands/"+spec.Name+"/schema", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: unexpected status %d", spec.Name, w.Code)
+			continue
+		}
+		var schema catalog.Schema
+		if err := json.Unmarshal(w.Body.Bytes(), &schema); err != nil {
+			t.Errorf("%s: invalid schema: %s", spec.Name, err)
+			continue
+		}
+		for _, param := range spec.Parameters {
+			want := param.Type
+			if param.Integer {
+				want = "integer"
+			}
+			if property, ok := schema.Properties[param.Name]; !ok || property.Type != want {
+				t.Errorf("%s: parameter %s doesn't match schema %+v", spec.Name, param.Name, property)
+			}
+		}
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/1/commands/teleport/schema", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown command, got %d", w.Code)
+	}
+}
+
+func TestInvalidDomainOverride(t *testing.T) {
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/door_lock", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	req.Header.Set("X-Tesla-Domain", "powertrain")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown domain, got %d", w.Code)
+	}
+}
+
+func TestInvalidCommandBodies(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	tests := []struct {
+		command string
+		params  map[string]interface{}
+		reason  string
+	}{
+		{"set_charge_limit", map[string]interface{}{"percent": 40}, "invalid percent param: must be an integer between 50 and 100"},
+		{"remote_seat_heater_request", map[string]interface{}{"seat_position": 9, "level": 1}, "invalid seat_position param: must be an integer between 0 and 8"},
+		{"actuate_trunk", map[string]interface{}{"which_trunk": "side"}, "invalid which_trunk param: must be one of front, rear"},
+		{"trigger_homelink", map[string]interface{}{"lat": 37.4, "lon": 181}, "invalid lon param: must be a number between -180 and 180"},
+	}
+	for _, test := range tests {
+		code, reply := postCommand(t, p, test.command, test.params)
+		if code != http.StatusBadRequest || reply.Response == nil || reply.Response.Reason != test.reason {
+			t.Errorf("%s %v: expected 400 with reason %q, got %d %+v", test.command, test.params, test.reason, code, reply.Response)
+		}
+	}
+	if car.ChargeLimit() == 40 {
+		t.Errorf("Invalid charge limit reached the vehicle")
+	}
+
+	// Unrecognized parameters are ignored unless the proxy is strict.
+	params := map[string]interface{}{"percent": 60, "charge_limit": 60}
+	if code, reply := postCommand(t, p, "set_charge_limit", params); code != http.StatusOK || car.ChargeLimit() != 60 {
+		t.Errorf("Expected unrecognized parameter to be ignored, got %d %+v", code, reply.Response)
+	}
+	p.StrictParameters = true
+	params["percent"] = 70
+	code, reply := postCommand(t, p, "set_charge_limit", params)
+	if code != http.StatusBadRequest || reply.Response == nil || reply.Response.Reason != "unexpected charge_limit param" {
+		t.Errorf("Expected strict proxy to reject unrecognized parameter, got %d %+v", code, reply.Response)
+	}
+	if car.ChargeLimit() == 70 {
+		t.Errorf("Rejected charge limit reached the vehicle")
+	}
+}
+
+func TestExtractCommandActionTypes(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		command string
+		params  proxy.RequestParameters
+		reason  string
+	}{
+		{"adjust_volume", proxy.RequestParameters{"volume": 11.0}, "invalid volume param: must be a number between 0 and 10"},
+		{"remote_seat_cooler_request", proxy.RequestParameters{"seat_position": 1, "seat_cooler_level": 4}, "invalid seat_cooler_level param: must be an integer between 0 and 3"},
+		{"set_cabin_overheat_protection", proxy.RequestParameters{"fan_only": true}, "missing on param"},
+		{"set_off_peak_charging", proxy.RequestParameters{"enabled": true}, "missing end_off_peak_time param"},
+		{"window_control", proxy.RequestParameters{"command": "open"}, "invalid command param: must be one of vent, close"},
+	} {
+		if _, err := proxy.ExtractCommandAction(ctx, test.command, test.params); err == nil || err.Error() != test.reason {
+			t.Errorf("%s %v: expected %q, got %v", test.command, test.params, test.reason, err)
+		}
+	}
+	for command, params := range map[string]proxy.RequestParameters{
+		"remote_seat_cooler_request":    {"seat_position": 1, "seat_cooler_level": 3},
+		"set_cabin_overheat_protection": {"mode": "fan_only"},
+		"add_charge_schedule":           {"days_of_week": "weekdays", "enabled": true, "start_enabled": true, "start_time": 60, "end_enabled": false, "lat": 37.4, "lon": -122.1},
+		"set_scheduled_departure":       {"enable": true, "departure_time": 450, "preconditioning_enabled": true},
+		"window_control":                {"command": "close", "lat": 37.4, "lon": -122.1},
+	} {
+		if action, err := proxy.ExtractCommandAction(ctx, command, params); err != nil || action == nil {
+			t.Errorf("%s %v: unexpected error %v", command, params, err)
+		}
+	}
+}
+
+func TestConditionalCatalogRequests(t *testing.T) {
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w
+	}
+
+	etags := make(map[string]bool)
+	for _, path := range []string{"/api/1/commands", "/api/1/commands/set_charge_limit/schema", "/api/1/commands/honk_horn/schema"} {
+		w := get(path, nil)
+		etag, modified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+		if w.Code != http.StatusOK || etag == "" || modified == "" || w.Header().Get("Cache-Control") != "public, max-age=300" {
+			t.Fatalf("%s: unexpected response %d %v", path, w.Code, w.Header())
+		}
+		if etags[etag] {
+			t.Errorf("%s: ETag %s isn't unique", path, etag)
+		}
+		etags[etag] = true
+
+		if w = get(path, http.Header{"If-None-Match": {`"other", ` + etag}}); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("%s: expected 304 for matching ETag, got %d", path, w.Code)
+		}
+		if w.Header().Get("ETag") != etag {
+			t.Errorf("%s: 304 response is missing ETag", path)
+		}
+		if w = get(path, http.Header{"If-None-Match": {`W/"other"`}}); w.Code != http.StatusOK || w.Body.Len() == 0 {
+			t.Errorf("%s: expected 200 for stale ETag, got %d", path, w.Code)
+		}
+
+		if w = get(path, http.Header{"If-Modified-Since": {modified}}); w.Code != http.StatusNotModified {
+			t.Errorf("%s: expected 304 for current If-Modified-Since, got %d", path, w.Code)
+		}
+		lastModified, err := http.ParseTime(modified)
+		if err != nil {
+			t.Fatal(err)
+		}
+		earlier := lastModified.Add(-time.Hour).Format(http.TimeFormat)
+		if w = get(path, http.Header{"If-Modified-Since": {earlier}}); w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 for earlier If-Modified-Since, got %d", path, w.Code)
+		}
+		// If-None-Match takes precedence over If-Modified-Since.
+		if w = get(path, http.Header{"If-None-Match": {`W/"other"`}, "If-Modified-Since": {modified}}); w.Code != http.StatusOK {
+			t.Errorf("%s: expected If-None-Match to take precedence, got %d", path, w.Code)
+		}
+	}
+}
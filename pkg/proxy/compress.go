@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultCompressionMinBytes is the default size below which responses aren't compressed. Small
+// responses, such as command acknowledgements, don't benefit from compression.
+const DefaultCompressionMinBytes = 1024
+
+// Compress returns a handler that compresses responses from next with gzip or deflate, as
+// negotiated by the request's Accept-Encoding header. Responses shorter than minBytes, responses
+// that already have a Content-Encoding, and event streams are sent uncompressed. A response is
+// also sent uncompressed if the handler flushes it before minBytes have been written, so
+// streaming responses aren't delayed.
+func Compress(next http.Handler, minBytes int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cw := newCompressWriter(w, req, minBytes)
+		if cw == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		defer cw.Close()
+		next.ServeHTTP(cw, req)
+	})
+}
+
+// negotiateEncoding returns the preferred encoding the client accepts, or an empty string. Gzip
+// is preferred over deflate when the client rates them equally.
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "deflate" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && coding == "gzip") {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the start of a response until it knows whether to compress it: either
+// minBytes have been written, or the response is complete or flushed.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minBytes int
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	encoder io.WriteCloser // Nil if the response isn't compressed
+}
+
+// newCompressWriter returns nil if the response to req shouldn't be compressed.
+func newCompressWriter(w http.ResponseWriter, req *http.Request, minBytes int) *compressWriter {
+	if minBytes <= 0 || req.Method == http.MethodHead {
+		return nil
+	}
+	encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+	if encoding == "" {
+		return nil
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	return &compressWriter{ResponseWriter: w, encoding: encoding, minBytes: minBytes}
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if !c.decided {
+		c.buf.Write(p)
+		if c.buf.Len() < c.minBytes && c.compressible() {
+			return len(p), nil
+		}
+		if err := c.decide(c.buf.Len() >= c.minBytes); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if c.encoder != nil {
+		return c.encoder.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// compressible returns false if the handler's headers rule out compression.
+func (c *compressWriter) compressible() bool {
+	header := c.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") {
+		return false
+	}
+	return c.status != http.StatusNoContent && c.status != http.StatusNotModified
+}
+
+// decide writes the response header and the buffered body, compressing them if compress is true
+// and the headers allow it.
+func (c *compressWriter) decide(compress bool) error {
+	c.decided = true
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if compress && c.compressible() {
+		header := c.Header()
+		header.Set("Content-Encoding", c.encoding)
+		header.Del("Content-Length")
+		if c.encoding == "gzip" {
+			c.encoder = gzip.NewWriter(c.ResponseWriter)
+		} else {
+			c.encoder, _ = flate.NewWriter(c.ResponseWriter, flate.DefaultCompression)
+		}
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	if c.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if c.encoder != nil {
+		_, err = c.encoder.Write(c.buf.Bytes())
+	} else {
+		_, err = c.ResponseWriter.Write(c.buf.Bytes())
+	}
+	c.buf.Reset()
+	return err
+}
+
+// Flush sends buffered data to the client. If the response hasn't been compressed yet, it never
+// will be, since the client may be waiting for the data.
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		_ = c.decide(false)
+	}
+	if flusher, ok := c.encoder.(interface{ Flush() error }); ok {
+		_ = flusher.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close completes the response.
+func (c *compressWriter) Close() error {
+	if !c.decided {
+		if c.status == 0 && c.buf.Len() == 0 {
+			// The handler didn't write anything. Let the server send its default response.
+			return nil
+		}
+		if err := c.decide(c.buf.Len() >= c.minBytes); err != nil {
+			return err
+		}
+	}
+	if c.encoder != nil {
+		return c.encoder.Close()
+	}
+	return nil
+}
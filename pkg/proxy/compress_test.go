@@ -0,0 +1,139 @@
+package proxy_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func getWithEncoding(t *testing.T, handler http.Handler, path, acceptEncoding string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func decode(t *testing.T, encoding string, body []byte) []byte {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	case "deflate":
+		r = flate.NewReader(bytes.NewReader(body))
+	default:
+		return body
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Couldn't decode %s response: %s", encoding, err)
+	}
+	return decoded
+}
+
+func TestCompressedResponses(t *testing.T) {
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := proxy.New(context.Background(), skey, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := getWithEncoding(t, p, "/api/1/commands", "")
+	if plain.Code != http.StatusOK || plain.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("Unexpected uncompressed response: %d %v", plain.Code, plain.Header())
+	}
+	if plain.Body.Len() < proxy.DefaultCompressionMinBytes {
+		t.Fatalf("Command catalog is too small (%d bytes) to test compression", plain.Body.Len())
+	}
+
+	tests := map[string]string{
+		"gzip":                    "gzip",
+		"deflate":                 "deflate",
+		"deflate, gzip":           "gzip",
+		"gzip;q=0.5, deflate":     "deflate",
+		"gzip;q=0, br":            "",
+		"identity":                "",
+		"GZIP;q=1.0, deflate;q=1": "gzip",
+	}
+	for acceptEncoding, encoding := range tests {
+		w := getWithEncoding(t, p, "/api/1/commands", acceptEncoding)
+		if got := w.Header().Get("Content-Encoding"); got != encoding {
+			t.Errorf("%s: expected encoding %q, got %q", acceptEncoding, encoding, got)
+			continue
+		}
+		if encoding != "" && w.Body.Len() >= plain.Body.Len() {
+			t.Errorf("%s: response wasn't compressed", acceptEncoding)
+		}
+		if decoded := decode(t, encoding, w.Body.Bytes()); !bytes.Equal(decoded, plain.Body.Bytes()) {
+			t.Errorf("%s: decoded response doesn't match uncompressed response", acceptEncoding)
+		}
+	}
+
+	// Small responses aren't compressed.
+	if w := getWithEncoding(t, p, "/health", "gzip"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != "OK" {
+		t.Errorf("Unexpected health check response: %v %q", w.Header(), w.Body)
+	}
+}
+
+func TestCompressSkipsStreamsAndEncodedResponses(t *testing.T) {
+	large := strings.Repeat("data: {\"soc\":80}\n\n", 200)
+	stream := proxy.Compress(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, large)
+		w.(http.Flusher).Flush()
+	}), 16)
+	if w := getWithEncoding(t, stream, "/events", "gzip"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != large || !w.Flushed {
+		t.Errorf("Event stream was compressed or not flushed")
+	}
+
+	// A response flushed before reaching the threshold is sent as is.
+	flushed := proxy.Compress(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, "first")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, large)
+	}), 16)
+	if w := getWithEncoding(t, flushed, "/", "gzip"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != "first"+large {
+		t.Errorf("Flushed response was compressed")
+	}
+
+	encoded := proxy.Compress(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		io.WriteString(w, large)
+	}), 16)
+	if w := getWithEncoding(t, encoded, "/", "gzip"); w.Header().Get("Content-Encoding") != "br" || w.Body.String() != large {
+		t.Errorf("Already-encoded response was re-encoded")
+	}
+
+	status := proxy.Compress(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, large)
+	}), 16)
+	w := getWithEncoding(t, status, "/", "gzip")
+	if w.Code != http.StatusCreated || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("Unexpected response %d %v", w.Code, w.Header())
+	}
+	if decoded := decode(t, "gzip", w.Body.Bytes()); string(decoded) != large {
+		t.Errorf("Decoded response doesn't match")
+	}
+}
@@ -0,0 +1,119 @@
+package proxy_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rawClient sends requests as written over one connection, like a minimal embedded client.
+type rawClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialRaw(t *testing.T, server *httptest.Server) *rawClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return &rawClient{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// do sends request and returns the response and its body. Responses to HTTP/1.0 requests that
+// don't have a Content-Length are read until the connection closes.
+func (c *rawClient) do(request string) (*http.Response, string) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.conn, request); err != nil {
+		c.t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(c.reader, nil)
+	if err != nil {
+		c.t.Fatalf("Couldn't read response to %q: %s", request, err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+// closed returns true if the server has closed the connection.
+func (c *rawClient) closed() bool {
+	_, err := c.reader.ReadByte()
+	return err == io.EOF
+}
+
+func TestHTTP10(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	// Without keep-alive, the connection is closed after the response.
+	client := dialRaw(t, server)
+	resp, body := client.do("GET /health HTTP/1.0\r\n\r\n")
+	if resp.StatusCode != http.StatusOK || len(resp.TransferEncoding) > 0 || resp.ContentLength != int64(len(body)) {
+		t.Errorf("Unexpected health check response %d %v %d: %q", resp.StatusCode, resp.TransferEncoding, resp.ContentLength, body)
+	}
+	if !resp.Close || !client.closed() {
+		t.Errorf("Expected connection to close after HTTP/1.0 response")
+	}
+
+	// With keep-alive, commands and large documents can share a connection.
+	client = dialRaw(t, server)
+	resp, body = client.do("POST /api/1/vehicles/" + testVIN + "/command/door_unlock HTTP/1.0\r\n" +
+		"Connection: keep-alive\r\nAuthorization: Bearer " + testToken + "\r\nContent-Type: application/json\r\n" +
+		"Content-Length: 2\r\n\r\n{}")
+	if resp.StatusCode != http.StatusOK || resp.Close || car.Locked() {
+		t.Fatalf("Command over HTTP/1.0 failed with status %d (close %v): %s", resp.StatusCode, resp.Close, body)
+	}
+	resp, body = client.do("GET /api/1/commands HTTP/1.0\r\nConnection: keep-alive\r\n\r\n")
+	if resp.StatusCode != http.StatusOK || len(resp.TransferEncoding) > 0 || resp.Close || !strings.Contains(body, `"door_unlock"`) {
+		t.Errorf("Unexpected catalog response %d %v (close %v)", resp.StatusCode, resp.TransferEncoding, resp.Close)
+	}
+
+	// A compressed response has no Content-Length, so it's delimited by closing the connection
+	// instead of chunked encoding.
+	resp, body = client.do("GET /api/1/commands HTTP/1.0\r\nConnection: keep-alive\r\nAccept-Encoding: gzip\r\n\r\n")
+	if resp.Header.Get("Content-Encoding") != "gzip" || len(resp.TransferEncoding) > 0 || !resp.Close || !client.closed() {
+		t.Errorf("Unexpected compressed response %v %v (close %v)", resp.Header, resp.TransferEncoding, resp.Close)
+	}
+	if zr, err := gzip.NewReader(strings.NewReader(body)); err != nil {
+		t.Errorf("Invalid compressed body: %s", err)
+	} else if decoded, err := io.ReadAll(zr); err != nil || !strings.Contains(string(decoded), `"door_unlock"`) {
+		t.Errorf("Invalid compressed body: %v", err)
+	}
+}
+
+func TestConnectionClose(t *testing.T) {
+	p, _ := newTestProxy(t, true)
+	server := httptest.NewServer(p)
+	defer server.Close()
+
+	client := dialRaw(t, server)
+	if resp, _ := client.do("GET /health HTTP/1.1\r\nHost: proxy\r\n\r\n"); resp.Close {
+		t.Fatalf("HTTP/1.1 connection closed without Connection: close")
+	}
+	if resp, _ := client.do("GET /health HTTP/1.1\r\nHost: proxy\r\nConnection: close\r\n\r\n"); !resp.Close || !client.closed() {
+		t.Errorf("Connection wasn't closed after Connection: close")
+	}
+
+	p, _ = newTestProxy(t, true)
+	p.CloseConnections = true
+	closing := httptest.NewServer(p)
+	defer closing.Close()
+	client = dialRaw(t, closing)
+	if resp, _ := client.do("GET /health HTTP/1.1\r\nHost: proxy\r\n\r\n"); !resp.Close || !client.closed() {
+		t.Errorf("Connection wasn't closed with CloseConnections")
+	}
+}
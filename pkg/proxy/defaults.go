@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+	"github.com/teslamotors/vehicle-command/pkg/redact"
+)
+
+// CommandDefaults holds per-vehicle default parameters. When a command for one of the vehicles
+// omits a parameter that has a default, the proxy adds the default before validating the command,
+// authorizing it, and sending it to the vehicle or Fleet API. Parameters in the request always take
+// precedence. CommandDefaults must be created with ParseCommandDefaults or LoadCommandDefaultsFile.
+type CommandDefaults struct {
+	// Vehicles maps VINs to command names to parameters, in the format of the command's JSON body.
+	Vehicles map[string]map[string]RequestParameters `json:"vehicles"`
+}
+
+// ParseCommandDefaults decodes JSON-encoded CommandDefaults, such as
+//
+//	{"vehicles": {"5YJ3E1EA7KF000001": {"set_charge_limit": {"percent": 80}}}}
+//
+// Each default must be a known parameter of the command, with a permitted value.
+func ParseCommandDefaults(data []byte) (*CommandDefaults, error) {
+	var defaults CommandDefaults
+	if err := json.Unmarshal(data, &defaults); err != nil {
+		return nil, err
+	}
+	for vin, commands := range defaults.Vehicles {
+		if len(vin) != vinLength {
+			return nil, fmt.Errorf("invalid VIN %q", vin)
+		}
+		for command, params := range commands {
+			if err := validateDefaults(command, params); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", redact.VIN(vin), command, err)
+			}
+		}
+	}
+	return &defaults, nil
+}
+
+// LoadCommandDefaultsFile reads JSON-encoded CommandDefaults from filename.
+func LoadCommandDefaultsFile(filename string) (*CommandDefaults, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := ParseCommandDefaults(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid defaults file %s: %w", filename, err)
+	}
+	return defaults, nil
+}
+
+func validateDefaults(command string, params RequestParameters) error {
+	spec, ok := catalog.Lookup(command)
+	if !ok {
+		return errors.New("unknown command")
+	}
+	for name, value := range params {
+		param, ok := spec.Parameter(name)
+		if !ok {
+			return fmt.Errorf("unknown parameter %s", name)
+		}
+		if !param.Accepts(value) {
+			return fmt.Errorf("invalid value for %s", name)
+		}
+	}
+	// Defaults that supply every required parameter must form a valid command on their own, which
+	// catches values that are well-typed but out of range. Partial defaults are checked once
+	// they're combined with a request.
+	var paramErr *catalog.ParameterError
+	if err := spec.Validate(params); errors.As(err, &paramErr) && paramErr.Missing {
+		return nil
+	}
+	_, err := ExtractCommandAction(context.Background(), command, params)
+	if errors.Is(err, ErrCommandNotImplemented) || errors.Is(err, ErrCommandUseRESTAPI) {
+		return nil
+	}
+	return err
+}
+
+// WithCommandDefaults makes the proxy fill in parameters that commands omit from defaults.
+func WithCommandDefaults(defaults *CommandDefaults) Option {
+	return func(p *Proxy) {
+		p.defaults = defaults
+	}
+}
+
+// applyDefaults adds the default parameters configured for vin and command that req omits,
+// replacing req's body with the combined parameters.
+func (p *Proxy) applyDefaults(req *http.Request, command, vin string) error {
+	if p.defaults == nil {
+		return nil
+	}
+	defaults := p.defaults.Vehicles[vin][command]
+	if len(defaults) == 0 {
+		return nil
+	}
+	params, err := commandParameters(req, command)
+	if err != nil {
+		return err
+	}
+	if params == nil {
+		params = make(RequestParameters, len(defaults))
+	}
+	applied := false
+	for name, value := range defaults {
+		if _, ok := params[name]; !ok {
+			params[name] = value
+			applied = true
+		}
+	}
+	if !applied {
+		return nil
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+	log.Debug("[%s] Applied default parameters to %s", vin, command)
+	return nil
+}
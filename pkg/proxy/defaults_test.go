@@ -0,0 +1,54 @@
+package proxy_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func TestCommandDefaults(t *testing.T) {
+	defaults, err := proxy.ParseCommandDefaults([]byte(`{"vehicles": {"` + testVIN + `": {
+		"set_charge_limit": {"percent": 65},
+		"set_temps": {"driver_temp": 19.5}
+	}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, car := newTestProxy(t, true, proxy.WithCommandDefaults(defaults))
+
+	if code, reply := postCommand(t, p, "set_charge_limit", nil); code != http.StatusOK || car.ChargeLimit() != 65 {
+		t.Fatalf("Default wasn't applied: %d %+v (limit %d)", code, reply, car.ChargeLimit())
+	}
+	if code, _ := postCommand(t, p, "set_charge_limit", map[string]interface{}{"percent": 70.0}); code != http.StatusOK || car.ChargeLimit() != 70 {
+		t.Errorf("Request parameter didn't override default: %d (limit %d)", code, car.ChargeLimit())
+	}
+
+	// Defaults can supply some of a command's parameters.
+	if code, reply := postCommand(t, p, "set_temps", map[string]interface{}{"passenger_temp": 22.0}); code != http.StatusOK {
+		t.Fatalf("Command with partial defaults failed: %d %+v", code, reply)
+	}
+	if driver, passenger := car.Temperatures(); driver != 19.5 || passenger != 22 {
+		t.Errorf("Unexpected temperatures %v/%v", driver, passenger)
+	}
+	if code, _ := postCommand(t, p, "set_valet_mode", nil); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for command without defaults, got %d", code)
+	}
+}
+
+func TestParseCommandDefaults(t *testing.T) {
+	invalid := map[string]string{
+		"VIN":        `{"vehicles": {"5YJ3": {"set_charge_limit": {"percent": 80}}}}`,
+		"command":    `{"vehicles": {"` + testVIN + `": {"set_charge_limimt": {"percent": 80}}}}`,
+		"parameter":  `{"vehicles": {"` + testVIN + `": {"set_charge_limit": {"percnet": 80}}}}`,
+		"type":       `{"vehicles": {"` + testVIN + `": {"set_charge_limit": {"percent": "80"}}}}`,
+		"enum value": `{"vehicles": {"` + testVIN + `": {"set_cabin_overheat_protection": {"mode": "warm"}}}}`,
+		"value": `{"vehicles": {"` + testVIN + `": {"add_charge_schedule": {"days_of_week": "Funday",
+			"enabled": true, "start_enabled": true, "end_enabled": false, "lat": 37.4, "lon": -122.1}}}}`,
+	}
+	for label, config := range invalid {
+		if _, err := proxy.ParseCommandDefaults([]byte(config)); err == nil {
+			t.Errorf("Expected error for invalid %s", label)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+)
+
+// documentMaxAge is how long clients may use a cached copy of the command catalog or a command
+// schema before revalidating it.
+const documentMaxAge = 5 * time.Minute
+
+// document is a response body that can only change when the proxy binary does, such as the
+// command catalog. Clients revalidate cached copies with If-None-Match or If-Modified-Since.
+type document struct {
+	body        []byte
+	contentType string
+	// etag is weak, since the same document may be sent with or without compression.
+	etag string
+}
+
+func newDocument(body []byte, contentType string) *document {
+	sum := sha256.Sum256(body)
+	return &document{body: body, contentType: contentType, etag: fmt.Sprintf(`W/"%x"`, sum[:16])}
+}
+
+// documents holds the command catalog and the JSON Schema of each command, encoded when the proxy
+// is created.
+type documents struct {
+	catalog *document
+	schemas map[string]*document // Keyed by command name
+	// modified is the Last-Modified time of every document.
+	modified time.Time
+}
+
+func newDocuments(started time.Time) (*documents, error) {
+	body, err := catalog.MarshalJSON("")
+	if err != nil {
+		return nil, err
+	}
+	docs := &documents{
+		catalog:  newDocument(body, "application/json"),
+		schemas:  make(map[string]*document),
+		modified: buildTime(),
+	}
+	if docs.modified.IsZero() {
+		docs.modified = started
+	}
+	for _, spec := range catalog.Commands() {
+		if spec.Name == "" {
+			continue
+		}
+		body, err := json.Marshal(spec.Schema())
+		if err != nil {
+			return nil, err
+		}
+		docs.schemas[spec.Name] = newDocument(body, "application/schema+json")
+	}
+	return docs, nil
+}
+
+// buildTime returns the commit time of the proxy binary's source, or the zero time if it's
+// unknown or the binary was built with uncommitted changes.
+func buildTime() time.Time {
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return time.Time{}
+	}
+	var commit time.Time
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.time":
+			commit, _ = time.Parse(time.RFC3339, setting.Value)
+		case "vcs.modified":
+			if setting.Value == "true" {
+				return time.Time{}
+			}
+		}
+	}
+	return commit
+}
+
+// serve writes doc, or 304 Not Modified if req's validators match it.
+func (d *document) serve(w http.ResponseWriter, req *http.Request, modified time.Time) {
+	header := w.Header()
+	header.Set("Content-Type", d.contentType)
+	header.Set("ETag", d.etag)
+	header.Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(documentMaxAge/time.Second)))
+	http.ServeContent(w, req, "", modified, bytes.NewReader(d.body))
+}
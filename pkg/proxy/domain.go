@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// domainHeader sends a command to the named domain instead of the one that normally handles it.
+// The vehicle rejects commands sent to the wrong domain; the header exists for protocol debugging.
+const domainHeader = "X-Tesla-Domain"
+
+var domainsByName = map[string]protocol.Domain{
+	catalog.DomainVCSEC:        protocol.DomainVCSEC,
+	catalog.DomainInfotainment: protocol.DomainInfotainment,
+}
+
+// domainOverride returns the domain named by req's X-Tesla-Domain header, or protocol.DomainNone
+// if the header is absent.
+func domainOverride(req *http.Request) (protocol.Domain, error) {
+	name := req.Header.Get(domainHeader)
+	if name == "" {
+		return protocol.DomainNone, nil
+	}
+	domain, ok := domainsByName[strings.ToUpper(name)]
+	if !ok {
+		return protocol.DomainNone, fmt.Errorf("invalid %s header %q: expected %s or %s",
+			domainHeader, name, catalog.DomainVCSEC, catalog.DomainInfotainment)
+	}
+	return domain, nil
+}
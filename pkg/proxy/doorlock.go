@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// confirmParam asks door_lock and door_unlock to read back the vehicle's lock state after the
+// vehicle acknowledges the command. door_unlock otherwise ignores the query string, but accepts
+// this parameter there because it only changes the response, not what the vehicle does.
+const confirmParam = "confirm"
+
+// lockCommands maps the commands that accept confirmParam to the lock state they request.
+var lockCommands = map[string]bool{
+	"door_lock":   true,
+	"door_unlock": false,
+}
+
+// reasonInMotion is the reason reported when the vehicle refuses to unlock because it isn't in
+// park.
+const reasonInMotion = "vehicle_in_motion"
+
+// lockConfirmTimeout limits the time spent waiting for the vehicle to report the requested lock
+// state, leaving the rest of the request's timeout for saving the session.
+const lockConfirmTimeout = 3 * time.Second
+
+// lockConfirmInterval is the delay between lock state queries.
+const lockConfirmInterval = 250 * time.Millisecond
+
+// lockState is the lock state observed after door_lock or door_unlock with confirmParam.
+type lockState struct {
+	Locked bool `json:"locked"`
+	// Confirmed is true if the vehicle reported the requested state before lockConfirmTimeout.
+	Confirmed bool `json:"confirmed"`
+}
+
+// addConfirmParam copies confirmParam from req's query string into params for lock commands that
+// don't otherwise accept query parameters. A value in the body takes precedence.
+func addConfirmParam(req *http.Request, command string, params RequestParameters) (RequestParameters, error) {
+	if _, ok := lockCommands[command]; !ok || SupportsQueryParameters(command) {
+		return params, nil
+	}
+	values, ok := req.URL.Query()[confirmParam]
+	if !ok {
+		return params, nil
+	}
+	if len(values) != 1 {
+		return nil, invalidParamError(confirmParam)
+	}
+	confirm, err := coerceParam(catalog.TypeBool, values[0])
+	if err != nil {
+		return nil, invalidParamError(confirmParam)
+	}
+	if params == nil {
+		params = make(RequestParameters)
+	}
+	if _, ok := params[confirmParam]; !ok {
+		params[confirmParam] = confirm
+	}
+	return params, nil
+}
+
+// readLockState polls car until its lock state is want or lockConfirmTimeout expires, and returns
+// the last state it observed.
+func readLockState(ctx context.Context, car *vehicle.Vehicle, want bool) (*lockState, error) {
+	ctx, cancel := context.WithTimeout(ctx, lockConfirmTimeout)
+	defer cancel()
+	var observed *lockState
+	for {
+		locked, err := car.Locked(ctx)
+		if err == nil {
+			observed = &lockState{Locked: locked, Confirmed: locked == want}
+			if observed.Confirmed {
+				return observed, nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			if observed == nil {
+				return nil, err
+			}
+			return observed, nil
+		case <-time.After(lockConfirmInterval):
+		}
+	}
+}
+
+// writeLockResponse reports success along with, if the client asked for confirmation, the lock
+// state the vehicle reported afterwards. As with writeChargeLimitResponse, the command has already
+// succeeded, so the state is omitted if it can't be read.
+func writeLockResponse(ctx context.Context, w http.ResponseWriter, req *http.Request, car *vehicle.Vehicle, command string) {
+	reply := successResponse(ctx, car)
+	params, err := commandParameters(req, command)
+	if confirm, _ := params[confirmParam].(bool); err == nil && confirm {
+		if state, err := readLockState(ctx, car, lockCommands[command]); err == nil {
+			reply.LockState = state
+		} else {
+			log.Warning("Couldn't read lock state after %s: %s", command, err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: reply})
+}
+
+// writeInMotionResponse reports that the vehicle refused to unlock because it isn't in park. Like
+// other refusals, it's an unsuccessful result rather than an error, but with a stable reason.
+func writeInMotionResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: &carResponse{Reason: reasonInMotion}})
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// drainStatus is the response to /admin/drain.
+type drainStatus struct {
+	Draining         bool       `json:"draining"`
+	DrainingSince    *time.Time `json:"draining_since,omitempty"`
+	RequestsInFlight int64      `json:"requests_in_flight"`
+}
+
+// Drain makes the health check at /health fail with 503 Service Unavailable, so that load
+// balancers stop routing new requests to the proxy. Requests that still arrive are handled as
+// usual. Once RequestsInFlight reaches zero, the process can be stopped without interrupting
+// clients. Drain returns false if the proxy was already draining.
+func (p *Proxy) Drain() bool {
+	now := time.Now()
+	return p.drainingSince.CompareAndSwap(nil, &now)
+}
+
+// Resume reverses Drain. It returns false if the proxy wasn't draining.
+func (p *Proxy) Resume() bool {
+	return p.drainingSince.Swap(nil) != nil
+}
+
+// Draining returns true if Drain has been called since the proxy started or last resumed.
+func (p *Proxy) Draining() bool {
+	return p.drainingSince.Load() != nil
+}
+
+// RequestsInFlight returns the number of requests to Fleet API and vehicle routes that the proxy is
+// handling, including asynchronous commands that haven't delivered their callbacks. Health checks,
+// metrics, the command catalog and admin requests aren't counted.
+func (p *Proxy) RequestsInFlight() int64 {
+	return p.metrics.requestsInFlight.Load()
+}
+
+// handleAdminDrain starts draining on POST and resumes on DELETE. Each method, including GET,
+// responds with the draining state.
+func (p *Proxy) handleAdminDrain(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		if p.Drain() {
+			log.Warning("Admin request from %s started draining; health checks will fail", req.RemoteAddr)
+		}
+	case http.MethodDelete:
+		if p.Resume() {
+			log.Warning("Admin request from %s stopped draining", req.RemoteAddr)
+		}
+	}
+	status := &drainStatus{RequestsInFlight: p.RequestsInFlight()}
+	if since := p.drainingSince.Load(); since != nil {
+		t := since.UTC()
+		status.Draining, status.DrainingSince = true, &t
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: status})
+}
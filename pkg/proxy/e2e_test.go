@@ -0,0 +1,985 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	carserver "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// newTestProxy returns a proxy that sends commands to an in-memory vehicle. If paired is true,
+// the vehicle's keychain contains the proxy's key. Options can replace the proxy's dialer.
+func newTestProxy(t testing.TB, paired bool, options ...proxy.Option) (*proxy.Proxy, *vehicletest.Vehicle) {
+	t.Helper()
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	car := vehicletest.New(testVIN)
+	if paired {
+		car.Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+	}
+	dial := func(context.Context, *account.Account, string) (connector.Connector, error) {
+		return car.Connect(), nil
+	}
+	p, err := proxy.New(context.Background(), skey, 1, append([]proxy.Option{proxy.WithDialer(dial)}, options...)...)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	return p, car
+}
+
+// sampleParameters returns a valid JSON body for spec.
+func sampleParameters(spec *catalog.Command) map[string]interface{} {
+	overrides := map[string]map[string]interface{}{
+		"add_charge_schedule":           {"days_of_week": "Monday"},
+		"add_precondition_schedule":     {"days_of_week": "Monday"},
+		"set_cabin_overheat_protection": {"on": true},
+		"set_off_peak_charging":         {"end_off_peak_time": 360.0},
+		"set_temps":                     {"driver_temp": 21.0, "passenger_temp": 21.0},
+		"set_valet_mode":                {"password": "1234"},
+		"speed_limit_activate":          {"pin": "1234"},
+		"speed_limit_deactivate":        {"pin": "1234"},
+		"speed_limit_clear_pin":         {"pin": "1234"},
+	}
+	params := make(map[string]interface{})
+	for _, param := range spec.Parameters {
+		if !param.Required {
+			continue
+		}
+		switch {
+		case len(param.Values) > 0:
+			params[param.Name] = param.Values[0]
+		case param.Type == catalog.TypeBool:
+			params[param.Name] = true
+		case param.Type == catalog.TypeNumber && param.Minimum != nil:
+			params[param.Name] = *param.Minimum
+		case param.Type == catalog.TypeNumber:
+			params[param.Name] = 1.0
+		default:
+			params[param.Name] = "1"
+		}
+	}
+	for name, value := range overrides[spec.Name] {
+		params[name] = value
+	}
+	return params
+}
+
+type commandResponse struct {
+	Response *struct {
+		Result         bool     `json:"result"`
+		Reason         string   `json:"reason"`
+		ChargeLimitSOC *int32   `json:"charge_limit_soc"`
+		DriverTemp     *float32 `json:"driver_temp"`
+		PassengerTemp  *float32 `json:"passenger_temp"`
+
+		OffPeakCharging *struct {
+			Enabled        bool `json:"enabled"`
+			WeekdaysOnly   bool `json:"weekdays_only"`
+			EndOffPeakTime int  `json:"end_off_peak_time"`
+		} `json:"off_peak_charging"`
+
+		Location *struct {
+			Latitude  float64  `json:"latitude"`
+			Longitude float64  `json:"longitude"`
+			Heading   *float64 `json:"heading"`
+			Speed     *float64 `json:"speed"`
+		} `json:"location"`
+
+		ChargeState *struct {
+			ChargingState  string  `json:"charging_state"`
+			BatteryLevel   int32   `json:"battery_level_percent"`
+			RangeMiles     float64 `json:"range_mi"`
+			RangeKM        float64 `json:"range_km"`
+			ChargerPowerKW float64 `json:"charger_power_kw"`
+			MinutesToFull  *int    `json:"minutes_to_full"`
+			DisplayUnits   *string `json:"display_units"`
+		} `json:"charge_state"`
+
+		LockState *struct {
+			Locked    bool `json:"locked"`
+			Confirmed bool `json:"confirmed"`
+		} `json:"lock_state"`
+
+		Timing *struct {
+			Handshake float64 `json:"handshake_ms"`
+			Signing   float64 `json:"signing_ms"`
+			RoundTrip float64 `json:"round_trip_ms"`
+			Retries   *int    `json:"retries"`
+		} `json:"timing"`
+
+		Messages []struct {
+			Domain      string                     `json:"domain"`
+			FromVehicle bool                       `json:"from_vehicle"`
+			Payload     map[string]json.RawMessage `json:"payload"`
+		} `json:"messages"`
+	} `json:"response"`
+	Error string `json:"error"`
+}
+
+func postCommand(t testing.TB, p *proxy.Proxy, command string, params map[string]interface{}) (int, *commandResponse) {
+	t.Helper()
+	body, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/"+command, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s: expected JSON response, got %q", command, ct)
+	}
+	var reply commandResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatalf("%s: invalid response %q: %s", command, w.Body.String(), err)
+	}
+	return w.Code, &reply
+}
+
+// chargingState is a charge state for vehicletest.Vehicle.SetChargeState.
+var chargingState = &carserver.ChargeState{
+	ChargingState: &carserver.ChargeState_ChargingState{
+		Type: &carserver.ChargeState_ChargingState_Charging{Charging: &carserver.Void{}},
+	},
+	OptionalBatteryLevel:        &carserver.ChargeState_BatteryLevel{BatteryLevel: 62},
+	OptionalBatteryRange:        &carserver.ChargeState_BatteryRange{BatteryRange: 200.04},
+	OptionalChargerPower:        &carserver.ChargeState_ChargerPower{ChargerPower: 11},
+	OptionalMinutesToFullCharge: &carserver.ChargeState_MinutesToFullCharge{MinutesToFullCharge: 95},
+}
+
+// displayUnits returns a proxy.DisplayUnitsResolver that reports units without contacting Fleet
+// API, and counts its calls in lookups if lookups is non-nil.
+func displayUnits(units string, lookups *int) proxy.DisplayUnitsResolver {
+	return func(context.Context, *account.Account, string) (string, error) {
+		if lookups != nil {
+			*lookups++
+		}
+		return units, nil
+	}
+}
+
+func TestEndToEndCommands(t *testing.T) {
+	p, car := newTestProxy(t, true, proxy.WithDisplayUnitsResolver(displayUnits("mi", nil)))
+	p.AllowLocation = true
+	p.AllowSpeedLimit = true
+	car.SetLocation(37.5, -122.25, 90, 0)
+	car.SetChargeState(chargingState)
+	for _, spec := range catalog.Commands() {
+		if spec.Name == "" || spec.Handling != catalog.HandlingSigned {
+			continue
+		}
+		if spec.Name == "set_pin_to_drive" {
+			// The vehicle package only sends this command through Fleet API, which encrypts the PIN.
+			continue
+		}
+		if spec.Name == "wake_up" {
+			// Vehicles that are already awake aren't sent a wake command.
+			car.SetAsleep(true)
+		}
+		before := len(car.Commands())
+		code, reply := postCommand(t, p, spec.Name, sampleParameters(&spec))
+		if code != http.StatusOK || reply.Response == nil || !reply.Response.Result || reply.Error != "" {
+			t.Errorf("%s: unexpected response %d %+v", spec.Name, code, reply)
+			continue
+		}
+		if len(car.Commands()) == before {
+			t.Errorf("%s: vehicle didn't receive a command", spec.Name)
+		}
+	}
+}
+
+func TestEndToEndVehicleState(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	if code, _ := postCommand(t, p, "door_unlock", nil); code != http.StatusOK || car.Locked() {
+		t.Errorf("Expected door_unlock to unlock vehicle (status %d)", code)
+	}
+	if code, _ := postCommand(t, p, "door_lock", nil); code != http.StatusOK || !car.Locked() {
+		t.Errorf("Expected door_lock to lock vehicle (status %d)", code)
+	}
+}
+
+func TestEndToEndLockConfirmation(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	if _, reply := postCommand(t, p, "door_unlock", nil); reply.Response == nil || reply.Response.LockState != nil {
+		t.Errorf("Lock state included without confirm: %+v", reply)
+	}
+	for _, tt := range []struct {
+		command string
+		params  map[string]interface{}
+		locked  bool
+	}{
+		{"door_lock?confirm=true", nil, true},
+		{"door_unlock?confirm=1", nil, false},
+		{"door_lock", map[string]interface{}{"confirm": true}, true},
+	} {
+		code, reply := postCommand(t, p, tt.command, tt.params)
+		if code != http.StatusOK || reply.Response == nil || !reply.Response.Result {
+			t.Fatalf("%s failed: %d %+v", tt.command, code, reply)
+		}
+		state := reply.Response.LockState
+		if state == nil || state.Locked != tt.locked || !state.Confirmed || car.Locked() != tt.locked {
+			t.Errorf("%s: unexpected lock state %+v", tt.command, state)
+		}
+	}
+	if code, _ := postCommand(t, p, "door_unlock?confirm=maybe", nil); code != http.StatusBadRequest {
+		t.Errorf("Expected invalid confirm param to be rejected, got %d", code)
+	}
+}
+
+func TestEndToEndUnlockInMotion(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	car.SetLocation(37.5, -122.25, 90, 30)
+	code, reply := postCommand(t, p, "door_unlock?confirm=true", nil)
+	if code != http.StatusOK || reply.Response == nil || reply.Response.Result || reply.Response.Reason != "vehicle_in_motion" {
+		t.Errorf("Expected vehicle_in_motion, got %d %+v", code, reply.Response)
+	}
+	if !car.Locked() {
+		t.Error("Vehicle unlocked while in motion")
+	}
+	if _, reply := postCommand(t, p, "door_lock", nil); reply.Response == nil || !reply.Response.Result {
+		t.Errorf("Expected door_lock to succeed in motion, got %+v", reply.Response)
+	}
+}
+
+func TestEndToEndTiming(t *testing.T) {
+	p, _ := newTestProxy(t, true)
+	if _, reply := postCommand(t, p, "door_lock", nil); reply.Response == nil || reply.Response.Timing != nil {
+		t.Errorf("Timing included without IncludeTiming: %+v", reply)
+	}
+
+	p.IncludeTiming = true
+	_, reply := postCommand(t, p, "door_unlock", nil)
+	if reply.Response == nil || reply.Response.Timing == nil {
+		t.Fatalf("Expected timing in response: %+v", reply)
+	}
+	timing := reply.Response.Timing
+	if timing.Handshake <= 0 || timing.Signing <= 0 || timing.RoundTrip <= 0 || timing.Retries == nil {
+		t.Errorf("Incomplete timing %+v", timing)
+	}
+}
+
+func TestEndToEndMessages(t *testing.T) {
+	p, _ := newTestProxy(t, true)
+	if _, reply := postCommand(t, p, "door_lock", nil); reply.Response == nil || reply.Response.Messages != nil {
+		t.Errorf("Messages included without IncludeMessages: %+v", reply)
+	}
+
+	p.IncludeMessages = true
+	_, reply := postCommand(t, p, "door_unlock", nil)
+	if reply.Response == nil || len(reply.Response.Messages) < 2 {
+		t.Fatalf("Expected messages in response: %+v", reply)
+	}
+	request := reply.Response.Messages[0]
+	if request.Domain != "DOMAIN_VEHICLE_SECURITY" || request.FromVehicle {
+		t.Errorf("Unexpected first message %+v", request)
+	}
+	if action := string(request.Payload["RKEAction"]); action != `"RKE_ACTION_UNLOCK"` {
+		t.Errorf("Expected RKE_ACTION_UNLOCK, got %s in %+v", action, request)
+	}
+	if last := reply.Response.Messages[len(reply.Response.Messages)-1]; !last.FromVehicle {
+		t.Errorf("Expected the vehicle's reply last, got %+v", last)
+	}
+}
+
+func TestEndToEndChargeLimitPresets(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	for command, want := range map[string]int32{
+		"charge_standard":  vehicletest.StandardChargeLimit,
+		"charge_max_range": vehicletest.MaxChargeLimit,
+	} {
+		code, reply := postCommand(t, p, command, nil)
+		if code != http.StatusOK || reply.Response == nil || !reply.Response.Result {
+			t.Fatalf("%s failed: %d %+v", command, code, reply)
+		}
+		if got := reply.Response.ChargeLimitSOC; got == nil || *got != want || car.ChargeLimit() != want {
+			t.Errorf("%s: expected charge limit %d, got %v", command, want, got)
+		}
+	}
+	// Other commands don't report the charge limit.
+	if _, reply := postCommand(t, p, "set_charge_limit", map[string]interface{}{"percent": 70}); reply.Response.ChargeLimitSOC != nil {
+		t.Errorf("Unexpected charge limit in set_charge_limit response")
+	}
+}
+
+func TestEndToEndChargeLimitAlreadySet(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	car.RejectCommands("already_max_range")
+	code, reply := postCommand(t, p, "charge_max_range", nil)
+	if code != http.StatusOK || reply.Response == nil || !reply.Response.Result || reply.Response.Reason != "already_max_range" {
+		t.Errorf("Expected success with reason, got %d %+v", code, reply.Response)
+	}
+
+	car.RejectCommands("not_charging")
+	if _, reply := postCommand(t, p, "charge_standard", nil); reply.Response == nil || reply.Response.Result {
+		t.Errorf("Expected charge_standard to fail, got %+v", reply.Response)
+	}
+}
+
+func TestEndToEndOffPeakCharging(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	code, reply := postCommand(t, p, "set_off_peak_charging", map[string]interface{}{
+		"enabled":           true,
+		"weekdays_only":     true,
+		"end_off_peak_time": 390,
+	})
+	if code != http.StatusOK || reply.Response == nil || !reply.Response.Result {
+		t.Fatalf("set_off_peak_charging failed: %d %+v", code, reply)
+	}
+	if settings := reply.Response.OffPeakCharging; settings == nil || !settings.Enabled || !settings.WeekdaysOnly || settings.EndOffPeakTime != 390 {
+		t.Errorf("Unexpected settings in response: %+v", settings)
+	}
+	if departure := car.ScheduledDeparture(); departure.GetOffPeakHoursEndTime() != 390 {
+		t.Errorf("Vehicle has unexpected departure settings: %v", departure)
+	}
+
+	code, reply = postCommand(t, p, "get_off_peak_charging", nil)
+	if code != http.StatusOK || reply.Response.OffPeakCharging == nil || reply.Response.OffPeakCharging.EndOffPeakTime != 390 {
+		t.Errorf("Unexpected get_off_peak_charging response: %d %+v", code, reply.Response)
+	}
+
+	for _, params := range []map[string]interface{}{
+		{"enabled": true},
+		{"enabled": true, "end_off_peak_time": 1440},
+		{"enabled": true, "end_off_peak_time": 60.5},
+	} {
+		if code, _ := postCommand(t, p, "set_off_peak_charging", params); code != http.StatusBadRequest {
+			t.Errorf("Expected %v to be rejected, got %d", params, code)
+		}
+	}
+
+	car.RejectCommands("disabled_by_utility")
+	if _, reply := postCommand(t, p, "set_off_peak_charging", map[string]interface{}{"enabled": false}); reply.Response == nil || reply.Response.Result || !strings.Contains(reply.Response.Reason, "disabled_by_utility") {
+		t.Errorf("Expected vehicle's reason to be reported, got %+v", reply.Response)
+	}
+}
+
+func TestEndToEndTemperatures(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	code, reply := postCommand(t, p, "set_temps", map[string]interface{}{"driver_temp": 21.3, "passenger_temp": 30})
+	if code != http.StatusBadRequest || reply.Error == "" {
+		t.Errorf("Expected out-of-range temperature to be rejected, got %d %+v", code, reply)
+	}
+	if driver, passenger := car.Temperatures(); driver != 21 || passenger != 21 {
+		t.Errorf("Rejected command changed temperatures to %v, %v", driver, passenger)
+	}
+
+	code, reply = postCommand(t, p, "set_temps", map[string]interface{}{"driver_temp": 21.3, "passenger_temp": 23})
+	if code != http.StatusOK || reply.Response == nil || !reply.Response.Result {
+		t.Fatalf("set_temps failed: %d %+v", code, reply)
+	}
+	// The vehicle rounds setpoints to the nearest half degree.
+	if got := reply.Response.DriverTemp; got == nil || *got != 21.5 {
+		t.Errorf("Expected driver temperature 21.5, got %v", got)
+	}
+	if got := reply.Response.PassengerTemp; got == nil || *got != 23 {
+		t.Errorf("Expected passenger temperature 23, got %v", got)
+	}
+}
+
+func TestEndToEndLocation(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	car.SetLocation(37.5, -122.25, 270, 25)
+
+	code, reply := postCommand(t, p, "get_location", nil)
+	if code != http.StatusForbidden || !strings.Contains(reply.Error, "-allow-location") {
+		t.Errorf("Expected location to be disabled, got %d %+v", code, reply)
+	}
+	if len(car.Commands()) != 0 {
+		t.Errorf("Vehicle was contacted while location was disabled")
+	}
+
+	p.AllowLocation = true
+	code, reply = postCommand(t, p, "get_location", nil)
+	if code != http.StatusOK || reply.Response == nil || !reply.Response.Result {
+		t.Fatalf("Unexpected response %d %+v", code, reply)
+	}
+	location := reply.Response.Location
+	if location == nil || location.Latitude != 37.5 || location.Longitude != -122.25 {
+		t.Fatalf("Unexpected location %+v", location)
+	}
+	if location.Heading == nil || *location.Heading != 270 || location.Speed == nil || *location.Speed != 25 {
+		t.Errorf("Unexpected heading or speed %+v", location)
+	}
+}
+
+func TestEndToEndChargeState(t *testing.T) {
+	lookups := 0
+	fakeClock := clock.NewFake(time.Now())
+	p, car := newTestProxy(t, true, proxy.WithDisplayUnitsResolver(displayUnits("km", &lookups)), proxy.WithClock(fakeClock))
+
+	code, reply := postCommand(t, p, "get_charge_state", nil)
+	if code != http.StatusOK || reply.Response == nil || reply.Response.Result || reply.Response.ChargeState != nil {
+		t.Errorf("Expected unsuccessful result before the vehicle reports a battery level, got %d %+v", code, reply)
+	}
+
+	car.SetChargeState(chargingState)
+	for i := 0; i < 2; i++ {
+		code, reply = postCommand(t, p, "get_charge_state", nil)
+		if code != http.StatusOK || reply.Response == nil || !reply.Response.Result {
+			t.Fatalf("Unexpected response %d %+v", code, reply)
+		}
+	}
+	state := reply.Response.ChargeState
+	if state == nil || state.ChargingState != "charging" || state.BatteryLevel != 62 || state.ChargerPowerKW != 11 {
+		t.Fatalf("Unexpected charge state %+v", state)
+	}
+	if state.RangeMiles != 200 || state.RangeKM != 321.9 {
+		t.Errorf("Unexpected range %v mi, %v km", state.RangeMiles, state.RangeKM)
+	}
+	if state.MinutesToFull == nil || *state.MinutesToFull != 95 {
+		t.Errorf("Unexpected time to full %v", state.MinutesToFull)
+	}
+	if state.DisplayUnits == nil || *state.DisplayUnits != "km" || lookups != 1 {
+		t.Errorf("Expected one lookup of display units, got %v after %d", state.DisplayUnits, lookups)
+	}
+
+	// Cached display units expire after an hour.
+	fakeClock.Advance(time.Hour)
+	if code, reply = postCommand(t, p, "get_charge_state", nil); code != http.StatusOK || lookups != 2 {
+		t.Errorf("Expected display units to be looked up again, got %d %+v after %d lookups", code, reply, lookups)
+	}
+}
+
+func TestUnavailableVehicles(t *testing.T) {
+	status := &account.VehicleStatus{State: account.VehicleStateOnline, InService: true}
+	lookups := 0
+	resolve := func(context.Context, *account.Account, string) (*account.VehicleStatus, error) {
+		lookups++
+		return status, nil
+	}
+	fakeClock := clock.NewFake(time.Now())
+	p, car := newTestProxy(t, true, proxy.WithVehicleStatusResolver(resolve), proxy.WithClock(fakeClock))
+	send := func(force string) (int, *proxy.Response) {
+		req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/honk_horn", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		if force != "" {
+			req.Header.Set("X-Tesla-Force-Attempt", force)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		var reply proxy.Response
+		if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+			t.Fatalf("Invalid response %q: %s", w.Body.String(), err)
+		}
+		return w.Code, &reply
+	}
+
+	code, reply := send("")
+	if code != http.StatusConflict || reply.Error != account.ErrVehicleInService.Error() || !strings.Contains(reply.ErrDetails, "X-Tesla-Force-Attempt") {
+		t.Errorf("Expected 409 for vehicle in service, got %d %+v", code, reply)
+	}
+	if len(car.Commands()) != 0 {
+		t.Errorf("Vehicle in service was contacted")
+	}
+
+	// The status is cached, so changing it has no effect until it expires.
+	status = &account.VehicleStatus{State: account.VehicleStateOffline}
+	if code, _ = send(""); code != http.StatusConflict || lookups != 1 {
+		t.Errorf("Expected cached status, got %d after %d lookups", code, lookups)
+	}
+	if code, _ = send("maybe"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid override header, got %d", code)
+	}
+	if code, reply = send("true"); code != http.StatusOK {
+		t.Errorf("Expected override header to force the command, got %d %+v", code, reply)
+	}
+
+	// Cached statuses expire after 30 seconds.
+	fakeClock.Advance(30 * time.Second)
+	if code, _ = send(""); code != http.StatusServiceUnavailable || lookups != 2 {
+		t.Errorf("Expected expired status to be looked up again, got %d after %d lookups", code, lookups)
+	}
+
+	p, car = newTestProxy(t, true, proxy.WithVehicleStatusResolver(resolve))
+	if code, reply = send(""); code != http.StatusServiceUnavailable || reply.Error != account.ErrVehicleOffline.Error() {
+		t.Errorf("Expected 503 for offline vehicle, got %d %+v", code, reply)
+	}
+	if len(car.Commands()) != 0 {
+		t.Errorf("Offline vehicle was contacted")
+	}
+
+	status = &account.VehicleStatus{State: account.VehicleStateAsleep}
+	p, _ = newTestProxy(t, true, proxy.WithVehicleStatusResolver(resolve))
+	if code, reply = send(""); code != http.StatusOK {
+		t.Errorf("Expected command to sleeping vehicle to be attempted, got %d %+v", code, reply)
+	}
+}
+
+func TestUnsupportedCommands(t *testing.T) {
+	lookups := 0
+	resolve := func(context.Context, *account.Account, string) (vehicle.Capabilities, error) {
+		lookups++
+		return vehicle.Capabilities{vehicle.CapabilityTonneau: false}, nil
+	}
+	p, car := newTestProxy(t, true, proxy.WithCapabilityResolver(resolve))
+	send := func(command string, force bool) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/"+command, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		if force {
+			req.Header.Set("X-Tesla-Force-Attempt", "true")
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	code, body := send("open_tonneau", false)
+	if code != http.StatusUnprocessableEntity || !strings.Contains(body, `"capability":"tonneau"`) {
+		t.Errorf("Expected 422 naming the tonneau, got %d %s", code, body)
+	}
+	if len(car.Commands()) != 0 {
+		t.Errorf("Vehicle was contacted")
+	}
+	if code, _ = send("close_tonneau", false); code != http.StatusUnprocessableEntity || lookups != 1 {
+		t.Errorf("Expected cached capabilities, got %d after %d lookups", code, lookups)
+	}
+	if code, body = send("open_tonneau", true); code == http.StatusUnprocessableEntity {
+		t.Errorf("Expected override header to skip the check, got %d %s", code, body)
+	}
+	if code, body = send("honk_horn", false); code != http.StatusOK {
+		t.Errorf("Expected honk_horn to succeed, got %d %s", code, body)
+	}
+}
+
+func TestBulkChargeLimit(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	send := func(body string) (int, *proxy.BulkChargeLimitResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/api/1/bulk/set_charge_limit", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		var reply struct {
+			Response *proxy.BulkChargeLimitResponse `json:"response"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+			t.Fatalf("Invalid response %q: %s", w.Body.String(), err)
+		}
+		return w.Code, reply.Response
+	}
+
+	const invalidVIN = "5YJ3E1EA7KF000000"
+	code, reply := send(`{"percent":80,"vins":["` + testVIN + `"],"overrides":{"` + invalidVIN + `":40,"short":90}}`)
+	if code != http.StatusOK || reply == nil {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if reply.Succeeded != 1 || reply.Failed != 2 || len(reply.Results) != 3 {
+		t.Errorf("Unexpected results %+v", reply)
+	}
+	if result := reply.Results[testVIN]; result == nil || result.Status != http.StatusOK || result.Percent != 80 {
+		t.Errorf("Expected %s to succeed, got %+v", testVIN, result)
+	}
+	if result := reply.Results[invalidVIN]; result == nil || result.Status != http.StatusBadRequest || !strings.Contains(string(result.Body), "between 50 and 100") {
+		t.Errorf("Expected invalid limit to be rejected, got %+v", result)
+	}
+	if result := reply.Results["short"]; result == nil || result.Status != http.StatusBadRequest {
+		t.Errorf("Expected invalid VIN to be rejected, got %+v", result)
+	}
+	if commands := car.Commands(); len(commands) != 1 {
+		t.Errorf("Expected 1 command, got %d", len(commands))
+	}
+
+	// A vehicle that refuses the command fails, even though its status is 200 OK.
+	car.RejectCommands("not_allowed")
+	code, reply = send(`{"percent":70,"vins":["` + testVIN + `"]}`)
+	if code != http.StatusOK || reply == nil || reply.Succeeded != 0 || reply.Failed != 1 {
+		t.Errorf("Expected refused command to count as a failure, got %d %+v", code, reply)
+	}
+	car.RejectCommands("")
+
+	for _, body := range []string{
+		`{}`,
+		`{"vins":["` + testVIN + `"]}`,
+		`{"percent":80,"vins":["` + testVIN + `","` + testVIN + `"]}`,
+		`{"percent":80,"vins":["` + testVIN + `"],"overrides":{"` + testVIN + `":90}}`,
+		`not json`,
+	} {
+		if code, _ := send(body); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, code)
+		}
+	}
+}
+
+func TestSpeedLimitMode(t *testing.T) {
+	p, car := newTestProxy(t, true)
+
+	code, reply := postCommand(t, p, "speed_limit_activate", map[string]interface{}{"pin": "1234"})
+	if code != http.StatusForbidden || !strings.Contains(reply.Error, "-allow-speed-limit") {
+		t.Errorf("Expected speed limit commands to be disabled, got %d %+v", code, reply)
+	}
+	if len(car.Commands()) != 0 {
+		t.Errorf("Vehicle was contacted while speed limit commands were disabled")
+	}
+
+	p.AllowSpeedLimit = true
+	for _, test := range []struct {
+		command string
+		params  map[string]interface{}
+	}{
+		{"speed_limit_activate", map[string]interface{}{"pin": "98765"}},
+		{"speed_limit_activate", map[string]interface{}{"pin": "12a4"}},
+		{"speed_limit_activate", map[string]interface{}{"pin": 1234.0}},
+		{"speed_limit_set_limit", map[string]interface{}{"limit_mph": 49.0}},
+		{"speed_limit_set_limit", map[string]interface{}{"limit_mph": 121.0}},
+	} {
+		code, reply := postCommand(t, p, test.command, test.params)
+		if code != http.StatusBadRequest {
+			t.Errorf("%s %v: expected 400, got %d %+v", test.command, test.params, code, reply)
+		}
+		if strings.Contains(reply.Error, "98765") || strings.Contains(reply.Error, "12a4") {
+			t.Errorf("Error response includes the PIN: %s", reply.Error)
+		}
+	}
+	if len(car.Commands()) != 0 {
+		t.Errorf("Vehicle received invalid speed limit commands")
+	}
+
+	if code, reply := postCommand(t, p, "speed_limit_set_limit", map[string]interface{}{"limit_mph": 70.0}); code != http.StatusOK || !reply.Response.Result {
+		t.Fatalf("Unexpected response to speed_limit_set_limit: %d %+v", code, reply)
+	}
+	if code, reply := postCommand(t, p, "speed_limit_activate", map[string]interface{}{"pin": "1234"}); code != http.StatusOK || !reply.Response.Result {
+		t.Fatalf("Unexpected response to speed_limit_activate: %d %+v", code, reply)
+	}
+	if state := car.SpeedLimit(); !state.Active || state.PIN != "1234" || state.LimitMPH != 70 {
+		t.Errorf("Unexpected speed limit state %+v", state)
+	}
+
+	// The vehicle's reason for rejecting a command is passed on to the client.
+	code, reply = postCommand(t, p, "speed_limit_deactivate", map[string]interface{}{"pin": "4321"})
+	if code != http.StatusOK || reply.Response == nil || reply.Response.Result || !strings.Contains(reply.Response.Reason, "invalid_pin") {
+		t.Errorf("Unexpected response to wrong PIN: %d %+v", code, reply)
+	}
+
+	// Changing the PIN takes two commands.
+	if code, _ := postCommand(t, p, "speed_limit_clear_pin", map[string]interface{}{"pin": "1234"}); code != http.StatusOK {
+		t.Errorf("Couldn't clear PIN: %d", code)
+	}
+	if code, _ := postCommand(t, p, "speed_limit_activate", map[string]interface{}{"pin": "5678"}); code != http.StatusOK {
+		t.Errorf("Couldn't activate with new PIN: %d", code)
+	}
+	if state := car.SpeedLimit(); !state.Active || state.PIN != "5678" {
+		t.Errorf("Unexpected speed limit state after changing PIN %+v", state)
+	}
+}
+
+func TestCabinOverheatProtection(t *testing.T) {
+	p, car := newTestProxy(t, true)
+
+	// The simulated vehicle doesn't support fan-only mode until told to.
+	code, reply := postCommand(t, p, "set_cabin_overheat_protection", map[string]interface{}{"mode": "no_ac"})
+	if code != http.StatusOK || reply.Response == nil || reply.Response.Result || !strings.Contains(reply.Response.Reason, "fan_only_not_supported") {
+		t.Errorf("Unexpected response to unsupported mode: %d %+v", code, reply)
+	}
+	car.SupportFanOnlyCabinOverheatProtection(true)
+
+	tests := []struct {
+		params map[string]interface{}
+		want   carserver.ClimateState_CabinOverheatProtection_E
+	}{
+		{map[string]interface{}{"mode": "no_ac"}, carserver.ClimateState_CabinOverheatProtectionFanOnly},
+		{map[string]interface{}{"mode": "off"}, carserver.ClimateState_CabinOverheatProtectionOff},
+		{map[string]interface{}{"mode": "on"}, carserver.ClimateState_CabinOverheatProtectionOn},
+		{map[string]interface{}{"on": true, "fan_only": true}, carserver.ClimateState_CabinOverheatProtectionFanOnly},
+		{map[string]interface{}{"on": false}, carserver.ClimateState_CabinOverheatProtectionOff},
+	}
+	for _, test := range tests {
+		code, reply := postCommand(t, p, "set_cabin_overheat_protection", test.params)
+		if code != http.StatusOK || reply.Response == nil || !reply.Response.Result {
+			t.Errorf("Unexpected response to %v: %d %+v", test.params, code, reply)
+		}
+		if mode := car.CabinOverheatProtection(); mode != test.want {
+			t.Errorf("Mode after %v is %s, expected %s", test.params, mode, test.want)
+		}
+	}
+
+	for _, params := range []map[string]interface{}{{"mode": "max"}, {"fan_only": true}} {
+		if code, _ := postCommand(t, p, "set_cabin_overheat_protection", params); code != http.StatusBadRequest {
+			t.Errorf("Expected %v to be rejected, got status %d", params, code)
+		}
+	}
+}
+
+func TestCommandByVehicleID(t *testing.T) {
+	const vehicleID = "1492931337154643"
+	resolve := func(_ context.Context, _ *account.Account, id string) (string, error) {
+		if id == vehicleID {
+			return testVIN, nil
+		}
+		return "", account.ErrUnknownVehicleID
+	}
+	p, car := newTestProxy(t, true, proxy.WithVINResolver(resolve))
+	send := func(id string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+id+"/command/door_unlock", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := send(vehicleID); code != http.StatusOK || car.Locked() {
+		t.Errorf("Command sent by vehicle ID failed with status %d", code)
+	}
+	if code := send("1234"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown vehicle ID, got %d", code)
+	}
+}
+
+func TestCommandProtocolProbe(t *testing.T) {
+	p, _ := newTestProxy(t, false)
+	probe := func() (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/api/1/vehicles/"+testVIN+"/command_protocol", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+	// The probe doesn't require the proxy's key to be paired.
+	if code, body := probe(); code != http.StatusOK || !strings.Contains(body, `"signed_commands":true,"cached":false`) {
+		t.Errorf("Unexpected probe response %d %s", code, body)
+	}
+	if code, body := probe(); code != http.StatusOK || !strings.Contains(body, `"signed_commands":true,"cached":true`) {
+		t.Errorf("Probe result wasn't cached: %d %s", code, body)
+	}
+}
+
+// fakeFleetAPI starts a server that stands in for Fleet API until the test ends, and returns its
+// host. It calls record for each request that the proxy forwards, and replies with a successful
+// command result.
+func fakeFleetAPI(t *testing.T, record http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		record(w, req)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"response":{"result":true,"reason":""}}`))
+	}))
+	// The proxy forwards requests with the default transport, which doesn't trust the server's
+	// certificate.
+	transport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	t.Cleanup(func() {
+		http.DefaultTransport = transport
+		server.Close()
+	})
+	return server.Listener.Addr().String()
+}
+
+// unsignedConnector is a connection to a vehicle that doesn't support the signed command
+// protocol.
+type unsignedConnector struct {
+	receive chan []byte
+}
+
+func (c *unsignedConnector) Receive() <-chan []byte { return c.receive }
+func (c *unsignedConnector) Send(context.Context, []byte) error {
+	return protocol.ErrProtocolNotSupported
+}
+func (c *unsignedConnector) VIN() string { return testVIN }
+func (c *unsignedConnector) Close()      {}
+func (c *unsignedConnector) PreferredAuthMethod() connector.AuthMethod {
+	return connector.AuthMethodHMAC
+}
+func (c *unsignedConnector) RetryInterval() time.Duration  { return time.Second }
+func (c *unsignedConnector) AllowedLatency() time.Duration { return time.Second }
+
+func TestUnsignedVehicleCommands(t *testing.T) {
+	var forwarded []string
+	host := fakeFleetAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		forwarded = append(forwarded, req.URL.Path)
+	})
+
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := func(context.Context, *account.Account, string) (connector.Connector, error) {
+		return &unsignedConnector{receive: make(chan []byte)}, nil
+	}
+	p, err := proxy.New(context.Background(), skey, 1, proxy.WithDialer(dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.FleetAPIHost = host
+
+	// The first command finds that the vehicle doesn't support the protocol, and is forwarded.
+	for _, command := range []string{"flash_lights", "navigation_gps_request", "share"} {
+		path := "/api/1/vehicles/" + testVIN + "/command/" + command
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected command to be forwarded, got %d %s", command, w.Code, w.Body.String())
+		}
+		if len(forwarded) == 0 || forwarded[len(forwarded)-1] != path {
+			t.Errorf("%s: command wasn't forwarded to Fleet API: %v", command, forwarded)
+		}
+	}
+}
+
+func TestVehicleAwake(t *testing.T) {
+	p, car := newTestProxy(t, false)
+	check := func() (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/api/1/vehicles/"+testVIN+"/awake", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+	if code, body := check(); code != http.StatusOK || !strings.Contains(body, `"response":{"awake":true}`) {
+		t.Errorf("Unexpected response %d %s", code, body)
+	}
+	car.SetAsleep(true)
+	if code, body := check(); code != http.StatusOK || !strings.Contains(body, `"response":{"awake":false}`) {
+		t.Errorf("Unexpected response %d %s", code, body)
+	}
+	if car.Wakes() != 0 {
+		t.Errorf("Checking the sleep state woke the vehicle")
+	}
+}
+
+func TestEndToEndErrors(t *testing.T) {
+	p, car := newTestProxy(t, true)
+
+	// Errors reported by the vehicle's application layer are returned as unsuccessful results.
+	car.RejectCommands("already_on")
+	code, reply := postCommand(t, p, "auto_conditioning_start", nil)
+	if code != http.StatusOK || reply.Response == nil || reply.Response.Result || !strings.Contains(reply.Response.Reason, "already_on") {
+		t.Errorf("Unexpected response to rejected command: %d %+v", code, reply)
+	}
+	car.RejectCommands("")
+
+	// Protocol faults are errors.
+	car.InjectFault(universal.MessageFault_E_MESSAGEFAULT_ERROR_INSUFFICIENT_PRIVILEGES)
+	code, reply = postCommand(t, p, "flash_lights", nil)
+	if code != http.StatusInternalServerError || reply.Error == "" || reply.Response != nil {
+		t.Errorf("Unexpected response to faulted command: %d %+v", code, reply)
+	}
+	car.InjectFault(universal.MessageFault_E_MESSAGEFAULT_ERROR_NONE)
+
+	// A vehicle that's still busy when the request's deadline leaves no time to retry is reported
+	// as rate limited, or with the status the operator configured.
+	p.Timeout = time.Second
+	car.InjectFault(universal.MessageFault_E_MESSAGEFAULT_ERROR_BUSY)
+	for _, status := range []int{0, http.StatusServiceUnavailable} {
+		p.BusyStatus = status
+		want := status
+		if want == 0 {
+			want = http.StatusTooManyRequests
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/flash_lights", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if w.Code != want || w.Header().Get("Retry-After") != "2" {
+			t.Errorf("Unexpected response to busy vehicle: %d %v %s", w.Code, w.Header(), w.Body)
+		}
+	}
+	car.InjectFault(universal.MessageFault_E_MESSAGEFAULT_ERROR_NONE)
+
+	// A vehicle that doesn't recognize the proxy's key rejects the handshake.
+	p, car = newTestProxy(t, false)
+	code, reply = postCommand(t, p, "flash_lights", nil)
+	if code != http.StatusInternalServerError || reply.Error == "" {
+		t.Errorf("Unexpected response from unpaired vehicle: %d %+v", code, reply)
+	}
+	if len(car.Commands()) != 0 {
+		t.Errorf("Unpaired vehicle executed a command")
+	}
+}
+
+func TestFleetAPIRetryAfter(t *testing.T) {
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := func(context.Context, *account.Account, string) (connector.Connector, error) {
+		return nil, &inet.HTTPError{Code: http.StatusTooManyRequests, Message: `{"error":"rate limited"}`, RetryAfter: 7 * time.Second}
+	}
+	p, err := proxy.New(context.Background(), skey, 1, proxy.WithDialer(dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/flash_lights", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "7" {
+		t.Errorf("Expected Fleet API's 429 and Retry-After, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestMaxActiveSessions(t *testing.T) {
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	car := vehicletest.New(testVIN)
+	car.Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+	dialing := make(chan struct{})
+	release := make(chan struct{})
+	dial := func(_ context.Context, _ *account.Account, vin string) (connector.Connector, error) {
+		if vin == testVIN {
+			close(dialing)
+			<-release
+		}
+		return car.Connect(), nil
+	}
+	p, err := proxy.New(context.Background(), skey, 1, proxy.WithDialer(dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.MaxActiveSessions = 1
+
+	done := make(chan int)
+	go func() {
+		code, _ := postCommand(t, p, "flash_lights", nil)
+		done <- code
+	}()
+	<-dialing
+
+	// The queue of the vehicle is reported under a label that doesn't reveal its VIN.
+	if metrics := scrapeMetrics(t, p); !strings.Contains(metrics, `tesla_proxy_vin_queue_depth{vehicle="`) || strings.Contains(metrics, testVIN) {
+		t.Errorf("Expected queue depth labeled without the VIN, got:\n%s", metrics)
+	}
+
+	// The first vehicle's session is in use, so a command for a second vehicle is turned away.
+	const otherVIN = "5YJ3E1EA7KF000002"
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+otherVIN+"/command/flash_lights", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After, got %d %v", w.Code, w.Header())
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("Expected first command to succeed, got %d", code)
+	}
+
+	metrics := scrapeMetrics(t, p)
+	for _, expected := range []string{"tesla_proxy_sessions_max 1\n", "tesla_proxy_sessions_rejected_total 1\n", "tesla_proxy_vehicles_active 0\n"} {
+		if !strings.Contains(metrics, expected) {
+			t.Errorf("Expected metrics to contain %q", expected)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// Fault types that FaultRule.Error may name. Each produces the response that the proxy returns for
+// the corresponding real failure, so that clients can exercise their error handling.
+const (
+	// FaultVehicleOffline returns 408, as Fleet API does when the vehicle is asleep or offline.
+	FaultVehicleOffline = "vehicle_offline"
+	// FaultTimeout returns 504, as if the vehicle didn't respond before the command timed out.
+	FaultTimeout = "timeout"
+	// FaultBusy returns Proxy.BusyStatus with a Retry-After header, as if the vehicle stayed busy.
+	FaultBusy = "busy"
+	// FaultRateLimited returns 429 with a Retry-After header.
+	FaultRateLimited = "rate_limited"
+	// FaultBadGateway returns 502, as if Fleet API couldn't be reached.
+	FaultBadGateway = "bad_gateway"
+	// FaultServerError returns 500.
+	FaultServerError = "server_error"
+	// FaultVehicleRejected returns 200 with a false result, as if the vehicle refused the command.
+	FaultVehicleRejected = "vehicle_rejected"
+)
+
+var faultTypes = []string{
+	FaultVehicleOffline, FaultTimeout, FaultBusy, FaultRateLimited, FaultBadGateway, FaultServerError,
+	FaultVehicleRejected,
+}
+
+// faultHeader is set on responses to commands that had a fault injected, naming the fault type.
+const faultHeader = "X-Fault-Injected"
+
+// FaultInjection makes the proxy delay or fail commands on purpose, so that clients can test their
+// timeout and retry handling. It's for testing only: injected failures are indistinguishable from
+// real ones apart from the X-Fault-Injected response header, and the commands aren't sent to the
+// vehicle. FaultInjection must be created with ParseFaultInjection or LoadFaultInjectionFile.
+type FaultInjection struct {
+	// Seed initializes the random number generator that decides which commands fail, so that runs
+	// with the same seed and the same sequence of commands fail the same commands.
+	Seed int64 `json:"seed"`
+	// Rules are checked in order, and the first rule that matches a command applies to it. Commands
+	// that don't match a rule are handled normally.
+	Rules []FaultRule `json:"rules"`
+
+	lock sync.Mutex
+	rng  *rand.Rand
+}
+
+// FaultRule describes the faults injected into matching commands. Empty lists match any value.
+type FaultRule struct {
+	Commands []string `json:"commands,omitempty"`
+	VINs     []string `json:"vins,omitempty"`
+	// Latency delays matching commands, as a duration such as "1.5s". Commands are delayed whether
+	// or not they fail.
+	Latency string `json:"latency,omitempty"`
+	// Jitter adds a random delay of up to this duration to Latency.
+	Jitter string `json:"jitter,omitempty"`
+	// ErrorRate is the probability, from 0 to 1, that a matching command fails with Error.
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	// Error is one of the Fault constants. It defaults to FaultServerError.
+	Error string `json:"error,omitempty"`
+
+	latency, jitter time.Duration
+}
+
+// ParseFaultInjection decodes a JSON-encoded FaultInjection, such as
+//
+//	{"seed": 1, "rules": [{"commands": ["door_unlock"], "latency": "2s", "error_rate": 0.5, "error": "timeout"}]}
+func ParseFaultInjection(data []byte) (*FaultInjection, error) {
+	var faults FaultInjection
+	if err := json.Unmarshal(data, &faults); err != nil {
+		return nil, err
+	}
+	for i := range faults.Rules {
+		if err := faults.Rules[i].parse(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	faults.rng = rand.New(rand.NewSource(faults.Seed))
+	return &faults, nil
+}
+
+// LoadFaultInjectionFile reads a JSON-encoded FaultInjection from filename.
+func LoadFaultInjectionFile(filename string) (*FaultInjection, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	faults, err := ParseFaultInjection(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fault injection file %s: %w", filename, err)
+	}
+	return faults, nil
+}
+
+// WithFaultInjection makes the proxy inject faults into commands. Don't use it in production.
+func WithFaultInjection(faults *FaultInjection) Option {
+	return func(p *Proxy) {
+		p.faults = faults
+	}
+}
+
+func (r *FaultRule) parse() error {
+	var err error
+	for _, command := range r.Commands {
+		if _, ok := catalog.Lookup(command); !ok {
+			return fmt.Errorf("unknown command %s", command)
+		}
+	}
+	for _, vin := range r.VINs {
+		if len(vin) != vinLength {
+			return fmt.Errorf("invalid VIN %q", vin)
+		}
+	}
+	if r.Latency != "" {
+		if r.latency, err = time.ParseDuration(r.Latency); err != nil || r.latency < 0 {
+			return fmt.Errorf("invalid latency %q", r.Latency)
+		}
+	}
+	if r.Jitter != "" {
+		if r.jitter, err = time.ParseDuration(r.Jitter); err != nil || r.jitter < 0 {
+			return fmt.Errorf("invalid jitter %q", r.Jitter)
+		}
+	}
+	if r.ErrorRate < 0 || r.ErrorRate > 1 {
+		return fmt.Errorf("error rate %v isn't between 0 and 1", r.ErrorRate)
+	}
+	if r.Error == "" {
+		r.Error = FaultServerError
+	} else if !slices.Contains(faultTypes, r.Error) {
+		return fmt.Errorf("unknown error type %s", r.Error)
+	}
+	return nil
+}
+
+func (r *FaultRule) matches(command, vin string) bool {
+	return (len(r.Commands) == 0 || slices.Contains(r.Commands, command)) &&
+		(len(r.VINs) == 0 || slices.Contains(r.VINs, vin))
+}
+
+// decide returns the delay and fault type, if any, to inject into a command. The fault type is
+// empty if the command should be handled normally after the delay.
+func (f *FaultInjection) decide(command, vin string) (time.Duration, string) {
+	for i := range f.Rules {
+		rule := &f.Rules[i]
+		if !rule.matches(command, vin) {
+			continue
+		}
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		delay := rule.latency
+		if rule.jitter > 0 {
+			delay += time.Duration(f.rng.Int63n(int64(rule.jitter) + 1))
+		}
+		if rule.ErrorRate > 0 && f.rng.Float64() < rule.ErrorRate {
+			return delay, rule.Error
+		}
+		return delay, ""
+	}
+	return 0, ""
+}
+
+// injectFault delays the command and writes an error response if p.faults says to. It returns
+// true if it wrote a response, in which case the command must not be sent.
+func (p *Proxy) injectFault(w http.ResponseWriter, req *http.Request, command, vin string) (bool, error) {
+	if p.faults == nil {
+		return false, nil
+	}
+	delay, fault := p.faults.decide(command, vin)
+	if delay > 0 {
+		timer := p.clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-req.Context().Done():
+			timer.Stop()
+		}
+	}
+	if fault == "" {
+		return false, nil
+	}
+	log.Warning("Injecting %s fault into %s", fault, command)
+	w.Header().Set(faultHeader, fault)
+	err := faultError(fault)
+	switch fault {
+	case FaultBusy, FaultRateLimited:
+		w.Header().Set("Retry-After", "1")
+	}
+	code := faultStatus(fault)
+	if fault == FaultBusy {
+		code = p.busyStatus()
+	}
+	writeJSONError(w, code, err)
+	return true, err
+}
+
+func faultStatus(fault string) int {
+	switch fault {
+	case FaultTimeout:
+		return http.StatusGatewayTimeout
+	case FaultRateLimited:
+		return http.StatusTooManyRequests
+	case FaultBadGateway:
+		return http.StatusBadGateway
+	case FaultVehicleRejected:
+		return http.StatusOK
+	}
+	return http.StatusInternalServerError
+}
+
+func faultError(fault string) error {
+	switch fault {
+	case FaultVehicleOffline:
+		return &inet.HTTPError{
+			Code:    http.StatusRequestTimeout,
+			Message: `{"response":null,"error":"vehicle unavailable: vehicle is offline or asleep","error_description":""}`,
+		}
+	case FaultTimeout:
+		return context.DeadlineExceeded
+	case FaultVehicleRejected:
+		return &protocol.NominalError{Details: errors.New("injected fault")}
+	}
+	return fmt.Errorf("injected %s fault", fault)
+}
@@ -0,0 +1,87 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func TestFaultInjection(t *testing.T) {
+	faults, err := proxy.ParseFaultInjection([]byte(`{"rules": [
+		{"commands": ["door_unlock"], "error_rate": 1, "error": "vehicle_offline"},
+		{"commands": ["honk_horn"], "latency": "50ms"},
+		{"commands": ["flash_lights"], "error_rate": 1, "error": "vehicle_rejected"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, car := newTestProxy(t, true, proxy.WithFaultInjection(faults))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/door_unlock", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestTimeout || w.Header().Get("X-Fault-Injected") != proxy.FaultVehicleOffline {
+		t.Errorf("Unexpected response to failed command: %d %v %s", w.Code, w.Header(), w.Body.String())
+	}
+	if !car.Locked() {
+		t.Errorf("Failed command reached the vehicle")
+	}
+
+	start := time.Now()
+	if code, reply := postCommand(t, p, "honk_horn", nil); code != http.StatusOK || !reply.Response.Result {
+		t.Errorf("Delayed command failed: %d %+v", code, reply)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Command wasn't delayed: %s", elapsed)
+	}
+	if code, reply := postCommand(t, p, "flash_lights", nil); code != http.StatusOK || reply.Response.Result {
+		t.Errorf("Expected vehicle to reject command: %d %+v", code, reply)
+	}
+	if code, reply := postCommand(t, p, "set_charge_limit", map[string]interface{}{"percent": 60.0}); code != http.StatusOK || car.ChargeLimit() != 60 {
+		t.Errorf("Command without a matching rule failed: %d %+v", code, reply)
+	}
+}
+
+func TestFaultInjectionIsDeterministic(t *testing.T) {
+	codes := func() []int {
+		faults, err := proxy.ParseFaultInjection([]byte(`{"seed": 42, "rules": [{"error_rate": 0.5, "error": "busy"}]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, _ := newTestProxy(t, true, proxy.WithFaultInjection(faults))
+		var codes []int
+		for i := 0; i < 20; i++ {
+			code, _ := postCommand(t, p, "honk_horn", nil)
+			codes = append(codes, code)
+		}
+		return codes
+	}
+	first := codes()
+	if !slices.Contains(first, http.StatusOK) || !slices.Contains(first, http.StatusTooManyRequests) {
+		t.Errorf("Expected a mix of successes and failures, got %v", first)
+	}
+	if second := codes(); !slices.Equal(first, second) {
+		t.Errorf("Same seed produced different results: %v and %v", first, second)
+	}
+}
+
+func TestParseFaultInjection(t *testing.T) {
+	invalid := map[string]string{
+		"command":    `{"rules": [{"commands": ["honk"], "error_rate": 1}]}`,
+		"VIN":        `{"rules": [{"vins": ["5YJ3"], "error_rate": 1}]}`,
+		"latency":    `{"rules": [{"latency": "2 seconds"}]}`,
+		"jitter":     `{"rules": [{"jitter": "-1s"}]}`,
+		"error rate": `{"rules": [{"error_rate": 1.5}]}`,
+		"error type": `{"rules": [{"error_rate": 1, "error": "explode"}]}`,
+	}
+	for label, config := range invalid {
+		if _, err := proxy.ParseFaultInjection([]byte(config)); err == nil {
+			t.Errorf("Expected error for invalid %s", label)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// statusClientClosedRequest is the non-standard status, used by nginx among others, of commands
+// that weren't sent because the client closed its request first.
+const statusClientClosedRequest = 499
+
+var errClientClosedRequest = errors.New("client closed the request before the command was sent")
+
+// goRequest runs f in a goroutine that's counted by the tesla_proxy_request_goroutines gauge
+// until it returns. Handlers start goroutines only through goRequest, usually by way of a
+// requestGroup, so a goroutine that outlives its request shows up in the gauge.
+func (p *Proxy) goRequest(f func()) {
+	p.metrics.requestGoroutines.Add(1)
+	go func() {
+		defer p.metrics.requestGoroutines.Add(-1)
+		f()
+	}()
+}
+
+// requestGroup runs goroutines on behalf of one request. The handler that creates it must call
+// Wait before it returns, so that none of the goroutines outlive the request.
+type requestGroup struct {
+	p     *Proxy
+	ctx   context.Context
+	wg    sync.WaitGroup
+	slots chan struct{}
+}
+
+// newRequestGroup returns a requestGroup that runs at most limit goroutines at once on behalf of a
+// request with context ctx.
+func (p *Proxy) newRequestGroup(ctx context.Context, limit int) *requestGroup {
+	return &requestGroup{p: p, ctx: ctx, slots: make(chan struct{}, limit)}
+}
+
+// Go waits until fewer than the group's limit of goroutines are running, and then runs f in
+// another. If the request's context is done first, f isn't run and Go returns the context's error.
+func (g *requestGroup) Go(f func()) error {
+	select {
+	case g.slots <- struct{}{}:
+	case <-g.ctx.Done():
+		return g.ctx.Err()
+	}
+	g.wg.Add(1)
+	g.p.goRequest(func() {
+		defer func() {
+			<-g.slots
+			g.wg.Done()
+		}()
+		f()
+	})
+	return nil
+}
+
+// Wait returns once every goroutine started by Go has returned.
+func (g *requestGroup) Wait() {
+	g.wg.Wait()
+}
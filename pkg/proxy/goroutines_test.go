@@ -0,0 +1,117 @@
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestGoroutines(t *testing.T) {
+	const requests = 10000
+	p, _ := newTestProxy(t, true)
+	p.Callbacks.SigningKey = testCallbackKey
+	p.Callbacks.AllowedHosts = []string{"127.0.0.1"}
+	callbacks, payloads := callbackReceiver(t, 0)
+
+	vehiclePath := "/api/1/vehicles/" + testVIN
+	send := func(i int) {
+		var method, path, body string
+		switch i % 5 {
+		case 0:
+			method, path = http.MethodGet, "/health"
+		case 1:
+			method, path = http.MethodPost, vehiclePath+"/command/door_lock"
+		case 2:
+			method, path, body = http.MethodPost, "/api/1/bulk/set_charge_limit", `{"percent": 80, "vins": ["`+testVIN+`"]}`
+		case 3:
+			method, path, body = http.MethodPost, vehiclePath+"/command_sequence",
+				`{"commands": [{"command": "door_unlock"}, {"command": "set_charge_limit", "parameters": {"percent": 70}}]}`
+		case 4:
+			method, path = http.MethodPost, vehiclePath+"/command/flash_lights"
+			if i%500 == 4 {
+				body = `{"callback_url": "` + callbacks.URL + `"}`
+			}
+		}
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if w.Code != http.StatusOK && w.Code != http.StatusAccepted {
+			t.Errorf("%s %s: unexpected status %d: %s", method, path, w.Code, w.Body.String())
+		}
+		if w.Code == http.StatusAccepted {
+			waitForCallback(t, payloads)
+		}
+	}
+
+	// The first requests start the goroutines that outlive them by design: the vehicle's
+	// connection, which is kept for the next command, and the goroutine that expires it.
+	for i := 0; i < 5; i++ {
+		send(i)
+	}
+	waitForGoroutines := func(limit int) int {
+		deadline := time.Now().Add(5 * time.Second)
+		for runtime.NumGoroutine() > limit && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return runtime.NumGoroutine()
+	}
+	// The baseline is the count once goroutines that finish the first requests, such as the HTTP
+	// client's connection readers, have exited: the same count several samples in a row.
+	baseline := runtime.NumGoroutine()
+	for stable, deadline := 0, time.Now().Add(5*time.Second); stable < 5 && time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+		if n := runtime.NumGoroutine(); n == baseline {
+			stable++
+		} else {
+			baseline, stable = n, 0
+		}
+	}
+
+	var wg sync.WaitGroup
+	const workers = 8
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < requests; i += workers {
+				send(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := waitForGoroutines(baseline); n > baseline {
+		buf := make([]byte, 1<<20)
+		t.Fatalf("%d goroutines after %d requests, up from %d:\n%s", n, requests, baseline, buf[:runtime.Stack(buf, true)])
+	}
+	if metrics := scrapeMetrics(t, p); !strings.Contains(metrics, "tesla_proxy_request_goroutines 0\n") {
+		t.Errorf("Request goroutines not back to zero:\n%s", metrics)
+	}
+}
+
+func TestRequestCanceled(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for path, body := range map[string]string{
+		"/api/1/bulk/set_charge_limit":                     `{"percent": 55, "vins": ["` + testVIN + `"]}`,
+		"/api/1/vehicles/" + testVIN + "/command_sequence": `{"commands": [{"command": "set_charge_limit", "parameters": {"percent": 55}}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)).WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if !strings.Contains(w.Body.String(), `"status":499`) {
+			t.Errorf("%s: expected status 499 for command, got %s", path, w.Body.String())
+		}
+	}
+	if car.ChargeLimit() == 55 {
+		t.Errorf("Command was sent after the client closed the request")
+	}
+}
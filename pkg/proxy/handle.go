@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/dispatcher"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// DefaultVehicleIdleTimeout is the default for Proxy.VehicleIdleTimeout.
+const DefaultVehicleIdleTimeout = 5 * time.Minute
+
+// vehicleHandle holds a vehicle's connection and session state between commands. A command to a
+// vehicle with an idle handle skips dialing, importing the cached sessions (which repeats the key
+// agreement for each domain), and starting the dispatcher, and continues each session with the
+// vehicle's clock offset and anti-replay counter where the last command left them.
+//
+// A handle is only reused while it's consistent with the rest of the proxy's state. The session
+// cache must still hold the sessions the handle saved, so that sessions that were refreshed by the
+// keep-alive, loaded from a SessionStore, reset, or evicted are never overwritten with stale ones.
+// The client must also present the same OAuth token and be routed to the same Fleet API server.
+// Otherwise the proxy closes the handle and starts over, exactly as it does for a vehicle it
+// hasn't seen before.
+type vehicleHandle struct {
+	vin       string
+	car       *vehicle.Vehicle
+	token     string // OAuth token the connection presents
+	host      string // Fleet API server the connection sends requests to
+	connected bool
+
+	// The remaining fields are guarded by vehicleHandles.lock.
+	refs     int
+	lastUsed time.Time
+	saved    []dispatcher.CacheEntry // Sessions car last saved to Proxy.sessions
+	synced   bool                    // True if car's sessions have been saved
+}
+
+// vehicleHandles holds the idle handle of each vehicle. The session cache is read before lock is
+// taken, never while it's held, so that handle bookkeeping doesn't wait on the cache.
+type vehicleHandles struct {
+	lock     sync.Mutex
+	byVIN    map[string]*vehicleHandle
+	expiring bool // True while expireVehicleHandles is running
+}
+
+// sameEntries returns true if a and b are the same slice, rather than equal slices. Each save
+// replaces a vehicle's slice in the session cache, so this detects changes cheaply.
+func sameEntries(a, b []dispatcher.CacheEntry) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// reusesVehicles returns true if the proxy keeps vehicle handles between commands. Sessions are
+// reloaded from p.SessionStore before each command, which invalidates handles, so they aren't kept
+// if it's set.
+func (p *Proxy) reusesVehicles() bool {
+	return p.VehicleIdleTimeout > 0 && p.SessionStore == nil
+}
+
+// current returns true if h's sessions are entries, which p.sessions.GetEntry returned for h.vin
+// with cached. The caller must hold p.vehicles.lock.
+func current(h *vehicleHandle, entries []dispatcher.CacheEntry, cached bool) bool {
+	return cached && h.synced && sameEntries(entries, h.saved)
+}
+
+// acquireVehicle returns a handle for sending commands to vin on behalf of acct, which presented
+// token. It reuses vin's idle handle if possible, and otherwise creates a vehicle with getVehicle.
+// The caller must hold vin's lock and release the handle with releaseVehicle.
+func (p *Proxy) acquireVehicle(ctx context.Context, acct *account.Account, token, vin string) (*vehicleHandle, error) {
+	var stale *vehicleHandle
+	entries, cached := p.sessions.GetEntry(vin)
+	p.vehicles.lock.Lock()
+	if h, ok := p.vehicles.byVIN[vin]; ok && h.refs == 0 {
+		if p.reusesVehicles() && h.token == token && h.host == acct.Host && current(h, entries, cached) {
+			h.refs++
+			p.vehicles.lock.Unlock()
+			// Undo settings made for the previous command.
+			h.car.DomainOverride = protocol.DomainNone
+			h.car.Capabilities = nil
+			h.car.SkipCapabilityCheck = false
+			h.car.ResetBusyRetries()
+			log.Debug("Reusing connection to %s", vin)
+			return h, nil
+		}
+		delete(p.vehicles.byVIN, vin)
+		stale = h
+	}
+	p.vehicles.lock.Unlock()
+	if stale != nil {
+		stale.close()
+	}
+
+	car, err := p.getVehicle(ctx, acct, vin)
+	if err != nil || car == nil {
+		return nil, err
+	}
+	return &vehicleHandle{vin: vin, car: car, token: token, host: acct.Host, refs: 1}, nil
+}
+
+// connect starts h's connection to the vehicle, unless it's already running.
+func (h *vehicleHandle) connect(ctx context.Context) error {
+	if h.connected {
+		return nil
+	}
+	if err := h.car.Connect(ctx); err != nil {
+		return err
+	}
+	h.connected = true
+	return nil
+}
+
+// close disconnects h from the vehicle.
+func (h *vehicleHandle) close() {
+	if h.connected {
+		h.car.Disconnect()
+		h.connected = false
+	}
+}
+
+// saveSessions copies h's sessions to p's session cache. The handle can only be reused after its
+// sessions have been saved.
+func (p *Proxy) saveSessions(h *vehicleHandle) {
+	_ = h.car.UpdateCachedSessions(p.sessions)
+	entries, ok := p.sessions.GetEntry(h.vin)
+	p.vehicles.lock.Lock()
+	h.saved, h.synced = entries, ok
+	p.vehicles.lock.Unlock()
+}
+
+// releaseVehicle reverses acquireVehicle. The handle is kept for the next command if its sessions
+// are current, and is closed otherwise.
+func (p *Proxy) releaseVehicle(h *vehicleHandle) {
+	entries, cached := p.sessions.GetEntry(h.vin)
+	p.vehicles.lock.Lock()
+	h.refs--
+	if h.refs > 0 {
+		p.vehicles.lock.Unlock()
+		return
+	}
+	h.lastUsed = p.clock.Now()
+	closed := h
+	idle, ok := p.vehicles.byVIN[h.vin]
+	if p.reusesVehicles() && h.connected && current(h, entries, cached) && (!ok || idle.refs == 0) {
+		// h saved the sessions that are in the cache, so it replaces any other idle handle.
+		if p.vehicles.byVIN == nil {
+			p.vehicles.byVIN = make(map[string]*vehicleHandle)
+		}
+		p.vehicles.byVIN[h.vin] = h
+		if !p.vehicles.expiring {
+			p.vehicles.expiring = true
+			go p.expireVehicleHandles()
+		}
+		closed = nil
+		if ok && idle != h {
+			closed = idle
+		}
+	} else if ok && idle == h {
+		delete(p.vehicles.byVIN, h.vin)
+	}
+	p.vehicles.lock.Unlock()
+	if closed != nil {
+		closed.close()
+	}
+}
+
+// discardVehicle closes vin's idle handle, if it has one.
+func (p *Proxy) discardVehicle(vin string) {
+	p.vehicles.lock.Lock()
+	h, ok := p.vehicles.byVIN[vin]
+	if ok && h.refs == 0 {
+		delete(p.vehicles.byVIN, vin)
+	} else {
+		h = nil
+	}
+	p.vehicles.lock.Unlock()
+	if h != nil {
+		h.close()
+	}
+}
+
+// vehicleHandleCount returns the number of vehicles with idle handles.
+func (p *Proxy) vehicleHandleCount() int {
+	p.vehicles.lock.Lock()
+	defer p.vehicles.lock.Unlock()
+	return len(p.vehicles.byVIN)
+}
+
+// evictIdleVehicles closes the least recently used idle handles until at most limit vehicles hold a
+// connection, counting the vehicles with commands in progress, which are never evicted.
+func (p *Proxy) evictIdleVehicles(limit int) {
+	active := p.metrics.activeVINs()
+	var idle []*vehicleHandle
+	p.vehicles.lock.Lock()
+	for vin, h := range p.vehicles.byVIN {
+		if !active[vin] && h.refs == 0 {
+			idle = append(idle, h)
+		}
+	}
+	sort.Slice(idle, func(i, j int) bool { return idle[i].lastUsed.Before(idle[j].lastUsed) })
+	excess := len(active) + len(idle) - limit
+	if excess < 0 {
+		excess = 0
+	} else if excess > len(idle) {
+		excess = len(idle)
+	}
+	evicted := idle[:excess]
+	for _, h := range evicted {
+		delete(p.vehicles.byVIN, h.vin)
+	}
+	p.vehicles.lock.Unlock()
+	for _, h := range evicted {
+		log.Debug("Closing idle connection to %s to stay within the session limit", h.vin)
+		h.close()
+	}
+}
+
+// expireVehicleHandles closes handles that have been idle for p.VehicleIdleTimeout, or whose
+// sessions are no longer current, until there are none left.
+func (p *Proxy) expireVehicleHandles() {
+	for {
+		<-p.clock.After(p.VehicleIdleTimeout / 2)
+		p.vehicles.lock.Lock()
+		vins := make([]string, 0, len(p.vehicles.byVIN))
+		for vin := range p.vehicles.byVIN {
+			vins = append(vins, vin)
+		}
+		p.vehicles.lock.Unlock()
+		type cacheEntry struct {
+			entries []dispatcher.CacheEntry
+			cached  bool
+		}
+		sessions := make(map[string]cacheEntry, len(vins))
+		for _, vin := range vins {
+			entries, cached := p.sessions.GetEntry(vin)
+			sessions[vin] = cacheEntry{entries, cached}
+		}
+
+		var expired []*vehicleHandle
+		p.vehicles.lock.Lock()
+		for vin, h := range p.vehicles.byVIN {
+			// Handles added since the cache was read are checked on the next tick.
+			entry, read := sessions[vin]
+			if h.refs == 0 && (clock.Since(p.clock, h.lastUsed) >= p.VehicleIdleTimeout || (read && !current(h, entry.entries, entry.cached))) {
+				delete(p.vehicles.byVIN, vin)
+				expired = append(expired, h)
+			}
+		}
+		done := len(p.vehicles.byVIN) == 0
+		if done {
+			p.vehicles.expiring = false
+		}
+		p.vehicles.lock.Unlock()
+		for _, h := range expired {
+			log.Debug("Closing idle connection to %s", h.vin)
+			h.close()
+		}
+		if done {
+			return
+		}
+	}
+}
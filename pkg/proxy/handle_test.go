@@ -0,0 +1,200 @@
+package proxy_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+// connections records the connections a proxy dials to an in-memory vehicle.
+type connections []*vehicletest.Connection
+
+// open returns the number of connections that haven't been closed.
+func (c connections) open() int {
+	n := 0
+	for _, conn := range c {
+		select {
+		case _, ok := <-conn.Receive():
+			if ok {
+				n++
+			}
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// newDialRecordingProxy is like newTestProxy, but also returns the connections the proxy dials.
+func newDialRecordingProxy(t *testing.T, options ...proxy.Option) (*proxy.Proxy, *connections) {
+	t.Helper()
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	car := vehicletest.New(testVIN)
+	car.Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+	dialed := &connections{}
+	dial := func(context.Context, *account.Account, string) (connector.Connector, error) {
+		conn := car.Connect()
+		*dialed = append(*dialed, conn)
+		return conn, nil
+	}
+	p, err := proxy.New(context.Background(), skey, 1, append(options, proxy.WithDialer(dial))...)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	return p, dialed
+}
+
+func TestVehicleConnectionReuse(t *testing.T) {
+	p, dialed := newDialRecordingProxy(t)
+	p.AdminToken = []byte("admin-token")
+	for i := 0; i < 3; i++ {
+		if code, _ := postCommand(t, p, "flash_lights", nil); code != http.StatusOK {
+			t.Fatalf("Command failed with status %d", code)
+		}
+	}
+	if len(*dialed) != 1 || dialed.open() != 1 {
+		t.Errorf("Expected one open connection for three commands, got %d (%d open)", len(*dialed), dialed.open())
+	}
+	if metrics := scrapeMetrics(t, p); !strings.Contains(metrics, "tesla_proxy_vehicle_connections_idle 1\n") {
+		t.Errorf("Idle connection not exported:\n%s", metrics)
+	}
+
+	// Clients with other tokens get their own connections.
+	otherToken := "header." + base64.RawStdEncoding.EncodeToString(
+		[]byte(`{"aud":["https://fleet-api.prd.na.vn.cloud.tesla.com"],"sub":"other-subject"}`)) + ".signature"
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/flash_lights", nil)
+	req.Header.Set("Authorization", "Bearer "+otherToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Command with other token failed with status %d", w.Code)
+	}
+	if len(*dialed) != 2 || dialed.open() != 1 {
+		t.Errorf("Expected the other token to replace the connection, got %d (%d open)", len(*dialed), dialed.open())
+	}
+
+	// Resetting the vehicle's sessions closes its connection.
+	if code := resetSession(p, "admin-token", testVIN); code != http.StatusOK {
+		t.Fatalf("Reset failed with status %d", code)
+	}
+	if dialed.open() != 0 {
+		t.Errorf("Reset didn't close the connection")
+	}
+	if code, _ := postCommand(t, p, "flash_lights", nil); code != http.StatusOK || len(*dialed) != 3 {
+		t.Errorf("Expected a new connection after reset (status %d, %d dialed)", code, len(*dialed))
+	}
+}
+
+func TestVehicleConnectionReuseDisabled(t *testing.T) {
+	p, dialed := newDialRecordingProxy(t)
+	p.VehicleIdleTimeout = 0
+	for i := 0; i < 2; i++ {
+		if code, _ := postCommand(t, p, "flash_lights", nil); code != http.StatusOK {
+			t.Fatalf("Command failed with status %d", code)
+		}
+	}
+	if len(*dialed) != 2 || dialed.open() != 0 {
+		t.Errorf("Expected a connection per command, got %d (%d open)", len(*dialed), dialed.open())
+	}
+
+	// Sessions are reloaded from a store before each command, so connections aren't kept.
+	p, dialed = newDialRecordingProxy(t)
+	p.SessionStore = &testStore{data: make(map[string][]byte)}
+	for i := 0; i < 2; i++ {
+		if code, _ := postCommand(t, p, "flash_lights", nil); code != http.StatusOK {
+			t.Fatalf("Command failed with status %d", code)
+		}
+	}
+	if len(*dialed) != 2 || dialed.open() != 0 {
+		t.Errorf("Expected a connection per command with a session store, got %d (%d open)", len(*dialed), dialed.open())
+	}
+}
+
+func TestVehicleConnectionIdleTimeout(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	p, dialed := newDialRecordingProxy(t, proxy.WithClock(fakeClock))
+	p.VehicleIdleTimeout = time.Minute
+	if code, _ := postCommand(t, p, "flash_lights", nil); code != http.StatusOK {
+		t.Fatalf("Command failed with status %d", code)
+	}
+	fakeClock.Advance(30 * time.Second)
+	if code, _ := postCommand(t, p, "flash_lights", nil); code != http.StatusOK || len(*dialed) != 1 {
+		t.Fatalf("Expected the connection to be reused (status %d, %d dialed)", code, len(*dialed))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for dialed.open() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Idle connection wasn't closed")
+		}
+		fakeClock.Advance(30 * time.Second)
+		time.Sleep(time.Millisecond)
+	}
+	if code, _ := postCommand(t, p, "flash_lights", nil); code != http.StatusOK || len(*dialed) != 2 {
+		t.Errorf("Expected a new connection after the idle timeout (status %d, %d dialed)", code, len(*dialed))
+	}
+}
+
+func TestVehicleConnectionsCountTowardMaxActiveSessions(t *testing.T) {
+	const otherVIN = "5YJ3E1EA7KF000002"
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialed := make(map[string]*connections)
+	cars := make(map[string]*vehicletest.Vehicle)
+	for _, vin := range []string{testVIN, otherVIN} {
+		cars[vin] = vehicletest.New(vin)
+		cars[vin].Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+		dialed[vin] = &connections{}
+	}
+	dial := func(_ context.Context, _ *account.Account, vin string) (connector.Connector, error) {
+		conn := cars[vin].Connect()
+		*dialed[vin] = append(*dialed[vin], conn)
+		return conn, nil
+	}
+	p, err := proxy.New(context.Background(), skey, 2, proxy.WithDialer(dial))
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	p.MaxActiveSessions = 1
+
+	if code, _ := postCommand(t, p, "flash_lights", nil); code != http.StatusOK {
+		t.Fatalf("Command failed with status %d", code)
+	}
+	if dialed[testVIN].open() != 1 {
+		t.Fatalf("Expected an idle connection to %s", testVIN)
+	}
+
+	// The idle connection is closed to make room for the other vehicle's.
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+otherVIN+"/command/flash_lights", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Command for %s failed with status %d: %s", otherVIN, w.Code, w.Body.String())
+	}
+	if dialed[testVIN].open() != 0 || dialed[otherVIN].open() != 1 {
+		t.Errorf("Expected only the connection to %s to stay open, got %d and %d", otherVIN,
+			dialed[testVIN].open(), dialed[otherVIN].open())
+	}
+	if metrics := scrapeMetrics(t, p); !strings.Contains(metrics, "tesla_proxy_vehicle_connections_idle 1\n") {
+		t.Errorf("Expected one idle connection:\n%s", metrics)
+	}
+}
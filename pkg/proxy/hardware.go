@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// capabilityTimeout limits the time spent reading a vehicle's configuration before a command that
+// requires a vehicle.Capability. If it expires, the command is sent anyway.
+const capabilityTimeout = 5 * time.Second
+
+// CapabilityResolver returns a vehicle's optional hardware.
+type CapabilityResolver func(ctx context.Context, acct *account.Account, vin string) (vehicle.Capabilities, error)
+
+// WithCapabilityResolver replaces the lookup the proxy uses to reject commands, such as
+// open_tonneau, that require hardware the vehicle doesn't have. By default, the proxy uses
+// [account.Account.VehicleCapabilities] if it sends commands through Fleet API, and skips the
+// check if it was created WithDialer.
+func WithCapabilityResolver(resolve CapabilityResolver) Option {
+	return func(p *Proxy) {
+		p.resolveCapabilities = resolve
+	}
+}
+
+// vehicleCapabilities returns vin's capabilities, or nil if they can't be determined. Capabilities
+// are read once per VIN.
+func (p *Proxy) vehicleCapabilities(ctx context.Context, acct *account.Account, vin string) vehicle.Capabilities {
+	if cached, ok := p.capabilityCache.Load(vin); ok {
+		return cached.(vehicle.Capabilities)
+	}
+	resolve := p.resolveCapabilities
+	if resolve == nil {
+		if p.dial != nil {
+			return nil
+		}
+		resolve = func(ctx context.Context, acct *account.Account, vin string) (vehicle.Capabilities, error) {
+			return acct.VehicleCapabilities(ctx, vin)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, capabilityTimeout)
+	defer cancel()
+	caps, err := resolve(ctx, acct, vin)
+	if err != nil {
+		log.Warning("[%s] Couldn't read vehicle capabilities: %s", vin, err)
+		return nil
+	}
+	p.capabilityCache.Store(vin, caps)
+	return caps
+}
+
+// checkCapability rejects command with 422 Unprocessable Entity if it requires a
+// vehicle.Capability that car lacks. Like checkVehicleAvailable, it honors forceAttemptHeader.
+func (p *Proxy) checkCapability(ctx context.Context, acct *account.Account, w http.ResponseWriter, req *http.Request, car *vehicle.Vehicle, command string) error {
+	capability, ok := vehicle.CommandCapabilities[command]
+	if !ok {
+		return nil
+	}
+	if force, _ := strconv.ParseBool(req.Header.Get(forceAttemptHeader)); force {
+		car.SkipCapabilityCheck = true
+		return nil
+	}
+	car.Capabilities = p.vehicleCapabilities(ctx, acct, car.VIN())
+	err := car.CheckCapability(capability)
+	if err == nil {
+		return nil
+	}
+	log.Info("[%s] Rejecting %s: %s", car.VIN(), command, err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(&Response{
+		Response: map[string]vehicle.Capability{"capability": capability},
+		Error:    err.Error(),
+		ErrDetails: fmt.Sprintf("The vehicle's configuration doesn't include %s. Send %s: true to attempt it anyway.",
+			capability, forceAttemptHeader),
+	})
+	return err
+}
@@ -0,0 +1,100 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func mustParseCIDRs(t *testing.T, s string) []netip.Prefix {
+	t.Helper()
+	prefixes, err := proxy.ParseCIDRs(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prefixes
+}
+
+func TestParseCIDRs(t *testing.T) {
+	prefixes := mustParseCIDRs(t, "10.1.2.3/8, 192.168.1.1,fd00::/8,")
+	if len(prefixes) != 3 || prefixes[0].String() != "10.0.0.0/8" || prefixes[1].String() != "192.168.1.1/32" {
+		t.Errorf("Unexpected prefixes %v", prefixes)
+	}
+	for _, s := range []string{"10.0.0.0/33", "localhost", "10.0.0"} {
+		if _, err := proxy.ParseCIDRs(s); err == nil {
+			t.Errorf("Expected error for %q", s)
+		}
+	}
+}
+
+func TestIPFilterClientAddr(t *testing.T) {
+	filter := &proxy.IPFilter{TrustedProxies: mustParseCIDRs(t, "10.0.0.0/8")}
+	tests := []struct {
+		peer      string
+		forwarded []string
+		client    string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		// Untrusted peers can't choose their address.
+		{"192.0.2.1:1234", []string{"10.0.0.1"}, "192.0.2.1"},
+		{"10.0.0.2:1234", []string{"192.0.2.5"}, "192.0.2.5"},
+		// Entries added by trusted proxies are skipped, but not those added by the client.
+		{"10.0.0.2:1234", []string{"198.51.100.7, 192.0.2.5", "10.0.0.3"}, "192.0.2.5"},
+		{"10.0.0.2:1234", nil, "10.0.0.2"},
+		{"[::ffff:192.0.2.1]:1234", nil, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = tt.peer
+		for _, value := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		addr, err := filter.ClientAddr(req)
+		if err != nil || addr.String() != tt.client {
+			t.Errorf("Peer %s with X-Forwarded-For %v: expected %s, got %s (%v)", tt.peer, tt.forwarded, tt.client, addr, err)
+		}
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	filter := &proxy.IPFilter{
+		Allow:          mustParseCIDRs(t, "192.0.2.0/24,10.0.0.0/8"),
+		Deny:           mustParseCIDRs(t, "192.0.2.128/25"),
+		TrustedProxies: mustParseCIDRs(t, "10.0.0.1"),
+	}
+	p, _ := newTestProxy(t, true, proxy.WithIPFilter(filter))
+	send := func(peer, forwarded string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/door_lock", nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		req.RemoteAddr = peer + ":1234"
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send("192.0.2.1", ""); code != http.StatusOK {
+		t.Errorf("Expected allowed client to succeed, got %d", code)
+	}
+	if code := send("198.51.100.1", ""); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for client outside allowed ranges, got %d", code)
+	}
+	if code := send("192.0.2.200", ""); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for denied client, got %d", code)
+	}
+	if code := send("10.0.0.1", "192.0.2.200"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for denied client behind trusted proxy, got %d", code)
+	}
+	if code := send("10.0.0.2", ""); code != http.StatusOK {
+		t.Errorf("Expected allowed client to succeed, got %d", code)
+	}
+	if metrics := scrapeMetrics(t, p); !strings.Contains(metrics, "tesla_proxy_requests_blocked_total 3\n") {
+		t.Errorf("Metrics don't count blocked requests:\n%s", metrics)
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+)
+
+// DefaultMaxKeepAliveIdle is how long the proxy keeps refreshing the session of a vehicle that
+// isn't receiving commands.
+const DefaultMaxKeepAliveIdle = 24 * time.Hour
+
+// idleSession records the account that most recently sent a command to a vehicle. The keep-alive
+// uses the account's OAuth token, so each command replaces the entry to keep the token fresh.
+type idleSession struct {
+	acct     *account.Account
+	lastUsed time.Time
+}
+
+// tryLockVIN locks the VIN-specific mutex if it's available, returning false otherwise.
+func (p *Proxy) tryLockVIN(vin string) bool {
+	_, loaded := p.vinLock.LoadOrStore(vin, make(chan bool, 1))
+	return !loaded
+}
+
+// touchSession records that acct just used the session with vin.
+func (p *Proxy) touchSession(acct *account.Account, vin string) {
+	if p.KeepAliveInterval <= 0 {
+		return
+	}
+	p.idleSessions.Store(vin, idleSession{acct: acct, lastUsed: time.Now()})
+}
+
+// RunKeepAlive refreshes cached vehicle sessions that have been idle for KeepAliveInterval, until
+// ctx is canceled. It returns immediately if KeepAliveInterval isn't positive.
+//
+// Sessions are only refreshed while the vehicle is awake, which is checked without waking it.
+// Each refresh uses the OAuth token of the last client to command the vehicle; if Tesla's servers
+// reject the token, the vehicle is skipped until another command arrives with a new one. Sessions
+// of vehicles that haven't received a command for longer than MaxKeepAliveIdle are no longer
+// refreshed.
+func (p *Proxy) RunKeepAlive(ctx context.Context) {
+	if p.KeepAliveInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.KeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.keepAlive(ctx)
+		}
+	}
+}
+
+// keepAlive refreshes each session that's been idle for at least KeepAliveInterval.
+func (p *Proxy) keepAlive(ctx context.Context) {
+	p.idleSessions.Range(func(key, value any) bool {
+		vin, entry := key.(string), value.(idleSession)
+		idle := time.Since(entry.lastUsed)
+		switch {
+		case idle > p.MaxKeepAliveIdle && p.MaxKeepAliveIdle > 0:
+			p.idleSessions.CompareAndDelete(vin, value)
+			return true
+		case idle < p.KeepAliveInterval:
+			return true
+		}
+		if err := p.refreshIdleSession(ctx, entry.acct, vin); err != nil {
+			log.Warning("[%s] Keep-alive failed: %s", vin, err)
+			var httpErr *inet.HTTPError
+			if errors.As(err, &httpErr) && httpErr.Code == http.StatusUnauthorized {
+				p.idleSessions.CompareAndDelete(vin, value)
+			}
+		}
+		return ctx.Err() == nil
+	})
+}
+
+// refreshIdleSession repeats the handshake with vin if it's awake and no command is in progress.
+func (p *Proxy) refreshIdleSession(ctx context.Context, acct *account.Account, vin string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	if !p.tryLockVIN(vin) {
+		return nil
+	}
+	defer p.unlockVIN(vin)
+	if err := p.loadStoredSessions(ctx, vin); err != nil {
+		return err
+	}
+
+	car, err := p.getVehicle(ctx, acct, vin)
+	if err != nil {
+		return err
+	}
+	if err := car.Connect(ctx); err != nil {
+		return err
+	}
+	defer car.Disconnect()
+	if awake, err := car.IsAwake(ctx); err != nil || !awake {
+		return err
+	}
+	// Sessions are loaded from p.sessions when car is created.
+	if err := car.RefreshSessions(ctx); err != nil {
+		return err
+	}
+	log.Debug("[%s] Refreshed idle session", vin)
+	_ = car.UpdateCachedSessions(p.sessions)
+	p.saveStoredSessions(ctx, vin)
+	return nil
+}
@@ -0,0 +1,51 @@
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestKeepAlive(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	p.KeepAliveInterval = 10 * time.Millisecond
+	if code, _ := postCommand(t, p, "door_unlock", nil); code != http.StatusOK {
+		t.Fatalf("Command failed with status %d", code)
+	}
+
+	// Asleep vehicles aren't contacted, since a handshake would wake them.
+	car.SetAsleep(true)
+	handshakes := car.Handshakes()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.RunKeepAlive(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if car.Handshakes() != handshakes || car.Wakes() != 0 {
+		t.Errorf("Keep-alive contacted a sleeping vehicle")
+	}
+
+	car.SetAsleep(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for car.Handshakes() == handshakes {
+		if time.Now().After(deadline) {
+			t.Fatalf("Keep-alive didn't refresh the idle session")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The refreshed session is used by the next command without another handshake.
+	cancel()
+	<-done
+	handshakes = car.Handshakes()
+	if code, _ := postCommand(t, p, "door_lock", nil); code != http.StatusOK || car.Handshakes() != handshakes {
+		t.Errorf("Command after keep-alive failed (%d) or repeated the handshake", code)
+	}
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+)
+
+var errNoLastCommand = errors.New("no command has been recorded for this vehicle")
+
+// LastCommand describes the most recent command the proxy executed for a vehicle. It's reported
+// by GET /vehicles/{VIN}/last-command.
+type LastCommand struct {
+	RequestID string    `json:"request_id"`
+	Command   string    `json:"command"`
+	Timestamp time.Time `json:"timestamp"` // When the proxy started executing the command
+	LatencyMS int64     `json:"latency_ms"`
+	Status    int       `json:"status"`
+	// Result and Reason are copied from the response sent to the client, if it had them.
+	Result bool   `json:"result"`
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// lastCommandCache holds the LastCommand of each vehicle. Entries live no longer than the
+// vehicle's cached sessions: they're dropped when the sessions are reset, and the cache never
+// holds more vehicles than the session cache does.
+type lastCommandCache struct {
+	lock  sync.Mutex
+	byVIN map[string]*LastCommand
+}
+
+// store records cmd as vin's last command. If that makes the cache larger than sessions, it evicts
+// vehicles that no longer have cached sessions, then the vehicles with the oldest commands.
+func (c *lastCommandCache) store(vin string, cmd *LastCommand, sessions *cache.SessionCache) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.byVIN == nil {
+		c.byVIN = make(map[string]*LastCommand)
+	}
+	c.byVIN[vin] = cmd
+	limit := sessions.MaxEntries
+	if limit <= 0 || len(c.byVIN) <= limit {
+		return
+	}
+	for other := range c.byVIN {
+		if _, ok := sessions.GetEntry(other); !ok && other != vin {
+			delete(c.byVIN, other)
+		}
+	}
+	for len(c.byVIN) > limit {
+		oldestVIN := vin
+		for other, entry := range c.byVIN {
+			if entry.Timestamp.Before(c.byVIN[oldestVIN].Timestamp) {
+				oldestVIN = other
+			}
+		}
+		delete(c.byVIN, oldestVIN)
+	}
+}
+
+func (c *lastCommandCache) get(vin string) (*LastCommand, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cmd, ok := c.byVIN[vin]
+	return cmd, ok
+}
+
+func (c *lastCommandCache) delete(vin string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.byVIN, vin)
+}
+
+// recordsLastCommands returns true if the proxy keeps each vehicle's LastCommand. They're only
+// reported by an admin endpoint, so they aren't kept unless p.AdminToken is set.
+func (p *Proxy) recordsLastCommands() bool {
+	return len(p.AdminToken) > 0
+}
+
+// recordLastCommand saves the outcome of a command that started at started, as recorded by rec.
+func (p *Proxy) recordLastCommand(vin, command, id string, started time.Time, rec *statusRecorder) {
+	cmd := &LastCommand{
+		RequestID: id,
+		Command:   command,
+		Timestamp: started.UTC(),
+		LatencyMS: clock.Since(p.clock, started).Milliseconds(),
+		Status:    rec.status,
+	}
+	if rec.body != nil {
+		var reply struct {
+			Response struct {
+				Result bool   `json:"result"`
+				Reason string `json:"reason"`
+			} `json:"response"`
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(rec.body.Bytes(), &reply) == nil {
+			cmd.Result, cmd.Reason, cmd.Error = reply.Response.Result, reply.Response.Reason, reply.Error
+		}
+	}
+	p.lastCommands.store(vin, cmd, p.sessions)
+}
+
+// handleLastCommand reports the last command executed for vin.
+func (p *Proxy) handleLastCommand(w http.ResponseWriter, vin string) {
+	cmd, ok := p.lastCommands.get(vin)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, errNoLastCommand)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: cmd})
+}
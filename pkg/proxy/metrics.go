@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/redact"
+)
+
+const metricsPath = "/metrics"
+
+var errMetricsUnauthorized = errors.New("missing or invalid metrics token")
+
+// proxyMetrics holds counters and gauges exposed at /metrics in the Prometheus text exposition
+// format. Updates are cheap (atomics or a short critical section) so they can be made on every
+// request.
+type proxyMetrics struct {
+	inFlight           atomic.Int64
+	requestsInFlight   atomic.Int64 // Authenticated requests, including pending callbacks
+	requestGoroutines  atomic.Int64 // Goroutines started by goRequest that haven't returned
+	sessionsRejected   atomic.Uint64
+	sessionStoreErrors atomic.Uint64
+	panics             atomic.Uint64
+	requestsBlocked    atomic.Uint64
+	vehiclesDenied     atomic.Uint64
+	wakesCoalesced     atomic.Uint64
+	clockSkew          atomic.Int64 // time.Duration measured by the last clock check
+	clockChecked       atomic.Bool
+
+	queueLock  sync.Mutex
+	queueDepth map[string]int // Requests holding or waiting for each VIN's lock
+}
+
+func newProxyMetrics() *proxyMetrics {
+	return &proxyMetrics{queueDepth: make(map[string]int)}
+}
+
+// commandStarted records that a command for vin has arrived and will wait for the VIN lock. A VIN
+// with at least one command in progress has an active session.
+//
+// If vin doesn't have an active session and maxSessions VINs already do, commandStarted returns
+// false without recording the command. Zero disables the limit.
+func (m *proxyMetrics) commandStarted(vin string, maxSessions int) bool {
+	m.queueLock.Lock()
+	defer m.queueLock.Unlock()
+	if _, active := m.queueDepth[vin]; !active && maxSessions > 0 && len(m.queueDepth) >= maxSessions {
+		m.sessionsRejected.Add(1)
+		return false
+	}
+	m.inFlight.Add(1)
+	m.queueDepth[vin]++
+	return true
+}
+
+// activeVINs returns the VINs with active sessions.
+func (m *proxyMetrics) activeVINs() map[string]bool {
+	m.queueLock.Lock()
+	defer m.queueLock.Unlock()
+	active := make(map[string]bool, len(m.queueDepth))
+	for vin := range m.queueDepth {
+		active[vin] = true
+	}
+	return active
+}
+
+// commandFinished reverses commandStarted.
+func (m *proxyMetrics) commandFinished(vin string) {
+	m.inFlight.Add(-1)
+	m.queueLock.Lock()
+	if m.queueDepth[vin] <= 1 {
+		delete(m.queueDepth, vin)
+	} else {
+		m.queueDepth[vin]--
+	}
+	m.queueLock.Unlock()
+}
+
+func writeMetric(w io.Writer, name, kind, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
+
+func (p *Proxy) writeMetrics(w io.Writer) {
+	m := p.metrics
+	writeMetric(w, "tesla_proxy_commands_in_flight", "gauge",
+		"Vehicle commands currently being processed or waiting for a vehicle.", m.inFlight.Load())
+
+	m.queueLock.Lock()
+	depths := make(map[string]int, len(m.queueDepth))
+	maxDepth := 0
+	for vin, depth := range m.queueDepth {
+		// Masked VINs are easy to brute-force, so labels always use the keyed hash, whatever the
+		// log redaction mode.
+		depths[redact.HashVIN(vin)] += depth
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+	}
+	m.queueLock.Unlock()
+
+	writeMetric(w, "tesla_proxy_vehicles_active", "gauge",
+		"Vehicles with at least one command in progress, each of which uses an active session.", len(depths))
+	if p.MaxActiveSessions > 0 {
+		writeMetric(w, "tesla_proxy_sessions_max", "gauge",
+			"Maximum number of vehicles with active sessions.", p.MaxActiveSessions)
+	}
+	writeMetric(w, "tesla_proxy_sessions_rejected_total", "counter",
+		"Commands rejected because the maximum number of active sessions was reached.", m.sessionsRejected.Load())
+	writeMetric(w, "tesla_proxy_vehicle_connections_idle", "gauge",
+		"Vehicles whose connection and session state are kept in memory for the next command.", p.vehicleHandleCount())
+	writeMetric(w, "tesla_proxy_vin_queue_depth_max", "gauge",
+		"Largest number of commands queued for a single vehicle.", maxDepth)
+	writeMetric(w, "tesla_proxy_panics_total", "counter",
+		"Requests that panicked and were answered with 500 Internal Server Error.", m.panics.Load())
+	writeMetric(w, "tesla_proxy_requests_in_flight", "gauge",
+		"Authenticated requests being handled, including asynchronous commands awaiting callbacks.", m.requestsInFlight.Load())
+	writeMetric(w, "tesla_proxy_request_goroutines", "gauge",
+		"Goroutines started to handle requests that are still running, including those delivering callbacks.", m.requestGoroutines.Load())
+	if p.MaxConcurrentRequests > 0 {
+		writeMetric(w, "tesla_proxy_requests_max", "gauge",
+			"Maximum number of authenticated requests handled at once.", p.MaxConcurrentRequests)
+	}
+	writeMetric(w, "tesla_proxy_admission_queue_depth", "gauge",
+		"Requests waiting for admission because the maximum number of concurrent requests was reached.", p.admission.depth())
+	writeMetric(w, "tesla_proxy_requests_shed_total", "counter",
+		"Requests rejected with 503 because the proxy was overloaded.", p.admission.shedCount())
+	writeMetric(w, "tesla_proxy_wakes_coalesced_total", "counter",
+		"wake_up requests that shared the result of a wake_up already in progress for the vehicle.", m.wakesCoalesced.Load())
+	draining := 0
+	if p.Draining() {
+		draining = 1
+	}
+	writeMetric(w, "tesla_proxy_draining", "gauge",
+		"1 if the proxy is draining and failing health checks, otherwise 0.", draining)
+
+	if m.clockChecked.Load() {
+		writeMetric(w, "tesla_proxy_clock_skew_seconds", "gauge",
+			"Difference between the local clock and Fleet API's at the last clock check, positive if the local clock is ahead.",
+			time.Duration(m.clockSkew.Load()).Seconds())
+	}
+
+	fmt.Fprintln(w, "# HELP tesla_proxy_vin_queue_depth Commands in progress or queued for each vehicle.")
+	fmt.Fprintln(w, "# TYPE tesla_proxy_vin_queue_depth gauge")
+	labels := make([]string, 0, len(depths))
+	for label := range depths {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		fmt.Fprintf(w, "tesla_proxy_vin_queue_depth{vehicle=%q} %d\n", label, depths[label])
+	}
+
+	if p.SessionStore != nil {
+		writeMetric(w, "tesla_proxy_session_store_errors_total", "counter",
+			"Failed attempts to load sessions from or save sessions to the session store.", m.sessionStoreErrors.Load())
+	}
+
+	if p.ipFilter != nil {
+		writeMetric(w, "tesla_proxy_requests_blocked_total", "counter",
+			"Requests rejected with 403 because the client's address isn't allowed.", m.requestsBlocked.Load())
+	}
+
+	if p.vinAllowlist != nil {
+		writeMetric(w, "tesla_proxy_vehicle_requests_denied_total", "counter",
+			"Requests rejected with 403 because the vehicle isn't on the VIN allowlist.", m.vehiclesDenied.Load())
+	}
+
+	if p.Audit != nil {
+		writeMetric(w, "tesla_proxy_audit_records_dropped_total", "counter",
+			"Audit records discarded because the audit queue was full.", p.Audit.Dropped())
+		writeMetric(w, "tesla_proxy_audit_write_errors_total", "counter",
+			"Audit records that could not be written.", p.Audit.WriteErrors())
+	}
+}
+
+// authorizeMetrics checks that req carries p.MetricsToken. Otherwise, it writes an error response
+// and returns false. The metrics endpoint doesn't exist unless p.MetricsToken is set.
+func (p *Proxy) authorizeMetrics(w http.ResponseWriter, req *http.Request) bool {
+	if len(p.MetricsToken) == 0 {
+		writeJSONError(w, http.StatusNotFound, nil)
+		return false
+	}
+	expected := append([]byte("Bearer "), p.MetricsToken...)
+	if subtle.ConstantTimeCompare([]byte(req.Header.Get("Authorization")), expected) != 1 {
+		log.Warning("Rejected metrics request from %s", req.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+		writeJSONError(w, http.StatusUnauthorized, errMetricsUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (p *Proxy) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	p.writeMetrics(w)
+}
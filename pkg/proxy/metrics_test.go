@@ -0,0 +1,63 @@
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+
+	// The metrics endpoint doesn't exist without a metrics token, and requires that token instead
+	// of an OAuth token.
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a metrics token, got %d", w.Code)
+	}
+	p.MetricsToken = []byte(testMetricsToken)
+	for _, header := range []string{"", "Bearer " + testToken, "Bearer wrong-token"} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w = httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Expected 401 for Authorization %q, got %d", header, w.Code)
+		}
+	}
+	body := scrapeMetrics(t, p)
+	for _, expected := range []string{
+		"# TYPE tesla_proxy_commands_in_flight gauge\ntesla_proxy_commands_in_flight 0\n",
+		"tesla_proxy_vin_queue_depth_max 0\n",
+		"tesla_proxy_vehicles_active 0\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", expected, body)
+		}
+	}
+
+	// A completed command must not leave a queue entry behind.
+	req := httptest.NewRequest(http.MethodGet, "/api/1/vehicles/"+testVIN+"/command/door_unlock", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	if metrics := scrapeMetrics(t, p); strings.Contains(metrics, "tesla_proxy_vin_queue_depth{") {
+		t.Errorf("Queue depth not cleared after command:\n%s", metrics)
+	}
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", w.Code)
+	}
+}
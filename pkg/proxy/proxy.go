@@ -11,49 +11,347 @@ import (
 	"net/http"
 	"net/url"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/protobuf/proto"
 
-	"github.com/teslamotors/vehicle-command/internal/log"
+	logger "github.com/teslamotors/vehicle-command/internal/log"
 	"github.com/teslamotors/vehicle-command/pkg/account"
 	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 	"github.com/teslamotors/vehicle-command/pkg/sign"
 	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+	"github.com/teslamotors/vehicle-command/pkg/version"
 )
 
+var log = logger.Module(logger.ModuleProxy)
+
 const (
-	DefaultTimeout       = 10 * time.Second
-	maxRequestBodyBytes  = 512
-	vinLength            = 17
-	proxyProtocolVersion = "tesla-http-proxy/1.1.0"
-	MaxResponseLength    = 10000000
-	MaxAttempts          = 2
+	DefaultTimeout      = 10 * time.Second
+	maxRequestBodyBytes = 512
+	vinLength           = 17
+	commandsPath        = "/api/1/commands"
+	versionPath         = "/version"
+	MaxResponseLength   = 10000000
+	MaxAttempts         = 2
 )
 
 var h2Prefix = "h2=https://"
 
-func getAccount(req *http.Request) (*account.Account, error) {
-	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+var errWrongMethod = errors.New("wrong http method")
+
+var errTooManySessions = errors.New("too many vehicles have active sessions")
+
+var errLocationDisabled = errors.New("get_location is disabled; start the proxy with -allow-location to enable it")
+
+var errSpeedLimitDisabled = errors.New("speed limit commands are disabled; start the proxy with -allow-speed-limit to enable them")
+
+// sessionRetryAfterSeconds is the Retry-After value sent when MaxActiveSessions is reached.
+const sessionRetryAfterSeconds = 2
+
+func getAccount(req *http.Request, userAgent string) (*account.Account, error) {
+	token, ok := bearerToken(req)
 	if !ok {
 		return nil, fmt.Errorf("client did not provide an OAuth token")
 	}
-	return account.New(token, proxyProtocolVersion)
+	return account.New(token, userAgent)
+}
+
+// bearerToken returns the OAuth token in req's Authorization header.
+func bearerToken(req *http.Request) (string, bool) {
+	return strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
 }
 
 // Proxy exposes an HTTP API for sending vehicle commands.
 type Proxy struct {
 	Timeout time.Duration
 
-	commandKey       protocol.ECDHPrivateKey
-	sessions         *cache.SessionCache
-	vinLock          sync.Map
-	unsupported      sync.Map
-	domainForSubject sync.Map
+	// ConnectTimeout and CommandTimeout split a vehicle command's Timeout into phases.
+	// ConnectTimeout limits dialing the vehicle, connecting, and the session handshake, so that
+	// commands to unreachable vehicles fail fast with a 504. CommandTimeout starts once the session
+	// is established and limits executing the command, including retries while the vehicle is busy.
+	// Neither extends past Timeout, which remains the deadline for the whole request; zero lets a
+	// phase use whatever remains of it. Clients can override either for one request with the
+	// X-Tesla-Connect-Timeout and X-Tesla-Command-Timeout headers.
+	ConnectTimeout time.Duration
+	CommandTimeout time.Duration
+
+	// APICallTimeout limits each request that the proxy sends to Tesla's servers on behalf of a
+	// vehicle command, such as a signed command or a wake_up request, so that one request that
+	// hangs doesn't use up the command's Timeout. Requests that time out are retried if the
+	// command's deadline allows, and fail with a 504 otherwise. Zero limits requests only by the
+	// command's deadline.
+	APICallTimeout time.Duration
+
+	// Audit, if non-nil, receives a record of every vehicle command handled by the proxy.
+	Audit *AuditLogger
+
+	// AccessLog, if non-nil, receives a line in Apache Combined Log Format for every request,
+	// followed by the time taken to serve it in microseconds. It's separate from the application
+	// log, for tools that parse web server logs. Writes are serialized.
+	AccessLog io.Writer
+
+	// MaxURLLength and MaxHeaderBytes limit the size of request URLs (path and query string) and
+	// headers. Larger requests are rejected with 414 and 431, respectively. Zero disables a limit.
+	MaxURLLength   int
+	MaxHeaderBytes int
+
+	// RoleRefreshInterval controls how long the proxy trusts the role of its key on each vehicle.
+	// The role is fetched when the proxy connects to a vehicle and its cached role is older than
+	// this, and after the vehicle refuses a command because of the key's role. Commands that the
+	// cached role can't authorize are rejected with a 403 without contacting the vehicle. Zero
+	// disables the check.
+	RoleRefreshInterval time.Duration
+
+	// MaxActiveSessions limits the number of vehicles with commands in progress, each of which
+	// holds a connection and session. Commands for other vehicles are rejected with a 503 and a
+	// Retry-After header until a session becomes idle. Commands for vehicles that already have an
+	// active session wait their turn as usual. Zero disables the limit.
+	//
+	// Connections kept for the next command (see VehicleIdleTimeout) count toward the limit too;
+	// the least recently used are closed to make room for a vehicle without one. The limit is
+	// independent of the size of the session cache, which retains idle sessions without their
+	// connections.
+	MaxActiveSessions int
+
+	// MaxConcurrentRequests limits the number of authenticated requests handled at once, whether
+	// they're vehicle commands or forwarded to Fleet API. Up to MaxQueuedRequests more wait, in
+	// order of arrival, for at most AdmissionWait. Requests that find the queue full, or that are
+	// still waiting after AdmissionWait, are rejected immediately with a 503 and a Retry-After
+	// header, so that a traffic spike doesn't slow every request down until they all time out.
+	// Health, metrics, and admin requests are never queued. Asynchronous commands keep their slot
+	// until their callback has been delivered. Zero disables the limit.
+	MaxConcurrentRequests int
+	MaxQueuedRequests     int
+
+	// AdmissionWait is the longest a request waits for admission under MaxConcurrentRequests. Zero
+	// means DefaultAdmissionWait.
+	AdmissionWait time.Duration
+
+	// CompressionMinBytes is the size at which responses are compressed, if the client accepts
+	// gzip or deflate encoding. Zero disables compression.
+	CompressionMinBytes int
+
+	// CloseConnections makes the proxy close each client connection after sending its response,
+	// for clients that expect a connection per request without sending "Connection: close".
+	// Regardless of CloseConnections, the proxy closes the connections of clients that send
+	// "Connection: close", and of HTTP/1.0 clients that don't send "Connection: keep-alive".
+	CloseConnections bool
+
+	// AllowLocation enables the get_location command. Vehicle location is privacy-sensitive, so
+	// the command is rejected with a 403 unless the operator opts in.
+	AllowLocation bool
+
+	// EnableUI serves a page at /ui for trying out commands from a browser. It's meant for local
+	// development: the page is unauthenticated, although commands sent from it require an OAuth
+	// token as usual. Requests for /ui return 404 if it's disabled.
+	EnableUI bool
+
+	// UserAgent names the application in the User-Agent header of requests to Tesla's servers,
+	// such as "acme-fleet/2.1", as Tesla asks integrations to do. The proxy's own version follows
+	// it; see [version.UserAgent].
+	UserAgent string
+
+	// AllowSpeedLimit enables the speed_limit_* commands, which change how fast the vehicle can be
+	// driven. They're rejected with a 403 unless the operator opts in, including commands that
+	// would be forwarded to Fleet API.
+	AllowSpeedLimit bool
+
+	// BusyStatus is the HTTP status returned when the vehicle is still busy, or still asking the
+	// proxy to wait, after the proxy has retried a command for as long as the request's deadline
+	// allows. The response includes a Retry-After header. Zero means DefaultBusyStatus; set it to
+	// http.StatusServiceUnavailable for clients that only back off after a 503.
+	BusyStatus int
+
+	// StrictParameters rejects command bodies with parameters that the command doesn't recognize.
+	// By default they're ignored, as they are by Fleet API, so that existing clients keep working.
+	StrictParameters bool
+
+	// IncludeTiming adds a breakdown of where the time went, from connecting to the vehicle through
+	// its response, to successful command responses. The proxy binaries enable it with -verbose.
+	IncludeTiming bool
+
+	// IncludeMessages adds the messages exchanged with the vehicle, decoded as protobuf JSON, to
+	// successful command responses. The proxy binaries enable it with -verbose.
+	IncludeMessages bool
+
+	// SessionStore, if non-nil, persists sessions outside of the proxy. Sessions are loaded from
+	// the store before each command and saved after it.
+	SessionStore SessionStore
+
+	// SessionStoreFailClosed rejects commands with a 503 when sessions can't be loaded from
+	// SessionStore. By default, the proxy logs a warning and uses the sessions it holds in memory,
+	// which may require a handshake with the vehicle.
+	SessionStoreFailClosed bool
+
+	// KeepAliveInterval enables RunKeepAlive, which refreshes vehicle sessions that have been idle
+	// this long so that the next command doesn't need to resynchronize with the vehicle. Zero
+	// disables it.
+	KeepAliveInterval time.Duration
+
+	// MaxKeepAliveIdle is how long after a vehicle's last command RunKeepAlive stops refreshing its
+	// session. Zero refreshes sessions indefinitely.
+	MaxKeepAliveIdle time.Duration
+
+	// VehicleIdleTimeout is how long the proxy keeps a vehicle's connection and session state in
+	// memory after a command, so that the next command to the vehicle doesn't have to set them up
+	// again. Zero sets up each command's connection from the session cache. Connections aren't kept
+	// if SessionStore is set, since sessions are reloaded from the store before each command.
+	VehicleIdleTimeout time.Duration
+
+	// BasePath, such as "/tesla", is a path prefix under which the proxy serves all of its routes,
+	// including /health, /metrics and /admin/, for deployments behind an ingress that doesn't remove
+	// it. The prefix is removed before the request is routed, so requests forwarded to Fleet API
+	// don't include it. Requests outside BasePath get a 404 without further processing. A trailing
+	// slash is ignored.
+	BasePath string
+
+	// AdminToken enables the administrative endpoints under /admin/, which require an
+	// "Authorization: Bearer" header containing the token instead of an OAuth token. The endpoints
+	// return 404 if AdminToken is empty.
+	AdminToken []byte
+
+	// MetricsToken enables the /metrics endpoint, which requires an "Authorization: Bearer" header
+	// containing the token instead of an OAuth token. The endpoint returns 404 if MetricsToken is
+	// empty.
+	MetricsToken []byte
+
+	// Environment names the Fleet API environment the proxy was started with. It's informational,
+	// and is reported by /admin/stats.
+	Environment string
+
+	// FleetAPIHost, if set, replaces the Fleet API server named in clients' OAuth tokens, for
+	// example to send requests to a staging server. Servers that redirect a client to another host
+	// still take precedence.
+	FleetAPIHost string
+
+	// MaxClockSkew is how far the local clock may differ from Fleet API's before CheckClock
+	// reports that it's unsynchronized. It defaults to DefaultMaxClockSkew.
+	MaxClockSkew time.Duration
+
+	// ClockCheckURL is the URL whose Date header CheckClock compares with the local clock. It
+	// defaults to the root of FleetAPIHost, or of the North America Fleet API server.
+	ClockCheckURL string
+
+	// Callbacks configures asynchronous commands. If a command's JSON body includes a callback_url,
+	// the proxy replies with 202 Accepted and later POSTs a CallbackPayload to that URL.
+	Callbacks CallbackConfig
+
+	// Settings are reported by GET /admin/config alongside the proxy's own configuration. The
+	// proxy binaries set them to their effective command-line configuration. Values of settings
+	// whose names suggest a secret (see redact.IsSecretSetting) are masked.
+	Settings map[string]string
+
+	commandKey           protocol.ECDHPrivateKey
+	sessions             *cache.SessionCache
+	cacheSize            int
+	vinLock              sync.Map
+	signedCommands       sync.Map // VIN → bool, true if the vehicle supports signed commands
+	domainForSubject     sync.Map
+	keyRoles             sync.Map
+	metrics              *proxyMetrics
+	dial                 Dialer
+	resolveVIN           VINResolver
+	resolveDisplayUnits  DisplayUnitsResolver
+	displayUnitsCache    sync.Map // VIN → cachedDisplayUnits
+	resolveVehicleStatus VehicleStatusResolver
+	vehicleStatusCache   sync.Map // VIN → cachedVehicleStatus
+	resolveCapabilities  CapabilityResolver
+	resolveAlerts        AlertsResolver
+	capabilityCache      sync.Map // VIN → vehicle.Capabilities
+	authorizer           Authorizer
+	defaults             *CommandDefaults
+	aliases              *CommandAliases
+	lastCommands         lastCommandCache
+	vehicles             vehicleHandles
+	wakes                wakeFlights
+	faults               *FaultInjection
+	idleSessions         sync.Map // VIN → idleSession
+	started              time.Time
+	documents            *documents
+	drainingSince        atomic.Pointer[time.Time] // Nil unless draining
+	admission            admissionQueue
+	ipFilter             *IPFilter
+	vinAllowlist         *VINAllowlist
+	accessLogLock        sync.Mutex
+	clock                clock.Clock
+}
+
+// Dialer opens a connection that carries commands for vin, on behalf of acct.
+type Dialer func(ctx context.Context, acct *account.Account, vin string) (connector.Connector, error)
+
+// Option configures a Proxy created by New.
+type Option func(*Proxy)
+
+// WithDialer makes the proxy send signed commands over connections returned by dial instead of
+// through Fleet API. This allows tests to exercise the full HTTP API against an in-memory vehicle.
+// Requests that the proxy forwards are unaffected.
+func WithDialer(dial Dialer) Option {
+	return func(p *Proxy) {
+		p.dial = dial
+	}
+}
+
+// WithClock makes the proxy use c instead of the system clock to expire cached vehicle state and
+// to time retries, both its own and those of the vehicle sessions it opens. Tests use it to skip
+// delays.
+func WithClock(c clock.Clock) Option {
+	return func(p *Proxy) {
+		p.clock = c
+	}
+}
+
+// VINResolver returns the VIN of the vehicle with the given numeric Fleet API vehicle ID.
+type VINResolver func(ctx context.Context, acct *account.Account, id string) (string, error)
+
+// WithVINResolver replaces the lookup the proxy uses to translate vehicle IDs in request paths
+// into VINs. By default, the proxy uses [account.Account.ResolveVIN].
+func WithVINResolver(resolve VINResolver) Option {
+	return func(p *Proxy) {
+		p.resolveVIN = resolve
+	}
+}
+
+// resolveRouteVIN replaces a vehicle ID in rt with the vehicle's VIN. Vehicle sessions are cached
+// by VIN, so commands sent by ID and by VIN share them. It writes an error response and returns
+// false if the ID can't be resolved.
+func (p *Proxy) resolveRouteVIN(acct *account.Account, w http.ResponseWriter, rt *route) bool {
+	if !account.IsVehicleID(rt.vin) {
+		return true
+	}
+	// Forwarded requests only need the VIN to check the allowlist.
+	if rt.kind == routeForward && p.vinAllowlist.Len() == 0 {
+		return true
+	}
+	resolve := p.resolveVIN
+	if resolve == nil {
+		resolve = func(ctx context.Context, acct *account.Account, id string) (string, error) {
+			return acct.ResolveVIN(ctx, id)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+	vin, err := resolve(ctx, acct, rt.vin)
+	switch {
+	case errors.Is(err, account.ErrUnknownVehicleID) || errors.Is(err, account.ErrAmbiguousVehicleID):
+		writeJSONError(w, http.StatusNotFound, err)
+		return false
+	case err != nil:
+		writeJSONError(w, http.StatusBadGateway, fmt.Errorf("couldn't resolve vehicle ID %s: %w", rt.vin, err))
+		return false
+	}
+	log.Debug("Resolved vehicle ID %s to %s", rt.vin, vin)
+	rt.vin = vin
+	return true
 }
 
 func (p *Proxy) updateDomainForSubject(subject, domain string) {
@@ -69,12 +367,16 @@ func (p *Proxy) fetchDomainForSubject(subject string) string {
 }
 
 func (p *Proxy) markUnsupportedVIN(vin string) {
-	p.unsupported.Store(vin, true)
+	p.signedCommands.Store(vin, false)
+}
+
+func (p *Proxy) markSupportedVIN(vin string) {
+	p.signedCommands.Store(vin, true)
 }
 
 func (p *Proxy) isNotSupported(vin string) bool {
-	_, ok := p.unsupported.Load(vin)
-	return ok
+	supported, ok := p.signedCommands.Load(vin)
+	return ok && !supported.(bool)
 }
 
 // lockVIN locks a VIN-specific mutex, blocking until the operation succeeds or ctx expires.
@@ -110,12 +412,36 @@ func (p *Proxy) unlockVIN(vin string) {
 //
 // Vehicles must have the public part of skey enrolled on their keychains. (This is a
 // command-authentication key, not a TLS key.)
-func New(_ context.Context, skey protocol.ECDHPrivateKey, cacheSize int) (*Proxy, error) {
-	return &Proxy{
-		Timeout:    DefaultTimeout,
-		commandKey: skey,
-		sessions:   cache.New(cacheSize),
-	}, nil
+func New(_ context.Context, skey protocol.ECDHPrivateKey, cacheSize int, options ...Option) (*Proxy, error) {
+	p := &Proxy{
+		Timeout:             DefaultTimeout,
+		RoleRefreshInterval: DefaultRoleRefreshInterval,
+		MaxURLLength:        DefaultMaxURLLength,
+		MaxHeaderBytes:      DefaultMaxHeaderBytes,
+		CompressionMinBytes: DefaultCompressionMinBytes,
+		MaxKeepAliveIdle:    DefaultMaxKeepAliveIdle,
+		MaxClockSkew:        DefaultMaxClockSkew,
+		VehicleIdleTimeout:  DefaultVehicleIdleTimeout,
+		commandKey:          skey,
+		sessions:            cache.New(cacheSize),
+		cacheSize:           cacheSize,
+		metrics:             newProxyMetrics(),
+		started:             time.Now(),
+		clock:               clock.Real,
+		Callbacks: CallbackConfig{
+			Attempts:      DefaultCallbackAttempts,
+			RetryInterval: DefaultCallbackRetryInterval,
+		},
+	}
+	for _, option := range options {
+		option(p)
+	}
+	p.admission.clock = p.clock
+	var err error
+	if p.documents, err = newDocuments(p.started); err != nil {
+		return nil, fmt.Errorf("couldn't encode command catalog: %w", err)
+	}
+	return p, nil
 }
 
 // Response contains a server's response to a client request.
@@ -128,6 +454,129 @@ type Response struct {
 type carResponse struct {
 	Result bool   `json:"result"`
 	Reason string `json:"reason"`
+
+	// ChargeLimitSOC is the resulting charge limit, for commands listed in chargeLimitCommands.
+	ChargeLimitSOC *int32 `json:"charge_limit_soc,omitempty"`
+
+	// DriverTemp and PassengerTemp are the resulting setpoints after set_temps, in degrees Celsius.
+	// The vehicle may round or clamp the requested temperatures.
+	DriverTemp    *float32 `json:"driver_temp,omitempty"`
+	PassengerTemp *float32 `json:"passenger_temp,omitempty"`
+
+	// OffPeakCharging reports the vehicle's settings after get_off_peak_charging and
+	// set_off_peak_charging.
+	OffPeakCharging *offPeakCharging `json:"off_peak_charging,omitempty"`
+
+	// BusyRetries is the number of times the proxy repeated the command because the vehicle was
+	// busy.
+	BusyRetries int `json:"busy_retries,omitempty"`
+
+	// Location is the vehicle's position after get_location.
+	Location *location `json:"location,omitempty"`
+
+	// ChargeState is the vehicle's battery and charging state after get_charge_state.
+	ChargeState *chargeState `json:"charge_state,omitempty"`
+
+	// LockState is the vehicle's lock state after door_lock or door_unlock, if the client asked
+	// for confirmation.
+	LockState *lockState `json:"lock_state,omitempty"`
+
+	// Timing breaks down the time spent on the command, if Proxy.IncludeTiming is set.
+	Timing *commandTiming `json:"timing,omitempty"`
+
+	// Messages lists the messages exchanged with the vehicle, if Proxy.IncludeMessages is set.
+	Messages *commandMessages `json:"messages,omitempty"`
+}
+
+// successResponse returns the response to a command that car executed. ctx is the context the
+// command was sent with.
+func successResponse(ctx context.Context, car *vehicle.Vehicle) *carResponse {
+	reply := &carResponse{Result: true, BusyRetries: car.BusyRetries()}
+	if timing := connector.TimingFromContext(ctx); timing != nil {
+		reply.Timing = &commandTiming{timing: timing}
+	}
+	if transcript := vehicle.TranscriptFromContext(ctx); transcript != nil {
+		reply.Messages = &commandMessages{transcript: transcript}
+	}
+	return reply
+}
+
+// commandTiming encodes a vehicle.Timing in milliseconds. The Timing is read when the response is
+// encoded, so it includes requests made after the command, such as reading back a charge limit.
+type commandTiming struct {
+	timing *vehicle.Timing
+}
+
+func (c *commandTiming) MarshalJSON() ([]byte, error) {
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return json.Marshal(struct {
+		Connect   float64 `json:"connect_ms"`
+		Handshake float64 `json:"handshake_ms"`
+		Signing   float64 `json:"signing_ms"`
+		RoundTrip float64 `json:"round_trip_ms"`
+		RetryWait float64 `json:"retry_wait_ms"`
+		Retries   int     `json:"retries"`
+	}{
+		ms(c.timing.Connect), ms(c.timing.Handshake), ms(c.timing.Signing),
+		ms(c.timing.RoundTrip), ms(c.timing.RetryWait), c.timing.Retries,
+	})
+}
+
+// commandMessages encodes a vehicle.Transcript as a list of protobuf JSON messages. Like
+// commandTiming, the Transcript is read when the response is encoded.
+type commandMessages struct {
+	transcript *vehicle.Transcript
+}
+
+type commandMessage struct {
+	Domain      string          `json:"domain"`
+	FromVehicle bool            `json:"from_vehicle"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+func (c *commandMessages) MarshalJSON() ([]byte, error) {
+	messages := []commandMessage{}
+	for _, m := range c.transcript.Messages() {
+		payload := protocol.NewPayloadMessage(m.Domain, m.FromVehicle)
+		if payload == nil {
+			continue
+		}
+		if err := proto.Unmarshal(m.Payload, payload); err != nil {
+			return nil, fmt.Errorf("couldn't decode message from %s: %w", m.Domain, err)
+		}
+		encoded, err := protocol.MarshalJSON(payload, "")
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, commandMessage{
+			Domain:      m.Domain.String(),
+			FromVehicle: m.FromVehicle,
+			Payload:     encoded,
+		})
+	}
+	return json.Marshal(messages)
+}
+
+type location struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Heading   *float64 `json:"heading,omitempty"` // Degrees clockwise from north
+	Speed     *float64 `json:"speed,omitempty"`   // Miles per hour
+	GPSAsOf   int64    `json:"gps_as_of,omitempty"`
+}
+
+type offPeakCharging struct {
+	Enabled        bool `json:"enabled"`
+	WeekdaysOnly   bool `json:"weekdays_only"`
+	EndOffPeakTime int  `json:"end_off_peak_time"` // Minutes after midnight
+}
+
+// chargeLimitCommands set the charge limit to a percentage that depends on the vehicle. Their
+// responses include the resulting limit so that clients don't need to query it separately. If
+// the limit is already at the requested setting, they succeed with the vehicle's reason.
+var chargeLimitCommands = map[string]bool{
+	"charge_standard":  true,
+	"charge_max_range": true,
 }
 
 func writeJSONError(w http.ResponseWriter, code int, err error) {
@@ -138,6 +587,10 @@ func writeJSONError(w http.ResponseWriter, code int, err error) {
 	if errors.As(err, &httpErr) {
 		code = httpErr.Code
 		jsonBytes = []byte(err.Error())
+		// Pass on Fleet API's request to back off, for example when it rate limits the vehicle.
+		if httpErr.RetryAfter > 0 && w.Header().Get("Retry-After") == "" {
+			w.Header().Set("Retry-After", retryAfterSeconds(httpErr.RetryAfter))
+		}
 	} else {
 		if err == nil {
 			reply.Error = http.StatusText(code)
@@ -164,6 +617,7 @@ func writeJSONError(w http.ResponseWriter, code int, err error) {
 }
 
 var connectionHeaders = []string{
+	"Connection",
 	"Proxy-Connection",
 	"Keep-Alive",
 	"Transfer-Encoding",
@@ -171,6 +625,22 @@ var connectionHeaders = []string{
 	"Upgrade",
 }
 
+// removeConnectionHeaders removes hop-by-hop headers from header, including those that its
+// Connection header lists. HTTP/1.0 clients, for example, send "Connection: keep-alive" to reuse
+// their connection to the proxy, which mustn't be passed on to Fleet API.
+func removeConnectionHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range connectionHeaders {
+		header.Del(name)
+	}
+}
+
 // forwardRequest is the fallback handler for "/api/1/*".
 // It forwards GET and POST requests to Tesla using the proxy's OAuth token.
 func (p *Proxy) forwardRequest(acct *account.Account, w http.ResponseWriter, req *http.Request) {
@@ -183,10 +653,7 @@ func (p *Proxy) forwardRequest(acct *account.Account, w http.ResponseWriter, req
 		return
 	}
 	proxyReq.Header = req.Header.Clone()
-	// Remove per-hop headers
-	for _, hdr := range connectionHeaders {
-		proxyReq.Header.Del(hdr)
-	}
+	removeConnectionHeaders(proxyReq.Header)
 
 	clientIP, _, err := net.SplitHostPort(req.RemoteAddr)
 	if err != nil {
@@ -261,13 +728,16 @@ func (p *Proxy) forwardRequest(acct *account.Account, w http.ResponseWriter, req
 				proxyReq.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 			}
 		} else {
-			for _, hdr := range connectionHeaders {
-				result.Header.Del(hdr)
-			}
+			removeConnectionHeaders(result.Header)
 			outHeader := w.Header()
 			for name, value := range result.Header {
 				outHeader[name] = value
 			}
+			// The body has been read in full, so clients that don't support chunked encoding,
+			// such as HTTP/1.0 clients, can keep their connection open.
+			if result.StatusCode != http.StatusNoContent && result.StatusCode != http.StatusNotModified {
+				outHeader.Set("Content-Length", strconv.Itoa(len(body)))
+			}
 
 			w.WriteHeader(result.StatusCode)
 			w.Write(body)
@@ -293,58 +763,308 @@ func (p *Proxy) forwardRequest(acct *account.Account, w http.ResponseWriter, req
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	log.Info("Received %s request for %s", req.Method, req.URL.Path)
 
-	if req.URL.Path == "/health" {
-		p.handleHealthCheck(w, req)
+	if p.AccessLog != nil {
+		aw := &accessLogWriter{ResponseWriter: w}
+		defer p.logAccess(aw, req, time.Now())
+		w = aw
+	}
+	if cw := newCompressWriter(w, req, p.CompressionMinBytes); cw != nil {
+		defer cw.Close()
+		w = cw
+	}
+	rec := &statusRecorder{ResponseWriter: w}
+	defer p.recoverPanic(rec, req)
+	w = rec
+
+	if p.CloseConnections {
+		w.Header().Set("Connection", "close")
+	}
+
+	if req = p.stripBasePath(w, req); req == nil {
 		return
 	}
 
-	acct, err := getAccount(req)
+	if !p.allowClient(w, req) {
+		return
+	}
+
+	if code, err := p.checkRequestSize(req); err != nil {
+		writeJSONError(w, code, err)
+		return
+	}
+
+	rt := routeRequest(req)
+	p.resolveCommandAlias(req, &rt)
+	if rt.public() {
+		if !rt.allowMethod(w, req) {
+			return
+		}
+		switch rt.kind {
+		case routeHealth:
+			p.handleHealthCheck(w, req)
+		case routeVersion:
+			p.handleVersion(w, req)
+		case routeMetrics:
+			if p.authorizeMetrics(w, req) {
+				p.handleMetrics(w, req)
+			}
+		case routeCommandCatalog:
+			p.handleCommandCatalog(w, req)
+		case routeCommandSchema:
+			p.handleCommandSchema(w, req, rt.command)
+		case routeUI:
+			p.handleUI(w, req)
+		}
+		return
+	}
+
+	if rt.admin() {
+		if !p.authorizeAdmin(w, req) || !rt.allowMethod(w, req) {
+			return
+		}
+		switch rt.kind {
+		case routeResetSession:
+			p.handleResetSession(w, req, rt.vin)
+		case routeLastCommand:
+			p.handleLastCommand(w, rt.vin)
+		case routeAdminStats:
+			p.handleAdminStats(w)
+		case routeAdminDrain:
+			p.handleAdminDrain(w, req)
+		case routeAdminConfig:
+			p.handleAdminConfig(w)
+		case routeAdminClockCheck:
+			p.handleAdminClockCheck(w, req)
+		}
+		return
+	}
+
+	if p.MaxConcurrentRequests > 0 {
+		if !p.admit(w, req) {
+			return
+		}
+		slot := &admissionSlot{queue: &p.admission}
+		req = req.WithContext(context.WithValue(req.Context(), admissionSlotKey{}, slot))
+		defer slot.release()
+	}
+
+	p.metrics.requestsInFlight.Add(1)
+	defer p.metrics.requestsInFlight.Add(-1)
+
+	acct, err := getAccount(req, p.UserAgent)
 	if err != nil {
 		writeJSONError(w, http.StatusForbidden, err)
 		return
 	}
+	acct.Clock = p.clock
+	acct.CallTimeout = p.APICallTimeout
+	if p.FleetAPIHost != "" {
+		acct.Host = p.FleetAPIHost
+	}
 	if host := p.fetchDomainForSubject(acct.Subject); host != "" {
 		acct.Host = host
 	}
+	if !p.resolveRouteVIN(acct, w, &rt) {
+		return
+	}
 
-	if strings.HasPrefix(req.URL.Path, "/api/1/vehicles/") {
-		path := strings.Split(req.URL.Path, "/")
-		if len(path) == 7 && path[5] == "command" {
-			command := path[6]
-			vin := path[4]
-			if len(vin) != vinLength {
-				writeJSONError(w, http.StatusNotFound, errors.New("expected 17-character VIN in path (do not user Fleet API ID)"))
-				return
-			}
-			if p.isNotSupported(vin) {
-				p.forwardRequest(acct, w, req)
-				if acct.Host != p.fetchDomainForSubject(acct.Subject) {
-					p.updateDomainForSubject(acct.Subject, acct.Host)
-				}
-			} else {
-				if err := p.handleVehicleCommand(acct, w, req, command, vin); err == ErrCommandUseRESTAPI {
-					p.forwardRequest(acct, w, req)
-				}
-			}
-			return
-		}
-		if len(path) == 5 && path[4] == "fleet_telemetry_config" {
+	switch rt.kind {
+	case routeVehicleCommand:
+		p.handleCommandRoute(acct, w, req, &rt)
+	case routeFleetTelemetryConfig:
+		if rt.allowMethod(w, req) {
 			p.handleFleetTelemetryConfig(acct, w, req)
-			return
+		}
+	case routeBulkChargeLimit:
+		if rt.allowMethod(w, req) {
+			p.handleBulkChargeLimit(acct, w, req)
+		}
+	case routeCommandProtocol:
+		if rt.allowMethod(w, req) && p.allowVehicle(w, rt.vin) {
+			p.handleCommandProtocol(acct, w, rt.vin)
+		}
+	case routeVehicleAwake:
+		if rt.allowMethod(w, req) && p.allowVehicle(w, rt.vin) {
+			p.handleVehicleAwake(acct, w, rt.vin)
+		}
+	case routeVehicleAlerts:
+		if rt.allowMethod(w, req) && p.allowVehicle(w, rt.vin) {
+			p.handleVehicleAlerts(acct, w, rt.vin)
+		}
+	case routeCommandSequence:
+		if rt.allowMethod(w, req) && p.allowVehicle(w, rt.vin) {
+			p.handleCommandSequence(acct, w, req, rt.vin)
+		}
+	default:
+		if rt.allowMethod(w, req) && (rt.vin == "" || p.allowVehicle(w, rt.vin)) {
+			p.forwardRequest(acct, w, req)
 		}
 	}
-	p.forwardRequest(acct, w, req)
 }
 
-func (p *Proxy) handleHealthCheck(w http.ResponseWriter, req *http.Request) {
-	if req.Method != http.MethodGet {
-		writeJSONError(w, http.StatusMethodNotAllowed, nil)
+// handleCommandRoute handles requests to /api/1/vehicles/{VIN}/command/{command}. Unlike other
+// routes, requests with the wrong method are audited.
+func (p *Proxy) handleCommandRoute(acct *account.Account, w http.ResponseWriter, req *http.Request, rt *route) {
+	command, vin := rt.command, rt.vin
+	if len(vin) != vinLength {
+		writeJSONError(w, http.StatusNotFound, errors.New("expected 17-character VIN or numeric vehicle ID in path"))
+		return
+	}
+	id := requestID(req)
+	w.Header().Set(requestIDHeader, id)
+	rec := &statusRecorder{ResponseWriter: w}
+	// Unknown commands are rejected before the method is checked, since no method would succeed.
+	// Vehicles that don't support the signed command protocol are the exception: all of their
+	// commands are forwarded, including Fleet API commands the catalog doesn't list, such as
+	// navigation_gps_request.
+	if _, ok := catalog.Lookup(command); !ok && !p.isNotSupported(vin) {
+		err := p.unknownCommandError(command)
+		writeJSONError(rec, http.StatusNotFound, err)
+		p.audit(req, acct, id, vin, command, AuditOutcomeFailure, rec.status, nil, err)
+		return
+	}
+	if !rt.allowMethod(rec, req) {
+		p.audit(req, acct, id, vin, command, AuditOutcomeFailure, rec.status, nil, errWrongMethod)
+		return
+	}
+	callbackURL, err := extractCallbackURL(req, &p.Callbacks)
+	if err == nil && callbackURL != "" && len(p.Callbacks.SigningKey) == 0 {
+		err = errCallbacksDisabled
+	}
+	if err != nil {
+		writeJSONError(rec, http.StatusBadRequest, err)
+		p.audit(req, acct, id, vin, command, AuditOutcomeFailure, rec.status, nil, err)
+		return
+	}
+	if callbackURL != "" {
+		p.handleAsyncCommand(acct, w, req, command, vin, id, callbackURL)
+		return
+	}
+	p.executeCommand(acct, rec, req, command, vin, id)
+}
+
+// executeCommand sends a command to a vehicle, or forwards it to Fleet API, and audits the result.
+func (p *Proxy) executeCommand(acct *account.Account, rec *statusRecorder, req *http.Request, command, vin, id string) {
+	var outcome string
+	var err error
+	if !p.allowVehicle(rec, vin) {
+		p.audit(req, acct, id, vin, command, AuditOutcomeFailure, rec.status, nil, errVehicleNotAllowed)
+		return
+	}
+	if (p.Audit != nil || p.recordsLastCommands()) && rec.body == nil {
+		rec.body = new(bytes.Buffer)
+	}
+	if p.recordsLastCommands() {
+		defer p.recordLastCommand(vin, command, id, p.clock.Now(), rec)
+	}
+	if err = p.applyDefaults(req, command, vin); err != nil {
+		writeJSONError(rec, http.StatusBadRequest, err)
+		p.audit(req, acct, id, vin, command, AuditOutcomeFailure, rec.status, nil, err)
+		return
+	}
+	if strings.HasPrefix(command, "speed_limit_") && !p.AllowSpeedLimit {
+		writeJSONError(rec, http.StatusForbidden, errSpeedLimitDisabled)
+		p.audit(req, acct, id, vin, command, AuditOutcomeFailure, rec.status, nil, errSpeedLimitDisabled)
+		return
+	}
+	if err = p.authorize(acct, rec, req, command, vin); err != nil {
+		p.audit(req, acct, id, vin, command, AuditOutcomeFailure, rec.status, nil, err)
+		return
+	}
+	if injected, err := p.injectFault(rec, req, command, vin); injected {
+		p.audit(req, acct, id, vin, command, AuditOutcomeFailure, rec.status, rec.response(), err)
+		return
+	}
+	if err = p.checkVehicleAvailable(acct, rec, req, vin); err != nil {
+		p.audit(req, acct, id, vin, command, AuditOutcomeFailure, rec.status, rec.response(), err)
+		return
+	}
+	if command == wakeCommand {
+		outcome, err = p.coalesceWake(acct, rec, req, vin)
+	} else {
+		outcome, err = p.sendCommand(acct, rec, req, command, vin)
+	}
+	p.audit(req, acct, id, vin, command, outcome, rec.status, rec.response(), err)
+}
+
+// sendCommand sends a command to a vehicle, or forwards it to Fleet API, and returns the outcome
+// to audit.
+func (p *Proxy) sendCommand(acct *account.Account, w http.ResponseWriter, req *http.Request, command, vin string) (outcome string, err error) {
+	outcome = AuditOutcomeForwarded
+	if p.isNotSupported(vin) {
+		p.forwardRequest(acct, w, req)
+		if acct.Host != p.fetchDomainForSubject(acct.Subject) {
+			p.updateDomainForSubject(acct.Subject, acct.Host)
+		}
+	} else {
+		if err = p.handleVehicleCommand(acct, w, req, command, vin); err == ErrCommandUseRESTAPI {
+			err = nil
+			p.forwardRequest(acct, w, req)
+		} else if err == nil {
+			outcome = AuditOutcomeSuccess
+		} else if !errors.Is(err, protocol.ErrProtocolNotSupported) {
+			outcome = AuditOutcomeFailure
+		}
+	}
+	return outcome, err
+}
+
+func (p *Proxy) audit(req *http.Request, acct *account.Account, id, vin, command, outcome string, status int,
+	response json.RawMessage, err error) {
+	if p.Audit == nil {
+		return
+	}
+	record := AuditRecord{
+		RequestID: id,
+		VIN:       vin,
+		Command:   command,
+		Requester: requesterIdentity(req, acct.Subject),
+		Outcome:   outcome,
+		Status:    status,
+		Response:  response,
+	}
+	if err != nil && !errors.Is(err, protocol.ErrProtocolNotSupported) {
+		record.Error = err.Error()
+	}
+	p.Audit.Record(record)
+}
+
+func (p *Proxy) handleHealthCheck(w http.ResponseWriter, _ *http.Request) {
+	if p.Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("DRAINING"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
+// handleVersion reports which build of the proxy is running.
+func (p *Proxy) handleVersion(w http.ResponseWriter, _ *http.Request) {
+	info := version.Get()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: &info})
+}
+
+// handleCommandCatalog describes the commands the proxy accepts. The catalog doesn't contain
+// account-specific information, so the endpoint doesn't require authentication.
+func (p *Proxy) handleCommandCatalog(w http.ResponseWriter, req *http.Request) {
+	p.documents.catalog.serve(w, req, p.documents.modified)
+}
+
+// handleCommandSchema serves the JSON Schema of command's request body. The schema is generated
+// from the catalog entry that validates requests, so clients that check bodies against it see the
+// same errors the proxy would report.
+func (p *Proxy) handleCommandSchema(w http.ResponseWriter, req *http.Request, command string) {
+	schema, ok := p.documents.schemas[command]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, p.unknownCommandError(command))
+		return
+	}
+	schema.serve(w, req, p.documents.modified)
+}
+
 func (p *Proxy) handleFleetTelemetryConfig(acct *account.Account, w http.ResponseWriter, req *http.Request) {
 	log.Info("Processing fleet telemetry configuration...")
 	defer func() {
@@ -363,6 +1083,15 @@ func (p *Proxy) handleFleetTelemetryConfig(acct *account.Account, w http.Respons
 		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("could not parse JSON body: %s", err))
 		return
 	}
+	if params.Config == nil {
+		writeJSONError(w, http.StatusBadRequest, errors.New("missing config"))
+		return
+	}
+	for _, vin := range params.VINs {
+		if !p.allowVehicle(w, vin) {
+			return
+		}
+	}
 
 	// Let the server validate the VINs and config, the proxy just needs to sign
 	if _, ok := params.Config["aud"]; ok {
@@ -399,6 +1128,34 @@ func (p *Proxy) handleFleetTelemetryConfig(acct *account.Account, w http.Respons
 func (p *Proxy) handleVehicleCommand(acct *account.Account, w http.ResponseWriter, req *http.Request, command, vin string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
 	defer cancel()
+	if p.IncludeTiming {
+		ctx, _ = vehicle.WithTiming(ctx)
+	}
+	if p.IncludeMessages {
+		ctx, _ = vehicle.WithTranscript(ctx)
+	}
+
+	if command == "get_location" && !p.AllowLocation {
+		writeJSONError(w, http.StatusForbidden, errLocationDisabled)
+		return errLocationDisabled
+	}
+
+	connectTimeout, commandTimeout, err := p.phaseTimeouts(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return err
+	}
+
+	if !p.metrics.commandStarted(vin, p.MaxActiveSessions) {
+		w.Header().Set("Retry-After", strconv.Itoa(sessionRetryAfterSeconds))
+		writeJSONError(w, http.StatusServiceUnavailable, errTooManySessions)
+		return errTooManySessions
+	}
+	defer p.metrics.commandFinished(vin)
+	if p.MaxActiveSessions > 0 {
+		// Idle connections count toward the limit, so they make room for vin's.
+		p.evictIdleVehicles(p.MaxActiveSessions)
+	}
 
 	// Serialize commands sent to a specific VIN to avoid some complexities associated with sharing
 	// the vehicle.Vehicle object. VCSEC commands fail if they arrive out of order, anyway.
@@ -408,82 +1165,339 @@ func (p *Proxy) handleVehicleCommand(acct *account.Account, w http.ResponseWrite
 	}
 	defer p.unlockVIN(vin)
 
-	car, commandToExecuteFunc, err := p.loadVehicleAndCommandFromRequest(ctx, acct, w, req, command, vin)
+	if err := p.loadStoredSessions(ctx, vin); err != nil {
+		writeJSONError(w, http.StatusServiceUnavailable, err)
+		return err
+	}
+
+	domain, err := p.validateCommandRequest(ctx, w, req, command)
 	if err != nil {
 		return err
 	}
+	// Dialing the vehicle, connecting, and the session handshake are limited by connectTimeout, so
+	// that commands to unreachable vehicles fail fast.
+	connectCtx, cancelConnect := withPhaseTimeout(ctx, connectTimeout)
+	defer cancelConnect()
+	log.Debug("Executing %s on %s", command, vin)
+	token, _ := bearerToken(req)
+	h, err := p.acquireVehicle(connectCtx, acct, token, vin)
+	if err != nil || h == nil {
+		writeConnectError(connectCtx, ctx, w, err)
+		return err
+	}
+	defer p.releaseVehicle(h)
+	car := h.car
+	if domain != protocol.DomainNone {
+		log.Debug("Overriding domain of %s with %s", command, domain)
+		car.DomainOverride = domain
+	}
 
-	if err := car.Connect(ctx); err != nil {
-		writeJSONError(w, http.StatusInternalServerError, err)
+	if err := p.checkKeyRole(vin, command); err != nil {
+		writeJSONError(w, http.StatusForbidden, err)
 		return err
 	}
-	defer car.Disconnect()
 
-	if err := car.StartSession(ctx, nil); errors.Is(err, protocol.ErrProtocolNotSupported) {
+	if err := p.checkCapability(ctx, acct, w, req, car, command); err != nil {
+		return err
+	}
+
+	reconnected := !h.connected
+	if err := h.connect(connectCtx); err != nil {
+		writeConnectError(connectCtx, ctx, w, err)
+		return err
+	}
+
+	if err := car.StartSession(connectCtx, nil); errors.Is(err, protocol.ErrProtocolNotSupported) {
 		p.markUnsupportedVIN(vin)
 		p.forwardRequest(acct, w, req)
 		return err
 	} else if err != nil {
-		writeJSONError(w, http.StatusInternalServerError, err)
+		writeConnectError(connectCtx, ctx, w, err)
 		return err
 	}
+	cancelConnect()
+	p.markSupportedVIN(vin)
 	defer func() {
-		_ = car.UpdateCachedSessions(p.sessions)
+		p.saveSessions(h)
+		p.saveStoredSessions(ctx, vin)
+		p.touchSession(acct, vin)
 	}()
 
+	if reconnected {
+		p.refreshKeyRole(ctx, car, vin)
+	}
+	if err := p.checkKeyRole(vin, command); err != nil {
+		writeJSONError(w, http.StatusForbidden, err)
+		return err
+	}
+
+	// The command timeout starts once the session is established. Commands are bound to the
+	// context they're extracted with, so the command is extracted again now that it has started.
+	commandCtx, cancelCommand := withPhaseTimeout(ctx, commandTimeout)
+	defer cancelCommand()
+	commandToExecuteFunc, err := p.extractCommandAction(commandCtx, req, command)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return err
+	}
 	if err = commandToExecuteFunc(car); err == ErrCommandUseRESTAPI {
 		return err
 	}
+	if p.forgetKeyRole(vin, err) {
+		p.refreshKeyRole(ctx, car, vin)
+	}
+	if err != nil && phaseExpired(commandCtx, ctx) {
+		writeJSONError(w, http.StatusGatewayTimeout, errCommandTimeout)
+		return err
+	}
+	if errors.Is(err, inet.ErrAPICallTimeout) {
+		writeJSONError(w, http.StatusGatewayTimeout, err)
+		return err
+	}
+	if command == "door_unlock" && vehicle.InMotion(err) {
+		writeInMotionResponse(w)
+		return err
+	}
+	if reason, ok := vehicle.AlreadySet(err); ok && chargeLimitCommands[command] {
+		writeChargeLimitResponse(commandCtx, w, car, reason)
+		return nil
+	}
 	if protocol.IsNominalError(err) {
 		writeJSONError(w, http.StatusOK, err)
 		return err
 	}
+	if errors.Is(err, vehicle.ErrTemperatureOutOfRange) {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return err
+	}
+	var busyErr *vehicle.BusyError
+	if errors.As(err, &busyErr) {
+		p.writeBusyError(w, busyErr)
+		return err
+	}
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, err)
 		return err
 	}
 
+	if chargeLimitCommands[command] {
+		writeChargeLimitResponse(commandCtx, w, car, "")
+		return nil
+	}
+	if command == "get_off_peak_charging" || command == "set_off_peak_charging" {
+		return writeOffPeakChargingResponse(commandCtx, w, car, command == "get_off_peak_charging")
+	}
+	if command == "set_temps" {
+		writeTemperatureResponse(commandCtx, w, car)
+		return nil
+	}
+	if _, ok := lockCommands[command]; ok {
+		writeLockResponse(commandCtx, w, req, car, command)
+		return nil
+	}
+	if command == "get_location" {
+		return p.writeLocationResponse(commandCtx, w, car)
+	}
+	if command == "get_charge_state" {
+		return p.writeChargeStateResponse(commandCtx, w, acct, car)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "{\"response\":{\"result\":true,\"reason\":\"\"}}")
+	json.NewEncoder(w).Encode(&Response{Response: successResponse(commandCtx, car)})
 	return nil
 }
 
-func (p *Proxy) loadVehicleAndCommandFromRequest(ctx context.Context, acct *account.Account, w http.ResponseWriter, req *http.Request,
-	command, vin string) (*vehicle.Vehicle, func(*vehicle.Vehicle) error, error) {
+// DefaultBusyStatus is the default value of Proxy.BusyStatus. Clients commonly treat 429 as a
+// signal to back off, which is what a busy vehicle needs.
+const DefaultBusyStatus = http.StatusTooManyRequests
 
-	log.Debug("Executing %s on %s", command, vin)
-	if req.Method != http.MethodPost {
-		writeJSONError(w, http.StatusMethodNotAllowed, nil)
-		return nil, nil, fmt.Errorf("wrong http method")
+func (p *Proxy) busyStatus() int {
+	if p.BusyStatus == 0 {
+		return DefaultBusyStatus
+	}
+	return p.BusyStatus
+}
+
+// writeBusyError tells the client to try again once the vehicle is no longer busy. The vehicle
+// didn't execute the command, and the proxy has already retried it for as long as the request's
+// deadline allowed, so the failure is reported as p.BusyStatus rather than 500.
+func (p *Proxy) writeBusyError(w http.ResponseWriter, busyErr *vehicle.BusyError) {
+	w.Header().Set("Retry-After", retryAfterSeconds(busyErr.RetryAfter))
+	writeJSONError(w, p.busyStatus(), busyErr)
+}
+
+// retryAfterSeconds formats d as the value of a Retry-After header, rounding up to a whole number
+// of seconds.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int((d + time.Second - 1) / time.Second))
+}
+
+// writeChargeLimitResponse reports success along with the vehicle's new charge limit. The command
+// has already succeeded, so if the limit can't be read, the response omits it. The reason is
+// non-empty if the vehicle refused the command because the limit was already at the requested
+// setting.
+func writeChargeLimitResponse(ctx context.Context, w http.ResponseWriter, car *vehicle.Vehicle, reason string) {
+	reply := successResponse(ctx, car)
+	reply.Reason = reason
+	if limit, err := car.ChargeLimit(ctx); err == nil {
+		reply.ChargeLimitSOC = &limit
+	} else {
+		log.Warning("Couldn't read charge limit after command: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: reply})
+}
+
+// writeTemperatureResponse reports success along with the temperature setpoints the vehicle
+// adopted. As with writeChargeLimitResponse, they're omitted if they can't be read.
+func writeTemperatureResponse(ctx context.Context, w http.ResponseWriter, car *vehicle.Vehicle) {
+	reply := successResponse(ctx, car)
+	if settings, err := car.TemperatureSettings(ctx); err == nil {
+		reply.DriverTemp = &settings.DriverCelsius
+		reply.PassengerTemp = &settings.PassengerCelsius
+	} else {
+		log.Warning("Couldn't read temperature settings after command: %s", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: reply})
+}
+
+// writeOffPeakChargingResponse reports the vehicle's off-peak charging settings. If they can't be
+// read, the request fails if the settings are the point of the command (required is true);
+// otherwise the command has already succeeded and the response omits them.
+func writeOffPeakChargingResponse(ctx context.Context, w http.ResponseWriter, car *vehicle.Vehicle, required bool) error {
+	reply := successResponse(ctx, car)
+	settings, err := car.OffPeakCharging(ctx)
+	switch {
+	case err == nil:
+		reply.OffPeakCharging = &offPeakCharging{
+			Enabled:        settings.Enabled,
+			WeekdaysOnly:   settings.WeekdaysOnly,
+			EndOffPeakTime: int(settings.EndTime / time.Minute),
+		}
+	case !required:
+		log.Warning("Couldn't read off-peak charging settings after command: %s", err)
+	case protocol.IsNominalError(err):
+		writeJSONError(w, http.StatusOK, err)
+		return err
+	default:
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return err
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: reply})
+	return nil
+}
+
+// writeLocationResponse reports the vehicle's position. A vehicle that doesn't know its position
+// yields an unsuccessful result rather than an error.
+func (p *Proxy) writeLocationResponse(ctx context.Context, w http.ResponseWriter, car *vehicle.Vehicle) error {
+	position, err := car.Location(ctx)
+	var busyErr *vehicle.BusyError
+	switch {
+	case errors.Is(err, vehicle.ErrLocationUnavailable):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(&Response{Response: &carResponse{Reason: err.Error()}})
+		return err
+	case errors.As(err, &busyErr):
+		p.writeBusyError(w, busyErr)
+		return err
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return err
+	}
+	reply := successResponse(ctx, car)
+	reply.Location = &location{
+		Latitude:  position.Latitude,
+		Longitude: position.Longitude,
+		Heading:   position.Heading,
+		Speed:     position.Speed,
+	}
+	if !position.Timestamp.IsZero() {
+		reply.Location.GPSAsOf = position.Timestamp.Unix()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: reply})
+	return nil
+}
 
-	commandToExecuteFunc, err := extractCommandAction(ctx, req, command)
+// validateCommandRequest checks the parameters and X-Tesla-Domain header of req before the proxy
+// contacts the vehicle, and returns the domain named by the header. It writes an error response if
+// they're invalid.
+func (p *Proxy) validateCommandRequest(ctx context.Context, w http.ResponseWriter, req *http.Request, command string) (protocol.Domain, error) {
+	if _, err := p.extractCommandAction(ctx, req, command); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return protocol.DomainNone, err
+	}
+	domain, err := domainOverride(req)
 	if err != nil {
 		writeJSONError(w, http.StatusBadRequest, err)
-		return nil, nil, err
+		return protocol.DomainNone, err
 	}
+	return domain, nil
+}
 
-	car, err := acct.GetVehicle(ctx, vin, p.commandKey, p.sessions)
-	if err != nil || car == nil {
-		writeJSONError(w, http.StatusInternalServerError, err)
-		return nil, nil, err
+// getVehicle returns a vehicle that sends commands through Fleet API, or through p.dial if set.
+func (p *Proxy) getVehicle(ctx context.Context, acct *account.Account, vin string) (*vehicle.Vehicle, error) {
+	if p.dial == nil {
+		return acct.GetVehicle(ctx, vin, p.commandKey, p.sessions)
 	}
+	conn, err := p.dial(ctx, acct, vin)
+	if err != nil {
+		return nil, err
+	}
+	car, err := vehicle.NewVehicle(conn, p.commandKey, p.sessions, vehicle.WithClock(p.clock))
+	if err != nil {
+		conn.Close()
+	}
+	return car, err
+}
 
-	return car, commandToExecuteFunc, err
+// extractCommandAction returns the action for command with the parameters in req. Unrecognized
+// parameters are rejected if p.StrictParameters is set.
+func (p *Proxy) extractCommandAction(ctx context.Context, req *http.Request, command string) (func(*vehicle.Vehicle) error, error) {
+	params, err := commandParameters(req, command)
+	if err != nil {
+		return nil, err
+	}
+	return decodeCommandAction(ctx, command, params, p.StrictParameters)
 }
 
-func extractCommandAction(ctx context.Context, req *http.Request, command string) (func(*vehicle.Vehicle) error, error) {
+// commandParameters returns the parameters in req's JSON body and, if command accepts them, query
+// string. The body is left unread, so req can be parsed again or forwarded.
+func commandParameters(req *http.Request, command string) (RequestParameters, error) {
 	var params RequestParameters
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
 		return nil, &inet.HTTPError{Code: http.StatusBadRequest, Message: "could not read request body"}
 	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
 	if len(body) > 0 {
 		if err := json.Unmarshal(body, &params); err != nil {
 			return nil, &inet.HTTPError{Code: http.StatusBadRequest, Message: "error occurred while parsing request parameters"}
 		}
 	}
-
-	return ExtractCommandAction(ctx, command, params)
+	// Commands that support query parameters accept them in addition to a JSON body. Values in the
+	// body take precedence. Other commands ignore the query string, as they always have.
+	if SupportsQueryParameters(command) {
+		queryParams, err := QueryParameters(command, req.URL.Query())
+		if err != nil {
+			return nil, err
+		}
+		if params == nil {
+			params = queryParams
+		} else {
+			for key, value := range queryParams {
+				if _, ok := params[key]; !ok {
+					params[key] = value
+				}
+			}
+		}
+	}
+	return addConfirmParam(req, command, params)
 }
@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// SupportsQueryParameters returns true if command accepts parameters in the query string. Only
+// commands that are safe to repeat are marked as such in the catalog; commands that unlock the
+// vehicle, enable driving, modify PINs or schedules, or erase data must remain POST-only with a
+// JSON body.
+func SupportsQueryParameters(command string) bool {
+	spec, ok := catalog.Lookup(command)
+	return ok && spec.QueryString
+}
+
+// QueryCommands returns the sorted names of commands that accept query-string parameters.
+func QueryCommands() []string {
+	var names []string
+	for _, spec := range catalog.Commands() {
+		if spec.QueryString {
+			names = append(names, spec.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// QueryParameters converts query-string values into RequestParameters for command, coercing each
+// value to the type that would be used in an equivalent JSON body. Unknown parameters, repeated
+// parameters, and values that cannot be coerced result in an error.
+func QueryParameters(command string, query url.Values) (RequestParameters, error) {
+	if !SupportsQueryParameters(command) {
+		if len(query) > 0 {
+			return nil, &protocol.NominalError{Details: fmt.Errorf("%s does not accept query parameters", command)}
+		}
+		return RequestParameters{}, nil
+	}
+	spec, _ := catalog.Lookup(command)
+	params := make(RequestParameters, len(query))
+	for key, values := range query {
+		param, ok := spec.Parameter(key)
+		if !ok {
+			return nil, &protocol.NominalError{Details: fmt.Errorf("unexpected %s param", key)}
+		}
+		if len(values) != 1 {
+			return nil, invalidParamError(key)
+		}
+		value, err := coerceParam(param.Type, values[0])
+		if err != nil {
+			return nil, invalidParamError(key)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
+
+func coerceParam(kind catalog.Type, value string) (interface{}, error) {
+	switch kind {
+	case catalog.TypeString:
+		return value, nil
+	case catalog.TypeBool:
+		switch strings.ToLower(value) {
+		case "true", "1", "on", "yes":
+			return true, nil
+		case "false", "0", "off", "no":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid boolean %q", value)
+	case catalog.TypeNumber:
+		num, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(num) || math.IsInf(num, 0) {
+			return nil, fmt.Errorf("invalid number %q", value)
+		}
+		return num, nil
+	}
+	return nil, fmt.Errorf("unsupported parameter type")
+}
@@ -0,0 +1,74 @@
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func TestQueryParameters(t *testing.T) {
+	tests := []struct {
+		command  string
+		query    string
+		expected proxy.RequestParameters
+		wantErr  bool
+	}{
+		{"door_lock", "", proxy.RequestParameters{}, false},
+		{"set_charge_limit", "percent=80", proxy.RequestParameters{"percent": 80.0}, false},
+		{"set_charge_limit", "percent=80.5", proxy.RequestParameters{"percent": 80.5}, false},
+		{"set_charge_limit", "percent=-1e1", proxy.RequestParameters{"percent": -10.0}, false},
+		{"set_charge_limit", "percent=eighty", nil, true},
+		{"set_charge_limit", "percent=NaN", nil, true},
+		{"set_charge_limit", "percent=Inf", nil, true},
+		{"set_charge_limit", "percent=80&percent=90", nil, true},
+		{"set_charge_limit", "limit=80", nil, true},
+		{"set_sentry_mode", "on=true", proxy.RequestParameters{"on": true}, false},
+		{"set_sentry_mode", "on=1", proxy.RequestParameters{"on": true}, false},
+		{"set_sentry_mode", "on=OFF", proxy.RequestParameters{"on": false}, false},
+		{"set_sentry_mode", "on=no", proxy.RequestParameters{"on": false}, false},
+		{"set_sentry_mode", "on=maybe", nil, true},
+		{"set_temps", "driver_temp=21.5&passenger_temp=20", proxy.RequestParameters{"driver_temp": 21.5, "passenger_temp": 20.0}, false},
+		{"set_climate_keeper_mode", "climate_keeper_mode=2&manual_override=false",
+			proxy.RequestParameters{"climate_keeper_mode": 2.0, "manual_override": false}, false},
+		{"door_unlock", "force=true", nil, true},
+	}
+
+	for _, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatalf("Bad test query %q: %s", test.query, err)
+		}
+		params, err := proxy.QueryParameters(test.command, query)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Expected error for %s?%s", test.command, test.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %s?%s: %s", test.command, test.query, err)
+		} else if !reflect.DeepEqual(params, test.expected) {
+			t.Errorf("%s?%s: expected %v, got %v", test.command, test.query, test.expected, params)
+		}
+	}
+}
+
+func TestQueryCommandsAreKnown(t *testing.T) {
+	for _, command := range proxy.QueryCommands() {
+		_, err := proxy.ExtractCommandAction(context.Background(), command, proxy.RequestParameters{})
+		var httpErr *inet.HTTPError
+		if errors.As(err, &httpErr) {
+			t.Errorf("Query command %s is not a recognized command", command)
+		}
+	}
+	for _, command := range []string{"door_unlock", "remote_start_drive", "erase_user_data", "set_valet_mode", "actuate_trunk"} {
+		if proxy.SupportsQueryParameters(command) {
+			t.Errorf("%s must be POST-only", command)
+		}
+	}
+}
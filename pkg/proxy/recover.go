@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverPanic converts a panic in a request handler into a 500 Internal Server Error. It must be
+// deferred. The stack trace is logged along with the request ID, which is also returned to the
+// client so the two can be matched up.
+//
+// Handlers release VIN locks and other per-request state with defer, so the proxy can keep serving
+// requests after recovering. If the handler already started writing a response, the response is
+// left truncated.
+func (p *Proxy) recoverPanic(w *statusRecorder, req *http.Request) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	p.metrics.panics.Add(1)
+	id := w.Header().Get(requestIDHeader)
+	if id == "" {
+		id = requestID(req)
+	}
+	log.Error("Recovered from panic while handling %s %s (request %s): %v\n%s", req.Method, req.URL.Path, id, v, debug.Stack())
+	if w.status != 0 {
+		return
+	}
+	w.Header().Set(requestIDHeader, id)
+	writeJSONError(w, http.StatusInternalServerError, fmt.Errorf("internal error (request ID %s)", id))
+}
@@ -0,0 +1,105 @@
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+const testMetricsToken = "metrics-token"
+
+// scrapeMetrics returns the body of GET /metrics, enabling the endpoint on p if necessary.
+func scrapeMetrics(t *testing.T, p *proxy.Proxy) string {
+	t.Helper()
+	if len(p.MetricsToken) == 0 {
+		p.MetricsToken = []byte(testMetricsToken)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer "+string(p.MetricsToken))
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d for metrics: %s", w.Code, w.Body.String())
+	}
+	return w.Body.String()
+}
+
+func TestPanicRecovery(t *testing.T) {
+	panicking := true
+	authorize := func(context.Context, proxy.CommandRequest) error {
+		if panicking {
+			var params map[string]int
+			params["percent"] = 1
+		}
+		return nil
+	}
+	p, car := newTestProxy(t, true, proxy.WithAuthorizer(authorizerFunc(authorize)))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/honk_horn", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	id := w.Header().Get("X-Request-ID")
+	if w.Code != http.StatusInternalServerError || id == "" || !strings.Contains(w.Body.String(), id) {
+		t.Fatalf("Unexpected response to panicking request: %d %v %s", w.Code, w.Header(), w.Body.String())
+	}
+	if metrics := scrapeMetrics(t, p); !strings.Contains(metrics, "tesla_proxy_panics_total 1\n") {
+		t.Errorf("Panic wasn't counted:\n%s", metrics)
+	}
+
+	// The VIN lock was released, so later commands still reach the vehicle.
+	panicking = false
+	if code, reply := postCommand(t, p, "set_charge_limit", map[string]interface{}{"percent": 65.0}); code != http.StatusOK || car.ChargeLimit() != 65 {
+		t.Errorf("Command after panic failed: %d %+v", code, reply)
+	}
+}
+
+func TestMalformedBodies(t *testing.T) {
+	p, _ := newTestProxy(t, true)
+	p.AdminToken = []byte("admin-secret")
+	bodies := []string{
+		``,
+		`{`,
+		`null`,
+		`[]`,
+		`"door_lock"`,
+		`12`,
+		`{"percent": "abc", "on": "yes", "driver_temp": null}`,
+		`{"vins": "` + testVIN + `", "config": []}`,
+		`{"config": null}`,
+		strings.Repeat(`[`, 10000) + strings.Repeat(`]`, 10000),
+		"\x00\xff{}",
+	}
+	paths := []string{
+		"/api/1/vehicles/fleet_telemetry_config",
+		"/admin/vehicles/" + testVIN + "/reset_session",
+	}
+	for _, spec := range catalog.Commands() {
+		if spec.Name != "" && spec.Handling != catalog.HandlingForwarded {
+			paths = append(paths, "/api/1/vehicles/"+testVIN+"/command/"+spec.Name)
+		}
+	}
+	for _, path := range paths {
+		for _, body := range bodies {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			if strings.HasPrefix(path, "/admin/") {
+				req.Header.Set("Authorization", "Bearer admin-secret")
+			} else {
+				req.Header.Set("Authorization", "Bearer "+testToken)
+			}
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, req)
+			if w.Code >= http.StatusInternalServerError {
+				t.Errorf("POST %s with body %.40q: got %d %s", path, body, w.Code, w.Body.String())
+			}
+		}
+	}
+	if metrics := scrapeMetrics(t, p); !strings.Contains(metrics, "tesla_proxy_panics_total 0\n") {
+		t.Errorf("Malformed bodies caused panics:\n%s", metrics)
+	}
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/vehicle"
+)
+
+// DefaultRoleRefreshInterval is how long the proxy trusts the role it last observed for its key on
+// a vehicle.
+const DefaultRoleRefreshInterval = time.Hour
+
+// keyRole records the role of the proxy's command-authentication key on a vehicle.
+type keyRole struct {
+	role    keys.Role
+	fetched time.Time
+}
+
+// RoleError indicates that the proxy's key is enrolled on a vehicle with a role that can't
+// authorize a command.
+type RoleError struct {
+	Command string
+	Role    keys.Role
+}
+
+func (e *RoleError) Error() string {
+	role := strings.ToLower(strings.TrimPrefix(e.Role.String(), "ROLE_"))
+	return fmt.Sprintf("%s requires an owner key, but the proxy's key is enrolled as %s", e.Command, role)
+}
+
+// cachedKeyRole returns the last role observed for the proxy's key on vin and whether that
+// observation is recent enough to use without refreshing it.
+func (p *Proxy) cachedKeyRole(vin string) (role keys.Role, fresh bool) {
+	obj, ok := p.keyRoles.Load(vin)
+	if !ok {
+		return keys.Role_ROLE_NONE, false
+	}
+	entry := obj.(keyRole)
+	return entry.role, clock.Since(p.clock, entry.fetched) < p.RoleRefreshInterval
+}
+
+// checkKeyRole returns a RoleError if the proxy's key is known to lack the role command requires
+// on vin. Vehicles whose role hasn't been observed recently pass the check, so that a key that has
+// been upgraded since the last observation isn't locked out.
+func (p *Proxy) checkKeyRole(vin, command string) error {
+	if p.RoleRefreshInterval <= 0 {
+		return nil
+	}
+	spec, ok := catalog.Lookup(command)
+	if !ok {
+		return nil
+	}
+	if role, fresh := p.cachedKeyRole(vin); fresh && !spec.PermittedFor(role) {
+		return &RoleError{Command: command, Role: role}
+	}
+	return nil
+}
+
+// refreshKeyRole asks car for the role of the proxy's key if the cached value is missing or
+// stale. Failures are logged but otherwise ignored, since the vehicle still enforces roles.
+//
+// The proxy calls refreshKeyRole when it connects to a vehicle, not before every command, so
+// commands sent over a reused connection don't wait for the extra round trip. A command that the
+// vehicle refuses because of the key's role also triggers a refresh; see forgetKeyRole.
+func (p *Proxy) refreshKeyRole(ctx context.Context, car *vehicle.Vehicle, vin string) {
+	if p.RoleRefreshInterval <= 0 || p.commandKey == nil {
+		return
+	}
+	if _, fresh := p.cachedKeyRole(vin); fresh {
+		return
+	}
+	info, err := car.KeyInfoByPublicKey(ctx, p.commandKey.PublicBytes())
+	if err != nil {
+		log.Warning("Couldn't fetch key role: %s", err)
+		return
+	}
+	log.Debug("Proxy key role is %s", info.GetKeyRole())
+	p.keyRoles.Store(vin, keyRole{role: info.GetKeyRole(), fetched: p.clock.Now()})
+}
+
+// forgetKeyRole discards the cached role of the proxy's key on vin if err shows that the vehicle
+// refused a command because of the key's role, which means the role has changed since it was
+// cached. It returns true if the role was discarded.
+func (p *Proxy) forgetKeyRole(vin string, err error) bool {
+	var faultErr *protocol.RoutableMessageError
+	if !errors.As(err, &faultErr) || faultErr.Code != universal.MessageFault_E_MESSAGEFAULT_ERROR_INSUFFICIENT_PRIVILEGES {
+		return false
+	}
+	p.keyRoles.Delete(vin)
+	return true
+}
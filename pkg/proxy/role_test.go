@@ -0,0 +1,84 @@
+package proxy_test
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+// newRoleTestProxy returns a proxy whose key is enrolled on the returned vehicle with role.
+func newRoleTestProxy(t *testing.T, role keys.Role) (*proxy.Proxy, *vehicletest.Vehicle, []byte) {
+	t.Helper()
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	car := vehicletest.New(testVIN)
+	car.Pair(skey.PublicBytes(), role)
+	dial := func(context.Context, *account.Account, string) (connector.Connector, error) {
+		return car.Connect(), nil
+	}
+	p, err := proxy.New(context.Background(), skey, 1, proxy.WithDialer(dial))
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	return p, car, skey.PublicBytes()
+}
+
+func TestKeyRoleFetchedPerConnection(t *testing.T) {
+	p, car, _ := newRoleTestProxy(t, keys.Role_ROLE_DRIVER)
+	for i := 0; i < 3; i++ {
+		if code, _ := postCommand(t, p, "flash_lights", nil); code != http.StatusOK {
+			t.Fatalf("flash_lights: unexpected status %d", code)
+		}
+	}
+	if n := car.KeyInfoRequests(); n != 1 {
+		t.Errorf("Expected one key role request for commands over the same connection, got %d", n)
+	}
+
+	enable := map[string]interface{}{"enable": true}
+	sent := len(car.Commands())
+	if code, _ := postCommand(t, p, "guest_mode", enable); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for owner command with driver key, got %d", code)
+	}
+	if len(car.Commands()) != sent || car.KeyInfoRequests() != 1 {
+		t.Errorf("Vehicle was contacted for a command the cached role can't authorize")
+	}
+}
+
+func TestKeyRoleRefreshedAfterPrivilegeFault(t *testing.T) {
+	p, car, publicKey := newRoleTestProxy(t, keys.Role_ROLE_OWNER)
+	enable := map[string]interface{}{"enable": true}
+	if code, _ := postCommand(t, p, "guest_mode", enable); code != http.StatusOK {
+		t.Fatalf("guest_mode: unexpected status %d", code)
+	}
+
+	// The key is downgraded while the proxy still trusts the role it cached; the vehicle refuses
+	// the next command, which makes the proxy fetch the role again.
+	car.Pair(publicKey, keys.Role_ROLE_DRIVER)
+	car.InjectFault(universal.MessageFault_E_MESSAGEFAULT_ERROR_INSUFFICIENT_PRIVILEGES)
+	if code, _ := postCommand(t, p, "guest_mode", enable); code == http.StatusOK {
+		t.Fatalf("Expected command refused by the vehicle to fail")
+	}
+	car.InjectFault(universal.MessageFault_E_MESSAGEFAULT_ERROR_NONE)
+	if n := car.KeyInfoRequests(); n != 2 {
+		t.Errorf("Expected key role to be fetched again after privilege fault, got %d requests", n)
+	}
+
+	sent := len(car.Commands())
+	if code, _ := postCommand(t, p, "guest_mode", enable); code != http.StatusForbidden {
+		t.Errorf("Expected 403 after the refreshed role, got %d", code)
+	}
+	if len(car.Commands()) != sent {
+		t.Errorf("Vehicle was contacted for a command the refreshed role can't authorize")
+	}
+}
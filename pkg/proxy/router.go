@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+)
+
+const (
+	// DefaultMaxURLLength is the default limit on the length of a request's path and query string.
+	DefaultMaxURLLength = 2048
+	// DefaultMaxHeaderBytes is the default limit on the total size of a request's headers.
+	DefaultMaxHeaderBytes = 16 << 10
+)
+
+// routeKind identifies the handler for a request path.
+type routeKind int
+
+const (
+	routeForward routeKind = iota
+	routeHealth
+	routeMetrics
+	routeCommandCatalog
+	routeVehicleCommand
+	routeFleetTelemetryConfig
+	routeCommandProtocol
+	routeCommandSchema
+	routeVehicleAwake
+	routeResetSession
+	routeAdminStats
+	routeAdminDrain
+	routeBulkChargeLimit
+	routeAdminConfig
+	routeUI
+	routeVersion
+	routeAdminClockCheck
+	routeLastCommand
+	routeVehicleAlerts
+	routeCommandSequence
+)
+
+var (
+	methodsGet     = []string{http.MethodGet}
+	methodsPost    = []string{http.MethodPost}
+	methodsGetPost = []string{http.MethodGet, http.MethodPost}
+	methodsDrain   = []string{http.MethodGet, http.MethodPost, http.MethodDelete}
+	// Requests that the proxy doesn't handle itself are forwarded to Tesla's servers with any
+	// method, since Fleet API decides which methods its endpoints accept.
+	methodsForward []string
+)
+
+// route is the result of matching a request path against the endpoints the proxy serves.
+type route struct {
+	kind    routeKind
+	methods []string // Accepted HTTP methods, or nil for any method
+
+	// Set for routeVehicleCommand, routeCommandProtocol, routeVehicleAwake, routeVehicleAlerts,
+	// routeCommandSequence, routeResetSession and routeLastCommand, and for routeForward if the
+	// path names a vehicle. routeCommandSchema sets command.
+	vin     string
+	command string
+}
+
+// admin returns true if the route requires Proxy.AdminToken instead of an OAuth token.
+func (r *route) admin() bool {
+	return r.kind == routeResetSession || r.kind == routeAdminStats || r.kind == routeAdminDrain || r.kind == routeAdminConfig ||
+		r.kind == routeAdminClockCheck || r.kind == routeLastCommand
+}
+
+// public returns true if the route is served without an OAuth token.
+func (r *route) public() bool {
+	return r.kind == routeHealth || r.kind == routeVersion || r.kind == routeMetrics || r.kind == routeCommandCatalog || r.kind == routeCommandSchema || r.kind == routeUI
+}
+
+// routeRequest returns the route for req's path. A trailing slash is ignored, so that, for example,
+// /health/ is the health check, and is removed from req's path so that handlers and commands
+// forwarded to Fleet API see the path without it. Paths that are only forwarded keep the slash.
+func routeRequest(req *http.Request) route {
+	rt := matchRoute(req.URL.Path)
+	if rt.kind != routeForward {
+		return rt
+	}
+	path, ok := strings.CutSuffix(req.URL.Path, "/")
+	if !ok || path == "" {
+		return rt
+	}
+	if trimmed := matchRoute(path); trimmed.kind != routeForward {
+		req.URL.Path = path
+		req.URL.RawPath = strings.TrimSuffix(req.URL.RawPath, "/")
+		return trimmed
+	}
+	return rt
+}
+
+// matchRoute returns the route for path. Every path matches some route; paths that the proxy
+// doesn't handle itself are forwarded.
+func matchRoute(path string) route {
+	switch path {
+	case "/health":
+		return route{kind: routeHealth, methods: methodsGet}
+	case versionPath:
+		return route{kind: routeVersion, methods: methodsGet}
+	case metricsPath:
+		return route{kind: routeMetrics, methods: methodsGet}
+	case commandsPath:
+		return route{kind: routeCommandCatalog, methods: methodsGet}
+	case adminStatsPath:
+		return route{kind: routeAdminStats, methods: methodsGet}
+	case adminDrainPath:
+		return route{kind: routeAdminDrain, methods: methodsDrain}
+	case adminConfigPath:
+		return route{kind: routeAdminConfig, methods: methodsGet}
+	case adminClockCheckPath:
+		return route{kind: routeAdminClockCheck, methods: methodsGet}
+	case bulkChargeLimitPath:
+		return route{kind: routeBulkChargeLimit, methods: methodsPost}
+	case uiPath:
+		return route{kind: routeUI, methods: methodsGet}
+	}
+	if strings.HasPrefix(path, uiPath+"/") {
+		return route{kind: routeUI, methods: methodsGet}
+	}
+	if strings.HasPrefix(path, commandsPath+"/") {
+		parts := strings.Split(strings.TrimPrefix(path, commandsPath+"/"), "/")
+		if len(parts) == 2 && parts[1] == "schema" {
+			return route{kind: routeCommandSchema, methods: methodsGet, command: parts[0]}
+		}
+	}
+	if strings.HasPrefix(path, adminVehiclesPath) {
+		parts := strings.Split(strings.TrimPrefix(path, adminVehiclesPath), "/")
+		if len(parts) == 2 && parts[1] == "reset_session" {
+			return route{kind: routeResetSession, methods: methodsPost, vin: parts[0]}
+		}
+	}
+	if strings.HasPrefix(path, lastCommandPath) {
+		parts := strings.Split(strings.TrimPrefix(path, lastCommandPath), "/")
+		if len(parts) == 2 && parts[1] == lastCommandSuffix {
+			return route{kind: routeLastCommand, methods: methodsGet, vin: parts[0]}
+		}
+	}
+	if strings.HasPrefix(path, "/api/1/vehicles/") {
+		parts := strings.Split(path, "/")
+		if len(parts) == 7 && parts[5] == "command" && parts[6] != "" {
+			return route{kind: routeVehicleCommand, methods: commandMethods(parts[6]), vin: parts[4], command: parts[6]}
+		}
+		if len(parts) == 6 && parts[5] == "command_protocol" {
+			return route{kind: routeCommandProtocol, methods: methodsGet, vin: parts[4]}
+		}
+		if len(parts) == 6 && parts[5] == "awake" {
+			return route{kind: routeVehicleAwake, methods: methodsGet, vin: parts[4]}
+		}
+		if len(parts) == 6 && parts[5] == "alerts" {
+			return route{kind: routeVehicleAlerts, methods: methodsGet, vin: parts[4]}
+		}
+		if len(parts) == 6 && parts[5] == commandSequenceSuffix {
+			return route{kind: routeCommandSequence, methods: methodsPost, vin: parts[4]}
+		}
+		if len(parts) == 5 && parts[4] == "fleet_telemetry_config" {
+			return route{kind: routeFleetTelemetryConfig, methods: methodsPost}
+		}
+		// Forwarded requests about one vehicle, such as vehicle_data, are subject to the VIN
+		// allowlist like the proxy's own endpoints.
+		if len(parts[4]) == vinLength || account.IsVehicleID(parts[4]) {
+			return route{kind: routeForward, methods: methodsForward, vin: parts[4]}
+		}
+	}
+	return route{kind: routeForward, methods: methodsForward}
+}
+
+// commandMethods returns the HTTP methods accepted by a vehicle command route.
+func commandMethods(command string) []string {
+	if SupportsQueryParameters(command) {
+		return methodsGetPost
+	}
+	return methodsPost
+}
+
+// allowMethod returns true if the route accepts req's method, or accepts any method. Otherwise, it
+// writes a 405 response with an Allow header listing the methods the route accepts.
+func (r *route) allowMethod(w http.ResponseWriter, req *http.Request) bool {
+	if r.methods == nil || slices.Contains(r.methods, req.Method) {
+		return true
+	}
+	w.Header().Set("Allow", strings.Join(r.methods, ", "))
+	writeJSONError(w, http.StatusMethodNotAllowed, nil)
+	return false
+}
+
+// checkRequestSize returns an HTTP status code and error if req's URL or headers exceed the
+// proxy's limits. These checks run before authentication so that oversized requests are
+// discarded cheaply.
+func (p *Proxy) checkRequestSize(req *http.Request) (int, error) {
+	if p.MaxURLLength > 0 && len(req.URL.RequestURI()) > p.MaxURLLength {
+		return http.StatusRequestURITooLong, fmt.Errorf("request URL exceeds %d bytes", p.MaxURLLength)
+	}
+	if p.MaxHeaderBytes > 0 {
+		size := 0
+		for name, values := range req.Header {
+			for _, value := range values {
+				size += len(name) + len(value) + len(": \r\n")
+			}
+		}
+		if size > p.MaxHeaderBytes {
+			return http.StatusRequestHeaderFieldsTooLarge, fmt.Errorf("request headers exceed %d bytes", p.MaxHeaderBytes)
+		}
+	}
+	return 0, nil
+}
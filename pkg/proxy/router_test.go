@@ -0,0 +1,216 @@
+package proxy_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+	"github.com/teslamotors/vehicle-command/pkg/version"
+)
+
+func TestMethodNotAllowed(t *testing.T) {
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	p.AdminToken = []byte("admin-token")
+	commandPath := "/api/1/vehicles/" + testVIN + "/command/"
+	// Every route the proxy serves.
+	tests := []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodPost, "/health", "GET"},
+		{http.MethodPost, "/version", "GET"},
+		{http.MethodPut, "/metrics", "GET"},
+		{http.MethodDelete, "/api/1/commands", "GET"},
+		{http.MethodPost, "/api/1/commands/door_lock/schema", "GET"},
+		{http.MethodPost, "/ui", "GET"},
+		{http.MethodGet, commandPath + "door_unlock", "POST"},
+		{http.MethodPut, commandPath + "door_unlock", "POST"},
+		{http.MethodDelete, commandPath + "set_charge_limit", "GET, POST"},
+		{http.MethodGet, "/api/1/vehicles/fleet_telemetry_config", "POST"},
+		{http.MethodGet, "/api/1/bulk/set_charge_limit", "POST"},
+		{http.MethodPost, "/api/1/vehicles/" + testVIN + "/command_protocol", "GET"},
+		{http.MethodPost, "/api/1/vehicles/" + testVIN + "/awake", "GET"},
+		{http.MethodDelete, "/api/1/vehicles/" + testVIN + "/alerts", "GET"},
+		{http.MethodGet, "/api/1/vehicles/" + testVIN + "/command_sequence", "POST"},
+		{http.MethodPost, "/admin/stats", "GET"},
+		{http.MethodPut, "/admin/drain", "GET, POST, DELETE"},
+		{http.MethodPost, "/admin/config", "GET"},
+		{http.MethodPost, "/admin/clock-check", "GET"},
+		{http.MethodGet, "/admin/vehicles/" + testVIN + "/reset_session", "POST"},
+		{http.MethodPost, "/vehicles/" + testVIN + "/last-command", "GET"},
+	}
+	for _, test := range tests {
+		// A trailing slash matches the same route.
+		for _, path := range []string{test.path, test.path + "/"} {
+			req := httptest.NewRequest(test.method, path, nil)
+			if strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/vehicles/") {
+				req.Header.Set("Authorization", "Bearer admin-token")
+			} else {
+				req.Header.Set("Authorization", "Bearer "+testToken)
+			}
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, req)
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("%s %s: expected 405, got %d", test.method, path, w.Code)
+			}
+			if allow := w.Header().Get("Allow"); allow != test.allow {
+				t.Errorf("%s %s: expected Allow %q, got %q", test.method, path, test.allow, allow)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("%s %s: expected JSON error, got %q", test.method, path, ct)
+			}
+		}
+	}
+
+	// Public endpoints don't set Allow on success.
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Allow") != "" {
+		t.Errorf("Unexpected health check response: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestForwardedMethods(t *testing.T) {
+	methods := make(map[string]string)
+	host := fakeFleetAPI(t, func(w http.ResponseWriter, req *http.Request) {
+		methods[req.URL.Path] = req.Method
+	})
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	p.FleetAPIHost = host
+	// Fleet API decides which methods its endpoints accept.
+	tests := map[string]string{
+		"/api/1/vehicles": http.MethodPut,
+		"/api/1/vehicles/" + testVIN + "/vehicle_data":    http.MethodPatch,
+		"/api/1/vehicles/" + testVIN + "/fleet_telemetry": http.MethodDelete,
+		"/api/1/users/me": http.MethodOptions,
+	}
+	for path, method := range tests {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || methods[path] != method {
+			t.Errorf("%s %s: expected request to be forwarded, got %d (forwarded as %q)", method, path, w.Code, methods[path])
+		}
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	for _, path := range []string{"/health/", "/api/1/commands/", "/api/1/commands/door_lock/schema/"} {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s: expected 200, got %d", path, w.Code)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/door_unlock/", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || car.Locked() {
+		t.Errorf("Command with trailing slash failed with status %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	aliases, err := proxy.ParseCommandAliases([]byte(`{"aliases": {"climate_on": "auto_conditioning_start"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, dialed := newDialRecordingProxy(t, proxy.WithCommandAliases(aliases))
+	commandPath := "/api/1/vehicles/" + testVIN + "/command/"
+	tests := []struct {
+		method string
+		path   string
+		err    string
+	}{
+		// Unknown commands are 404 Not Found for any method.
+		{http.MethodPost, commandPath + "door_lok", "unknown command door_lok; did you mean door_lock?"},
+		{http.MethodGet, commandPath + "door_lok", "unknown command door_lok; did you mean door_lock?"},
+		{http.MethodPost, commandPath + "climate_onn", "unknown command climate_onn; did you mean climate_on?"},
+		{http.MethodPost, commandPath + "not_a_command", "unknown command not_a_command"},
+		{http.MethodGet, "/api/1/commands/set_charge_limt/schema", "unknown command set_charge_limt; did you mean set_charge_limit?"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		var reply struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+			t.Fatalf("%s %s: invalid response %q", test.method, test.path, w.Body.String())
+		}
+		if w.Code != http.StatusNotFound || reply.Error != test.err {
+			t.Errorf("%s %s: expected 404 %q, got %d %q", test.method, test.path, test.err, w.Code, reply.Error)
+		}
+	}
+	if len(*dialed) != 0 {
+		t.Errorf("Proxy connected to the vehicle for an unknown command")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	var reply struct {
+		Response version.Info `json:"response"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Response != version.Get() {
+		t.Errorf("Expected %+v, got %+v", version.Get(), reply.Response)
+	}
+}
+
+func TestRequestSizeLimits(t *testing.T) {
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	p.MaxURLLength = 64
+	p.MaxHeaderBytes = 256
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health?"+strings.Repeat("x", 64), nil))
+	if w.Code != http.StatusRequestURITooLong {
+		t.Errorf("Expected 414 for long URL, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Padding", strings.Repeat("x", 256))
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("Expected 431 for large headers, got %d", w.Code)
+	}
+
+	p.MaxURLLength = 0
+	p.MaxHeaderBytes = 0
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with limits disabled, got %d", w.Code)
+	}
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+)
+
+const (
+	// commandSequenceSuffix ends the path of a vehicle's command sequence endpoint,
+	// /api/1/vehicles/{VIN}/command_sequence.
+	commandSequenceSuffix = "command_sequence"
+	// maxSequenceSteps limits the number of commands in one sequence.
+	maxSequenceSteps = 20
+	// maxSequenceBodyBytes limits the size of a command sequence's body.
+	maxSequenceBodyBytes = 64 << 10
+)
+
+// CommandSequenceRequest is the body of POST /api/1/vehicles/{VIN}/command_sequence. The commands
+// are executed in order, each one starting after the previous one has finished. Unless
+// ContinueOnError is true, the sequence stops at the first command that fails.
+type CommandSequenceRequest struct {
+	Commands        []CommandSequenceStep `json:"commands"`
+	ContinueOnError bool                  `json:"continue_on_error,omitempty"`
+}
+
+// CommandSequenceStep is one command in a sequence. Parameters is the body that the equivalent
+// /api/1/vehicles/{VIN}/command/{Command} request would have.
+type CommandSequenceStep struct {
+	Command    string          `json:"command"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// CommandSequenceResult is the outcome of one command in a sequence. Status and Body are the
+// status code and body that the equivalent individual request would have received. Commands that
+// weren't executed because an earlier one failed are Skipped.
+type CommandSequenceResult struct {
+	Command string          `json:"command"`
+	Status  int             `json:"status,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+	Skipped bool            `json:"skipped,omitempty"`
+}
+
+// CommandSequenceResponse is the "response" object of a command sequence. Results has one entry
+// for each command in the request, in the same order.
+type CommandSequenceResponse struct {
+	Succeeded int                      `json:"succeeded"`
+	Failed    int                      `json:"failed"`
+	Skipped   int                      `json:"skipped"`
+	Results   []*CommandSequenceResult `json:"results"`
+}
+
+// validate returns an error if the sequence is empty, too long, or has a step without a valid
+// command name.
+func (r *CommandSequenceRequest) validate() error {
+	if len(r.Commands) == 0 {
+		return errors.New("no commands in request")
+	}
+	if len(r.Commands) > maxSequenceSteps {
+		return fmt.Errorf("request includes %d commands; the limit is %d", len(r.Commands), maxSequenceSteps)
+	}
+	for i, step := range r.Commands {
+		// Command names become part of the path of each command's request.
+		if !aliasPattern.MatchString(step.Command) {
+			return fmt.Errorf("command %d: invalid name %q", i, step.Command)
+		}
+	}
+	return nil
+}
+
+// handleCommandSequence executes a list of commands on one vehicle in order, over the sessions the
+// proxy keeps with each of the vehicle's domains, so that a client can, for example, unlock the
+// vehicle and then start climate control in one round trip. Each command goes through the same
+// checks, auditing, and error handling as an individual request, and its result is reported
+// separately. The response is 200 OK unless the request itself is malformed, even if some commands
+// fail.
+func (p *Proxy) handleCommandSequence(acct *account.Account, w http.ResponseWriter, req *http.Request, vin string) {
+	if len(vin) != vinLength {
+		writeJSONError(w, http.StatusNotFound, errors.New("expected 17-character VIN or numeric vehicle ID in path"))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxSequenceBodyBytes+1))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, errors.New("could not read request body"))
+		return
+	}
+	if len(body) > maxSequenceBodyBytes {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %d bytes", maxSequenceBodyBytes))
+		return
+	}
+	var sequence CommandSequenceRequest
+	if err := json.Unmarshal(body, &sequence); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	if err := sequence.validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	// A misspelled command fails the whole sequence, rather than the commands before it being
+	// executed.
+	commands := make([]string, len(sequence.Commands))
+	for i, step := range sequence.Commands {
+		commands[i] = step.Command
+		if p.aliases != nil && p.aliases.Aliases[step.Command] != "" {
+			commands[i] = p.aliases.Aliases[step.Command]
+		}
+		if _, ok := catalog.Lookup(commands[i]); !ok {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("command %d: %w", i, p.unknownCommandError(step.Command)))
+			return
+		}
+	}
+	id := requestID(req)
+	w.Header().Set(requestIDHeader, id)
+	log.Info("Executing sequence of %d commands", len(sequence.Commands))
+
+	reply := CommandSequenceResponse{Results: make([]*CommandSequenceResult, len(sequence.Commands))}
+	for i, step := range sequence.Commands {
+		command := commands[i]
+		result := &CommandSequenceResult{Command: command}
+		reply.Results[i] = result
+		if reply.Failed > 0 && !sequence.ContinueOnError {
+			result.Skipped = true
+			reply.Skipped++
+			continue
+		}
+		result.Status, result.Body = p.executeSubCommand(acct, req, vin, command, step.Parameters, id+"-"+strconv.Itoa(i))
+		if subCommandSucceeded(result.Status, result.Body) {
+			reply.Succeeded++
+		} else {
+			reply.Failed++
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(&Response{Response: &reply})
+}
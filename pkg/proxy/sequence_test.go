@@ -0,0 +1,109 @@
+package proxy_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func postSequence(t *testing.T, p *proxy.Proxy, body string) (int, *proxy.CommandSequenceResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command_sequence", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	var reply struct {
+		Response *proxy.CommandSequenceResponse `json:"response"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+		t.Fatalf("Invalid response %q: %s", w.Body.String(), err)
+	}
+	return w.Code, reply.Response
+}
+
+func TestCommandSequence(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	code, reply := postSequence(t, p, `{"commands": [
+		{"command": "door_unlock"},
+		{"command": "set_charge_limit", "parameters": {"percent": 70}},
+		{"command": "door_lock"}]}`)
+	if code != http.StatusOK || reply.Succeeded != 3 || reply.Failed != 0 || len(reply.Results) != 3 {
+		t.Fatalf("Unexpected response %d: %+v", code, reply)
+	}
+	for i, command := range []string{"door_unlock", "set_charge_limit", "door_lock"} {
+		if result := reply.Results[i]; result.Command != command || result.Status != http.StatusOK {
+			t.Errorf("Step %d: unexpected result %+v", i, result)
+		}
+	}
+	// The commands alternate between domains, and each one finishes before the next starts.
+	var domains []universal.Domain
+	for _, command := range car.Commands() {
+		domains = append(domains, command.Domain)
+	}
+	expected := []universal.Domain{
+		universal.Domain_DOMAIN_VEHICLE_SECURITY,
+		universal.Domain_DOMAIN_INFOTAINMENT,
+		universal.Domain_DOMAIN_VEHICLE_SECURITY,
+	}
+	if len(domains) != len(expected) {
+		t.Fatalf("Expected commands to domains %v, got %v", expected, domains)
+	}
+	for i := range expected {
+		if domains[i] != expected[i] {
+			t.Fatalf("Expected commands to domains %v, got %v", expected, domains)
+		}
+	}
+	if !car.Locked() || car.ChargeLimit() != 70 {
+		t.Errorf("Vehicle didn't execute the sequence")
+	}
+
+	// By default, the sequence stops at the first failure.
+	const failing = `{"command": "speed_limit_activate", "parameters": {"pin": "1234"}}`
+	code, reply = postSequence(t, p, `{"commands": [{"command": "door_unlock"}, `+failing+`, {"command": "door_lock"}]}`)
+	if code != http.StatusOK || reply.Succeeded != 1 || reply.Failed != 1 || reply.Skipped != 1 {
+		t.Fatalf("Unexpected response %d: %+v", code, reply)
+	}
+	if reply.Results[1].Status != http.StatusForbidden || !reply.Results[2].Skipped || reply.Results[2].Status != 0 {
+		t.Errorf("Unexpected results %+v, %+v", reply.Results[1], reply.Results[2])
+	}
+	if car.Locked() {
+		t.Errorf("Command after failure was executed")
+	}
+
+	code, reply = postSequence(t, p, `{"continue_on_error": true, "commands": [`+failing+`, {"command": "door_lock"}]}`)
+	if code != http.StatusOK || reply.Succeeded != 1 || reply.Failed != 1 || reply.Skipped != 0 || !car.Locked() {
+		t.Errorf("Unexpected response with continue_on_error %d: %+v", code, reply)
+	}
+
+	// A command that the vehicle refuses stops the sequence, even though its status is 200 OK.
+	car.RejectCommands("not_allowed")
+	code, reply = postSequence(t, p, `{"commands": [{"command": "set_charge_limit", "parameters": {"percent": 60}}, {"command": "door_unlock"}]}`)
+	car.RejectCommands("")
+	if code != http.StatusOK || reply.Succeeded != 0 || reply.Failed != 1 || reply.Skipped != 1 {
+		t.Fatalf("Expected refused command to stop the sequence, got %d: %+v", code, reply)
+	}
+	if reply.Results[0].Status != http.StatusOK || !car.Locked() {
+		t.Errorf("Unexpected results %+v, %+v", reply.Results[0], reply.Results[1])
+	}
+
+	for _, body := range []string{
+		`{}`,
+		`{"commands": [{"command": ""}]}`,
+		`{"commands": [{"command": "door_unlock"}, {"command": "door_lok"}]}`,
+		`{"commands": [{"command": "door_lock/../../vehicle_data"}]}`,
+		`{"commands": [` + strings.Repeat(`{"command": "door_lock"}, `, 20) + `{"command": "door_lock"}]}`,
+		`not json`,
+	} {
+		if code, _ := postSequence(t, p, body); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, code)
+		}
+	}
+	if !car.Locked() {
+		t.Errorf("Invalid sequence was partly executed")
+	}
+}
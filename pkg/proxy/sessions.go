@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"io"
+
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+)
+
+// ExportSessions writes the proxy's vehicle sessions to w, in the format of
+// [cache.SessionCache.Export], so that another proxy can continue them with ImportSessions
+// instead of repeating the handshake with each vehicle. Commands in progress save their sessions
+// when they finish, so the export has the state of each vehicle's previous command.
+func (p *Proxy) ExportSessions(w io.Writer) error {
+	return p.sessions.Export(w)
+}
+
+// ImportSessions adds the sessions exported by another proxy's ExportSessions, replacing this
+// proxy's sessions for the same vehicles, and returns the number of vehicles imported. The
+// session cache's CounterMargin is applied when the sessions are used, so commands the exporting
+// proxy sends after the export don't cause anti-replay counters to be reused.
+func (p *Proxy) ImportSessions(r io.Reader) (int, error) {
+	imported, err := cache.Import(r)
+	if err != nil {
+		return 0, err
+	}
+	for vin, entries := range imported.Vehicles {
+		if err := p.sessions.Update(vin, entries); err != nil {
+			return 0, err
+		}
+	}
+	return len(imported.Vehicles), nil
+}
@@ -0,0 +1,68 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func TestExportSessions(t *testing.T) {
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	car := vehicletest.New(testVIN)
+	car.Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+	dial := func(context.Context, *account.Account, string) (connector.Connector, error) {
+		return car.Connect(), nil
+	}
+	newProxy := func() *proxy.Proxy {
+		p, err := proxy.New(context.Background(), skey, 1, proxy.WithDialer(dial))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	old := newProxy()
+	if code, _ := postCommand(t, old, "door_lock", nil); code != http.StatusOK {
+		t.Fatalf("Command failed with status %d", code)
+	}
+	handshakes := car.Handshakes()
+	var snapshot bytes.Buffer
+	if err := old.ExportSessions(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(snapshot.String(), testVIN) {
+		t.Fatalf("Snapshot doesn't include %s: %s", testVIN, snapshot.String())
+	}
+
+	// The new proxy continues the old proxy's sessions, even while the old one keeps using them.
+	p := newProxy()
+	if n, err := p.ImportSessions(&snapshot); err != nil || n != 1 {
+		t.Fatalf("Expected to import 1 vehicle, got %d: %v", n, err)
+	}
+	if code, _ := postCommand(t, old, "door_unlock", nil); code != http.StatusOK {
+		t.Errorf("Old proxy's command failed with status %d", code)
+	}
+	if code, _ := postCommand(t, p, "door_lock", nil); code != http.StatusOK {
+		t.Errorf("New proxy's command failed with status %d", code)
+	}
+	if car.Handshakes() != handshakes || car.Desyncs() != 0 {
+		t.Errorf("Imported sessions weren't used: %d new handshakes, %d desyncs", car.Handshakes()-handshakes, car.Desyncs())
+	}
+
+	if _, err := p.ImportSessions(strings.NewReader("not json")); err == nil {
+		t.Error("Expected error importing invalid snapshot")
+	}
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+
+	"github.com/teslamotors/vehicle-command/pkg/version"
+)
+
+// StartupInfo describes a proxy that has started listening, for supervisors and orchestration
+// tools that check its configuration from its startup output. It's written as one JSON line.
+type StartupInfo struct {
+	// Event is always "startup", so that the line can be told apart from other JSON output.
+	Event   string `json:"event"`
+	Program string `json:"program"`
+	Version string `json:"version"`
+	// ListenAddress is the address the listener is bound to, which includes the port chosen by
+	// the system if the configured port was 0.
+	ListenAddress string `json:"listen_address"`
+	// Transport is "https" or "http", the scheme clients use to reach the listener.
+	Transport string `json:"transport"`
+	TLS       bool   `json:"tls"`
+	// CacheSize is the number of vehicles whose sessions the proxy keeps.
+	CacheSize int `json:"cache_size"`
+	// AdminAuth is true if the /admin/ endpoints are enabled for clients with the admin token.
+	AdminAuth bool `json:"admin_auth"`
+	// MetricsAuth is true if /metrics is enabled for clients with the metrics token.
+	MetricsAuth bool   `json:"metrics_auth"`
+	BasePath    string `json:"base_path,omitempty"`
+}
+
+// StartupInfo returns a description of p serving on addr, over TLS if useTLS is true.
+func (p *Proxy) StartupInfo(addr net.Addr, useTLS bool) *StartupInfo {
+	info := &StartupInfo{
+		Event:         "startup",
+		Program:       version.Program(),
+		Version:       version.Get().Version,
+		ListenAddress: addr.String(),
+		Transport:     "http",
+		TLS:           useTLS,
+		CacheSize:     p.cacheSize,
+		AdminAuth:     len(p.AdminToken) > 0,
+		MetricsAuth:   len(p.MetricsToken) > 0,
+		BasePath:      p.basePath(),
+	}
+	if useTLS {
+		info.Transport = "https"
+	}
+	return info
+}
+
+// Write writes s to w as one line of JSON.
+func (s *StartupInfo) Write(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,55 @@
+package proxy_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/version"
+)
+
+func TestStartupInfo(t *testing.T) {
+	p, _ := newTestProxy(t, true)
+	addr := &net.TCPAddr{IP: net.IPv6loopback, Port: 4443}
+
+	var out bytes.Buffer
+	if err := p.StartupInfo(addr, true).Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	line, rest, _ := bytes.Cut(out.Bytes(), []byte("\n"))
+	if len(rest) > 0 {
+		t.Errorf("Expected one line, got %q", out.String())
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		t.Fatalf("Invalid JSON %q: %s", line, err)
+	}
+	expected := map[string]interface{}{
+		"event":          "startup",
+		"program":        version.Program(),
+		"version":        version.Get().Version,
+		"listen_address": "[::1]:4443",
+		"transport":      "https",
+		"tls":            true,
+		"cache_size":     float64(1),
+		"admin_auth":     false,
+		"metrics_auth":   false,
+	}
+	if len(fields) != len(expected) {
+		t.Errorf("Expected fields %v, got %v", expected, fields)
+	}
+	for name, value := range expected {
+		if fields[name] != value {
+			t.Errorf("Expected %s %v, got %v", name, value, fields[name])
+		}
+	}
+
+	p.AdminToken = []byte("admin-token")
+	p.MetricsToken = []byte(testMetricsToken)
+	p.BasePath = "/tesla/"
+	info := p.StartupInfo(addr, false)
+	if info.Transport != "http" || info.TLS || !info.AdminAuth || !info.MetricsAuth || info.BasePath != "/tesla" {
+		t.Errorf("Unexpected startup info for HTTP proxy with admin endpoints: %+v", info)
+	}
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+)
+
+const (
+	// vehicleStatusTTL is how long the proxy trusts a vehicle's in-service and offline status
+	// before reading it again. It's short so that commands resume soon after the vehicle does.
+	vehicleStatusTTL = 30 * time.Second
+	// vehicleStatusTimeout limits the time spent reading a vehicle's status before a command. If
+	// it expires, the command is attempted anyway.
+	vehicleStatusTimeout = 5 * time.Second
+)
+
+// forceAttemptHeader makes the proxy send a command to a vehicle that Fleet API reports as in
+// service or offline. It exists for debugging; such commands are expected to fail.
+const forceAttemptHeader = "X-Tesla-Force-Attempt"
+
+// VehicleStatusResolver returns a vehicle's connectivity as reported by Fleet API.
+type VehicleStatusResolver func(ctx context.Context, acct *account.Account, vin string) (*account.VehicleStatus, error)
+
+// WithVehicleStatusResolver replaces the lookup the proxy uses to reject commands to vehicles that
+// are in service mode or offline. By default, the proxy uses [account.Account.VehicleStatus] if it
+// sends commands through Fleet API, and skips the check if it was created WithDialer.
+func WithVehicleStatusResolver(resolve VehicleStatusResolver) Option {
+	return func(p *Proxy) {
+		p.resolveVehicleStatus = resolve
+	}
+}
+
+// cachedVehicleStatus is an entry in Proxy.vehicleStatusCache.
+type cachedVehicleStatus struct {
+	status  *account.VehicleStatus
+	fetched time.Time
+}
+
+// vehicleStatus returns vin's status, or nil if it can't be determined.
+func (p *Proxy) vehicleStatus(acct *account.Account, vin string) *account.VehicleStatus {
+	if cached, ok := p.vehicleStatusCache.Load(vin); ok {
+		if entry := cached.(cachedVehicleStatus); clock.Since(p.clock, entry.fetched) < vehicleStatusTTL {
+			return entry.status
+		}
+	}
+	resolve := p.resolveVehicleStatus
+	if resolve == nil {
+		if p.dial != nil {
+			return nil
+		}
+		resolve = func(ctx context.Context, acct *account.Account, vin string) (*account.VehicleStatus, error) {
+			return acct.VehicleStatus(ctx, vin)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), vehicleStatusTimeout)
+	defer cancel()
+	status, err := resolve(ctx, acct, vin)
+	if err != nil {
+		log.Warning("[%s] Couldn't read vehicle status: %s", vin, err)
+		return nil
+	}
+	p.vehicleStatusCache.Store(vin, cachedVehicleStatus{status: status, fetched: p.clock.Now()})
+	return status
+}
+
+// checkVehicleAvailable fails fast, rather than waiting for a command to time out, if Fleet API
+// reports that vin is in service mode (409 Conflict) or offline (503 Service Unavailable). It
+// writes an error response and returns a non-nil error if the command shouldn't be sent.
+func (p *Proxy) checkVehicleAvailable(acct *account.Account, w http.ResponseWriter, req *http.Request, vin string) error {
+	if value := req.Header.Get(forceAttemptHeader); value != "" {
+		force, err := strconv.ParseBool(value)
+		if err != nil {
+			err = fmt.Errorf("invalid %s header %q: expected true or false", forceAttemptHeader, value)
+			writeJSONError(w, http.StatusBadRequest, err)
+			return err
+		}
+		if force {
+			return nil
+		}
+	}
+	status := p.vehicleStatus(acct, vin)
+	if status == nil {
+		return nil
+	}
+	err := status.Err()
+	var code int
+	var description string
+	switch {
+	case errors.Is(err, account.ErrVehicleInService):
+		code = http.StatusConflict
+		description = "The vehicle won't accept commands until service is complete."
+	case errors.Is(err, account.ErrVehicleOffline):
+		code = http.StatusServiceUnavailable
+		description = "Tesla's servers can't reach the vehicle. Commands, including wake_up, will fail until it reconnects."
+		w.Header().Set("Retry-After", strconv.Itoa(int(vehicleStatusTTL/time.Second)))
+	default:
+		return nil
+	}
+	log.Info("[%s] Rejecting command: %s", vin, err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&Response{
+		Error:      err.Error(),
+		ErrDetails: fmt.Sprintf("%s Send %s: true to attempt it anyway.", description, forceAttemptHeader),
+	})
+	return err
+}
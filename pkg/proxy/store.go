@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+)
+
+var errSessionStoreUnavailable = errors.New("session store unavailable")
+
+// SessionStore persists vehicle sessions outside of the proxy process, for example in Redis, so
+// that they survive restarts and can be shared by several proxy instances. The proxy treats the
+// stored data as opaque.
+type SessionStore interface {
+	// Load returns the data most recently saved for vin, or nil if there is none.
+	Load(ctx context.Context, vin string) ([]byte, error)
+	// Save replaces the data stored for vin.
+	Save(ctx context.Context, vin string, data []byte) error
+}
+
+// loadStoredSessions copies vin's sessions from p.SessionStore into the in-process session cache.
+// If the store fails, the proxy continues with the sessions it already has unless
+// p.SessionStoreFailClosed is set.
+func (p *Proxy) loadStoredSessions(ctx context.Context, vin string) error {
+	if p.SessionStore == nil {
+		return nil
+	}
+	data, err := p.SessionStore.Load(ctx, vin)
+	if err == nil && data != nil {
+		var stored *cache.SessionCache
+		if stored, err = cache.Import(bytes.NewReader(data)); err == nil {
+			if entries, ok := stored.GetEntry(vin); ok {
+				err = p.sessions.Update(vin, entries)
+			}
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	p.metrics.sessionStoreErrors.Add(1)
+	if p.SessionStoreFailClosed {
+		log.Error("Couldn't load sessions for %s: %s", vin, err)
+		return errSessionStoreUnavailable
+	}
+	log.Warning("Couldn't load sessions for %s, using in-process sessions: %s", vin, err)
+	return nil
+}
+
+// saveStoredSessions writes vin's sessions from the in-process session cache to p.SessionStore.
+// By the time sessions are saved the command has already been sent, so failures are logged but
+// not reported to the client, regardless of p.SessionStoreFailClosed.
+func (p *Proxy) saveStoredSessions(ctx context.Context, vin string) {
+	if p.SessionStore == nil {
+		return
+	}
+	entries, ok := p.sessions.GetEntry(vin)
+	if !ok {
+		return
+	}
+	single := cache.New(0)
+	var buffer bytes.Buffer
+	err := single.Update(vin, entries)
+	if err == nil {
+		err = single.Export(&buffer)
+	}
+	if err == nil {
+		err = p.SessionStore.Save(ctx, vin, buffer.Bytes())
+	}
+	if err != nil {
+		p.metrics.sessionStoreErrors.Add(1)
+		log.Warning("Couldn't save sessions for %s: %s", vin, err)
+	}
+}
@@ -0,0 +1,88 @@
+package proxy_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var errStoreDown = errors.New("connection refused")
+
+// testStore is an in-memory SessionStore that fails every operation while down is true.
+type testStore struct {
+	lock sync.Mutex
+	down bool
+	data map[string][]byte
+}
+
+func (s *testStore) Load(_ context.Context, vin string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.down {
+		return nil, errStoreDown
+	}
+	return s.data[vin], nil
+}
+
+func (s *testStore) Save(_ context.Context, vin string, data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.down {
+		return errStoreDown
+	}
+	s.data[vin] = data
+	return nil
+}
+
+func TestSessionStore(t *testing.T) {
+	p, _ := newTestProxy(t, true)
+	store := &testStore{data: make(map[string][]byte)}
+	p.SessionStore = store
+
+	if code, reply := postCommand(t, p, "door_lock", nil); code != http.StatusOK {
+		t.Fatalf("Unexpected status %d: %s", code, reply.Error)
+	}
+	if len(store.data[testVIN]) == 0 {
+		t.Fatalf("Sessions weren't saved")
+	}
+	// The next command uses the stored sessions.
+	if code, reply := postCommand(t, p, "door_unlock", nil); code != http.StatusOK {
+		t.Fatalf("Unexpected status %d with stored sessions: %s", code, reply.Error)
+	}
+}
+
+func TestSessionStoreFailOpen(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	p.SessionStore = &testStore{down: true}
+
+	if code, reply := postCommand(t, p, "door_unlock", nil); code != http.StatusOK {
+		t.Fatalf("Unexpected status %d: %s", code, reply.Error)
+	}
+	if car.Locked() {
+		t.Errorf("Command wasn't executed")
+	}
+
+	if metrics, expected := scrapeMetrics(t, p), "tesla_proxy_session_store_errors_total 2\n"; !strings.Contains(metrics, expected) {
+		t.Errorf("Expected metrics to contain %q, got:\n%s", expected, metrics)
+	}
+}
+
+func TestSessionStoreFailClosed(t *testing.T) {
+	p, car := newTestProxy(t, true)
+	p.SessionStore = &testStore{down: true}
+	p.SessionStoreFailClosed = true
+
+	code, reply := postCommand(t, p, "door_unlock", nil)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d", code)
+	}
+	if !strings.Contains(reply.Error, "session store unavailable") {
+		t.Errorf("Unexpected error %q", reply.Error)
+	}
+	if len(car.Commands()) != 0 {
+		t.Errorf("Command was sent to the vehicle")
+	}
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+)
+
+// maxSuggestionDistance is the largest number of edits that turn an unknown command's name into
+// a command the proxy suggests instead.
+const maxSuggestionDistance = 3
+
+// unknownCommandError returns the error for a request naming command, which isn't in the catalog.
+// If a command or alias has a similar name, the error suggests it.
+func (p *Proxy) unknownCommandError(command string) error {
+	if suggestion := p.suggestCommand(command); suggestion != "" {
+		return fmt.Errorf("unknown command %s; did you mean %s?", command, suggestion)
+	}
+	return fmt.Errorf("unknown command %s", command)
+}
+
+// suggestCommand returns the command or alias whose name is closest to command, or "" if none is
+// close enough. Short names only match names that differ by fewer edits. Ties are broken
+// alphabetically, so that the suggestion doesn't change between requests.
+func (p *Proxy) suggestCommand(command string) string {
+	limit := min(maxSuggestionDistance, len(command)/2)
+	best, bestDistance := "", limit+1
+	consider := func(name string) {
+		if name == "" {
+			return
+		}
+		d := editDistance(command, name)
+		if d < bestDistance || (d == bestDistance && name < best) {
+			best, bestDistance = name, d
+		}
+	}
+	for _, c := range catalog.Commands() {
+		consider(c.Name)
+	}
+	if p.aliases != nil {
+		for alias := range p.aliases.Aliases {
+			consider(alias)
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b, counting bytes, which is enough
+// for command names.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
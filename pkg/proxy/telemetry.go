@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/telemetry"
+)
+
+// telemetryShutdownTimeout limits how long shutting down the telemetry listener waits for records
+// from closed vehicle connections to be written.
+const telemetryShutdownTimeout = 10 * time.Second
+
+// TelemetryConfig describes an optional Fleet Telemetry listener. Vehicles connect to it directly,
+// so it runs on its own address, separate from the proxy's REST API.
+type TelemetryConfig struct {
+	Addr         string // Listen address, such as ":4443". Empty disables the listener.
+	CertFile     string // Server certificate chain presented to vehicles.
+	KeyFile      string // Server private key.
+	ClientCAFile string // CA certificates used to verify vehicle client certificates.
+	Filename     string // Append JSON-lines records to this file.
+	MaxBytes     int64  // Rotate Filename once it exceeds this size. Zero disables rotation.
+	MaxBackups   int    // Number of rotated files to keep.
+	WebhookURL   string // POST each record to this URL.
+}
+
+// Open returns a server that accepts Fleet Telemetry connections and writes decoded records to
+// the configured file or webhook. The caller should start it with ListenAndServeTLS("", ""). Open
+// returns nil (and no error) if the listener is not configured.
+func (c *TelemetryConfig) Open() (*http.Server, error) {
+	if c.Addr == "" {
+		return nil, nil
+	}
+	if c.CertFile == "" || c.KeyFile == "" || c.ClientCAFile == "" {
+		return nil, fmt.Errorf("telemetry listener requires a certificate, key, and vehicle CA file")
+	}
+	tlsConfig, err := telemetry.NewTLSConfig(c.CertFile, c.KeyFile, c.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var out io.Writer
+	switch {
+	case c.Filename != "" && c.WebhookURL != "":
+		return nil, fmt.Errorf("telemetry output file and webhook are mutually exclusive")
+	case c.Filename != "":
+		f, err := OpenRotatingFile(c.Filename, c.MaxBytes, c.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't open telemetry output: %w", err)
+		}
+		out = f
+	case c.WebhookURL != "":
+		out = &WebhookWriter{URL: c.WebhookURL}
+	default:
+		return nil, fmt.Errorf("telemetry listener requires an output file or webhook")
+	}
+
+	handler := telemetry.NewServer(telemetry.NewJSONSink(out))
+	server := &http.Server{
+		Addr:              c.Addr,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: telemetry.DefaultReadHeaderTimeout,
+	}
+	// Shutting down the server also closes the vehicles' WebSocket connections.
+	server.RegisterOnShutdown(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), telemetryShutdownTimeout)
+		defer cancel()
+		if err := handler.Shutdown(ctx); err != nil {
+			log.Warning("Telemetry connections didn't close: %s", err)
+		}
+	})
+	return server, nil
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+)
+
+// Headers that override Proxy.ConnectTimeout and Proxy.CommandTimeout for one request. Values are
+// durations such as "2s" or "500ms".
+const (
+	connectTimeoutHeader = "X-Tesla-Connect-Timeout"
+	commandTimeoutHeader = "X-Tesla-Command-Timeout"
+)
+
+var (
+	errConnectTimeout = errors.New("timed out connecting to vehicle")
+	errCommandTimeout = errors.New("vehicle didn't complete the command in time")
+)
+
+// phaseTimeouts returns the connect and command timeouts for req. Zero means that the phase may use
+// the rest of the request's Timeout.
+func (p *Proxy) phaseTimeouts(req *http.Request) (connect, command time.Duration, err error) {
+	if connect, err = timeoutHeader(req, connectTimeoutHeader, p.ConnectTimeout); err != nil {
+		return 0, 0, err
+	}
+	if command, err = timeoutHeader(req, commandTimeoutHeader, p.CommandTimeout); err != nil {
+		return 0, 0, err
+	}
+	return connect, command, nil
+}
+
+// timeoutHeader returns the duration in req's header, or fallback if the header is absent.
+func timeoutHeader(req *http.Request, header string, fallback time.Duration) (time.Duration, error) {
+	value := req.Header.Get(header)
+	if value == "" {
+		return fallback, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s header %q: expected a positive duration such as 5s", header, value)
+	}
+	return timeout, nil
+}
+
+// withPhaseTimeout returns a context for one phase of a command. The phase ends after timeout or at
+// ctx's deadline, whichever comes first. A zero timeout leaves ctx's deadline unchanged.
+func withPhaseTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// phaseExpired returns true if phaseCtx ran out of time before parent did, so that a failure can
+// be attributed to the phase's own timeout rather than the request's.
+func phaseExpired(phaseCtx, parent context.Context) bool {
+	return errors.Is(phaseCtx.Err(), context.DeadlineExceeded) && parent.Err() == nil
+}
+
+// writeConnectError reports a failure to reach the vehicle. Failures caused by the connect timeout
+// or Proxy.APICallTimeout are reported as 504 Gateway Timeout.
+func writeConnectError(connectCtx, ctx context.Context, w http.ResponseWriter, err error) {
+	if phaseExpired(connectCtx, ctx) {
+		writeJSONError(w, http.StatusGatewayTimeout, errConnectTimeout)
+		return
+	}
+	if errors.Is(err, inet.ErrAPICallTimeout) {
+		writeJSONError(w, http.StatusGatewayTimeout, err)
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, err)
+}
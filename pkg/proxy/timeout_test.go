@@ -0,0 +1,160 @@
+package proxy_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+// silentConnection drops messages sent to the vehicle while silent is set, as if it had become
+// unreachable.
+type silentConnection struct {
+	connector.Connector
+	silent *atomic.Bool
+}
+
+func (c *silentConnection) Send(ctx context.Context, buffer []byte) error {
+	if c.silent.Load() {
+		return nil
+	}
+	return c.Connector.Send(ctx, buffer)
+}
+
+// hungConnection fails messages sent to the vehicle while hung is set, as if requests to Fleet API
+// had run out of time after the request was sent.
+type hungConnection struct {
+	connector.Connector
+	hung *atomic.Bool
+}
+
+func (c *hungConnection) Send(ctx context.Context, buffer []byte) error {
+	if c.hung.Load() {
+		return &protocol.CommandError{Err: fmt.Errorf("%w after 1s", inet.ErrAPICallTimeout), PossibleSuccess: true, PossibleTemporary: true}
+	}
+	return c.Connector.Send(ctx, buffer)
+}
+
+// sendWithHeaders sends door_lock to p with the given headers and returns the status code and how
+// long the proxy took to respond.
+func sendWithHeaders(p *proxy.Proxy, headers map[string]string) (int, time.Duration) {
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/door_lock", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	start := time.Now()
+	p.ServeHTTP(w, req)
+	return w.Code, time.Since(start)
+}
+
+func TestConnectTimeout(t *testing.T) {
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The vehicle never answers the dialer, as when it's out of range.
+	dial := func(ctx context.Context, _ *account.Account, _ string) (connector.Connector, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	p, err := proxy.New(context.Background(), skey, 1, proxy.WithDialer(dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ConnectTimeout = 50 * time.Millisecond
+
+	if code, elapsed := sendWithHeaders(p, nil); code != http.StatusGatewayTimeout || elapsed > p.Timeout/2 {
+		t.Errorf("Expected 504 after ConnectTimeout, got %d after %s", code, elapsed)
+	}
+	// The header overrides ConnectTimeout.
+	p.ConnectTimeout = 0
+	if code, elapsed := sendWithHeaders(p, map[string]string{"X-Tesla-Connect-Timeout": "20ms"}); code != http.StatusGatewayTimeout || elapsed > p.Timeout/2 {
+		t.Errorf("Expected 504 after X-Tesla-Connect-Timeout, got %d after %s", code, elapsed)
+	}
+	for _, value := range []string{"soon", "0s", "-1s"} {
+		if code, _ := sendWithHeaders(p, map[string]string{"X-Tesla-Connect-Timeout": value}); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for X-Tesla-Connect-Timeout %q, got %d", value, code)
+		}
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	car := vehicletest.New(testVIN)
+	car.Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+	var silent atomic.Bool
+	dial := func(context.Context, *account.Account, string) (connector.Connector, error) {
+		return &silentConnection{Connector: car.Connect(), silent: &silent}, nil
+	}
+	p, err := proxy.New(context.Background(), skey, 1, proxy.WithDialer(dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ConnectTimeout = 100 * time.Millisecond
+	if code, _ := sendWithHeaders(p, nil); code != http.StatusOK {
+		t.Fatalf("Command failed with status %d", code)
+	}
+
+	// With an established session, the vehicle stops responding to commands. The connect timeout
+	// doesn't apply to the command, which fails once the command timeout expires.
+	silent.Store(true)
+	headers := map[string]string{"X-Tesla-Command-Timeout": "300ms"}
+	code, elapsed := sendWithHeaders(p, headers)
+	if code != http.StatusGatewayTimeout || elapsed < 300*time.Millisecond || elapsed > p.Timeout/2 {
+		t.Errorf("Expected 504 after X-Tesla-Command-Timeout, got %d after %s", code, elapsed)
+	}
+}
+
+func TestAPICallTimeout(t *testing.T) {
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	car := vehicletest.New(testVIN)
+	car.Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+	var hung atomic.Bool
+	var callTimeout time.Duration
+	dial := func(_ context.Context, acct *account.Account, _ string) (connector.Connector, error) {
+		callTimeout = acct.CallTimeout
+		return &hungConnection{Connector: car.Connect(), hung: &hung}, nil
+	}
+	p, err := proxy.New(context.Background(), skey, 1, proxy.WithDialer(dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.APICallTimeout = time.Second
+	if code, _ := sendWithHeaders(p, nil); code != http.StatusOK {
+		t.Fatalf("Command failed with status %d", code)
+	}
+	if callTimeout != p.APICallTimeout {
+		t.Errorf("Expected connections to Fleet API to time out after %s, got %s", p.APICallTimeout, callTimeout)
+	}
+
+	hung.Store(true)
+	req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/door_lock", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusGatewayTimeout || !strings.Contains(w.Body.String(), "request to Fleet API timed out") {
+		t.Errorf("Expected 504 naming the request that timed out, got %d: %s", w.Code, w.Body.String())
+	}
+}
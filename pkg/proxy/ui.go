@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiPath is where the command testing page is served if Proxy.EnableUI is set.
+const uiPath = "/ui"
+
+// uiContentSecurityPolicy confines the page to its embedded assets and the proxy's own API, so
+// that it never loads third-party code while the user's OAuth token is in memory.
+const uiContentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; " +
+	"connect-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+//go:embed ui
+var uiFiles embed.FS
+
+// uiAssets holds index.html and the files it references.
+var uiAssets = func() fs.FS {
+	assets, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return assets
+}()
+
+var uiFileServer = http.StripPrefix(uiPath, http.FileServer(http.FS(uiAssets)))
+
+// handleUI serves a page that lists the commands in the catalog, builds a form for each from its
+// JSON Schema, and sends it to a vehicle with an OAuth token that the user pastes in. The page
+// itself is public; commands sent from it are authenticated like any other. It returns 404 unless
+// p.EnableUI is set.
+func (p *Proxy) handleUI(w http.ResponseWriter, req *http.Request) {
+	if !p.EnableUI {
+		writeJSONError(w, http.StatusNotFound, nil)
+		return
+	}
+	if req.URL.Path == uiPath {
+		// Relative links in index.html resolve against the directory.
+		http.Redirect(w, req, p.basePath()+uiPath+"/", http.StatusMovedPermanently)
+		return
+	}
+	header := w.Header()
+	header.Set("Content-Security-Policy", uiContentSecurityPolicy)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Referrer-Policy", "no-referrer")
+	header.Set("Cache-Control", "no-cache")
+	uiFileServer.ServeHTTP(w, req)
+}
@@ -0,0 +1,194 @@
+// Command testing page for the Tesla HTTP proxy. It builds a form from each command's JSON Schema
+// and POSTs the result to the proxy. The OAuth token stays in this page's memory; it's never
+// stored or sent anywhere but the proxy.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+// The page is served at /ui/ under the proxy's base path, so API paths are relative to its parent.
+const apiRoot = "../api/1";
+
+let commands = [];
+let selected = null;
+
+function element(tag, properties, ...children) {
+  const node = document.createElement(tag);
+  Object.assign(node, properties);
+  node.append(...children);
+  return node;
+}
+
+async function fetchJSON(url) {
+  const response = await fetch(url);
+  if (!response.ok) {
+    throw new Error(`${url}: ${response.status} ${response.statusText}`);
+  }
+  return response.json();
+}
+
+function showError(message) {
+  $("result").hidden = false;
+  $("status").className = "error";
+  $("status").textContent = message;
+  $("response").textContent = "";
+}
+
+function renderCommands() {
+  const filter = $("filter").value.trim().toLowerCase();
+  const list = $("commands");
+  list.replaceChildren();
+  for (const command of commands) {
+    if (filter && !command.name.includes(filter) && !(command.help || "").toLowerCase().includes(filter)) {
+      continue;
+    }
+    const button = element("button", { type: "button", textContent: command.name, title: command.help || "" });
+    button.setAttribute("aria-current", String(command === selected));
+    button.addEventListener("click", () => selectCommand(command));
+    list.append(element("li", {}, button));
+  }
+}
+
+// input returns a form control for a property of a command's schema.
+function input(name, property, required) {
+  if (Array.isArray(property.enum)) {
+    const select = element("select", { id: `field-${name}`, name });
+    if (!required) {
+      select.append(element("option", { value: "", textContent: "" }));
+    }
+    for (const value of property.enum) {
+      select.append(element("option", { value: String(value), textContent: String(value) }));
+    }
+    return select;
+  }
+  switch (property.type) {
+    case "boolean": {
+      const select = element("select", { id: `field-${name}`, name });
+      if (!required) {
+        select.append(element("option", { value: "", textContent: "" }));
+      }
+      select.append(element("option", { value: "true", textContent: "true" }));
+      select.append(element("option", { value: "false", textContent: "false" }));
+      return select;
+    }
+    case "integer":
+    case "number": {
+      const field = element("input", { id: `field-${name}`, name, type: "number", required });
+      field.step = property.type === "integer" ? "1" : "any";
+      if (property.minimum !== undefined) {
+        field.min = property.minimum;
+      }
+      if (property.maximum !== undefined) {
+        field.max = property.maximum;
+      }
+      return field;
+    }
+    default:
+      return element("input", { id: `field-${name}`, name, type: "text", required, spellcheck: false });
+  }
+}
+
+async function selectCommand(command) {
+  selected = command;
+  renderCommands();
+  $("result").hidden = true;
+  let schema;
+  try {
+    schema = await fetchJSON(`${apiRoot}/commands/${encodeURIComponent(command.name)}/schema`);
+  } catch (err) {
+    showError(`Couldn't load schema: ${err.message}`);
+    return;
+  }
+  if (selected !== command) {
+    return;
+  }
+  const required = new Set(schema.required || []);
+  const fields = $("fields");
+  fields.replaceChildren();
+  for (const [name, property] of Object.entries(schema.properties || {})) {
+    const isRequired = required.has(name);
+    const label = element("label", { htmlFor: `field-${name}`, textContent: isRequired ? `${name} *` : name });
+    const field = element("div", { className: "field" }, label, input(name, property, isRequired));
+    if (property.description) {
+      field.append(element("small", { textContent: property.description }));
+    }
+    field.dataset.type = property.type || "string";
+    fields.append(field);
+  }
+  $("name").textContent = command.name;
+  $("help").textContent = command.help || "";
+  $("placeholder").hidden = true;
+  $("form").hidden = false;
+}
+
+// body returns the JSON body of the command, omitting optional fields that were left blank.
+function body() {
+  const params = {};
+  for (const field of $("fields").children) {
+    const control = field.querySelector("input, select");
+    if (control.value === "") {
+      continue;
+    }
+    switch (field.dataset.type) {
+      case "boolean":
+        params[control.name] = control.value === "true";
+        break;
+      case "integer":
+      case "number":
+        params[control.name] = Number(control.value);
+        break;
+      default:
+        params[control.name] = control.value;
+    }
+  }
+  return params;
+}
+
+async function send(event) {
+  event.preventDefault();
+  const vin = $("vin").value.trim();
+  const token = $("token").value.trim();
+  if (!vin || !token) {
+    showError("Enter an OAuth token and a VIN.");
+    return;
+  }
+  const url = `${apiRoot}/vehicles/${encodeURIComponent(vin)}/command/${encodeURIComponent(selected.name)}`;
+  const start = performance.now();
+  $("status").className = "";
+  $("status").textContent = "Sending…";
+  $("response").textContent = "";
+  $("result").hidden = false;
+  try {
+    const response = await fetch(url, {
+      method: "POST",
+      headers: { "Authorization": `Bearer ${token}`, "Content-Type": "application/json" },
+      body: JSON.stringify(body()),
+    });
+    const elapsed = Math.round(performance.now() - start);
+    const text = await response.text();
+    $("status").className = response.ok ? "" : "error";
+    $("status").textContent = `${response.status} ${response.statusText} (${elapsed} ms)`;
+    try {
+      $("response").textContent = JSON.stringify(JSON.parse(text), null, 2);
+    } catch {
+      $("response").textContent = text;
+    }
+  } catch (err) {
+    showError(`Request failed: ${err.message}`);
+  }
+}
+
+async function main() {
+  $("filter").addEventListener("input", renderCommands);
+  $("form").addEventListener("submit", send);
+  try {
+    const catalog = await fetchJSON(`${apiRoot}/commands`);
+    commands = (catalog.commands || []).filter((command) => command.handling !== "not_implemented");
+    commands.sort((a, b) => a.name.localeCompare(b.name));
+  } catch (err) {
+    showError(`Couldn't load the command catalog: ${err.message}`);
+    return;
+  }
+  renderCommands();
+}
+
+main();
@@ -0,0 +1,59 @@
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func TestUI(t *testing.T) {
+	p, err := proxy.New(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatalf("Couldn't create proxy: %s", err)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// The page is disabled by default, and isn't forwarded to Fleet API.
+	if w := get("/ui/"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 while disabled, got %d", w.Code)
+	}
+
+	p.EnableUI = true
+	if w := get("/ui"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/ui/" {
+		t.Errorf("Expected redirect to /ui/, got %d %v", w.Code, w.Header())
+	}
+	w := get("/ui/")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<script src="app.js"`) {
+		t.Fatalf("Unexpected response %d: %s", w.Code, w.Body.String())
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'self'") {
+		t.Errorf("Unexpected Content-Security-Policy %q", csp)
+	}
+	for path, contentType := range map[string]string{
+		"/ui/app.js":    "text/javascript",
+		"/ui/style.css": "text/css",
+	} {
+		w := get(path)
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), contentType) {
+			t.Errorf("GET %s: unexpected response %d %q", path, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+	if w := get("/ui/missing.js"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing asset, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/ui/", nil)
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", w.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var errVehicleNotAllowed = errors.New("vehicle is not on the proxy's VIN allowlist")
+
+// VINAllowlist limits the vehicles the proxy serves. Each entry is a VIN, or a VIN prefix followed
+// by "*" that matches a range of vehicles, such as a fleet's manufacturer and model codes
+// ("5YJ3E1EA*"). Entries are case-insensitive. An empty VINAllowlist allows every vehicle.
+//
+// The zero value is an empty VINAllowlist, to which entries can be added with Parse and LoadFile.
+type VINAllowlist struct {
+	vins     map[string]bool
+	prefixes []string
+}
+
+// WithVINAllowlist makes the proxy reject requests to vehicles that allowlist doesn't include with
+// 403 Forbidden, before connecting to the vehicle. Rejected requests are counted by the
+// tesla_proxy_vehicle_requests_denied_total metric.
+func WithVINAllowlist(allowlist *VINAllowlist) Option {
+	return func(p *Proxy) {
+		p.vinAllowlist = allowlist
+	}
+}
+
+// Parse adds the entries in s, which are separated by commas or whitespace. Text from "#" to the
+// end of a line is a comment.
+func (a *VINAllowlist) Parse(s string) error {
+	for _, line := range strings.Split(s, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		})
+		for _, field := range fields {
+			if err := a.add(field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadFile adds the entries in filename, in the format accepted by Parse. Files typically list one
+// entry per line.
+func (a *VINAllowlist) LoadFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := a.Parse(string(data)); err != nil {
+		return fmt.Errorf("invalid VIN allowlist file %s: %w", filename, err)
+	}
+	return nil
+}
+
+func (a *VINAllowlist) add(entry string) error {
+	entry = strings.ToUpper(entry)
+	prefix, wildcard := strings.CutSuffix(entry, "*")
+	valid := len(prefix) == vinLength || (wildcard && len(prefix) < vinLength)
+	for _, c := range prefix {
+		valid = valid && (('A' <= c && c <= 'Z') || ('0' <= c && c <= '9'))
+	}
+	if !valid {
+		return fmt.Errorf("invalid VIN allowlist entry %q: expected a 17-character VIN or a prefix ending in *", entry)
+	}
+	if wildcard {
+		a.prefixes = append(a.prefixes, prefix)
+		return nil
+	}
+	if a.vins == nil {
+		a.vins = make(map[string]bool)
+	}
+	a.vins[prefix] = true
+	return nil
+}
+
+// Len returns the number of entries in a.
+func (a *VINAllowlist) Len() int {
+	if a == nil {
+		return 0
+	}
+	return len(a.vins) + len(a.prefixes)
+}
+
+// Allowed returns true if a includes vin, or a is empty.
+func (a *VINAllowlist) Allowed(vin string) bool {
+	if a.Len() == 0 {
+		return true
+	}
+	vin = strings.ToUpper(vin)
+	if a.vins[vin] {
+		return true
+	}
+	for _, prefix := range a.prefixes {
+		if strings.HasPrefix(vin, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowVehicle checks vin against p.vinAllowlist. If the vehicle isn't allowed, it writes a 403
+// response and returns false.
+func (p *Proxy) allowVehicle(w http.ResponseWriter, vin string) bool {
+	if p.vinAllowlist.Allowed(vin) {
+		return true
+	}
+	p.metrics.vehiclesDenied.Add(1)
+	log.Warning("Rejected request to %s, which isn't on the VIN allowlist", vin)
+	writeJSONError(w, http.StatusForbidden, errVehicleNotAllowed)
+	return false
+}
@@ -0,0 +1,127 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func TestParseVINAllowlist(t *testing.T) {
+	var allowlist proxy.VINAllowlist
+	if !allowlist.Allowed(testVIN) {
+		t.Errorf("Empty allowlist should allow every vehicle")
+	}
+	if err := allowlist.Parse("5yj3e1ea7kf000001, 7SAY* # Model Y fleet\nLRW3*\t\n# 5YJSA*\n"); err != nil {
+		t.Fatal(err)
+	}
+	if allowlist.Len() != 3 {
+		t.Errorf("Expected 3 entries, got %d", allowlist.Len())
+	}
+	tests := map[string]bool{
+		testVIN:             true,
+		"5YJ3E1EA7KF000002": false,
+		"7SAYGDEE1PF000001": true,
+		"lrw3f7ek4nc000001": true,
+		"5YJSA1E26MF000001": false,
+	}
+	for vin, allowed := range tests {
+		if allowlist.Allowed(vin) != allowed {
+			t.Errorf("Expected Allowed(%s) to be %v", vin, allowed)
+		}
+	}
+
+	for _, s := range []string{"5YJ3E1EA7KF00000", "5YJ3E1EA7KF0000012", "5YJ3E1EA7KF0000012*", "5YJ*3", "5YJ-*"} {
+		if err := new(proxy.VINAllowlist).Parse(s); err == nil {
+			t.Errorf("Expected error for %q", s)
+		}
+	}
+}
+
+func TestLoadVINAllowlistFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "vins.txt")
+	if err := os.WriteFile(filename, []byte("# Depot 1\n"+testVIN+"\n5YJS*\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var allowlist proxy.VINAllowlist
+	if err := allowlist.LoadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if allowlist.Len() != 2 || !allowlist.Allowed(testVIN) {
+		t.Errorf("Allowlist wasn't loaded from file")
+	}
+	if err := os.WriteFile(filename, []byte("not-a-vin\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := allowlist.LoadFile(filename); err == nil || !strings.Contains(err.Error(), filename) {
+		t.Errorf("Expected error naming %s, got %v", filename, err)
+	}
+}
+
+func TestVINAllowlist(t *testing.T) {
+	const otherVIN = "5YJSA1E26MF000001"
+	var allowlist proxy.VINAllowlist
+	if err := allowlist.Parse("5YJ3*"); err != nil {
+		t.Fatal(err)
+	}
+	p, dialed := newDialRecordingProxy(t, proxy.WithVINAllowlist(&allowlist))
+	send := func(path string) int {
+		method := http.MethodPost
+		if !strings.Contains(path, "/command/") {
+			method = http.MethodGet
+		}
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send("/api/1/vehicles/" + testVIN + "/command/door_lock"); code != http.StatusOK {
+		t.Errorf("Expected allowed vehicle to succeed, got %d", code)
+	}
+	dials := len(*dialed)
+	for _, path := range []string{
+		"/api/1/vehicles/" + otherVIN + "/command/door_lock",
+		"/api/1/vehicles/" + otherVIN + "/command/wake_up",
+		"/api/1/vehicles/" + otherVIN + "/awake",
+		"/api/1/vehicles/" + otherVIN + "/vehicle_data",
+		"/api/1/vehicles/" + otherVIN + "/wake_up",
+	} {
+		if code := send(path); code != http.StatusForbidden {
+			t.Errorf("%s: expected 403 for vehicle outside allowlist, got %d", path, code)
+		}
+	}
+	if len(*dialed) != dials {
+		t.Errorf("Proxy connected to a vehicle outside the allowlist")
+	}
+
+	// Each vehicle in a bulk request is checked.
+	req := httptest.NewRequest(http.MethodPost, "/api/1/bulk/set_charge_limit",
+		strings.NewReader(`{"percent": 80, "vins": ["`+testVIN+`", "`+otherVIN+`"]}`))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"succeeded":1,"failed":1`) ||
+		!strings.Contains(w.Body.String(), `"`+otherVIN+`":{"percent":80,"status":403`) {
+		t.Errorf("Unexpected bulk response %s", w.Body.String())
+	}
+
+	// So is each vehicle in a telemetry configuration.
+	req = httptest.NewRequest(http.MethodPost, "/api/1/vehicles/fleet_telemetry_config",
+		strings.NewReader(`{"vins": ["`+testVIN+`", "`+otherVIN+`"], "config": {"hostname": "telemetry.example.com"}}`))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for telemetry configuration of vehicle outside allowlist, got %d", w.Code)
+	}
+
+	if metrics := scrapeMetrics(t, p); !strings.Contains(metrics, "tesla_proxy_vehicle_requests_denied_total 7\n") {
+		t.Errorf("Metrics don't count denied requests:\n%s", metrics)
+	}
+}
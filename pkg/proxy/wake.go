@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/teslamotors/vehicle-command/pkg/account"
+)
+
+const wakeCommand = "wake_up"
+
+var errWakeFailed = errors.New("wake_up failed")
+
+// wakeFlight is a wake_up in progress. Requests to wake the same vehicle that arrive in the
+// meantime wait for it and reply with its response, rather than sending wake_up again.
+type wakeFlight struct {
+	done    chan struct{}
+	status  int
+	header  http.Header
+	body    []byte
+	outcome string
+	err     error
+}
+
+// wakeFlights holds the wake_up in progress for each vehicle and OAuth token.
+type wakeFlights struct {
+	lock  sync.Mutex
+	byKey map[string]*wakeFlight
+}
+
+// writeTo replays f's response to w.
+func (f *wakeFlight) writeTo(w http.ResponseWriter) {
+	for name, values := range f.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(f.status)
+	w.Write(f.body)
+}
+
+// coalesceWake wakes vin with sendCommand, unless a wake_up for vin from a client with the same
+// OAuth token is already in progress, in which case it waits for that one to finish and replies
+// with its response. Requests with different tokens aren't coalesced, since Tesla's servers
+// authorize each token separately. Each request is authorized by the proxy before it gets here.
+func (p *Proxy) coalesceWake(acct *account.Account, w http.ResponseWriter, req *http.Request, vin string) (string, error) {
+	token, _ := bearerToken(req)
+	key := vin + " " + token
+	p.wakes.lock.Lock()
+	if f, ok := p.wakes.byKey[key]; ok {
+		p.wakes.lock.Unlock()
+		p.metrics.wakesCoalesced.Add(1)
+		log.Debug("Waiting for wake_up of %s already in progress", vin)
+		<-f.done
+		f.writeTo(w)
+		return f.outcome, f.err
+	}
+	f := &wakeFlight{done: make(chan struct{})}
+	if p.wakes.byKey == nil {
+		p.wakes.byKey = make(map[string]*wakeFlight)
+	}
+	p.wakes.byKey[key] = f
+	p.wakes.lock.Unlock()
+
+	result := &bufferedResponse{header: make(http.Header)}
+	rec := &statusRecorder{ResponseWriter: result}
+	finished := false
+	defer func() {
+		if !finished {
+			// sendCommand panicked. The panic is reported to this request's client; the others
+			// get a generic error.
+			result = &bufferedResponse{header: make(http.Header)}
+			writeJSONError(result, http.StatusInternalServerError, errWakeFailed)
+			f.status, f.header, f.body = http.StatusInternalServerError, result.header, result.body.Bytes()
+			f.outcome, f.err = AuditOutcomeFailure, errWakeFailed
+		}
+		p.wakes.lock.Lock()
+		delete(p.wakes.byKey, key)
+		p.wakes.lock.Unlock()
+		close(f.done)
+	}()
+	f.outcome, f.err = p.sendCommand(acct, rec, req, wakeCommand, vin)
+	f.status, f.header, f.body = rec.status, result.header, result.body.Bytes()
+	if f.status == 0 {
+		f.status = http.StatusOK
+	}
+	finished = true
+	f.writeTo(w)
+	return f.outcome, f.err
+}
@@ -0,0 +1,66 @@
+package proxy_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+)
+
+func TestConcurrentWakesCoalesced(t *testing.T) {
+	var car *vehicletest.Vehicle
+	var dials atomic.Int32
+	release := make(chan struct{})
+	dial := func(context.Context, *account.Account, string) (connector.Connector, error) {
+		dials.Add(1)
+		<-release
+		return car.Connect(), nil
+	}
+	p, car := newTestProxy(t, true, proxy.WithDialer(dial))
+	// Each wake_up that reaches the vehicle dials it.
+	p.VehicleIdleTimeout = 0
+	car.SetAsleep(true)
+
+	const requests = 5
+	codes := make(chan int, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/api/1/vehicles/"+testVIN+"/command/wake_up", nil)
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, req)
+			codes <- w.Code
+		}()
+	}
+	// The first wake_up is held up dialing the vehicle until the others have joined it.
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(scrapeMetrics(t, p), "tesla_proxy_wakes_coalesced_total 4\n") {
+		if time.Now().After(deadline) {
+			close(release)
+			t.Fatalf("Concurrent wake_up requests weren't coalesced")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < requests; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("Unexpected status %d", code)
+		}
+	}
+	if dials.Load() != 1 || car.Wakes() != 1 {
+		t.Errorf("Expected one wake, got %d dials and %d wakes", dials.Load(), car.Wakes())
+	}
+
+	// Once the wake_up finishes, the next one is sent on its own.
+	if code, _ := postCommand(t, p, "wake_up", nil); code != http.StatusOK || dials.Load() != 2 {
+		t.Errorf("Expected a new wake_up to reach the vehicle (status %d, %d dials)", code, dials.Load())
+	}
+}
@@ -0,0 +1,258 @@
+// Package proxyclient is a Go client for the REST API of tesla-http-proxy.
+//
+// A [Client] sends requests to a proxy on behalf of one OAuth token. Its methods mirror the
+// proxy's routes, and they report failures with the same error types the rest of the SDK uses:
+// an [*inet.HTTPError] when the proxy or Fleet API rejects a request, and a
+// [*protocol.NominalError] when the vehicle receives a command but refuses to execute it.
+//
+//	client, err := proxyclient.New("https://localhost:4443", &tls.Config{RootCAs: pool}, token)
+//	if err != nil {
+//		return err
+//	}
+//	if err := client.Unlock(ctx, vin); err != nil {
+//		return err
+//	}
+//
+// Requests that the proxy turns away with a Retry-After header, because the vehicle is busy or the
+// proxy is at capacity, are retried after the requested delay; see [Client.MaxAttempts].
+package proxyclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/catalog"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+// Defaults used for zero-valued Client fields.
+const (
+	DefaultMaxAttempts  = 3
+	DefaultMaxRetryWait = 30 * time.Second
+)
+
+// ErrUnexpectedResponse indicates that the proxy's reply wasn't the JSON envelope it sends.
+var ErrUnexpectedResponse = errors.New("proxyclient: unexpected response from proxy")
+
+// Client sends requests to a tesla-http-proxy. It's safe for concurrent use.
+type Client struct {
+	// MaxAttempts limits the number of times a request is sent. A request is only repeated if the
+	// proxy rejected it without executing it and included a Retry-After header. Defaults to
+	// DefaultMaxAttempts; set it to 1 to disable retries.
+	MaxAttempts int
+
+	// MaxRetryWait is the longest Retry-After delay the client waits out. Requests with longer
+	// delays, or delays that would outlast the context's deadline, fail immediately. Defaults to
+	// DefaultMaxRetryWait.
+	MaxRetryWait time.Duration
+
+	baseURL    *url.URL
+	authHeader string
+	client     http.Client
+}
+
+// New returns a client for the proxy at baseURL, such as "https://localhost:4443". The proxy's TLS
+// certificate is verified using tlsConfig, which may be nil to use the system's roots. Requests are
+// authorized with oauthToken, which the proxy uses to reach Fleet API.
+func New(baseURL string, tlsConfig *tls.Config, oauthToken string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: expected http(s)://host[:port]", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		baseURL:    u,
+		authHeader: "Bearer " + strings.TrimSpace(oauthToken),
+		client:     http.Client{Transport: transport},
+	}, nil
+}
+
+// Result is the proxy's reply to a command the vehicle executed.
+type Result struct {
+	// Reason is the vehicle's explanation, if any. It's usually empty on success, but some
+	// commands succeed with a reason, such as charge_max_range when the limit is already set.
+	Reason string
+	// Response is the complete "response" object, which includes command-specific fields such as
+	// charge_limit_soc.
+	Response json.RawMessage
+}
+
+// envelope is the JSON body of the proxy's replies.
+type envelope struct {
+	Response         json.RawMessage `json:"response"`
+	Error            string          `json:"error"`
+	ErrorDescription string          `json:"error_description"`
+}
+
+// commandResult is the "response" object of a command.
+type commandResult struct {
+	Result bool   `json:"result"`
+	Reason string `json:"reason"`
+}
+
+// Command sends command to the vehicle with the given VIN or vehicle ID. The params, if non-nil,
+// are encoded as the JSON body; they're typically a catalog request type such as
+// [catalog.ChargeLimitRequest]. If the vehicle refuses the command, the error is a
+// [*protocol.NominalError] holding the vehicle's reason.
+func (c *Client) Command(ctx context.Context, vin, command string, params interface{}) (*Result, error) {
+	var body []byte
+	if params != nil {
+		var err error
+		if body, err = json.Marshal(params); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.do(ctx, http.MethodPost, vehiclePath(vin, "command", command), nil, body)
+	if err != nil {
+		return nil, err
+	}
+	var result commandResult
+	if err := json.Unmarshal(reply.Response, &result); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedResponse, err)
+	}
+	if !result.Result {
+		return nil, &protocol.NominalError{Details: errors.New(result.Reason)}
+	}
+	return &Result{Reason: result.Reason, Response: reply.Response}, nil
+}
+
+// Lock locks the vehicle.
+func (c *Client) Lock(ctx context.Context, vin string) error {
+	_, err := c.Command(ctx, vin, "door_lock", nil)
+	return err
+}
+
+// Unlock unlocks the vehicle. Vehicles refuse to unlock while they're not in park, in which case
+// the error's message is "vehicle_in_motion".
+func (c *Client) Unlock(ctx context.Context, vin string) error {
+	_, err := c.Command(ctx, vin, "door_unlock", nil)
+	return err
+}
+
+// SetChargeLimit sets the vehicle's charge limit, in percent.
+func (c *Client) SetChargeLimit(ctx context.Context, vin string, percent int) error {
+	_, err := c.Command(ctx, vin, "set_charge_limit", &catalog.ChargeLimitRequest{Percent: percent})
+	return err
+}
+
+// Wake wakes the vehicle.
+func (c *Client) Wake(ctx context.Context, vin string) error {
+	_, err := c.Command(ctx, vin, "wake_up", nil)
+	return err
+}
+
+// VehicleData returns the "response" object of the vehicle's Fleet API vehicle data, which the
+// proxy forwards to Fleet API. If endpoints is empty, Fleet API chooses which categories to
+// include.
+func (c *Client) VehicleData(ctx context.Context, vin string, endpoints ...string) (json.RawMessage, error) {
+	query := url.Values{}
+	if len(endpoints) > 0 {
+		query.Set("endpoints", strings.Join(endpoints, ";"))
+	}
+	reply, err := c.do(ctx, http.MethodGet, vehiclePath(vin, "vehicle_data"), query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Response, nil
+}
+
+func vehiclePath(vin string, elem ...string) string {
+	return "/api/1/vehicles/" + url.PathEscape(vin) + "/" + strings.Join(elem, "/")
+}
+
+// do sends a request to the proxy, retrying it as permitted by c.MaxAttempts, and decodes the
+// reply.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte) (*envelope, error) {
+	attempts := c.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultMaxAttempts
+	}
+	maxWait := c.MaxRetryWait
+	if maxWait <= 0 {
+		maxWait = DefaultMaxRetryWait
+	}
+	for attempt := 1; ; attempt++ {
+		reply, err := c.send(ctx, method, path, query, body)
+		var httpErr *inet.HTTPError
+		if err == nil || attempt >= attempts || !errors.As(err, &httpErr) || !retryable(httpErr, maxWait) {
+			return reply, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < httpErr.RetryAfter {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(httpErr.RetryAfter):
+		}
+	}
+}
+
+// retryable returns true if err asks the client to come back later and the proxy didn't execute
+// the request.
+func retryable(err *inet.HTTPError, maxWait time.Duration) bool {
+	return err.RetryAfter > 0 && err.RetryAfter <= maxWait && !err.MayHaveSucceeded()
+}
+
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body []byte) (*envelope, error) {
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", c.authHeader)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, &protocol.CommandError{Err: err, PossibleSuccess: method != http.MethodGet, PossibleTemporary: true}
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(response.Body, connector.MaxResponseLength+1))
+	if err != nil {
+		return nil, &protocol.CommandError{Err: err, PossibleSuccess: true, PossibleTemporary: true}
+	}
+	if len(data) > connector.MaxResponseLength {
+		return nil, protocol.NewError("response exceeds maximum length", true, true)
+	}
+	var reply envelope
+	decodeErr := json.Unmarshal(data, &reply)
+	if response.StatusCode != http.StatusOK {
+		message := strings.TrimSpace(string(data))
+		if decodeErr == nil && reply.Error != "" {
+			message = reply.Error
+		}
+		return nil, &inet.HTTPError{
+			Code:       response.StatusCode,
+			Message:    message,
+			RetryAfter: inet.ParseRetryAfter(response.Header.Get("Retry-After")),
+		}
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedResponse, decodeErr)
+	}
+	return &reply, nil
+}
@@ -0,0 +1,239 @@
+package proxyclient_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/account"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/connector/inet"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+	"github.com/teslamotors/vehicle-command/pkg/proxy"
+	"github.com/teslamotors/vehicle-command/pkg/proxyclient"
+)
+
+const testVIN = "5YJ3E1EA7KF000001"
+
+// testToken is an unsigned OAuth token that the proxy accepts as client credentials.
+var testToken = "header." + base64.RawStdEncoding.EncodeToString(
+	[]byte(`{"aud":["https://fleet-api.prd.na.vn.cloud.tesla.com"],"sub":"test-subject"}`)) + ".signature"
+
+// newClient returns a client for a TLS server running handler.
+func newClient(t *testing.T, handler http.Handler) *proxyclient.Client {
+	t.Helper()
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	client, err := proxyclient.New(server.URL, &tls.Config{RootCAs: roots}, testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// newProxyClient returns a client for a proxy that sends commands to an in-memory vehicle.
+func newProxyClient(t *testing.T) (*proxyclient.Client, *vehicletest.Vehicle) {
+	t.Helper()
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	car := vehicletest.New(testVIN)
+	car.Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+	dial := func(context.Context, *account.Account, string) (connector.Connector, error) {
+		return car.Connect(), nil
+	}
+	p, err := proxy.New(context.Background(), skey, 1, proxy.WithDialer(dial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newClient(t, p), car
+}
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"", "localhost:4443", "ftp://localhost", "https://"} {
+		if _, err := proxyclient.New(baseURL, nil, testToken); err == nil {
+			t.Errorf("Expected error for base URL %q", baseURL)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	client, car := newProxyClient(t)
+	ctx := context.Background()
+
+	if err := client.Unlock(ctx, testVIN); err != nil || car.Locked() {
+		t.Errorf("Unlock failed: %v", err)
+	}
+	if err := client.Lock(ctx, testVIN); err != nil || !car.Locked() {
+		t.Errorf("Lock failed: %v", err)
+	}
+	if err := client.SetChargeLimit(ctx, testVIN, 70); err != nil || car.ChargeLimit() != 70 {
+		t.Errorf("SetChargeLimit failed: %v (limit %d)", err, car.ChargeLimit())
+	}
+	car.SetAsleep(true)
+	if err := client.Wake(ctx, testVIN); err != nil || car.Wakes() != 1 {
+		t.Errorf("Wake failed: %v", err)
+	}
+	result, err := client.Command(ctx, testVIN, "charge_max_range", nil)
+	if err != nil || !strings.Contains(string(result.Response), `"charge_limit_soc":100`) {
+		t.Errorf("Unexpected charge_max_range result %+v: %v", result, err)
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	client, car := newProxyClient(t)
+	ctx := context.Background()
+
+	// The vehicle refuses the command.
+	car.SetLocation(37.5, -122.25, 90, 30)
+	err := client.Unlock(ctx, testVIN)
+	var nominalErr *protocol.NominalError
+	if !errors.As(err, &nominalErr) || err.Error() != "vehicle_in_motion" {
+		t.Errorf("Expected vehicle_in_motion, got %v", err)
+	}
+
+	// The proxy rejects the request.
+	err = client.SetChargeLimit(ctx, testVIN, 10)
+	var httpErr *inet.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusBadRequest || !strings.Contains(httpErr.Message, "percent") {
+		t.Errorf("Expected 400 for invalid charge limit, got %v", err)
+	}
+	if _, err = client.Command(ctx, testVIN, "no_such_command", nil); !errors.As(err, &httpErr) || httpErr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown command, got %v", err)
+	}
+}
+
+// recording is a response captured from a proxy.
+type recording struct {
+	status     int
+	retryAfter string
+	body       string
+}
+
+// replay serves recordings in order, repeating the last one, and counts the requests it receives.
+func replay(recordings []recording, requests *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r := recordings[min(*requests, len(recordings)-1)]
+		*requests++
+		if r.retryAfter != "" {
+			w.Header().Set("Retry-After", r.retryAfter)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(r.status)
+		w.Write([]byte(r.body))
+	})
+}
+
+var (
+	recordedSuccess     = recording{http.StatusOK, "", `{"response":{"result":true,"reason":""},"error":"","error_description":""}`}
+	recordedBusy        = recording{http.StatusTooManyRequests, "1", `{"response":null,"error":"vehicle is busy","error_description":""}`}
+	recordedForbidden   = recording{http.StatusForbidden, "", `{"response":null,"error":"key role ROLE_DRIVER can't authorize set_pin_to_drive","error_description":""}`}
+	recordedFleetAPI    = recording{http.StatusRequestTimeout, "", `{"response":null,"error":"vehicle unavailable: vehicle is offline or asleep","error_description":""}`}
+	recordedRefusal     = recording{http.StatusOK, "", `{"response":{"result":false,"reason":"not_charging"},"error":"","error_description":""}`}
+	recordedBadGateway  = recording{http.StatusBadGateway, "", `upstream connect error`}
+	recordedVehicleData = recording{http.StatusOK, "", `{"response":{"vin":"` + testVIN + `","charge_state":{"battery_level":62}}}`}
+)
+
+func TestRecordedResponses(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordings []recording
+		requests   int
+		code       int    // Expected HTTPError code, if any
+		reason     string // Expected NominalError message, if any
+	}{
+		{"success", []recording{recordedSuccess}, 1, 0, ""},
+		{"busy then success", []recording{recordedBusy, recordedSuccess}, 2, 0, ""},
+		{"forbidden", []recording{recordedForbidden}, 1, http.StatusForbidden, ""},
+		{"fleet api error", []recording{recordedFleetAPI}, 1, http.StatusRequestTimeout, ""},
+		{"refused", []recording{recordedRefusal}, 1, 0, "not_charging"},
+		{"not json", []recording{recordedBadGateway}, 1, http.StatusBadGateway, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			client := newClient(t, replay(tt.recordings, &requests))
+			_, err := client.Command(context.Background(), testVIN, "charge_stop", nil)
+			var httpErr *inet.HTTPError
+			var nominalErr *protocol.NominalError
+			switch {
+			case tt.code != 0:
+				if !errors.As(err, &httpErr) || httpErr.Code != tt.code {
+					t.Errorf("Expected HTTP %d, got %v", tt.code, err)
+				}
+			case tt.reason != "":
+				if !errors.As(err, &nominalErr) || err.Error() != tt.reason {
+					t.Errorf("Expected refusal %q, got %v", tt.reason, err)
+				}
+			case err != nil:
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if requests != tt.requests {
+				t.Errorf("Expected %d requests, got %d", tt.requests, requests)
+			}
+		})
+	}
+}
+
+func TestRetryLimits(t *testing.T) {
+	var requests int
+	client := newClient(t, replay([]recording{recordedBusy}, &requests))
+	client.MaxAttempts = 1
+	err := client.Lock(context.Background(), testVIN)
+	var httpErr *inet.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Code != http.StatusTooManyRequests || httpErr.RetryAfter != time.Second || requests != 1 {
+		t.Errorf("Expected a single 429 with Retry-After, got %v after %d requests", err, requests)
+	}
+
+	// Delays longer than MaxRetryWait or the context's deadline aren't waited out.
+	requests = 0
+	client.MaxAttempts = 0
+	client.MaxRetryWait = time.Millisecond
+	if err := client.Lock(context.Background(), testVIN); err == nil || requests != 1 {
+		t.Errorf("Expected no retries beyond MaxRetryWait, got %v after %d requests", err, requests)
+	}
+	requests = 0
+	client.MaxRetryWait = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := client.Lock(ctx, testVIN); err == nil || requests != 1 {
+		t.Errorf("Expected no retries beyond deadline, got %v after %d requests", err, requests)
+	}
+}
+
+func TestVehicleData(t *testing.T) {
+	var requests int
+	var query string
+	recorded := replay([]recording{recordedVehicleData}, &requests)
+	client := newClient(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet || req.URL.Path != "/api/1/vehicles/"+testVIN+"/vehicle_data" {
+			t.Errorf("Unexpected request %s %s", req.Method, req.URL.Path)
+		}
+		if req.Header.Get("Authorization") != "Bearer "+testToken {
+			t.Error("Request didn't include OAuth token")
+		}
+		query = req.URL.Query().Get("endpoints")
+		recorded.ServeHTTP(w, req)
+	}))
+	data, err := client.VehicleData(context.Background(), testVIN, "charge_state", "location_data")
+	if err != nil || !strings.Contains(string(data), `"battery_level":62`) {
+		t.Errorf("Unexpected vehicle data %s: %v", data, err)
+	}
+	if query != "charge_state;location_data" {
+		t.Errorf("Unexpected endpoints %q", query)
+	}
+}
@@ -0,0 +1,137 @@
+// Package redact removes vehicle identification numbers (VINs) from text that leaves the process
+// through logs, metrics labels, or audit records.
+//
+// A single process-wide redaction function is used everywhere so that the same VIN always
+// produces the same token regardless of where it's emitted. The default masks all but the last
+// four characters. Applications that need a different scheme, such as format-preserving
+// tokenization, can install their own function with SetVINRedactor.
+//
+// The package also identifies secrets that configuration dumps must mask; see IsSecretSetting.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// VINFunc maps a VIN to the string that should be emitted in its place. Implementations must be
+// safe for concurrent use and should be deterministic so that log lines can be correlated.
+type VINFunc func(vin string) string
+
+// Names of the built-in redaction modes accepted by ParseMode.
+const (
+	ModeMask = "mask"
+	ModeHash = "hash"
+	ModeNone = "none"
+)
+
+var (
+	redactorLock sync.RWMutex
+	redactor     VINFunc = MaskVIN
+	hashKey              = randomHashKey()
+)
+
+// randomHashKey returns the key HashVIN uses until SetHashKey is called.
+func randomHashKey() []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("couldn't generate VIN hash key: %s", err))
+	}
+	return key
+}
+
+// vinPattern matches candidate VINs in either case. VINs never contain I, O, or Q.
+var vinPattern = regexp.MustCompile(`(?i)\b[A-HJ-NPR-Z0-9]{17}\b`)
+
+// SetVINRedactor installs f as the process-wide redaction function. Passing nil restores the
+// default (MaskVIN).
+func SetVINRedactor(f VINFunc) {
+	if f == nil {
+		f = MaskVIN
+	}
+	redactorLock.Lock()
+	defer redactorLock.Unlock()
+	redactor = f
+}
+
+// VIN returns the redacted form of vin using the installed redaction function.
+func VIN(vin string) string {
+	redactorLock.RLock()
+	f := redactor
+	redactorLock.RUnlock()
+	return f(vin)
+}
+
+// Text replaces every VIN-like substring of s with its redacted form. Substrings must contain both
+// letters and digits to be treated as VINs, which keeps long numbers intact, and must be exactly 17
+// characters long, which keeps hex dumps intact. VINs are case-insensitive, so a VIN is redacted as
+// its upper-case form.
+func Text(s string) string {
+	if len(s) < 17 {
+		return s
+	}
+	return vinPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if !strings.ContainsAny(match, "0123456789") || strings.Trim(match, "0123456789") == "" {
+			return match
+		}
+		return VIN(strings.ToUpper(match))
+	})
+}
+
+// MaskVIN replaces all but the last four characters of vin with asterisks.
+func MaskVIN(vin string) string {
+	if len(vin) <= 4 {
+		return strings.Repeat("*", len(vin))
+	}
+	return strings.Repeat("*", len(vin)-4) + vin[len(vin)-4:]
+}
+
+// SetHashKey sets the secret key of HashVIN. Processes that share a key produce the same hashes,
+// so a deployment that correlates hashes across processes or restarts should set one. Passing an
+// empty key restores a random key generated for this process.
+//
+// VINs have too little entropy for an unkeyed digest to hide them: anyone can hash every
+// plausible VIN and look the result up. Without the key, a hash can't be tested against VINs.
+func SetHashKey(key []byte) {
+	if len(key) == 0 {
+		key = randomHashKey()
+	}
+	redactorLock.Lock()
+	defer redactorLock.Unlock()
+	hashKey = append([]byte(nil), key...)
+}
+
+// HashVIN replaces vin with a truncated HMAC-SHA256 of the VIN, keyed with the key set by
+// SetHashKey. The result is stable for as long as the key is, so it can be used to correlate
+// events without revealing the VIN.
+func HashVIN(vin string) string {
+	redactorLock.RLock()
+	mac := hmac.New(sha256.New, hashKey)
+	redactorLock.RUnlock()
+	mac.Write([]byte(vin))
+	return "vin:" + hex.EncodeToString(mac.Sum(nil)[:6])
+}
+
+// NoRedaction returns vin unmodified.
+func NoRedaction(vin string) string {
+	return vin
+}
+
+// ParseMode returns the built-in redaction function with the given name (mask, hash, or none).
+func ParseMode(mode string) (VINFunc, error) {
+	switch strings.ToLower(mode) {
+	case ModeMask, "":
+		return MaskVIN, nil
+	case ModeHash:
+		return HashVIN, nil
+	case ModeNone:
+		return NoRedaction, nil
+	}
+	return nil, fmt.Errorf("unrecognized VIN redaction mode '%s' (expected %s, %s, or %s)", mode, ModeMask, ModeHash, ModeNone)
+}
@@ -0,0 +1,67 @@
+package redact
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Secret replaces the values of secrets, such as tokens and passwords, in configuration dumps.
+const Secret = "<redacted>"
+
+// secretWords identify settings that hold secrets.
+var secretWords = []string{"password", "secret", "token", "credential"}
+
+// IsSecretSetting returns true if the setting called name may hold a secret. Settings that name a
+// file, directory, or keyring entry containing a secret, such as token-file or token-name, aren't
+// secret themselves.
+func IsSecretSetting(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range []string{"-file", "-name", "-dir", "_file", "_name", "_dir"} {
+		if strings.HasSuffix(name, suffix) {
+			return false
+		}
+	}
+	for _, word := range secretWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// URL masks the credentials that rawURL may carry, such as the API key of a webhook: its userinfo
+// and the values of its query parameters are replaced with Secret. Values that aren't URLs with a
+// host, or that carry neither, are returned unchanged.
+func URL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.User == nil && u.RawQuery == "") {
+		return rawURL
+	}
+	var b strings.Builder
+	b.WriteString(u.Scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(Secret)
+		b.WriteByte('@')
+	}
+	b.WriteString(u.Host)
+	b.WriteString(u.EscapedPath())
+	if u.RawQuery != "" {
+		for i, param := range strings.Split(u.RawQuery, "&") {
+			if i == 0 {
+				b.WriteByte('?')
+			} else {
+				b.WriteByte('&')
+			}
+			name, _, _ := strings.Cut(param, "=")
+			b.WriteString(name)
+			b.WriteByte('=')
+			b.WriteString(Secret)
+		}
+	}
+	if u.Fragment != "" {
+		b.WriteByte('#')
+		b.WriteString(u.EscapedFragment())
+	}
+	return b.String()
+}
@@ -11,6 +11,7 @@ import (
 //
 // The function overwrites the audience ("aud") and issuer ("iss") JWT claims.
 func SignMessageForVehicle(privateKey authentication.ECDHPrivateKey, vin, app string, message jwt.MapClaims) (string, error) {
+	privateKey = authentication.WithKeyUsage(privateKey, vin, authentication.KeyPurposeMessageSignature)
 	return authentication.SignMessage(privateKey, message, "com.tesla.vehicle."+vin+"."+app)
 }
 
@@ -21,5 +22,6 @@ func SignMessageForVehicle(privateKey authentication.ECDHPrivateKey, vin, app st
 // The function overwrites the audience ("aud") and issuer ("iss") JWT claims.
 func SignMessageForFleet(privateKey authentication.ECDHPrivateKey, app string, message jwt.MapClaims) (string, error) {
 	// Issuers are identified by their public key
+	privateKey = authentication.WithKeyUsage(privateKey, "", authentication.KeyPurposeMessageSignature)
 	return authentication.SignMessage(privateKey, message, "com.tesla.fleet."+app)
 }
@@ -0,0 +1,63 @@
+package telemetry
+
+import (
+	"errors"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+var errMalformedEnvelope = errors.New("malformed telemetry envelope")
+
+// fbTable reads fields from a FlatBuffers table, like the accessors that flatc generates from
+// Tesla's fleet-telemetry schemas. Fields are identified by slot, their position in the schema.
+//
+// The FlatBuffers runtime doesn't bounds-check offsets, so reading a malformed buffer panics; see
+// readEnvelope.
+type fbTable struct {
+	flatbuffers.Table
+}
+
+// fbRoot returns the root table of buf.
+func fbRoot(buf []byte) fbTable {
+	return fbTable{flatbuffers.Table{Bytes: buf, Pos: flatbuffers.GetUOffsetT(buf)}}
+}
+
+// offset returns the position of the field in slot relative to the table, or 0 if the field is
+// absent.
+func (t *fbTable) offset(slot int) flatbuffers.UOffsetT {
+	return flatbuffers.UOffsetT(t.Offset(flatbuffers.VOffsetT(4 + 2*slot)))
+}
+
+func (t *fbTable) uint8(slot int) uint8 {
+	if o := t.offset(slot); o != 0 {
+		return t.GetUint8(t.Pos + o)
+	}
+	return 0
+}
+
+func (t *fbTable) uint32(slot int) uint32 {
+	if o := t.offset(slot); o != 0 {
+		return t.GetUint32(t.Pos + o)
+	}
+	return 0
+}
+
+// bytes returns the [ubyte] vector in slot, or nil if it's absent.
+func (t *fbTable) bytes(slot int) []byte {
+	if o := t.offset(slot); o != 0 {
+		return t.ByteVector(t.Pos + o)
+	}
+	return nil
+}
+
+// subtable returns the table in slot, such as the value of a union. The bool is false if the field
+// is absent.
+func (t *fbTable) subtable(slot int) (fbTable, bool) {
+	var sub fbTable
+	o := t.offset(slot)
+	if o == 0 {
+		return sub, false
+	}
+	t.Union(&sub.Table, o)
+	return sub, true
+}
@@ -0,0 +1,274 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// TopicVehicleData is the topic of messages that carry vehicle_data.proto Payloads. Other topics,
+// such as "alerts" and "errors", are passed to sinks without decoding.
+const TopicVehicleData = "V"
+
+// Envelope slots, from Tesla's fleet-telemetry messages/tesla/*.fbs schemas.
+const (
+	envelopeTxID        = 0
+	envelopeTopic       = 1
+	envelopeMessageType = 2
+	envelopeMessage     = 3
+	envelopeMessageID   = 4
+
+	streamCreatedAt = 0
+	streamPayload   = 2
+
+	messageTypeStream = 1
+)
+
+// ValueKind identifies the type of a Datum's Value.
+type ValueKind string
+
+const (
+	KindString   ValueKind = "string"
+	KindInteger  ValueKind = "integer" // int64
+	KindFloat    ValueKind = "float"   // float64
+	KindBoolean  ValueKind = "boolean"
+	KindLocation ValueKind = "location" // Location
+	KindEnum     ValueKind = "enum"     // int32; ValueField identifies the enum type
+	KindInvalid  ValueKind = "invalid"  // The vehicle couldn't read the field; Value is nil
+	KindMessage  ValueKind = "message"  // []byte containing an undecoded protobuf message
+)
+
+// Location is a decoded LocationValue.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Datum is a single field reported by a vehicle.
+type Datum struct {
+	// Field is the vehicle_data.proto Field enum value, such as 4 for VehicleSpeed. Field names
+	// aren't included because the enum grows with vehicle firmware; map numbers to names using
+	// the vehicle_data.proto version that matches your telemetry configuration.
+	Field int32 `json:"field"`
+	// ValueField is the field number of the Value oneof member that the vehicle populated. It
+	// distinguishes enum types, which all have KindEnum.
+	ValueField int32       `json:"value_field"`
+	Kind       ValueKind   `json:"kind"`
+	Value      interface{} `json:"value,omitempty"`
+}
+
+// Record is a telemetry message received from a vehicle.
+type Record struct {
+	// VIN is taken from the vehicle's client certificate.
+	VIN        string    `json:"vin"`
+	Topic      string    `json:"topic"`
+	TxID       string    `json:"txid,omitempty"`
+	MessageID  string    `json:"message_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReceivedAt time.Time `json:"received_at"`
+	// IsResend is set if the vehicle has sent the data before, for example because it didn't
+	// receive an acknowledgement.
+	IsResend bool    `json:"is_resend,omitempty"`
+	Data     []Datum `json:"data,omitempty"`
+	// Payload holds the undecoded message for topics other than TopicVehicleData.
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// Decode parses a telemetry message sent by the vehicle with the given VIN.
+func Decode(vin string, message []byte) (*Record, error) {
+	record := &Record{VIN: vin, ReceivedAt: time.Now()}
+	payload, err := record.readEnvelope(message)
+	if err != nil {
+		return nil, err
+	}
+	if record.Topic != TopicVehicleData {
+		record.Payload = append([]byte(nil), payload...)
+		return record, nil
+	}
+	if err := record.decodePayload(payload); err != nil {
+		return nil, fmt.Errorf("invalid vehicle data payload: %w", err)
+	}
+	return record, nil
+}
+
+// readEnvelope sets r's metadata from the FlatBuffers envelope of message and returns the
+// envelope's payload, which refers to message. Since message comes from the network and the
+// FlatBuffers runtime doesn't check offsets, a malformed envelope causes a panic, which
+// readEnvelope recovers from.
+func (r *Record) readEnvelope(message []byte) (payload []byte, err error) {
+	defer func() {
+		if recover() != nil {
+			payload, err = nil, errMalformedEnvelope
+		}
+	}()
+	envelope := fbRoot(message)
+	r.Topic = string(envelope.bytes(envelopeTopic))
+	r.TxID = string(envelope.bytes(envelopeTxID))
+	r.MessageID = string(envelope.bytes(envelopeMessageID))
+	if messageType := envelope.uint8(envelopeMessageType); messageType != messageTypeStream {
+		return nil, fmt.Errorf("unsupported telemetry message type %d", messageType)
+	}
+	stream, ok := envelope.subtable(envelopeMessage)
+	if !ok {
+		return nil, errMalformedEnvelope
+	}
+	r.CreatedAt = time.Unix(int64(stream.uint32(streamCreatedAt)), 0).UTC()
+	return stream.bytes(streamPayload), nil
+}
+
+var errMalformedPayload = errors.New("malformed protobuf")
+
+// protoFields invokes fn on each field of a serialized protobuf message. For varint, fixed32,
+// and fixed64 fields, value holds the field's bits; for length-delimited fields, data holds its
+// contents.
+func protoFields(b []byte, fn func(num protowire.Number, typ protowire.Type, value uint64, data []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return errMalformedPayload
+		}
+		b = b[n:]
+		var value uint64
+		var data []byte
+		switch typ {
+		case protowire.VarintType:
+			value, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			value = uint64(v)
+		case protowire.Fixed64Type:
+			value, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errMalformedPayload
+		}
+		b = b[n:]
+		if err := fn(num, typ, value, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodePayload parses a vehicle_data.proto Payload:
+//
+//	message Payload {
+//	  repeated Datum data = 1;
+//	  google.protobuf.Timestamp created_at = 2;
+//	  string vin = 3;
+//	  bool is_resend = 4;
+//	}
+func (r *Record) decodePayload(payload []byte) error {
+	var vin string
+	err := protoFields(payload, func(num protowire.Number, typ protowire.Type, value uint64, data []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			datum, err := decodeDatum(data)
+			if err != nil {
+				return err
+			}
+			r.Data = append(r.Data, datum)
+		case num == 2 && typ == protowire.BytesType:
+			createdAt, err := decodeTimestamp(data)
+			if err != nil {
+				return err
+			}
+			r.CreatedAt = createdAt
+		case num == 3 && typ == protowire.BytesType:
+			vin = string(data)
+		case num == 4 && typ == protowire.VarintType:
+			r.IsResend = value != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if vin != "" && vin != r.VIN {
+		return errors.New("payload VIN doesn't match client certificate")
+	}
+	return nil
+}
+
+func decodeTimestamp(data []byte) (time.Time, error) {
+	var seconds, nanos int64
+	err := protoFields(data, func(num protowire.Number, typ protowire.Type, value uint64, _ []byte) error {
+		if typ == protowire.VarintType {
+			switch num {
+			case 1:
+				seconds = int64(value)
+			case 2:
+				nanos = int64(int32(value))
+			}
+		}
+		return nil
+	})
+	return time.Unix(seconds, nanos).UTC(), err
+}
+
+// decodeDatum parses a Datum, which holds a Field enum (field 1) and a Value (field 2).
+func decodeDatum(data []byte) (Datum, error) {
+	var datum Datum
+	err := protoFields(data, func(num protowire.Number, typ protowire.Type, value uint64, data []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			datum.Field = int32(value)
+		case num == 2 && typ == protowire.BytesType:
+			return protoFields(data, datum.setValue)
+		}
+		return nil
+	})
+	return datum, err
+}
+
+// setValue decodes a member of the Value oneof. The first few members have fixed meanings;
+// the remainder are enums or messages, which are identified by ValueField.
+func (d *Datum) setValue(num protowire.Number, typ protowire.Type, value uint64, data []byte) error {
+	d.ValueField = int32(num)
+	switch {
+	case num == 1 && typ == protowire.BytesType: // string_value
+		d.Kind, d.Value = KindString, string(data)
+	case num == 2 && typ == protowire.VarintType: // int_value
+		d.Kind, d.Value = KindInteger, int64(int32(value))
+	case num == 3 && typ == protowire.VarintType: // long_value
+		d.Kind, d.Value = KindInteger, int64(value)
+	case num == 6 && typ == protowire.VarintType: // boolean_value
+		d.Kind, d.Value = KindBoolean, value != 0
+	case num == 10 && typ == protowire.VarintType: // invalid
+		d.Kind, d.Value = KindInvalid, nil
+	case num == 7 && typ == protowire.BytesType: // location_value
+		var location Location
+		err := protoFields(data, func(num protowire.Number, typ protowire.Type, value uint64, _ []byte) error {
+			if typ == protowire.Fixed64Type {
+				switch num {
+				case 1:
+					location.Latitude = math.Float64frombits(value)
+				case 2:
+					location.Longitude = math.Float64frombits(value)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		d.Kind, d.Value = KindLocation, location
+	case typ == protowire.Fixed32Type: // float_value
+		d.Kind, d.Value = KindFloat, float64(math.Float32frombits(uint32(value)))
+	case typ == protowire.Fixed64Type: // double_value
+		d.Kind, d.Value = KindFloat, math.Float64frombits(value)
+	case typ == protowire.VarintType:
+		d.Kind, d.Value = KindEnum, int32(value)
+	case typ == protowire.BytesType:
+		d.Kind, d.Value = KindMessage, append([]byte(nil), data...)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+/*
+Package telemetry receives Fleet Telemetry streams directly from vehicles.
+
+Vehicles configured with fleet_telemetry_config (see the HTTP proxy's
+/api/1/vehicles/fleet_telemetry_config endpoint) open a WebSocket to the configured hostname,
+authenticating with a client certificate issued by Tesla whose common name is the VIN. Each
+WebSocket message is a FlatBuffers envelope around a topic-specific payload. Server decodes these
+messages into Records and passes them to a Sink.
+
+This package is intended for local deployments that want telemetry without running Tesla's
+fleet-telemetry server. It doesn't acknowledge messages, so vehicles may resend data (see
+Record.IsResend), and it doesn't interpret the payloads of topics other than TopicVehicleData.
+*/
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	logger "github.com/teslamotors/vehicle-command/internal/log"
+)
+
+var log = logger.Module(logger.ModuleTelemetry)
+
+const (
+	// DefaultMaxMessageBytes limits the size of a single telemetry message.
+	DefaultMaxMessageBytes = 1 << 20
+	// DefaultIdleTimeout is how long a vehicle connection may go without a message or a reply to
+	// the server's pings before the server closes it.
+	DefaultIdleTimeout = 2 * time.Minute
+	// DefaultReadHeaderTimeout limits how long a vehicle may take to send the headers of its
+	// WebSocket handshake.
+	DefaultReadHeaderTimeout = 10 * time.Second
+
+	// writeTimeout limits how long the server blocks sending a ping or close frame to a vehicle.
+	writeTimeout = 10 * time.Second
+)
+
+// Sink receives decoded telemetry records. Server calls WriteRecord from one goroutine per
+// vehicle connection, so implementations must be safe for concurrent use.
+type Sink interface {
+	WriteRecord(r *Record) error
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(r *Record) error
+
+func (f SinkFunc) WriteRecord(r *Record) error {
+	return f(r)
+}
+
+// JSONSink writes each record as a line of JSON. Each record is passed to the underlying writer in
+// a single Write call.
+type JSONSink struct {
+	out  io.Writer
+	lock sync.Mutex
+}
+
+// NewJSONSink returns a Sink that writes JSON lines to out.
+func NewJSONSink(out io.Writer) *JSONSink {
+	return &JSONSink{out: out}
+}
+
+func (s *JSONSink) WriteRecord(r *Record) error {
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.out.Write(append(encoded, '\n'))
+	return err
+}
+
+// Server is an http.Handler that accepts Fleet Telemetry connections. It must be served over TLS
+// with client certificates required; see NewTLSConfig. WebSocket connections outlive the HTTP
+// requests that open them, so call Shutdown as well as shutting down the http.Server.
+type Server struct {
+	Sink            Sink
+	MaxMessageBytes int
+	// IdleTimeout closes connections that go this long without a message or a reply to the
+	// server's pings, which it sends at half this interval. Zero means DefaultIdleTimeout.
+	IdleTimeout time.Duration
+
+	lock     sync.Mutex
+	conns    map[*websocket.Conn]struct{}
+	shutdown bool
+	active   sync.WaitGroup
+}
+
+// NewServer returns a Server that sends records to sink.
+func NewServer(sink Sink) *Server {
+	return &Server{Sink: sink, MaxMessageBytes: DefaultMaxMessageBytes, IdleTimeout: DefaultIdleTimeout}
+}
+
+// NewTLSConfig loads the server's certificate chain and private key, and configures the server to
+// require vehicle client certificates signed by a CA in clientCAFile.
+func NewTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load telemetry server certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load vehicle CA certificates: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("vehicle CA file doesn't contain any PEM certificates")
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// clientVIN returns the VIN from the verified client certificate of req.
+func clientVIN(req *http.Request) (string, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return "", errors.New("vehicle did not present a verified client certificate")
+	}
+	vin := req.TLS.VerifiedChains[0][0].Subject.CommonName
+	if len(vin) != 17 {
+		return "", fmt.Errorf("client certificate common name %q is not a VIN", vin)
+	}
+	return vin, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	vin, err := clientVIN(req)
+	if err != nil {
+		log.Warning("Rejected telemetry connection from %s: %s", req.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	s.accept(w, req, vin)
+}
+
+// accept completes the WebSocket handshake with the vehicle with the given VIN and receives its
+// messages until it disconnects.
+func (s *Server) accept(w http.ResponseWriter, req *http.Request, vin string) {
+	// Vehicles don't send an Origin header, which the upgrader accepts.
+	var upgrader websocket.Upgrader
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		log.Warning("Telemetry handshake with %s failed: %s", vin, err)
+		return
+	}
+	if !s.track(conn) {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(writeTimeout))
+		conn.Close()
+		return
+	}
+	defer s.untrack(conn)
+	log.Info("Receiving telemetry from %s", vin)
+	s.serve(conn, vin)
+}
+
+// track records conn so that Shutdown can close it. It returns false if the server is shutting
+// down.
+func (s *Server) track(conn *websocket.Conn) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.shutdown {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[*websocket.Conn]struct{})
+	}
+	s.conns[conn] = struct{}{}
+	s.active.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn *websocket.Conn) {
+	s.lock.Lock()
+	delete(s.conns, conn)
+	s.lock.Unlock()
+	s.active.Done()
+}
+
+// Shutdown closes vehicle connections, telling the vehicles to reconnect later, and waits for
+// their records to reach the Sink or for ctx to expire. Connections opened afterwards are closed
+// immediately. The http.Server doesn't close WebSocket connections itself, so register Shutdown
+// with its RegisterOnShutdown method.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lock.Lock()
+	s.shutdown = true
+	conns := make([]*websocket.Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.lock.Unlock()
+	for _, conn := range conns {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(writeTimeout))
+		conn.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// serve decodes messages from conn until the vehicle disconnects, the connection is idle for
+// longer than IdleTimeout, or the server shuts down.
+func (s *Server) serve(conn *websocket.Conn, vin string) {
+	defer conn.Close()
+	maxMessage := s.MaxMessageBytes
+	if maxMessage <= 0 {
+		maxMessage = DefaultMaxMessageBytes
+	}
+	idleTimeout := s.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	conn.SetReadLimit(int64(maxMessage))
+	extendDeadline := func() error {
+		return conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	}
+	extendDeadline()
+	conn.SetPongHandler(func(string) error {
+		return extendDeadline()
+	})
+	conn.SetPingHandler(func(data string) error {
+		extendDeadline()
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeTimeout))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		}
+		return err
+	})
+
+	stopPings := make(chan struct{})
+	defer close(stopPings)
+	go func() {
+		ticker := time.NewTicker(idleTimeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopPings:
+				return
+			case <-ticker.C:
+				if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)) != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && !errors.Is(err, io.EOF) {
+				log.Warning("Telemetry connection from %s closed: %s", vin, err)
+			}
+			return
+		}
+		extendDeadline()
+		if messageType != websocket.BinaryMessage {
+			continue
+		}
+		record, err := Decode(vin, message)
+		if err != nil {
+			log.Warning("Discarding telemetry message from %s: %s", vin, err)
+			continue
+		}
+		if err := s.Sink.WriteRecord(record); err != nil {
+			log.Error("Telemetry sink failed: %s", err)
+		}
+	}
+}
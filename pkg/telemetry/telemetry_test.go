@@ -0,0 +1,281 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const testVIN = "5YJ3E1EA7KF000001"
+
+// testEnvelope builds a FlatBuffers envelope as a vehicle would.
+func testEnvelope(topic string, messageType byte, createdAt uint32, payload []byte) []byte {
+	b := flatbuffers.NewBuilder(0)
+	payloadVector := b.CreateByteVector(payload)
+	b.StartObject(6)
+	b.PrependUint32Slot(streamCreatedAt, createdAt, 0)
+	b.PrependUOffsetTSlot(streamPayload, payloadVector, 0)
+	stream := b.EndObject()
+
+	topicVector := b.CreateByteVector([]byte(topic))
+	txid := b.CreateByteVector([]byte("tx-1"))
+	messageID := b.CreateByteVector([]byte("msg-1"))
+	b.StartObject(5)
+	b.PrependUOffsetTSlot(envelopeTxID, txid, 0)
+	b.PrependUOffsetTSlot(envelopeTopic, topicVector, 0)
+	b.PrependByteSlot(envelopeMessageType, messageType, 0)
+	b.PrependUOffsetTSlot(envelopeMessage, stream, 0)
+	b.PrependUOffsetTSlot(envelopeMessageID, messageID, 0)
+	b.Finish(b.EndObject())
+	return b.FinishedBytes()
+}
+
+func appendDatum(b []byte, field int32, value []byte) []byte {
+	var datum []byte
+	datum = protowire.AppendTag(datum, 1, protowire.VarintType)
+	datum = protowire.AppendVarint(datum, uint64(field))
+	datum = protowire.AppendTag(datum, 2, protowire.BytesType)
+	datum = protowire.AppendBytes(datum, value)
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, datum)
+}
+
+func testPayload(vin string) []byte {
+	var b []byte
+	var value []byte
+	value = protowire.AppendTag(value, 1, protowire.BytesType)
+	value = protowire.AppendString(value, "Drive")
+	b = appendDatum(b, 10, value)
+
+	value = protowire.AppendTag(nil, 5, protowire.Fixed64Type)
+	value = protowire.AppendFixed64(value, math.Float64bits(42.5))
+	b = appendDatum(b, 4, value)
+
+	var location []byte
+	location = protowire.AppendTag(location, 1, protowire.Fixed64Type)
+	location = protowire.AppendFixed64(location, math.Float64bits(37.5))
+	location = protowire.AppendTag(location, 2, protowire.Fixed64Type)
+	location = protowire.AppendFixed64(location, math.Float64bits(-122.25))
+	value = protowire.AppendTag(nil, 7, protowire.BytesType)
+	value = protowire.AppendBytes(value, location)
+	b = appendDatum(b, 21, value)
+
+	value = protowire.AppendTag(nil, 10, protowire.VarintType)
+	value = protowire.AppendVarint(value, 1)
+	b = appendDatum(b, 8, value)
+
+	value = protowire.AppendTag(nil, 12, protowire.VarintType)
+	value = protowire.AppendVarint(value, 3)
+	b = appendDatum(b, 2, value)
+
+	var timestamp []byte
+	timestamp = protowire.AppendTag(timestamp, 1, protowire.VarintType)
+	timestamp = protowire.AppendVarint(timestamp, 1700000000)
+	timestamp = protowire.AppendTag(timestamp, 2, protowire.VarintType)
+	timestamp = protowire.AppendVarint(timestamp, 500)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, timestamp)
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendString(b, vin)
+	b = protowire.AppendTag(b, 4, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func TestDecodeVehicleData(t *testing.T) {
+	record, err := Decode(testVIN, testEnvelope(TopicVehicleData, messageTypeStream, 1, testPayload(testVIN)))
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if record.VIN != testVIN || record.Topic != TopicVehicleData || record.TxID != "tx-1" || record.MessageID != "msg-1" {
+		t.Errorf("Unexpected record metadata: %+v", record)
+	}
+	if !record.CreatedAt.Equal(time.Unix(1700000000, 500)) {
+		t.Errorf("Expected payload timestamp, got %s", record.CreatedAt)
+	}
+	if !record.IsResend {
+		t.Errorf("Expected IsResend")
+	}
+	expected := []Datum{
+		{Field: 10, ValueField: 1, Kind: KindString, Value: "Drive"},
+		{Field: 4, ValueField: 5, Kind: KindFloat, Value: 42.5},
+		{Field: 21, ValueField: 7, Kind: KindLocation, Value: Location{Latitude: 37.5, Longitude: -122.25}},
+		{Field: 8, ValueField: 10, Kind: KindInvalid},
+		{Field: 2, ValueField: 12, Kind: KindEnum, Value: int32(3)},
+	}
+	if len(record.Data) != len(expected) {
+		t.Fatalf("Expected %d data, got %d", len(expected), len(record.Data))
+	}
+	for i, datum := range record.Data {
+		if datum != expected[i] {
+			t.Errorf("Datum %d: expected %+v, got %+v", i, expected[i], datum)
+		}
+	}
+}
+
+func TestDecodeOtherTopic(t *testing.T) {
+	record, err := Decode(testVIN, testEnvelope("alerts", messageTypeStream, 1700000000, []byte{1, 2, 3}))
+	if err != nil {
+		t.Fatalf("Decode failed: %s", err)
+	}
+	if record.Data != nil || string(record.Payload) != "\x01\x02\x03" {
+		t.Errorf("Expected undecoded payload, got %+v", record)
+	}
+	if !record.CreatedAt.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Expected envelope timestamp, got %s", record.CreatedAt)
+	}
+}
+
+func TestDecodeRejectsInvalidMessages(t *testing.T) {
+	valid := testEnvelope(TopicVehicleData, messageTypeStream, 1, testPayload(testVIN))
+	// Truncated messages must fail cleanly rather than panic.
+	for i := 0; i < len(valid); i++ {
+		Decode(testVIN, valid[:i])
+	}
+	if _, err := Decode(testVIN, valid[:3]); err == nil {
+		t.Errorf("Expected error for truncated envelope")
+	}
+	if _, err := Decode("5YJ3E1EA7KF000002", valid); err == nil {
+		t.Errorf("Expected error for mismatched VIN")
+	}
+	if _, err := Decode(testVIN, testEnvelope(TopicVehicleData, 2, 1, nil)); err == nil {
+		t.Errorf("Expected error for unsupported message type")
+	}
+	if _, err := Decode(testVIN, testEnvelope(TopicVehicleData, messageTypeStream, 1, []byte{0x0a, 0x05})); err == nil {
+		t.Errorf("Expected error for malformed payload")
+	}
+}
+
+// dialTestServer serves s to a vehicle with testVIN, and returns the vehicle's end of the
+// connection.
+func dialTestServer(t *testing.T, s *Server) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s.accept(w, req, testVIN)
+	}))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitForClose reads from conn, without answering pings, until the server closes it.
+func waitForClose(t *testing.T, conn *websocket.Conn) error {
+	t.Helper()
+	conn.SetPingHandler(func(string) error { return nil })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return err
+		}
+	}
+}
+
+func TestServerForwardsRecords(t *testing.T) {
+	records := make(chan *Record, 2)
+	s := NewServer(SinkFunc(func(r *Record) error {
+		records <- r
+		return nil
+	}))
+	conn := dialTestServer(t, s)
+
+	message := testEnvelope("alerts", messageTypeStream, 1, []byte("alert"))
+	if err := conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("Ping failed: %s", err)
+	}
+	for _, m := range [][]byte{message, []byte("not an envelope"), message} {
+		if err := conn.WriteMessage(websocket.BinaryMessage, m); err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte("ignored"))
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-records:
+			if r.Topic != "alerts" || string(r.Payload) != "alert" {
+				t.Errorf("Unexpected record: %+v", r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected two records, got %d", i)
+		}
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	if err := waitForClose(t, conn); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("Expected normal closure, got %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("Unexpected records after invalid messages")
+	}
+}
+
+func TestServerMessageLimit(t *testing.T) {
+	s := NewServer(SinkFunc(func(*Record) error { return nil }))
+	s.MaxMessageBytes = 8
+	conn := dialTestServer(t, s)
+	conn.WriteMessage(websocket.BinaryMessage, []byte("1234567890"))
+	if err := waitForClose(t, conn); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("Expected close for message too big, got %v", err)
+	}
+}
+
+func TestServerIdleTimeout(t *testing.T) {
+	s := NewServer(SinkFunc(func(*Record) error { return nil }))
+	s.IdleTimeout = 50 * time.Millisecond
+	conn := dialTestServer(t, s)
+	// The vehicle doesn't answer pings, so the server gives up on it.
+	if err := waitForClose(t, conn); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected server to close idle connection, got %v", err)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	s := NewServer(SinkFunc(func(*Record) error { return nil }))
+	conn := dialTestServer(t, s)
+	// The handshake completes before the server starts serving the connection.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		s.lock.Lock()
+		served := len(s.conns)
+		s.lock.Unlock()
+		if served == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Server didn't serve connection")
+		}
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %s", err)
+	}
+	if err := waitForClose(t, conn); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected vehicle to be told to reconnect later, got %v", err)
+	}
+	// Vehicles that connect after shutdown are turned away.
+	if err := waitForClose(t, dialTestServer(t, s)); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected new connection to be closed, got %v", err)
+	}
+}
+
+func TestServerRequiresClientCertificate(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	recorder := httptest.NewRecorder()
+	NewServer(SinkFunc(func(*Record) error { return nil })).ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", recorder.Code)
+	}
+}
@@ -118,15 +118,24 @@ func (v *Vehicle) ChargePortOpen(ctx context.Context) error {
 
 // OpenTonneau opens a Cybetruck's tonneau. Has no effect on other vehicles.
 func (v *Vehicle) OpenTonneau(ctx context.Context) error {
+	if err := v.CheckCapability(CapabilityTonneau); err != nil {
+		return err
+	}
 	return v.executeClosureAction(ctx, vcsec.ClosureMoveType_E_CLOSURE_MOVE_TYPE_OPEN, ClosureTonneau)
 }
 
 // CloseTonneau closes a Cybetruck's tonneau. Has no effect on other vehicles.
 func (v *Vehicle) CloseTonneau(ctx context.Context) error {
+	if err := v.CheckCapability(CapabilityTonneau); err != nil {
+		return err
+	}
 	return v.executeClosureAction(ctx, vcsec.ClosureMoveType_E_CLOSURE_MOVE_TYPE_CLOSE, ClosureTonneau)
 }
 
 // StopTonneau tells a Cybetruck to stop moving its tonneau. Has no effect on other vehicles.
 func (v *Vehicle) StopTonneau(ctx context.Context) error {
+	if err := v.CheckCapability(CapabilityTonneau); err != nil {
+		return err
+	}
 	return v.executeClosureAction(ctx, vcsec.ClosureMoveType_E_CLOSURE_MOVE_TYPE_STOP, ClosureTonneau)
 }
@@ -0,0 +1,35 @@
+package vehicle
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Benchmarks for command serialization. Signing is benchmarked in internal/authentication. Run with:
+//
+//	go test -run '^$' -bench . -benchmem ./pkg/vehicle
+
+func benchmarkSerialize(b *testing.B, fn func(*Vehicle) error) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		message, err := CaptureMessage("5YJ3E1EA7KF000001", fn)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := proto.Marshal(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSerializeInfotainmentCommand(b *testing.B) {
+	ctx := context.Background()
+	benchmarkSerialize(b, func(v *Vehicle) error { return v.ChangeChargeLimit(ctx, 80) })
+}
+
+func BenchmarkSerializeVCSECCommand(b *testing.B) {
+	ctx := context.Background()
+	benchmarkSerialize(b, func(v *Vehicle) error { return v.Lock(ctx) })
+}
@@ -0,0 +1,77 @@
+package vehicle
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+)
+
+// TestRestoreAfterCrash simulates a client that saves its sessions, sends a command, and is killed
+// before it can save them again. The next client restores the stale sessions.
+func TestRestoreAfterCrash(t *testing.T) {
+	tests := []struct {
+		name    string
+		margin  uint32
+		desyncs int
+	}{
+		{"default margin", cache.DefaultCounterMargin, 0},
+		{"no margin", 0, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sim := vehicletest.New("5YJ3E1EA7KF000001")
+			sim.Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+
+			sessions := cache.New(0)
+			sessions.CounterMargin = test.margin
+			car, err := NewVehicle(sim.Connect(), skey, sessions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := car.Connect(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := car.StartSession(ctx, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := car.UpdateCachedSessions(sessions); err != nil {
+				t.Fatal(err)
+			}
+			if err := car.Unlock(ctx); err != nil {
+				t.Fatal(err)
+			}
+			car.Disconnect()
+
+			car, err = NewVehicle(sim.Connect(), skey, sessions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := car.Connect(ctx); err != nil {
+				t.Fatal(err)
+			}
+			defer car.Disconnect()
+			if err := car.StartSession(ctx, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := car.Lock(ctx); err != nil {
+				t.Fatalf("Command failed after restoring sessions: %s", err)
+			}
+			if !sim.Locked() {
+				t.Errorf("Vehicle didn't lock")
+			}
+			if n := sim.Desyncs(); n != test.desyncs {
+				t.Errorf("Expected %d desyncs, got %d", test.desyncs, n)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package vehicle
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+// SupportsSignedCommands determines whether the vehicle accepts commands that use the end-to-end
+// signed command protocol. Vehicles that don't, such as older Model S and X, execute commands sent
+// to the legacy Fleet API REST endpoints instead.
+//
+// The probe asks VCSEC for session information about a throwaway public key, so it works with
+// any key (or none) and doesn't change the Vehicle's sessions. Over BLE, the answer is always
+// true. An error means the answer is unknown, for example because the vehicle is offline.
+func (v *Vehicle) SupportsSignedCommands(ctx context.Context) (bool, error) {
+	probeKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return false, err
+	}
+	_, err = v.SessionInfo(ctx, probeKey.PublicKey(), universal.Domain_DOMAIN_VEHICLE_SECURITY)
+	switch {
+	case err == nil, errors.Is(err, protocol.ErrKeyNotPaired):
+		// The vehicle doesn't recognize the throwaway key, but it understood the request.
+		return true, nil
+	case errors.Is(err, protocol.ErrProtocolNotSupported):
+		return false, nil
+	}
+	return false, err
+}
+
+// Capability names optional hardware that some commands require.
+type Capability string
+
+const (
+	// CapabilityTonneau is a powered tonneau cover (Cybertruck).
+	CapabilityTonneau Capability = "tonneau"
+	// CapabilityHEPAFilter is the HEPA cabin filter that Bioweapon Defense Mode uses.
+	CapabilityHEPAFilter Capability = "hepa_filter"
+	// CapabilitySeatCooling is ventilated front seats.
+	CapabilitySeatCooling Capability = "seat_cooling"
+)
+
+// CommandCapabilities maps the Fleet API name of each command that only applies to some vehicles
+// to the Capability it requires.
+var CommandCapabilities = map[string]Capability{
+	"close_tonneau":              CapabilityTonneau,
+	"open_tonneau":               CapabilityTonneau,
+	"stop_tonneau":               CapabilityTonneau,
+	"remote_seat_cooler_request": CapabilitySeatCooling,
+	"set_bioweapon_mode":         CapabilityHEPAFilter,
+}
+
+// Capabilities records whether a vehicle has each Capability. A Capability that's missing from
+// the map is unknown, and commands that require it are sent anyway.
+type Capabilities map[Capability]bool
+
+// ErrUnsupportedVehicle indicates that a command doesn't apply to the vehicle, for example because
+// it lacks the necessary hardware. Errors returned for this reason are UnsupportedVehicleErrors.
+var ErrUnsupportedVehicle = errors.New("vehicle does not support command")
+
+// UnsupportedVehicleError is returned, without contacting the vehicle, for commands that require a
+// Capability the vehicle doesn't have.
+type UnsupportedVehicleError struct {
+	Capability Capability
+}
+
+func (e *UnsupportedVehicleError) Error() string {
+	return fmt.Sprintf("this vehicle does not support %s", e.Capability)
+}
+
+func (e *UnsupportedVehicleError) Is(target error) bool {
+	return target == ErrUnsupportedVehicle
+}
+
+func (e *UnsupportedVehicleError) MayHaveSucceeded() bool {
+	return false
+}
+
+func (e *UnsupportedVehicleError) Temporary() bool {
+	return false
+}
+
+// CheckCapability returns an UnsupportedVehicleError if v.Capabilities reports that the vehicle
+// lacks capability. It returns nil if the vehicle has it, if it's unknown, or if
+// v.SkipCapabilityCheck is set.
+func (v *Vehicle) CheckCapability(capability Capability) error {
+	if v.SkipCapabilityCheck {
+		return nil
+	}
+	if supported, known := v.Capabilities[capability]; known && !supported {
+		return &UnsupportedVehicleError{Capability: capability}
+	}
+	return nil
+}
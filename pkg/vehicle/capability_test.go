@@ -0,0 +1,59 @@
+package vehicle
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+)
+
+func TestSupportsSignedCommands(t *testing.T) {
+	// The simulated vehicle doesn't know the probe's key, which still proves it speaks the protocol.
+	car := connectWithoutSession(t)
+	if supported, err := car.SupportsSignedCommands(context.Background()); err != nil || !supported {
+		t.Errorf("Expected signed commands to be supported, got %v (%v)", supported, err)
+	}
+
+	legacy, dispatch := newTestVehicle()
+	dispatch.SendError = protocol.ErrProtocolNotSupported
+	if supported, err := legacy.SupportsSignedCommands(context.Background()); err != nil || supported {
+		t.Errorf("Expected signed commands to be unsupported, got %v (%v)", supported, err)
+	}
+}
+
+func TestCheckCapability(t *testing.T) {
+	car, dispatch := newTestVehicle()
+	dispatch.SendError = errors.New("command sent")
+
+	// Unknown capabilities don't prevent commands from being sent.
+	if err := car.OpenTonneau(context.Background()); err != dispatch.SendError {
+		t.Errorf("Expected command to be sent, got %v", err)
+	}
+
+	car.Capabilities = Capabilities{CapabilityTonneau: false, CapabilitySeatCooling: true}
+	err := car.OpenTonneau(context.Background())
+	var unsupported *UnsupportedVehicleError
+	if !errors.As(err, &unsupported) || unsupported.Capability != CapabilityTonneau || !errors.Is(err, ErrUnsupportedVehicle) {
+		t.Errorf("Expected unsupported tonneau, got %v", err)
+	}
+	if err.Error() != "this vehicle does not support tonneau" {
+		t.Errorf("Unexpected error message: %s", err)
+	}
+	if err := car.SetSeatCooler(context.Background(), LevelLow, SeatFrontLeft); err != dispatch.SendError {
+		t.Errorf("Expected seat cooler command to be sent, got %v", err)
+	}
+
+	car.SkipCapabilityCheck = true
+	if err := car.OpenTonneau(context.Background()); err != dispatch.SendError {
+		t.Errorf("Expected check to be skipped, got %v", err)
+	}
+}
+
+func TestCommandCapabilitiesAreSigned(t *testing.T) {
+	for command := range CommandCapabilities {
+		if _, ok := CommandDomains[command]; !ok {
+			t.Errorf("%s requires a capability but isn't in CommandDomains", command)
+		}
+	}
+}
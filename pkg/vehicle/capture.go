@@ -0,0 +1,68 @@
+package vehicle
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/dispatcher"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+// errCaptured aborts a command after its first message has been captured.
+var errCaptured = errors.New("message captured")
+
+// captureSender is a sender that records the first message it's asked to send instead of
+// transmitting it.
+type captureSender struct {
+	message *universal.RoutableMessage
+}
+
+func (c *captureSender) Start(context.Context) error { return nil }
+func (c *captureSender) Stop()                       {}
+
+func (c *captureSender) Send(_ context.Context, message *universal.RoutableMessage, _ connector.AuthMethod) (protocol.Receiver, error) {
+	if c.message == nil {
+		c.message = message
+	}
+	return nil, errCaptured
+}
+
+func (c *captureSender) StartSessions(context.Context, []universal.Domain) error  { return nil }
+func (c *captureSender) ResyncSession(context.Context, universal.Domain) error    { return nil }
+func (c *captureSender) ResyncSessions(context.Context, []universal.Domain) error { return nil }
+func (c *captureSender) HasSession(universal.Domain) bool                         { return true }
+func (c *captureSender) Cache() []dispatcher.CacheEntry                           { return nil }
+func (c *captureSender) LoadCache([]dispatcher.CacheEntry, uint32) error          { return nil }
+func (c *captureSender) RetryInterval() time.Duration                             { return time.Second }
+func (c *captureSender) SetMaxLatency(time.Duration)                              {}
+
+// CaptureMessage invokes fn on an offline Vehicle and returns the first message fn attempts to
+// send, without connecting to anything. The message is unsigned: authentication is applied later
+// by the session layer, which requires a handshake with the vehicle.
+//
+// This is useful for inspecting the wire format of commands or for integrating with systems that
+// construct and sign messages separately. Commands that never reach the session layer, such as
+// those executed by Tesla's servers, return an error.
+func CaptureMessage(vin string, fn func(*Vehicle) error) (*universal.RoutableMessage, error) {
+	sender := &captureSender{}
+	v := &Vehicle{
+		Flags:      DefaultFlags,
+		dispatcher: sender,
+		vin:        vin,
+		clock:      clock.Real,
+		authMethod: connector.AuthMethodNone,
+	}
+	err := fn(v)
+	if sender.message != nil {
+		return sender.message, nil
+	}
+	if err == nil || errors.Is(err, errCaptured) {
+		return nil, errors.New("command did not produce a message")
+	}
+	return nil, err
+}
@@ -0,0 +1,37 @@
+package vehicle
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	carserver "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+func TestCaptureMessage(t *testing.T) {
+	ctx := context.Background()
+	message, err := CaptureMessage("5YJ3E1EA7KF000001", func(v *Vehicle) error {
+		return v.ChangeChargeLimit(ctx, 80)
+	})
+	if err != nil {
+		t.Fatalf("CaptureMessage failed: %s", err)
+	}
+	if domain := message.GetToDestination().GetDomain(); domain != universal.Domain_DOMAIN_INFOTAINMENT {
+		t.Errorf("Unexpected domain %s", domain)
+	}
+	var action carserver.Action
+	if err := proto.Unmarshal(message.GetProtobufMessageAsBytes(), &action); err != nil {
+		t.Fatalf("Couldn't decode payload: %s", err)
+	}
+	if percent := action.GetVehicleAction().GetChargingSetLimitAction().GetPercent(); percent != 80 {
+		t.Errorf("Expected charge limit 80, got %d", percent)
+	}
+}
+
+func TestCaptureMessageWithoutMessage(t *testing.T) {
+	if _, err := CaptureMessage("5YJ3E1EA7KF000001", func(*Vehicle) error { return nil }); err == nil {
+		t.Errorf("Expected error when no message is sent")
+	}
+}
@@ -5,6 +5,7 @@ package vehicle
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	carserver "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
@@ -18,6 +19,43 @@ const (
 	ChargingPolicyWeekdays
 )
 
+// ChargingScheduleMode selects how the vehicle decides when to start charging.
+type ChargingScheduleMode int
+
+const (
+	// ChargingScheduleOff disables scheduled charging and scheduled departure, so the vehicle
+	// charges as soon as it's plugged in.
+	ChargingScheduleOff ChargingScheduleMode = iota
+	// ChargingScheduleStartTime starts charging at a fixed time each day.
+	ChargingScheduleStartTime
+	// ChargingScheduleDeparture charges so that the vehicle is ready by a departure time.
+	ChargingScheduleDeparture
+)
+
+var chargingScheduleModeNames = map[ChargingScheduleMode]string{
+	ChargingScheduleOff:       "off",
+	ChargingScheduleStartTime: "start_time",
+	ChargingScheduleDeparture: "departure",
+}
+
+func (m ChargingScheduleMode) String() string {
+	if name, ok := chargingScheduleModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("ChargingScheduleMode(%d)", int(m))
+}
+
+// ParseChargingScheduleMode converts "off", "start_time", or "departure" into a
+// ChargingScheduleMode.
+func ParseChargingScheduleMode(name string) (ChargingScheduleMode, error) {
+	for mode, modeName := range chargingScheduleModeNames {
+		if strings.EqualFold(name, modeName) {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid charging schedule mode '%s' (expected off, start_time, or departure)", name)
+}
+
 type ChargeSchedule = carserver.ChargeSchedule
 
 type PreconditionSchedule = carserver.PreconditionSchedule
@@ -143,6 +181,8 @@ func (v *Vehicle) ChargeStop(ctx context.Context) error {
 		})
 }
 
+// ChargeMaxRange sets the charge limit to the vehicle's maximum range setting. If the limit is
+// already at that setting, the vehicle refuses the command; see [AlreadySet].
 func (v *Vehicle) ChargeMaxRange(ctx context.Context) error {
 	return v.executeCarServerAction(ctx,
 		&carserver.Action_VehicleAction{
@@ -158,6 +198,98 @@ func (v *Vehicle) ChargeMaxRange(ctx context.Context) error {
 		})
 }
 
+// ChargeLimit returns the vehicle's current charge limit, in percent. It's useful for reporting
+// the result of ChargeStandardRange and ChargeMaxRange, whose percentages vary by vehicle.
+func (v *Vehicle) ChargeLimit(ctx context.Context) (int32, error) {
+	data, err := v.GetState(ctx, StateCategoryCharge)
+	if err != nil {
+		return 0, err
+	}
+	state := data.GetChargeState()
+	if _, ok := state.GetOptionalChargeLimitSoc().(*carserver.ChargeState_ChargeLimitSoc); !ok {
+		return 0, ErrVehicleStateUnknown
+	}
+	return state.GetChargeLimitSoc(), nil
+}
+
+// KilometersPerMile converts the distances that vehicles report, which are always in miles, to
+// kilometers.
+const KilometersPerMile = 1.609344
+
+// ChargeStatus is a vehicle's battery and charging state.
+type ChargeStatus struct {
+	// ChargingState is one of "disconnected", "no_power", "starting", "charging", "complete",
+	// "stopped", "calibrating", or "unknown".
+	ChargingState string
+	// BatteryLevel is the state of charge in percent. UsableBatteryLevel excludes energy that
+	// the vehicle can't currently use, for example because the battery is cold.
+	BatteryLevel       int32
+	UsableBatteryLevel int32
+	// ChargeLimit is the state of charge, in percent, at which charging stops.
+	ChargeLimit int32
+	// RangeMiles is the rated range. EstimatedRangeMiles is based on recent driving.
+	RangeMiles          float64
+	EstimatedRangeMiles float64
+	// ChargerPowerKW is zero unless the vehicle is charging.
+	ChargerPowerKW float64
+	// TimeToFull is the vehicle's estimate of the time until it reaches ChargeLimit. It's zero
+	// unless the vehicle is charging.
+	TimeToFull time.Duration
+	// EnergyAddedKWh is the energy added during the current or most recent charging session.
+	EnergyAddedKWh float64
+}
+
+// chargingStateName returns the ChargeStatus.ChargingState of state.
+func chargingStateName(state *carserver.ChargeState_ChargingState) string {
+	switch state.GetType().(type) {
+	case *carserver.ChargeState_ChargingState_Disconnected:
+		return "disconnected"
+	case *carserver.ChargeState_ChargingState_NoPower:
+		return "no_power"
+	case *carserver.ChargeState_ChargingState_Starting:
+		return "starting"
+	case *carserver.ChargeState_ChargingState_Charging:
+		return "charging"
+	case *carserver.ChargeState_ChargingState_Complete:
+		return "complete"
+	case *carserver.ChargeState_ChargingState_Stopped:
+		return "stopped"
+	case *carserver.ChargeState_ChargingState_Calibrating:
+		return "calibrating"
+	}
+	return "unknown"
+}
+
+// ChargeStatus fetches the vehicle's battery and charging state. It returns
+// ErrVehicleStateUnknown if the vehicle doesn't report its battery level.
+func (v *Vehicle) ChargeStatus(ctx context.Context) (*ChargeStatus, error) {
+	data, err := v.GetState(ctx, StateCategoryCharge)
+	if err != nil {
+		return nil, err
+	}
+	state := data.GetChargeState()
+	if state.GetOptionalBatteryLevel() == nil {
+		return nil, ErrVehicleStateUnknown
+	}
+	status := &ChargeStatus{
+		ChargingState:       chargingStateName(state.GetChargingState()),
+		BatteryLevel:        state.GetBatteryLevel(),
+		UsableBatteryLevel:  state.GetUsableBatteryLevel(),
+		ChargeLimit:         state.GetChargeLimitSoc(),
+		RangeMiles:          float64(state.GetBatteryRange()),
+		EstimatedRangeMiles: float64(state.GetEstBatteryRange()),
+		EnergyAddedKWh:      float64(state.GetChargeEnergyAdded()),
+	}
+	if state.GetOptionalUsableBatteryLevel() == nil {
+		status.UsableBatteryLevel = status.BatteryLevel
+	}
+	if status.ChargingState == "charging" {
+		status.ChargerPowerKW = float64(state.GetChargerPower())
+		status.TimeToFull = time.Duration(state.GetMinutesToFullCharge()) * time.Minute
+	}
+	return status, nil
+}
+
 func (v *Vehicle) SetChargingAmps(ctx context.Context, amps int32) error {
 	return v.executeCarServerAction(ctx,
 		&carserver.Action_VehicleAction{
@@ -172,6 +304,8 @@ func (v *Vehicle) SetChargingAmps(ctx context.Context, amps int32) error {
 
 }
 
+// ChargeStandardRange sets the charge limit to the vehicle's recommended daily setting. As with
+// ChargeMaxRange, the vehicle refuses the command if the limit is already at that setting.
 func (v *Vehicle) ChargeStandardRange(ctx context.Context) error {
 	return v.executeCarServerAction(ctx,
 		&carserver.Action_VehicleAction{
@@ -298,6 +432,128 @@ func (v *Vehicle) ClearScheduledDeparture(ctx context.Context) error {
 		})
 }
 
+// ChargingScheduleModeError is returned by SetChargingScheduleMode when the vehicle accepted the
+// first of the commands that change its mode but not a later one. The vehicle is then in neither
+// the previous mode nor the requested one, and retrying the request is safe.
+type ChargingScheduleModeError struct {
+	// Applied describes the change the vehicle made, such as "disabled scheduled charging".
+	Applied string
+	// Failed describes the change the vehicle didn't make.
+	Failed string
+	Err    error
+}
+
+func (e *ChargingScheduleModeError) Error() string {
+	return fmt.Sprintf("%s, but couldn't %s: %s", e.Applied, e.Failed, e.Err)
+}
+
+func (e *ChargingScheduleModeError) Unwrap() error {
+	return e.Err
+}
+
+// SetChargingScheduleMode switches the vehicle between charging on plug-in, charging at a daily
+// start time, and charging for a departure time. The value of timeAfterMidnight is the start time
+// or departure time, respectively, and is ignored when mode is ChargingScheduleOff.
+//
+// Departure-based scheduling is enabled without preconditioning or off-peak charging; use
+// ScheduleDeparture to configure those.
+//
+// ChargingScheduleOff takes two commands, which disable scheduled charging and then scheduled
+// departure. A vehicle that reports that either one is already disabled (see AlreadySet) is
+// treated as having disabled it. If the first command fails, the vehicle's settings are
+// unchanged and its error is returned. If the second fails, the error is a
+// *ChargingScheduleModeError.
+func (v *Vehicle) SetChargingScheduleMode(ctx context.Context, mode ChargingScheduleMode, timeAfterMidnight time.Duration) error {
+	if mode != ChargingScheduleOff && (timeAfterMidnight < 0 || timeAfterMidnight >= 24*time.Hour) {
+		return fmt.Errorf("invalid time after midnight: %s", timeAfterMidnight)
+	}
+	switch mode {
+	case ChargingScheduleOff:
+		if err := v.ScheduleCharging(ctx, false, 0); err != nil {
+			if _, ok := AlreadySet(err); !ok {
+				return err
+			}
+		}
+		if err := v.ClearScheduledDeparture(ctx); err != nil {
+			if _, ok := AlreadySet(err); !ok {
+				return &ChargingScheduleModeError{
+					Applied: "disabled scheduled charging",
+					Failed:  "disable scheduled departure",
+					Err:     err,
+				}
+			}
+		}
+		return nil
+	case ChargingScheduleStartTime:
+		return v.ScheduleCharging(ctx, true, timeAfterMidnight)
+	case ChargingScheduleDeparture:
+		return v.ScheduleDeparture(ctx, timeAfterMidnight, 0, ChargingPolicyOff, ChargingPolicyOff)
+	}
+	return fmt.Errorf("invalid charging schedule mode %s", mode)
+}
+
+// OffPeakChargingSettings describe when the vehicle charges during off-peak hours. Off-peak
+// charging is part of scheduled departure: the vehicle charges as much as it can before the
+// off-peak period ends and finishes charging by the departure time.
+type OffPeakChargingSettings struct {
+	Enabled bool
+	// WeekdaysOnly restricts off-peak charging to Monday through Friday.
+	WeekdaysOnly bool
+	// EndTime is the end of the off-peak period, relative to midnight.
+	EndTime time.Duration
+}
+
+// OffPeakCharging returns the vehicle's off-peak charging settings.
+func (v *Vehicle) OffPeakCharging(ctx context.Context) (*OffPeakChargingSettings, error) {
+	data, err := v.GetState(ctx, StateCategoryCharge)
+	if err != nil {
+		return nil, err
+	}
+	state := data.GetChargeState()
+	times := state.GetOffPeakChargingTimes()
+	return &OffPeakChargingSettings{
+		Enabled:      times.GetTimes() != nil,
+		WeekdaysOnly: times.GetWeekdays() != nil,
+		EndTime:      time.Duration(state.GetOffPeakHoursEndTime()) * time.Minute,
+	}, nil
+}
+
+// SetOffPeakCharging changes the vehicle's off-peak charging settings without changing its
+// departure time or preconditioning settings. Since the vehicle only charges off-peak when
+// scheduled departure is enabled, enabling off-peak charging also enables scheduled departure,
+// using the departure time the vehicle last reported.
+func (v *Vehicle) SetOffPeakCharging(ctx context.Context, settings OffPeakChargingSettings) error {
+	if settings.EndTime < 0 || settings.EndTime >= 24*time.Hour {
+		return fmt.Errorf("invalid off-peak end time: %s", settings.EndTime)
+	}
+	data, err := v.GetState(ctx, StateCategoryCharge)
+	if err != nil {
+		return err
+	}
+	state := data.GetChargeState()
+	departing := state.GetScheduledChargingMode() == carserver.ChargeState_ScheduledChargingModeDepartBy
+	if !departing && !settings.Enabled {
+		// Off-peak charging is already inactive.
+		return nil
+	}
+
+	offPeak := ChargingPolicyOff
+	if settings.Enabled {
+		offPeak = ChargingPolicyAllDays
+		if settings.WeekdaysOnly {
+			offPeak = ChargingPolicyWeekdays
+		}
+	}
+	preconditioning := ChargingPolicyOff
+	if times := state.GetPreconditioningTimes(); times.GetWeekdays() != nil {
+		preconditioning = ChargingPolicyWeekdays
+	} else if times.GetAllWeek() != nil {
+		preconditioning = ChargingPolicyAllDays
+	}
+	departAt := time.Duration(state.GetScheduledDepartureTimeMinutes()) * time.Minute
+	return v.ScheduleDeparture(ctx, departAt, settings.EndTime, preconditioning, offPeak)
+}
+
 // SetLowPowerMode enables or disables low power mode, which reduces battery consumption. If the
 // vehicle is forced to be in lower power mode due to low battery, this will return a
 // low_power_mode_enforced error.
@@ -0,0 +1,230 @@
+package vehicle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	carserver "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+func TestParseChargingScheduleMode(t *testing.T) {
+	for _, mode := range []ChargingScheduleMode{ChargingScheduleOff, ChargingScheduleStartTime, ChargingScheduleDeparture} {
+		parsed, err := ParseChargingScheduleMode(mode.String())
+		if err != nil || parsed != mode {
+			t.Errorf("Round trip of %s produced %s (%v)", mode, parsed, err)
+		}
+	}
+	if _, err := ParseChargingScheduleMode("weekly"); err == nil {
+		t.Errorf("Expected error for invalid mode")
+	}
+}
+
+func TestChargeStandardRangeAlreadySet(t *testing.T) {
+	car, sim := connectSimulatedVehicle(t)
+	ctx := context.Background()
+	if err := car.ChargeStandardRange(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := AlreadySet(nil); ok {
+		t.Errorf("nil error reported as already set")
+	}
+
+	sim.RejectCommands("already_standard")
+	err := car.ChargeStandardRange(ctx)
+	if reason, ok := AlreadySet(err); !ok || reason != "already_standard" {
+		t.Errorf("Expected already_standard, got %q (%v)", reason, err)
+	}
+	// Reasons are matched exactly, not by prefix.
+	for _, reason := range []string{"not_charging", "already_charging_elsewhere"} {
+		sim.RejectCommands(reason)
+		err := car.ChargeStandardRange(ctx)
+		if _, ok := AlreadySet(err); ok {
+			t.Errorf("Unrelated failure %q reported as already set", reason)
+		}
+		var refusedErr *RefusedError
+		if !errors.As(err, &refusedErr) || refusedErr.Reason != reason || !protocol.IsNominalError(err) {
+			t.Errorf("Expected %q refusal, got %v", reason, err)
+		}
+	}
+}
+
+func TestSetChargingScheduleMode(t *testing.T) {
+	ctx := context.Background()
+	message, err := CaptureMessage("5YJ3E1EA7KF000001", func(v *Vehicle) error {
+		return v.SetChargingScheduleMode(ctx, ChargingScheduleDeparture, 7*time.Hour+30*time.Minute)
+	})
+	if err != nil {
+		t.Fatalf("CaptureMessage failed: %s", err)
+	}
+	var action carserver.Action
+	if err := proto.Unmarshal(message.GetProtobufMessageAsBytes(), &action); err != nil {
+		t.Fatalf("Couldn't decode payload: %s", err)
+	}
+	departure := action.GetVehicleAction().GetScheduledDepartureAction()
+	if !departure.GetEnabled() || departure.GetDepartureTime() != 450 {
+		t.Errorf("Unexpected departure action: %v", departure)
+	}
+
+	_, err = CaptureMessage("5YJ3E1EA7KF000001", func(v *Vehicle) error {
+		return v.SetChargingScheduleMode(ctx, ChargingScheduleStartTime, 24*time.Hour)
+	})
+	if err == nil {
+		t.Errorf("Expected error for start time outside of day")
+	}
+}
+
+// vehicleActions decodes the infotainment actions that sim executed after the first skip commands.
+func vehicleActions(t *testing.T, sim *vehicletest.Vehicle, skip int) []*carserver.VehicleAction {
+	t.Helper()
+	var actions []*carserver.VehicleAction
+	for _, command := range sim.Commands()[skip:] {
+		var action carserver.Action
+		if err := proto.Unmarshal(command.Payload, &action); err != nil {
+			t.Fatalf("Couldn't decode command: %s", err)
+		}
+		actions = append(actions, action.GetVehicleAction())
+	}
+	return actions
+}
+
+func TestChargingScheduleModes(t *testing.T) {
+	car, sim := connectSimulatedVehicle(t)
+	ctx := context.Background()
+	set := func(mode ChargingScheduleMode, timeAfterMidnight time.Duration) ([]*carserver.VehicleAction, error) {
+		skip := len(sim.Commands())
+		err := car.SetChargingScheduleMode(ctx, mode, timeAfterMidnight)
+		return vehicleActions(t, sim, skip), err
+	}
+
+	actions, err := set(ChargingScheduleStartTime, 2*time.Hour+30*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || !actions[0].GetScheduledChargingAction().GetEnabled() ||
+		actions[0].GetScheduledChargingAction().GetChargingTime() != 150 {
+		t.Errorf("Unexpected start time actions: %v", actions)
+	}
+
+	actions, err = set(ChargingScheduleDeparture, 7*time.Hour+30*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || !actions[0].GetScheduledDepartureAction().GetEnabled() ||
+		actions[0].GetScheduledDepartureAction().GetDepartureTime() != 450 {
+		t.Errorf("Unexpected departure actions: %v", actions)
+	}
+
+	// Turning scheduling off disables scheduled charging, then scheduled departure.
+	actions, err = set(ChargingScheduleOff, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0].GetScheduledChargingAction() == nil || actions[0].GetScheduledChargingAction().GetEnabled() ||
+		actions[1].GetScheduledDepartureAction() == nil || actions[1].GetScheduledDepartureAction().GetEnabled() {
+		t.Errorf("Unexpected off actions: %v", actions)
+	}
+	if sim.ScheduledDeparture().GetEnabled() {
+		t.Errorf("Scheduled departure wasn't disabled")
+	}
+
+	// Settings that are already off don't count as failures.
+	sim.RejectActions("already_disabled", func(*carserver.VehicleAction) bool { return true })
+	if _, err = set(ChargingScheduleOff, 0); err != nil {
+		t.Errorf("Expected settings that were already off to succeed, got %s", err)
+	}
+
+	// If the first step fails, nothing changes and the second step isn't attempted.
+	sim.RejectActions("busy", func(action *carserver.VehicleAction) bool {
+		return action.GetScheduledChargingAction() != nil
+	})
+	actions, err = set(ChargingScheduleOff, 0)
+	var modeErr *ChargingScheduleModeError
+	if err == nil || errors.As(err, &modeErr) || len(actions) != 1 {
+		t.Errorf("Expected first step to fail alone, got %v after %d actions", err, len(actions))
+	}
+
+	// If the second step fails, the error says which change was made.
+	sim.RejectActions("busy", func(action *carserver.VehicleAction) bool {
+		return action.GetScheduledDepartureAction() != nil
+	})
+	_, err = set(ChargingScheduleOff, 0)
+	if !errors.As(err, &modeErr) || modeErr.Applied != "disabled scheduled charging" || !protocol.IsNominalError(err) {
+		t.Errorf("Expected ChargingScheduleModeError, got %v", err)
+	}
+}
+
+func TestSetOffPeakCharging(t *testing.T) {
+	car, sim := connectSimulatedVehicle(t)
+	ctx := context.Background()
+	if err := car.ScheduleDeparture(ctx, 7*time.Hour+30*time.Minute, 0, ChargingPolicyWeekdays, ChargingPolicyOff); err != nil {
+		t.Fatal(err)
+	}
+
+	want := OffPeakChargingSettings{Enabled: true, WeekdaysOnly: true, EndTime: 6 * time.Hour}
+	if err := car.SetOffPeakCharging(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	departure := sim.ScheduledDeparture()
+	if departure.GetDepartureTime() != 450 || departure.GetPreconditioningTimes().GetWeekdays() == nil {
+		t.Errorf("Departure settings weren't preserved: %v", departure)
+	}
+	if settings, err := car.OffPeakCharging(ctx); err != nil || *settings != want {
+		t.Errorf("Expected %+v, got %+v (%v)", want, settings, err)
+	}
+
+	if err := car.SetOffPeakCharging(ctx, OffPeakChargingSettings{EndTime: 6 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if departure = sim.ScheduledDeparture(); !departure.GetEnabled() || departure.GetOffPeakChargingTimes() != nil {
+		t.Errorf("Expected off-peak charging to be disabled: %v", departure)
+	}
+
+	commands := len(sim.Commands())
+	if err := car.SetOffPeakCharging(ctx, OffPeakChargingSettings{Enabled: true, EndTime: 24 * time.Hour}); err == nil {
+		t.Errorf("Expected error for end time outside of day")
+	}
+	if len(sim.Commands()) != commands {
+		t.Errorf("Invalid settings were sent to the vehicle")
+	}
+}
+
+func TestChargeStatus(t *testing.T) {
+	car, sim := connectSimulatedVehicle(t)
+	ctx := context.Background()
+
+	if _, err := car.ChargeStatus(ctx); !errors.Is(err, ErrVehicleStateUnknown) {
+		t.Errorf("Expected ErrVehicleStateUnknown before the vehicle reports a battery level, got %v", err)
+	}
+
+	sim.SetChargeState(&carserver.ChargeState{
+		ChargingState: &carserver.ChargeState_ChargingState{
+			Type: &carserver.ChargeState_ChargingState_Charging{Charging: &carserver.Void{}},
+		},
+		OptionalBatteryLevel:        &carserver.ChargeState_BatteryLevel{BatteryLevel: 62},
+		OptionalBatteryRange:        &carserver.ChargeState_BatteryRange{BatteryRange: 200},
+		OptionalChargerPower:        &carserver.ChargeState_ChargerPower{ChargerPower: 11},
+		OptionalMinutesToFullCharge: &carserver.ChargeState_MinutesToFullCharge{MinutesToFullCharge: 95},
+	})
+	status, err := car.ChargeStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ChargeStatus{
+		ChargingState:      "charging",
+		BatteryLevel:       62,
+		UsableBatteryLevel: 62,
+		ChargeLimit:        sim.ChargeLimit(),
+		RangeMiles:         200,
+		ChargerPowerKW:     11,
+		TimeToFull:         95 * time.Minute,
+	}
+	if *status != want {
+		t.Errorf("Expected %+v, got %+v", want, *status)
+	}
+}
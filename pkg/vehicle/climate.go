@@ -2,6 +2,7 @@ package vehicle
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	carserver "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
@@ -9,6 +10,9 @@ import (
 
 // SetSeatCooler sets seat cooling level.
 func (v *Vehicle) SetSeatCooler(ctx context.Context, level Level, seat SeatPosition) error {
+	if err := v.CheckCapability(CapabilitySeatCooling); err != nil {
+		return err
+	}
 	// The protobuf index starts at 0 for unknown, we want to start with 0 for off
 	seatMap := map[SeatPosition]carserver.HvacSeatCoolerActions_HvacSeatCoolerPosition_E{
 		SeatFrontLeft:  carserver.HvacSeatCoolerActions_HvacSeatCoolerPosition_FrontLeft,
@@ -85,6 +89,107 @@ func (v *Vehicle) AutoSeatAndClimate(ctx context.Context, positions []SeatPositi
 		})
 }
 
+// ErrTemperatureOutOfRange indicates a requested cabin temperature is outside the range the
+// vehicle supports.
+var ErrTemperatureOutOfRange = errors.New("temperature out of range")
+
+// FahrenheitToCelsius converts a temperature from degrees Fahrenheit to degrees Celsius.
+func FahrenheitToCelsius(fahrenheit float32) float32 {
+	return (fahrenheit - 32) * 5 / 9
+}
+
+// CelsiusToFahrenheit converts a temperature from degrees Celsius to degrees Fahrenheit.
+func CelsiusToFahrenheit(celsius float32) float32 {
+	return celsius*9/5 + 32
+}
+
+// TemperatureSettings describes the cabin temperature setpoints of each climate zone.
+type TemperatureSettings struct {
+	DriverCelsius    float32
+	PassengerCelsius float32
+	// MinCelsius and MaxCelsius are the range of setpoints the vehicle accepts. They are zero if the
+	// vehicle doesn't report its range.
+	MinCelsius float32
+	MaxCelsius float32
+}
+
+// TemperatureSettings fetches the vehicle's cabin temperature setpoints.
+func (v *Vehicle) TemperatureSettings(ctx context.Context) (*TemperatureSettings, error) {
+	data, err := v.GetState(ctx, StateCategoryClimate)
+	if err != nil {
+		return nil, err
+	}
+	state := data.GetClimateState()
+	_, hasDriver := state.GetOptionalDriverTempSetting().(*carserver.ClimateState_DriverTempSetting)
+	_, hasPassenger := state.GetOptionalPassengerTempSetting().(*carserver.ClimateState_PassengerTempSetting)
+	if !hasDriver || !hasPassenger {
+		return nil, ErrVehicleStateUnknown
+	}
+	settings := &TemperatureSettings{
+		DriverCelsius:    state.GetDriverTempSetting(),
+		PassengerCelsius: state.GetPassengerTempSetting(),
+	}
+	_, hasMin := state.GetOptionalMinAvailTempCelsius().(*carserver.ClimateState_MinAvailTempCelsius)
+	_, hasMax := state.GetOptionalMaxAvailTempCelsius().(*carserver.ClimateState_MaxAvailTempCelsius)
+	if hasMin && hasMax {
+		settings.MinCelsius = state.GetMinAvailTempCelsius()
+		settings.MaxCelsius = state.GetMaxAvailTempCelsius()
+	}
+	return settings, nil
+}
+
+// checkRange returns an error wrapping ErrTemperatureOutOfRange if celsius is outside the range in
+// s. Any temperature is accepted if the range is unknown.
+func (s *TemperatureSettings) checkRange(zone string, celsius float32) error {
+	if s.MinCelsius == 0 && s.MaxCelsius == 0 {
+		return nil
+	}
+	if celsius < s.MinCelsius || celsius > s.MaxCelsius {
+		return fmt.Errorf("%w: %s temperature %.1f°C is outside of %.1f°C to %.1f°C",
+			ErrTemperatureOutOfRange, zone, celsius, s.MinCelsius, s.MaxCelsius)
+	}
+	return nil
+}
+
+// SetTemperatures sets independent driver and passenger setpoints. Unlike ChangeClimateTemp, it
+// rejects temperatures outside the range the vehicle reports, and returns the setpoints that are
+// in effect afterwards. These can differ from the requested temperatures, for example because
+// the vehicle rounds them to its display resolution. If the setpoints can't be read after the
+// command succeeds, the requested temperatures are returned.
+func (v *Vehicle) SetTemperatures(ctx context.Context, driverCelsius, passengerCelsius float32) (*TemperatureSettings, error) {
+	current, err := v.TemperatureSettings(ctx)
+	if err != nil && !errors.Is(err, ErrVehicleStateUnknown) {
+		return nil, err
+	}
+	if current != nil {
+		if err := current.checkRange("driver", driverCelsius); err != nil {
+			return nil, err
+		}
+		if err := current.checkRange("passenger", passengerCelsius); err != nil {
+			return nil, err
+		}
+	}
+	if err := v.ChangeClimateTemp(ctx, driverCelsius, passengerCelsius); err != nil {
+		return nil, err
+	}
+	updated, err := v.TemperatureSettings(ctx)
+	if err != nil {
+		// The command succeeded, so don't report an error that would prompt the caller to retry it.
+		updated = &TemperatureSettings{DriverCelsius: driverCelsius, PassengerCelsius: passengerCelsius}
+		if current != nil {
+			updated.MinCelsius, updated.MaxCelsius = current.MinCelsius, current.MaxCelsius
+		}
+	}
+	return updated, nil
+}
+
+// SetTemperaturesFahrenheit is like SetTemperatures, but takes temperatures in degrees Fahrenheit.
+// The returned settings are in Celsius.
+func (v *Vehicle) SetTemperaturesFahrenheit(ctx context.Context, driverFahrenheit, passengerFahrenheit float32) (*TemperatureSettings, error) {
+	return v.SetTemperatures(ctx, FahrenheitToCelsius(driverFahrenheit), FahrenheitToCelsius(passengerFahrenheit))
+}
+
+// ChangeClimateTemp sets the driver and passenger temperature setpoints, in degrees Celsius.
 func (v *Vehicle) ChangeClimateTemp(ctx context.Context, driverCelsius float32, passengerCelsius float32) error {
 	return v.executeCarServerAction(ctx,
 		&carserver.Action_VehicleAction{
@@ -205,7 +310,77 @@ func (v *Vehicle) SetPreconditioningMax(ctx context.Context, enabled bool, manua
 		})
 }
 
+// SetMaxDefrost turns Max Defrost on or off. Max Defrost runs the climate system at maximum
+// heat and fan speed with the air directed at the windshield.
+func (v *Vehicle) SetMaxDefrost(ctx context.Context, on bool) error {
+	return v.SetPreconditioningMax(ctx, on, false)
+}
+
+// PreconditionOptions selects the optional steps of [Vehicle.Precondition].
+type PreconditionOptions struct {
+	// SeatHeaters sets the heater level of each listed seat.
+	SeatHeaters map[SeatPosition]Level
+	// MaxDefrost turns on Max Defrost.
+	MaxDefrost bool
+	// SteeringWheelHeater turns on the steering wheel heater.
+	SteeringWheelHeater bool
+}
+
+// Names of [PreconditionStep]s.
+const (
+	PreconditionStepClimate             = "climate"
+	PreconditionStepMaxDefrost          = "max_defrost"
+	PreconditionStepSeatHeaters         = "seat_heaters"
+	PreconditionStepSteeringWheelHeater = "steering_wheel_heater"
+)
+
+// PreconditionStep records the outcome of one step of [Vehicle.Precondition].
+type PreconditionStep struct {
+	Name string
+	Err  error // Nil if the step succeeded
+}
+
+// Precondition turns on climate control and then applies the optional settings in opts, using
+// the vehicle's existing connection and session for every step. It's intended for "warm up the
+// car" shortcuts.
+//
+// If climate control can't be turned on, Precondition returns an error without attempting the
+// other steps. Otherwise it attempts every requested step and reports each outcome in the
+// returned slice, in order, so that a rejected seat heater setting (for example) doesn't hide the
+// steps that succeeded.
+func (v *Vehicle) Precondition(ctx context.Context, opts *PreconditionOptions) ([]PreconditionStep, error) {
+	if err := v.ClimateOn(ctx); err != nil {
+		return nil, err
+	}
+	steps := []PreconditionStep{{Name: PreconditionStepClimate}}
+	if opts == nil {
+		return steps, nil
+	}
+	if opts.MaxDefrost {
+		steps = append(steps, PreconditionStep{
+			Name: PreconditionStepMaxDefrost,
+			Err:  v.SetMaxDefrost(ctx, true),
+		})
+	}
+	if len(opts.SeatHeaters) > 0 {
+		steps = append(steps, PreconditionStep{
+			Name: PreconditionStepSeatHeaters,
+			Err:  v.SetSeatHeater(ctx, opts.SeatHeaters),
+		})
+	}
+	if opts.SteeringWheelHeater {
+		steps = append(steps, PreconditionStep{
+			Name: PreconditionStepSteeringWheelHeater,
+			Err:  v.SetSteeringWheelHeater(ctx, true),
+		})
+	}
+	return steps, nil
+}
+
 func (v *Vehicle) SetBioweaponDefenseMode(ctx context.Context, enabled bool, manualOverride bool) error {
+	if err := v.CheckCapability(CapabilityHEPAFilter); err != nil {
+		return err
+	}
 	return v.executeCarServerAction(ctx,
 		&carserver.Action_VehicleAction{
 			VehicleAction: &carserver.VehicleAction{
@@ -234,6 +409,29 @@ func (v *Vehicle) SetCabinOverheatProtection(ctx context.Context, enabled bool,
 		})
 }
 
+// CabinOverheatProtectionMode selects whether Cabin Overheat Protection runs and whether it uses
+// the air conditioning.
+type CabinOverheatProtectionMode = carserver.ClimateState_CabinOverheatProtection_E
+
+const (
+	CabinOverheatProtectionOff = carserver.ClimateState_CabinOverheatProtectionOff
+	CabinOverheatProtectionOn  = carserver.ClimateState_CabinOverheatProtectionOn
+	// CabinOverheatProtectionFanOnly runs the fan without air conditioning. The Tesla app labels
+	// this mode "No A/C". Vehicles that don't support it reject the command.
+	CabinOverheatProtectionFanOnly = carserver.ClimateState_CabinOverheatProtectionFanOnly
+)
+
+// SetCabinOverheatProtectionMode is equivalent to [Vehicle.SetCabinOverheatProtection] but takes a
+// single mode.
+func (v *Vehicle) SetCabinOverheatProtectionMode(ctx context.Context, mode CabinOverheatProtectionMode) error {
+	switch mode {
+	case CabinOverheatProtectionOff, CabinOverheatProtectionOn, CabinOverheatProtectionFanOnly:
+	default:
+		return fmt.Errorf("invalid Cabin Overheat Protection mode %d", mode)
+	}
+	return v.SetCabinOverheatProtection(ctx, mode != CabinOverheatProtectionOff, mode == CabinOverheatProtectionFanOnly)
+}
+
 func (v *Vehicle) SetCabinOverheatProtectionTemperature(ctx context.Context, level Level) error {
 	return v.executeCarServerAction(ctx,
 		&carserver.Action_VehicleAction{
@@ -0,0 +1,82 @@
+package vehicle
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+)
+
+// connectSimulatedVehicle returns a Vehicle with an authenticated session to an in-memory vehicle.
+func connectSimulatedVehicle(t *testing.T) (*Vehicle, *vehicletest.Vehicle) {
+	t.Helper()
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := vehicletest.New("5YJ3E1EA7KF000001")
+	sim.Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+	car, err := NewVehicle(sim.Connect(), skey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := car.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(car.Disconnect)
+	if err := car.StartSession(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	return car, sim
+}
+
+func TestPrecondition(t *testing.T) {
+	car, sim := connectSimulatedVehicle(t)
+	steps, err := car.Precondition(context.Background(), &PreconditionOptions{
+		MaxDefrost:          true,
+		SteeringWheelHeater: true,
+		// The simulated vehicle doesn't have a third row.
+		SeatHeaters: map[SeatPosition]Level{SeatThirdRowLeft: LevelHigh},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		PreconditionStepClimate,
+		PreconditionStepMaxDefrost,
+		PreconditionStepSeatHeaters,
+		PreconditionStepSteeringWheelHeater,
+	}
+	if len(steps) != len(want) {
+		t.Fatalf("Expected steps %v, got %+v", want, steps)
+	}
+	for i, step := range steps {
+		if step.Name != want[i] {
+			t.Errorf("Step %d: expected %s, got %s", i, want[i], step.Name)
+		}
+		if failed := step.Err != nil; failed != (step.Name == PreconditionStepSeatHeaters) {
+			t.Errorf("Step %s: unexpected error %v", step.Name, step.Err)
+		}
+	}
+	if !sim.ClimateOn() || !sim.MaxDefrost() {
+		t.Errorf("Expected climate and Max Defrost to be on")
+	}
+}
+
+func TestPreconditionClimateOnly(t *testing.T) {
+	car, sim := connectSimulatedVehicle(t)
+	steps, err := car.Precondition(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || steps[0].Name != PreconditionStepClimate || !sim.ClimateOn() || sim.MaxDefrost() {
+		t.Errorf("Unexpected result %+v", steps)
+	}
+	if err := car.SetMaxDefrost(context.Background(), true); err != nil || !sim.MaxDefrost() {
+		t.Errorf("Expected Max Defrost to be on (%v)", err)
+	}
+}
@@ -0,0 +1,148 @@
+package vehicle
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+// CommandDomains maps the Fleet API name of each command that this package signs to the vehicle
+// domain that executes it, and therefore the domain that [Vehicle.StartSession] must include for
+// the command to succeed. The HTTP proxy and tesla-control take the domains in their command
+// catalogs from this table. Commands that Tesla's servers execute aren't listed.
+var CommandDomains = map[string]universal.Domain{
+	// Vehicle security controller (VCSEC)
+	"actuate_trunk":      universal.Domain_DOMAIN_VEHICLE_SECURITY,
+	"close_tonneau":      universal.Domain_DOMAIN_VEHICLE_SECURITY,
+	"door_lock":          universal.Domain_DOMAIN_VEHICLE_SECURITY,
+	"door_unlock":        universal.Domain_DOMAIN_VEHICLE_SECURITY,
+	"open_tonneau":       universal.Domain_DOMAIN_VEHICLE_SECURITY,
+	"remote_start_drive": universal.Domain_DOMAIN_VEHICLE_SECURITY,
+	"stop_tonneau":       universal.Domain_DOMAIN_VEHICLE_SECURITY,
+
+	// Infotainment
+	"add_charge_schedule":                  universal.Domain_DOMAIN_INFOTAINMENT,
+	"add_precondition_schedule":            universal.Domain_DOMAIN_INFOTAINMENT,
+	"adjust_volume":                        universal.Domain_DOMAIN_INFOTAINMENT,
+	"auto_conditioning_start":              universal.Domain_DOMAIN_INFOTAINMENT,
+	"auto_conditioning_stop":               universal.Domain_DOMAIN_INFOTAINMENT,
+	"cancel_software_update":               universal.Domain_DOMAIN_INFOTAINMENT,
+	"charge_max_range":                     universal.Domain_DOMAIN_INFOTAINMENT,
+	"charge_port_door_close":               universal.Domain_DOMAIN_INFOTAINMENT,
+	"charge_port_door_open":                universal.Domain_DOMAIN_INFOTAINMENT,
+	"charge_standard":                      universal.Domain_DOMAIN_INFOTAINMENT,
+	"charge_start":                         universal.Domain_DOMAIN_INFOTAINMENT,
+	"charge_stop":                          universal.Domain_DOMAIN_INFOTAINMENT,
+	"clear_pin_to_drive_admin":             universal.Domain_DOMAIN_INFOTAINMENT,
+	"erase_user_data":                      universal.Domain_DOMAIN_INFOTAINMENT,
+	"flash_lights":                         universal.Domain_DOMAIN_INFOTAINMENT,
+	"get_charge_state":                     universal.Domain_DOMAIN_INFOTAINMENT,
+	"get_location":                         universal.Domain_DOMAIN_INFOTAINMENT,
+	"get_off_peak_charging":                universal.Domain_DOMAIN_INFOTAINMENT,
+	"guest_mode":                           universal.Domain_DOMAIN_INFOTAINMENT,
+	"honk_horn":                            universal.Domain_DOMAIN_INFOTAINMENT,
+	"media_next_fav":                       universal.Domain_DOMAIN_INFOTAINMENT,
+	"media_next_track":                     universal.Domain_DOMAIN_INFOTAINMENT,
+	"media_prev_fav":                       universal.Domain_DOMAIN_INFOTAINMENT,
+	"media_prev_track":                     universal.Domain_DOMAIN_INFOTAINMENT,
+	"media_toggle_playback":                universal.Domain_DOMAIN_INFOTAINMENT,
+	"media_volume_down":                    universal.Domain_DOMAIN_INFOTAINMENT,
+	"media_volume_up":                      universal.Domain_DOMAIN_INFOTAINMENT,
+	"remote_auto_seat_climate_request":     universal.Domain_DOMAIN_INFOTAINMENT,
+	"remote_boombox":                       universal.Domain_DOMAIN_INFOTAINMENT,
+	"remote_seat_cooler_request":           universal.Domain_DOMAIN_INFOTAINMENT,
+	"remote_seat_heater_request":           universal.Domain_DOMAIN_INFOTAINMENT,
+	"remote_steering_wheel_heater_request": universal.Domain_DOMAIN_INFOTAINMENT,
+	"remove_charge_schedule":               universal.Domain_DOMAIN_INFOTAINMENT,
+	"remove_precondition_schedule":         universal.Domain_DOMAIN_INFOTAINMENT,
+	"reset_pin_to_drive_pin":               universal.Domain_DOMAIN_INFOTAINMENT,
+	"reset_valet_pin":                      universal.Domain_DOMAIN_INFOTAINMENT,
+	"schedule_software_update":             universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_bioweapon_mode":                   universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_cabin_overheat_protection":        universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_charge_limit":                     universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_charging_amps":                    universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_charging_schedule_mode":           universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_climate_keeper_mode":              universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_cop_temp":                         universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_low_power_mode":                   universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_off_peak_charging":                universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_pin_to_drive":                     universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_preconditioning_max":              universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_scheduled_charging":               universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_scheduled_departure":              universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_sentry_mode":                      universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_temps":                            universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_valet_mode":                       universal.Domain_DOMAIN_INFOTAINMENT,
+	"set_vehicle_name":                     universal.Domain_DOMAIN_INFOTAINMENT,
+	"speed_limit_activate":                 universal.Domain_DOMAIN_INFOTAINMENT,
+	"speed_limit_clear_pin":                universal.Domain_DOMAIN_INFOTAINMENT,
+	"speed_limit_clear_pin_admin":          universal.Domain_DOMAIN_INFOTAINMENT,
+	"speed_limit_deactivate":               universal.Domain_DOMAIN_INFOTAINMENT,
+	"speed_limit_set_limit":                universal.Domain_DOMAIN_INFOTAINMENT,
+	"trigger_homelink":                     universal.Domain_DOMAIN_INFOTAINMENT,
+	"window_control":                       universal.Domain_DOMAIN_INFOTAINMENT,
+}
+
+// SessionError indicates that a command was addressed to a domain without a session, and the
+// Vehicle isn't allowed to establish one. It wraps [protocol.ErrNoSession].
+type SessionError struct {
+	// Domain is the domain that lacks a session.
+	Domain universal.Domain
+	// Started is true if StartSession was called, but without Domain.
+	Started bool
+}
+
+func (e *SessionError) Error() string {
+	if e.Started {
+		return fmt.Sprintf("command requires a %s session, but the domains passed to StartSession don't include it", e.Domain)
+	}
+	return fmt.Sprintf("command requires a %s session; call StartSession first", e.Domain)
+}
+
+func (e *SessionError) Unwrap() error {
+	return protocol.ErrNoSession
+}
+
+func (e *SessionError) MayHaveSucceeded() bool {
+	return false
+}
+
+func (e *SessionError) Temporary() bool {
+	return false
+}
+
+// sessionPermitted returns true if the domains passed to StartSession include domain.
+func (v *Vehicle) sessionPermitted(domain universal.Domain) (started, permitted bool) {
+	v.sessionLock.Lock()
+	defer v.sessionLock.Unlock()
+	if !v.sessionsStarted {
+		return false, false
+	}
+	if v.sessionDomains == nil {
+		return true, true
+	}
+	for _, d := range v.sessionDomains {
+		if d == domain {
+			return true, true
+		}
+	}
+	return true, false
+}
+
+// ensureSession checks that domain has a session before a command is sent to it, performing the
+// handshake if StartSession deferred it or the session was lost.
+func (v *Vehicle) ensureSession(ctx context.Context, domain universal.Domain) error {
+	if v.dispatcher.HasSession(domain) {
+		return nil
+	}
+	started, permitted := v.sessionPermitted(domain)
+	if !permitted {
+		return &SessionError{Domain: domain, Started: started}
+	}
+	log.Debug("Starting %s session on demand", domain)
+	return v.startSessions(ctx, []universal.Domain{domain})
+}
@@ -0,0 +1,82 @@
+package vehicle
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/internal/authentication"
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
+
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+// connectWithoutSession returns a Vehicle connected to a simulated vehicle on which StartSession
+// hasn't been called.
+func connectWithoutSession(t *testing.T) *Vehicle {
+	t.Helper()
+	skey, err := authentication.NewECDHPrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := vehicletest.New("5YJ3E1EA7KF000001")
+	sim.Pair(skey.PublicBytes(), keys.Role_ROLE_OWNER)
+	car, err := NewVehicle(sim.Connect(), skey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := car.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(car.Disconnect)
+	return car
+}
+
+func TestMissingSession(t *testing.T) {
+	car := connectWithoutSession(t)
+	ctx := context.Background()
+
+	var sessionErr *SessionError
+	if err := car.FlashLights(ctx); !errors.As(err, &sessionErr) || sessionErr.Started {
+		t.Fatalf("Expected SessionError before StartSession, got %v", err)
+	}
+
+	if err := car.StartSession(ctx, []universal.Domain{universal.Domain_DOMAIN_VEHICLE_SECURITY}); err != nil {
+		t.Fatal(err)
+	}
+	err := car.FlashLights(ctx)
+	if !errors.As(err, &sessionErr) || !sessionErr.Started || sessionErr.Domain != universal.Domain_DOMAIN_INFOTAINMENT {
+		t.Fatalf("Expected SessionError naming infotainment, got %v", err)
+	}
+	if !errors.Is(err, protocol.ErrNoSession) || protocol.ShouldRetry(err) {
+		t.Errorf("SessionError is misclassified: %v", err)
+	}
+	if err := car.Lock(ctx); err != nil {
+		t.Errorf("VCSEC command failed: %s", err)
+	}
+}
+
+func TestLazySessions(t *testing.T) {
+	car := connectWithoutSession(t)
+	car.LazySessions = true
+	ctx := context.Background()
+
+	if err := car.StartSession(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if car.dispatcher.HasSession(universal.Domain_DOMAIN_INFOTAINMENT) {
+		t.Fatalf("StartSession performed a handshake")
+	}
+	if err := car.FlashLights(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !car.dispatcher.HasSession(universal.Domain_DOMAIN_INFOTAINMENT) {
+		t.Errorf("Infotainment session wasn't established")
+	}
+	if car.dispatcher.HasSession(universal.Domain_DOMAIN_VEHICLE_SECURITY) {
+		t.Errorf("VCSEC session was established without a VCSEC command")
+	}
+}
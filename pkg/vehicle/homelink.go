@@ -0,0 +1,66 @@
+package vehicle
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+// ErrNoHomelink indicates the vehicle doesn't report HomeLink state, which is the case for vehicles
+// without a HomeLink module.
+var ErrNoHomelink = errors.New("vehicle has no HomeLink module")
+
+// HomelinkDevice describes a HomeLink device location that the vehicle considers in range.
+//
+// The vehicle protocol doesn't expose the names or locations of programmed HomeLink devices; it only
+// reports whether one is nearby. The device's location is therefore the one the client asked
+// about, and Distance is the distance in meters, rounded to the nearest meter, from the vehicle's current
+// location to it.
+type HomelinkDevice struct {
+	Latitude  float32 `json:"latitude"`
+	Longitude float32 `json:"longitude"`
+	Distance  float64 `json:"distance_meters"`
+}
+
+// NearbyHomelinkDevices checks whether the vehicle considers a HomeLink device at (latitude,
+// longitude) to be in range, which is a prerequisite for [Vehicle.TriggerHomelink].
+//
+// The result is empty if the vehicle has a HomeLink module but no device is nearby. If the vehicle
+// has no HomeLink module, the method returns ErrNoHomelink.
+func (v *Vehicle) NearbyHomelinkDevices(ctx context.Context, latitude, longitude float32) ([]HomelinkDevice, error) {
+	data, err := v.GetState(ctx, StateCategoryLocation)
+	if err != nil {
+		return nil, err
+	}
+	return nearbyHomelinkDevices(data.GetLocationState(), latitude, longitude)
+}
+
+func nearbyHomelinkDevices(location *carserver.LocationState, latitude, longitude float32) ([]HomelinkDevice, error) {
+	if _, ok := location.GetOptionalHomelinkNearby().(*carserver.LocationState_HomelinkNearby); !ok {
+		return nil, ErrNoHomelink
+	}
+	devices := []HomelinkDevice{}
+	if location.GetHomelinkNearby() {
+		devices = append(devices, HomelinkDevice{
+			Latitude:  latitude,
+			Longitude: longitude,
+			Distance:  math.Round(distanceMeters(location.GetLatitude(), location.GetLongitude(), latitude, longitude)),
+		})
+	}
+	return devices, nil
+}
+
+// earthRadiusMeters is the mean radius of the Earth.
+const earthRadiusMeters = 6371000
+
+// distanceMeters returns the great-circle distance between two points using the haversine formula.
+func distanceMeters(lat1, lon1, lat2, lon2 float32) float64 {
+	toRadians := func(degrees float32) float64 { return float64(degrees) * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
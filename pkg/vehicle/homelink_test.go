@@ -0,0 +1,47 @@
+package vehicle
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+)
+
+func TestNearbyHomelinkDevices(t *testing.T) {
+	location := &carserver.LocationState{
+		OptionalLatitude:       &carserver.LocationState_Latitude{Latitude: 37.4925},
+		OptionalLongitude:      &carserver.LocationState_Longitude{Longitude: -121.9447},
+		OptionalHomelinkNearby: &carserver.LocationState_HomelinkNearby{HomelinkNearby: true},
+	}
+	devices, err := nearbyHomelinkDevices(location, 37.4935, -121.9447)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("Expected one device, got %v", devices)
+	}
+	// 0.001 degrees of latitude is about 111 meters.
+	if math.Abs(devices[0].Distance-111) > 1 {
+		t.Errorf("Unexpected distance %f", devices[0].Distance)
+	}
+
+	location.OptionalHomelinkNearby = &carserver.LocationState_HomelinkNearby{HomelinkNearby: false}
+	devices, err = nearbyHomelinkDevices(location, 37.4935, -121.9447)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devices == nil || len(devices) != 0 {
+		t.Errorf("Expected empty list, got %v", devices)
+	}
+}
+
+func TestNearbyHomelinkDevicesWithoutHomelink(t *testing.T) {
+	location := &carserver.LocationState{
+		OptionalLatitude:  &carserver.LocationState_Latitude{Latitude: 37.4925},
+		OptionalLongitude: &carserver.LocationState_Longitude{Longitude: -121.9447},
+	}
+	if _, err := nearbyHomelinkDevices(location, 37.4935, -121.9447); !errors.Is(err, ErrNoHomelink) {
+		t.Errorf("Expected ErrNoHomelink, got %v", err)
+	}
+}
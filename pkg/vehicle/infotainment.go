@@ -6,6 +6,7 @@ package vehicle
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -39,11 +40,49 @@ func (v *Vehicle) getCarServerResponse(ctx context.Context, action *carserver.Ac
 		if description == "" {
 			description = "unspecified error"
 		}
-		return nil, &protocol.NominalError{Details: protocol.NewError("car could not execute command: "+description, false, false)}
+		return nil, &protocol.NominalError{Details: &protocol.CommandError{Err: &RefusedError{Reason: description}}}
 	}
 	return &response, nil
 }
 
+// nominalErrorPrefix precedes the vehicle's description of why it refused an infotainment command.
+const nominalErrorPrefix = "car could not execute command: "
+
+// RefusedError holds the reason the vehicle gave for refusing an infotainment command, such as
+// "already_standard" or "not_charging". Errors returned by commands wrap it in a
+// [protocol.NominalError].
+type RefusedError struct {
+	Reason string
+}
+
+func (e *RefusedError) Error() string {
+	return nominalErrorPrefix + e.Reason
+}
+
+// alreadySetReasons are the reasons vehicles give for refusing a command that requests the state
+// they're already in.
+var alreadySetReasons = map[string]bool{
+	"already_set":       true,
+	"already_standard":  true,
+	"already_max_range": true,
+	"already_enabled":   true,
+	"already_disabled":  true,
+	"already_on":        true,
+	"already_off":       true,
+}
+
+// AlreadySet returns the vehicle's reason and true if err only indicates that the vehicle was
+// already in the state a command requested, as when [Vehicle.ChargeStandardRange] is sent to a
+// vehicle whose charge limit is already the standard setting. Callers can usually treat such
+// errors as success.
+func AlreadySet(err error) (string, bool) {
+	var refusedErr *RefusedError
+	if !errors.As(err, &refusedErr) || !alreadySetReasons[refusedErr.Reason] {
+		return "", false
+	}
+	return refusedErr.Reason, true
+}
+
 func (v *Vehicle) executeCarServerAction(ctx context.Context, action *carserver.Action_VehicleAction) error {
 	_, err := v.getCarServerResponse(ctx, action)
 	return err
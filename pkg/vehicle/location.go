@@ -0,0 +1,68 @@
+package vehicle
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLocationUnavailable indicates the vehicle didn't report its GPS position, which can happen
+// shortly after it wakes up or if location services are disabled.
+var ErrLocationUnavailable = errors.New("vehicle did not report its location")
+
+// Location is a vehicle's GPS position.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	// Heading is the direction of travel in degrees clockwise from north, or nil if unknown.
+	Heading *float64
+	// Speed is in miles per hour, or nil if unknown. The vehicle may not report a speed while it's
+	// parked.
+	Speed *float64
+	// Timestamp is when the vehicle acquired the position. It's zero if the vehicle didn't say.
+	Timestamp time.Time
+}
+
+// Location fetches the vehicle's GPS position. Speed is read separately from the drive state; if
+// that fails, the position is still returned without a speed.
+func (v *Vehicle) Location(ctx context.Context) (*Location, error) {
+	data, err := v.GetState(ctx, StateCategoryLocation)
+	if err != nil {
+		return nil, err
+	}
+	state := data.GetLocationState()
+	if state.GetOptionalLatitude() == nil || state.GetOptionalLongitude() == nil {
+		return nil, ErrLocationUnavailable
+	}
+	location := &Location{
+		Latitude:  float64(state.GetLatitude()),
+		Longitude: float64(state.GetLongitude()),
+	}
+	if state.GetOptionalHeading() != nil {
+		heading := float64(state.GetHeading())
+		location.Heading = &heading
+	}
+	if state.GetOptionalGpsAsOf() != nil {
+		location.Timestamp = time.Unix(int64(state.GetGpsAsOf()), 0)
+	} else if state.GetTimestamp() != nil {
+		location.Timestamp = state.GetTimestamp().AsTime()
+	}
+
+	drive, err := v.GetState(ctx, StateCategoryDrive)
+	if err != nil {
+		log.Warning("Couldn't read vehicle speed: %s", err)
+		return location, nil
+	}
+	driveState := drive.GetDriveState()
+	var speed float64
+	switch {
+	case driveState.GetOptionalSpeedFloat() != nil:
+		speed = float64(driveState.GetSpeedFloat())
+	case driveState.GetOptionalSpeed() != nil:
+		speed = float64(driveState.GetSpeed())
+	default:
+		return location, nil
+	}
+	location.Speed = &speed
+	return location, nil
+}
@@ -0,0 +1,34 @@
+package vehicle
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLocation(t *testing.T) {
+	car, sim := connectSimulatedVehicle(t)
+	ctx := context.Background()
+
+	if _, err := car.Location(ctx); !errors.Is(err, ErrLocationUnavailable) {
+		t.Errorf("Expected ErrLocationUnavailable before the vehicle has a position, got %v", err)
+	}
+
+	sim.SetLocation(37.5, -122.25, 90, 30)
+	location, err := car.Location(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Latitude != 37.5 || location.Longitude != -122.25 {
+		t.Errorf("Unexpected position %f, %f", location.Latitude, location.Longitude)
+	}
+	if location.Heading == nil || *location.Heading != 90 {
+		t.Errorf("Unexpected heading %v", location.Heading)
+	}
+	if location.Speed == nil || *location.Speed != 30 {
+		t.Errorf("Unexpected speed %v", location.Speed)
+	}
+	if location.Timestamp.IsZero() {
+		t.Errorf("Missing timestamp")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 	carserver "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
+	verror "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/errors"
 	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/keys"
 	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
 )
@@ -92,6 +93,15 @@ func (v *Vehicle) ResetPIN(ctx context.Context) error {
 		})
 }
 
+// Speed Limit Mode accepts maximum speeds in this range, in miles per hour.
+const (
+	MinSpeedLimitMPH = 50
+	MaxSpeedLimitMPH = 120
+)
+
+// ActivateSpeedLimit limits the vehicle's maximum speed. If Speed Limit Mode doesn't have a PIN
+// yet, speedLimitPin becomes its PIN; otherwise it must match. The vehicle rejects the command if
+// the PIN is wrong.
 func (v *Vehicle) ActivateSpeedLimit(ctx context.Context, speedLimitPin string) error {
 	return v.executeCarServerAction(ctx,
 		&carserver.Action_VehicleAction{
@@ -106,6 +116,8 @@ func (v *Vehicle) ActivateSpeedLimit(ctx context.Context, speedLimitPin string)
 		})
 }
 
+// DeactivateSpeedLimit turns off Speed Limit Mode. The vehicle rejects the command if
+// speedLimitPin is wrong.
 func (v *Vehicle) DeactivateSpeedLimit(ctx context.Context, speedLimitPin string) error {
 	return v.executeCarServerAction(ctx,
 		&carserver.Action_VehicleAction{
@@ -120,6 +132,8 @@ func (v *Vehicle) DeactivateSpeedLimit(ctx context.Context, speedLimitPin string
 		})
 }
 
+// ClearSpeedLimitPINAdminAction clears the Speed Limit Mode PIN without requiring it. Only fleet
+// manager keys can authorize it.
 func (v *Vehicle) ClearSpeedLimitPINAdminAction(ctx context.Context) error {
 	return v.executeCarServerAction(ctx,
 		&carserver.Action_VehicleAction{
@@ -131,6 +145,8 @@ func (v *Vehicle) ClearSpeedLimitPINAdminAction(ctx context.Context) error {
 		})
 }
 
+// SpeedLimitSetLimitMPH sets the maximum speed enforced by Speed Limit Mode, which must be between
+// MinSpeedLimitMPH and MaxSpeedLimitMPH.
 func (v *Vehicle) SpeedLimitSetLimitMPH(ctx context.Context, speedLimitMPH float64) error {
 	return v.executeCarServerAction(ctx,
 		&carserver.Action_VehicleAction{
@@ -144,6 +160,8 @@ func (v *Vehicle) SpeedLimitSetLimitMPH(ctx context.Context, speedLimitMPH float
 		})
 }
 
+// ClearSpeedLimitPIN clears the Speed Limit Mode PIN, which also deactivates Speed Limit Mode. To
+// change the PIN, clear it and then call ActivateSpeedLimit with the new one.
 func (v *Vehicle) ClearSpeedLimitPIN(ctx context.Context, speedLimitPin string) error {
 	return v.executeCarServerAction(ctx,
 		&carserver.Action_VehicleAction{
@@ -303,6 +321,20 @@ func (v *Vehicle) KeyInfoBySlot(ctx context.Context, slot uint32) (*vcsec.Whitel
 	return reply.GetWhitelistEntryInfo(), err
 }
 
+// KeyInfoByPublicKey fetches the whitelist entry, including the role, of the key with the provided
+// uncompressed NIST P-256 public key. This is useful for checking which commands a key can
+// authorize without trying them.
+func (v *Vehicle) KeyInfoByPublicKey(ctx context.Context, publicKey []byte) (*vcsec.WhitelistEntryInfo, error) {
+	reply, err := v.sendVCSECInformationRequest(ctx, &vcsec.InformationRequest{
+		InformationRequestType: vcsec.InformationRequestType_INFORMATION_REQUEST_TYPE_GET_WHITELIST_ENTRY_INFO,
+		Key:                    &vcsec.InformationRequest_PublicKey{PublicKey: publicKey},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.GetWhitelistEntryInfo(), err
+}
+
 func (v *Vehicle) Lock(ctx context.Context) error {
 	return v.executeRKEAction(ctx, vcsec.RKEAction_E_RKE_ACTION_LOCK)
 }
@@ -311,6 +343,29 @@ func (v *Vehicle) Unlock(ctx context.Context) error {
 	return v.executeRKEAction(ctx, vcsec.RKEAction_E_RKE_ACTION_UNLOCK)
 }
 
+// InMotion returns true if err indicates that the vehicle refused a command, such as
+// [Vehicle.Unlock], because it isn't in park.
+func InMotion(err error) bool {
+	var vcsecErr *protocol.NominalVCSECError
+	return errors.As(err, &vcsecErr) &&
+		vcsecErr.Details.GetGenericError() == verror.GenericError_E_GENERICERROR_VEHICLE_NOT_IN_PARK
+}
+
+// Locked returns true if the vehicle's doors are locked. Selective unlock (for example, of only
+// the driver's door) counts as unlocked. Like [Vehicle.BodyControllerState], this works over BLE
+// even when infotainment is asleep.
+func (v *Vehicle) Locked(ctx context.Context) (bool, error) {
+	status, err := v.BodyControllerState(ctx)
+	if err != nil {
+		return false, err
+	}
+	switch status.GetVehicleLockState() {
+	case vcsec.VehicleLockState_E_VEHICLELOCKSTATE_LOCKED, vcsec.VehicleLockState_E_VEHICLELOCKSTATE_INTERNAL_LOCKED:
+		return true, nil
+	}
+	return false, nil
+}
+
 // SendAddKeyRequest sends an add-key request to the vehicle over BLE. The user must approve the
 // request by tapping their NFC card on the center console and then confirming their intent on the
 // vehicle UI.
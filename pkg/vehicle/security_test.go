@@ -1,7 +1,11 @@
 package vehicle
 
 import (
+	"errors"
 	"testing"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	verror "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/errors"
 )
 
 func TestValidPIN(t *testing.T) {
@@ -28,3 +32,20 @@ func TestValidPIN(t *testing.T) {
 		}
 	}
 }
+
+func TestInMotion(t *testing.T) {
+	notInPark := &protocol.NominalError{Details: &protocol.NominalVCSECError{
+		Details: &verror.NominalError{GenericError: verror.GenericError_E_GENERICERROR_VEHICLE_NOT_IN_PARK},
+	}}
+	if !InMotion(notInPark) {
+		t.Error("Expected VEHICLE_NOT_IN_PARK to indicate motion")
+	}
+	closuresOpen := &protocol.NominalError{Details: &protocol.NominalVCSECError{
+		Details: &verror.NominalError{GenericError: verror.GenericError_E_GENERICERROR_CLOSURES_OPEN},
+	}}
+	for _, err := range []error{nil, closuresOpen, errors.New("vehicle not in park")} {
+		if InMotion(err) {
+			t.Errorf("Unexpected motion for %v", err)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package vehicle
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/signatures"
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+// SessionDetails describes the session state that a vehicle domain reports for a public key.
+type SessionDetails struct {
+	Domain string `json:"domain"`
+	// Status is SESSION_INFO_STATUS_KEY_NOT_ON_WHITELIST if the domain doesn't recognize the key.
+	Status string `json:"status"`
+	// Epoch identifies the domain's current anti-replay epoch. It changes when the domain restarts.
+	Epoch   string `json:"epoch"`
+	Counter uint32 `json:"counter"`
+	// ClockTime is the domain's clock, in seconds since the start of Epoch.
+	ClockTime uint32 `json:"clock_time"`
+	// PublicKey is the domain's public key, hex-encoded in uncompressed form.
+	PublicKey string `json:"public_key"`
+	Handle    uint32 `json:"handle,omitempty"`
+	// ReceivedAt is the client's time when the reply arrived.
+	ReceivedAt time.Time `json:"received_at"`
+	// ClockOffset is how far the client's clock for Epoch, which determines when signed commands
+	// expire, is ahead of the domain's clock, in seconds. It's nil unless the client has a session
+	// with the domain in the same epoch. Offsets of more than a few seconds cause commands to be
+	// rejected as expired.
+	ClockOffset *int64 `json:"clock_offset,omitempty"`
+	// SessionCounter is the anti-replay counter of the client's session, if it has one in Epoch.
+	SessionCounter *uint32 `json:"session_counter,omitempty"`
+}
+
+// SessionDetails requests the session info that domain holds for the client's public key, and
+// compares it against the client's session with domain, if there is one. The request isn't signed
+// and the reply isn't authenticated, so this works even when signed commands are failing, but the
+// result should only be used for diagnostics.
+func (v *Vehicle) SessionDetails(ctx context.Context, domain universal.Domain) (*SessionDetails, error) {
+	if !v.keyAvailable {
+		return nil, protocol.ErrRequiresKey
+	}
+	info, err := v.sessionInfo(ctx, v.publicKey, domain)
+	if err != nil {
+		return nil, err
+	}
+	details := &SessionDetails{
+		Domain:     domain.String(),
+		Status:     info.GetStatus().String(),
+		Epoch:      hex.EncodeToString(info.GetEpoch()),
+		Counter:    info.GetCounter(),
+		ClockTime:  info.GetClockTime(),
+		PublicKey:  hex.EncodeToString(info.GetPublicKey()),
+		Handle:     info.GetHandle(),
+		ReceivedAt: time.Now(),
+	}
+	if local := v.localSessionInfo(domain); local != nil && bytes.Equal(local.GetEpoch(), info.GetEpoch()) {
+		offset := int64(local.GetClockTime()) - int64(info.GetClockTime())
+		counter := local.GetCounter()
+		details.ClockOffset = &offset
+		details.SessionCounter = &counter
+	}
+	return details, nil
+}
+
+// ClockOffsetDuration returns ClockOffset as a time.Duration, and false if it's unknown.
+func (s *SessionDetails) ClockOffsetDuration() (time.Duration, bool) {
+	if s.ClockOffset == nil {
+		return 0, false
+	}
+	return time.Duration(*s.ClockOffset) * time.Second, true
+}
+
+// localSessionInfo returns the client's current state for its session with domain, or nil if it
+// has none.
+func (v *Vehicle) localSessionInfo(domain universal.Domain) *signatures.SessionInfo {
+	for _, entry := range v.dispatcher.Cache() {
+		if universal.Domain(entry.Domain) != domain {
+			continue
+		}
+		var info signatures.SessionInfo
+		if err := proto.Unmarshal(entry.SessionInfo, &info); err != nil {
+			return nil
+		}
+		return &info
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package vehicle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/internal/vehicletest"
+	"github.com/teslamotors/vehicle-command/pkg/protocol"
+
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+func TestSessionDetails(t *testing.T) {
+	car := connectWithoutSession(t)
+	ctx := context.Background()
+	vcsec := universal.Domain_DOMAIN_VEHICLE_SECURITY
+
+	details, err := car.SessionDetails(ctx, vcsec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Status != "SESSION_INFO_STATUS_OK" || details.Epoch == "" || len(details.PublicKey) != 130 {
+		t.Errorf("Unexpected session details %+v", details)
+	}
+	if _, ok := details.ClockOffsetDuration(); ok || details.SessionCounter != nil {
+		t.Errorf("Clock offset reported without a session")
+	}
+
+	if err := car.StartSession(ctx, []universal.Domain{vcsec}); err != nil {
+		t.Fatal(err)
+	}
+	if err := car.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if details, err = car.SessionDetails(ctx, vcsec); err != nil {
+		t.Fatal(err)
+	}
+	offset, ok := details.ClockOffsetDuration()
+	if !ok || offset < -time.Second || offset > time.Second {
+		t.Errorf("Unexpected clock offset %v (known: %v)", offset, ok)
+	}
+	if details.SessionCounter == nil || *details.SessionCounter != details.Counter {
+		t.Errorf("Session counter doesn't match vehicle counter: %+v", details)
+	}
+}
+
+func TestSessionDetailsRequiresKey(t *testing.T) {
+	sim := vehicletest.New("5YJ3E1EA7KF000001")
+	car, err := NewVehicle(sim.Connect(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := car.SessionDetails(context.Background(), universal.Domain_DOMAIN_VEHICLE_SECURITY); !errors.Is(err, protocol.ErrRequiresKey) {
+		t.Errorf("Expected ErrRequiresKey, got %v", err)
+	}
+}
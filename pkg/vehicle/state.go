@@ -3,6 +3,11 @@ package vehicle
 import (
 	"context"
 	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector"
 
 	carserver "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/carserver"
 	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
@@ -18,6 +23,21 @@ func (v *Vehicle) BodyControllerState(ctx context.Context) (*vcsec.VehicleStatus
 	return reply.GetVehicleStatus(), nil
 }
 
+// IsAwake returns true if the vehicle is awake. It never wakes the vehicle: over the Internet, the
+// answer comes from Tesla's servers (see [connector.SleepStateReporter]); over BLE, it's the sleep
+// status reported by the vehicle's security controller, which stays reachable while the rest of
+// the vehicle sleeps.
+func (v *Vehicle) IsAwake(ctx context.Context) (bool, error) {
+	if reporter, ok := v.conn.(connector.SleepStateReporter); ok {
+		return reporter.IsAwake(ctx)
+	}
+	status, err := v.BodyControllerState(ctx)
+	if err != nil {
+		return false, err
+	}
+	return status.GetVehicleSleepStatus() == vcsec.VehicleSleepStatus_E_VEHICLE_SLEEP_STATUS_AWAKE, nil
+}
+
 type StateCategory int32
 
 const (
@@ -85,3 +105,76 @@ func (v *Vehicle) GetState(ctx context.Context, category StateCategory) (*carser
 	}
 	return rsp.GetVehicleData(), nil
 }
+
+// StateOptions control how [Vehicle.GetStateWithOptions] reads vehicle state.
+type StateOptions struct {
+	// MaxStaleness is the age of the oldest data the caller accepts. If the vehicle reports data
+	// that's older, typically because it has been asleep, it's woken up and queried again. Zero
+	// accepts data of any age.
+	MaxStaleness time.Duration
+}
+
+// State is vehicle data along with the time the vehicle last updated it.
+type State struct {
+	Data *carserver.VehicleData
+	// Timestamp is the oldest timestamp of the categories in Data. It's zero if the vehicle didn't
+	// report one.
+	Timestamp time.Time
+}
+
+// Age returns how long ago the vehicle updated the data, or zero if the timestamp is unknown.
+func (s *State) Age() time.Duration {
+	if s.Timestamp.IsZero() {
+		return 0
+	}
+	return time.Since(s.Timestamp)
+}
+
+// GetStateWithOptions is like GetState, but also reports when the vehicle last updated the data and
+// can wake the vehicle to refresh data that's too old.
+func (v *Vehicle) GetStateWithOptions(ctx context.Context, category StateCategory, options StateOptions) (*State, error) {
+	data, err := v.GetState(ctx, category)
+	if err != nil {
+		return nil, err
+	}
+	state := &State{Data: data, Timestamp: dataTimestamp(data)}
+	if options.MaxStaleness <= 0 || state.Age() <= options.MaxStaleness {
+		return state, nil
+	}
+	log.Debug("Vehicle data is %s old; waking vehicle to refresh it", state.Age().Round(time.Second))
+	if err := v.Wakeup(ctx); err != nil {
+		return nil, err
+	}
+	if data, err = v.GetState(ctx, category); err != nil {
+		return nil, err
+	}
+	return &State{Data: data, Timestamp: dataTimestamp(data)}, nil
+}
+
+// dataTimestamp returns the oldest timestamp of the categories in data.
+func dataTimestamp(data *carserver.VehicleData) time.Time {
+	var oldest time.Time
+	for _, category := range []interface{ GetTimestamp() *timestamppb.Timestamp }{
+		data.GetChargeState(),
+		data.GetClimateState(),
+		data.GetDriveState(),
+		data.GetLocationState(),
+		data.GetClosuresState(),
+		data.GetChargeScheduleState(),
+		data.GetPreconditioningScheduleState(),
+		data.GetTirePressureState(),
+		data.GetMediaState(),
+		data.GetMediaDetailState(),
+		data.GetSoftwareUpdateState(),
+		data.GetParentalControlsState(),
+	} {
+		timestamp := category.GetTimestamp()
+		if timestamp == nil {
+			continue
+		}
+		if t := timestamp.AsTime(); oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	return oldest
+}
@@ -0,0 +1,73 @@
+package vehicle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetStateWithOptions(t *testing.T) {
+	car, sim := connectSimulatedVehicle(t)
+	ctx := context.Background()
+
+	sim.SetStateAge(time.Hour)
+	state, err := car.GetStateWithOptions(ctx, StateCategoryCharge, StateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age := state.Age(); age < time.Hour || age > time.Hour+time.Minute {
+		t.Errorf("Expected data to be an hour old, got %s", age)
+	}
+	if state.Data.GetChargeState().GetChargeLimitSoc() == 0 {
+		t.Errorf("Missing charge state: %v", state.Data)
+	}
+
+	commands := len(sim.Commands())
+	state, err = car.GetStateWithOptions(ctx, StateCategoryCharge, StateOptions{MaxStaleness: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age := state.Age(); age > time.Minute {
+		t.Errorf("Stale data wasn't refreshed: %s old", age)
+	}
+	// Wake up, then query again.
+	if got := len(sim.Commands()) - commands; got != 3 {
+		t.Errorf("Expected 3 commands, vehicle received %d", got)
+	}
+}
+
+func TestStateAgeUnknown(t *testing.T) {
+	state := &State{}
+	if state.Age() != 0 {
+		t.Errorf("Expected zero age when timestamp is unknown")
+	}
+}
+
+func TestIsAwake(t *testing.T) {
+	car, sim := connectSimulatedVehicle(t)
+	ctx := context.Background()
+
+	if awake, err := car.IsAwake(ctx); err != nil || !awake {
+		t.Fatalf("Expected vehicle to be awake (err = %v)", err)
+	}
+	if err := car.Wakeup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sim.Wakes() != 0 {
+		t.Errorf("Wakeup sent a wake command to an awake vehicle")
+	}
+
+	sim.SetAsleep(true)
+	if awake, err := car.IsAwake(ctx); err != nil || awake {
+		t.Fatalf("Expected vehicle to be asleep (err = %v)", err)
+	}
+	if sim.Wakes() != 0 {
+		t.Errorf("IsAwake woke the vehicle")
+	}
+	if err := car.Wakeup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if sim.Wakes() != 1 {
+		t.Errorf("Expected one wake command, got %d", sim.Wakes())
+	}
+}
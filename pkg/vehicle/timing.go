@@ -0,0 +1,36 @@
+package vehicle
+
+import (
+	"context"
+	"time"
+
+	"github.com/teslamotors/vehicle-command/pkg/connector"
+)
+
+// Timing breaks down where the time spent on a command went. See [WithTiming].
+type Timing = connector.Timing
+
+// WithTiming returns a copy of ctx that records a breakdown of the time spent on Vehicle methods
+// called with it, from connecting through handshakes, signing, round trips, and retries. Read the
+// Timing after those methods return:
+//
+//	ctx, timing := vehicle.WithTiming(ctx)
+//	err := car.Lock(ctx)
+//	fmt.Println(timing)
+func WithTiming(ctx context.Context) (context.Context, *Timing) {
+	return connector.WithTiming(ctx)
+}
+
+// recordPhase adds the time since start to the Timing field selected by phase, if ctx came from
+// WithTiming.
+func recordPhase(ctx context.Context, start time.Time, phase func(t *Timing) *time.Duration) {
+	connector.RecordTiming(ctx, func(t *Timing) { *phase(t) += time.Since(start) })
+}
+
+// recordRetry counts a retransmission that waited since start.
+func recordRetry(ctx context.Context, start time.Time) {
+	connector.RecordTiming(ctx, func(t *Timing) {
+		t.Retries++
+		t.RetryWait += time.Since(start)
+	})
+}
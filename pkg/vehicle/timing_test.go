@@ -0,0 +1,34 @@
+package vehicle
+
+import (
+	"context"
+	"testing"
+
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+func TestTiming(t *testing.T) {
+	car := connectWithoutSession(t)
+	ctx, timing := WithTiming(context.Background())
+
+	if err := car.StartSession(ctx, []universal.Domain{universal.Domain_DOMAIN_VEHICLE_SECURITY}); err != nil {
+		t.Fatal(err)
+	}
+	if timing.Handshake <= 0 || timing.RoundTrip != 0 {
+		t.Errorf("Handshake wasn't recorded separately: %s", timing)
+	}
+	if err := car.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if timing.Signing <= 0 || timing.RoundTrip <= 0 {
+		t.Errorf("Command wasn't recorded: %s", timing)
+	}
+	if timing.Retries != 0 || timing.RetryWait != 0 {
+		t.Errorf("Unexpected retries: %s", timing)
+	}
+
+	// Contexts without a Timing are unaffected.
+	if err := car.Unlock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
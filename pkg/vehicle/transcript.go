@@ -0,0 +1,67 @@
+package vehicle
+
+import (
+	"context"
+	"sync"
+
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+)
+
+// TranscriptMessage is a message that a Vehicle sent or received. Payload is the plaintext, before
+// encryption or after decryption; see [protocol.NewPayloadMessage] for its type.
+type TranscriptMessage struct {
+	Domain      universal.Domain
+	FromVehicle bool
+	Payload     []byte
+}
+
+// Transcript records the messages exchanged by Vehicle methods called with a context returned by
+// WithTranscript. Session handshakes aren't recorded.
+type Transcript struct {
+	lock     sync.Mutex
+	messages []TranscriptMessage
+}
+
+// Messages returns the messages recorded so far, in the order they were sent or received.
+func (t *Transcript) Messages() []TranscriptMessage {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]TranscriptMessage(nil), t.messages...)
+}
+
+type transcriptKey struct{}
+
+// WithTranscript returns a copy of ctx that records the messages exchanged by Vehicle methods
+// called with it, for debugging. Replies that report an error are recorded too.
+func WithTranscript(ctx context.Context) (context.Context, *Transcript) {
+	transcript := &Transcript{}
+	return context.WithValue(ctx, transcriptKey{}, transcript), transcript
+}
+
+// TranscriptFromContext returns the Transcript associated with ctx by WithTranscript, or nil if
+// there isn't one.
+func TranscriptFromContext(ctx context.Context) *Transcript {
+	transcript, _ := ctx.Value(transcriptKey{}).(*Transcript)
+	return transcript
+}
+
+// recordMessage adds a message to the Transcript of ctx, if it has one.
+func recordMessage(ctx context.Context, domain universal.Domain, fromVehicle bool, payload []byte) {
+	transcript := TranscriptFromContext(ctx)
+	if transcript == nil {
+		return
+	}
+	transcript.lock.Lock()
+	defer transcript.lock.Unlock()
+	transcript.messages = append(transcript.messages, TranscriptMessage{
+		Domain:      domain,
+		FromVehicle: fromVehicle,
+		Payload:     append([]byte(nil), payload...),
+	})
+}
+
+// recordReply adds reply, which the vehicle sent in response to a message, to the Transcript of
+// ctx, if it has one.
+func recordReply(ctx context.Context, reply *universal.RoutableMessage) {
+	recordMessage(ctx, reply.GetFromDestination().GetDomain(), true, reply.GetProtobufMessageAsBytes())
+}
@@ -0,0 +1,42 @@
+package vehicle
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
+	"github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/vcsec"
+)
+
+func TestTranscript(t *testing.T) {
+	car := connectWithoutSession(t)
+	ctx, transcript := WithTranscript(context.Background())
+
+	if err := car.StartSession(ctx, []universal.Domain{universal.Domain_DOMAIN_VEHICLE_SECURITY}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(transcript.Messages()); n != 0 {
+		t.Errorf("Handshake was recorded as %d messages", n)
+	}
+	if err := car.Lock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	messages := transcript.Messages()
+	if len(messages) < 2 || messages[0].FromVehicle || !messages[1].FromVehicle {
+		t.Fatalf("Expected a message and a reply, got %+v", messages)
+	}
+	for _, message := range messages {
+		if message.Domain != universal.Domain_DOMAIN_VEHICLE_SECURITY {
+			t.Errorf("Unexpected domain %s", message.Domain)
+		}
+	}
+	var request vcsec.UnsignedMessage
+	if err := proto.Unmarshal(messages[0].Payload, &request); err != nil {
+		t.Fatalf("Request isn't plaintext: %s", err)
+	}
+	if request.GetRKEAction() != vcsec.RKEAction_E_RKE_ACTION_LOCK {
+		t.Errorf("Unexpected request %v", &request)
+	}
+}
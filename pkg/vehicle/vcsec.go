@@ -8,7 +8,6 @@ import (
 	"context"
 	"crypto/ecdh"
 	"fmt"
-	"time"
 
 	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
@@ -68,6 +67,7 @@ func readUntil(ctx context.Context, recv protocol.Receiver, done isTerminalTest)
 	for {
 		select {
 		case reply := <-recv.Recv():
+			recordReply(ctx, reply)
 			fromVCSEC, err := unmarshalVCSECResponse(reply)
 			if err != nil {
 				return nil, err
@@ -98,7 +98,7 @@ func (v *Vehicle) getVCSECResult(ctx context.Context, payload []byte, auth conne
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
-		case <-time.After(v.dispatcher.RetryInterval()):
+		case <-v.clock.After(v.dispatcher.RetryInterval()):
 			continue
 		}
 	}
@@ -107,18 +107,23 @@ func (v *Vehicle) getVCSECResult(ctx context.Context, payload []byte, auth conne
 const slotNone = 0xFFFFFFFF
 
 func (v *Vehicle) getVCSECInfo(ctx context.Context, requestType vcsec.InformationRequestType, keySlot uint32) (*vcsec.FromVCSECMessage, error) {
-	payload := vcsec.UnsignedMessage{
-		SubMessage: &vcsec.UnsignedMessage_InformationRequest{
-			InformationRequest: &vcsec.InformationRequest{
-				InformationRequestType: requestType,
-			},
-		},
+	request := &vcsec.InformationRequest{
+		InformationRequestType: requestType,
 	}
 	if keySlot != slotNone {
-		payload.GetInformationRequest().Key = &vcsec.InformationRequest_Slot{
+		request.Key = &vcsec.InformationRequest_Slot{
 			Slot: keySlot,
 		}
 	}
+	return v.sendVCSECInformationRequest(ctx, request)
+}
+
+func (v *Vehicle) sendVCSECInformationRequest(ctx context.Context, request *vcsec.InformationRequest) (*vcsec.FromVCSECMessage, error) {
+	payload := vcsec.UnsignedMessage{
+		SubMessage: &vcsec.UnsignedMessage_InformationRequest{
+			InformationRequest: request,
+		},
+	}
 
 	encodedPayload, err := proto.Marshal(&payload)
 	if err != nil {
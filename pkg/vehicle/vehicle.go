@@ -4,13 +4,18 @@ import (
 	"context"
 	"crypto/ecdh"
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/protobuf/proto"
 
 	"github.com/teslamotors/vehicle-command/internal/authentication"
 	"github.com/teslamotors/vehicle-command/internal/dispatcher"
+	logger "github.com/teslamotors/vehicle-command/internal/log"
 	"github.com/teslamotors/vehicle-command/pkg/cache"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
 	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 
@@ -18,6 +23,8 @@ import (
 	universal "github.com/teslamotors/vehicle-command/pkg/protocol/protobuf/universalmessage"
 )
 
+var log = logger.Module(logger.ModuleVehicle)
+
 // DefaultFlags is a bitmask that controls what flags are set on requests.
 var DefaultFlags = uint32(1 << universal.Flags_FLAG_ENCRYPT_RESPONSE)
 
@@ -31,6 +38,41 @@ var (
 	ErrVehicleStateUnknown = errors.New("could not determine vehicle state")
 )
 
+// Busy faults often last a while, for example while the infotainment system installs a software
+// update, so Send backs off further after each one instead of retrying at the connector's usual
+// interval.
+var (
+	busyRetryInitialInterval = 2 * time.Second
+	busyRetryMaxInterval     = 15 * time.Second
+)
+
+// BusyError indicates the vehicle was still busy when the context's deadline left no time for
+// another attempt.
+type BusyError struct {
+	// Retries is the number of times the command was sent again after a busy fault.
+	Retries int
+	// RetryAfter is how long the caller should wait before trying again.
+	RetryAfter time.Duration
+	// Err is the last fault the vehicle returned.
+	Err error
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("vehicle still busy after %d retries: %s", e.Retries, e.Err)
+}
+
+func (e *BusyError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BusyError) MayHaveSucceeded() bool {
+	return false
+}
+
+func (e *BusyError) Temporary() bool {
+	return true
+}
+
 // sender provides an interface that handles the RoutableMessage protocol layer.
 type sender interface {
 	// Start causes the sender to listen for messages from the vehicle in a
@@ -50,8 +92,17 @@ type sender interface {
 	// and infotainment to allow subsequent commands to be authenticated.
 	StartSessions(ctx context.Context, domains []universal.Domain) error
 
+	// ResyncSession repeats the handshake with domain even if a session is already established.
+	ResyncSession(ctx context.Context, domain universal.Domain) error
+
+	// ResyncSessions calls ResyncSession for each of domains concurrently.
+	ResyncSessions(ctx context.Context, domains []universal.Domain) error
+
+	// HasSession returns true if authenticated messages can be sent to domain.
+	HasSession(domain universal.Domain) bool
+
 	Cache() []dispatcher.CacheEntry
-	LoadCache(entries []dispatcher.CacheEntry) error
+	LoadCache(entries []dispatcher.CacheEntry, counterMargin uint32) error
 
 	// Returns the recommended retransmission interval for the Connector
 	RetryInterval() time.Duration
@@ -64,33 +115,84 @@ type sender interface {
 type Vehicle struct {
 	Flags uint32
 
+	// DomainOverride, if set, routes every command to this domain instead of the domain that
+	// normally handles it. The vehicle rejects commands sent to the wrong domain, so this is only
+	// useful for protocol debugging and interoperability testing.
+	DomainOverride universal.Domain
+
+	// ResyncCounter, if true, makes Send repeat the session handshake and retry once when the
+	// vehicle rejects a command's anti-replay counter, which happens if the client's session state
+	// falls behind the vehicle's (for example, after a lost response or a stale session cache).
+	// NewVehicle enables it.
+	ResyncCounter bool
+
+	// LazySessions, if true, makes StartSession defer each domain's handshake until the first
+	// command sent to that domain. A client that turns out to only need VCSEC, for example, then
+	// doesn't wake infotainment.
+	LazySessions bool
+
+	// Capabilities, if set, describes the vehicle's optional hardware. Methods that send commands
+	// the vehicle can't execute return an UnsupportedVehicleError before contacting it. Fleet API
+	// clients can obtain Capabilities from the account package.
+	Capabilities Capabilities
+
+	// SkipCapabilityCheck, if true, sends commands regardless of Capabilities.
+	SkipCapabilityCheck bool
+
 	dispatcher sender
 	vin        string
+	clock      clock.Clock
 
 	conn       connector.Connector
 	authMethod connector.AuthMethod
 
 	keyAvailable bool
+	publicKey    []byte // Uncompressed public key of the client, if keyAvailable
+
+	busyRetries atomic.Int32
+
+	sessionLock     sync.Mutex
+	sessionsStarted bool
+	sessionDomains  []universal.Domain // Domains passed to StartSession; nil means all
+}
+
+// Option configures a Vehicle created by NewVehicle.
+type Option func(*Vehicle)
+
+// WithClock makes the Vehicle, and the session layer beneath it, wait between retries using c
+// instead of the system clock. Tests use it to skip retry delays.
+func WithClock(c clock.Clock) Option {
+	return func(v *Vehicle) {
+		v.clock = c
+	}
 }
 
 // NewVehicle creates a new Vehicle. The privateKey and sessionCache may be nil.
-func NewVehicle(conn connector.Connector, privateKey authentication.ECDHPrivateKey, sessionCache *cache.SessionCache) (*Vehicle, error) {
-	dispatch, err := dispatcher.New(conn, privateKey)
+func NewVehicle(conn connector.Connector, privateKey authentication.ECDHPrivateKey, sessionCache *cache.SessionCache, options ...Option) (*Vehicle, error) {
+	vin := conn.VIN()
+	vehicle := &Vehicle{
+		Flags:         DefaultFlags,
+		ResyncCounter: true,
+		vin:           vin,
+		clock:         clock.Real,
+		conn:          conn,
+		authMethod:    conn.PreferredAuthMethod(),
+		keyAvailable:  privateKey != nil,
+	}
+	for _, option := range options {
+		option(vehicle)
+	}
+	dispatch, err := dispatcher.New(conn, privateKey, dispatcher.WithClock(vehicle.clock))
 	if err != nil {
 		return nil, err
 	}
-	vin := conn.VIN()
-	vehicle := &Vehicle{
-		Flags:        DefaultFlags,
-		dispatcher:   dispatch,
-		vin:          vin,
-		conn:         conn,
-		authMethod:   conn.PreferredAuthMethod(),
-		keyAvailable: privateKey != nil,
+	vehicle.dispatcher = dispatch
+	if privateKey != nil {
+		vehicle.publicKey = privateKey.PublicBytes()
 	}
 	if sessionCache != nil {
 		if sessions, ok := sessionCache.GetEntry(vin); ok {
-			if err := dispatch.LoadCache(sessions); err != nil {
+			if err := dispatch.LoadCache(sessions, sessionCache.CounterMargin); err != nil {
 				return nil, err
 			}
 		}
@@ -114,11 +216,18 @@ func (v *Vehicle) PrivateKeyAvailable() bool {
 
 // Connect opens a connection to the vehicle.
 func (v *Vehicle) Connect(ctx context.Context) error {
+	defer recordPhase(ctx, time.Now(), func(t *Timing) *time.Duration { return &t.Connect })
 	return v.dispatcher.Start(ctx)
 }
 
+// SessionInfo requests the session info that domain holds for publicKey. The reply isn't
+// authenticated. See SessionDetails for a decoded version that uses the client's own key.
 func (v *Vehicle) SessionInfo(ctx context.Context, publicKey *ecdh.PublicKey, domain universal.Domain) (*signatures.SessionInfo, error) {
-	request := dispatcher.SessionInfoRequest(domain, publicKey.Bytes())
+	return v.sessionInfo(ctx, publicKey.Bytes(), domain)
+}
+
+func (v *Vehicle) sessionInfo(ctx context.Context, publicBytes []byte, domain universal.Domain) (*signatures.SessionInfo, error) {
+	request := dispatcher.SessionInfoRequest(domain, publicBytes)
 	recv, err := v.dispatcher.Send(ctx, request, connector.AuthMethodNone)
 	if err != nil {
 		return nil, err
@@ -146,7 +255,29 @@ func (v *Vehicle) SessionInfo(ctx context.Context, publicKey *ecdh.PublicKey, do
 // vehicle. If domains is nil, then the client will establish connections with all supported vehicle
 // subsystems. The client may specify a subset of domains if it does not need to connect to all of
 // them; for example, a client that only interacts with VCSEC can avoid waking infotainment.
+//
+// The handshakes with each domain run concurrently. If more than one fails, the error is a
+// [protocol.HandshakeError].
+//
+// Authenticated commands sent to a domain that isn't in domains fail with a [SessionError]. If
+// v.LazySessions is set, the handshakes are performed when the first command is sent to each
+// domain instead.
 func (v *Vehicle) StartSession(ctx context.Context, domains []universal.Domain) error {
+	v.sessionLock.Lock()
+	v.sessionsStarted = true
+	v.sessionDomains = nil
+	if domains != nil {
+		v.sessionDomains = append([]universal.Domain{}, domains...)
+	}
+	v.sessionLock.Unlock()
+	if v.LazySessions {
+		return nil
+	}
+	return v.startSessions(ctx, domains)
+}
+
+func (v *Vehicle) startSessions(ctx context.Context, domains []universal.Domain) error {
+	defer recordPhase(ctx, time.Now(), func(t *Timing) *time.Duration { return &t.Handshake })
 	for {
 		err := v.dispatcher.StartSessions(ctx, domains)
 		if err == nil {
@@ -156,9 +287,10 @@ func (v *Vehicle) StartSession(ctx context.Context, domains []universal.Domain)
 		if !protocol.ShouldRetry(err) {
 			return err
 		}
+		log.Debug("Retrying session handshake after error: %s", err)
 
 		select {
-		case <-time.After(v.dispatcher.RetryInterval()):
+		case <-v.clock.After(v.dispatcher.RetryInterval()):
 			continue
 		case <-ctx.Done():
 			return ctx.Err()
@@ -166,6 +298,28 @@ func (v *Vehicle) StartSession(ctx context.Context, domains []universal.Domain)
 	}
 }
 
+// RefreshSessions repeats the handshake with each domain in which v has an authenticated session,
+// replacing the session's clock and anti-replay counter with the vehicle's. A session loaded from
+// a cache may have gone stale while idle; refreshing it ahead of time spares the next command a
+// resync. Domains without a session are skipped.
+//
+// The handshakes run concurrently. If more than one fails, the error is a
+// [protocol.HandshakeError].
+//
+// Handshakes require the vehicle to be awake; see [Vehicle.IsAwake].
+func (v *Vehicle) RefreshSessions(ctx context.Context) error {
+	var domains []universal.Domain
+	for _, domain := range []universal.Domain{universal.Domain_DOMAIN_VEHICLE_SECURITY, universal.Domain_DOMAIN_INFOTAINMENT} {
+		if v.dispatcher.HasSession(domain) {
+			domains = append(domains, domain)
+		}
+	}
+	if len(domains) == 0 {
+		return nil
+	}
+	return v.dispatcher.ResyncSessions(ctx, domains)
+}
+
 // Disconnect closes the connection to v.
 // Calling this method invokes the underlying [connector.Connector.Close] method. The
 // [connector.Connector] interface definition requires that multiple calls to Close() are safe, and so
@@ -178,7 +332,44 @@ func (v *Vehicle) Disconnect() {
 	}
 }
 
+// targetDomain returns the domain that receives messages intended for domain.
+func (v *Vehicle) targetDomain(domain universal.Domain) universal.Domain {
+	if v.DomainOverride != universal.Domain_DOMAIN_BROADCAST {
+		return v.DomainOverride
+	}
+	return domain
+}
+
+// isBusyFault returns true if the vehicle was too busy to process a command, either because a
+// subsystem was busy or because the vehicle asked the client to wait.
+func isBusyFault(err error) bool {
+	if errors.Is(err, protocol.ErrBusy) {
+		return true
+	}
+	var msgErr *protocol.RoutableMessageError
+	return errors.As(err, &msgErr) && msgErr.Code == universal.MessageFault_E_MESSAGEFAULT_ERROR_BUSY
+}
+
+// BusyRetries returns the number of times Send has repeated a command because the vehicle was
+// busy.
+func (v *Vehicle) BusyRetries() int {
+	return int(v.busyRetries.Load())
+}
+
+// ResetBusyRetries sets the count returned by BusyRetries to zero. Clients that reuse a Vehicle
+// for several commands can call it before each one.
+func (v *Vehicle) ResetBusyRetries() {
+	v.busyRetries.Store(0)
+}
+
+// isCounterDesync returns true if the vehicle rejected a command's anti-replay counter.
+func isCounterDesync(err error) bool {
+	var msgErr *protocol.RoutableMessageError
+	return errors.As(err, &msgErr) && msgErr.Code == universal.MessageFault_E_MESSAGEFAULT_ERROR_INVALID_TOKEN_OR_COUNTER
+}
+
 func (v *Vehicle) getReceiver(ctx context.Context, domain universal.Domain, payload []byte, auth connector.AuthMethod) (protocol.Receiver, error) {
+	domain = v.targetDomain(domain)
 	message := universal.RoutableMessage{
 		ToDestination: &universal.Destination{
 			SubDestination: &universal.Destination_Domain{
@@ -195,6 +386,7 @@ func (v *Vehicle) getReceiver(ctx context.Context, domain universal.Domain, payl
 	if err != nil {
 		return nil, err
 	}
+	recordMessage(ctx, domain, false, payload)
 	return pendingResponse, nil
 }
 
@@ -204,9 +396,11 @@ func (v *Vehicle) trySend(ctx context.Context, domain universal.Domain, payload
 		return nil, err
 	}
 	defer recv.Close()
+	defer recordPhase(ctx, time.Now(), func(t *Timing) *time.Duration { return &t.RoundTrip })
 
 	select {
 	case response := <-recv.Recv():
+		recordReply(ctx, response)
 		return response.GetProtobufMessageAsBytes(), protocol.GetError(response)
 	case <-ctx.Done():
 		return nil, &protocol.CommandError{Err: ctx.Err(), PossibleSuccess: true, PossibleTemporary: true}
@@ -233,9 +427,24 @@ func (v *Vehicle) SendMessage(ctx context.Context, message *universal.RoutableMe
 //
 // The domain controls what vehicle subsystem receives the message, and auth controls how the
 // message is authenticated (if it all).
+//
+// If v.ResyncCounter is set and the vehicle rejects the message's anti-replay counter, Send
+// performs a new handshake and retries once.
+//
+// If the vehicle is busy, Send waits 2 seconds before retrying and doubles the delay after each
+// busy fault, up to 15 seconds. When the next attempt wouldn't start before ctx's deadline, Send
+// returns a [BusyError] right away rather than waiting for the deadline.
 func (v *Vehicle) Send(ctx context.Context, domain universal.Domain, payload []byte, auth connector.AuthMethod) ([]byte, error) {
+	if auth != connector.AuthMethodNone {
+		if err := v.ensureSession(ctx, v.targetDomain(domain)); err != nil {
+			return nil, err
+		}
+	}
 	payloadCopy := make([]byte, len(payload))
 	copy(payloadCopy, payload)
+	resynced := false
+	busyRetries := 0
+	busyDelay := busyRetryInitialInterval
 	for {
 		response, err := v.trySend(ctx, domain, payloadCopy, auth)
 
@@ -243,23 +452,70 @@ func (v *Vehicle) Send(ctx context.Context, domain universal.Domain, payload []b
 			return response, nil
 		}
 
+		if v.ResyncCounter && auth != connector.AuthMethodNone && isCounterDesync(err) {
+			if resynced {
+				return nil, err
+			}
+			resynced = true
+			target := v.targetDomain(domain)
+			log.Info("Vehicle rejected command counter; resynchronizing %s session", target)
+			resyncStart := time.Now()
+			resyncErr := v.dispatcher.ResyncSession(ctx, target)
+			recordPhase(ctx, resyncStart, func(t *Timing) *time.Duration { return &t.Handshake })
+			if resyncErr != nil {
+				log.Warning("Couldn't resynchronize %s session: %s", target, resyncErr)
+				return nil, err
+			}
+			recordRetry(ctx, time.Now())
+			continue
+		}
+
+		if isBusyFault(err) {
+			busyErr := &BusyError{Retries: busyRetries, RetryAfter: busyDelay, Err: err}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < busyDelay {
+				return nil, busyErr
+			}
+			log.Debug("Vehicle busy; retrying in %s", busyDelay)
+			waitStart := time.Now()
+			select {
+			case <-ctx.Done():
+				return nil, busyErr
+			case <-v.clock.After(busyDelay):
+			}
+			recordRetry(ctx, waitStart)
+			busyRetries++
+			v.busyRetries.Add(1)
+			busyDelay = min(2*busyDelay, busyRetryMaxInterval)
+			continue
+		}
+
 		if !protocol.ShouldRetry(err) {
 			return nil, err
 		}
 
+		waitStart := time.Now()
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
-		case <-time.After(v.dispatcher.RetryInterval()):
+		case <-v.clock.After(v.dispatcher.RetryInterval()):
+			recordRetry(ctx, waitStart)
 			continue
 		}
 	}
 }
 
+// Wakeup wakes the vehicle. Vehicles that are already awake aren't sent a wake request; see
+// [Vehicle.IsAwake].
 func (v *Vehicle) Wakeup(ctx context.Context) error {
 	if oapi, ok := v.conn.(connector.FleetAPIConnector); ok {
 		return oapi.Wakeup(ctx)
 	}
+	if v.conn != nil {
+		if awake, err := v.IsAwake(ctx); err == nil && awake {
+			log.Debug("Vehicle is already awake")
+			return nil
+		}
+	}
 	return v.wakeupRKE(ctx)
 }
 
@@ -269,7 +525,7 @@ func (v *Vehicle) UpdateCachedSessions(c *cache.SessionCache) error {
 
 func (v *Vehicle) LoadCachedSessions(c *cache.SessionCache) error {
 	if data, ok := c.GetEntry(v.vin); ok {
-		return v.dispatcher.LoadCache(data)
+		return v.dispatcher.LoadCache(data, c.CounterMargin)
 	}
 	return errors.New("VIN not in cache")
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/teslamotors/vehicle-command/internal/dispatcher"
+	"github.com/teslamotors/vehicle-command/pkg/clock"
 	"github.com/teslamotors/vehicle-command/pkg/connector"
 	"github.com/teslamotors/vehicle-command/pkg/protocol"
 
@@ -43,7 +44,13 @@ type testSender struct {
 	SendError error
 	errQueue  []error
 
+	lastMessage *universal.RoutableMessage
+
 	ConnectionErrors []error
+
+	// resyncs counts calls to ResyncSession, which invokes onResync if it's set.
+	resyncs  int
+	onResync func()
 }
 
 func (s *testSender) StartSessions(_ context.Context, _ []universal.Domain) error {
@@ -55,11 +62,35 @@ func (s *testSender) StartSessions(_ context.Context, _ []universal.Domain) erro
 	return nil
 }
 
+func (s *testSender) ResyncSession(_ context.Context, _ universal.Domain) error {
+	s.lock.Lock()
+	s.resyncs++
+	onResync := s.onResync
+	s.lock.Unlock()
+	if onResync != nil {
+		onResync()
+	}
+	return nil
+}
+
+func (s *testSender) ResyncSessions(ctx context.Context, domains []universal.Domain) error {
+	for _, domain := range domains {
+		if err := s.ResyncSession(ctx, domain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *testSender) HasSession(_ universal.Domain) bool {
+	return true
+}
+
 func (s *testSender) Cache() []dispatcher.CacheEntry {
 	return nil
 }
 
-func (s *testSender) LoadCache(_ []dispatcher.CacheEntry) error {
+func (s *testSender) LoadCache(_ []dispatcher.CacheEntry, _ uint32) error {
 	return nil
 }
 
@@ -93,7 +124,7 @@ func (s *testSender) SetMaxLatency(_ time.Duration) {}
 
 func newTestVehicle() (*Vehicle, *testSender) {
 	dispatch := newTestSender()
-	return &Vehicle{dispatcher: dispatch}, dispatch
+	return &Vehicle{dispatcher: dispatch, clock: clock.Real}, dispatch
 }
 
 func newTestSender() *testSender {
@@ -128,9 +159,10 @@ func (s *testSender) Stop() {
 	s.lock.Unlock()
 }
 
-func (s *testSender) Send(_ context.Context, _ *universal.RoutableMessage, _ connector.AuthMethod) (protocol.Receiver, error) {
+func (s *testSender) Send(_ context.Context, message *universal.RoutableMessage, _ connector.AuthMethod) (protocol.Receiver, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	s.lastMessage = message
 	if s.SendError != nil {
 		return nil, s.SendError
 	}
@@ -256,9 +288,100 @@ func TestVehicleRetryTimeout(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
 	defer cancel()
 
+	// The deadline doesn't leave time to retry, so Send gives up without waiting for it.
 	_, err := vehicle.Send(ctx, universal.Domain_DOMAIN_VEHICLE_SECURITY, nil, connector.AuthMethodNone)
-	if !errors.Is(err, context.DeadlineExceeded) {
-		t.Errorf("Unexpected error: %s", err)
+	var busyErr *BusyError
+	if !errors.As(err, &busyErr) {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if busyErr.Retries != 0 || busyErr.RetryAfter != busyRetryInitialInterval || !protocol.Temporary(err) {
+		t.Errorf("Unexpected busy error: %+v", busyErr)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("Send waited for the deadline")
+	}
+}
+
+func TestVehicleWaitIsBusy(t *testing.T) {
+	vehicle, dispatch := newTestVehicle()
+	if err := vehicle.Connect(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer vehicle.Disconnect()
+
+	// A vehicle that asks the client to wait, without a busy fault, is treated the same way.
+	dispatch.fixedResponse = &universal.RoutableMessage{
+		SignedMessageStatus: &universal.MessageStatus{
+			OperationStatus: universal.OperationStatus_E_OPERATIONSTATUS_WAIT,
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err := vehicle.Send(ctx, universal.Domain_DOMAIN_VEHICLE_SECURITY, nil, connector.AuthMethodNone)
+	var busyErr *BusyError
+	if !errors.As(err, &busyErr) || !errors.Is(err, protocol.ErrBusy) {
+		t.Fatalf("Expected BusyError, got %v", err)
+	}
+}
+
+func TestVehicleBusyBackoff(t *testing.T) {
+	fakeClock := clock.NewFake(time.Unix(1700000000, 0))
+	vehicle, dispatch := newTestVehicle()
+	vehicle.clock = fakeClock
+	if err := vehicle.Connect(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer vehicle.Disconnect()
+
+	dispatch.fixedResponse = &universal.RoutableMessage{
+		SignedMessageStatus: &universal.MessageStatus{
+			OperationStatus:    universal.OperationStatus_E_OPERATIONSTATUS_ERROR,
+			SignedMessageFault: universal.MessageFault_E_MESSAGEFAULT_ERROR_BUSY,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	type result struct {
+		response []byte
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		response, err := vehicle.Send(ctx, universal.Domain_DOMAIN_INFOTAINMENT, nil, connector.AuthMethodNone)
+		done <- result{response, err}
+	}()
+
+	// The delay doubles after each busy response until it reaches the maximum.
+	delays := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 15 * time.Second, 15 * time.Second}
+	for i, delay := range delays {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(delay - time.Millisecond)
+		if fakeClock.Waiters() != 1 {
+			t.Fatalf("Retry %d was sent before %s", i, delay)
+		}
+		if i == len(delays)-1 {
+			dispatch.lock.Lock()
+			dispatch.fixedResponse = &universal.RoutableMessage{
+				SignedMessageStatus: &universal.MessageStatus{},
+				Payload: &universal.RoutableMessage_ProtobufMessageAsBytes{
+					ProtobufMessageAsBytes: []byte("ok"),
+				},
+			}
+			dispatch.lock.Unlock()
+		}
+		fakeClock.Advance(time.Millisecond)
+	}
+
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("Unexpected error: %s", r.err)
+	}
+	if string(r.response) != "ok" {
+		t.Errorf("Unexpected response: %q", r.response)
+	}
+	if retries := vehicle.BusyRetries(); retries != len(delays) {
+		t.Errorf("Expected %d busy retries, got %d", len(delays), retries)
 	}
 }
 
@@ -279,7 +402,9 @@ func TestVehicleNoResponseTimeout(t *testing.T) {
 }
 
 func TestVehicleRetryFail(t *testing.T) {
+	fakeClock := clock.NewFake(time.Unix(1700000000, 0))
 	vehicle, dispatch := newTestVehicle()
+	vehicle.clock = fakeClock
 	if err := vehicle.Connect(context.Background()); err != nil {
 		t.Fatalf("Unexpected error: %s", err)
 	}
@@ -301,11 +426,120 @@ func TestVehicleRetryFail(t *testing.T) {
 	}
 	dispatch.EnqueueError(&protocol.RoutableMessageError{Code: universal.MessageFault_E_MESSAGEFAULT_ERROR_INSUFFICIENT_PRIVILEGES})
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 
-	_, err := vehicle.Send(ctx, universal.Domain_DOMAIN_VEHICLE_SECURITY, nil, connector.AuthMethodNone)
-	if errors.Is(err, context.DeadlineExceeded) {
+	done := make(chan error, 1)
+	go func() {
+		_, err := vehicle.Send(ctx, universal.Domain_DOMAIN_VEHICLE_SECURITY, nil, connector.AuthMethodNone)
+		done <- err
+	}()
+	// Each retriable error is followed by one wait, which is never longer than the busy backoff.
+	for range retriableErrors {
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(busyRetryMaxInterval)
+	}
+	if err := <-done; errors.Is(err, context.DeadlineExceeded) {
 		t.Errorf("Unexpected error: %s", err)
 	}
 }
+
+func counterDesyncResponse() *universal.RoutableMessage {
+	return &universal.RoutableMessage{
+		SignedMessageStatus: &universal.MessageStatus{
+			OperationStatus:    universal.OperationStatus_E_OPERATIONSTATUS_ERROR,
+			SignedMessageFault: universal.MessageFault_E_MESSAGEFAULT_ERROR_INVALID_TOKEN_OR_COUNTER,
+		},
+	}
+}
+
+func TestVehicleCounterResync(t *testing.T) {
+	vehicle, dispatch := newTestVehicle()
+	vehicle.ResyncCounter = true
+	if err := vehicle.Connect(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer vehicle.Disconnect()
+
+	dispatch.fixedResponse = counterDesyncResponse()
+	dispatch.onResync = func() {
+		dispatch.lock.Lock()
+		dispatch.fixedResponse = &universal.RoutableMessage{
+			SignedMessageStatus: &universal.MessageStatus{},
+			Payload: &universal.RoutableMessage_ProtobufMessageAsBytes{
+				ProtobufMessageAsBytes: []byte("ok"),
+			},
+		}
+		dispatch.lock.Unlock()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	response, err := vehicle.Send(ctx, universal.Domain_DOMAIN_INFOTAINMENT, nil, connector.AuthMethodHMAC)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if string(response) != "ok" {
+		t.Errorf("Unexpected response: %q", response)
+	}
+	if dispatch.resyncs != 1 {
+		t.Errorf("Expected one resync, got %d", dispatch.resyncs)
+	}
+}
+
+func TestVehicleCounterResyncOnce(t *testing.T) {
+	vehicle, dispatch := newTestVehicle()
+	vehicle.ResyncCounter = true
+	if err := vehicle.Connect(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer vehicle.Disconnect()
+
+	dispatch.fixedResponse = counterDesyncResponse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := vehicle.Send(ctx, universal.Domain_DOMAIN_INFOTAINMENT, nil, connector.AuthMethodHMAC)
+	if !isCounterDesync(err) {
+		t.Errorf("Expected counter error after resync, got %v", err)
+	}
+	if dispatch.resyncs != 1 {
+		t.Errorf("Expected one resync, got %d", dispatch.resyncs)
+	}
+}
+
+func TestVehicleCounterResyncDisabled(t *testing.T) {
+	vehicle, dispatch := newTestVehicle()
+	if err := vehicle.Connect(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer vehicle.Disconnect()
+
+	dispatch.fixedResponse = counterDesyncResponse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := vehicle.Send(ctx, universal.Domain_DOMAIN_INFOTAINMENT, nil, connector.AuthMethodHMAC); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if dispatch.resyncs != 0 {
+		t.Errorf("Expected no resync, got %d", dispatch.resyncs)
+	}
+}
+
+func TestDomainOverride(t *testing.T) {
+	vehicle, dispatch := newTestVehicle()
+	for _, override := range []universal.Domain{universal.Domain_DOMAIN_BROADCAST, universal.Domain_DOMAIN_INFOTAINMENT} {
+		vehicle.DomainOverride = override
+		if _, err := vehicle.getReceiver(context.Background(), universal.Domain_DOMAIN_VEHICLE_SECURITY, nil, connector.AuthMethodNone); err != nil {
+			t.Fatal(err)
+		}
+		expected := override
+		if override == universal.Domain_DOMAIN_BROADCAST {
+			expected = universal.Domain_DOMAIN_VEHICLE_SECURITY
+		}
+		if domain := dispatch.lastMessage.GetToDestination().GetDomain(); domain != expected {
+			t.Errorf("With override %s, expected destination %s, got %s", override, expected, domain)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Package version identifies the build of a program that uses this module, so that operators and
+// Tesla's servers can tell which release sent a request.
+//
+// Most information comes from [debug.ReadBuildInfo], which the Go toolchain populates from the
+// module version and, when building from a git checkout, the commit. Builds without VCS metadata
+// (for example, Docker builds that exclude .git) can supply it at link time:
+//
+//	go build -ldflags "-X github.com/teslamotors/vehicle-command/pkg/version.commit=$(git rev-parse HEAD) \
+//	    -X github.com/teslamotors/vehicle-command/pkg/version.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./...
+package version
+
+import (
+	_ "embed" // Used to embed the release version
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+var (
+	//go:embed version.txt
+	release string
+
+	// Set with -ldflags -X to override the values recorded by the Go toolchain.
+	version string
+	commit  string
+	date    string
+)
+
+// Info describes a build.
+type Info struct {
+	// Version is a semantic version such as "v0.4.0". Builds that aren't from a tagged module
+	// version report the release they're based on with a "-devel" suffix.
+	Version string `json:"version"`
+	// Commit is the git revision the build is from, if known.
+	Commit string `json:"commit,omitempty"`
+	// Date is when the build was made if set at link time, and otherwise the commit time, in RFC
+	// 3339 format.
+	Date string `json:"date,omitempty"`
+	// Modified is true if the working tree had uncommitted changes.
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Release returns the SDK release recorded in the source tree, such as "0.4.0".
+func Release() string {
+	return strings.TrimSpace(release)
+}
+
+// Get returns information about the running program's build.
+func Get() Info {
+	info := Info{
+		Version:   "v" + Release() + "-devel",
+		GoVersion: runtime.Version(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		if v := build.Main.Version; v != "" && v != "(devel)" {
+			info.Version = v
+		}
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.time":
+				info.Date = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if version != "" {
+		info.Version = version
+	}
+	if commit != "" {
+		info.Commit = commit
+	}
+	if date != "" {
+		info.Date = date
+	}
+	return info
+}
+
+// ShortCommit returns the first eight characters of i.Commit.
+func (i Info) ShortCommit() string {
+	if len(i.Commit) > 8 {
+		return i.Commit[:8]
+	}
+	return i.Commit
+}
+
+// String returns a one-line description such as "v0.4.0 (commit 0123abcd, 2024-05-01T00:00:00Z,
+// go1.23.0)".
+func (i Info) String() string {
+	details := []string{}
+	if i.Commit != "" {
+		commit := "commit " + i.ShortCommit()
+		if i.Modified {
+			commit += "+modified"
+		}
+		details = append(details, commit)
+	}
+	if i.Date != "" {
+		details = append(details, i.Date)
+	}
+	details = append(details, i.GoVersion)
+	return fmt.Sprintf("%s (%s)", i.Version, strings.Join(details, ", "))
+}
+
+// Program returns the name of the running program's main package, such as "tesla-http-proxy".
+func Program() string {
+	build, ok := debug.ReadBuildInfo()
+	if !ok || build.Path == "" {
+		return ""
+	}
+	path := strings.Split(build.Path, "/")
+	return path[len(path)-1]
+}
+
+// UserAgent returns the User-Agent header value that identifies this build to Tesla's servers,
+// such as "tesla-http-proxy/v0.4.0 tesla-sdk/0.4.0".
+//
+// Tesla asks that integrations name themselves in the User-Agent. If app is non-empty (for
+// example, "acme-fleet/2.1"), it's placed first.
+func UserAgent(app string) string {
+	var products []string
+	if app = strings.TrimSpace(app); app != "" {
+		products = append(products, app)
+	}
+	if program := Program(); program != "" {
+		products = append(products, program+"/"+Get().Version)
+	}
+	products = append(products, "tesla-sdk/"+Release())
+	return strings.Join(products, " ")
+}
+
+// Print writes the program name and build information to standard output, for use by -version
+// flags.
+func Print() {
+	program := Program()
+	if program == "" {
+		program = "tesla-sdk"
+	}
+	fmt.Printf("%s %s\n", program, Get())
+}
@@ -0,0 +1,56 @@
+package version
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRelease(t *testing.T) {
+	if r := Release(); r == "" || strings.ContainsAny(r, " \n") || strings.HasPrefix(r, "v") {
+		t.Errorf("Unexpected release %q", r)
+	}
+}
+
+func TestLinkTimeOverrides(t *testing.T) {
+	defer func(v, c, d string) { version, commit, date = v, c, d }(version, commit, date)
+	version = "v1.2.3"
+	commit = "0123456789abcdef0123456789abcdef01234567"
+	date = "2024-05-01T00:00:00Z"
+
+	info := Get()
+	if info.Version != version || info.Commit != commit || info.Date != date || info.GoVersion != runtime.Version() {
+		t.Errorf("Unexpected info %+v", info)
+	}
+	expected := "v1.2.3 (commit 01234567, 2024-05-01T00:00:00Z, " + runtime.Version() + ")"
+	if s := info.String(); s != expected {
+		t.Errorf("Expected %q, got %q", expected, s)
+	}
+	info.Modified = true
+	if s := info.String(); !strings.Contains(s, "commit 01234567+modified,") {
+		t.Errorf("Modified build not reported: %q", s)
+	}
+}
+
+func TestString(t *testing.T) {
+	info := Info{Version: "v0.4.0-devel", GoVersion: "go1.23.0"}
+	if s := info.String(); s != "v0.4.0-devel (go1.23.0)" {
+		t.Errorf("Unexpected string %q", s)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	library := "tesla-sdk/" + Release()
+	ua := UserAgent("")
+	if !strings.HasSuffix(ua, " "+library) && ua != library {
+		t.Errorf("User-Agent %q doesn't end with %q", ua, library)
+	}
+	if program := Program(); program != "" && !strings.HasPrefix(ua, program+"/"+Get().Version+" ") {
+		t.Errorf("User-Agent %q doesn't start with %s", ua, program)
+	}
+
+	ua = UserAgent(" acme-fleet/2.1 ")
+	if !strings.HasPrefix(ua, "acme-fleet/2.1 ") || !strings.HasSuffix(ua, library) {
+		t.Errorf("Unexpected User-Agent %q", ua)
+	}
+}